@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -17,7 +19,10 @@ import (
 	"sync"
 	"time"
 
+	"dialtone/dev/internal/plugincache"
+	"dialtone/dev/internal/pluginmanifest"
 	configv1 "dialtone/dev/plugins/config/src_v1/go"
+	diagnosticv1 "dialtone/dev/plugins/diagnostic/src_v1/go"
 	logs "dialtone/dev/plugins/logs/src_v1/go"
 	replv3 "dialtone/dev/plugins/repl/src_v3/go/repl"
 	tsnetv1 "dialtone/dev/plugins/tsnet/src_v1/go"
@@ -407,7 +412,19 @@ func main() {
 
 	switch command {
 	case "help", "-h", "--help":
+		if len(args) > 0 {
+			if err := printPluginHelp(args); err != nil {
+				logs.Error("%v", err)
+				os.Exit(1)
+			}
+			return
+		}
 		printDevUsage()
+	case "completion":
+		if err := printCompletion(args); err != nil {
+			logs.Error("%v", err)
+			os.Exit(1)
+		}
 	case "exit":
 		os.Exit(0)
 	case "install":
@@ -422,6 +439,13 @@ func main() {
 	case "branch":
 		runBranch(args)
 	case "plugins":
+		if len(args) > 0 && args[0] == "cache" {
+			if err := runPluginCache(args[1:]); err != nil {
+				logs.Error("%v", err)
+				os.Exit(1)
+			}
+			return
+		}
 		listPlugins()
 	case "dev":
 		if len(args) > 0 && args[0] == "install" {
@@ -527,67 +551,49 @@ func extractTransportFlags(command string, args []string) (targetHost string, ss
 	return targetHost, sshHost, filtered
 }
 
+var (
+	pluginRegistryOnce sync.Once
+	pluginRegistry     *pluginmanifest.Registry
+	pluginRegistryErr  error
+)
+
+// loadPluginRegistry reads the plugin.json manifests under plugins/ once per run.
+func loadPluginRegistry() (*pluginmanifest.Registry, error) {
+	pluginRegistryOnce.Do(func() {
+		pluginRegistry, pluginRegistryErr = pluginmanifest.Load("plugins")
+	})
+	return pluginRegistry, pluginRegistryErr
+}
+
+func resolvePluginRoute(command string, args []string) pluginmanifest.Route {
+	reg, err := loadPluginRegistry()
+	if err != nil {
+		logs.Warn("plugin manifests unavailable, routing via REPL: %v", err)
+		version, subcommand := pluginmanifest.SplitInvocation(args)
+		return pluginmanifest.Route{Plugin: command, Version: version, Subcommand: subcommand, Mode: pluginmanifest.ModeREPL}
+	}
+	return reg.Resolve(command, args)
+}
+
 func shouldRouteCommandViaREPL(command string, args []string) bool {
 	if logs.IsREPLContext() {
 		return false
 	}
 	switch strings.TrimSpace(command) {
-	case "", "help", "-h", "--help", "exit", "branch", "plugins", "dev":
-		return false
-	case "repl", "go", "bun":
+	case "", "help", "-h", "--help", "exit", "branch", "plugins", "dev", "completion":
 		return false
 	default:
-		return !shouldRunForegroundQuery(command, args)
+		return resolvePluginRoute(command, args).Mode == pluginmanifest.ModeREPL
 	}
 }
 
 func shouldRunForegroundQuery(command string, args []string) bool {
-	command = strings.TrimSpace(strings.ToLower(command))
-	subcommand := scaffoldSubcommand(args)
-	switch command {
-	case "cad":
-		switch subcommand {
-		case "test", "publish":
-			// CAD test/publish output is much easier to use when it streams directly.
-			return true
-		}
-	case "proc":
-		switch subcommand {
-		case "list", "ps":
-			return true
-		}
-	case "logs":
-		switch subcommand {
-		case "stream", "tail", "nats-status":
-			return true
-		}
-	case "wsl":
-		switch subcommand {
-		case "list", "ls", "status":
-			return true
-		}
-	}
-	return false
+	return resolvePluginRoute(command, args).Mode == pluginmanifest.ModeForeground
 }
 
 func scaffoldSubcommand(args []string) string {
-	if len(args) == 0 {
-		return ""
-	}
-	first := strings.TrimSpace(strings.ToLower(args[0]))
-	if strings.HasPrefix(first, "src_v") {
-		if len(args) < 2 {
-			return ""
-		}
-		return strings.TrimSpace(strings.ToLower(args[1]))
-	}
-	if len(args) >= 2 {
-		second := strings.TrimSpace(strings.ToLower(args[1]))
-		if strings.HasPrefix(second, "src_v") {
-			return first
-		}
-	}
-	return first
+	_, subcommand := pluginmanifest.SplitInvocation(args)
+	return subcommand
 }
 
 func resolveREPLTopicEnv() string {
@@ -1133,52 +1139,37 @@ func isLocalNATSURL(raw string) bool {
 	}
 }
 
+// bootstrapCheckNames are the diagnostic registry checks logged on startup.
+var bootstrapCheckNames = []string{
+	"core.env", "core.env-keys", "core.mesh-config", "core.go",
+	"core.nats", "core.repl-leader", "tsnet.tailnet", "core.cloudflared",
+	"core.bootstrap-http", "core.bootstrap-http-process",
+}
+
 func logBootstrapChecks() {
-	repoRoot := strings.TrimSpace(os.Getenv("DIALTONE_REPO_ROOT"))
 	srcRoot := strings.TrimSpace(os.Getenv("DIALTONE_SRC_ROOT"))
-	envDir := strings.TrimSpace(os.Getenv("DIALTONE_ENV"))
-	envFile := strings.TrimSpace(os.Getenv("DIALTONE_ENV_FILE"))
-	meshFile := strings.TrimSpace(os.Getenv("DIALTONE_MESH_CONFIG"))
-	goBin := strings.TrimSpace(os.Getenv("DIALTONE_GO_BIN"))
 
 	logs.System("Bootstrap checks:")
-	logPathCheck("repo root", repoRoot)
-	logPathCheck("src root", srcRoot)
-	logPathCheck("env dir", envDir)
-	logPathCheck("env json", envFile)
-	logPathCheck("mesh config", meshFile)
-	logPathCheck("go bin", goBin)
-
-	natsURL := strings.TrimSpace(os.Getenv("DIALTONE_REPL_NATS_URL"))
-	if natsURL == "" {
-		natsURL = "nats://127.0.0.1:4222"
-	}
-	logs.System("State:")
-	natsReachable := endpointReachable(natsURL, 700*time.Millisecond)
-	logs.System("- nats endpoint %s reachable=%t", natsURL, natsReachable)
-	logs.System("- repl leader process running=%t", replLeaderProcessRunning())
-
-	if active, provider, tailnet := tsnetv1.NativeTailnetConnected(); active {
-		logs.System("- tailnet active=true provider=%s tailnet=%s", provider, strings.TrimSpace(tailnet))
-	} else {
-		logs.System("- tailnet active=false")
+	statuses := map[string]diagnosticv1.Status{}
+	reg := diagnosticv1.NewRegistry()
+	err := diagnosticv1.RegisterCoreChecks(reg)
+	if err == nil {
+		err = tsnetv1.RegisterDiagnostics(reg)
 	}
-
-	logs.System("- cloudflare running=%t", cloudflaredRunning())
-
-	host := strings.TrimSpace(os.Getenv("DIALTONE_REPL_BOOTSTRAP_HTTP_HOST"))
-	if host == "" {
-		host = "127.0.0.1"
+	var plan []diagnosticv1.Check
+	if err == nil {
+		plan, err = reg.Plan(bootstrapCheckNames)
 	}
-	port := 8811
-	if raw := strings.TrimSpace(os.Getenv("DIALTONE_REPL_BOOTSTRAP_HTTP_PORT")); raw != "" {
-		if p, err := strconv.Atoi(raw); err == nil && p > 0 {
-			port = p
+	if err != nil {
+		logs.System("- diagnostic registry error: %v", err)
+	} else {
+		rep := diagnosticv1.RunHost(context.Background(), diagnosticv1.LocalTarget(), plan)
+		for _, r := range rep.Checks {
+			statuses[r.Name] = r.Status
+			logs.System("- %s %s: %s", r.Name, r.Status, r.Message)
 		}
 	}
-	bootstrapRunning := bootstrapHTTPReachable(host, port)
-	logs.System("- bootstrap http %s running=%t", fmt.Sprintf("http://%s:%d/install.sh", host, port), bootstrapRunning)
-	logs.System("- bootstrap http process running=%t", bootstrapHTTPProcessRunning())
+	natsReachable := statuses["core.nats"] == diagnosticv1.StatusPass
 
 	replScaffold := fileExists(filepath.Join(srcRoot, "plugins", "repl", "scaffold", "main.go"))
 	procScaffold := fileExists(filepath.Join(srcRoot, "plugins", "proc", "scaffold", "main.go"))
@@ -1191,59 +1182,6 @@ func logBootstrapChecks() {
 	logs.System("- repl injection ready=%t", natsReachable && replScaffold)
 	logs.System("- repl autostart enabled=%t", replAutostartEnabled())
 	logs.System("- bootstrap http autostart enabled=%t", replBootstrapHTTPAutostartEnabled())
-
-	validateEnvJSON(envFile)
-}
-
-func logPathCheck(label, path string) {
-	p := strings.TrimSpace(path)
-	if p == "" {
-		logs.System("- %s: <empty>", label)
-		return
-	}
-	info, err := os.Stat(p)
-	if err != nil {
-		logs.System("- %s: %s (missing)", label, p)
-		return
-	}
-	kind := "file"
-	if info.IsDir() {
-		kind = "dir"
-	}
-	logs.System("- %s: %s (%s)", label, p, kind)
-}
-
-func cloudflaredRunning() bool {
-	if runtime.GOOS == "windows" {
-		return false
-	}
-	cmd := exec.Command("pgrep", "-f", "cloudflared")
-	return cmd.Run() == nil
-}
-
-func replLeaderProcessRunning() bool {
-	if runtime.GOOS == "windows" {
-		return false
-	}
-	if processMatch(`plugins/repl/scaffold/main.go src_v3 leader`) {
-		return true
-	}
-	if processMatch(`src_v3 leader --embedded-nats`) {
-		return true
-	}
-	return false
-}
-
-func bootstrapHTTPProcessRunning() bool {
-	if runtime.GOOS == "windows" {
-		return false
-	}
-	return processMatch(`bootstrap-http --host`)
-}
-
-func processMatch(pattern string) bool {
-	cmd := exec.Command("pgrep", "-f", pattern)
-	return cmd.Run() == nil
 }
 
 func bootstrapHTTPReachable(host string, port int) bool {
@@ -1256,90 +1194,6 @@ func bootstrapHTTPReachable(host string, port int) bool {
 	return resp.StatusCode >= 200 && resp.StatusCode < 300
 }
 
-func validateEnvJSON(path string) {
-	path = strings.TrimSpace(path)
-	logs.System("env/dialtone.json checks:")
-	if path == "" {
-		logs.System("- format valid=false (env file path empty)")
-		return
-	}
-	raw, err := os.ReadFile(path)
-	if err != nil {
-		logs.System("- format valid=false (read error: %v)", err)
-		return
-	}
-	var doc map[string]any
-	if err := json.Unmarshal(raw, &doc); err != nil {
-		logs.System("- format valid=false (json error: %v)", err)
-		return
-	}
-	logs.System("- format valid=true")
-
-	requiredCore := []string{"DIALTONE_HOME", "DIALTONE_ENV", "DIALTONE_REPO_ROOT"}
-	for _, key := range requiredCore {
-		logs.System("- required %s present=%t", key, nonEmptyJSONValue(doc, key))
-	}
-	logs.System("- shared go cache configured=%t", nonEmptyJSONValue(doc, "DIALTONE_GO_CACHE_DIR"))
-	logs.System("- shared bun cache configured=%t", nonEmptyJSONValue(doc, "DIALTONE_BUN_CACHE_DIR"))
-
-	tsReady := nonEmptyJSONValue(doc, "TS_AUTHKEY") || (nonEmptyJSONValue(doc, "TS_API_KEY") && nonEmptyJSONValue(doc, "TS_TAILNET"))
-	logs.System("- tsnet bootstrap keys present=%t (TS_AUTHKEY or TS_API_KEY+TS_TAILNET)", tsReady)
-
-	cfReady := nonEmptyJSONValue(doc, "CF_TUNNEL_TOKEN_SHELL") || (nonEmptyJSONValue(doc, "CLOUDFLARE_API_TOKEN") && nonEmptyJSONValue(doc, "CLOUDFLARE_ACCOUNT_ID"))
-	logs.System("- cloudflare bootstrap keys present=%t (CF_TUNNEL_TOKEN_SHELL or CLOUDFLARE_API_TOKEN+CLOUDFLARE_ACCOUNT_ID)", cfReady)
-
-	nodesOK, nodeCount := meshNodesReady(doc["mesh_nodes"])
-	logs.System("- mesh_nodes valid=%t count=%d (each needs name+host+user)", nodesOK, nodeCount)
-}
-
-func nonEmptyJSONValue(doc map[string]any, key string) bool {
-	v, ok := doc[key]
-	if !ok || v == nil {
-		return false
-	}
-	switch t := v.(type) {
-	case string:
-		return strings.TrimSpace(t) != ""
-	case float64:
-		return true
-	case bool:
-		return true
-	default:
-		return fmt.Sprintf("%v", t) != ""
-	}
-}
-
-func meshNodesReady(raw any) (bool, int) {
-	nodes, ok := raw.([]any)
-	if !ok || len(nodes) == 0 {
-		return false, 0
-	}
-	count := 0
-	for _, n := range nodes {
-		m, ok := n.(map[string]any)
-		if !ok {
-			return false, count
-		}
-		if !mapValueNonEmpty(m, "name") || !mapValueNonEmpty(m, "host") || !mapValueNonEmpty(m, "user") {
-			return false, count
-		}
-		count++
-	}
-	return true, count
-}
-
-func mapValueNonEmpty(m map[string]any, key string) bool {
-	v, ok := m[key]
-	if !ok || v == nil {
-		return false
-	}
-	s, ok := v.(string)
-	if !ok {
-		return false
-	}
-	return strings.TrimSpace(s) != ""
-}
-
 func detectMissingForREPL() []MissingInstall {
 	missing := []MissingInstall{}
 	envDir := GetDialtoneEnv()
@@ -1421,12 +1275,16 @@ func printDevUsage() {
 	logs.Info("  --ssh-host <host>    Run any command over SSH transport via ssh src_v1 run --host <host>")
 	logs.Info("")
 	logs.Info("Dev orchestrator commands:")
-	logs.Info("  plugins              List available plugin scaffolds")
+	logs.Info("  plugins              List plugins from their plugin.json manifests")
+	logs.Info("  plugins cache status|clean|warm [plugin...]  Manage compiled plugin binaries")
+	logs.Info("  help [plugin] [ver]  Show this help, or a plugin's commands")
+	logs.Info("  completion bash|zsh  Print a shell completion script")
 	logs.Info("  branch <name>        Create or checkout a feature branch")
-	logs.Info("  help                 Show this help")
 	logs.Info("")
 	logs.Info("Plugin routing:")
 	logs.Info("  <plugin> <args...>   Run <plugin>/{scaffold|cli}/main.go in src/plugins (or scaffold.sh/cli.sh)")
+	logs.Info("                       plugins/<plugin>/<version>/plugin.json sets each command's mode:")
+	logs.Info("                       repl (dispatch via REPL), foreground (stream locally), direct")
 	logs.Info("")
 	logs.Info("Examples:")
 	logs.Info("  ./dialtone.sh go install --latest")
@@ -1440,105 +1298,209 @@ func printDevUsage() {
 }
 
 func listPlugins() {
-	roots := []string{"plugins"}
-	seen := map[string]struct{}{}
-	logs.Info("Available commands with scaffold:")
-	for _, root := range roots {
-		entries, err := os.ReadDir(root)
-		if err != nil {
-			continue
-		}
-		for _, entry := range entries {
-			if !entry.IsDir() {
-				continue
-			}
-			name := entry.Name()
-			if _, exists := seen[name]; exists {
-				continue
-			}
-			goScaffold := filepath.Join(root, name, "scaffold", "main.go")
-			cliScaffold := filepath.Join(root, name, "cli", "main.go")
-			shScaffold := filepath.Join(root, name, "scaffold.sh")
-			cliShell := filepath.Join(root, name, "cli.sh")
-			if fileExists(goScaffold) || fileExists(shScaffold) {
-				logs.Info("  - %s (%s)", name, root)
-				seen[name] = struct{}{}
-				continue
-			}
-			if fileExists(cliScaffold) || fileExists(cliShell) {
-				logs.Info("  - %s (%s)", name, root)
-				seen[name] = struct{}{}
-			}
-		}
+	reg, err := loadPluginRegistry()
+	if err != nil {
+		logs.Error("Failed to load plugin manifests: %v", err)
+		return
 	}
+	var b strings.Builder
+	reg.WritePluginList(&b)
+	logs.Info("Available plugins (name, versions, description):")
+	logs.Raw("%s", strings.TrimRight(b.String(), "\n"))
 }
 
-func runPluginScaffold(plugin string, args []string) error {
-	roots := []string{"plugins"}
-	pluginDir := ""
-	var fallbackDir string
-	for _, root := range roots {
-		candidate := filepath.Join(root, plugin)
-		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
-			goScaffold := filepath.Join(candidate, "scaffold", "main.go")
-			cliScaffold := filepath.Join(candidate, "cli", "main.go")
-			shScaffold := filepath.Join(candidate, "scaffold.sh")
-			if fileExists(goScaffold) || fileExists(cliScaffold) || fileExists(shScaffold) {
-				pluginDir = candidate
-				break
-			}
-			if fallbackDir == "" {
-				fallbackDir = candidate
-			}
-		}
+func printPluginHelp(args []string) error {
+	reg, err := loadPluginRegistry()
+	if err != nil {
+		return err
+	}
+	version := ""
+	if len(args) > 1 {
+		version = args[1]
+	}
+	var b strings.Builder
+	if err := reg.WritePluginHelp(&b, args[0], version); err != nil {
+		return err
 	}
-	if pluginDir == "" && fallbackDir != "" {
-		pluginDir = fallbackDir
+	logs.Raw("%s", strings.TrimRight(b.String(), "\n"))
+	return nil
+}
+
+// devBuiltinCommands are the dev.go commands offered by shell completion
+// alongside the plugins.
+var devBuiltinCommands = []string{"branch", "completion", "dev", "help", "install", "plugins"}
+
+func printCompletion(args []string) error {
+	shell := "bash"
+	if len(args) > 0 {
+		shell = args[0]
 	}
-	if pluginDir == "" {
+	reg, err := loadPluginRegistry()
+	if err != nil {
+		return err
+	}
+	script, err := reg.Completion(shell, devBuiltinCommands)
+	if err != nil {
+		return err
+	}
+	fmt.Print(script)
+	return nil
+}
+
+func runPluginScaffold(plugin string, args []string) error {
+	reg, err := loadPluginRegistry()
+	if err != nil {
+		return err
+	}
+	p, ok := reg.Lookup(plugin)
+	if !ok {
 		return logs.Errorf("unknown plugin: %s", plugin)
 	}
+	if p.Entry.Path == "" {
+		return logs.Errorf("plugin %s has no scaffold/cli main.go or scaffold.sh/cli.sh in candidate roots", plugin)
+	}
+	version, _ := pluginmanifest.SplitInvocation(args)
+	reqs := []Requirement{}
+	for _, req := range p.Requirements(version) {
+		reqs = append(reqs, Requirement{Tool: req.Tool, Version: req.Version})
+	}
+	if err := EnsureRequirements(reqs); err != nil {
+		return err
+	}
 
-	goScaffold := filepath.Join(pluginDir, "scaffold", "main.go")
-	cliScaffold := filepath.Join(pluginDir, "cli", "main.go")
-	if fileExists(goScaffold) {
-		var cmd *exec.Cmd
-		if fileExists(filepath.Join(pluginDir, "go.mod")) {
-			cmd = exec.Command("go", append([]string{"run", "./scaffold/main.go"}, args...)...)
-			cmd.Dir = pluginDir
-		} else {
-			cmd = exec.Command("go", append([]string{"run", "./" + filepath.ToSlash(goScaffold)}, args...)...)
+	// Go scaffolds run from the binary cache when their import graph is
+	// unchanged. On a miss this invocation still uses `go run` and hands the
+	// cache build to a detached `plugins cache warm` so it never delays exit.
+	var cmd *exec.Cmd
+	if target, ok := pluginBuildTarget(p); ok && !plugincache.Disabled() {
+		cache := pluginScaffoldCache()
+		key, err := cache.Key(context.Background(), target)
+		if err != nil {
+			logs.Warn("plugin cache skipped for %s: %v", plugin, err)
+		} else if bin, ok := cache.Lookup(target.Plugin, key); ok {
+			cmd = exec.Command(bin, args...)
+			cmd.Dir = target.Dir
+		} else if err := startPluginCacheWarm(cache, target.Plugin); err != nil && !errors.Is(err, plugincache.ErrBuildInProgress) {
+			logs.Warn("plugin cache build not started for %s: %v", plugin, err)
+		}
+	}
+	if cmd == nil {
+		switch {
+		case p.Entry.Kind == "shell":
+			cmd = exec.Command("bash", append([]string{filepath.Join(p.Dir, filepath.FromSlash(p.Entry.Path))}, args...)...)
+		case p.Entry.Module:
+			cmd = exec.Command("go", append([]string{"run", "./" + p.Entry.Path}, args...)...)
+			cmd.Dir = p.Dir
+		default:
+			cmd = exec.Command("go", append([]string{"run", "./" + filepath.ToSlash(filepath.Join(p.Dir, p.Entry.Path))}, args...)...)
 		}
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		return cmd.Run()
 	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
 
-	if fileExists(cliScaffold) {
-		var cmd *exec.Cmd
-		if fileExists(filepath.Join(pluginDir, "go.mod")) {
-			cmd = exec.Command("go", append([]string{"run", "./cli/main.go"}, args...)...)
-			cmd.Dir = pluginDir
-		} else {
-			cmd = exec.Command("go", append([]string{"run", "./" + filepath.ToSlash(cliScaffold)}, args...)...)
-		}
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		return cmd.Run()
+func pluginScaffoldCache() *plugincache.Cache {
+	return plugincache.New(filepath.Join(GetDialtoneEnv(), "cache", "scaffolds"))
+}
+
+// startPluginCacheWarm re-runs this dev binary as `plugins cache warm
+// <plugin>` in the background; its output lands in the cache's build.log.
+func startPluginCacheWarm(cache *plugincache.Cache, plugin string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
 	}
+	return cache.StartBuild(plugin, exec.Command(self, "plugins", "cache", "warm", plugin))
+}
 
-	shScaffold := filepath.Join(pluginDir, "scaffold.sh")
-	if fileExists(shScaffold) {
-		cmd := exec.Command("bash", append([]string{shScaffold}, args...)...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		return cmd.Run()
+// pluginBuildTarget mirrors how runPluginScaffold would `go run` the plugin.
+func pluginBuildTarget(p *pluginmanifest.Plugin) (plugincache.Target, bool) {
+	if p.Entry.Kind != "go" {
+		return plugincache.Target{}, false
+	}
+	if p.Entry.Module {
+		return plugincache.Target{Plugin: p.Name, Dir: p.Dir, Package: "./" + p.Entry.Path}, true
 	}
+	return plugincache.Target{Plugin: p.Name, Package: "./" + filepath.ToSlash(filepath.Join(p.Dir, p.Entry.Path))}, true
+}
 
-	return logs.Errorf("plugin %s has no scaffold/cli main.go or scaffold.sh/cli.sh in candidate roots", plugin)
+func runPluginCache(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: ./dialtone.sh plugins cache status|clean|warm [plugin...]")
+	}
+	reg, err := loadPluginRegistry()
+	if err != nil {
+		return err
+	}
+	names := args[1:]
+	selected := map[string]bool{}
+	for _, name := range names {
+		if _, ok := reg.Lookup(name); !ok {
+			return fmt.Errorf("unknown plugin: %s", name)
+		}
+		selected[name] = true
+	}
+	targets := []plugincache.Target{}
+	for _, p := range reg.Plugins() {
+		if len(selected) > 0 && !selected[p.Name] {
+			continue
+		}
+		if target, ok := pluginBuildTarget(p); ok {
+			targets = append(targets, target)
+		}
+	}
+	cache := pluginScaffoldCache()
+	ctx := context.Background()
+	switch args[0] {
+	case "status":
+		logs.Info("Plugin binary cache: %s", cache.Dir)
+		for _, st := range cache.Status(ctx, targets) {
+			detail := ""
+			switch {
+			case st.Error != "":
+				detail = st.Error
+			case st.Entry != nil:
+				detail = fmt.Sprintf("%s %.1fMB built %s", st.Key, float64(st.Entry.Size)/(1<<20), st.Entry.BuiltAt.Format(time.RFC3339))
+			default:
+				detail = st.Key
+			}
+			if st.Pending {
+				detail += " (building)"
+			}
+			logs.Raw("  %-12s %-8s %s", st.Plugin, st.State, detail)
+		}
+		return nil
+	case "clean":
+		removed, err := cache.Clean(names...)
+		if err != nil {
+			return err
+		}
+		logs.Info("Removed %d cached plugin binaries", removed)
+		return nil
+	case "warm":
+		failed := 0
+		for _, target := range targets {
+			start := time.Now()
+			key, err := cache.Key(ctx, target)
+			if err == nil {
+				_, err = cache.Build(ctx, target, key)
+			}
+			if err != nil {
+				failed++
+				logs.Warn("  %-12s failed: %v", target.Plugin, err)
+				continue
+			}
+			logs.Info("  %-12s ready (%s)", target.Plugin, time.Since(start).Round(time.Millisecond))
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d plugin(s) failed to build", failed)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown plugins cache command: %s", args[0])
+	}
 }
 
 func fileExists(path string) bool {
@@ -14,6 +14,7 @@ require (
 	github.com/nats-io/nats.go v1.48.0
 	github.com/pkg/sftp v1.13.10
 	github.com/shirou/gopsutil/v3 v3.24.5
+	github.com/tailscale/hujson v0.0.0-20221223112325-20486734a56a
 	github.com/vladimirvivien/go4vl v0.3.0
 	golang.org/x/crypto v0.48.0
 	google.golang.org/genai v1.48.0
@@ -108,7 +109,6 @@ require (
 	github.com/skeema/knownhosts v1.3.1 // indirect
 	github.com/tailscale/certstore v0.1.1-0.20231202035212-d3fa0460f47e // indirect
 	github.com/tailscale/go-winio v0.0.0-20231025203758-c4f33415bf55 // indirect
-	github.com/tailscale/hujson v0.0.0-20221223112325-20486734a56a // indirect
 	github.com/tailscale/peercred v0.0.0-20250107143737-35a0c7bd7edc // indirect
 	github.com/tailscale/web-client-prebuilt v0.0.0-20250124233751-d4cd19a26976 // indirect
 	github.com/tailscale/wireguard-go v0.0.0-20250716170648-1d0488a3d7da // indirect
@@ -0,0 +1,573 @@
+package modstate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, tx SchemaTx) error
+	Down    func(ctx context.Context, tx SchemaTx) error
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt string
+}
+
+type SchemaTx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// Migrations must stay append-only: never renumber or edit an applied entry,
+// add a new one instead. Up steps tolerate databases created by the
+// pre-migration EnsureSchema, which already had some of these columns.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up: func(ctx context.Context, tx SchemaTx) error {
+			return execSchema(ctx, tx,
+				`create table if not exists meta (
+					key text primary key,
+					value text not null,
+					updated_at text not null
+				);`,
+				`create table if not exists mods (
+					name text not null,
+					version text not null,
+					path text not null,
+					readme_path text not null default '',
+					manifest_path text not null default '',
+					has_main integer not null default 0,
+					has_cli integer not null default 0,
+					updated_at text not null,
+					primary key (name, version)
+				);`,
+				`create table if not exists mod_dependencies (
+					from_name text not null,
+					from_version text not null,
+					to_name text not null,
+					to_version text not null,
+					source text not null,
+					updated_at text not null,
+					primary key (from_name, from_version, to_name, to_version)
+				);`,
+				`create table if not exists mod_nix_packages (
+					mod_name text not null,
+					mod_version text not null,
+					selector text not null,
+					package_ref text not null,
+					updated_at text not null,
+					primary key (mod_name, mod_version, selector, package_ref)
+				);`,
+				`create table if not exists mod_env_vars (
+					mod_name text not null,
+					mod_version text not null,
+					key text not null,
+					required integer not null default 1,
+					updated_at text not null,
+					primary key (mod_name, mod_version, key)
+				);`,
+				`create table if not exists mod_test_policies (
+					mod_name text not null,
+					mod_version text not null,
+					requires_nix integer not null default 0,
+					serial_group text not null default '',
+					visible_tmux integer not null default 0,
+					updated_at text not null,
+					primary key (mod_name, mod_version)
+				);`,
+				`create table if not exists mod_launch_configs (
+					mod_name text not null,
+					mod_version text not null,
+					flake_shell text not null default '',
+					updated_at text not null,
+					primary key (mod_name, mod_version)
+				);`,
+				`create table if not exists runtime_env (
+					scope text not null,
+					key text not null,
+					value text not null,
+					updated_at text not null,
+					primary key (scope, key)
+				);`,
+				`create table if not exists state_values (
+					scope text not null,
+					key text not null,
+					value text not null,
+					updated_at text not null,
+					primary key (scope, key)
+				);`,
+				`create table if not exists command_queue (
+					id integer primary key autoincrement,
+					queue_name text not null,
+					status text not null,
+					kind text not null,
+					target text not null default '',
+					command_text text not null default '',
+					payload_json text not null default '',
+					result_text text not null default '',
+					error_text text not null default '',
+					created_at text not null,
+					started_at text not null default '',
+					finished_at text not null default ''
+				);`,
+				`create table if not exists command_runs (
+					id integer primary key autoincrement,
+					mod_name text not null,
+					mod_version text not null,
+					verb text not null default '',
+					command_text text not null,
+					args_json text not null default '[]',
+					transport text not null default '',
+					status text not null,
+					target text not null default '',
+					flake_shell text not null default '',
+					package_refs_json text not null default '[]',
+					shell_bus_id integer not null default 0,
+					pid integer not null default 0,
+					exit_code integer not null default 0,
+					runtime_ms integer not null default 0,
+					log_path text not null default '',
+					result_text text not null default '',
+					error_text text not null default '',
+					created_at text not null,
+					started_at text not null default '',
+					heartbeat_at text not null default '',
+					finished_at text not null default ''
+				);`,
+				`create index if not exists idx_command_runs_status on command_runs(status, id desc);`,
+				`create index if not exists idx_command_runs_mod on command_runs(mod_name, mod_version, id desc);`,
+				`create table if not exists mod_topology (
+					mod_name text not null,
+					mod_version text not null,
+					topo_rank integer not null,
+					updated_at text not null,
+					primary key (mod_name, mod_version)
+				);`,
+				`create table if not exists mod_test_steps (
+					plan_name text not null,
+					step_index integer not null,
+					mod_name text not null,
+					mod_version text not null,
+					topo_rank integer not null,
+					serial_group text not null default '',
+					requires_nix integer not null default 0,
+					visible_tmux integer not null default 0,
+					command_text text not null,
+					updated_at text not null,
+					primary key (plan_name, step_index)
+				);`,
+				`create table if not exists mod_test_runs (
+					id integer primary key autoincrement,
+					plan_name text not null,
+					status text not null,
+					total_steps integer not null default 0,
+					passed_steps integer not null default 0,
+					failed_steps integer not null default 0,
+					skipped_steps integer not null default 0,
+					stop_on_error integer not null default 1,
+					error_text text not null default '',
+					started_at text not null,
+					finished_at text not null default ''
+				);`,
+				`create table if not exists mod_test_run_steps (
+					run_id integer not null,
+					step_index integer not null,
+					mod_name text not null,
+					mod_version text not null,
+					serial_group text not null default '',
+					visible_tmux integer not null default 0,
+					requires_nix integer not null default 0,
+					status text not null,
+					exit_code integer not null default 0,
+					queue_id integer not null default 0,
+					command_text text not null,
+					output_text text not null default '',
+					error_text text not null default '',
+					started_at text not null,
+					finished_at text not null default '',
+					runtime_ms integer not null default 0,
+					primary key (run_id, step_index)
+				);`,
+				`create table if not exists protocol_runs (
+					id integer primary key autoincrement,
+					name text not null,
+					status text not null,
+					prompt_text text not null default '',
+					prompt_target text not null default '',
+					command_target text not null default '',
+					result_text text not null default '',
+					error_text text not null default '',
+					started_at text not null,
+					finished_at text not null default ''
+				);`,
+				`create table if not exists protocol_events (
+					run_id integer not null,
+					event_index integer not null,
+					event_type text not null,
+					queue_name text not null default '',
+					queue_row_id integer not null default 0,
+					pane_target text not null default '',
+					command_text text not null default '',
+					message_text text not null default '',
+					created_at text not null,
+					primary key (run_id, event_index)
+				);`,
+				`create table if not exists shell_bus (
+					id integer primary key autoincrement,
+					system text not null,
+					scope text not null,
+					subject text not null,
+					action text not null,
+					status text not null,
+					actor text not null,
+					session text not null default '',
+					pane text not null default '',
+					ref_id integer not null default 0,
+					body_json text not null default '',
+					created_at text not null,
+					updated_at text not null
+				);`,
+			)
+		},
+		Down: func(ctx context.Context, tx SchemaTx) error {
+			return execSchema(ctx, tx,
+				`drop table if exists shell_bus;`,
+				`drop table if exists protocol_events;`,
+				`drop table if exists protocol_runs;`,
+				`drop table if exists mod_test_run_steps;`,
+				`drop table if exists mod_test_runs;`,
+				`drop table if exists mod_test_steps;`,
+				`drop table if exists mod_topology;`,
+				`drop table if exists command_runs;`,
+				`drop table if exists command_queue;`,
+				`drop table if exists state_values;`,
+				`drop table if exists runtime_env;`,
+				`drop table if exists mod_launch_configs;`,
+				`drop table if exists mod_test_policies;`,
+				`drop table if exists mod_env_vars;`,
+				`drop table if exists mod_nix_packages;`,
+				`drop table if exists mod_dependencies;`,
+				`drop table if exists mods;`,
+				`drop table if exists meta;`,
+			)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "command_run_links",
+		Up: func(ctx context.Context, tx SchemaTx) error {
+			if err := ensureTableColumn(ctx, tx, "shell_bus", "command_run_id", "integer not null default 0"); err != nil {
+				return err
+			}
+			if err := ensureTableColumn(ctx, tx, "command_queue", "command_run_id", "integer not null default 0"); err != nil {
+				return err
+			}
+			return execSchema(ctx, tx,
+				`create index if not exists idx_shell_bus_command_run_id on shell_bus(command_run_id, id desc);`,
+				`create index if not exists idx_command_queue_command_run_id on command_queue(command_run_id, id desc);`,
+			)
+		},
+		Down: func(ctx context.Context, tx SchemaTx) error {
+			return execSchema(ctx, tx,
+				`drop index if exists idx_command_queue_command_run_id;`,
+				`drop index if exists idx_shell_bus_command_run_id;`,
+				`alter table command_queue drop column command_run_id;`,
+				`alter table shell_bus drop column command_run_id;`,
+			)
+		},
+	},
+	{
+		Version: 3,
+		Name:    "test_run_scheduling",
+		Up: func(ctx context.Context, tx SchemaTx) error {
+			return ensureTableColumns(ctx, tx, [][3]string{
+				{"mod_test_runs", "max_parallel", "integer not null default 0"},
+				{"mod_test_runs", "peak_concurrency", "integer not null default 0"},
+				{"mod_test_run_steps", "worker_slot", "integer not null default 0"},
+				{"mod_test_run_steps", "concurrency", "integer not null default 0"},
+				{"mod_test_run_steps", "wait_ms", "integer not null default 0"},
+			})
+		},
+		Down: func(ctx context.Context, tx SchemaTx) error {
+			return execSchema(ctx, tx,
+				`alter table mod_test_run_steps drop column wait_ms;`,
+				`alter table mod_test_run_steps drop column concurrency;`,
+				`alter table mod_test_run_steps drop column worker_slot;`,
+				`alter table mod_test_runs drop column peak_concurrency;`,
+				`alter table mod_test_runs drop column max_parallel;`,
+			)
+		},
+	},
+	{
+		Version: 4,
+		Name:    "test_run_affected_selection",
+		Up: func(ctx context.Context, tx SchemaTx) error {
+			return ensureTableColumns(ctx, tx, [][3]string{
+				{"mod_test_runs", "affected_ref", "text not null default ''"},
+				{"mod_test_run_steps", "trigger_files_json", "text not null default ''"},
+			})
+		},
+		Down: func(ctx context.Context, tx SchemaTx) error {
+			return execSchema(ctx, tx,
+				`alter table mod_test_run_steps drop column trigger_files_json;`,
+				`alter table mod_test_runs drop column affected_ref;`,
+			)
+		},
+	},
+	{
+		Version: 5,
+		Name:    "mod_version_ranges",
+		Up: func(ctx context.Context, tx SchemaTx) error {
+			if err := ensureTableColumn(ctx, tx, "mod_dependencies", "version_range", "text not null default ''"); err != nil {
+				return err
+			}
+			return execSchema(ctx, tx,
+				`create table if not exists mod_lock (
+					mod_name text primary key,
+					mod_version text not null,
+					required_by text not null default '',
+					updated_at text not null
+				);`,
+			)
+		},
+		Down: func(ctx context.Context, tx SchemaTx) error {
+			return execSchema(ctx, tx,
+				`drop table if exists mod_lock;`,
+				`alter table mod_dependencies drop column version_range;`,
+			)
+		},
+	},
+	{
+		Version: 6,
+		Name:    "tmux_pane_snapshots",
+		Up: func(ctx context.Context, tx SchemaTx) error {
+			return execSchema(ctx, tx,
+				`create table if not exists pane_snapshots (
+					id integer primary key autoincrement,
+					session text not null default '',
+					pane text not null,
+					ref_id integer not null default 0,
+					width integer not null default 0,
+					height integer not null default 0,
+					history_size integer not null default 0,
+					cursor_row integer not null default 0,
+					cursor_col integer not null default 0,
+					screen_json text not null,
+					text text not null default '',
+					created_at text not null
+				);`,
+				`create index if not exists idx_pane_snapshots_pane on pane_snapshots(pane, id);`,
+				`create table if not exists pane_snapshot_diffs (
+					id integer primary key autoincrement,
+					pane text not null,
+					from_id integer not null,
+					to_id integer not null,
+					scrolled integer not null default 0,
+					changed_rows integer not null default 0,
+					diff_json text not null,
+					text text not null default '',
+					created_at text not null
+				);`,
+				`create index if not exists idx_pane_snapshot_diffs_pane on pane_snapshot_diffs(pane, id);`,
+			)
+		},
+		Down: func(ctx context.Context, tx SchemaTx) error {
+			return execSchema(ctx, tx,
+				`drop table if exists pane_snapshot_diffs;`,
+				`drop table if exists pane_snapshots;`,
+			)
+		},
+	},
+}
+
+func Migrations() []Migration {
+	return append([]Migration(nil), migrations...)
+}
+
+func LatestSchemaVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+func CurrentSchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow(`select coalesce(max(version), 0) from schema_migrations`).Scan(&version)
+	return version, err
+}
+
+func MigrateUp(db *sql.DB) error {
+	return MigrateTo(db, LatestSchemaVersion())
+}
+
+// MigrateTo applies or reverts migrations until the schema is at target.
+// The whole walk runs in one BEGIN IMMEDIATE transaction on a dedicated
+// connection, so concurrent daemons serialize on the sqlite write lock and
+// the loser re-reads the applied version before doing anything.
+func MigrateTo(db *sql.DB, target int) error {
+	if target < 0 || target > LatestSchemaVersion() {
+		return fmt.Errorf("schema version %d out of range (0..%d)", target, LatestSchemaVersion())
+	}
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "PRAGMA busy_timeout=5000;"); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "begin immediate"); err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_, _ = conn.ExecContext(ctx, "rollback")
+		}
+	}()
+	if _, err := conn.ExecContext(ctx, `create table if not exists schema_migrations (
+		version integer primary key,
+		name text not null,
+		applied_at text not null
+	);`); err != nil {
+		return err
+	}
+	var current int
+	if err := conn.QueryRowContext(ctx, `select coalesce(max(version), 0) from schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+	for _, migration := range migrations {
+		if migration.Version <= current || migration.Version > target {
+			continue
+		}
+		if err := migration.Up(ctx, conn); err != nil {
+			return fmt.Errorf("migration %d %s up: %w", migration.Version, migration.Name, err)
+		}
+		if _, err := conn.ExecContext(ctx, `insert into schema_migrations(version, name, applied_at) values(?, ?, ?)`,
+			migration.Version, migration.Name, nowRFC3339()); err != nil {
+			return err
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version > current || migration.Version <= target {
+			continue
+		}
+		if err := migration.Down(ctx, conn); err != nil {
+			return fmt.Errorf("migration %d %s down: %w", migration.Version, migration.Name, err)
+		}
+		if _, err := conn.ExecContext(ctx, `delete from schema_migrations where version = ?`, migration.Version); err != nil {
+			return err
+		}
+	}
+	if target > 0 {
+		if _, err := conn.ExecContext(ctx, `insert into meta(key, value, updated_at) values('schema_version', ?, ?)
+			on conflict(key) do update set value=excluded.value, updated_at=excluded.updated_at`, fmt.Sprint(target), nowRFC3339()); err != nil {
+			return err
+		}
+	}
+	if _, err := conn.ExecContext(ctx, "commit"); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+func LoadMigrationStatus(db *sql.DB) ([]MigrationStatus, error) {
+	if _, err := db.Exec(`create table if not exists schema_migrations (
+		version integer primary key,
+		name text not null,
+		applied_at text not null
+	);`); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`select version, applied_at from schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	appliedAt := map[int]string{}
+	for rows.Next() {
+		var version int
+		var at string
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		appliedAt[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		at, ok := appliedAt[migration.Version]
+		out = append(out, MigrationStatus{Version: migration.Version, Name: migration.Name, Applied: ok, AppliedAt: at})
+	}
+	return out, nil
+}
+
+func execSchema(ctx context.Context, tx SchemaTx, stmts ...string) error {
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ensureTableColumns(ctx context.Context, tx SchemaTx, columns [][3]string) error {
+	for _, column := range columns {
+		if err := ensureTableColumn(ctx, tx, column[0], column[1], column[2]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ensureTableColumn(ctx context.Context, tx SchemaTx, tableName, columnName, columnDef string) error {
+	exists, err := tableHasColumn(ctx, tx, tableName, columnName)
+	if err != nil || exists {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("alter table %s add column %s %s", quoteSQLiteIdent(tableName), quoteSQLiteIdent(columnName), strings.TrimSpace(columnDef)))
+	return err
+}
+
+func tableHasColumn(ctx context.Context, tx SchemaTx, tableName, columnName string) (bool, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("pragma table_info(%s)", quoteSQLiteIdent(tableName)))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid int
+		var name string
+		var columnType string
+		var notNull int
+		var defaultValue sql.NullString
+		var pk int
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(columnName)) {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+func quoteSQLiteIdent(value string) string {
+	return `"` + strings.ReplaceAll(strings.TrimSpace(value), `"`, `""`) + `"`
+}
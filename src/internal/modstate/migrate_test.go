@@ -0,0 +1,156 @@
+package modstate
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestMigrationsReplayFromEmptyDatabase(t *testing.T) {
+	db := openMigrateTestDB(t, filepath.Join(t.TempDir(), "state.sqlite"))
+	for i, migration := range Migrations() {
+		if migration.Version != i+1 {
+			t.Fatalf("migration %q has version %d, want contiguous %d", migration.Name, migration.Version, i+1)
+		}
+		if err := MigrateTo(db, migration.Version); err != nil {
+			t.Fatalf("MigrateTo(%d) returned error: %v", migration.Version, err)
+		}
+		if version, err := CurrentSchemaVersion(db); err != nil || version != migration.Version {
+			t.Fatalf("CurrentSchemaVersion = %d, %v; want %d", version, err, migration.Version)
+		}
+	}
+	assertTableColumn(t, db, "shell_bus", "command_run_id", true)
+	assertTableColumn(t, db, "mod_test_run_steps", "trigger_files_json", true)
+	record, ok, err := LoadStateValue(db, "system", "missing")
+	if err != nil || ok {
+		t.Fatalf("LoadStateValue on migrated db = %+v ok=%v err=%v", record, ok, err)
+	}
+
+	for version := LatestSchemaVersion() - 1; version >= 0; version-- {
+		if err := MigrateTo(db, version); err != nil {
+			t.Fatalf("MigrateTo(%d) down returned error: %v", version, err)
+		}
+	}
+	assertTableExists(t, db, "shell_bus", false)
+	statuses, err := LoadMigrationStatus(db)
+	if err != nil {
+		t.Fatalf("LoadMigrationStatus returned error: %v", err)
+	}
+	for _, status := range statuses {
+		if status.Applied {
+			t.Fatalf("expected every migration to be reverted, got %+v", status)
+		}
+	}
+
+	if err := MigrateUp(db); err != nil {
+		t.Fatalf("MigrateUp after full down returned error: %v", err)
+	}
+	statuses, err = LoadMigrationStatus(db)
+	if err != nil {
+		t.Fatalf("LoadMigrationStatus returned error: %v", err)
+	}
+	for _, status := range statuses {
+		if !status.Applied || status.AppliedAt == "" {
+			t.Fatalf("expected every migration to be applied, got %+v", status)
+		}
+	}
+}
+
+func TestEnsureSchemaAdoptsPreMigrationDatabase(t *testing.T) {
+	db := openMigrateTestDB(t, filepath.Join(t.TempDir(), "state.sqlite"))
+	if _, err := db.Exec(`create table shell_bus (
+		id integer primary key autoincrement,
+		system text not null,
+		scope text not null,
+		subject text not null,
+		action text not null,
+		status text not null,
+		actor text not null,
+		session text not null default '',
+		pane text not null default '',
+		ref_id integer not null default 0,
+		body_json text not null default '',
+		created_at text not null,
+		updated_at text not null
+	);`); err != nil {
+		t.Fatalf("create legacy shell_bus: %v", err)
+	}
+	if _, err := db.Exec(`insert into shell_bus(system, scope, subject, action, status, actor, created_at, updated_at)
+		values('shell', 'desired', 'command', 'run', 'done', 'dialtone_mod', 'now', 'now')`); err != nil {
+		t.Fatalf("insert legacy shell_bus row: %v", err)
+	}
+	if err := EnsureSchema(db); err != nil {
+		t.Fatalf("EnsureSchema returned error: %v", err)
+	}
+	assertTableColumn(t, db, "shell_bus", "command_run_id", true)
+	rows, err := LoadShellBus(db, "desired", 10)
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("LoadShellBus after adopt = %+v err=%v", rows, err)
+	}
+	if version, err := CurrentSchemaVersion(db); err != nil || version != LatestSchemaVersion() {
+		t.Fatalf("CurrentSchemaVersion = %d, %v", version, err)
+	}
+}
+
+func TestMigrateUpIsSafeAcrossConcurrentConnections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.sqlite")
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for range 4 {
+		db := openMigrateTestDB(t, path)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- MigrateUp(db)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent MigrateUp returned error: %v", err)
+		}
+	}
+	db := openMigrateTestDB(t, path)
+	var count int
+	if err := db.QueryRow(`select count(*) from schema_migrations`).Scan(&count); err != nil {
+		t.Fatalf("count schema_migrations: %v", err)
+	}
+	if count != LatestSchemaVersion() {
+		t.Fatalf("schema_migrations rows = %d, want %d", count, LatestSchemaVersion())
+	}
+}
+
+func openMigrateTestDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func assertTableColumn(t *testing.T, db *sql.DB, table, column string, want bool) {
+	t.Helper()
+	got, err := tableHasColumn(context.Background(), db, table, column)
+	if err != nil {
+		t.Fatalf("tableHasColumn(%s, %s) returned error: %v", table, column, err)
+	}
+	if got != want {
+		t.Fatalf("tableHasColumn(%s, %s) = %v, want %v", table, column, got, want)
+	}
+}
+
+func assertTableExists(t *testing.T, db *sql.DB, table string, want bool) {
+	t.Helper()
+	var count int
+	if err := db.QueryRow(`select count(*) from sqlite_master where type = 'table' and name = ?`, table).Scan(&count); err != nil {
+		t.Fatalf("lookup table %s: %v", table, err)
+	}
+	if (count == 1) != want {
+		t.Fatalf("table %s exists=%v, want %v", table, count == 1, want)
+	}
+}
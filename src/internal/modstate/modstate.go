@@ -13,8 +13,8 @@ import (
 	"time"
 )
 
-const schemaVersion = "2"
-
+// ModRef names a dependency. Version is a constraint: an exact version
+// ("v1") or a range such as ">=v1 <v3" (see ParseVersionConstraint).
 type ModRef struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
@@ -59,6 +59,7 @@ type DependencyRecord struct {
 	FromVersion string
 	ToName      string
 	ToVersion   string
+	Range       string
 	Source      string
 }
 
@@ -89,13 +90,14 @@ type GraphNode struct {
 type GraphEdge struct {
 	From   GraphNode
 	To     GraphNode
+	Range  string
 	Source string
 }
 
 type StateRecord struct {
-	Scope string
-	Key   string
-	Value string
+	Scope string `json:"scope"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
 }
 
 type QueueRecord struct {
@@ -133,103 +135,110 @@ type TestStepRecord struct {
 }
 
 type ProtocolRunRecord struct {
-	ID            int64
-	Name          string
-	Status        string
-	PromptText    string
-	PromptTarget  string
-	CommandTarget string
-	ResultText    string
-	ErrorText     string
-	StartedAt     string
-	FinishedAt    string
+	ID            int64  `json:"id"`
+	Name          string `json:"name"`
+	Status        string `json:"status"`
+	PromptText    string `json:"prompt_text"`
+	PromptTarget  string `json:"prompt_target"`
+	CommandTarget string `json:"command_target"`
+	ResultText    string `json:"result_text"`
+	ErrorText     string `json:"error_text"`
+	StartedAt     string `json:"started_at"`
+	FinishedAt    string `json:"finished_at"`
 }
 
 type ProtocolEventRecord struct {
-	RunID       int64
-	EventIndex  int
-	EventType   string
-	QueueName   string
-	QueueRowID  int64
-	PaneTarget  string
-	CommandText string
-	MessageText string
-	CreatedAt   string
+	RunID       int64  `json:"run_id"`
+	EventIndex  int    `json:"event_index"`
+	EventType   string `json:"event_type"`
+	QueueName   string `json:"queue_name"`
+	QueueRowID  int64  `json:"queue_row_id"`
+	PaneTarget  string `json:"pane_target"`
+	CommandText string `json:"command_text"`
+	MessageText string `json:"message_text"`
+	CreatedAt   string `json:"created_at"`
 }
 
 type ModTestRunRecord struct {
-	ID           int64
-	PlanName     string
-	Status       string
-	TotalSteps   int
-	PassedSteps  int
-	FailedSteps  int
-	SkippedSteps int
-	StopOnError  bool
-	ErrorText    string
-	StartedAt    string
-	FinishedAt   string
+	ID              int64  `json:"id"`
+	PlanName        string `json:"plan_name"`
+	Status          string `json:"status"`
+	TotalSteps      int    `json:"total_steps"`
+	PassedSteps     int    `json:"passed_steps"`
+	FailedSteps     int    `json:"failed_steps"`
+	SkippedSteps    int    `json:"skipped_steps"`
+	StopOnError     bool   `json:"stop_on_error"`
+	MaxParallel     int    `json:"max_parallel"`
+	PeakConcurrency int    `json:"peak_concurrency"`
+	AffectedRef     string `json:"affected_ref"`
+	ErrorText       string `json:"error_text"`
+	StartedAt       string `json:"started_at"`
+	FinishedAt      string `json:"finished_at"`
 }
 
 type ModTestRunStepRecord struct {
-	RunID       int64
-	StepIndex   int
-	ModName     string
-	ModVersion  string
-	SerialGroup string
-	VisibleTmux bool
-	RequiresNix bool
-	Status      string
-	ExitCode    int
-	QueueID     int64
-	CommandText string
-	OutputText  string
-	ErrorText   string
-	StartedAt   string
-	FinishedAt  string
-	RuntimeMS   int64
+	RunID            int64  `json:"run_id"`
+	StepIndex        int    `json:"step_index"`
+	ModName          string `json:"mod_name"`
+	ModVersion       string `json:"mod_version"`
+	SerialGroup      string `json:"serial_group"`
+	VisibleTmux      bool   `json:"visible_tmux"`
+	RequiresNix      bool   `json:"requires_nix"`
+	Status           string `json:"status"`
+	ExitCode         int    `json:"exit_code"`
+	QueueID          int64  `json:"queue_id"`
+	CommandText      string `json:"command_text"`
+	OutputText       string `json:"output_text"`
+	ErrorText        string `json:"error_text"`
+	StartedAt        string `json:"started_at"`
+	FinishedAt       string `json:"finished_at"`
+	RuntimeMS        int64  `json:"runtime_ms"`
+	WorkerSlot       int    `json:"worker_slot"`
+	Concurrency      int    `json:"concurrency"`
+	WaitMS           int64  `json:"wait_ms"`
+	TriggerFilesJSON string `json:"trigger_files_json"`
 }
 
 type ShellBusRecord struct {
-	ID           int64
-	System       string
-	Scope        string
-	Subject      string
-	Action       string
-	Status       string
-	Actor        string
-	Session      string
-	Pane         string
-	RefID        int64
-	CommandRunID int64
-	BodyJSON     string
-	CreatedAt    string
-	UpdatedAt    string
+	ID           int64  `json:"id"`
+	System       string `json:"system"`
+	Scope        string `json:"scope"`
+	Subject      string `json:"subject"`
+	Action       string `json:"action"`
+	Status       string `json:"status"`
+	Actor        string `json:"actor"`
+	Session      string `json:"session"`
+	Pane         string `json:"pane"`
+	RefID        int64  `json:"ref_id"`
+	CommandRunID int64  `json:"command_run_id"`
+	BodyJSON     string `json:"body_json"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
 }
 
 type CommandRunRecord struct {
-	ID              int64
-	ModName         string
-	ModVersion      string
-	Verb            string
-	CommandText     string
-	ArgsJSON        string
-	Transport       string
-	Status          string
-	Target          string
-	FlakeShell      string
-	PackageRefsJSON string
-	ShellBusID      int64
-	PID             int
-	ExitCode        int
-	RuntimeMS       int64
-	LogPath         string
-	ResultText      string
-	ErrorText       string
-	CreatedAt       string
-	StartedAt       string
-	HeartbeatAt     string
-	FinishedAt      string
+	ID              int64  `json:"id"`
+	ModName         string `json:"mod_name"`
+	ModVersion      string `json:"mod_version"`
+	Verb            string `json:"verb"`
+	CommandText     string `json:"command_text"`
+	ArgsJSON        string `json:"args_json"`
+	Transport       string `json:"transport"`
+	Status          string `json:"status"`
+	Target          string `json:"target"`
+	FlakeShell      string `json:"flake_shell"`
+	PackageRefsJSON string `json:"package_refs_json"`
+	ShellBusID      int64  `json:"shell_bus_id"`
+	PID             int    `json:"pid"`
+	ExitCode        int    `json:"exit_code"`
+	RuntimeMS       int64  `json:"runtime_ms"`
+	LogPath         string `json:"log_path"`
+	ResultText      string `json:"result_text"`
+	ErrorText       string `json:"error_text"`
+	CreatedAt       string `json:"created_at"`
+	StartedAt       string `json:"started_at"`
+	HeartbeatAt     string `json:"heartbeat_at"`
+	FinishedAt      string `json:"finished_at"`
 }
 
 type SyncSummary struct {
@@ -240,6 +249,7 @@ type SyncSummary struct {
 	Manifests    int
 	Topology     int
 	TestSteps    int
+	Locked       int
 }
 
 type Entrypoint struct {
@@ -297,264 +307,13 @@ func Open(path string) (*sql.DB, error) {
 }
 
 func EnsureSchema(db *sql.DB) error {
-	stmts := []string{
-		`create table if not exists meta (
-			key text primary key,
-			value text not null,
-			updated_at text not null
-		);`,
-		`create table if not exists mods (
-			name text not null,
-			version text not null,
-			path text not null,
-			readme_path text not null default '',
-			manifest_path text not null default '',
-			has_main integer not null default 0,
-			has_cli integer not null default 0,
-			updated_at text not null,
-			primary key (name, version)
-		);`,
-		`create table if not exists mod_dependencies (
-			from_name text not null,
-			from_version text not null,
-			to_name text not null,
-			to_version text not null,
-			source text not null,
-			updated_at text not null,
-			primary key (from_name, from_version, to_name, to_version)
-		);`,
-		`create table if not exists mod_nix_packages (
-			mod_name text not null,
-			mod_version text not null,
-			selector text not null,
-			package_ref text not null,
-			updated_at text not null,
-			primary key (mod_name, mod_version, selector, package_ref)
-		);`,
-		`create table if not exists mod_env_vars (
-			mod_name text not null,
-			mod_version text not null,
-			key text not null,
-			required integer not null default 1,
-			updated_at text not null,
-			primary key (mod_name, mod_version, key)
-		);`,
-		`create table if not exists mod_test_policies (
-			mod_name text not null,
-			mod_version text not null,
-			requires_nix integer not null default 0,
-			serial_group text not null default '',
-			visible_tmux integer not null default 0,
-			updated_at text not null,
-			primary key (mod_name, mod_version)
-		);`,
-		`create table if not exists mod_launch_configs (
-			mod_name text not null,
-			mod_version text not null,
-			flake_shell text not null default '',
-			updated_at text not null,
-			primary key (mod_name, mod_version)
-		);`,
-		`create table if not exists runtime_env (
-			scope text not null,
-			key text not null,
-			value text not null,
-			updated_at text not null,
-			primary key (scope, key)
-		);`,
-		`create table if not exists state_values (
-			scope text not null,
-			key text not null,
-			value text not null,
-			updated_at text not null,
-			primary key (scope, key)
-		);`,
-		`create table if not exists command_queue (
-			id integer primary key autoincrement,
-			command_run_id integer not null default 0,
-			queue_name text not null,
-			status text not null,
-			kind text not null,
-			target text not null default '',
-			command_text text not null default '',
-			payload_json text not null default '',
-			result_text text not null default '',
-			error_text text not null default '',
-			created_at text not null,
-			started_at text not null default '',
-			finished_at text not null default ''
-		);`,
-		`create table if not exists command_runs (
-			id integer primary key autoincrement,
-			mod_name text not null,
-			mod_version text not null,
-			verb text not null default '',
-			command_text text not null,
-			args_json text not null default '[]',
-			transport text not null default '',
-			status text not null,
-			target text not null default '',
-			flake_shell text not null default '',
-			package_refs_json text not null default '[]',
-			shell_bus_id integer not null default 0,
-			pid integer not null default 0,
-			exit_code integer not null default 0,
-			runtime_ms integer not null default 0,
-			log_path text not null default '',
-			result_text text not null default '',
-			error_text text not null default '',
-			created_at text not null,
-			started_at text not null default '',
-			heartbeat_at text not null default '',
-			finished_at text not null default ''
-		);`,
-		`create index if not exists idx_command_runs_status on command_runs(status, id desc);`,
-		`create index if not exists idx_command_runs_mod on command_runs(mod_name, mod_version, id desc);`,
-		`create table if not exists mod_topology (
-			mod_name text not null,
-			mod_version text not null,
-			topo_rank integer not null,
-			updated_at text not null,
-			primary key (mod_name, mod_version)
-		);`,
-		`create table if not exists mod_test_steps (
-			plan_name text not null,
-			step_index integer not null,
-			mod_name text not null,
-			mod_version text not null,
-			topo_rank integer not null,
-			serial_group text not null default '',
-			requires_nix integer not null default 0,
-			visible_tmux integer not null default 0,
-			command_text text not null,
-			updated_at text not null,
-			primary key (plan_name, step_index)
-		);`,
-		`create table if not exists mod_test_runs (
-			id integer primary key autoincrement,
-			plan_name text not null,
-			status text not null,
-			total_steps integer not null default 0,
-			passed_steps integer not null default 0,
-			failed_steps integer not null default 0,
-			skipped_steps integer not null default 0,
-			stop_on_error integer not null default 1,
-			error_text text not null default '',
-			started_at text not null,
-			finished_at text not null default ''
-		);`,
-		`create table if not exists mod_test_run_steps (
-			run_id integer not null,
-			step_index integer not null,
-			mod_name text not null,
-			mod_version text not null,
-			serial_group text not null default '',
-			visible_tmux integer not null default 0,
-			requires_nix integer not null default 0,
-			status text not null,
-			exit_code integer not null default 0,
-			queue_id integer not null default 0,
-			command_text text not null,
-			output_text text not null default '',
-			error_text text not null default '',
-			started_at text not null,
-			finished_at text not null default '',
-			runtime_ms integer not null default 0,
-			primary key (run_id, step_index)
-		);`,
-		`create table if not exists protocol_runs (
-			id integer primary key autoincrement,
-			name text not null,
-			status text not null,
-			prompt_text text not null default '',
-			prompt_target text not null default '',
-			command_target text not null default '',
-			result_text text not null default '',
-			error_text text not null default '',
-			started_at text not null,
-			finished_at text not null default ''
-		);`,
-		`create table if not exists protocol_events (
-			run_id integer not null,
-			event_index integer not null,
-			event_type text not null,
-			queue_name text not null default '',
-			queue_row_id integer not null default 0,
-			pane_target text not null default '',
-			command_text text not null default '',
-			message_text text not null default '',
-			created_at text not null,
-			primary key (run_id, event_index)
-		);`,
-		`create table if not exists shell_bus (
-			id integer primary key autoincrement,
-			system text not null,
-			scope text not null,
-			subject text not null,
-			action text not null,
-			status text not null,
-			actor text not null,
-			session text not null default '',
-			pane text not null default '',
-			ref_id integer not null default 0,
-			command_run_id integer not null default 0,
-			body_json text not null default '',
-			created_at text not null,
-			updated_at text not null
-		);`,
-	}
-	for _, stmt := range stmts {
-		if _, err := db.Exec(stmt); err != nil {
-			return err
-		}
-	}
-	if err := ensureTableColumn(db, "shell_bus", "command_run_id", "integer not null default 0"); err != nil {
-		return err
-	}
-	if err := ensureTableColumn(db, "command_queue", "command_run_id", "integer not null default 0"); err != nil {
-		return err
-	}
-	if _, err := db.Exec(`create index if not exists idx_shell_bus_command_run_id on shell_bus(command_run_id, id desc)`); err != nil {
-		return err
-	}
-	if _, err := db.Exec(`create index if not exists idx_command_queue_command_run_id on command_queue(command_run_id, id desc)`); err != nil {
-		return err
-	}
-	_, err := db.Exec(`insert into meta(key, value, updated_at) values('schema_version', ?, ?)
-		on conflict(key) do update set value=excluded.value, updated_at=excluded.updated_at`, schemaVersion, nowRFC3339())
-	return err
-}
-
-func ensureTableColumn(db *sql.DB, tableName, columnName, columnDef string) error {
-	rows, err := db.Query(fmt.Sprintf("pragma table_info(%s)", quoteSQLiteIdent(tableName)))
-	if err != nil {
-		return err
+	if db == nil {
+		return fmt.Errorf("sqlite db is required")
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var cid int
-		var name string
-		var columnType string
-		var notNull int
-		var defaultValue sql.NullString
-		var pk int
-		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
-			return err
-		}
-		if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(columnName)) {
-			return nil
-		}
+	if version, err := CurrentSchemaVersion(db); err == nil && version >= LatestSchemaVersion() {
+		return nil
 	}
-	if err := rows.Err(); err != nil {
-		return err
-	}
-	_, err = db.Exec(fmt.Sprintf("alter table %s add column %s %s", quoteSQLiteIdent(tableName), quoteSQLiteIdent(columnName), strings.TrimSpace(columnDef)))
-	return err
-}
-
-func quoteSQLiteIdent(value string) string {
-	return `"` + strings.ReplaceAll(strings.TrimSpace(value), `"`, `""`) + `"`
+	return MigrateUp(db)
 }
 
 func SyncRepo(db *sql.DB, repoRoot string, env map[string]string) (SyncSummary, error) {
@@ -565,6 +324,10 @@ func SyncRepo(db *sql.DB, repoRoot string, env map[string]string) (SyncSummary,
 	if err != nil {
 		return SyncSummary{}, err
 	}
+	lock, deps, err := ResolveVersions(mods, deps)
+	if err != nil {
+		return SyncSummary{}, err
+	}
 	topology, err := BuildTopology(mods, deps)
 	if err != nil {
 		return SyncSummary{}, err
@@ -589,6 +352,7 @@ func SyncRepo(db *sql.DB, repoRoot string, env map[string]string) (SyncSummary,
 		"delete from mod_launch_configs",
 		"delete from mod_topology",
 		"delete from mod_test_steps",
+		"delete from mod_lock",
 	} {
 		if _, err = tx.Exec(stmt); err != nil {
 			return SyncSummary{}, err
@@ -607,9 +371,16 @@ func SyncRepo(db *sql.DB, repoRoot string, env map[string]string) (SyncSummary,
 		}
 	}
 	for _, dep := range deps {
-		if _, err = tx.Exec(`insert into mod_dependencies(from_name, from_version, to_name, to_version, source, updated_at)
-			values(?, ?, ?, ?, ?, ?)`,
-			dep.FromName, dep.FromVersion, dep.ToName, dep.ToVersion, dep.Source, timestamp); err != nil {
+		if _, err = tx.Exec(`insert into mod_dependencies(from_name, from_version, to_name, to_version, version_range, source, updated_at)
+			values(?, ?, ?, ?, ?, ?, ?)`,
+			dep.FromName, dep.FromVersion, dep.ToName, dep.ToVersion, dep.Range, dep.Source, timestamp); err != nil {
+			return SyncSummary{}, err
+		}
+	}
+	for _, item := range lock {
+		if _, err = tx.Exec(`insert into mod_lock(mod_name, mod_version, required_by, updated_at)
+			values(?, ?, ?, ?)`,
+			item.ModName, item.ModVersion, item.RequiredBy, timestamp); err != nil {
 			return SyncSummary{}, err
 		}
 	}
@@ -694,6 +465,7 @@ func SyncRepo(db *sql.DB, repoRoot string, env map[string]string) (SyncSummary,
 		Manifests:    len(manifests),
 		Topology:     len(topology),
 		TestSteps:    len(testSteps),
+		Locked:       len(lock),
 	}, nil
 }
 
@@ -761,6 +533,7 @@ func ScanRepo(repoRoot string) ([]ModRecord, map[string]Manifest, []DependencyRe
 					FromVersion: manifest.Version,
 					ToName:      strings.TrimSpace(dep.Name),
 					ToVersion:   strings.TrimSpace(dep.Version),
+					Range:       strings.TrimSpace(dep.Version),
 					Source:      "mod.json",
 				})
 			}
@@ -786,7 +559,7 @@ func ScanRepo(repoRoot string) ([]ModRecord, map[string]Manifest, []DependencyRe
 }
 
 func LoadGraph(db *sql.DB) ([]GraphEdge, error) {
-	rows, err := db.Query(`select from_name, from_version, to_name, to_version, source
+	rows, err := db.Query(`select from_name, from_version, to_name, to_version, version_range, source
 		from mod_dependencies
 		order by from_name, from_version, to_name, to_version`)
 	if err != nil {
@@ -796,7 +569,7 @@ func LoadGraph(db *sql.DB) ([]GraphEdge, error) {
 	var edges []GraphEdge
 	for rows.Next() {
 		var edge GraphEdge
-		if err := rows.Scan(&edge.From.Name, &edge.From.Version, &edge.To.Name, &edge.To.Version, &edge.Source); err != nil {
+		if err := rows.Scan(&edge.From.Name, &edge.From.Version, &edge.To.Name, &edge.To.Version, &edge.Range, &edge.Source); err != nil {
 			return nil, err
 		}
 		edges = append(edges, edge)
@@ -804,6 +577,25 @@ func LoadGraph(db *sql.DB) ([]GraphEdge, error) {
 	return edges, rows.Err()
 }
 
+func LoadLock(db *sql.DB) ([]LockRecord, error) {
+	rows, err := db.Query(`select mod_name, mod_version, required_by
+		from mod_lock
+		order by mod_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []LockRecord{}
+	for rows.Next() {
+		var record LockRecord
+		if err := rows.Scan(&record.ModName, &record.ModVersion, &record.RequiredBy); err != nil {
+			return nil, err
+		}
+		out = append(out, record)
+	}
+	return out, rows.Err()
+}
+
 func LoadRuntimeEnv(db *sql.DB, scope string) ([]EnvRecord, error) {
 	rows, err := db.Query(`select scope, key, value from runtime_env where scope = ? order by key`, strings.TrimSpace(scope))
 	if err != nil {
@@ -1255,7 +1047,7 @@ func LoadModTestRuns(db *sql.DB, limit int) ([]ModTestRunRecord, error) {
 	if limit <= 0 {
 		limit = 20
 	}
-	rows, err := db.Query(`select id, plan_name, status, total_steps, passed_steps, failed_steps, skipped_steps, stop_on_error, error_text, started_at, finished_at
+	rows, err := db.Query(`select id, plan_name, status, total_steps, passed_steps, failed_steps, skipped_steps, stop_on_error, max_parallel, peak_concurrency, affected_ref, error_text, started_at, finished_at
 		from mod_test_runs
 		order by id desc
 		limit ?`, limit)
@@ -1269,7 +1061,7 @@ func LoadModTestRuns(db *sql.DB, limit int) ([]ModTestRunRecord, error) {
 		var stopOnError int
 		if err := rows.Scan(
 			&record.ID, &record.PlanName, &record.Status, &record.TotalSteps, &record.PassedSteps,
-			&record.FailedSteps, &record.SkippedSteps, &stopOnError, &record.ErrorText, &record.StartedAt, &record.FinishedAt,
+			&record.FailedSteps, &record.SkippedSteps, &stopOnError, &record.MaxParallel, &record.PeakConcurrency, &record.AffectedRef, &record.ErrorText, &record.StartedAt, &record.FinishedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1285,11 +1077,11 @@ func LoadModTestRun(db *sql.DB, runID int64) (ModTestRunRecord, bool, error) {
 	}
 	var record ModTestRunRecord
 	var stopOnError int
-	err := db.QueryRow(`select id, plan_name, status, total_steps, passed_steps, failed_steps, skipped_steps, stop_on_error, error_text, started_at, finished_at
+	err := db.QueryRow(`select id, plan_name, status, total_steps, passed_steps, failed_steps, skipped_steps, stop_on_error, max_parallel, peak_concurrency, affected_ref, error_text, started_at, finished_at
 		from mod_test_runs
 		where id = ?`, runID).Scan(
 		&record.ID, &record.PlanName, &record.Status, &record.TotalSteps, &record.PassedSteps,
-		&record.FailedSteps, &record.SkippedSteps, &stopOnError, &record.ErrorText, &record.StartedAt, &record.FinishedAt,
+		&record.FailedSteps, &record.SkippedSteps, &stopOnError, &record.MaxParallel, &record.PeakConcurrency, &record.AffectedRef, &record.ErrorText, &record.StartedAt, &record.FinishedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -1306,7 +1098,8 @@ func LoadModTestRunSteps(db *sql.DB, runID int64) ([]ModTestRunStepRecord, error
 		return nil, err
 	}
 	rows, err := db.Query(`select run_id, step_index, mod_name, mod_version, serial_group, visible_tmux, requires_nix,
-		status, exit_code, queue_id, command_text, output_text, error_text, started_at, finished_at, runtime_ms
+		status, exit_code, queue_id, command_text, output_text, error_text, started_at, finished_at, runtime_ms,
+		worker_slot, concurrency, wait_ms, trigger_files_json
 		from mod_test_run_steps
 		where run_id = ?
 		order by step_index`, runID)
@@ -1323,6 +1116,7 @@ func LoadModTestRunSteps(db *sql.DB, runID int64) ([]ModTestRunStepRecord, error
 			&record.RunID, &record.StepIndex, &record.ModName, &record.ModVersion, &record.SerialGroup, &visibleTmux, &requiresNix,
 			&record.Status, &record.ExitCode, &record.QueueID, &record.CommandText, &record.OutputText, &record.ErrorText,
 			&record.StartedAt, &record.FinishedAt, &record.RuntimeMS,
+			&record.WorkerSlot, &record.Concurrency, &record.WaitMS, &record.TriggerFilesJSON,
 		); err != nil {
 			return nil, err
 		}
@@ -1706,7 +1500,11 @@ func RenderGraphText(edges []GraphEdge) string {
 	}
 	lines := make([]string, 0, len(edges))
 	for _, edge := range edges {
-		lines = append(lines, fmt.Sprintf("%s:%s -> %s:%s (%s)", edge.From.Name, edge.From.Version, edge.To.Name, edge.To.Version, edge.Source))
+		target := edge.To.Name + ":" + edge.To.Version
+		if edge.Range != "" && edge.Range != edge.To.Version {
+			target += " [" + edge.Range + "]"
+		}
+		lines = append(lines, fmt.Sprintf("%s:%s -> %s (%s)", edge.From.Name, edge.From.Version, target, edge.Source))
 	}
 	return strings.Join(lines, "\n")
 }
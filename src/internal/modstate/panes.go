@@ -0,0 +1,137 @@
+package modstate
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// PaneSnapshotKeep bounds how many structured snapshots (and diffs) are kept
+// per pane; the shell worker records two panes after every command.
+const PaneSnapshotKeep = 200
+
+type PaneSnapshotRecord struct {
+	ID          int64  `json:"id"`
+	Session     string `json:"session"`
+	Pane        string `json:"pane"`
+	RefID       int64  `json:"ref_id"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	HistorySize int    `json:"history_size"`
+	CursorRow   int    `json:"cursor_row"`
+	CursorCol   int    `json:"cursor_col"`
+	ScreenJSON  string `json:"screen_json"`
+	Text        string `json:"text"`
+	CreatedAt   string `json:"created_at"`
+}
+
+type PaneDiffRecord struct {
+	ID          int64  `json:"id"`
+	Pane        string `json:"pane"`
+	FromID      int64  `json:"from_id"`
+	ToID        int64  `json:"to_id"`
+	Scrolled    int    `json:"scrolled"`
+	ChangedRows int    `json:"changed_rows"`
+	DiffJSON    string `json:"diff_json"`
+	Text        string `json:"text"`
+	CreatedAt   string `json:"created_at"`
+}
+
+func AppendPaneSnapshot(db *sql.DB, record PaneSnapshotRecord) (int64, error) {
+	if err := EnsureSchema(db); err != nil {
+		return 0, err
+	}
+	pane := strings.TrimSpace(record.Pane)
+	result, err := db.Exec(`insert into pane_snapshots(session, pane, ref_id, width, height, history_size, cursor_row, cursor_col, screen_json, text, created_at)
+		values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		strings.TrimSpace(record.Session), pane, record.RefID, record.Width, record.Height, record.HistorySize,
+		record.CursorRow, record.CursorCol, record.ScreenJSON, record.Text, nowRFC3339())
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := db.Exec(`delete from pane_snapshots where pane = ? and id not in (
+		select id from pane_snapshots where pane = ? order by id desc limit ?)`, pane, pane, PaneSnapshotKeep); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func LoadLatestPaneSnapshot(db *sql.DB, pane string) (PaneSnapshotRecord, bool, error) {
+	return loadPaneSnapshot(db, `where pane = ? order by id desc limit 1`, strings.TrimSpace(pane))
+}
+
+func LoadPaneSnapshot(db *sql.DB, id int64) (PaneSnapshotRecord, bool, error) {
+	return loadPaneSnapshot(db, `where id = ?`, id)
+}
+
+func loadPaneSnapshot(db *sql.DB, where string, arg any) (PaneSnapshotRecord, bool, error) {
+	if err := EnsureSchema(db); err != nil {
+		return PaneSnapshotRecord{}, false, err
+	}
+	var record PaneSnapshotRecord
+	err := db.QueryRow(`select id, session, pane, ref_id, width, height, history_size, cursor_row, cursor_col, screen_json, text, created_at
+		from pane_snapshots `+where, arg).
+		Scan(&record.ID, &record.Session, &record.Pane, &record.RefID, &record.Width, &record.Height, &record.HistorySize,
+			&record.CursorRow, &record.CursorCol, &record.ScreenJSON, &record.Text, &record.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return PaneSnapshotRecord{}, false, nil
+		}
+		return PaneSnapshotRecord{}, false, err
+	}
+	return record, true, nil
+}
+
+func AppendPaneDiff(db *sql.DB, record PaneDiffRecord) (int64, error) {
+	if err := EnsureSchema(db); err != nil {
+		return 0, err
+	}
+	pane := strings.TrimSpace(record.Pane)
+	result, err := db.Exec(`insert into pane_snapshot_diffs(pane, from_id, to_id, scrolled, changed_rows, diff_json, text, created_at)
+		values(?, ?, ?, ?, ?, ?, ?, ?)`,
+		pane, record.FromID, record.ToID, record.Scrolled, record.ChangedRows, record.DiffJSON, record.Text, nowRFC3339())
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := db.Exec(`delete from pane_snapshot_diffs where pane = ? and id not in (
+		select id from pane_snapshot_diffs where pane = ? order by id desc limit ?)`, pane, pane, PaneSnapshotKeep); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// LoadPaneDiffs returns the newest diffs for pane (all panes when blank),
+// newest first.
+func LoadPaneDiffs(db *sql.DB, pane string, limit int) ([]PaneDiffRecord, error) {
+	if err := EnsureSchema(db); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+	rows, err := db.Query(`select id, pane, from_id, to_id, scrolled, changed_rows, diff_json, text, created_at
+		from pane_snapshot_diffs
+		where ? = '' or pane = ?
+		order by id desc
+		limit ?`, strings.TrimSpace(pane), strings.TrimSpace(pane), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []PaneDiffRecord{}
+	for rows.Next() {
+		var record PaneDiffRecord
+		if err := rows.Scan(&record.ID, &record.Pane, &record.FromID, &record.ToID, &record.Scrolled, &record.ChangedRows, &record.DiffJSON, &record.Text, &record.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, record)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,79 @@
+package modstate
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPaneSnapshotsAndDiffsRoundTripAndPrune(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "state.sqlite"))
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer db.Close()
+
+	if _, ok, err := LoadLatestPaneSnapshot(db, "codex-view:0:1"); err != nil || ok {
+		t.Fatalf("expected no snapshot yet, got ok=%t err=%v", ok, err)
+	}
+	var last int64
+	for i := 0; i < PaneSnapshotKeep+5; i++ {
+		last, err = AppendPaneSnapshot(db, PaneSnapshotRecord{Session: "codex-view", Pane: "codex-view:0:1", RefID: int64(i), Width: 80, Height: 24, ScreenJSON: "{}", Text: "$ "})
+		if err != nil {
+			t.Fatalf("AppendPaneSnapshot returned error: %v", err)
+		}
+		if _, err := AppendPaneDiff(db, PaneDiffRecord{Pane: "codex-view:0:1", FromID: last - 1, ToID: last, ChangedRows: 1, DiffJSON: "{}"}); err != nil {
+			t.Fatalf("AppendPaneDiff returned error: %v", err)
+		}
+	}
+	if _, err := AppendPaneSnapshot(db, PaneSnapshotRecord{Pane: "codex-view:0:0", ScreenJSON: "{}"}); err != nil {
+		t.Fatalf("AppendPaneSnapshot returned error: %v", err)
+	}
+
+	latest, ok, err := LoadLatestPaneSnapshot(db, "codex-view:0:1")
+	if err != nil || !ok || latest.ID != last || latest.RefID != PaneSnapshotKeep+4 || latest.Width != 80 {
+		t.Fatalf("unexpected latest snapshot: %+v ok=%t err=%v", latest, ok, err)
+	}
+	var count int
+	if err := db.QueryRow(`select count(*) from pane_snapshots where pane = 'codex-view:0:1'`).Scan(&count); err != nil || count != PaneSnapshotKeep {
+		t.Fatalf("pane_snapshots kept %d rows (err %v), want %d", count, err, PaneSnapshotKeep)
+	}
+	diffs, err := LoadPaneDiffs(db, "codex-view:0:1", 3)
+	if err != nil || len(diffs) != 3 || diffs[0].ToID != last {
+		t.Fatalf("unexpected diffs: %+v err=%v", diffs, err)
+	}
+	if all, err := LoadPaneDiffs(db, "", PaneSnapshotKeep*2); err != nil || len(all) != PaneSnapshotKeep {
+		t.Fatalf("expected pruned diffs, got %d err=%v", len(all), err)
+	}
+}
+
+func TestPaneSnapshotPruningIsPerPane(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "state.sqlite"))
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer db.Close()
+
+	// Interleaved panes share the global id sequence; each must still keep
+	// its own PaneSnapshotKeep rows.
+	panes := []string{"codex-view:0:0", "codex-view:0:1"}
+	for i := 0; i < PaneSnapshotKeep+5; i++ {
+		for _, pane := range panes {
+			id, err := AppendPaneSnapshot(db, PaneSnapshotRecord{Pane: pane, ScreenJSON: "{}"})
+			if err != nil {
+				t.Fatalf("AppendPaneSnapshot returned error: %v", err)
+			}
+			if _, err := AppendPaneDiff(db, PaneDiffRecord{Pane: pane, FromID: id - 2, ToID: id, DiffJSON: "{}"}); err != nil {
+				t.Fatalf("AppendPaneDiff returned error: %v", err)
+			}
+		}
+	}
+	for _, pane := range panes {
+		var snapshots, diffs int
+		if err := db.QueryRow(`select count(*) from pane_snapshots where pane = ?`, pane).Scan(&snapshots); err != nil || snapshots != PaneSnapshotKeep {
+			t.Fatalf("%s kept %d snapshots (err %v), want %d", pane, snapshots, err, PaneSnapshotKeep)
+		}
+		if err := db.QueryRow(`select count(*) from pane_snapshot_diffs where pane = ?`, pane).Scan(&diffs); err != nil || diffs != PaneSnapshotKeep {
+			t.Fatalf("%s kept %d diffs (err %v), want %d", pane, diffs, err, PaneSnapshotKeep)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package modstate
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// depends_on versions in mod.json are constraints. A bare version ("v1") pins
+// exactly; otherwise space-separated terms (>=v1 <v3, ^v2) must all hold and
+// "||" separates alternatives. "" and "*" accept any version.
+
+type VersionConstraint struct {
+	raw  string
+	alts [][]versionTerm
+}
+
+type versionTerm struct {
+	op      string
+	version string
+	parsed  [3]int
+	ok      bool
+}
+
+// LockRecord is the version of a mod the resolver picked for the repo.
+// RequiredBy lists the locked mods that constrain it ("shell:v1 (>=v1)").
+type LockRecord struct {
+	ModName    string
+	ModVersion string
+	RequiredBy string
+}
+
+func ParseVersionConstraint(raw string) (VersionConstraint, error) {
+	c := VersionConstraint{raw: strings.TrimSpace(raw)}
+	if c.raw == "" || c.raw == "*" {
+		return c, nil
+	}
+	for _, alt := range strings.Split(c.raw, "||") {
+		fields := strings.Fields(strings.ReplaceAll(alt, ",", " "))
+		var terms []versionTerm
+		for i := 0; i < len(fields); i++ {
+			tok := fields[i]
+			op := ""
+			for _, candidate := range []string{">=", "<=", ">", "<", "=", "^"} {
+				if strings.HasPrefix(tok, candidate) {
+					op = candidate
+					tok = strings.TrimPrefix(tok, candidate)
+					break
+				}
+			}
+			// Allow ">= v1" with a space after the operator.
+			if tok == "" && op != "" && i+1 < len(fields) {
+				i++
+				tok = fields[i]
+			}
+			if tok == "" {
+				return VersionConstraint{}, fmt.Errorf("version range %q: operator %q without version", c.raw, op)
+			}
+			parsed, ok := parseModVersion(tok)
+			if !ok && op != "" && op != "=" {
+				return VersionConstraint{}, fmt.Errorf("version range %q: %q is not a vMAJOR[.MINOR[.PATCH]] version", c.raw, tok)
+			}
+			if op == "^" {
+				next := [3]int{parsed[0] + 1}
+				terms = append(terms,
+					versionTerm{op: ">=", version: tok, parsed: parsed, ok: true},
+					versionTerm{op: "<", version: formatModVersion(next), parsed: next, ok: true})
+				continue
+			}
+			terms = append(terms, versionTerm{op: op, version: tok, parsed: parsed, ok: ok})
+		}
+		if len(terms) == 0 {
+			return VersionConstraint{}, fmt.Errorf("version range %q has an empty alternative", c.raw)
+		}
+		c.alts = append(c.alts, terms)
+	}
+	return c, nil
+}
+
+func (c VersionConstraint) String() string {
+	if c.raw == "" {
+		return "*"
+	}
+	return c.raw
+}
+
+func (c VersionConstraint) Allows(version string) bool {
+	if len(c.alts) == 0 {
+		return true
+	}
+	parsed, ok := parseModVersion(version)
+	for _, alt := range c.alts {
+		match := true
+		for _, term := range alt {
+			if !term.allows(strings.TrimSpace(version), parsed, ok) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func (t versionTerm) allows(version string, parsed [3]int, ok bool) bool {
+	if !ok || !t.ok {
+		return (t.op == "" || t.op == "=") && version == t.version
+	}
+	cmp := compareParsedVersions(parsed, t.parsed)
+	switch t.op {
+	case ">=":
+		return cmp >= 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	case "<":
+		return cmp < 0
+	default:
+		return cmp == 0
+	}
+}
+
+// CompareModVersions orders mod versions numerically (v2 < v10). Versions
+// that do not parse sort before all others, by string.
+func CompareModVersions(a, b string) int {
+	pa, okA := parseModVersion(a)
+	pb, okB := parseModVersion(b)
+	switch {
+	case okA && okB:
+		return compareParsedVersions(pa, pb)
+	case okA:
+		return 1
+	case okB:
+		return -1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func parseModVersion(v string) ([3]int, bool) {
+	var out [3]int
+	v = strings.TrimSpace(v)
+	if !strings.HasPrefix(v, "v") {
+		return out, false
+	}
+	parts := strings.Split(strings.TrimPrefix(v, "v"), ".")
+	if len(parts) > 3 {
+		return out, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return out, false
+		}
+		out[i] = n
+	}
+	return out, true
+}
+
+func formatModVersion(v [3]int) string {
+	switch {
+	case v[2] != 0:
+		return fmt.Sprintf("v%d.%d.%d", v[0], v[1], v[2])
+	case v[1] != 0:
+		return fmt.Sprintf("v%d.%d", v[0], v[1])
+	default:
+		return fmt.Sprintf("v%d", v[0])
+	}
+}
+
+func compareParsedVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+type versionRequirement struct {
+	from       string
+	name       string
+	constraint VersionConstraint
+}
+
+type versionConflict struct {
+	name     string
+	required []versionRequirement
+}
+
+// ResolveVersions picks one version of every mod so that the constraints of
+// all picked mods hold, preferring the newest versions of mods nothing else
+// depends on. It returns the lock and deps with ToVersion set to a concrete
+// version: the locked one for edges out of locked mods, otherwise the newest
+// version the constraint allows.
+func ResolveVersions(mods []ModRecord, deps []DependencyRecord) ([]LockRecord, []DependencyRecord, error) {
+	available := map[string][]string{}
+	for _, mod := range mods {
+		available[mod.Name] = append(available[mod.Name], mod.Version)
+	}
+	for name := range available {
+		sort.Slice(available[name], func(i, j int) bool {
+			return CompareModVersions(available[name][i], available[name][j]) > 0
+		})
+	}
+
+	reqs := map[string][]versionRequirement{}
+	constraints := make([]VersionConstraint, len(deps))
+	nameEdges := map[string]map[string]bool{}
+	for i, dep := range deps {
+		from := dep.FromName + ":" + dep.FromVersion
+		raw := dep.Range
+		if raw == "" {
+			raw = dep.ToVersion
+		}
+		c, err := ParseVersionConstraint(raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s depends on %s: %w", from, dep.ToName, err)
+		}
+		if _, ok := available[dep.ToName]; !ok {
+			return nil, nil, fmt.Errorf("%s depends on unknown mod %s", from, dep.ToName)
+		}
+		constraints[i] = c
+		reqs[from] = append(reqs[from], versionRequirement{from: from, name: dep.ToName, constraint: c})
+		if dep.FromName != dep.ToName {
+			if nameEdges[dep.FromName] == nil {
+				nameEdges[dep.FromName] = map[string]bool{}
+			}
+			nameEdges[dep.FromName][dep.ToName] = true
+		}
+	}
+
+	order := resolveOrder(available, nameEdges)
+	selected := map[string]string{}
+	var conflict *versionConflict
+	conflictDepth := -1
+	var solve func(depth int) bool
+	solve = func(depth int) bool {
+		if depth == len(order) {
+			return true
+		}
+		name := order[depth]
+		var required []versionRequirement
+		for _, other := range order[:depth] {
+			for _, req := range reqs[other+":"+selected[other]] {
+				if req.name == name {
+					required = append(required, req)
+				}
+			}
+		}
+		for _, version := range available[name] {
+			if !allowsAll(required, version) {
+				continue
+			}
+			// The candidate's own constraints on mods already picked.
+			fits := true
+			for _, req := range reqs[name+":"+version] {
+				if picked, ok := selected[req.name]; ok && !req.constraint.Allows(picked) {
+					fits = false
+					break
+				}
+			}
+			if !fits {
+				continue
+			}
+			selected[name] = version
+			if solve(depth + 1) {
+				return true
+			}
+			delete(selected, name)
+		}
+		if depth > conflictDepth {
+			conflictDepth = depth
+			conflict = &versionConflict{name: name, required: required}
+		}
+		return false
+	}
+	if !solve(0) {
+		return nil, nil, conflict.err(available[conflict.name])
+	}
+
+	lock := make([]LockRecord, 0, len(order))
+	for _, name := range order {
+		var by []string
+		for _, other := range order {
+			for _, req := range reqs[other+":"+selected[other]] {
+				if req.name == name {
+					by = append(by, fmt.Sprintf("%s (%s)", req.from, req.constraint))
+				}
+			}
+		}
+		sort.Strings(by)
+		lock = append(lock, LockRecord{ModName: name, ModVersion: selected[name], RequiredBy: strings.Join(by, ", ")})
+	}
+	sort.Slice(lock, func(i, j int) bool { return lock[i].ModName < lock[j].ModName })
+
+	resolved := make([]DependencyRecord, len(deps))
+	for i, dep := range deps {
+		dep.Range = constraints[i].raw
+		if selected[dep.FromName] == dep.FromVersion {
+			dep.ToVersion = selected[dep.ToName]
+		} else {
+			dep.ToVersion = ""
+			for _, version := range available[dep.ToName] {
+				if constraints[i].Allows(version) {
+					dep.ToVersion = version
+					break
+				}
+			}
+			if dep.ToVersion == "" {
+				return nil, nil, fmt.Errorf("%s:%s requires %s %s, but src/mods only has %s",
+					dep.FromName, dep.FromVersion, dep.ToName, constraints[i], strings.Join(available[dep.ToName], ", "))
+			}
+		}
+		resolved[i] = dep
+	}
+	return lock, resolved, nil
+}
+
+func allowsAll(reqs []versionRequirement, version string) bool {
+	for _, req := range reqs {
+		if !req.constraint.Allows(version) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *versionConflict) err(available []string) error {
+	if len(c.required) == 0 {
+		return fmt.Errorf("mod version conflict on %s: no version satisfies the dependencies of any %s version (available: %s)",
+			c.name, c.name, strings.Join(available, ", "))
+	}
+	parts := make([]string, 0, len(c.required))
+	for _, req := range c.required {
+		parts = append(parts, fmt.Sprintf("%s requires %s", req.from, req.constraint))
+	}
+	return fmt.Errorf("mod version conflict on %s: %s (available: %s)",
+		c.name, strings.Join(parts, ", "), strings.Join(available, ", "))
+}
+
+// resolveOrder lists mod names dependents-first so constraints are known
+// before the mods they apply to are picked. Names in a cycle go last.
+func resolveOrder(available map[string][]string, edges map[string]map[string]bool) []string {
+	names := make([]string, 0, len(available))
+	for name := range available {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	indegree := map[string]int{}
+	for _, tos := range edges {
+		for to := range tos {
+			indegree[to]++
+		}
+	}
+	var order, ready []string
+	for _, name := range names {
+		if indegree[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+	done := map[string]bool{}
+	for len(ready) > 0 {
+		name := ready[0]
+		ready = ready[1:]
+		order = append(order, name)
+		done[name] = true
+		var next []string
+		for to := range edges[name] {
+			indegree[to]--
+			if indegree[to] == 0 {
+				next = append(next, to)
+			}
+		}
+		sort.Strings(next)
+		ready = append(ready, next...)
+	}
+	for _, name := range names {
+		if !done[name] {
+			order = append(order, name)
+		}
+	}
+	return order
+}
+
+func RenderLockText(lock []LockRecord) string {
+	if len(lock) == 0 {
+		return "lock: no mods resolved"
+	}
+	lines := []string{"lock:"}
+	for _, item := range lock {
+		line := fmt.Sprintf("  %s:%s", item.ModName, item.ModVersion)
+		if item.RequiredBy != "" {
+			line += " <- " + item.RequiredBy
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
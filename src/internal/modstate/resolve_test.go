@@ -0,0 +1,154 @@
+package modstate
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVersionConstraintAllows(t *testing.T) {
+	cases := []struct {
+		raw   string
+		allow []string
+		deny  []string
+	}{
+		{raw: "v1", allow: []string{"v1", "v1.0.0"}, deny: []string{"v2", "v1.1"}},
+		{raw: ">=v1 <v3", allow: []string{"v1", "v2", "v2.9"}, deny: []string{"v0", "v3"}},
+		{raw: ">= v2", allow: []string{"v2", "v10"}, deny: []string{"v1"}},
+		{raw: "^v2", allow: []string{"v2", "v2.5.1"}, deny: []string{"v1", "v3"}},
+		{raw: "v1 || >=v3", allow: []string{"v1", "v3", "v4"}, deny: []string{"v2"}},
+		{raw: "*", allow: []string{"v1", "dev"}},
+		{raw: "", allow: []string{"v7"}},
+	}
+	for _, tc := range cases {
+		c, err := ParseVersionConstraint(tc.raw)
+		if err != nil {
+			t.Fatalf("ParseVersionConstraint(%q) returned error: %v", tc.raw, err)
+		}
+		for _, v := range tc.allow {
+			if !c.Allows(v) {
+				t.Errorf("%q should allow %s", tc.raw, v)
+			}
+		}
+		for _, v := range tc.deny {
+			if c.Allows(v) {
+				t.Errorf("%q should not allow %s", tc.raw, v)
+			}
+		}
+	}
+	for _, raw := range []string{">=", "<latest", "v1 ||"} {
+		if _, err := ParseVersionConstraint(raw); err == nil {
+			t.Errorf("ParseVersionConstraint(%q) should fail", raw)
+		}
+	}
+	if CompareModVersions("v10", "v2") <= 0 || CompareModVersions("v1", "v1.0") != 0 {
+		t.Fatalf("CompareModVersions does not order numerically")
+	}
+}
+
+func TestResolveVersionsPicksConsistentSet(t *testing.T) {
+	mods := []ModRecord{
+		{Name: "mesh", Version: "v1"}, {Name: "mesh", Version: "v2"}, {Name: "mesh", Version: "v3"},
+		{Name: "ssh", Version: "v1"}, {Name: "ssh", Version: "v2"},
+		{Name: "shell", Version: "v1"},
+		{Name: "codex", Version: "v1"},
+	}
+	deps := []DependencyRecord{
+		{FromName: "shell", FromVersion: "v1", ToName: "mesh", Range: ">=v1 <v3"},
+		{FromName: "codex", FromVersion: "v1", ToName: "mesh", Range: ">=v2"},
+		// mesh v2 only works with ssh v1; mesh v3 needs ssh v2.
+		{FromName: "mesh", FromVersion: "v2", ToName: "ssh", Range: "v1"},
+		{FromName: "mesh", FromVersion: "v3", ToName: "ssh", Range: "v2"},
+	}
+	lock, resolved, err := ResolveVersions(mods, deps)
+	if err != nil {
+		t.Fatalf("ResolveVersions returned error: %v", err)
+	}
+	got := map[string]LockRecord{}
+	for _, item := range lock {
+		got[item.ModName] = item
+	}
+	if got["mesh"].ModVersion != "v2" || got["ssh"].ModVersion != "v1" || got["shell"].ModVersion != "v1" {
+		t.Fatalf("unexpected lock: %+v", lock)
+	}
+	if got["mesh"].RequiredBy != "codex:v1 (>=v2), shell:v1 (>=v1 <v3)" || got["codex"].RequiredBy != "" {
+		t.Fatalf("unexpected required_by: %+v", got)
+	}
+	// Edges out of locked mods use the lock; mesh v3 is outside it and
+	// points at the newest ssh its constraint allows.
+	for _, dep := range resolved {
+		want := map[string]string{"shell": "v2", "codex": "v2", "mesh:v2": "v1", "mesh:v3": "v2"}
+		key := dep.FromName
+		if key == "mesh" {
+			key += ":" + dep.FromVersion
+		}
+		if dep.ToVersion != want[key] {
+			t.Fatalf("%s:%s -> %s resolved to %q, want %q", dep.FromName, dep.FromVersion, dep.ToName, dep.ToVersion, want[key])
+		}
+	}
+}
+
+func TestResolveVersionsReportsConflicts(t *testing.T) {
+	mods := []ModRecord{
+		{Name: "mesh", Version: "v1"}, {Name: "mesh", Version: "v3"},
+		{Name: "shell", Version: "v1"},
+		{Name: "codex", Version: "v1"},
+	}
+	deps := []DependencyRecord{
+		{FromName: "shell", FromVersion: "v1", ToName: "mesh", Range: ">=v1 <v3"},
+		{FromName: "codex", FromVersion: "v1", ToName: "mesh", Range: "v3"},
+	}
+	_, _, err := ResolveVersions(mods, deps)
+	if err == nil {
+		t.Fatalf("expected conflict error")
+	}
+	for _, want := range []string{"conflict on mesh", "codex:v1 requires v3", "shell:v1 requires >=v1 <v3", "available: v3, v1"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("conflict error %q missing %q", err, want)
+		}
+	}
+
+	deps = []DependencyRecord{{FromName: "shell", FromVersion: "v1", ToName: "nope", Range: "v1"}}
+	if _, _, err := ResolveVersions(mods, deps); err == nil || !strings.Contains(err.Error(), "unknown mod nope") {
+		t.Fatalf("expected unknown mod error, got %v", err)
+	}
+}
+
+func TestSyncRepoStoresVersionLock(t *testing.T) {
+	repoRoot := t.TempDir()
+	for _, version := range []string{"v1", "v2", "v3"} {
+		writeFile(t, filepath.Join(repoRoot, "src", "mods", "mesh", version, "main.go"), "package main\n")
+	}
+	writeFile(t, filepath.Join(repoRoot, "src", "mods", "shell", "v1", "mod.json"),
+		`{"name":"shell","version":"v1","depends_on":[{"name":"mesh","version":">=v1 <v3"}]}`)
+
+	db, err := Open(filepath.Join(repoRoot, ".dialtone", "state.sqlite"))
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer db.Close()
+	summary, err := SyncRepo(db, repoRoot, nil)
+	if err != nil {
+		t.Fatalf("SyncRepo returned error: %v", err)
+	}
+	if summary.Locked != 2 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	lock, err := LoadLock(db)
+	if err != nil {
+		t.Fatalf("LoadLock returned error: %v", err)
+	}
+	if len(lock) != 2 || lock[0].ModName != "mesh" || lock[0].ModVersion != "v2" || lock[0].RequiredBy != "shell:v1 (>=v1 <v3)" {
+		t.Fatalf("unexpected lock: %+v", lock)
+	}
+	edges, err := LoadGraph(db)
+	if err != nil {
+		t.Fatalf("LoadGraph returned error: %v", err)
+	}
+	text := RenderGraphText(edges) + "\n" + RenderLockText(lock)
+	for _, want := range []string{"shell:v1 -> mesh:v2 [>=v1 <v3] (mod.json)", "  mesh:v2 <- shell:v1 (>=v1 <v3)", "  shell:v1"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("graph output missing %q:\n%s", want, text)
+		}
+	}
+}
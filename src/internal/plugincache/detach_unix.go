@@ -0,0 +1,12 @@
+//go:build !windows
+
+package plugincache
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func configureDetachedCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,443 @@
+package plugincache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// staleLockAge is how long a build lock may sit before another process
+// assumes its builder died and takes over.
+const staleLockAge = 10 * time.Minute
+
+var ErrBuildInProgress = errors.New("plugin build already in progress")
+
+// Target is a Go plugin entrypoint: Package is built from Dir the same way
+// `go run` would have been invoked.
+type Target struct {
+	Plugin  string
+	Dir     string
+	Package string
+}
+
+// Cache stores compiled plugin binaries under Dir/<plugin>/<key>/.
+type Cache struct {
+	Dir string
+	Go  string
+}
+
+type Entry struct {
+	Plugin  string    `json:"plugin"`
+	Key     string    `json:"key"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	BuiltAt time.Time `json:"built_at"`
+}
+
+type Status struct {
+	Plugin  string `json:"plugin"`
+	Key     string `json:"key"`
+	State   string `json:"state"`
+	Entry   *Entry `json:"entry,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Stale   int    `json:"stale_entries"`
+	Pending bool   `json:"building"`
+}
+
+func New(dir string) *Cache {
+	return &Cache{Dir: dir, Go: "go"}
+}
+
+// Disabled reports whether DIALTONE_PLUGIN_CACHE turns the cache off.
+func Disabled() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("DIALTONE_PLUGIN_CACHE"))) {
+	case "0", "off", "false", "no":
+		return true
+	}
+	return false
+}
+
+type listedPackage struct {
+	ImportPath string
+	Dir        string
+	Standard   bool
+	Module     *struct {
+		Path    string
+		Version string
+		GoMod   string
+		Replace *struct{ Path, Version string }
+	}
+	GoFiles    []string
+	CgoFiles   []string
+	CFiles     []string
+	HFiles     []string
+	SFiles     []string
+	EmbedFiles []string
+}
+
+// Key hashes the target's package import graph together with the toolchain
+// and build environment. Standard library and versioned module packages are
+// keyed by version; everything else by file contents.
+//
+// The result is remembered in Dir/<plugin>/key.json alongside the mtime and
+// size of every file and package directory it read (go.mod and go.sum
+// included), so an unchanged tree skips `go list -deps` entirely.
+func (c *Cache) Key(ctx context.Context, t Target) (string, error) {
+	stamp := keyStamp{Package: t.Package, Dir: absDir(t.Dir), Toolchain: c.toolchainStamp()}
+	if key, ok := c.stampedKey(t.Plugin, stamp); ok {
+		return key, nil
+	}
+	env, err := c.output(ctx, t.Dir, "env", "GOVERSION", "GOOS", "GOARCH", "GOEXPERIMENT", "CGO_ENABLED", "GOFLAGS")
+	if err != nil {
+		return "", err
+	}
+	listing, err := c.output(ctx, t.Dir, "list", "-deps", "-json=ImportPath,Dir,Standard,Module,GoFiles,CgoFiles,CFiles,HFiles,SFiles,EmbedFiles", t.Package)
+	if err != nil {
+		return "", err
+	}
+	stamp.Files = map[string]string{}
+	h := sha256.New()
+	fmt.Fprintf(h, "target %s\nenv %s\n", t.Package, env)
+	dec := json.NewDecoder(bytes.NewReader(listing))
+	for {
+		var pkg listedPackage
+		if err := dec.Decode(&pkg); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("parse go list output: %w", err)
+		}
+		if pkg.Standard {
+			continue
+		}
+		if pkg.Module != nil && pkg.Module.Version != "" && pkg.Module.Replace == nil {
+			fmt.Fprintf(h, "pkg %s %s@%s\n", pkg.ImportPath, pkg.Module.Path, pkg.Module.Version)
+			continue
+		}
+		fmt.Fprintf(h, "pkg %s\n", pkg.ImportPath)
+		// A new or removed file changes the directory mtime, which is what
+		// catches edits that change the import graph itself.
+		stamp.addFile(pkg.Dir)
+		if pkg.Module != nil && pkg.Module.GoMod != "" {
+			stamp.addFile(pkg.Module.GoMod)
+			stamp.addFile(filepath.Join(filepath.Dir(pkg.Module.GoMod), "go.sum"))
+		}
+		files := [][]string{pkg.GoFiles, pkg.CgoFiles, pkg.CFiles, pkg.HFiles, pkg.SFiles, pkg.EmbedFiles}
+		for _, group := range files {
+			for _, name := range group {
+				path := filepath.Join(pkg.Dir, name)
+				stamp.addFile(path)
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return "", err
+				}
+				sum := sha256.Sum256(data)
+				fmt.Fprintf(h, "file %s %x\n", name, sum)
+			}
+		}
+	}
+	stamp.Key = hex.EncodeToString(h.Sum(nil))[:24]
+	c.writeStamp(t.Plugin, stamp)
+	return stamp.Key, nil
+}
+
+// keyStamp records what Key read for a target. Files maps each path to
+// "mtime size" ("missing" when it did not exist).
+type keyStamp struct {
+	Key       string            `json:"key"`
+	Package   string            `json:"package"`
+	Dir       string            `json:"dir"`
+	Toolchain string            `json:"toolchain"`
+	Files     map[string]string `json:"files"`
+}
+
+func (s *keyStamp) addFile(path string) {
+	s.Files[path] = fileStamp(path)
+}
+
+func fileStamp(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "missing"
+	}
+	return fmt.Sprintf("%d %d", info.ModTime().UnixNano(), info.Size())
+}
+
+func absDir(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	return abs
+}
+
+// toolchainStamp identifies the go binary and the environment variables
+// that feed `go env`, without running go.
+func (c *Cache) toolchainStamp() string {
+	bin, err := exec.LookPath(c.Go)
+	if err != nil {
+		return ""
+	}
+	parts := []string{bin, fileStamp(bin)}
+	for _, name := range []string{"GOOS", "GOARCH", "GOEXPERIMENT", "CGO_ENABLED", "GOFLAGS", "GOTOOLCHAIN", "GOENV"} {
+		parts = append(parts, name+"="+os.Getenv(name))
+	}
+	return strings.Join(parts, "\n")
+}
+
+func (c *Cache) stampPath(plugin string) string {
+	return filepath.Join(c.Dir, plugin, "key.json")
+}
+
+func (c *Cache) stampedKey(plugin string, want keyStamp) (string, bool) {
+	if want.Toolchain == "" {
+		return "", false
+	}
+	data, err := os.ReadFile(c.stampPath(plugin))
+	if err != nil {
+		return "", false
+	}
+	var got keyStamp
+	if json.Unmarshal(data, &got) != nil || got.Key == "" || len(got.Files) == 0 {
+		return "", false
+	}
+	if got.Package != want.Package || got.Dir != want.Dir || got.Toolchain != want.Toolchain {
+		return "", false
+	}
+	for path, stamp := range got.Files {
+		if fileStamp(path) != stamp {
+			return "", false
+		}
+	}
+	return got.Key, true
+}
+
+func (c *Cache) writeStamp(plugin string, stamp keyStamp) {
+	data, err := json.Marshal(stamp)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Join(c.Dir, plugin), 0o755); err != nil {
+		return
+	}
+	tmp := fmt.Sprintf("%s.tmp-%d", c.stampPath(plugin), os.Getpid())
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, c.stampPath(plugin)); err != nil {
+		os.Remove(tmp)
+	}
+}
+
+func (c *Cache) output(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, c.Go, args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func (c *Cache) binaryPath(plugin, key string) string {
+	name := plugin
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(c.Dir, plugin, key, name)
+}
+
+// Lookup returns the cached binary for key when it has been built.
+func (c *Cache) Lookup(plugin, key string) (string, bool) {
+	path := c.binaryPath(plugin, key)
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return "", false
+	}
+	return path, true
+}
+
+// Build compiles t into the cache under key and prunes the plugin's older
+// entries. It returns ErrBuildInProgress when another process holds the lock.
+func (c *Cache) Build(ctx context.Context, t Target, key string) (string, error) {
+	unlock, err := c.lock(t.Plugin)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	if path, ok := c.Lookup(t.Plugin, key); ok {
+		return path, nil
+	}
+	final := c.binaryPath(t.Plugin, key)
+	if err := os.MkdirAll(filepath.Dir(final), 0o755); err != nil {
+		return "", err
+	}
+	tmp := fmt.Sprintf("%s.tmp-%d", final, os.Getpid())
+	if runtime.GOOS == "windows" {
+		tmp += ".exe"
+	}
+	if _, err := c.output(ctx, t.Dir, "build", "-o", tmp, t.Package); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	c.prune(t.Plugin, key)
+	return final, nil
+}
+
+// StartBuild launches cmd, which is expected to Build the plugin's entry,
+// detached from the caller with its output in Dir/<plugin>/build.log, so the
+// caller can exit without waiting for the compile. It returns
+// ErrBuildInProgress when a build already holds the plugin's lock.
+func (c *Cache) StartBuild(plugin string, cmd *exec.Cmd) error {
+	if c.building(plugin) {
+		return ErrBuildInProgress
+	}
+	dir := filepath.Join(c.Dir, plugin)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(filepath.Join(dir, "build.log"), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	cmd.Stdin = nil
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	configureDetachedCommand(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+func (c *Cache) lock(plugin string) (func(), error) {
+	dir := filepath.Join(c.Dir, plugin)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "build.lock")
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		info, statErr := os.Stat(path)
+		if statErr != nil || time.Since(info.ModTime()) < staleLockAge {
+			return nil, ErrBuildInProgress
+		}
+		os.Remove(path)
+	}
+	return nil, ErrBuildInProgress
+}
+
+func (c *Cache) building(plugin string) bool {
+	info, err := os.Stat(filepath.Join(c.Dir, plugin, "build.lock"))
+	return err == nil && time.Since(info.ModTime()) < staleLockAge
+}
+
+func (c *Cache) prune(plugin, keep string) {
+	for _, entry := range c.Entries(plugin) {
+		if entry.Key != keep {
+			os.RemoveAll(filepath.Dir(entry.Path))
+		}
+	}
+}
+
+// Entries lists the cached binaries for plugin, or for every plugin when
+// plugin is empty.
+func (c *Cache) Entries(plugin string) []Entry {
+	pattern := filepath.Join(c.Dir, "*", "*")
+	if plugin != "" {
+		pattern = filepath.Join(c.Dir, plugin, "*")
+	}
+	dirs, _ := filepath.Glob(pattern)
+	out := []Entry{}
+	for _, dir := range dirs {
+		name := filepath.Base(filepath.Dir(dir))
+		path := c.binaryPath(name, filepath.Base(dir))
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		out = append(out, Entry{Plugin: name, Key: filepath.Base(dir), Path: path, Size: info.Size(), BuiltAt: info.ModTime()})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Plugin != out[j].Plugin {
+			return out[i].Plugin < out[j].Plugin
+		}
+		return out[i].BuiltAt.After(out[j].BuiltAt)
+	})
+	return out
+}
+
+// Status reports whether each target's current key is cached.
+func (c *Cache) Status(ctx context.Context, targets []Target) []Status {
+	out := make([]Status, 0, len(targets))
+	for _, t := range targets {
+		st := Status{Plugin: t.Plugin, Pending: c.building(t.Plugin)}
+		entries := c.Entries(t.Plugin)
+		key, err := c.Key(ctx, t)
+		if err != nil {
+			st.State = "error"
+			st.Error = err.Error()
+			st.Stale = len(entries)
+			out = append(out, st)
+			continue
+		}
+		st.Key = key
+		st.State = "missing"
+		for i := range entries {
+			if entries[i].Key == key {
+				st.State = "fresh"
+				st.Entry = &entries[i]
+			} else {
+				st.Stale++
+			}
+		}
+		if st.State == "missing" && st.Stale > 0 {
+			st.State = "stale"
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// Clean removes the cached binaries for the given plugins, or the whole
+// cache when none are named. It returns the number of entries removed.
+func (c *Cache) Clean(plugins ...string) (int, error) {
+	removed := 0
+	if len(plugins) == 0 {
+		removed = len(c.Entries(""))
+		return removed, os.RemoveAll(c.Dir)
+	}
+	for _, plugin := range plugins {
+		removed += len(c.Entries(plugin))
+		if err := os.RemoveAll(filepath.Join(c.Dir, plugin)); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
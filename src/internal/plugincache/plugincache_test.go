@@ -0,0 +1,133 @@
+package plugincache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeDemoModule(t *testing.T, dir, greeting string) {
+	t.Helper()
+	files := map[string]string{
+		"go.mod":           "module example.com/demo\n\ngo 1.21\n",
+		"scaffold/main.go": "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/demo/lib\"\n)\n\nfunc main() { fmt.Println(lib.Greeting()) }\n",
+		"lib/lib.go":       "package lib\n\nfunc Greeting() string { return \"" + greeting + "\" }\n",
+	}
+	for name, body := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBuildReusesBinaryUntilImportedSourcesChange(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+	src := t.TempDir()
+	writeDemoModule(t, src, "hello")
+	cache := New(filepath.Join(t.TempDir(), "cache"))
+	target := Target{Plugin: "demo", Dir: src, Package: "./scaffold/main.go"}
+	ctx := context.Background()
+
+	key, err := cache.Key(ctx, target)
+	if err != nil {
+		t.Fatalf("Key returned error: %v", err)
+	}
+	if _, ok := cache.Lookup("demo", key); ok {
+		t.Fatalf("empty cache should miss")
+	}
+	bin, err := cache.Build(ctx, target, key)
+	if err != nil {
+		t.Fatalf("Build returned error: %v", err)
+	}
+	out, err := exec.Command(bin).Output()
+	if err != nil || strings.TrimSpace(string(out)) != "hello" {
+		t.Fatalf("cached binary output = %q, %v", out, err)
+	}
+	again, err := cache.Key(ctx, target)
+	if err != nil || again != key {
+		t.Fatalf("unchanged sources changed key: %s -> %s (%v)", key, again, err)
+	}
+	// An unchanged tree answers from key.json without running go at all.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if memo, err := cache.Key(cancelled, target); err != nil || memo != key {
+		t.Fatalf("memoized key = %s, %v; want %s", memo, err, key)
+	}
+
+	// Editing a dependency, not the entrypoint, must invalidate the entry.
+	writeDemoModule(t, src, "changed")
+	if _, err := cache.Key(cancelled, target); err == nil {
+		t.Fatalf("edited sources should not be answered from key.json")
+	}
+	changed, err := cache.Key(ctx, target)
+	if err != nil {
+		t.Fatalf("Key returned error: %v", err)
+	}
+	if changed == key {
+		t.Fatalf("dependency edit did not change key")
+	}
+	if st := cache.Status(ctx, []Target{target}); len(st) != 1 || st[0].State != "stale" {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	if _, err := cache.Build(ctx, target, changed); err != nil {
+		t.Fatalf("Build returned error: %v", err)
+	}
+	if entries := cache.Entries("demo"); len(entries) != 1 || entries[0].Key != changed {
+		t.Fatalf("old entries were not pruned: %+v", entries)
+	}
+
+	unlock, err := cache.lock("demo")
+	if err != nil {
+		t.Fatalf("lock returned error: %v", err)
+	}
+	if _, err := cache.Build(ctx, target, "other"); !errors.Is(err, ErrBuildInProgress) {
+		t.Fatalf("expected ErrBuildInProgress, got %v", err)
+	}
+	unlock()
+
+	if removed, err := cache.Clean("demo"); err != nil || removed != 1 {
+		t.Fatalf("Clean = %d, %v", removed, err)
+	}
+}
+
+func TestStartBuildDetachesAndLogs(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	cache := New(t.TempDir())
+	if err := cache.StartBuild("demo", exec.Command("sh", "-c", "echo built")); err != nil {
+		t.Fatalf("StartBuild returned error: %v", err)
+	}
+	logPath := filepath.Join(cache.Dir, "demo", "build.log")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(logPath)
+		if strings.TrimSpace(string(data)) == "built" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("build.log = %q", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	unlock, err := cache.lock("demo")
+	if err != nil {
+		t.Fatalf("lock returned error: %v", err)
+	}
+	defer unlock()
+	if err := cache.StartBuild("demo", exec.Command("sh", "-c", "true")); !errors.Is(err, ErrBuildInProgress) {
+		t.Fatalf("expected ErrBuildInProgress, got %v", err)
+	}
+}
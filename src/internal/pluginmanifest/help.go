@@ -0,0 +1,140 @@
+package pluginmanifest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WritePluginList prints one line per plugin with its versions and summary.
+func (r *Registry) WritePluginList(w io.Writer) {
+	for _, plugin := range r.Plugins() {
+		versions := strings.Join(plugin.Versions(), ",")
+		if versions == "" {
+			versions = "-"
+		}
+		description := ""
+		if manifest, ok := plugin.Manifest(""); ok {
+			description = manifest.Description
+		} else {
+			description = "(no " + FileName + ")"
+		}
+		fmt.Fprintf(w, "  %-12s %-22s %s\n", plugin.Name, versions, description)
+	}
+}
+
+// WritePluginHelp prints the commands of one plugin version (newest when empty).
+func (r *Registry) WritePluginHelp(w io.Writer, name, version string) error {
+	plugin, ok := r.Lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown plugin: %s", name)
+	}
+	manifest, ok := plugin.Manifest(version)
+	if !ok {
+		if version != "" {
+			return fmt.Errorf("plugin %s has no %s manifest", name, version)
+		}
+		fmt.Fprintf(w, "%s has no %s; run ./dialtone.sh %s help\n", name, FileName, name)
+		return nil
+	}
+	usage := strings.TrimSpace(strings.Join([]string{"./dialtone.sh", manifest.Name, manifest.Version, "<command> [args]"}, " "))
+	fmt.Fprintf(w, "Usage: %s\n", strings.Join(strings.Fields(usage), " "))
+	if manifest.Description != "" {
+		fmt.Fprintf(w, "\n%s\n", manifest.Description)
+	}
+	if len(manifest.Requirements) > 0 {
+		reqs := make([]string, 0, len(manifest.Requirements))
+		for _, req := range manifest.Requirements {
+			reqs = append(reqs, strings.TrimSpace(req.Tool+" "+req.Version))
+		}
+		fmt.Fprintf(w, "\nRequires: %s\n", strings.Join(reqs, ", "))
+	}
+	defaultMode := manifest.DefaultMode
+	if defaultMode == "" {
+		defaultMode = ModeREPL
+	}
+	fmt.Fprintf(w, "\nCommands (default mode: %s):\n", defaultMode)
+	for _, cmd := range manifest.Commands {
+		label := strings.TrimSpace(cmd.Name + " " + cmd.Args)
+		if len(cmd.Aliases) > 0 {
+			label += " (" + strings.Join(cmd.Aliases, ", ") + ")"
+		}
+		mode := ""
+		if cmd.Mode != "" && cmd.Mode != defaultMode {
+			mode = " [" + cmd.Mode + "]"
+		}
+		fmt.Fprintf(w, "  %-36s %s%s\n", label, cmd.Description, mode)
+	}
+	if others := plugin.Versions(); len(others) > 1 {
+		fmt.Fprintf(w, "\nVersions: %s\n", strings.Join(others, ", "))
+	}
+	return nil
+}
+
+// Completion renders a shell completion script for bash or zsh from the
+// loaded manifests. builtins are the dev.go commands completed at position 1.
+func (r *Registry) Completion(shell string, builtins []string) (string, error) {
+	switch shell {
+	case "bash", "zsh":
+	default:
+		return "", fmt.Errorf("unsupported shell %q (want bash or zsh)", shell)
+	}
+	top := append([]string(nil), builtins...)
+	cases := []string{}
+	for _, plugin := range r.Plugins() {
+		top = append(top, plugin.Name)
+		versions := plugin.Versions()
+		latest, _ := plugin.Manifest("")
+		words := append(append([]string{}, versions...), commandWords(latest)...)
+		cases = append(cases, fmt.Sprintf("    %s:) words=%q ;;", plugin.Name, strings.Join(words, " ")))
+		for i := range plugin.Manifests {
+			manifest := &plugin.Manifests[i]
+			if manifest.Version == "" {
+				continue
+			}
+			cases = append(cases, fmt.Sprintf("    %s:%s) words=%q ;;", plugin.Name, manifest.Version, strings.Join(commandWords(manifest), " ")))
+		}
+	}
+	sort.Strings(top)
+
+	var b strings.Builder
+	b.WriteString("# dialtone shell completion generated from plugin manifests.\n")
+	if shell == "zsh" {
+		b.WriteString("autoload -U +X bashcompinit && bashcompinit\n")
+	}
+	b.WriteString("_dialtone_complete() {\n")
+	b.WriteString("  local cur=${COMP_WORDS[COMP_CWORD]}\n")
+	b.WriteString("  local words=\"\"\n")
+	b.WriteString("  if [ \"$COMP_CWORD\" -eq 1 ]; then\n")
+	fmt.Fprintf(&b, "    COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(top, " "))
+	b.WriteString("    return\n")
+	b.WriteString("  fi\n")
+	b.WriteString("  local key=\"${COMP_WORDS[1]}:\"\n")
+	b.WriteString("  if [ \"$COMP_CWORD\" -eq 3 ]; then\n")
+	b.WriteString("    case \"${COMP_WORDS[2]}\" in src_v*) key=\"${COMP_WORDS[1]}:${COMP_WORDS[2]}\" ;; *) return ;; esac\n")
+	b.WriteString("  elif [ \"$COMP_CWORD\" -gt 3 ]; then\n")
+	b.WriteString("    return\n")
+	b.WriteString("  fi\n")
+	b.WriteString("  case \"$key\" in\n")
+	for _, line := range cases {
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("  esac\n")
+	b.WriteString("  COMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	b.WriteString("}\n")
+	b.WriteString("complete -F _dialtone_complete dialtone.sh ./dialtone.sh\n")
+	return b.String(), nil
+}
+
+func commandWords(manifest *Manifest) []string {
+	if manifest == nil {
+		return nil
+	}
+	out := []string{}
+	for _, cmd := range manifest.Commands {
+		out = append(out, cmd.Name)
+		out = append(out, cmd.Aliases...)
+	}
+	return out
+}
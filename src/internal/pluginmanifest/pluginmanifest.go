@@ -0,0 +1,320 @@
+package pluginmanifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const FileName = "plugin.json"
+
+// Modes decide how dev.go runs a plugin command: repl dispatches it through
+// the REPL leader, foreground runs it locally after warming the REPL so output
+// streams to the caller, and direct runs it locally without touching the REPL.
+const (
+	ModeREPL       = "repl"
+	ModeForeground = "foreground"
+	ModeDirect     = "direct"
+)
+
+type Requirement struct {
+	Tool    string `json:"tool"`
+	Version string `json:"version,omitempty"`
+}
+
+type Command struct {
+	Name        string   `json:"name"`
+	Aliases     []string `json:"aliases,omitempty"`
+	Args        string   `json:"args,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Mode        string   `json:"mode,omitempty"`
+}
+
+type Manifest struct {
+	Name         string        `json:"name"`
+	Version      string        `json:"version,omitempty"`
+	Description  string        `json:"description,omitempty"`
+	DefaultMode  string        `json:"default_mode,omitempty"`
+	Requirements []Requirement `json:"requirements,omitempty"`
+	Commands     []Command     `json:"commands,omitempty"`
+	Path         string        `json:"-"`
+}
+
+// Entrypoint is the runner dev.go launches, relative to the plugin dir.
+type Entrypoint struct {
+	Kind   string
+	Path   string
+	Module bool
+}
+
+type Plugin struct {
+	Name      string
+	Dir       string
+	Entry     Entrypoint
+	Manifests []Manifest
+}
+
+type Registry struct {
+	Root    string
+	plugins map[string]*Plugin
+}
+
+// Route is the resolved handling for `<plugin> [version] <command> ...`.
+type Route struct {
+	Plugin     string
+	Version    string
+	Subcommand string
+	Mode       string
+	Command    *Command
+	Manifest   *Manifest
+}
+
+// Load reads every plugins/<name>/<version>/plugin.json (or an unversioned
+// plugins/<name>/plugin.json) and probes each plugin's runner.
+func Load(root string) (*Registry, error) {
+	reg := &Registry{Root: root, plugins: map[string]*Plugin{}}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		plugin := &Plugin{Name: entry.Name(), Dir: dir, Entry: probeEntrypoint(dir)}
+		candidates := []string{filepath.Join(dir, FileName)}
+		versionDirs, _ := filepath.Glob(filepath.Join(dir, "src_v*", FileName))
+		candidates = append(candidates, versionDirs...)
+		for _, path := range candidates {
+			manifest, ok, err := readManifest(path)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			if manifest.Name != plugin.Name {
+				return nil, fmt.Errorf("%s: name %q does not match plugin dir %q", path, manifest.Name, plugin.Name)
+			}
+			if want := versionForPath(dir, path); manifest.Version != want {
+				return nil, fmt.Errorf("%s: version %q does not match dir %q", path, manifest.Version, want)
+			}
+			plugin.Manifests = append(plugin.Manifests, manifest)
+		}
+		sort.Slice(plugin.Manifests, func(i, j int) bool {
+			return versionNumber(plugin.Manifests[i].Version) < versionNumber(plugin.Manifests[j].Version)
+		})
+		if plugin.Entry.Path == "" && len(plugin.Manifests) == 0 {
+			continue
+		}
+		reg.plugins[plugin.Name] = plugin
+	}
+	return reg, nil
+}
+
+func readManifest(path string) (Manifest, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Manifest{}, false, nil
+		}
+		return Manifest{}, false, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return Manifest{}, false, fmt.Errorf("parse %s: %w", path, err)
+	}
+	manifest.Path = path
+	if err := validateMode(manifest.DefaultMode); err != nil {
+		return Manifest{}, false, fmt.Errorf("%s: default_mode: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for _, cmd := range manifest.Commands {
+		if strings.TrimSpace(cmd.Name) == "" {
+			return Manifest{}, false, fmt.Errorf("%s: command without a name", path)
+		}
+		if err := validateMode(cmd.Mode); err != nil {
+			return Manifest{}, false, fmt.Errorf("%s: command %s: %w", path, cmd.Name, err)
+		}
+		for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+			if seen[name] {
+				return Manifest{}, false, fmt.Errorf("%s: duplicate command %q", path, name)
+			}
+			seen[name] = true
+		}
+	}
+	for _, req := range manifest.Requirements {
+		if strings.TrimSpace(req.Tool) == "" {
+			return Manifest{}, false, fmt.Errorf("%s: requirement without a tool", path)
+		}
+	}
+	return manifest, true, nil
+}
+
+func validateMode(mode string) error {
+	switch mode {
+	case "", ModeREPL, ModeForeground, ModeDirect:
+		return nil
+	default:
+		return fmt.Errorf("unknown mode %q (want %s, %s or %s)", mode, ModeREPL, ModeForeground, ModeDirect)
+	}
+}
+
+func probeEntrypoint(dir string) Entrypoint {
+	module := fileExists(filepath.Join(dir, "go.mod"))
+	for _, candidate := range []Entrypoint{
+		{Kind: "go", Path: "scaffold/main.go"},
+		{Kind: "go", Path: "cli/main.go"},
+		{Kind: "shell", Path: "scaffold.sh"},
+		{Kind: "shell", Path: "cli.sh"},
+	} {
+		if fileExists(filepath.Join(dir, filepath.FromSlash(candidate.Path))) {
+			candidate.Module = module && candidate.Kind == "go"
+			return candidate
+		}
+	}
+	return Entrypoint{}
+}
+
+func versionForPath(pluginDir, manifestPath string) string {
+	parent := filepath.Dir(manifestPath)
+	if filepath.Clean(parent) == filepath.Clean(pluginDir) {
+		return ""
+	}
+	return filepath.Base(parent)
+}
+
+func versionNumber(version string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(version, "src_v"))
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (r *Registry) Plugins() []*Plugin {
+	out := make([]*Plugin, 0, len(r.plugins))
+	for _, plugin := range r.plugins {
+		out = append(out, plugin)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (r *Registry) Lookup(name string) (*Plugin, bool) {
+	plugin, ok := r.plugins[strings.TrimSpace(name)]
+	return plugin, ok
+}
+
+// Manifest returns the manifest for version, or the newest one when version is empty.
+func (p *Plugin) Manifest(version string) (*Manifest, bool) {
+	if len(p.Manifests) == 0 {
+		return nil, false
+	}
+	if version == "" {
+		return &p.Manifests[len(p.Manifests)-1], true
+	}
+	for i := range p.Manifests {
+		if p.Manifests[i].Version == version {
+			return &p.Manifests[i], true
+		}
+	}
+	return nil, false
+}
+
+func (p *Plugin) Versions() []string {
+	out := []string{}
+	for _, manifest := range p.Manifests {
+		if manifest.Version != "" {
+			out = append(out, manifest.Version)
+		}
+	}
+	return out
+}
+
+func (m *Manifest) Command(name string) (*Command, bool) {
+	for i := range m.Commands {
+		cmd := &m.Commands[i]
+		if cmd.Name == name {
+			return cmd, true
+		}
+		for _, alias := range cmd.Aliases {
+			if alias == name {
+				return cmd, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Requirements returns the toolchain requirements for version (newest when empty).
+func (p *Plugin) Requirements(version string) []Requirement {
+	manifest, ok := p.Manifest(version)
+	if !ok {
+		return nil
+	}
+	return manifest.Requirements
+}
+
+// SplitInvocation finds the version and subcommand in plugin args, accepting
+// both `src_vN <cmd>` and the legacy `<cmd> src_vN` order.
+func SplitInvocation(args []string) (version, subcommand string) {
+	if len(args) == 0 {
+		return "", ""
+	}
+	first := strings.TrimSpace(strings.ToLower(args[0]))
+	if strings.HasPrefix(first, "src_v") {
+		if len(args) < 2 {
+			return first, ""
+		}
+		return first, strings.TrimSpace(strings.ToLower(args[1]))
+	}
+	if len(args) >= 2 {
+		second := strings.TrimSpace(strings.ToLower(args[1]))
+		if strings.HasPrefix(second, "src_v") {
+			return second, first
+		}
+	}
+	return "", first
+}
+
+// Resolve picks the mode for a plugin invocation: the command's mode, else the
+// manifest default, else repl (also used for plugins without manifests).
+func (r *Registry) Resolve(plugin string, args []string) Route {
+	plugin = strings.TrimSpace(strings.ToLower(plugin))
+	version, subcommand := SplitInvocation(args)
+	route := Route{Plugin: plugin, Version: version, Subcommand: subcommand, Mode: ModeREPL}
+	p, ok := r.Lookup(plugin)
+	if !ok {
+		return route
+	}
+	manifest, ok := p.Manifest(version)
+	if !ok {
+		// Older versions without a manifest keep the plugin-wide default.
+		if latest, ok := p.Manifest(""); ok && latest.DefaultMode != "" {
+			route.Mode = latest.DefaultMode
+		}
+		return route
+	}
+	route.Manifest = manifest
+	if manifest.DefaultMode != "" {
+		route.Mode = manifest.DefaultMode
+	}
+	if cmd, ok := manifest.Command(subcommand); ok {
+		route.Command = cmd
+		if cmd.Mode != "" {
+			route.Mode = cmd.Mode
+		}
+	}
+	return route
+}
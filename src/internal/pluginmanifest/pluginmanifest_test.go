@@ -0,0 +1,82 @@
+package pluginmanifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRepoManifestsPreserveRouting(t *testing.T) {
+	reg, err := Load(filepath.Join("..", "..", "plugins"))
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	cases := []struct {
+		plugin string
+		args   []string
+		want   string
+	}{
+		{"cad", []string{"src_v1", "test"}, ModeForeground},
+		{"cad", []string{"publish", "src_v1"}, ModeForeground},
+		{"cad", []string{"src_v1", "build"}, ModeREPL},
+		{"proc", []string{"src_v1", "ps"}, ModeForeground},
+		{"logs", []string{"src_v1", "tail"}, ModeForeground},
+		{"logs", []string{"src_v1", "nats-status"}, ModeForeground},
+		{"wsl", []string{"src_v3", "status"}, ModeForeground},
+		{"repl", []string{"src_v3", "leader"}, ModeDirect},
+		{"repl", []string{"src_v2", "run"}, ModeDirect},
+		{"go", []string{"src_v1", "version"}, ModeDirect},
+		{"bun", nil, ModeDirect},
+		{"ssh", []string{"src_v1", "run"}, ModeREPL},
+		{"no-such-plugin", []string{"src_v1", "x"}, ModeREPL},
+	}
+	for _, tc := range cases {
+		if got := reg.Resolve(tc.plugin, tc.args).Mode; got != tc.want {
+			t.Fatalf("Resolve(%s %v) mode = %s, want %s", tc.plugin, tc.args, got, tc.want)
+		}
+	}
+
+	plugin, ok := reg.Lookup("cad")
+	if !ok || plugin.Entry.Path != "scaffold/main.go" || plugin.Entry.Kind != "go" {
+		t.Fatalf("unexpected cad plugin: %+v", plugin)
+	}
+	if reqs := plugin.Requirements("src_v1"); len(reqs) == 0 {
+		t.Fatalf("cad src_v1 should declare toolchain requirements")
+	}
+
+	script, err := reg.Completion("bash", []string{"plugins"})
+	if err != nil {
+		t.Fatalf("Completion returned error: %v", err)
+	}
+	for _, want := range []string{"complete -F _dialtone_complete", `proc:src_v1) words="list ps kill`, " plugins "} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("completion script missing %q", want)
+		}
+	}
+	if _, err := reg.Completion("fish", nil); err == nil {
+		t.Fatalf("expected unsupported shell error")
+	}
+}
+
+func TestLoadRejectsInvalidManifests(t *testing.T) {
+	cases := map[string]string{
+		"name":      `{"name":"other","version":"src_v1"}`,
+		"version":   `{"name":"demo","version":"src_v2"}`,
+		"mode":      `{"name":"demo","version":"src_v1","commands":[{"name":"run","mode":"background"}]}`,
+		"duplicate": `{"name":"demo","version":"src_v1","commands":[{"name":"run"},{"name":"exec","aliases":["run"]}]}`,
+	}
+	for label, body := range cases {
+		root := t.TempDir()
+		dir := filepath.Join(root, "demo", "src_v1")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, FileName), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(root); err == nil {
+			t.Fatalf("%s: expected Load to reject %s", label, body)
+		}
+	}
+}
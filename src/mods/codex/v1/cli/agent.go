@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// agentBackend is the coding agent `codex v1 start` launches into the pane.
+// The real backend runs the Codex CLI; the fake replays a scenario file so the
+// test mod can drive the same pane workflow deterministically.
+type agentBackend interface {
+	Name() string
+	// Banner is printed in the pane before the agent starts.
+	Banner() string
+	// Command is the shell command run inside the flake shell.
+	Command() string
+	// ReadyMarkers appear in the pane once the agent accepts prompts.
+	ReadyMarkers() []string
+}
+
+type codexBackend struct {
+	model     string
+	reasoning string
+}
+
+func (b codexBackend) Name() string { return "codex" }
+
+func (b codexBackend) Banner() string {
+	return fmt.Sprintf("Starting Codex CLI with %s (requested reasoning: %s) and skipping confirmations...", b.model, b.reasoning)
+}
+
+func (b codexBackend) Command() string { return buildCodexExecCommand(b.model, b.reasoning) }
+
+func (b codexBackend) ReadyMarkers() []string { return []string{"OpenAI Codex", "model:"} }
+
+type fakeBackend struct {
+	scenario string
+}
+
+func (b fakeBackend) Name() string { return "fake" }
+
+func (b fakeBackend) Banner() string {
+	return fmt.Sprintf("Starting fake agent with scenario %s...", b.scenario)
+}
+
+func (b fakeBackend) Command() string {
+	return "exec ./dialtone_mod codex v1 fake-agent --scenario " + shellQuote(b.scenario)
+}
+
+func (b fakeBackend) ReadyMarkers() []string { return []string{fakeAgentBanner, "scenario:"} }
+
+func newAgentBackend(name, model, reasoning, scenario string) (agentBackend, error) {
+	switch strings.TrimSpace(name) {
+	case "", "codex":
+		return codexBackend{model: strings.TrimSpace(model), reasoning: strings.TrimSpace(reasoning)}, nil
+	case "fake":
+		if strings.TrimSpace(scenario) == "" {
+			return nil, fmt.Errorf("--backend fake requires --scenario FILE")
+		}
+		return fakeBackend{scenario: strings.TrimSpace(scenario)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported --backend %q (use codex or fake)", name)
+	}
+}
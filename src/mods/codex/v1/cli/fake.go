@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const fakeAgentBanner = "Dialtone fake agent"
+
+// fakeScenario scripts the fake agent: each step waits until the prompt text
+// typed into the pane matches Prompt, sleeps DelayMS, then runs Commands.
+// Commands may reference Prompt submatches ($1, ${name}).
+type fakeScenario struct {
+	Name  string     `json:"name"`
+	Steps []fakeStep `json:"steps"`
+}
+
+type fakeStep struct {
+	Prompt   string   `json:"prompt"`
+	DelayMS  int      `json:"delay_ms"`
+	Say      string   `json:"say"`
+	Commands []string `json:"commands"`
+
+	pattern *regexp.Regexp
+}
+
+type fakeCommandRunner func(command string, stdout, stderr io.Writer) error
+
+var fakeAgentSleep = time.Sleep
+
+func loadFakeScenario(path string) (fakeScenario, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fakeScenario{}, err
+	}
+	return parseFakeScenario(raw)
+}
+
+func parseFakeScenario(raw []byte) (fakeScenario, error) {
+	var scenario fakeScenario
+	if err := json.Unmarshal(raw, &scenario); err != nil {
+		return fakeScenario{}, fmt.Errorf("parse scenario: %w", err)
+	}
+	if len(scenario.Steps) == 0 {
+		return fakeScenario{}, errors.New("scenario has no steps")
+	}
+	if strings.TrimSpace(scenario.Name) == "" {
+		scenario.Name = "unnamed"
+	}
+	for i := range scenario.Steps {
+		step := &scenario.Steps[i]
+		if strings.TrimSpace(step.Prompt) == "" {
+			return fakeScenario{}, fmt.Errorf("step %d: prompt pattern is required", i+1)
+		}
+		if step.DelayMS < 0 {
+			return fakeScenario{}, fmt.Errorf("step %d: delay_ms must not be negative", i+1)
+		}
+		pattern, err := regexp.Compile(step.Prompt)
+		if err != nil {
+			return fakeScenario{}, fmt.Errorf("step %d: %w", i+1, err)
+		}
+		step.pattern = pattern
+	}
+	return scenario, nil
+}
+
+// expand returns the step's commands with prompt submatches substituted, or
+// false when input does not match the step yet.
+func (s fakeStep) expand(input string) ([]string, bool) {
+	match := s.pattern.FindStringSubmatchIndex(input)
+	if match == nil {
+		return nil, false
+	}
+	out := make([]string, 0, len(s.Commands))
+	for _, template := range s.Commands {
+		command := string(s.pattern.ExpandString(nil, template, input, match))
+		if strings.TrimSpace(command) != "" {
+			out = append(out, command)
+		}
+	}
+	return out, true
+}
+
+// runFakeScenario reads prompt lines from in and plays the steps in order.
+// After the last step it keeps draining input so the pane stays open like an
+// idle agent would.
+func runFakeScenario(scenario fakeScenario, in io.Reader, out io.Writer, run fakeCommandRunner) error {
+	fmt.Fprintf(out, "%s\n", fakeAgentBanner)
+	fmt.Fprintf(out, "scenario: %s (%d steps)\n", scenario.Name, len(scenario.Steps))
+	fmt.Fprintln(out, "waiting for prompt...")
+
+	reader := bufio.NewScanner(in)
+	reader.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var pending strings.Builder
+	next := 0
+	for reader.Scan() {
+		if next >= len(scenario.Steps) {
+			continue
+		}
+		pending.WriteString(reader.Text())
+		pending.WriteByte('\n')
+		step := scenario.Steps[next]
+		commands, ok := step.expand(pending.String())
+		if !ok {
+			continue
+		}
+		pending.Reset()
+		next++
+		if step.DelayMS > 0 {
+			fakeAgentSleep(time.Duration(step.DelayMS) * time.Millisecond)
+		}
+		if strings.TrimSpace(step.Say) != "" {
+			fmt.Fprintf(out, "%s\n", strings.TrimSpace(step.Say))
+		}
+		for _, command := range commands {
+			fmt.Fprintf(out, "$ %s\n", command)
+			if err := run(command, out, out); err != nil {
+				fmt.Fprintf(out, "command failed: %v\n", err)
+			}
+		}
+		if next == len(scenario.Steps) {
+			fmt.Fprintln(out, "scenario complete")
+		}
+	}
+	return reader.Err()
+}
+
+func runFakeAgent(argv []string) error {
+	opts := flag.NewFlagSet("codex v1 fake-agent", flag.ContinueOnError)
+	scenarioPath := opts.String("scenario", "", "Scenario JSON file of expected prompts and the commands to issue")
+	if err := opts.Parse(argv); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*scenarioPath) == "" {
+		return errors.New("--scenario is required")
+	}
+	scenario, err := loadFakeScenario(strings.TrimSpace(*scenarioPath))
+	if err != nil {
+		return err
+	}
+	return runFakeScenario(scenario, os.Stdin, os.Stdout, func(command string, stdout, stderr io.Writer) error {
+		cmd := exec.Command("bash", "-lc", command)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		return cmd.Run()
+	})
+}
@@ -56,6 +56,10 @@ func main() {
 		if err := runStatus(args); err != nil {
 			exitIfErr(err, "codex status")
 		}
+	case "fake-agent":
+		if err := runFakeAgent(args); err != nil {
+			exitIfErr(err, "codex fake-agent")
+		}
 	default:
 		fmt.Fprintf(os.Stderr, "unknown codex command: %s\n", command)
 		printUsage()
@@ -70,15 +74,28 @@ func runStart(argv []string) error {
 	shellName := opts.String("shell", "default", "flake shell to enter before launching Codex")
 	reasoning := opts.String("reasoning", "medium", "Codex reasoning effort to request")
 	model := opts.String("model", "gpt-5.4", "Codex model to launch")
+	backendName := opts.String("backend", "codex", "Agent backend to launch: codex|fake")
+	scenario := opts.String("scenario", "", "Scenario JSON file for --backend fake")
 	if err := opts.Parse(argv); err != nil {
 		return err
 	}
+	if strings.TrimSpace(*scenario) != "" {
+		abs, err := filepath.Abs(strings.TrimSpace(*scenario))
+		if err != nil {
+			return err
+		}
+		*scenario = abs
+	}
+	backend, err := newAgentBackend(*backendName, *model, *reasoning, *scenario)
+	if err != nil {
+		return err
+	}
 
 	repoRoot, err := locateRepoRoot()
 	if err != nil {
 		return err
 	}
-	startCmd := buildStartCommand(repoRoot, *shellName, *reasoning, *model)
+	startCmd := buildAgentStartCommand(repoRoot, *shellName, backend)
 	explicitPane := strings.TrimSpace(*pane)
 	if explicitPane != "" {
 		target := normalizePaneTarget(explicitPane)
@@ -86,7 +103,7 @@ func runStart(argv []string) error {
 			return err
 		}
 		trimPaneStartupScrollback(target)
-		fmt.Printf("started codex in tmux pane %s\n", target)
+		fmt.Printf("started %s in tmux pane %s\n", backend.Name(), target)
 		return nil
 	}
 	if err := ensureSession(*session, repoRoot); err != nil {
@@ -100,7 +117,7 @@ func runStart(argv []string) error {
 		return err
 	}
 	trimPaneStartupScrollback(target)
-	fmt.Printf("started codex in tmux session %s via %s\n", *session, target)
+	fmt.Printf("started %s in tmux session %s via %s\n", backend.Name(), *session, target)
 	return nil
 }
 
@@ -170,12 +187,14 @@ func activePaneTarget(session string) (string, error) {
 }
 
 func buildStartCommand(repoRoot, shellName, reasoning, model string) string {
-	codexCmd := buildCodexExecCommand(strings.TrimSpace(model), strings.TrimSpace(reasoning))
+	return buildAgentStartCommand(repoRoot, shellName, codexBackend{model: strings.TrimSpace(model), reasoning: strings.TrimSpace(reasoning)})
+}
+
+func buildAgentStartCommand(repoRoot, shellName string, backend agentBackend) string {
 	inner := fmt.Sprintf(
-		"clear; printf 'Starting Codex CLI with %s (requested reasoning: %s) and skipping confirmations...\\n'; %s",
-		shellSingleQuoteLiteral(strings.TrimSpace(model)),
-		shellSingleQuoteLiteral(strings.TrimSpace(reasoning)),
-		codexCmd,
+		"clear; printf '%%s\\n' '%s'; %s",
+		shellSingleQuoteLiteral(backend.Banner()),
+		backend.Command(),
 	)
 	return fmt.Sprintf(
 		"cd %s && exec env DIALTONE_NIX_SHELL_BANNER=0 nix --extra-experimental-features %s --no-warn-dirty develop %s --command bash -lc %s",
@@ -300,10 +319,12 @@ func printUsage() {
 	fmt.Println("       Run gofmt on codex v1 Go files")
 	fmt.Println("  test")
 	fmt.Println("       Run go test for codex v1 plus direct-routing helpers")
-	fmt.Println("  start [--session codex-view] [--shell default|ssh-v1] [--reasoning medium] [--model gpt-5.4]")
-	fmt.Println("       Launch Codex directly in the target tmux pane via nix develop; shell v1 owns the broader workflow")
+	fmt.Println("  start [--session codex-view] [--shell default|ssh-v1] [--reasoning medium] [--model gpt-5.4] [--backend codex|fake] [--scenario FILE]")
+	fmt.Println("       Launch Codex (or the scripted fake agent) directly in the target tmux pane via nix develop; shell v1 owns the broader workflow")
 	fmt.Println("  status [--session codex-view]")
 	fmt.Println("       Show the current pane command and cwd for the tmux session")
+	fmt.Println("  fake-agent --scenario FILE")
+	fmt.Println("       Play a scenario of expected prompts and the ./dialtone_mod commands to issue; used by start --backend fake")
 }
 
 func exitIfErr(err error, context string) {
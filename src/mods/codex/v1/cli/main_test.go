@@ -2,9 +2,11 @@ package main
 
 import (
 	"errors"
+	"io"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCodexTestPackagesCoverDirectControlPlaneContract(t *testing.T) {
@@ -235,3 +237,93 @@ func captureCodexStdout(t *testing.T, fn func()) string {
 	_ = w.Close()
 	return <-done
 }
+
+func TestBuildAgentStartCommandLaunchesFakeBackend(t *testing.T) {
+	backend, err := newAgentBackend("fake", "gpt-5.4", "medium", "/tmp/scenario's.json")
+	if err != nil {
+		t.Fatalf("newAgentBackend returned error: %v", err)
+	}
+	cmd := buildAgentStartCommand("/tmp/dialtone", "default", backend)
+	if !strings.Contains(cmd, "develop '.#default'") || !strings.Contains(cmd, "clear; printf") {
+		t.Fatalf("fake backend should reuse the repo shell launch: %q", cmd)
+	}
+	if !strings.Contains(cmd, "./dialtone_mod codex v1 fake-agent --scenario") || strings.Contains(cmd, "command -v codex") {
+		t.Fatalf("missing fake-agent launch: %q", cmd)
+	}
+	if got := backend.ReadyMarkers(); len(got) == 0 || got[0] != fakeAgentBanner {
+		t.Fatalf("unexpected fake ready markers: %v", got)
+	}
+	if _, err := newAgentBackend("fake", "", "", ""); err == nil {
+		t.Fatalf("expected fake backend without scenario to fail")
+	}
+	if _, err := newAgentBackend("claude", "", "", ""); err == nil {
+		t.Fatalf("expected unknown backend to fail")
+	}
+}
+
+func TestParseFakeScenarioValidatesSteps(t *testing.T) {
+	for _, raw := range []string{
+		`{"name":"empty","steps":[]}`,
+		`{"steps":[{"prompt":""}]}`,
+		`{"steps":[{"prompt":"(","commands":["x"]}]}`,
+		`{"steps":[{"prompt":"x","delay_ms":-1}]}`,
+		`not json`,
+	} {
+		if _, err := parseFakeScenario([]byte(raw)); err == nil {
+			t.Fatalf("expected %s to be rejected", raw)
+		}
+	}
+}
+
+func TestRunFakeScenarioIssuesCommandsInOrder(t *testing.T) {
+	scenario, err := parseFakeScenario([]byte(`{
+		"name": "probe",
+		"steps": [
+			{"prompt": "(?m)^(\\./dialtone_mod mods v1 probe .*--label (\\S+))$", "delay_ms": 250, "say": "running probe", "commands": ["$1", "echo ${2}"]},
+			{"prompt": "second", "commands": ["./dialtone_mod mods v1 db graph"]}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("parseFakeScenario returned error: %v", err)
+	}
+	var slept []time.Duration
+	fakeAgentSleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { fakeAgentSleep = time.Sleep }()
+
+	input := strings.Join([]string{
+		"Dialtone test v1 start TOKEN: this is the test.",
+		"Run this command once exactly as written:",
+		"./dialtone_mod mods v1 probe --mode success --label CODEX_AGENT_TOKEN",
+		"1. ./dialtone_mod mods v1 probe --mode fail --label TEST_FAILURE",
+		"second prompt",
+		"third prompt is ignored",
+	}, "\n") + "\n"
+	var ran []string
+	var out strings.Builder
+	err = runFakeScenario(scenario, strings.NewReader(input), &out, func(command string, stdout, stderr io.Writer) error {
+		ran = append(ran, command)
+		if strings.HasPrefix(command, "echo") {
+			return errors.New("exit status 1")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("runFakeScenario returned error: %v", err)
+	}
+	want := []string{
+		"./dialtone_mod mods v1 probe --mode success --label CODEX_AGENT_TOKEN",
+		"echo CODEX_AGENT_TOKEN",
+		"./dialtone_mod mods v1 db graph",
+	}
+	if strings.Join(ran, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected commands\nwant:\n%s\n\ngot:\n%s", strings.Join(want, "\n"), strings.Join(ran, "\n"))
+	}
+	if len(slept) != 1 || slept[0] != 250*time.Millisecond {
+		t.Fatalf("unexpected delays: %v", slept)
+	}
+	for _, line := range []string{fakeAgentBanner, "scenario: probe (2 steps)", "running probe", "$ echo CODEX_AGENT_TOKEN", "command failed: exit status 1", "scenario complete"} {
+		if !strings.Contains(out.String(), line) {
+			t.Fatalf("fake agent output missing %q:\n%s", line, out.String())
+		}
+	}
+}
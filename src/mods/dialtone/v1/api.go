@@ -0,0 +1,520 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"dialtone/dev/internal/modstate"
+	"dialtone/dev/mods/shared/dispatch"
+	"dialtone/dev/mods/shared/sqlitestate"
+)
+
+const (
+	apiListenKey         = "dialtone.daemon.api"
+	apiEventPollInterval = time.Second
+	apiEventPingInterval = 15 * time.Second
+	apiEventWindow       = 100
+)
+
+type apiServer struct {
+	repoRoot     string
+	db           *sql.DB
+	pollInterval time.Duration
+}
+
+type apiCommandRow struct {
+	modstate.ShellBusRecord
+	Body *dispatch.ShellCommandIntent `json:"body,omitempty"`
+}
+
+type apiTestRun struct {
+	modstate.ModTestRunRecord
+	Steps []modstate.ModTestRunStepRecord `json:"steps"`
+}
+
+type apiProtocolRun struct {
+	modstate.ProtocolRunRecord
+	Events []modstate.ProtocolEventRecord `json:"events"`
+}
+
+type apiEvent struct {
+	Kind string `json:"kind"`
+	Op   string `json:"op"`
+	Key  string `json:"key"`
+	Row  any    `json:"row"`
+}
+
+type apiChangeTracker struct {
+	seen map[string]string
+}
+
+func defaultAPISocketPath(repoRoot string) string {
+	return filepath.Join(sqlitestate.ResolveStateDir(repoRoot), "dialtone.sock")
+}
+
+func resolveAPIListenAddress(repoRoot, raw string) (string, string, error) {
+	value := strings.TrimSpace(raw)
+	switch {
+	case value == "" || value == "unix":
+		return "unix", defaultAPISocketPath(repoRoot), nil
+	case value == "off":
+		return "", "", nil
+	case strings.HasPrefix(value, "unix:"):
+		path := strings.TrimSpace(strings.TrimPrefix(value, "unix:"))
+		if path == "" {
+			return "", "", errors.New("--listen unix: requires a socket path")
+		}
+		return "unix", path, nil
+	}
+	host, _, err := net.SplitHostPort(value)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid --listen address %q: %w", value, err)
+	}
+	if host != "localhost" {
+		ip := net.ParseIP(host)
+		if ip == nil || !ip.IsLoopback() {
+			return "", "", fmt.Errorf("--listen must be a unix socket or a loopback address, got %q", value)
+		}
+	}
+	return "tcp", value, nil
+}
+
+func startAPIServer(repoRoot string, db *sql.DB, listen string) (func(), string, error) {
+	network, address, err := resolveAPIListenAddress(repoRoot, listen)
+	if err != nil || network == "" {
+		return func() {}, "", err
+	}
+	if network == "unix" {
+		if err := os.MkdirAll(filepath.Dir(address), 0o755); err != nil {
+			return nil, "", err
+		}
+		if err := os.Remove(address); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, "", err
+		}
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, "", err
+	}
+	if network == "unix" {
+		_ = os.Chmod(address, 0o600)
+	}
+	api := &apiServer{repoRoot: repoRoot, db: db, pollInterval: apiEventPollInterval}
+	server := &http.Server{Handler: api.routes(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "DIALTONE> api server stopped: %v\n", err)
+		}
+	}()
+	label := network + ":" + address
+	if network == "tcp" {
+		label = "http://" + listener.Addr().String()
+	}
+	stop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+		if network == "unix" {
+			_ = os.Remove(address)
+		}
+	}
+	return stop, label, nil
+}
+
+func (api *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/status", api.handleStatus)
+	mux.HandleFunc("GET /api/v1/state", api.handleState)
+	mux.HandleFunc("GET /api/v1/commands", api.handleCommands)
+	mux.HandleFunc("GET /api/v1/commands/{id}", api.handleCommand)
+	mux.HandleFunc("GET /api/v1/command-runs", api.handleCommandRuns)
+	mux.HandleFunc("GET /api/v1/command-runs/{id}", api.handleCommandRun)
+	mux.HandleFunc("GET /api/v1/test-runs", api.handleTestRuns)
+	mux.HandleFunc("GET /api/v1/test-runs/{id}", api.handleTestRun)
+	mux.HandleFunc("GET /api/v1/protocol-runs", api.handleProtocolRuns)
+	mux.HandleFunc("GET /api/v1/protocol-runs/{id}", api.handleProtocolRun)
+	mux.HandleFunc("GET /api/v1/events", api.handleEvents)
+	return mux
+}
+
+func (api *apiServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	values, err := modstate.LoadStateValues(api.db, sqlitestate.SystemScope)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	state := make(map[string]string, len(values))
+	for _, value := range values {
+		state[value.Key] = value.Value
+	}
+	queued, err := countQueuedRows(api.db)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]any{
+		"state_db":       sqlitestate.ResolveStateDBPath(api.repoRoot),
+		"prompt_target":  state[sqlitestate.TmuxPromptTargetKey],
+		"command_target": state[sqlitestate.TmuxTargetKey],
+		"queued":         queued,
+		"state":          state,
+	})
+}
+
+func (api *apiServer) handleState(w http.ResponseWriter, r *http.Request) {
+	scope := strings.TrimSpace(r.URL.Query().Get("scope"))
+	if scope == "" {
+		scope = sqlitestate.SystemScope
+	}
+	values, err := modstate.LoadStateValues(api.db, scope)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]any{"scope": scope, "values": values})
+}
+
+func (api *apiServer) handleCommands(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := commandsOptions{
+		limit:   20,
+		scope:   "desired",
+		subject: "command",
+		status:  strings.TrimSpace(query.Get("status")),
+		session: strings.TrimSpace(query.Get("session")),
+		pane:    strings.TrimSpace(query.Get("pane")),
+	}
+	if value := strings.TrimSpace(query.Get("scope")); value != "" {
+		opts.scope = value
+	}
+	if value := strings.TrimSpace(query.Get("subject")); value != "" {
+		opts.subject = value
+	}
+	limit, err := parseAPILimit(query.Get("limit"), opts.limit)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	opts.limit = limit
+	loadLimit := opts.limit
+	if loadLimit < 100 {
+		loadLimit = 100
+	}
+	scope := opts.scope
+	if scope == "all" {
+		scope = ""
+	}
+	rows, err := modstate.LoadShellBus(api.db, scope, loadLimit)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	out := make([]apiCommandRow, 0, opts.limit)
+	for _, row := range rows {
+		if !matchesCommandFilters(row, opts) {
+			continue
+		}
+		out = append(out, newAPICommandRow(row))
+		if len(out) >= opts.limit {
+			break
+		}
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]any{"rows": out})
+}
+
+func (api *apiServer) handleCommand(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseAPIPathID(w, r)
+	if !ok {
+		return
+	}
+	row, found, err := modstate.LoadShellBusRecord(api.db, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !found {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("shell bus row %d not found", id))
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, newAPICommandRow(row))
+}
+
+func (api *apiServer) handleCommandRuns(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseAPILimit(r.URL.Query().Get("limit"), 20)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	rows, err := modstate.LoadCommandRuns(api.db, limit)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]any{"rows": rows})
+}
+
+func (api *apiServer) handleCommandRun(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseAPIPathID(w, r)
+	if !ok {
+		return
+	}
+	run, found, err := modstate.LoadCommandRun(api.db, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !found {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("command run %d not found", id))
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, run)
+}
+
+func (api *apiServer) handleTestRuns(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseAPILimit(r.URL.Query().Get("limit"), 20)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	rows, err := modstate.LoadModTestRuns(api.db, limit)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]any{"rows": rows})
+}
+
+func (api *apiServer) handleTestRun(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseAPIPathID(w, r)
+	if !ok {
+		return
+	}
+	run, found, err := modstate.LoadModTestRun(api.db, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !found {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("test run %d not found", id))
+		return
+	}
+	steps, err := modstate.LoadModTestRunSteps(api.db, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, apiTestRun{ModTestRunRecord: run, Steps: steps})
+}
+
+func (api *apiServer) handleProtocolRuns(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseAPILimit(r.URL.Query().Get("limit"), 20)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	rows, err := modstate.LoadProtocolRuns(api.db, limit)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]any{"rows": rows})
+}
+
+func (api *apiServer) handleProtocolRun(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseAPIPathID(w, r)
+	if !ok {
+		return
+	}
+	run, found, err := loadProtocolRunByID(api.db, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !found {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("protocol run %d not found", id))
+		return
+	}
+	events, err := modstate.LoadProtocolEvents(api.db, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, apiProtocolRun{ProtocolRunRecord: run, Events: events})
+}
+
+func (api *apiServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, errors.New("streaming is not supported by this connection"))
+		return
+	}
+	tracker := newAPIChangeTracker()
+	initial, err := tracker.poll(api.db)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	eventID := 0
+	send := func(events []apiEvent) error {
+		for _, event := range events {
+			raw, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			eventID++
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", eventID, event.Kind, raw); err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+		return nil
+	}
+	if r.URL.Query().Get("replay") == "1" {
+		if err := send(initial); err != nil {
+			return
+		}
+	} else {
+		_, _ = fmt.Fprint(w, ": ready\n\n")
+		flusher.Flush()
+	}
+	poll := time.NewTicker(api.pollInterval)
+	defer poll.Stop()
+	ping := time.NewTicker(apiEventPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-poll.C:
+			events, err := tracker.poll(api.db)
+			if err != nil {
+				events = []apiEvent{{Kind: "error", Op: "poll", Row: err.Error()}}
+			}
+			if len(events) == 0 {
+				continue
+			}
+			if err := send(events); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func newAPIChangeTracker() *apiChangeTracker {
+	return &apiChangeTracker{seen: map[string]string{}}
+}
+
+// poll diffs the latest rows of each watched table against the previous poll
+// and returns insert/update events in table order.
+func (tracker *apiChangeTracker) poll(db *sql.DB) ([]apiEvent, error) {
+	events := []apiEvent{}
+	busRows, err := modstate.LoadShellBus(db, "", apiEventWindow)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(busRows) - 1; i >= 0; i-- {
+		row := busRows[i]
+		fingerprint := row.Status + "|" + row.UpdatedAt + "|" + strconv.FormatInt(row.RefID, 10) + "|" + strconv.Itoa(len(row.BodyJSON))
+		events = tracker.observe(events, "shell_bus", strconv.FormatInt(row.ID, 10), fingerprint, newAPICommandRow(row))
+	}
+	commandRuns, err := modstate.LoadCommandRuns(db, apiEventWindow)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(commandRuns) - 1; i >= 0; i-- {
+		run := commandRuns[i]
+		fingerprint := run.Status + "|" + run.HeartbeatAt + "|" + run.FinishedAt + "|" + strconv.Itoa(run.PID)
+		events = tracker.observe(events, "command_run", strconv.FormatInt(run.ID, 10), fingerprint, run)
+	}
+	testRuns, err := modstate.LoadModTestRuns(db, apiEventWindow)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(testRuns) - 1; i >= 0; i-- {
+		run := testRuns[i]
+		fingerprint := fmt.Sprintf("%s|%d|%d|%d|%s", run.Status, run.PassedSteps, run.FailedSteps, run.SkippedSteps, run.FinishedAt)
+		events = tracker.observe(events, "test_run", strconv.FormatInt(run.ID, 10), fingerprint, run)
+	}
+	values, err := modstate.LoadStateValues(db, sqlitestate.SystemScope)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		events = tracker.observe(events, "state", value.Key, value.Value, value)
+	}
+	return events, nil
+}
+
+func (tracker *apiChangeTracker) observe(events []apiEvent, kind, key, fingerprint string, row any) []apiEvent {
+	seenKey := kind + ":" + key
+	previous, ok := tracker.seen[seenKey]
+	if ok && previous == fingerprint {
+		return events
+	}
+	tracker.seen[seenKey] = fingerprint
+	op := "update"
+	if !ok {
+		op = "insert"
+	}
+	return append(events, apiEvent{Kind: kind, Op: op, Key: key, Row: row})
+}
+
+func newAPICommandRow(row modstate.ShellBusRecord) apiCommandRow {
+	out := apiCommandRow{ShellBusRecord: row}
+	if body, ok := decodeIntentBody(row); ok {
+		out.Body = &body
+	}
+	return out
+}
+
+func parseAPILimit(raw string, fallback int) (int, error) {
+	value := strings.TrimSpace(raw)
+	if value == "" {
+		return fallback, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("limit must be a positive integer, got %q", value)
+	}
+	return limit, nil
+}
+
+func parseAPIPathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(strings.TrimSpace(r.PathValue("id")), 10, 64)
+	if err != nil || id <= 0 {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid id %q", r.PathValue("id")))
+		return 0, false
+	}
+	return id, true
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(payload)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIJSON(w, status, map[string]string{"error": err.Error()})
+}
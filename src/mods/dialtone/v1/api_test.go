@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"dialtone/dev/internal/modstate"
+	"dialtone/dev/mods/shared/dispatch"
+	"dialtone/dev/mods/shared/sqlitestate"
+)
+
+func TestResolveAPIListenAddressAcceptsSocketsAndLoopbackOnly(t *testing.T) {
+	repoRoot := t.TempDir()
+	t.Setenv("DIALTONE_STATE_DIR", filepath.Join(repoRoot, "state"))
+	cases := []struct {
+		raw     string
+		network string
+		address string
+		wantErr bool
+	}{
+		{raw: "", network: "unix", address: filepath.Join(repoRoot, "state", "dialtone.sock")},
+		{raw: "off"},
+		{raw: "unix:/tmp/dialtone-test.sock", network: "unix", address: "/tmp/dialtone-test.sock"},
+		{raw: "127.0.0.1:7777", network: "tcp", address: "127.0.0.1:7777"},
+		{raw: "localhost:0", network: "tcp", address: "localhost:0"},
+		{raw: "0.0.0.0:7777", wantErr: true},
+		{raw: "unix:", wantErr: true},
+	}
+	for _, tc := range cases {
+		network, address, err := resolveAPIListenAddress(repoRoot, tc.raw)
+		if tc.wantErr {
+			if err == nil {
+				t.Fatalf("resolveAPIListenAddress(%q) expected error", tc.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("resolveAPIListenAddress(%q) returned error: %v", tc.raw, err)
+		}
+		if network != tc.network || address != tc.address {
+			t.Fatalf("resolveAPIListenAddress(%q) = %q %q, want %q %q", tc.raw, network, address, tc.network, tc.address)
+		}
+	}
+}
+
+func TestAPIServesCommandsAndTestRunsAsJSON(t *testing.T) {
+	db := openDialtoneTestDB(t)
+	body := mustEncodeIntentBody(t, dispatch.ShellCommandIntent{
+		Command: "./dialtone_mod mods v1 db graph",
+		Target:  "codex-view:0:1",
+		Summary: "graph completed",
+	})
+	rowID, err := modstate.EnqueueShellBus(db, "shell", "desired", "command", "run", "dialtone_mod", "codex-view", "codex-view:0:1", body)
+	if err != nil {
+		t.Fatalf("EnqueueShellBus returned error: %v", err)
+	}
+	if err := modstate.UpdateShellBusStatus(db, rowID, "done", 0, body); err != nil {
+		t.Fatalf("UpdateShellBusStatus returned error: %v", err)
+	}
+	server := httptest.NewServer((&apiServer{db: db, pollInterval: 10 * time.Millisecond}).routes())
+	defer server.Close()
+
+	var list struct {
+		Rows []apiCommandRow `json:"rows"`
+	}
+	getAPIJSON(t, server.URL+"/api/v1/commands?status=done", http.StatusOK, &list)
+	if len(list.Rows) != 1 || list.Rows[0].ID != rowID || list.Rows[0].Body == nil || list.Rows[0].Body.Summary != "graph completed" {
+		t.Fatalf("unexpected commands payload: %+v", list.Rows)
+	}
+
+	var row apiCommandRow
+	getAPIJSON(t, server.URL+"/api/v1/commands/"+strconv.FormatInt(rowID, 10), http.StatusOK, &row)
+	if row.Status != "done" || row.Pane != "codex-view:0:1" {
+		t.Fatalf("unexpected command payload: %+v", row)
+	}
+
+	var missing map[string]string
+	getAPIJSON(t, server.URL+"/api/v1/test-runs/999", http.StatusNotFound, &missing)
+	if !strings.Contains(missing["error"], "not found") {
+		t.Fatalf("expected not found error, got %+v", missing)
+	}
+	getAPIJSON(t, server.URL+"/api/v1/commands?limit=nope", http.StatusBadRequest, &missing)
+}
+
+func TestAPIChangeTrackerEmitsInsertAndUpdateOnce(t *testing.T) {
+	db := openDialtoneTestDB(t)
+	tracker := newAPIChangeTracker()
+	if _, err := tracker.poll(db); err != nil {
+		t.Fatalf("poll returned error: %v", err)
+	}
+	rowID, err := modstate.EnqueueShellBus(db, "shell", "desired", "command", "run", "dialtone_mod", "codex-view", "codex-view:0:1", "")
+	if err != nil {
+		t.Fatalf("EnqueueShellBus returned error: %v", err)
+	}
+	if err := modstate.UpsertStateValue(db, sqlitestate.SystemScope, "dialtone.daemon.status", "running"); err != nil {
+		t.Fatalf("UpsertStateValue returned error: %v", err)
+	}
+	events, err := tracker.poll(db)
+	if err != nil {
+		t.Fatalf("poll returned error: %v", err)
+	}
+	if len(events) != 2 || events[0].Kind != "shell_bus" || events[0].Op != "insert" || events[1].Kind != "state" {
+		t.Fatalf("unexpected insert events: %+v", events)
+	}
+	if events, err := tracker.poll(db); err != nil || len(events) != 0 {
+		t.Fatalf("expected no events on unchanged poll, got %+v err=%v", events, err)
+	}
+	if err := modstate.UpdateShellBusStatus(db, rowID, "running", 0, ""); err != nil {
+		t.Fatalf("UpdateShellBusStatus returned error: %v", err)
+	}
+	events, err = tracker.poll(db)
+	if err != nil {
+		t.Fatalf("poll returned error: %v", err)
+	}
+	if len(events) != 1 || events[0].Op != "update" || events[0].Key != strconv.FormatInt(rowID, 10) {
+		t.Fatalf("unexpected update events: %+v", events)
+	}
+}
+
+func TestAPIEventsStreamsShellBusChanges(t *testing.T) {
+	db := openDialtoneTestDB(t)
+	server := httptest.NewServer((&apiServer{db: db, pollInterval: 10 * time.Millisecond}).routes())
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/events", nil)
+	if err != nil {
+		t.Fatalf("NewRequest returned error: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET events returned error: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+	if _, err := modstate.EnqueueShellBus(db, "shell", "desired", "command", "run", "dialtone_mod", "codex-view", "codex-view:0:1", ""); err != nil {
+		t.Fatalf("EnqueueShellBus returned error: %v", err)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "event: shell_bus" {
+			return
+		}
+	}
+	t.Fatalf("event stream ended without shell_bus event: %v", scanner.Err())
+}
+
+func getAPIJSON(t *testing.T, url string, wantStatus int, out any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s returned error: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != wantStatus {
+		t.Fatalf("GET %s status = %d, want %d", url, resp.StatusCode, wantStatus)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatalf("decode %s: %v", url, err)
+	}
+}
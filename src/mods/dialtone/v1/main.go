@@ -166,6 +166,7 @@ func runPaths(argv []string) error {
 	fmt.Printf("state_db\t%s\n", sqlitestate.ResolveStateDBPath(repoRoot))
 	fmt.Printf("logs_dir\t%s\n", sqlitestate.ResolveLogsDir(repoRoot))
 	fmt.Printf("command_logs_dir\t%s\n", sqlitestate.ResolveCommandLogsDir(repoRoot))
+	fmt.Printf("api_socket\t%s\n", defaultAPISocketPath(repoRoot))
 	return nil
 }
 
@@ -205,7 +206,12 @@ func runProcesses(argv []string) error {
 }
 
 func runServe(argv []string) error {
-	if len(argv) != 0 {
+	fs := flag.NewFlagSet("dialtone v1 serve", flag.ContinueOnError)
+	listen := fs.String("listen", "", "API listen address: unix socket (default), unix:/path, 127.0.0.1:port, or off")
+	if err := fs.Parse(argv); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
 		return errors.New("serve does not accept positional arguments")
 	}
 	repoRoot, err := locateRepoRoot()
@@ -242,6 +248,19 @@ func runServe(argv []string) error {
 	}
 	defer markStopped()
 
+	stopAPI, apiAddress, err := startAPIServer(repoRoot, db, *listen)
+	if err != nil {
+		return fmt.Errorf("start api server: %w", err)
+	}
+	defer stopAPI()
+	defer func() { _ = modstate.DeleteStateValue(db, sqlitestate.SystemScope, apiListenKey) }()
+	if apiAddress != "" {
+		if err := modstate.UpsertStateValue(db, sqlitestate.SystemScope, apiListenKey, apiAddress); err != nil {
+			return err
+		}
+		fmt.Printf("DIALTONE> api listening on %s\n", apiAddress)
+	}
+
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 	defer signal.Stop(signals)
@@ -1769,8 +1788,8 @@ func printUsage() {
 	fmt.Println("       Print repo/state/log paths used by the dialtone control plane")
 	fmt.Println("  ensure")
 	fmt.Println("       Ensure the standalone dialtone daemon process is running outside Nix")
-	fmt.Println("  serve")
-	fmt.Println("       Run the standalone dialtone daemon loop outside Nix")
+	fmt.Println("  serve [--listen unix|unix:/path|127.0.0.1:PORT|off]")
+	fmt.Println("       Run the standalone dialtone daemon loop outside Nix and serve the local JSON/SSE API")
 	fmt.Println("  processes")
 	fmt.Println("       Print the live dialtone/dialtone_mod/worker process table")
 	fmt.Println("  status [--row-id <id>] [--full] [--sync=false]")
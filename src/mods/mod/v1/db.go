@@ -23,6 +23,8 @@ func runDB(args []string) error {
 		return runDBPath(args[1:])
 	case "init":
 		return runDBInit(args[1:])
+	case "migrate":
+		return runDBMigrate(args[1:])
 	case "sync":
 		return runDBSync(args[1:])
 	case "graph":
@@ -99,6 +101,76 @@ func runDBInit(args []string) error {
 	return nil
 }
 
+func runDBMigrate(args []string) error {
+	action := "status"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action = strings.ToLower(strings.TrimSpace(args[0]))
+		args = args[1:]
+	}
+	fs := flag.NewFlagSet("mods db migrate "+action, flag.ContinueOnError)
+	dbPath := fs.String("db", "", "SQLite database path (default: DIALTONE_STATE_DB or ~/.dialtone/state.sqlite)")
+	to := fs.Int("to", -1, "Target schema version (up: latest, down: one below current)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("db migrate %s does not accept positional arguments", action)
+	}
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		return err
+	}
+	db, err := modstate.Open(resolveStateDBPath(repoRoot, *dbPath))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	switch action {
+	case "status":
+	case "up":
+		target := modstate.LatestSchemaVersion()
+		if *to >= 0 {
+			target = *to
+		}
+		current, _ := modstate.CurrentSchemaVersion(db)
+		if target < current {
+			return fmt.Errorf("db migrate up --to %d is below the current schema version %d; use down", target, current)
+		}
+		if err := modstate.MigrateTo(db, target); err != nil {
+			return err
+		}
+	case "down":
+		current, err := modstate.CurrentSchemaVersion(db)
+		if err != nil {
+			return err
+		}
+		target := current - 1
+		if *to >= 0 {
+			target = *to
+		}
+		if target < 0 || target > current {
+			return fmt.Errorf("db migrate down --to %d must be between 0 and the current schema version %d", target, current)
+		}
+		if err := modstate.MigrateTo(db, target); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown db migrate action: %s (want status, up, or down)", action)
+	}
+	statuses, err := modstate.LoadMigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		state := "pending"
+		if status.Applied {
+			state = "applied"
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\n", status.Version, status.Name, state, status.AppliedAt)
+	}
+	return nil
+}
+
 func runDBSync(args []string) error {
 	fs := flag.NewFlagSet("mods db sync", flag.ContinueOnError)
 	dbPath := fs.String("db", "", "SQLite database path (default: DIALTONE_STATE_DB or ~/.dialtone/state.sqlite)")
@@ -123,15 +195,15 @@ func runDBSync(args []string) error {
 		return err
 	}
 	fmt.Printf("synced sqlite state db: %s\n", path)
-	fmt.Printf("mods=%d manifests=%d dependencies=%d nix_packages=%d env_vars=%d topology=%d test_steps=%d\n",
-		summary.Mods, summary.Manifests, summary.Dependencies, summary.NixPackages, summary.EnvVars, summary.Topology, summary.TestSteps)
+	fmt.Printf("mods=%d manifests=%d dependencies=%d nix_packages=%d env_vars=%d topology=%d test_steps=%d locked=%d\n",
+		summary.Mods, summary.Manifests, summary.Dependencies, summary.NixPackages, summary.EnvVars, summary.Topology, summary.TestSteps, summary.Locked)
 	return nil
 }
 
 func runDBGraph(args []string) error {
 	fs := flag.NewFlagSet("mods db graph", flag.ContinueOnError)
 	dbPath := fs.String("db", "", "SQLite database path (default: DIALTONE_STATE_DB or ~/.dialtone/state.sqlite)")
-	format := fs.String("format", "text", "Output format: text|mermaid|outline")
+	format := fs.String("format", "text", "Output format: text|mermaid|outline|lock")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
@@ -151,9 +223,17 @@ func runDBGraph(args []string) error {
 	if err != nil {
 		return err
 	}
-	switch strings.ToLower(strings.TrimSpace(*format)) {
-	case "text":
-		fmt.Println(modstate.RenderGraphText(edges))
+	mode := strings.ToLower(strings.TrimSpace(*format))
+	switch mode {
+	case "text", "lock":
+		lock, err := modstate.LoadLock(db)
+		if err != nil {
+			return err
+		}
+		if mode == "text" {
+			fmt.Println(modstate.RenderGraphText(edges))
+		}
+		fmt.Println(modstate.RenderLockText(lock))
 	case "mermaid":
 		fmt.Println(modstate.RenderGraphMermaid(edges))
 	case "outline":
@@ -544,10 +624,12 @@ func printDBUsage() {
 	fmt.Println("       Print the resolved sqlite state database path")
 	fmt.Println("  init [--db PATH]")
 	fmt.Println("       Create the sqlite state database schema if it does not exist")
+	fmt.Println("  migrate [status|up|down] [--db PATH] [--to VERSION]")
+	fmt.Println("       Print, apply, or revert numbered sqlite schema migrations")
 	fmt.Println("  sync [--db PATH]")
 	fmt.Println("       Sync mods, DAG manifests, nix packages, and current DIALTONE_* env vars into sqlite")
-	fmt.Println("  graph [--db PATH] [--format text|mermaid|outline]")
-	fmt.Println("       Print the mod dependency graph from sqlite")
+	fmt.Println("  graph [--db PATH] [--format text|mermaid|outline|lock]")
+	fmt.Println("       Print the mod dependency graph and resolved version lock from sqlite")
 	fmt.Println("  env [--db PATH] [--scope process]")
 	fmt.Println("       Print the captured runtime environment from sqlite")
 	fmt.Println("  env [--db PATH] [--scope process] --set KEY=VALUE")
@@ -570,8 +652,8 @@ func printDBUsage() {
 	fmt.Println("       Print the validated topological order for the mod DAG")
 	fmt.Println("  test-plan [--db PATH] [--name default]")
 	fmt.Println("       Print the sequential Go test plan derived from the SQLite DAG")
-	fmt.Println("  test-run [--db PATH] [--name default] [--sync=true] [--update-readmes=true]")
-	fmt.Println("       Execute the SQLite test plan step by step, record results, and update mod READMEs")
+	fmt.Println("  test-run [--db PATH] [--name default] [--sync=true] [--update-readmes=true] [--max-parallel N] [--affected GIT_REF]")
+	fmt.Println("       Execute the SQLite test plan in dependency order with parallel workers, record results, and update mod READMEs")
 	fmt.Println("  test-runs [--db PATH] [--limit 20]")
 	fmt.Println("       Print recorded SQLite test runs")
 	fmt.Println("  test-run-steps [--db PATH] --run ID")
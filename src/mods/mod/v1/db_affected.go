@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dialtone/dev/internal/modstate"
+)
+
+var gitChangedFilesFn = gitChangedFiles
+
+var sharedPackageRoots = []string{"src/mods/shared", "src/internal"}
+
+func gitChangedFiles(repoRoot, ref string) ([]string, error) {
+	diff, err := runGitLines(repoRoot, "diff", "--name-only", "--relative", strings.TrimSpace(ref), "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := runGitLines(repoRoot, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	out := []string{}
+	for _, file := range append(diff, untracked...) {
+		file = filepath.ToSlash(strings.TrimSpace(file))
+		if file == "" || seen[file] {
+			continue
+		}
+		seen[file] = true
+		out = append(out, file)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func runGitLines(repoRoot string, args ...string) ([]string, error) {
+	cmd := exec.Command("git", append([]string{"-C", repoRoot}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	raw, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// selectAffectedMods maps changed repo-relative files to the mods that must be
+// retested, keyed by name:version, with the files that triggered each one.
+// Shared packages affect every mod that imports them (directly or through
+// other shared packages), and every affected mod pulls in its dependents.
+func selectAffectedMods(repoRoot string, mods []modstate.ModRecord, edges []modstate.GraphEdge, changed []string) (map[string][]string, error) {
+	modulePath := readGoModulePath(filepath.Join(repoRoot, "src", "go.mod"))
+	modPaths := append([]modstate.ModRecord(nil), mods...)
+	sort.Slice(modPaths, func(i, j int) bool { return len(modPaths[i].Path) > len(modPaths[j].Path) })
+
+	direct := map[string]map[string]bool{}
+	addTrigger := func(key, file string) {
+		if direct[key] == nil {
+			direct[key] = map[string]bool{}
+		}
+		direct[key][file] = true
+	}
+	changedPackages := map[string][]string{}
+	for _, file := range changed {
+		file = path.Clean(filepath.ToSlash(strings.TrimSpace(file)))
+		if file == "src/go.mod" || file == "src/go.sum" {
+			for _, mod := range mods {
+				addTrigger(mod.Name+":"+mod.Version, file)
+			}
+			continue
+		}
+		if mod, ok := modForPath(modPaths, file); ok {
+			addTrigger(mod.Name+":"+mod.Version, file)
+			continue
+		}
+		if isSharedPackagePath(file) {
+			importPath := modulePath + "/" + strings.TrimPrefix(path.Dir(file), "src/")
+			changedPackages[importPath] = append(changedPackages[importPath], file)
+		}
+	}
+
+	if len(changedPackages) > 0 {
+		affectedPackages, err := expandSharedPackages(repoRoot, modulePath, changedPackages)
+		if err != nil {
+			return nil, err
+		}
+		for _, mod := range mods {
+			imports, err := goImportsUnder(filepath.Join(repoRoot, filepath.FromSlash(mod.Path)), true)
+			if err != nil {
+				return nil, err
+			}
+			for importPath := range imports {
+				for _, file := range affectedPackages[importPath] {
+					addTrigger(mod.Name+":"+mod.Version, file)
+				}
+			}
+		}
+	}
+
+	dependents := map[string][]string{}
+	for _, edge := range edges {
+		from := edge.From.Name + ":" + edge.From.Version
+		to := edge.To.Name + ":" + edge.To.Version
+		dependents[to] = append(dependents[to], from)
+	}
+	triggers := map[string]map[string]bool{}
+	for key, files := range direct {
+		queue := []string{key}
+		visited := map[string]bool{}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			if visited[current] {
+				continue
+			}
+			visited[current] = true
+			if triggers[current] == nil {
+				triggers[current] = map[string]bool{}
+			}
+			for file := range files {
+				triggers[current][file] = true
+			}
+			queue = append(queue, dependents[current]...)
+		}
+	}
+	out := map[string][]string{}
+	for key, files := range triggers {
+		out[key] = sortedKeys(files)
+	}
+	return out, nil
+}
+
+func filterAffectedPlan(plan []modstate.TestStepRecord, triggers map[string][]string) []modstate.TestStepRecord {
+	out := []modstate.TestStepRecord{}
+	for _, step := range plan {
+		if _, ok := triggers[step.ModName+":"+step.ModVersion]; ok {
+			out = append(out, step)
+		}
+	}
+	return out
+}
+
+func modForPath(mods []modstate.ModRecord, file string) (modstate.ModRecord, bool) {
+	for _, mod := range mods {
+		modPath := strings.TrimSuffix(filepath.ToSlash(mod.Path), "/")
+		if modPath != "" && (file == modPath || strings.HasPrefix(file, modPath+"/")) {
+			return mod, true
+		}
+	}
+	return modstate.ModRecord{}, false
+}
+
+func isSharedPackagePath(file string) bool {
+	for _, root := range sharedPackageRoots {
+		if strings.HasPrefix(file, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// expandSharedPackages returns every shared/internal package affected by the
+// changed ones, following reverse imports, with the files that triggered it.
+func expandSharedPackages(repoRoot, modulePath string, changed map[string][]string) (map[string][]string, error) {
+	importers := map[string][]string{}
+	for _, root := range sharedPackageRoots {
+		rootDir := filepath.Join(repoRoot, filepath.FromSlash(root))
+		err := filepath.WalkDir(rootDir, func(dir string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if !entry.IsDir() {
+				return nil
+			}
+			imports, err := goImportsUnder(dir, false)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(filepath.Join(repoRoot, "src"), dir)
+			if err != nil {
+				return err
+			}
+			importPath := modulePath + "/" + filepath.ToSlash(rel)
+			for imported := range imports {
+				importers[imported] = append(importers[imported], importPath)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	affected := map[string]map[string]bool{}
+	for pkg, files := range changed {
+		queue := []string{pkg}
+		visited := map[string]bool{}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			if visited[current] {
+				continue
+			}
+			visited[current] = true
+			if affected[current] == nil {
+				affected[current] = map[string]bool{}
+			}
+			for _, file := range files {
+				affected[current][file] = true
+			}
+			queue = append(queue, importers[current]...)
+		}
+	}
+	out := map[string][]string{}
+	for pkg, files := range affected {
+		out[pkg] = sortedKeys(files)
+	}
+	return out, nil
+}
+
+func goImportsUnder(dir string, recursive bool) (map[string]bool, error) {
+	out := map[string]bool{}
+	fset := token.NewFileSet()
+	collect := func(file string) {
+		parsed, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly)
+		if err != nil {
+			return
+		}
+		for _, spec := range parsed.Imports {
+			if value, err := strconv.Unquote(spec.Path.Value); err == nil {
+				out[value] = true
+			}
+		}
+	}
+	if !recursive {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return out, nil
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".go") {
+				collect(filepath.Join(dir, entry.Name()))
+			}
+		}
+		return out, nil
+	}
+	err := filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			return nil
+		}
+		collect(file)
+		return nil
+	})
+	return out, err
+}
+
+func readGoModulePath(goModPath string) string {
+	raw, err := os.ReadFile(goModPath)
+	if err == nil {
+		for _, line := range strings.Split(string(raw), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[0] == "module" {
+				return fields[1]
+			}
+		}
+	}
+	return "dialtone/dev"
+}
+
+func sortedKeys(values map[string]bool) []string {
+	out := make([]string, 0, len(values))
+	for value := range values {
+		out = append(out, value)
+	}
+	sort.Strings(out)
+	return out
+}
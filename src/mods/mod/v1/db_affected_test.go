@@ -0,0 +1,109 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"dialtone/dev/internal/modstate"
+)
+
+func TestSelectAffectedModsFollowsSharedImportsAndReverseDependencies(t *testing.T) {
+	repoRoot := t.TempDir()
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "src", "go.mod"), "module example\n\ngo 1.25\n")
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "src", "mods", "shared", "util", "util.go"), "package util\n")
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "src", "mods", "shared", "wrap", "wrap.go"), "package wrap\n\nimport _ \"example/mods/shared/util\"\n")
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "src", "mods", "alpha", "v1", "main.go"), "package main\n\nimport _ \"example/mods/shared/util\"\n")
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "src", "mods", "beta", "v1", "main.go"), "package main\n")
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "src", "mods", "gamma", "v1", "cli", "main.go"), "package main\n\nimport _ \"example/mods/shared/wrap\"\n")
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "src", "mods", "delta", "v1", "main.go"), "package main\n")
+	mods := []modstate.ModRecord{
+		{Name: "alpha", Version: "v1", Path: "src/mods/alpha/v1"},
+		{Name: "beta", Version: "v1", Path: "src/mods/beta/v1"},
+		{Name: "gamma", Version: "v1", Path: "src/mods/gamma/v1"},
+		{Name: "delta", Version: "v1", Path: "src/mods/delta/v1"},
+	}
+	edges := []modstate.GraphEdge{{
+		From: modstate.GraphNode{Name: "beta", Version: "v1"},
+		To:   modstate.GraphNode{Name: "alpha", Version: "v1"},
+	}}
+
+	got, err := selectAffectedMods(repoRoot, mods, edges, []string{"src/mods/shared/util/util.go", "docs/notes.md"})
+	if err != nil {
+		t.Fatalf("selectAffectedMods returned error: %v", err)
+	}
+	want := map[string][]string{
+		"alpha:v1": {"src/mods/shared/util/util.go"},
+		"beta:v1":  {"src/mods/shared/util/util.go"},
+		"gamma:v1": {"src/mods/shared/util/util.go"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("selectAffectedMods = %v, want %v", got, want)
+	}
+
+	got, err = selectAffectedMods(repoRoot, mods, edges, []string{"src/mods/delta/v1/main.go", "src/mods/alpha/v1/README.md"})
+	if err != nil {
+		t.Fatalf("selectAffectedMods returned error: %v", err)
+	}
+	want = map[string][]string{
+		"alpha:v1": {"src/mods/alpha/v1/README.md"},
+		"beta:v1":  {"src/mods/alpha/v1/README.md"},
+		"delta:v1": {"src/mods/delta/v1/main.go"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("selectAffectedMods = %v, want %v", got, want)
+	}
+}
+
+func TestRunDBTestRunAffectedRecordsTriggerFiles(t *testing.T) {
+	repoRoot := t.TempDir()
+	t.Setenv("DIALTONE_REPO_ROOT", repoRoot)
+	t.Setenv("DIALTONE_STATE_DB", filepath.Join(repoRoot, ".dialtone", "state.sqlite"))
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "dialtone_mod"), "#!/bin/sh\nexit 0\n")
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "src", "go.mod"), "module example\n\ngo 1.25\n")
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "src", "mods", "ghostty", "v1", "main.go"), "package main\n")
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "src", "mods", "ghostty", "v1", "mod.json"), `{"name":"ghostty","version":"v1"}`)
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "src", "mods", "shell", "v1", "main.go"), "package main\n")
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "src", "mods", "shell", "v1", "mod.json"), `{"name":"shell","version":"v1","depends_on":[{"name":"ghostty","version":"v1"}]}`)
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "src", "mods", "tmux", "v1", "main.go"), "package main\n")
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "src", "mods", "tmux", "v1", "mod.json"), `{"name":"tmux","version":"v1"}`)
+
+	previous := gitChangedFilesFn
+	gitChangedFilesFn = func(_, ref string) ([]string, error) {
+		if ref != "origin/main" {
+			t.Fatalf("unexpected ref %q", ref)
+		}
+		return []string{"src/mods/ghostty/v1/main.go"}, nil
+	}
+	t.Cleanup(func() { gitChangedFilesFn = previous })
+	stubRunTestCommand(t, func(string, testStepCommand) (string, int, error) { return "ok", 0, nil })
+
+	if err := runDBTestRun([]string{"--affected", "origin/main", "--update-readmes=false"}); err != nil {
+		t.Fatalf("runDBTestRun returned error: %v", err)
+	}
+
+	db, err := modstate.Open(filepath.Join(repoRoot, ".dialtone", "state.sqlite"))
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer db.Close()
+	runs, err := loadTestRuns(db, 10)
+	if err != nil {
+		t.Fatalf("loadTestRuns returned error: %v", err)
+	}
+	if len(runs) != 1 || runs[0].AffectedRef != "origin/main" || runs[0].TotalSteps != 2 {
+		t.Fatalf("unexpected affected run rows: %+v", runs)
+	}
+	steps, err := loadTestRunSteps(db, runs[0].ID)
+	if err != nil {
+		t.Fatalf("loadTestRunSteps returned error: %v", err)
+	}
+	if len(steps) != 2 || steps[0].ModName != "ghostty" || steps[1].ModName != "shell" {
+		t.Fatalf("expected only ghostty and its dependent shell, got %+v", steps)
+	}
+	for _, step := range steps {
+		if step.Triggers != `["src/mods/ghostty/v1/main.go"]` {
+			t.Fatalf("unexpected trigger files for %s: %q", step.ModName, step.Triggers)
+		}
+	}
+}
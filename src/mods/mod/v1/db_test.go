@@ -98,6 +98,46 @@ func TestRunDBStateSetAndUnset(t *testing.T) {
 	}
 }
 
+func TestRunDBMigrateUpDownAndStatus(t *testing.T) {
+	repoRoot := t.TempDir()
+	t.Setenv("DIALTONE_REPO_ROOT", repoRoot)
+	t.Setenv("DIALTONE_STATE_DB", filepath.Join(repoRoot, ".dialtone", "state.sqlite"))
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "dialtone_mod"), "#!/bin/sh\nexit 0\n")
+	writeDiscoverTestFile(t, filepath.Join(repoRoot, "src", "go.mod"), "module example\n\ngo 1.25\n")
+
+	if err := runDBMigrate([]string{"up"}); err != nil {
+		t.Fatalf("runDBMigrate up returned error: %v", err)
+	}
+	latest := modstate.LatestSchemaVersion()
+	if err := runDBMigrate([]string{"down"}); err != nil {
+		t.Fatalf("runDBMigrate down returned error: %v", err)
+	}
+
+	db, err := modstate.Open(filepath.Join(repoRoot, ".dialtone", "state.sqlite"))
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer db.Close()
+	if version, err := modstate.CurrentSchemaVersion(db); err != nil || version != latest-1 {
+		t.Fatalf("CurrentSchemaVersion after down = %d, %v; want %d", version, err, latest-1)
+	}
+	if err := runDBMigrate([]string{"up", "--to", "0"}); err == nil {
+		t.Fatalf("expected migrate up below the current version to fail")
+	}
+	if err := runDBMigrate([]string{"sideways"}); err == nil {
+		t.Fatalf("expected unknown migrate action to fail")
+	}
+	if err := runDBMigrate(nil); err != nil {
+		t.Fatalf("runDBMigrate status returned error: %v", err)
+	}
+	if err := modstate.EnsureSchema(db); err != nil {
+		t.Fatalf("EnsureSchema returned error: %v", err)
+	}
+	if version, err := modstate.CurrentSchemaVersion(db); err != nil || version != latest {
+		t.Fatalf("CurrentSchemaVersion after EnsureSchema = %d, %v; want %d", version, err, latest)
+	}
+}
+
 func TestRunDBSyncPersistsTopologyAndPlan(t *testing.T) {
 	repoRoot := t.TempDir()
 	t.Setenv("DIALTONE_REPO_ROOT", repoRoot)
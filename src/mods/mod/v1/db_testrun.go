@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"dialtone/dev/internal/modstate"
+	"dialtone/dev/mods/shared/sqlitestate"
 )
 
 type testRunRecord struct {
@@ -24,6 +25,9 @@ type testRunRecord struct {
 	PassedSteps int
 	FailedSteps int
 	Skipped     int
+	MaxParallel int
+	PeakRunning int
+	AffectedRef string
 	StartedAt   string
 	FinishedAt  string
 	ErrorText   string
@@ -46,6 +50,10 @@ type testRunStepRecord struct {
 	StartedAt   string
 	FinishedAt  string
 	RuntimeMS   int64
+	WorkerSlot  int
+	Concurrency int
+	WaitMS      int64
+	Triggers    string
 }
 
 func runDBTestRun(args []string) error {
@@ -56,12 +64,17 @@ func runDBTestRun(args []string) error {
 	syncBefore := fs.Bool("sync", true, "Sync repo state into sqlite before executing the plan")
 	updateReadmes := fs.Bool("update-readmes", true, "Write quickstart/test results into mod READMEs after the run")
 	limit := fs.Int("limit", 0, "Optional maximum number of test steps to execute")
+	maxParallel := fs.Int("max-parallel", defaultTestRunParallel(), "Maximum test steps to run at once")
+	affected := fs.String("affected", "", "Only run steps for mods changed since this git ref and the mods that depend on them")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 	if fs.NArg() != 0 {
 		return fmt.Errorf("db test-run does not accept positional arguments")
 	}
+	if *maxParallel <= 0 {
+		return fmt.Errorf("db test-run --max-parallel must be at least 1")
+	}
 	repoRoot, err := findRepoRoot()
 	if err != nil {
 		return err
@@ -83,9 +96,6 @@ func runDBTestRun(args []string) error {
 	if err != nil {
 		return err
 	}
-	if *limit > 0 && len(plan) > *limit {
-		plan = plan[:*limit]
-	}
 	if len(plan) == 0 {
 		return fmt.Errorf("sqlite test plan %q is empty", strings.TrimSpace(*planName))
 	}
@@ -97,38 +107,69 @@ func runDBTestRun(args []string) error {
 	for _, mod := range mods {
 		modByKey[mod.Name+":"+mod.Version] = mod
 	}
-	runID, err := startTestRun(db, strings.TrimSpace(*planName), len(plan), *stopOnError)
+	edges, err := modstate.LoadGraph(db)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("started sqlite test run %d plan=%s steps=%d\n", runID, strings.TrimSpace(*planName), len(plan))
-	passed := 0
-	failed := 0
-	skipped := 0
-	runStatus := "passed"
-	runError := ""
-	for _, step := range plan {
-		outcome, execErr := executeTestPlanStep(db, repoRoot, runID, modByKey, step)
-		if err := insertTestRunStep(db, outcome); err != nil {
+	affectedRef := strings.TrimSpace(*affected)
+	triggers := map[string][]string{}
+	if affectedRef != "" {
+		changed, err := gitChangedFilesFn(repoRoot, affectedRef)
+		if err != nil {
 			return err
 		}
-		switch outcome.Status {
-		case "passed":
-			passed++
-		case "skipped":
-			skipped++
-		default:
-			failed++
-			runStatus = "failed"
-			if runError == "" {
-				runError = fmt.Sprintf("%s %s failed at step %d", outcome.ModName, outcome.ModVersion, outcome.StepIndex)
-			}
+		triggers, err = selectAffectedMods(repoRoot, mods, edges, changed)
+		if err != nil {
+			return err
 		}
-		fmt.Printf("step %d\t%s\t%s\t%s\t%s\n", outcome.StepIndex, outcome.ModName, outcome.ModVersion, outcome.Status, outcome.CommandText)
-		if execErr != nil && *stopOnError {
-			break
+		plan = filterAffectedPlan(plan, triggers)
+		if len(plan) == 0 {
+			fmt.Printf("no mods affected since %s (%d changed files)\n", affectedRef, len(changed))
+			return nil
 		}
 	}
+	if *limit > 0 && len(plan) > *limit {
+		plan = plan[:*limit]
+	}
+	runID, err := startTestRun(db, strings.TrimSpace(*planName), len(plan), *stopOnError, *maxParallel, affectedRef)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("started sqlite test run %d plan=%s steps=%d max_parallel=%d\n", runID, strings.TrimSpace(*planName), len(plan), *maxParallel)
+	paneRecord, ok, err := modstate.LoadStateValue(db, sqlitestate.SystemScope, sqlitestate.TmuxTargetKey)
+	if err != nil {
+		return err
+	}
+	visiblePane := ""
+	if ok {
+		visiblePane = strings.TrimSpace(paneRecord.Value)
+	}
+	scheduler := testPlanScheduler{
+		db:          db,
+		repoRoot:    repoRoot,
+		runID:       runID,
+		modByKey:    modByKey,
+		dependsOn:   testPlanDependencies(plan, edges),
+		maxParallel: *maxParallel,
+		stopOnError: *stopOnError,
+		visiblePane: visiblePane,
+		triggers:    triggers,
+	}
+	summary, err := scheduler.run(plan)
+	if err != nil {
+		return err
+	}
+	passed := summary.passed
+	failed := summary.failed
+	skipped := summary.skipped
+	runStatus := "passed"
+	runError := summary.firstError
+	if failed > 0 {
+		runStatus = "failed"
+	}
+	if err := recordTestRunConcurrency(db, runID, summary.peakRunning); err != nil {
+		return err
+	}
 	if err := finishTestRun(db, runID, runStatus, passed, failed, skipped, runError); err != nil {
 		return err
 	}
@@ -211,58 +252,16 @@ func runDBTestRunSteps(args []string) error {
 }
 
 func ensureDBTestRunSchema(db *sql.DB) error {
-	if err := modstate.EnsureSchema(db); err != nil {
-		return err
-	}
-	stmts := []string{
-		`create table if not exists mod_test_runs (
-			id integer primary key autoincrement,
-			plan_name text not null,
-			status text not null,
-			total_steps integer not null default 0,
-			passed_steps integer not null default 0,
-			failed_steps integer not null default 0,
-			skipped_steps integer not null default 0,
-			stop_on_error integer not null default 1,
-			error_text text not null default '',
-			started_at text not null,
-			finished_at text not null default ''
-		);`,
-		`create table if not exists mod_test_run_steps (
-			run_id integer not null,
-			step_index integer not null,
-			mod_name text not null,
-			mod_version text not null,
-			serial_group text not null default '',
-			visible_tmux integer not null default 0,
-			requires_nix integer not null default 0,
-			status text not null,
-			exit_code integer not null default 0,
-			queue_id integer not null default 0,
-			command_text text not null,
-			output_text text not null default '',
-			error_text text not null default '',
-			started_at text not null,
-			finished_at text not null default '',
-			runtime_ms integer not null default 0,
-			primary key (run_id, step_index)
-		);`,
-	}
-	for _, stmt := range stmts {
-		if _, err := db.Exec(stmt); err != nil {
-			return err
-		}
-	}
-	return nil
+	return modstate.EnsureSchema(db)
 }
 
-func startTestRun(db *sql.DB, planName string, totalSteps int, stopOnError bool) (int64, error) {
+func startTestRun(db *sql.DB, planName string, totalSteps int, stopOnError bool, maxParallel int, affectedRef string) (int64, error) {
 	if err := ensureDBTestRunSchema(db); err != nil {
 		return 0, err
 	}
-	result, err := db.Exec(`insert into mod_test_runs(plan_name, status, total_steps, stop_on_error, started_at)
-		values(?, 'running', ?, ?, ?)`,
-		strings.TrimSpace(planName), totalSteps, boolToIntLocal(stopOnError), nowRFC3339Local())
+	result, err := db.Exec(`insert into mod_test_runs(plan_name, status, total_steps, stop_on_error, max_parallel, affected_ref, started_at)
+		values(?, 'running', ?, ?, ?, ?, ?)`,
+		strings.TrimSpace(planName), totalSteps, boolToIntLocal(stopOnError), maxParallel, strings.TrimSpace(affectedRef), nowRFC3339Local())
 	if err != nil {
 		return 0, err
 	}
@@ -280,16 +279,23 @@ func finishTestRun(db *sql.DB, runID int64, status string, passed, failed, skipp
 	return err
 }
 
+func recordTestRunConcurrency(db *sql.DB, runID int64, peakRunning int) error {
+	_, err := db.Exec(`update mod_test_runs set peak_concurrency = ? where id = ?`, peakRunning, runID)
+	return err
+}
+
 func insertTestRunStep(db *sql.DB, step testRunStepRecord) error {
 	if err := ensureDBTestRunSchema(db); err != nil {
 		return err
 	}
 	_, err := db.Exec(`insert into mod_test_run_steps(
 		run_id, step_index, mod_name, mod_version, serial_group, visible_tmux, requires_nix,
-		status, exit_code, queue_id, command_text, output_text, error_text, started_at, finished_at, runtime_ms
-	) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		status, exit_code, queue_id, command_text, output_text, error_text, started_at, finished_at, runtime_ms,
+		worker_slot, concurrency, wait_ms, trigger_files_json
+	) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		step.RunID, step.StepIndex, step.ModName, step.ModVersion, step.SerialGroup, boolToIntLocal(step.VisibleTmux), boolToIntLocal(step.RequiresNix),
 		step.Status, step.ExitCode, step.QueueID, step.CommandText, step.OutputText, step.ErrorText, step.StartedAt, step.FinishedAt, step.RuntimeMS,
+		step.WorkerSlot, step.Concurrency, step.WaitMS, step.Triggers,
 	)
 	return err
 }
@@ -298,7 +304,7 @@ func loadTestRuns(db *sql.DB, limit int) ([]testRunRecord, error) {
 	if limit <= 0 {
 		limit = 20
 	}
-	rows, err := db.Query(`select id, plan_name, status, total_steps, passed_steps, failed_steps, skipped_steps, started_at, finished_at, error_text
+	rows, err := db.Query(`select id, plan_name, status, total_steps, passed_steps, failed_steps, skipped_steps, max_parallel, peak_concurrency, affected_ref, started_at, finished_at, error_text
 		from mod_test_runs
 		order by id desc
 		limit ?`, limit)
@@ -309,7 +315,7 @@ func loadTestRuns(db *sql.DB, limit int) ([]testRunRecord, error) {
 	out := []testRunRecord{}
 	for rows.Next() {
 		var record testRunRecord
-		if err := rows.Scan(&record.ID, &record.PlanName, &record.Status, &record.TotalSteps, &record.PassedSteps, &record.FailedSteps, &record.Skipped, &record.StartedAt, &record.FinishedAt, &record.ErrorText); err != nil {
+		if err := rows.Scan(&record.ID, &record.PlanName, &record.Status, &record.TotalSteps, &record.PassedSteps, &record.FailedSteps, &record.Skipped, &record.MaxParallel, &record.PeakRunning, &record.AffectedRef, &record.StartedAt, &record.FinishedAt, &record.ErrorText); err != nil {
 			return nil, err
 		}
 		out = append(out, record)
@@ -319,17 +325,18 @@ func loadTestRuns(db *sql.DB, limit int) ([]testRunRecord, error) {
 
 func loadTestRun(db *sql.DB, runID int64) (testRunRecord, error) {
 	var record testRunRecord
-	err := db.QueryRow(`select id, plan_name, status, total_steps, passed_steps, failed_steps, skipped_steps, started_at, finished_at, error_text
+	err := db.QueryRow(`select id, plan_name, status, total_steps, passed_steps, failed_steps, skipped_steps, max_parallel, peak_concurrency, affected_ref, started_at, finished_at, error_text
 		from mod_test_runs
 		where id = ?`, runID).Scan(
-		&record.ID, &record.PlanName, &record.Status, &record.TotalSteps, &record.PassedSteps, &record.FailedSteps, &record.Skipped, &record.StartedAt, &record.FinishedAt, &record.ErrorText,
+		&record.ID, &record.PlanName, &record.Status, &record.TotalSteps, &record.PassedSteps, &record.FailedSteps, &record.Skipped, &record.MaxParallel, &record.PeakRunning, &record.AffectedRef, &record.StartedAt, &record.FinishedAt, &record.ErrorText,
 	)
 	return record, err
 }
 
 func loadTestRunSteps(db *sql.DB, runID int64) ([]testRunStepRecord, error) {
 	rows, err := db.Query(`select run_id, step_index, mod_name, mod_version, serial_group, visible_tmux, requires_nix,
-		status, exit_code, queue_id, command_text, output_text, error_text, started_at, finished_at, runtime_ms
+		status, exit_code, queue_id, command_text, output_text, error_text, started_at, finished_at, runtime_ms,
+		worker_slot, concurrency, wait_ms, trigger_files_json
 		from mod_test_run_steps
 		where run_id = ?
 		order by step_index`, runID)
@@ -345,6 +352,7 @@ func loadTestRunSteps(db *sql.DB, runID int64) ([]testRunStepRecord, error) {
 		if err := rows.Scan(
 			&record.RunID, &record.StepIndex, &record.ModName, &record.ModVersion, &record.SerialGroup, &visibleTmux, &requiresNix,
 			&record.Status, &record.ExitCode, &record.QueueID, &record.CommandText, &record.OutputText, &record.ErrorText, &record.StartedAt, &record.FinishedAt, &record.RuntimeMS,
+			&record.WorkerSlot, &record.Concurrency, &record.WaitMS, &record.Triggers,
 		); err != nil {
 			return nil, err
 		}
@@ -355,31 +363,14 @@ func loadTestRunSteps(db *sql.DB, runID int64) ([]testRunStepRecord, error) {
 	return out, rows.Err()
 }
 
-func executeTestPlanStep(db *sql.DB, repoRoot string, runID int64, modByKey map[string]modstate.ModRecord, step modstate.TestStepRecord) (testRunStepRecord, error) {
+type testStepCommand struct {
+	commandText string
+	requiresNix bool
+	flakeShell  string
+}
+
+func prepareTestPlanStep(db *sql.DB, runID int64, modByKey map[string]modstate.ModRecord, step modstate.TestStepRecord) (testRunStepRecord, *testStepCommand) {
 	modKey := step.ModName + ":" + step.ModVersion
-	mod, ok := modByKey[modKey]
-	if !ok {
-		now := nowRFC3339Local()
-		return testRunStepRecord{
-			RunID:       runID,
-			StepIndex:   step.StepIndex,
-			ModName:     step.ModName,
-			ModVersion:  step.ModVersion,
-			SerialGroup: step.SerialGroup,
-			VisibleTmux: step.VisibleTmux,
-			RequiresNix: step.RequiresNix,
-			Status:      "skipped",
-			ExitCode:    0,
-			CommandText: "",
-			OutputText:  "",
-			ErrorText:   "mod missing from sqlite registry",
-			StartedAt:   now,
-			FinishedAt:  now,
-			RuntimeMS:   0,
-		}, nil
-	}
-	commandText, ok := resolveGoTestCommand(mod)
-	start := time.Now().UTC()
 	record := testRunStepRecord{
 		RunID:       runID,
 		StepIndex:   step.StepIndex,
@@ -388,9 +379,17 @@ func executeTestPlanStep(db *sql.DB, repoRoot string, runID int64, modByKey map[
 		SerialGroup: step.SerialGroup,
 		VisibleTmux: step.VisibleTmux,
 		RequiresNix: step.RequiresNix,
-		CommandText: commandText,
-		StartedAt:   start.Format(time.RFC3339),
+		StartedAt:   nowRFC3339Local(),
 	}
+	mod, ok := modByKey[modKey]
+	if !ok {
+		record.Status = "skipped"
+		record.FinishedAt = record.StartedAt
+		record.ErrorText = "mod missing from sqlite registry"
+		return record, nil
+	}
+	commandText, ok := resolveGoTestCommand(mod)
+	record.CommandText = commandText
 	if !ok {
 		record.Status = "skipped"
 		record.FinishedAt = record.StartedAt
@@ -407,27 +406,33 @@ func executeTestPlanStep(db *sql.DB, repoRoot string, runID int64, modByKey map[
 	if launchErr == nil && strings.TrimSpace(launchConfig.FlakeShell) != "" {
 		flakeShell = strings.TrimSpace(launchConfig.FlakeShell)
 	}
-	output, exitCode, execErr := runTestCommand(repoRoot, commandText, step.RequiresNix, flakeShell)
+	return record, &testStepCommand{commandText: commandText, requiresNix: step.RequiresNix, flakeShell: flakeShell}
+}
+
+func finishTestPlanStep(db *sql.DB, record testRunStepRecord, output string, exitCode int, elapsed time.Duration, execErr error) testRunStepRecord {
 	record.OutputText = truncateText(output, 24000)
 	record.ExitCode = exitCode
-	record.RuntimeMS = time.Since(start).Milliseconds()
-	record.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	record.RuntimeMS = elapsed.Milliseconds()
+	record.FinishedAt = nowRFC3339Local()
 	if execErr != nil {
 		record.Status = "failed"
 		record.ErrorText = execErr.Error()
 		if record.QueueID != 0 {
 			_ = modstate.MarkCommandFinished(db, record.QueueID, "failed", record.OutputText, record.ErrorText)
 		}
-		return record, execErr
+		return record
 	}
 	record.Status = "passed"
 	if record.QueueID != 0 {
 		_ = modstate.MarkCommandFinished(db, record.QueueID, "done", record.OutputText, "")
 	}
-	return record, nil
+	return record
 }
 
-func runTestCommand(repoRoot, commandText string, requiresNix bool, flakeShell string) (string, int, error) {
+func runTestCommand(repoRoot string, command testStepCommand) (string, int, error) {
+	commandText := command.commandText
+	requiresNix := command.requiresNix
+	flakeShell := command.flakeShell
 	var cmd *exec.Cmd
 	if requiresNix {
 		script := buildShellScript(filepath.Join(repoRoot, "src"), commandText)
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dialtone/dev/internal/modstate"
+	"dialtone/dev/internal/tmuxcmd"
+	"dialtone/dev/mods/shared/sqlitestate"
+	tmuxv1 "dialtone/dev/mods/tmux/v1/go"
+)
+
+var (
+	runTestCommandFn        = runTestCommand
+	runVisibleTestCommandFn = runVisibleTestCommand
+)
+
+const (
+	visibleTestPollInterval = 500 * time.Millisecond
+	visibleTestTimeout      = 30 * time.Minute
+	visibleTestHistory      = 2000
+)
+
+type testPlanScheduler struct {
+	db          *sql.DB
+	repoRoot    string
+	runID       int64
+	modByKey    map[string]modstate.ModRecord
+	dependsOn   map[string][]string
+	maxParallel int
+	stopOnError bool
+	visiblePane string
+	triggers    map[string][]string
+}
+
+type testPlanSummary struct {
+	passed      int
+	failed      int
+	skipped     int
+	peakRunning int
+	firstError  string
+}
+
+type testStepResult struct {
+	step     modstate.TestStepRecord
+	record   testRunStepRecord
+	output   string
+	exitCode int
+	elapsed  time.Duration
+	err      error
+}
+
+func defaultTestRunParallel() int {
+	return max(1, min(runtime.NumCPU(), 4))
+}
+
+func testPlanDependencies(plan []modstate.TestStepRecord, edges []modstate.GraphEdge) map[string][]string {
+	inPlan := map[string]bool{}
+	for _, step := range plan {
+		inPlan[step.ModName+":"+step.ModVersion] = true
+	}
+	out := map[string][]string{}
+	for _, edge := range edges {
+		from := edge.From.Name + ":" + edge.From.Version
+		to := edge.To.Name + ":" + edge.To.Version
+		if from == to || !inPlan[from] || !inPlan[to] {
+			continue
+		}
+		out[from] = append(out[from], to)
+	}
+	for key := range out {
+		sort.Strings(out[key])
+	}
+	return out
+}
+
+// run launches each plan step once its in-plan dependencies have finished,
+// keeping at most one running step per serial group and per visible pane.
+// All sqlite writes happen on the calling goroutine; workers only run tests.
+func (s testPlanScheduler) run(plan []modstate.TestStepRecord) (testPlanSummary, error) {
+	summary := testPlanSummary{}
+	pending := append([]modstate.TestStepRecord(nil), plan...)
+	sort.SliceStable(pending, func(i, j int) bool {
+		if pending[i].TopoRank != pending[j].TopoRank {
+			return pending[i].TopoRank < pending[j].TopoRank
+		}
+		return pending[i].StepIndex < pending[j].StepIndex
+	})
+	outcome := map[string]string{}
+	busyGroups := map[string]bool{}
+	busySlots := make([]bool, s.maxParallel)
+	visibleBusy := false
+	running := 0
+	stopped := false
+	// Buffered so workers never block when run returns early on a sqlite error.
+	results := make(chan testStepResult, len(plan))
+	readyAt := map[string]time.Time{}
+
+	record := func(step testRunStepRecord) error {
+		if files := s.triggers[step.ModName+":"+step.ModVersion]; len(files) > 0 {
+			raw, err := json.Marshal(files)
+			if err != nil {
+				return err
+			}
+			step.Triggers = string(raw)
+		}
+		if err := insertTestRunStep(s.db, step); err != nil {
+			return err
+		}
+		switch step.Status {
+		case "passed":
+			summary.passed++
+		case "skipped":
+			summary.skipped++
+		default:
+			summary.failed++
+			if summary.firstError == "" {
+				summary.firstError = fmt.Sprintf("%s %s failed at step %d", step.ModName, step.ModVersion, step.StepIndex)
+			}
+		}
+		fmt.Printf("step %d\t%s\t%s\t%s\t%s\n", step.StepIndex, step.ModName, step.ModVersion, step.Status, step.CommandText)
+		return nil
+	}
+
+	for {
+		if !stopped {
+			waiting := make([]modstate.TestStepRecord, 0, len(pending))
+			for _, step := range pending {
+				key := step.ModName + ":" + step.ModVersion
+				blocker, ready := s.dependencyState(key, outcome)
+				if blocker != "" {
+					outcome[key] = "blocked"
+					if err := record(blockedTestStepRecord(s.runID, step, blocker)); err != nil {
+						return summary, err
+					}
+					continue
+				}
+				if ready && readyAt[key].IsZero() {
+					readyAt[key] = time.Now()
+				}
+				group := strings.TrimSpace(step.SerialGroup)
+				if !ready || running >= s.maxParallel || (group != "" && busyGroups[group]) || (step.VisibleTmux && visibleBusy) {
+					waiting = append(waiting, step)
+					continue
+				}
+				stepRecord, command := prepareTestPlanStep(s.db, s.runID, s.modByKey, step)
+				if command == nil {
+					outcome[key] = stepRecord.Status
+					if err := record(stepRecord); err != nil {
+						return summary, err
+					}
+					continue
+				}
+				slot := 0
+				for slot < len(busySlots) && busySlots[slot] {
+					slot++
+				}
+				busySlots[slot] = true
+				running++
+				summary.peakRunning = max(summary.peakRunning, running)
+				if group != "" {
+					busyGroups[group] = true
+				}
+				pane := ""
+				if step.VisibleTmux {
+					visibleBusy = true
+					if s.visiblePane != "" && !sqlitestate.IsHeadlessTarget(s.visiblePane) {
+						pane = s.visiblePane
+					}
+				}
+				stepRecord.WorkerSlot = slot + 1
+				stepRecord.Concurrency = running
+				stepRecord.WaitMS = time.Since(readyAt[key]).Milliseconds()
+				go func(step modstate.TestStepRecord, stepRecord testRunStepRecord, command testStepCommand, pane string) {
+					start := time.Now()
+					var output string
+					var exitCode int
+					var err error
+					if pane != "" {
+						marker := fmt.Sprintf("DIALTONE_TEST_DONE_%d_%d", s.runID, step.StepIndex)
+						output, exitCode, err = runVisibleTestCommandFn(s.repoRoot, pane, marker, command)
+					} else {
+						output, exitCode, err = runTestCommandFn(s.repoRoot, command)
+					}
+					results <- testStepResult{step: step, record: stepRecord, output: output, exitCode: exitCode, elapsed: time.Since(start), err: err}
+				}(step, stepRecord, *command, pane)
+			}
+			pending = waiting
+		}
+		if running == 0 {
+			break
+		}
+		result := <-results
+		running--
+		busySlots[result.record.WorkerSlot-1] = false
+		if group := strings.TrimSpace(result.step.SerialGroup); group != "" {
+			busyGroups[group] = false
+		}
+		if result.step.VisibleTmux {
+			visibleBusy = false
+		}
+		finished := finishTestPlanStep(s.db, result.record, result.output, result.exitCode, result.elapsed, result.err)
+		outcome[result.step.ModName+":"+result.step.ModVersion] = finished.Status
+		if err := record(finished); err != nil {
+			return summary, err
+		}
+		if finished.Status == "failed" && s.stopOnError {
+			stopped = true
+		}
+	}
+	return summary, nil
+}
+
+func (s testPlanScheduler) dependencyState(key string, outcome map[string]string) (string, bool) {
+	ready := true
+	for _, dep := range s.dependsOn[key] {
+		switch outcome[dep] {
+		case "passed", "skipped":
+		case "failed", "blocked":
+			return dep, false
+		default:
+			ready = false
+		}
+	}
+	return "", ready
+}
+
+func blockedTestStepRecord(runID int64, step modstate.TestStepRecord, blocker string) testRunStepRecord {
+	now := nowRFC3339Local()
+	return testRunStepRecord{
+		RunID:       runID,
+		StepIndex:   step.StepIndex,
+		ModName:     step.ModName,
+		ModVersion:  step.ModVersion,
+		SerialGroup: step.SerialGroup,
+		VisibleTmux: step.VisibleTmux,
+		RequiresNix: step.RequiresNix,
+		Status:      "skipped",
+		CommandText: step.CommandText,
+		ErrorText:   "dependency " + blocker + " did not pass",
+		StartedAt:   now,
+		FinishedAt:  now,
+	}
+}
+
+// runVisibleTestCommand types the step into the visible tmux pane, followed
+// by a marker that prints the exit status, and polls the pane until the
+// marker appears. The output is what the pane shows between the two.
+func runVisibleTestCommand(repoRoot, pane, marker string, command testStepCommand) (string, int, error) {
+	script := buildShellScript(filepath.Join(repoRoot, "src"), command.commandText)
+	if command.requiresNix {
+		shellRef := ".#" + strings.TrimSpace(command.flakeShell)
+		if strings.TrimSpace(command.flakeShell) == "" {
+			shellRef = ".#default"
+		}
+		script = fmt.Sprintf("cd %s && nix --extra-experimental-features 'nix-command flakes' develop %s --command sh -lc %s",
+			shellQuote(repoRoot), shellRef, shellQuote(script))
+	}
+	line := fmt.Sprintf("%s; printf '%s exit=%%s\\n' \"$?\"", script, marker)
+	target := tmuxv1.TmuxTarget(pane)
+	if out, err := tmuxcmd.Command(repoRoot, "send-keys", "-t", target, "--", line).CombinedOutput(); err != nil {
+		return "", -1, fmt.Errorf("tmux send-keys to %s failed: %s", pane, strings.TrimSpace(string(out)))
+	}
+	if out, err := tmuxcmd.Command(repoRoot, "send-keys", "-t", target, "C-m").CombinedOutput(); err != nil {
+		return "", -1, fmt.Errorf("tmux send-keys enter to %s failed: %s", pane, strings.TrimSpace(string(out)))
+	}
+	run := tmuxv1.CommandRunner(repoRoot)
+	deadline := time.Now().Add(visibleTestTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(visibleTestPollInterval)
+		screen, err := tmuxv1.Capture(run, pane, visibleTestHistory)
+		if err != nil {
+			return "", -1, err
+		}
+		if output, exitCode, ok := parseVisibleTestOutput(screen.Text(), marker); ok {
+			if exitCode != 0 {
+				return output, exitCode, fmt.Errorf("exit status %d", exitCode)
+			}
+			return output, 0, nil
+		}
+	}
+	return "", -1, fmt.Errorf("visible pane %s did not finish within %s", pane, visibleTestTimeout)
+}
+
+// parseVisibleTestOutput finds the marker's exit line and returns the pane
+// lines printed after the typed command that contains the marker.
+func parseVisibleTestOutput(text, marker string) (string, int, bool) {
+	done := regexp.MustCompile(`^` + regexp.QuoteMeta(marker) + ` exit=(\d+)$`)
+	lines := strings.Split(text, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		m := done.FindStringSubmatch(strings.TrimSpace(lines[i]))
+		if m == nil {
+			continue
+		}
+		exitCode, _ := strconv.Atoi(m[1])
+		start := 0
+		for j := i - 1; j >= 0; j-- {
+			if strings.Contains(lines[j], marker) {
+				start = j + 1
+				break
+			}
+		}
+		return strings.Join(lines[start:i], "\n"), exitCode, true
+	}
+	return "", 0, false
+}
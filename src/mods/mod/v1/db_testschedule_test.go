@@ -0,0 +1,204 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dialtone/dev/internal/modstate"
+)
+
+func TestTestPlanSchedulerRunsIndependentGroupsInParallel(t *testing.T) {
+	db := openScheduleTestDB(t)
+	runID, err := startTestRun(db, "default", 4, true, 4, "")
+	if err != nil {
+		t.Fatalf("startTestRun returned error: %v", err)
+	}
+	var mu sync.Mutex
+	active := map[string]int{}
+	overlap := map[string]bool{}
+	paneByCommand := map[string]string{}
+	run := func(pane string, command testStepCommand) (string, int, error) {
+		group := "none"
+		if strings.Contains(command.commandText, "alpha") || strings.Contains(command.commandText, "beta") {
+			group = "desktop"
+		}
+		mu.Lock()
+		active[group]++
+		if active[group] > 1 {
+			overlap[group] = true
+		}
+		paneByCommand[command.commandText] = pane
+		mu.Unlock()
+		time.Sleep(40 * time.Millisecond)
+		mu.Lock()
+		active[group]--
+		mu.Unlock()
+		return "ok", 0, nil
+	}
+	stubRunTestCommand(t, func(_ string, command testStepCommand) (string, int, error) {
+		return run("", command)
+	})
+	stubRunVisibleTestCommand(t, func(_, pane, marker string, command testStepCommand) (string, int, error) {
+		if marker != "DIALTONE_TEST_DONE_"+strconv.FormatInt(runID, 10)+"_1" {
+			t.Errorf("unexpected marker %q", marker)
+		}
+		return run(pane, command)
+	})
+	plan := []modstate.TestStepRecord{
+		{StepIndex: 1, ModName: "alpha", ModVersion: "v1", TopoRank: 0, SerialGroup: "desktop", VisibleTmux: true},
+		{StepIndex: 2, ModName: "beta", ModVersion: "v1", TopoRank: 1, SerialGroup: "desktop"},
+		{StepIndex: 3, ModName: "gamma", ModVersion: "v1", TopoRank: 2},
+		{StepIndex: 4, ModName: "delta", ModVersion: "v1", TopoRank: 3},
+	}
+	scheduler := testPlanScheduler{
+		db:          db,
+		runID:       runID,
+		modByKey:    scheduleTestMods(plan),
+		dependsOn:   map[string][]string{"delta:v1": {"gamma:v1"}},
+		maxParallel: 4,
+		stopOnError: true,
+		visiblePane: "codex-view:0:1",
+	}
+	summary, err := scheduler.run(plan)
+	if err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+	if summary.passed != 4 || summary.failed != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if summary.peakRunning < 2 {
+		t.Fatalf("expected independent steps to overlap, peak=%d", summary.peakRunning)
+	}
+	if overlap["desktop"] {
+		t.Fatalf("expected serial group desktop to run one step at a time")
+	}
+	if got := paneByCommand["go test ./mods/alpha/v1"]; got != "codex-view:0:1" {
+		t.Fatalf("expected visible step to run in the visible pane, got %q", got)
+	}
+	if got := paneByCommand["go test ./mods/gamma/v1"]; got != "" {
+		t.Fatalf("expected non-visible step to run directly, got %q", got)
+	}
+
+	steps, err := loadTestRunSteps(db, runID)
+	if err != nil {
+		t.Fatalf("loadTestRunSteps returned error: %v", err)
+	}
+	byMod := map[string]testRunStepRecord{}
+	for _, step := range steps {
+		byMod[step.ModName] = step
+		if step.WorkerSlot < 1 || step.WorkerSlot > 4 || step.Concurrency < 1 {
+			t.Fatalf("expected worker slot and concurrency to be recorded, got %+v", step)
+		}
+	}
+	if byMod["beta"].WaitMS < 30 {
+		t.Fatalf("expected beta to wait for its serial group, got %+v", byMod["beta"])
+	}
+	if byMod["delta"].WaitMS >= byMod["gamma"].RuntimeMS {
+		t.Fatalf("expected delta wait to start once gamma finished, got gamma=%+v delta=%+v", byMod["gamma"], byMod["delta"])
+	}
+}
+
+func TestTestPlanSchedulerSkipsDependentsOfFailedSteps(t *testing.T) {
+	db := openScheduleTestDB(t)
+	runID, err := startTestRun(db, "default", 3, false, 2, "")
+	if err != nil {
+		t.Fatalf("startTestRun returned error: %v", err)
+	}
+	stubRunTestCommand(t, func(_ string, command testStepCommand) (string, int, error) {
+		if strings.Contains(command.commandText, "alpha") {
+			return "boom", 1, errors.New("exit status 1")
+		}
+		return "ok", 0, nil
+	})
+	plan := []modstate.TestStepRecord{
+		{StepIndex: 1, ModName: "alpha", ModVersion: "v1", TopoRank: 0},
+		{StepIndex: 2, ModName: "beta", ModVersion: "v1", TopoRank: 1},
+		{StepIndex: 3, ModName: "gamma", ModVersion: "v1", TopoRank: 2},
+	}
+	scheduler := testPlanScheduler{
+		db:          db,
+		runID:       runID,
+		modByKey:    scheduleTestMods(plan),
+		dependsOn:   map[string][]string{"beta:v1": {"alpha:v1"}, "gamma:v1": {"beta:v1"}},
+		maxParallel: 2,
+	}
+	summary, err := scheduler.run(plan)
+	if err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+	if summary.failed != 1 || summary.skipped != 2 || summary.passed != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	steps, err := loadTestRunSteps(db, runID)
+	if err != nil {
+		t.Fatalf("loadTestRunSteps returned error: %v", err)
+	}
+	if len(steps) != 3 || steps[1].Status != "skipped" || !strings.Contains(steps[1].ErrorText, "alpha:v1") || !strings.Contains(steps[2].ErrorText, "beta:v1") {
+		t.Fatalf("expected dependents to be skipped, got %+v", steps)
+	}
+}
+
+func stubRunTestCommand(t *testing.T, fn func(string, testStepCommand) (string, int, error)) {
+	t.Helper()
+	previous := runTestCommandFn
+	runTestCommandFn = fn
+	t.Cleanup(func() { runTestCommandFn = previous })
+}
+
+func stubRunVisibleTestCommand(t *testing.T, fn func(string, string, string, testStepCommand) (string, int, error)) {
+	t.Helper()
+	previous := runVisibleTestCommandFn
+	runVisibleTestCommandFn = fn
+	t.Cleanup(func() { runVisibleTestCommandFn = previous })
+}
+
+func TestParseVisibleTestOutput(t *testing.T) {
+	marker := "DIALTONE_TEST_DONE_7_2"
+	screen := strings.Join([]string{
+		"$ old prompt",
+		"$ cd /repo/src && go test ./mods/alpha/v1; printf '" + marker + " exit=%s\\n' \"$?\"",
+		"--- FAIL: TestAlpha",
+		"FAIL",
+		marker + " exit=1",
+		"$",
+	}, "\n")
+	output, exitCode, ok := parseVisibleTestOutput(screen, marker)
+	if !ok || exitCode != 1 || output != "--- FAIL: TestAlpha\nFAIL" {
+		t.Fatalf("unexpected parse: ok=%v exit=%d output=%q", ok, exitCode, output)
+	}
+	if _, _, ok := parseVisibleTestOutput(strings.Join(strings.Split(screen, "\n")[:4], "\n"), marker); ok {
+		t.Fatalf("expected unfinished pane to not parse")
+	}
+}
+
+func openScheduleTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := modstate.Open(filepath.Join(t.TempDir(), "state.sqlite"))
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := ensureDBTestRunSchema(db); err != nil {
+		t.Fatalf("ensureDBTestRunSchema returned error: %v", err)
+	}
+	return db
+}
+
+func scheduleTestMods(plan []modstate.TestStepRecord) map[string]modstate.ModRecord {
+	out := map[string]modstate.ModRecord{}
+	for _, step := range plan {
+		out[step.ModName+":"+step.ModVersion] = modstate.ModRecord{
+			Name:    step.ModName,
+			Version: step.ModVersion,
+			Path:    "src/mods/" + step.ModName + "/" + step.ModVersion,
+			HasMain: true,
+		}
+	}
+	return out
+}
@@ -138,7 +138,7 @@ func printUsage() {
 	fmt.Println("       [--source PATH] [--dest PATH] [--repo-dir PATH] [--skip-self=true|false]")
 	fmt.Println("       [--branch-map host=branch ...] [--dry-run] [--force]")
 	fmt.Println("       Run `clean --force` then `pull` for the same host target")
-	fmt.Println("  db <path|init|sync|graph|env|state|queue|runs|run|topo|test-plan|test-run|protocol-runs|protocol-events> [args]")
+	fmt.Println("  db <path|init|migrate|sync|graph|env|state|queue|runs|run|topo|test-plan|test-run|protocol-runs|protocol-events> [args]")
 	fmt.Println("       Manage the central sqlite state database for the mod DAG, canonical command runs, transport rows, protocol runs, and TDD test execution")
 	fmt.Println("")
 	fmt.Println("Examples:")
@@ -43,6 +43,9 @@ func ShellReady(db *sql.DB) (bool, error) {
 	if !ok || strings.TrimSpace(commandTarget.Value) == "" {
 		return false, nil
 	}
+	if sqlitestate.IsHeadlessTarget(commandTarget.Value) {
+		return true, nil
+	}
 	promptTarget, ok, err := modstate.LoadStateValue(db, sqlitestate.SystemScope, sqlitestate.TmuxPromptTargetKey)
 	if err != nil {
 		return false, err
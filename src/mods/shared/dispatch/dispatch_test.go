@@ -47,6 +47,25 @@ func TestShellReadyRequiresBothTargets(t *testing.T) {
 	}
 }
 
+func TestShellReadyAcceptsHeadlessCommandTargetWithoutPrompt(t *testing.T) {
+	db, err := modstate.Open(filepath.Join(t.TempDir(), "state.sqlite"))
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer db.Close()
+
+	if err := modstate.UpsertStateValue(db, sqlitestate.SystemScope, sqlitestate.TmuxTargetKey, "pty:headless"); err != nil {
+		t.Fatalf("set command target: %v", err)
+	}
+	ready, err := ShellReady(db)
+	if err != nil {
+		t.Fatalf("ShellReady returned error: %v", err)
+	}
+	if !ready {
+		t.Fatalf("expected headless command target to be ready without a prompt target")
+	}
+}
+
 func TestShouldRouteViaShellExcludesBootstrapAndBackendMods(t *testing.T) {
 	cases := []struct {
 		mod     string
@@ -17,6 +17,7 @@ const TmuxTargetKey = "tmux.target"
 const TmuxPromptTargetKey = "tmux.prompt_target"
 const ShellWorkerStatusKey = "shell.worker.status"
 const ShellWorkerPaneKey = "shell.worker.pane"
+const ShellWorkerBackendKey = "shell.worker.backend"
 const ShellWorkerHeartbeatKey = "shell.worker.heartbeat_at"
 const ShellWorkerCurrentRowIDKey = "shell.worker.current_row_id"
 const ShellWorkerCurrentCommandKey = "shell.worker.current_command"
@@ -27,6 +28,20 @@ const ShellWorkerLastExitCodeKey = "shell.worker.last_exit_code"
 const ShellEnsurePIDKey = "shell.ensure.pid"
 const ShellEnsureLogPathKey = "shell.ensure.log_path"
 const ShellEnsureStartedAtKey = "shell.ensure.started_at"
+const ShellBackendTmux = "tmux"
+const ShellBackendPTY = "pty"
+const HeadlessTargetPrefix = "pty:"
+
+func ResolveShellBackend() string {
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("DIALTONE_SHELL_BACKEND")), ShellBackendPTY) {
+		return ShellBackendPTY
+	}
+	return ShellBackendTmux
+}
+
+func IsHeadlessTarget(target string) bool {
+	return strings.HasPrefix(strings.TrimSpace(target), HeadlessTargetPrefix)
+}
 
 func ResolveStateDir(repoRoot string) string {
 	if value := strings.TrimSpace(os.Getenv("DIALTONE_STATE_DIR")); value != "" {
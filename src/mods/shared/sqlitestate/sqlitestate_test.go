@@ -177,3 +177,23 @@ func openTestDB(t *testing.T) *sql.DB {
 	t.Cleanup(func() { _ = db.Close() })
 	return db
 }
+
+func TestResolveShellBackendDefaultsToTmux(t *testing.T) {
+	t.Setenv("DIALTONE_SHELL_BACKEND", "")
+	if got := ResolveShellBackend(); got != ShellBackendTmux {
+		t.Fatalf("expected tmux backend by default, got %q", got)
+	}
+	t.Setenv("DIALTONE_SHELL_BACKEND", " PTY ")
+	if got := ResolveShellBackend(); got != ShellBackendPTY {
+		t.Fatalf("expected pty backend from env, got %q", got)
+	}
+}
+
+func TestIsHeadlessTarget(t *testing.T) {
+	if !IsHeadlessTarget("pty:headless") {
+		t.Fatalf("expected pty: target to be headless")
+	}
+	if IsHeadlessTarget("codex-view:0:1") {
+		t.Fatalf("expected tmux pane target not to be headless")
+	}
+}
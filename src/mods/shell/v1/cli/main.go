@@ -20,6 +20,7 @@ import (
 	"dialtone/dev/internal/tmuxcmd"
 	"dialtone/dev/mods/shared/dispatch"
 	"dialtone/dev/mods/shared/sqlitestate"
+	tmuxv1 "dialtone/dev/mods/tmux/v1/go"
 )
 
 type shellWorkflowState struct {
@@ -32,12 +33,20 @@ type shellWorkflowState struct {
 }
 
 var (
-	shellPaneExistsFn  = paneExists
-	shellRunStartFn    func([]string) error
-	shellStartWorkerFn func(string, string, string, time.Duration) error
+	shellPaneExistsFn          = paneExists
+	shellRunStartFn            func([]string) error
+	shellStartWorkerFn         func(string, string, string, time.Duration) error
+	shellStartHeadlessWorkerFn = startHeadlessShellWorker
 )
 
+func (state shellWorkflowState) headless() bool {
+	return sqlitestate.IsHeadlessTarget(state.CommandTarget)
+}
+
 func (state shellWorkflowState) readyForVisibleCommands() bool {
+	if state.headless() {
+		return state.WorkerHealthy && strings.TrimSpace(state.WorkerPane) == strings.TrimSpace(state.CommandTarget)
+	}
 	if strings.TrimSpace(state.PromptTarget) == "" || strings.TrimSpace(state.CommandTarget) == "" {
 		return false
 	}
@@ -51,15 +60,17 @@ func (state shellWorkflowState) readyForVisibleCommands() bool {
 
 func (state shellWorkflowState) problems() []string {
 	problems := make([]string, 0, 6)
-	if strings.TrimSpace(state.PromptTarget) == "" {
-		problems = append(problems, "missing prompt_target")
-	} else if !state.PromptPanePresent {
-		problems = append(problems, "prompt pane is not reachable")
-	}
-	if strings.TrimSpace(state.CommandTarget) == "" {
-		problems = append(problems, "missing command_target")
-	} else if !state.CommandPanePresent {
-		problems = append(problems, "command pane is not reachable")
+	if !state.headless() {
+		if strings.TrimSpace(state.PromptTarget) == "" {
+			problems = append(problems, "missing prompt_target")
+		} else if !state.PromptPanePresent {
+			problems = append(problems, "prompt pane is not reachable")
+		}
+		if strings.TrimSpace(state.CommandTarget) == "" {
+			problems = append(problems, "missing command_target")
+		} else if !state.CommandPanePresent {
+			problems = append(problems, "command pane is not reachable")
+		}
 	}
 	if !state.WorkerHealthy {
 		problems = append(problems, "worker heartbeat is stale or stopped")
@@ -954,6 +965,7 @@ func writeShellBusCommandLog(repoRoot string, rowID int64, body shellBusIntentBo
 func runServe(argv []string) error {
 	opts := flag.NewFlagSet("shell v1 serve", flag.ContinueOnError)
 	pane := opts.String("pane", "", "Explicit dialtone-view pane target for this worker")
+	backendName := opts.String("backend", sqlitestate.ResolveShellBackend(), "Worker backend: tmux runs in dialtone-view, pty runs each command in its own pseudo-terminal")
 	pollIntervalMS := opts.Int("poll-interval-ms", 500, "Polling interval for queued SQLite shell bus rows")
 	if err := opts.Parse(argv); err != nil {
 		return err
@@ -964,11 +976,19 @@ func runServe(argv []string) error {
 	if *pollIntervalMS <= 0 {
 		return errors.New("--poll-interval-ms must be positive")
 	}
+	backend, err := resolveShellWorkerBackend(*backendName)
+	if err != nil {
+		return err
+	}
 	repoRoot, err := locateRepoRoot()
 	if err != nil {
 		return err
 	}
+	headless := backend.name == sqlitestate.ShellBackendPTY
 	workerPane := strings.TrimSpace(*pane)
+	if workerPane == "" && headless {
+		workerPane = headlessWorkerTarget("")
+	}
 	if workerPane == "" {
 		workerPane, err = loadStateTarget(repoRoot, sqlitestate.TmuxTargetKey)
 		if err != nil {
@@ -978,12 +998,26 @@ func runServe(argv []string) error {
 	if workerPane == "" {
 		return errors.New("serve requires a dialtone-view pane target")
 	}
+	if headless && !sqlitestate.IsHeadlessTarget(workerPane) {
+		return fmt.Errorf("pty worker target must start with %q, got %s", sqlitestate.HeadlessTargetPrefix, workerPane)
+	}
 	session := strings.TrimSpace(strings.Split(workerPane, ":")[0])
+	if headless {
+		session = strings.TrimPrefix(workerPane, sqlitestate.HeadlessTargetPrefix)
+	}
 	db, err := modstate.Open(sqlitestate.ResolveStateDBPath(repoRoot))
 	if err != nil {
 		return err
 	}
 	defer db.Close()
+	if err := setShellWorkerState(db, map[string]string{sqlitestate.ShellWorkerBackendKey: backend.name}); err != nil {
+		return err
+	}
+	if headless {
+		if err := setShellWorkerState(db, map[string]string{sqlitestate.TmuxTargetKey: workerPane}); err != nil {
+			return err
+		}
+	}
 	defer func() {
 		_ = setShellWorkerState(db, map[string]string{
 			sqlitestate.ShellWorkerStatusKey:         "stopped",
@@ -994,7 +1028,8 @@ func runServe(argv []string) error {
 		})
 	}()
 
-	fmt.Printf("shell worker ready\t%s\n", workerPane)
+	fmt.Printf("shell worker ready\t%s\t%s\n", workerPane, backend.name)
+	unresolved := map[int64]bool{}
 	for {
 		if err := setShellWorkerState(db, map[string]string{
 			sqlitestate.ShellWorkerStatusKey:    "running",
@@ -1008,23 +1043,18 @@ func runServe(argv []string) error {
 			return err
 		}
 		for _, row := range rows {
-			target, err := resolveShellBusTarget(repoRoot, row)
+			owned, err := shellWorkerOwnsRow(repoRoot, row, workerPane, session, headless)
 			if err != nil {
-				return err
-			}
-			switch row.Subject {
-			case "command":
-				if strings.TrimSpace(target) != workerPane {
-					continue
+				if !unresolved[row.ID] {
+					unresolved[row.ID] = true
+					fmt.Fprintf(os.Stderr, "shell worker: skip row %d: %v\n", row.ID, err)
 				}
-			case "prompt":
-				if strings.TrimSpace(target) == "" || strings.TrimSpace(strings.Split(target, ":")[0]) != session {
-					continue
-				}
-			default:
 				continue
 			}
-			if err := syncShellBusRowInWorker(db, repoRoot, row, workerPane); err != nil {
+			if !owned {
+				continue
+			}
+			if err := syncShellBusRowInWorker(db, repoRoot, row, workerPane, backend); err != nil {
 				return err
 			}
 		}
@@ -1032,6 +1062,31 @@ func runServe(argv []string) error {
 	}
 }
 
+// shellWorkerOwnsRow reports whether a queued row belongs to this worker.
+// Headless workers have no prompt pane, so prompt rows are skipped before any
+// target lookup. A row whose target cannot be resolved returns an error so
+// the caller can warn and keep polling instead of stopping the loop.
+func shellWorkerOwnsRow(repoRoot string, row modstate.ShellBusRecord, workerPane, session string, headless bool) (bool, error) {
+	switch row.Subject {
+	case "command":
+	case "prompt":
+		if headless {
+			return false, nil
+		}
+	default:
+		return false, nil
+	}
+	target, err := resolveShellBusTarget(repoRoot, row)
+	if err != nil {
+		return false, err
+	}
+	target = strings.TrimSpace(target)
+	if row.Subject == "command" {
+		return target == workerPane, nil
+	}
+	return target != "" && strings.TrimSpace(strings.Split(target, ":")[0]) == session, nil
+}
+
 func setShellWorkerState(db *sql.DB, values map[string]string) error {
 	for key, value := range values {
 		if err := modstate.UpsertStateValue(db, sqlitestate.SystemScope, key, value); err != nil {
@@ -1091,7 +1146,7 @@ func inspectShellWorkflowState(repoRoot string) (shellWorkflowState, error) {
 	if state.PromptTarget != "" {
 		state.PromptPanePresent = shellPaneExistsFn(repoRoot, state.PromptTarget)
 	}
-	if state.CommandTarget != "" {
+	if state.CommandTarget != "" && !state.headless() {
 		state.CommandPanePresent = shellPaneExistsFn(repoRoot, state.CommandTarget)
 	}
 	return state, nil
@@ -1105,6 +1160,12 @@ func ensureShellWorkflowWorker(repoRoot, session, dialtoneShell, reasoning, mode
 	if state.readyForVisibleCommands() {
 		return nil
 	}
+	if state.headless() {
+		return shellStartHeadlessWorkerFn(repoRoot, strings.TrimSpace(state.CommandTarget), wait)
+	}
+	if sqlitestate.ResolveShellBackend() == sqlitestate.ShellBackendPTY {
+		return shellStartHeadlessWorkerFn(repoRoot, headlessWorkerTarget(""), wait)
+	}
 	if strings.TrimSpace(state.PromptTarget) == "" ||
 		strings.TrimSpace(state.CommandTarget) == "" ||
 		!state.PromptPanePresent ||
@@ -1336,7 +1397,7 @@ func syncShellBusRow(db *sql.DB, repoRoot string, row modstate.ShellBusRecord, w
 	return nil
 }
 
-func syncShellBusRowInWorker(db *sql.DB, repoRoot string, row modstate.ShellBusRecord, workerPane string) error {
+func syncShellBusRowInWorker(db *sql.DB, repoRoot string, row modstate.ShellBusRecord, workerPane string, backend shellWorkerBackend) error {
 	body := shellBusIntentBody{}
 	if strings.TrimSpace(row.BodyJSON) != "" {
 		if err := json.Unmarshal([]byte(row.BodyJSON), &body); err != nil {
@@ -1425,7 +1486,7 @@ func syncShellBusRowInWorker(db *sql.DB, repoRoot string, row modstate.ShellBusR
 		if strings.TrimSpace(body.DisplayCommand) != "" {
 			fmt.Printf("$ %s\n", strings.TrimSpace(body.DisplayCommand))
 		}
-		output, exitCode, pid, runtime, execErr := runVisibleCommand(repoRoot, workerPane, body.Command, func(pid int) error {
+		output, exitCode, pid, runtime, execErr := backend.runCommand(repoRoot, workerPane, body.Command, func(pid int) error {
 			body.PID = pid
 			updated, _ := json.Marshal(body)
 			if err := modstate.UpdateShellBusStatus(db, row.ID, "running", 0, string(updated)); err != nil {
@@ -1470,7 +1531,7 @@ func syncShellBusRowInWorker(db *sql.DB, repoRoot string, row modstate.ShellBusR
 		if err := finishCommandRun(db, body, status); err != nil {
 			return err
 		}
-		_ = captureCurrentShellState(db, repoRoot, row.ID)
+		_ = backend.captureState(db, repoRoot, row.Session, target, row.ID, output)
 		return setShellWorkerState(db, map[string]string{
 			sqlitestate.ShellWorkerStatusKey:         "running",
 			sqlitestate.ShellWorkerPaneKey:           workerPane,
@@ -1726,9 +1787,22 @@ func captureCurrentShellState(db *sql.DB, repoRoot string, refID int64) error {
 	return nil
 }
 
+// paneSnapshotLines caps the plain-text pane snapshot stored in shell_bus;
+// the structured screen recorded by tmux v1 keeps the full capture.
+const paneSnapshotLines = 120
+
+// capturePaneSnapshot records the pane's structured screen (and its diff
+// against the previous snapshot) alongside the plain-text shell_bus row.
 func capturePaneSnapshot(db *sql.DB, repoRoot, session, pane string, refID int64) error {
 	return capturePaneSnapshotWithReader(db, session, pane, refID, func(target string) (string, error) {
-		return runDialtoneModQuiet(repoRoot, "tmux", "v1", "read", "--pane", target, "--lines", "120")
+		screen, err := tmuxv1.Capture(tmuxv1.CommandRunner(repoRoot), target, paneSnapshotLines)
+		if err != nil {
+			return "", err
+		}
+		if _, err := tmuxv1.Record(db, session, target, refID, screen); err != nil {
+			return "", err
+		}
+		return screen.Text(), nil
 	})
 }
 
@@ -1744,6 +1818,7 @@ func capturePaneSnapshotWithReader(db *sql.DB, session, pane string, refID int64
 	if err != nil {
 		return err
 	}
+	text = trailingLines(text, paneSnapshotLines)
 	payload, err := json.Marshal(map[string]string{
 		"text":    text,
 		"summary": summarizeSnapshot(text),
@@ -1755,6 +1830,14 @@ func capturePaneSnapshotWithReader(db *sql.DB, session, pane string, refID int64
 	return err
 }
 
+func trailingLines(text string, n int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) <= n {
+		return text
+	}
+	return strings.Join(lines[len(lines)-n:], "\n")
+}
+
 func runState(argv []string) error {
 	opts := flag.NewFlagSet("shell v1 state", flag.ContinueOnError)
 	limit := opts.Int("limit", 40, "Maximum observed rows to scan for pane snapshots")
@@ -2629,10 +2712,10 @@ func printUsage() {
 	fmt.Println("       Run basic tests first, start the shell workflow, then run the remaining full test sweep in dialtone-view")
 	fmt.Println("  sync-once [--limit 10] [--wait-seconds 10]")
 	fmt.Println("       Reconcile queued SQLite shell bus intents into the live tmux panes once")
-	fmt.Println("  serve [--pane codex-view:0:1] [--poll-interval-ms 500]")
-	fmt.Println("       Run the long-lived SQLite shell worker inside dialtone-view")
+	fmt.Println("  serve [--pane codex-view:0:1] [--backend tmux|pty] [--poll-interval-ms 500]")
+	fmt.Println("       Run the long-lived SQLite shell worker inside dialtone-view, or headless with --backend pty (target pty:headless)")
 	fmt.Println("  ensure-worker [--session codex-view] [--dialtone-shell default] [--wait-seconds 20]")
-	fmt.Println("       Start the workflow or restart the dialtone-view worker if it is missing")
+	fmt.Println("       Start the workflow or restart the dialtone-view worker if it is missing; DIALTONE_SHELL_BACKEND=pty starts a headless pty worker instead")
 	fmt.Println("  state [--limit 40] [--row-id 123] [--full]")
 	fmt.Println("       Auto-refresh and read prompt/command targets, worker status, and the latest or selected shell_bus command row from SQLite")
 	fmt.Println("  status [--limit 40] [--row-id 123] [--full]")
@@ -3,6 +3,7 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -589,6 +590,101 @@ func TestEnsureVisibleShellWorkflowReturnsActionableFailure(t *testing.T) {
 	}
 }
 
+func TestShellWorkflowStateHeadlessSkipsPromptPane(t *testing.T) {
+	state := shellWorkflowState{
+		CommandTarget: "pty:headless",
+		WorkerHealthy: true,
+		WorkerPane:    "pty:headless",
+	}
+	if !state.readyForVisibleCommands() {
+		t.Fatalf("expected headless workflow to be ready without prompt pane: %+v", state)
+	}
+	state.WorkerHealthy = false
+	if got := state.problemSummary(); strings.Contains(got, "prompt") || !strings.Contains(got, "worker heartbeat is stale or stopped") {
+		t.Fatalf("unexpected headless problem summary: %q", got)
+	}
+}
+
+func TestEnsureShellWorkflowWorkerStartsHeadlessWorkerForPTYBackend(t *testing.T) {
+	repoRoot, _ := openShellWorkflowTestDB(t)
+	t.Setenv("DIALTONE_SHELL_BACKEND", "pty")
+
+	originalRunStart := shellRunStartFn
+	originalStartHeadless := shellStartHeadlessWorkerFn
+	t.Cleanup(func() {
+		shellRunStartFn = originalRunStart
+		shellStartHeadlessWorkerFn = originalStartHeadless
+	})
+	shellRunStartFn = func(args []string) error {
+		t.Fatalf("did not expect the ghostty workflow to start: %v", args)
+		return nil
+	}
+	gotTarget := ""
+	shellStartHeadlessWorkerFn = func(_ string, target string, _ time.Duration) error {
+		gotTarget = target
+		return nil
+	}
+
+	if err := ensureShellWorkflowWorker(repoRoot, "codex-view", "default", "medium", "gpt-5.4", "dialtone-view", 20*time.Second); err != nil {
+		t.Fatalf("ensureShellWorkflowWorker returned error: %v", err)
+	}
+	if gotTarget != "pty:headless" {
+		t.Fatalf("expected headless worker target, got %q", gotTarget)
+	}
+}
+
+func TestResolveShellWorkerBackend(t *testing.T) {
+	for _, name := range []string{"", "tmux", "pty"} {
+		if _, err := resolveShellWorkerBackend(name); err != nil {
+			t.Fatalf("resolveShellWorkerBackend(%q) returned error: %v", name, err)
+		}
+	}
+	if _, err := resolveShellWorkerBackend("screen"); err == nil {
+		t.Fatalf("expected unknown backend to be rejected")
+	}
+}
+
+func TestRunPTYCommandCapturesOutputAndExitCode(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("pty backend requires linux or darwin")
+	}
+	startedPID := 0
+	output, exitCode, pid, _, err := runPTYCommand(t.TempDir(), "pty:test", "if [ -t 1 ]; then echo tty; fi; echo $DIALTONE_TMUX_TARGET; exit 3", func(pid int) error {
+		startedPID = pid
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("expected non-zero exit to return an error")
+	}
+	if exitCode != 3 || pid <= 0 || pid != startedPID {
+		t.Fatalf("unexpected exit=%d pid=%d started=%d", exitCode, pid, startedPID)
+	}
+	if !strings.Contains(output, "tty\npty:test\n") {
+		t.Fatalf("expected pty output with normalized newlines, got %q", output)
+	}
+}
+
+func TestPTYBackendCaptureStateStoresCommandOutputAsSnapshot(t *testing.T) {
+	db, err := modstate.Open(filepath.Join(t.TempDir(), "state.sqlite"))
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer db.Close()
+	if err := ptyShellWorkerBackend().captureState(db, "", "headless", "pty:headless", 9, "ok\n"); err != nil {
+		t.Fatalf("captureState returned error: %v", err)
+	}
+	rows, err := modstate.LoadShellBus(db, "observed", 10)
+	if err != nil {
+		t.Fatalf("LoadShellBus returned error: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Pane != "pty:headless" || rows[0].RefID != 9 {
+		t.Fatalf("unexpected observed rows: %+v", rows)
+	}
+	if got := latestPaneSnapshotText(rows, "pty:headless"); got != "ok" {
+		t.Fatalf("unexpected stored snapshot: %q", got)
+	}
+}
+
 func TestLoadStateTargetReadsSQLiteState(t *testing.T) {
 	repoRoot := t.TempDir()
 	dbPath := filepath.Join(repoRoot, ".dialtone", "state.sqlite")
@@ -863,6 +959,31 @@ func TestCapturePaneSnapshotWithReaderStoresObservedRow(t *testing.T) {
 	}
 }
 
+func TestCapturePaneSnapshotKeepsTrailingLines(t *testing.T) {
+	db, err := modstate.Open(filepath.Join(t.TempDir(), "state.sqlite"))
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer db.Close()
+	lines := make([]string, 0, paneSnapshotLines+40)
+	for i := 0; i < paneSnapshotLines+40; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	if err := capturePaneSnapshotWithReader(db, "codex-view", "codex-view:0:1", 7, func(string) (string, error) {
+		return strings.Join(lines, "\n") + "\n", nil
+	}); err != nil {
+		t.Fatalf("capturePaneSnapshotWithReader returned error: %v", err)
+	}
+	rows, err := modstate.LoadShellBus(db, "observed", 10)
+	if err != nil {
+		t.Fatalf("LoadShellBus returned error: %v", err)
+	}
+	want := strings.Join(lines[40:], "\n")
+	if got := latestPaneSnapshotText(rows, "codex-view:0:1"); got != want {
+		t.Fatalf("expected the last %d lines, got %d lines", paneSnapshotLines, len(strings.Split(got, "\n")))
+	}
+}
+
 func TestMarkShellBusRowRunningUpdatesQueuedRow(t *testing.T) {
 	db, err := modstate.Open(filepath.Join(t.TempDir(), "state.sqlite"))
 	if err != nil {
@@ -1070,3 +1191,21 @@ func openShellWorkflowTestDB(t *testing.T) (string, *sql.DB) {
 	t.Cleanup(func() { _ = db.Close() })
 	return repoRoot, db
 }
+
+func TestShellWorkerOwnsRowSkipsPromptRowsWhenHeadless(t *testing.T) {
+	repoRoot := t.TempDir()
+	t.Setenv("DIALTONE_STATE_DB", filepath.Join(repoRoot, ".dialtone", "state.sqlite"))
+	prompt := modstate.ShellBusRecord{ID: 1, Subject: "prompt"}
+	owned, err := shellWorkerOwnsRow(repoRoot, prompt, "pty:headless", "headless", true)
+	if err != nil || owned {
+		t.Fatalf("headless worker should skip prompt rows without a target lookup: owned=%v err=%v", owned, err)
+	}
+	if _, err := shellWorkerOwnsRow(repoRoot, prompt, "codex-view:0:1", "codex-view", false); err == nil {
+		t.Fatalf("expected unresolved prompt target error for tmux worker")
+	}
+	command := modstate.ShellBusRecord{ID: 2, Subject: "command", Pane: "pty:headless"}
+	owned, err = shellWorkerOwnsRow(repoRoot, command, "pty:headless", "headless", true)
+	if err != nil || !owned {
+		t.Fatalf("headless worker should own its command rows: owned=%v err=%v", owned, err)
+	}
+}
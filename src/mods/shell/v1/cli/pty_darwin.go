@@ -0,0 +1,42 @@
+//go:build darwin
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func openPTY() (*os.File, string, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := ptyIoctl(master.Fd(), syscall.TIOCPTYGRANT, 0); err != nil {
+		_ = master.Close()
+		return nil, "", fmt.Errorf("grant pty: %w", err)
+	}
+	if err := ptyIoctl(master.Fd(), syscall.TIOCPTYUNLK, 0); err != nil {
+		_ = master.Close()
+		return nil, "", fmt.Errorf("unlock pty: %w", err)
+	}
+	name := make([]byte, 128)
+	if err := ptyIoctl(master.Fd(), syscall.TIOCPTYGNAME, uintptr(unsafe.Pointer(&name[0]))); err != nil {
+		_ = master.Close()
+		return nil, "", fmt.Errorf("read pty name: %w", err)
+	}
+	if end := bytes.IndexByte(name, 0); end >= 0 {
+		name = name[:end]
+	}
+	return master, string(name), nil
+}
+
+func ptyIoctl(fd, request, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
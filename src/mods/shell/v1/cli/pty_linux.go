@@ -0,0 +1,35 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func openPTY() (*os.File, string, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	unlock := int32(0)
+	if err := ptyIoctl(master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		_ = master.Close()
+		return nil, "", fmt.Errorf("unlock pty: %w", err)
+	}
+	index := uint32(0)
+	if err := ptyIoctl(master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&index))); err != nil {
+		_ = master.Close()
+		return nil, "", fmt.Errorf("read pty index: %w", err)
+	}
+	return master, fmt.Sprintf("/dev/pts/%d", index), nil
+}
+
+func ptyIoctl(fd, request, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
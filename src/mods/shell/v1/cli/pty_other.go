@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+func startPTYCommand(cmd *exec.Cmd) (*os.File, error) {
+	return nil, fmt.Errorf("pty shell worker backend is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"dialtone/dev/mods/shared/sqlitestate"
+)
+
+const ptyOutputDrainTimeout = 2 * time.Second
+
+type shellWorkerBackend struct {
+	name         string
+	runCommand   func(repoRoot, target, command string, onStart func(pid int) error) (string, int, int, time.Duration, error)
+	captureState func(db *sql.DB, repoRoot, session, target string, refID int64, output string) error
+}
+
+func tmuxShellWorkerBackend() shellWorkerBackend {
+	return shellWorkerBackend{
+		name:       sqlitestate.ShellBackendTmux,
+		runCommand: runVisibleCommand,
+		captureState: func(db *sql.DB, repoRoot, _, _ string, refID int64, _ string) error {
+			return captureCurrentShellState(db, repoRoot, refID)
+		},
+	}
+}
+
+func ptyShellWorkerBackend() shellWorkerBackend {
+	return shellWorkerBackend{
+		name:       sqlitestate.ShellBackendPTY,
+		runCommand: runPTYCommand,
+		captureState: func(db *sql.DB, _, session, target string, refID int64, output string) error {
+			return capturePaneSnapshotWithReader(db, session, target, refID, func(string) (string, error) {
+				return output, nil
+			})
+		},
+	}
+}
+
+func resolveShellWorkerBackend(name string) (shellWorkerBackend, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", sqlitestate.ShellBackendTmux:
+		return tmuxShellWorkerBackend(), nil
+	case sqlitestate.ShellBackendPTY:
+		return ptyShellWorkerBackend(), nil
+	default:
+		return shellWorkerBackend{}, fmt.Errorf("unsupported shell worker backend %q (want tmux or pty)", strings.TrimSpace(name))
+	}
+}
+
+func headlessWorkerTarget(session string) string {
+	session = strings.TrimSpace(session)
+	if session == "" {
+		session = "headless"
+	}
+	return sqlitestate.HeadlessTargetPrefix + session
+}
+
+func runPTYCommand(repoRoot, target, command string, onStart func(pid int) error) (string, int, int, time.Duration, error) {
+	env := buildVisibleCommandEnv(os.Environ(), target)
+	shellPath := resolveVisibleShellPath(env)
+	cmd := exec.Command(shellPath, "-lc", command)
+	cmd.Dir = strings.TrimSpace(repoRoot)
+	cmd.Env = env
+	startedAt := time.Now()
+	master, err := startPTYCommand(cmd)
+	if err != nil {
+		return "", -1, 0, 0, err
+	}
+	var (
+		output   bytes.Buffer
+		outputMu sync.Mutex
+	)
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		buf := make([]byte, 4096)
+		for {
+			n, readErr := master.Read(buf)
+			if n > 0 {
+				_, _ = os.Stdout.Write(buf[:n])
+				outputMu.Lock()
+				output.Write(buf[:n])
+				outputMu.Unlock()
+			}
+			if readErr != nil {
+				return
+			}
+		}
+	}()
+	collect := func() string {
+		select {
+		case <-copied:
+		case <-time.After(ptyOutputDrainTimeout):
+			// Background children can keep the pty slave open after the shell exits.
+		}
+		_ = master.Close()
+		<-copied
+		outputMu.Lock()
+		defer outputMu.Unlock()
+		return normalizePTYOutput(output.String())
+	}
+	pid := 0
+	if cmd.Process != nil {
+		pid = cmd.Process.Pid
+	}
+	if onStart != nil {
+		if err := onStart(pid); err != nil {
+			if cmd.Process != nil {
+				_ = cmd.Process.Kill()
+			}
+			_ = cmd.Wait()
+			return collect(), -1, pid, time.Since(startedAt), err
+		}
+	}
+	err = cmd.Wait()
+	runtime := time.Since(startedAt)
+	text := collect()
+	if err != nil {
+		exitCode := -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+		return text, exitCode, pid, runtime, err
+	}
+	return text, 0, pid, runtime, nil
+}
+
+func normalizePTYOutput(raw string) string {
+	text := strings.ReplaceAll(raw, "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n")
+}
+
+func startHeadlessShellWorker(repoRoot, target string, wait time.Duration) error {
+	logDir := filepath.Join(sqlitestate.ResolveStateDir(repoRoot), "logs")
+	if err := os.MkdirAll(logDir, 0o755); err != nil {
+		return err
+	}
+	logPath := filepath.Join(logDir, fmt.Sprintf("shell-worker-pty-%d.log", time.Now().UnixNano()))
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	cmd := buildDialtoneModCommand(repoRoot, "shell", "v1", "serve", "--backend", sqlitestate.ShellBackendPTY, "--pane", strings.TrimSpace(target))
+	cmd.Dir = strings.TrimSpace(repoRoot)
+	cmd.Stdout = file
+	cmd.Stderr = file
+	cmd.Stdin = nil
+	setDetachedProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	_ = cmd.Process.Release()
+	if err := waitForShellWorkerReady(repoRoot, strings.TrimSpace(target), wait); err != nil {
+		return fmt.Errorf("%w (log: %s)", err, logPath)
+	}
+	return nil
+}
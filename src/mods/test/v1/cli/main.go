@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -40,6 +41,8 @@ type startOptions struct {
 	rightTitle       string
 	prompt           string
 	verifyCodex      bool
+	agent            string
+	agentScenario    string
 }
 
 type commandContext struct {
@@ -162,6 +165,16 @@ func runStart(argv []string) error {
 		return err
 	}
 	scenarios := buildDefaultScenarios(scenarioDir)
+	if opts.agentScenario != "" {
+		if opts.agentScenario, err = filepath.Abs(opts.agentScenario); err != nil {
+			return err
+		}
+	} else if opts.agent == "fake" {
+		opts.agentScenario = filepath.Join(scenarioDir, "fake-agent.json")
+		if err := os.WriteFile(opts.agentScenario, []byte(buildFakeAgentScenario(token)), 0o644); err != nil {
+			return err
+		}
+	}
 
 	runID := int64(0)
 	finishStatus := "failed"
@@ -245,7 +258,7 @@ func runStart(argv []string) error {
 		}
 	}
 
-	codexStartCommand := buildCodexStartCommand(opts.session, promptTarget, opts.model, opts.reasoning)
+	codexStartCommand := buildAgentStartCommand(opts.session, promptTarget, opts.model, opts.reasoning, opts.agent, opts.agentScenario)
 	codexStartOutput, err := runDialtoneModCapture(repoRoot,
 		"shell", "v1", "run",
 		"--pane", commandTarget,
@@ -269,7 +282,7 @@ func runStart(argv []string) error {
 		fmt.Print(report.String())
 		return err
 	}
-	codexReadyOutput, err := waitForPaneContains(repoRoot, promptTarget, []string{"OpenAI Codex", "model:"}, time.Duration(opts.codexWaitSeconds)*time.Second)
+	codexReadyOutput, err := waitForPaneContains(repoRoot, promptTarget, agentReadyMarkers(opts.agent), time.Duration(opts.codexWaitSeconds)*time.Second)
 	if err != nil {
 		finishError = err.Error()
 		writeSection("test.codex-ready", codexReadyOutput)
@@ -422,6 +435,8 @@ func parseStartArgs(argv []string) (startOptions, error) {
 	rightTitle := opts.String("right-title", "dialtone-view", "Title for the right-side tmux pane")
 	prompt := opts.String("prompt", "", "Optional explicit prompt text to submit to codex-view")
 	verifyCodex := opts.Bool("verify-codex", true, "Wait for Codex to issue one prompted plain routed ./dialtone_mod command before the harness queues the deterministic scenarios")
+	agent := opts.String("agent", "codex", "Agent backend to drive in codex-view: codex|fake")
+	agentScenario := opts.String("agent-scenario", "", "Scenario JSON for --agent fake (default: run the prompted probe command)")
 	if err := opts.Parse(argv); err != nil {
 		return startOptions{}, err
 	}
@@ -437,6 +452,14 @@ func parseStartArgs(argv []string) (startOptions, error) {
 	if *codexWaitSeconds <= 0 {
 		return startOptions{}, errors.New("--codex-wait-seconds must be positive")
 	}
+	switch strings.TrimSpace(*agent) {
+	case "codex", "fake":
+	default:
+		return startOptions{}, fmt.Errorf("unsupported --agent %q (use codex or fake)", *agent)
+	}
+	if strings.TrimSpace(*agentScenario) != "" && strings.TrimSpace(*agent) != "fake" {
+		return startOptions{}, errors.New("--agent-scenario requires --agent fake")
+	}
 	return startOptions{
 		session:          strings.TrimSpace(*session),
 		waitSeconds:      *waitSeconds,
@@ -447,6 +470,8 @@ func parseStartArgs(argv []string) (startOptions, error) {
 		rightTitle:       strings.TrimSpace(*rightTitle),
 		prompt:           strings.TrimSpace(*prompt),
 		verifyCodex:      *verifyCodex,
+		agent:            strings.TrimSpace(*agent),
+		agentScenario:    strings.TrimSpace(*agentScenario),
 	}, nil
 }
 
@@ -496,14 +521,47 @@ func buildCodexAgentScenario(token string) routedScenario {
 }
 
 func buildCodexStartCommand(session, promptTarget, model, reasoning string) string {
-	return dispatch.BuildDialtoneCommand([]string{
+	return buildAgentStartCommand(session, promptTarget, model, reasoning, "codex", "")
+}
+
+func buildAgentStartCommand(session, promptTarget, model, reasoning, agent, scenario string) string {
+	args := []string{
 		"codex", "v1", "start",
 		"--session", strings.TrimSpace(session),
 		"--pane", strings.TrimSpace(promptTarget),
 		"--shell", "default",
 		"--reasoning", strings.TrimSpace(reasoning),
 		"--model", strings.TrimSpace(model),
-	})
+	}
+	if strings.TrimSpace(agent) == "fake" {
+		args = append(args, "--backend", "fake", "--scenario", strings.TrimSpace(scenario))
+	}
+	return dispatch.BuildDialtoneCommand(args)
+}
+
+// agentReadyMarkers match the banners codex v1 start prints for each backend.
+func agentReadyMarkers(agent string) []string {
+	if strings.TrimSpace(agent) == "fake" {
+		return []string{"Dialtone fake agent", "scenario:"}
+	}
+	return []string{"OpenAI Codex", "model:"}
+}
+
+// buildFakeAgentScenario scripts the fake agent to do what the prompt asks
+// Codex to do: run the one exact probe command for this token, once.
+func buildFakeAgentScenario(token string) string {
+	command := dispatch.BuildDialtoneCommand(buildCodexAgentScenario(token).Args)
+	scenario := map[string]any{
+		"name": "test-v1-codex-agent",
+		"steps": []map[string]any{{
+			"prompt":   "(?m)^" + regexp.QuoteMeta(command) + "$",
+			"delay_ms": 500,
+			"say":      "running the prompted probe command",
+			"commands": []string{command},
+		}},
+	}
+	raw, _ := json.MarshalIndent(scenario, "", "  ")
+	return string(raw) + "\n"
 }
 
 func promptExampleCommands() []string {
@@ -1248,7 +1306,7 @@ func printUsage() {
 	fmt.Println("       Run gofmt on test v1 Go files")
 	fmt.Println("  test")
 	fmt.Println("       Run go test for test v1")
-	fmt.Println("  start")
+	fmt.Println("  start [--agent codex|fake] [--agent-scenario FILE]")
 	fmt.Println("       Run the end-to-end dialtone system test: ensure the workflow, refresh codex-view, submit a prompt, wait for Codex to queue one plain routed ./dialtone_mod command, then queue deterministic routed commands into dialtone-view to validate success, long-running, failure, recovery, and background behavior")
 }
 
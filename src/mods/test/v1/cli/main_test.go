@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/json"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -381,3 +383,53 @@ func TestWaitForShellBusCommandByTextFindsMatchingCodexRow(t *testing.T) {
 		t.Fatalf("expected row id %d, got %+v", wantID, record)
 	}
 }
+
+func TestParseStartArgsValidatesAgent(t *testing.T) {
+	if _, err := parseStartArgs([]string{"--agent", "claude"}); err == nil {
+		t.Fatalf("expected unknown agent to fail")
+	}
+	if _, err := parseStartArgs([]string{"--agent-scenario", "s.json"}); err == nil {
+		t.Fatalf("expected --agent-scenario without --agent fake to fail")
+	}
+	opts, err := parseStartArgs([]string{"--agent", "fake"})
+	if err != nil || opts.agent != "fake" {
+		t.Fatalf("unexpected fake agent options: %+v, %v", opts, err)
+	}
+}
+
+func TestBuildAgentStartCommandSelectsFakeBackend(t *testing.T) {
+	got := buildAgentStartCommand("codex-view", "codex-view:0:0", "gpt-5.4", "medium", "fake", "/tmp/fake-agent.json")
+	if !strings.Contains(got, "./dialtone_mod codex v1 start") || !strings.Contains(got, "--backend fake --scenario /tmp/fake-agent.json") {
+		t.Fatalf("expected fake backend flags, got %q", got)
+	}
+	if strings.Contains(buildCodexStartCommand("codex-view", "codex-view:0:0", "gpt-5.4", "medium"), "--backend") {
+		t.Fatalf("codex backend should keep the default start command")
+	}
+	if markers := agentReadyMarkers("fake"); markers[0] != "Dialtone fake agent" {
+		t.Fatalf("unexpected fake ready markers: %v", markers)
+	}
+}
+
+func TestBuildFakeAgentScenarioMatchesPromptedCommand(t *testing.T) {
+	token := "DIALTONE_TEST_V1_42"
+	var scenario struct {
+		Steps []struct {
+			Prompt   string   `json:"prompt"`
+			Commands []string `json:"commands"`
+		} `json:"steps"`
+	}
+	if err := json.Unmarshal([]byte(buildFakeAgentScenario(token)), &scenario); err != nil {
+		t.Fatalf("scenario is not valid JSON: %v", err)
+	}
+	if len(scenario.Steps) != 1 {
+		t.Fatalf("unexpected scenario: %+v", scenario)
+	}
+	step := scenario.Steps[0]
+	prompt := buildPromptText(token, "", buildCodexAgentScenario(token))
+	if !regexp.MustCompile(step.Prompt).MatchString(prompt) {
+		t.Fatalf("scenario prompt %q does not match prompt text:\n%s", step.Prompt, prompt)
+	}
+	if len(step.Commands) != 1 || step.Commands[0] != "./dialtone_mod mods v1 probe --mode success --label CODEX_AGENT_DIALTONE_TEST_V1_42" {
+		t.Fatalf("unexpected scenario commands: %v", step.Commands)
+	}
+}
@@ -96,6 +96,18 @@ func main() {
 		if err := runRead(args); err != nil {
 			exitIfErr(err, "tmux read")
 		}
+	case "snapshot":
+		if err := runSnapshot(args); err != nil {
+			exitIfErr(err, "tmux snapshot")
+		}
+	case "query":
+		if err := runQuery(args); err != nil {
+			exitIfErr(err, "tmux query")
+		}
+	case "diff":
+		if err := runDiff(args); err != nil {
+			exitIfErr(err, "tmux diff")
+		}
 	case "clear":
 		if err := runClear(args); err != nil {
 			exitIfErr(err, "tmux clear")
@@ -654,6 +666,12 @@ func printUsage() {
 	fmt.Println("       Write text to a tmux pane (default target: dialtone:0:0)")
 	fmt.Println("  read [--pane dialtone:0:0] [--lines 10]")
 	fmt.Println("       Read trailing lines from a tmux pane (default: 10)")
+	fmt.Println("  snapshot [--pane dialtone:0:0] [--lines 120] [--record] [--ref-id N] [--format text|json] [--prompt REGEX]")
+	fmt.Println("       Capture the pane with escape sequences into a screen model (cells, colors, cursor, scrollback); --record stores it and its diff in SQLite")
+	fmt.Println("  query [--pane dialtone:0:0] --what prompt|command|output|cursor|line|cell|text [--row N] [--col N] [--prompt REGEX] [--recorded]")
+	fmt.Println("       Answer a semantic question about the pane screen, e.g. the last prompt line or the output of the last command")
+	fmt.Println("  diff [--pane codex-view:0:1] [--limit 5]")
+	fmt.Println("       Show the recorded terminal-state diffs between pane snapshots")
 	fmt.Println("  clear [--pane codex-view:0:0]")
 	fmt.Println("       Clear tmux history and redraw the target pane")
 	fmt.Println("  rename [--session NAME] [--to dialtone]")
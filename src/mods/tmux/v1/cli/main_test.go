@@ -5,6 +5,8 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	tmuxv1 "dialtone/dev/mods/tmux/v1/go"
 )
 
 func TestTmuxBinaryPrefersDialtoneEnv(t *testing.T) {
@@ -98,7 +100,7 @@ func TestRunShellRejectsPositionalArgs(t *testing.T) {
 
 func TestTmuxCLIUsageIncludesContractAndRuntimeCommands(t *testing.T) {
 	output := captureTmuxStdout(t, printUsage)
-	for _, want := range []string{"install", "build", "format", "test", "read", "write", "shell", "target"} {
+	for _, want := range []string{"install", "build", "format", "test", "read", "write", "shell", "target", "snapshot", "query", "diff"} {
 		if !strings.Contains(output, want) {
 			t.Fatalf("usage missing %q: %s", want, output)
 		}
@@ -143,3 +145,30 @@ func captureTmuxStdout(t *testing.T, fn func()) string {
 	_ = w.Close()
 	return <-done
 }
+
+func TestQueryScreenAnswersSemanticQuestions(t *testing.T) {
+	screen := tmuxv1.ParseCapture("~/dialtone $ ./dialtone_mod mods v1 probe --mode success\nprobe_mode\tsuccess\nprobe_result\tsuccess\n~/dialtone \x1b[32m$\x1b[0m \n", tmuxv1.PaneInfo{Width: 80, Height: 4, CursorRow: 3, CursorCol: 13})
+	cases := map[string]string{
+		"prompt":  "~/dialtone $",
+		"command": "./dialtone_mod mods v1 probe --mode success",
+		"output":  "probe_mode\tsuccess\nprobe_result\tsuccess",
+		"cursor":  "3\t13\t~/dialtone $",
+		"cell":    `{"ch":"$","style":{"fg":"2"}}`,
+	}
+	for what, want := range cases {
+		got, err := queryScreen(screen, what, 3, 11, tmuxv1.DefaultPromptPattern)
+		if err != nil || got != want {
+			t.Fatalf("query %s = %q, %v; want %q", what, got, err, want)
+		}
+	}
+	if _, err := queryScreen(screen, "line", 9, 0, nil); err == nil {
+		t.Fatalf("expected out-of-range row error")
+	}
+	pattern, err := compilePromptPattern(`^>>> (.*)$`)
+	if err != nil {
+		t.Fatalf("compilePromptPattern returned error: %v", err)
+	}
+	if _, err := queryScreen(screen, "prompt", 0, 0, pattern); err == nil {
+		t.Fatalf("expected custom prompt pattern to find no prompt")
+	}
+}
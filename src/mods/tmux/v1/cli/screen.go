@@ -0,0 +1,232 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"dialtone/dev/internal/modstate"
+	tmuxv1 "dialtone/dev/mods/tmux/v1/go"
+)
+
+func runSnapshot(argv []string) error {
+	opts := flag.NewFlagSet("tmux v1 snapshot", flag.ContinueOnError)
+	pane := opts.String("pane", "dialtone:0:0", "tmux target in session:window:pane form")
+	lines := opts.Int("lines", 120, "Scrollback lines to capture above the visible area")
+	record := opts.Bool("record", false, "Store the snapshot and its diff against the previous one in SQLite")
+	refID := opts.Int64("ref-id", 0, "shell_bus row id to link the recorded snapshot to")
+	format := opts.String("format", "text", "Output format: text|json")
+	prompt := opts.String("prompt", "", "Prompt regexp for last prompt/command detection (default: common shell prompts)")
+	if err := opts.Parse(argv); err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unsupported --format %q (use text or json)", *format)
+	}
+	pattern, err := compilePromptPattern(*prompt)
+	if err != nil {
+		return err
+	}
+	target, err := parsePaneTarget(*pane)
+	if err != nil {
+		return err
+	}
+	repoRoot, _ := locateRepoRoot()
+	screen, err := tmuxv1.Capture(tmuxv1.CommandRunner(repoRoot), target.target(), *lines)
+	if err != nil {
+		return err
+	}
+	var recorded tmuxv1.Recorded
+	if *record {
+		if repoRoot == "" {
+			return errors.New("--record requires the dialtone repo root")
+		}
+		err := withStateDB(repoRoot, func(db *sql.DB) error {
+			var err error
+			recorded, err = tmuxv1.Record(db, target.Session, paneName(target), *refID, screen)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if *format == "json" {
+		raw, err := json.MarshalIndent(screen, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(raw))
+		return nil
+	}
+	fmt.Print(renderSnapshotSummary(paneName(target), screen, pattern, recorded))
+	return nil
+}
+
+func renderSnapshotSummary(pane string, screen tmuxv1.Screen, pattern *regexp.Regexp, recorded tmuxv1.Recorded) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "pane\t%s\n", pane)
+	fmt.Fprintf(&out, "size\t%dx%d\n", screen.Width, screen.Height)
+	fmt.Fprintf(&out, "history\t%d\n", screen.HistorySize)
+	fmt.Fprintf(&out, "cursor\t%d,%d\n", screen.Cursor.Row, screen.Cursor.Col)
+	fmt.Fprintf(&out, "alternate\t%t\n", screen.Alternate)
+	if _, line, ok := screen.LastPrompt(pattern); ok {
+		fmt.Fprintf(&out, "last_prompt\t%s\n", line)
+	}
+	if block, ok := screen.LastCommand(pattern); ok {
+		fmt.Fprintf(&out, "last_command\t%s\n", block.Command)
+		fmt.Fprintf(&out, "last_command_running\t%t\n", block.Running)
+		fmt.Fprintf(&out, "last_command_output_lines\t%d\n", len(block.Output))
+	}
+	if recorded.SnapshotID > 0 {
+		fmt.Fprintf(&out, "snapshot_id\t%d\n", recorded.SnapshotID)
+	}
+	if recorded.Diff != nil {
+		fmt.Fprintf(&out, "diff_id\t%d\n", recorded.DiffID)
+		fmt.Fprintf(&out, "diff:\n%s\n", recorded.Diff.String())
+	}
+	return out.String()
+}
+
+func runQuery(argv []string) error {
+	opts := flag.NewFlagSet("tmux v1 query", flag.ContinueOnError)
+	pane := opts.String("pane", "dialtone:0:0", "tmux target in session:window:pane form")
+	lines := opts.Int("lines", 120, "Scrollback lines to capture above the visible area")
+	what := opts.String("what", "prompt", "prompt|command|output|cursor|line|cell|text")
+	row := opts.Int("row", 0, "Visible row for --what line|cell")
+	col := opts.Int("col", 0, "Column for --what cell")
+	prompt := opts.String("prompt", "", "Prompt regexp (default: common shell prompts)")
+	recorded := opts.Bool("recorded", false, "Query the latest snapshot recorded in SQLite instead of the live pane")
+	if err := opts.Parse(argv); err != nil {
+		return err
+	}
+	pattern, err := compilePromptPattern(*prompt)
+	if err != nil {
+		return err
+	}
+	target, err := parsePaneTarget(*pane)
+	if err != nil {
+		return err
+	}
+	repoRoot, _ := locateRepoRoot()
+	var screen tmuxv1.Screen
+	if *recorded {
+		if repoRoot == "" {
+			return errors.New("--recorded requires the dialtone repo root")
+		}
+		err = withStateDB(repoRoot, func(db *sql.DB) error {
+			record, ok, err := modstate.LoadLatestPaneSnapshot(db, paneName(target))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("no recorded snapshot for %s", paneName(target))
+			}
+			screen, err = tmuxv1.LoadSnapshot(record)
+			return err
+		})
+	} else {
+		screen, err = tmuxv1.Capture(tmuxv1.CommandRunner(repoRoot), target.target(), *lines)
+	}
+	if err != nil {
+		return err
+	}
+	out, err := queryScreen(screen, *what, *row, *col, pattern)
+	if err != nil {
+		return err
+	}
+	fmt.Println(out)
+	return nil
+}
+
+func queryScreen(screen tmuxv1.Screen, what string, row, col int, pattern *regexp.Regexp) (string, error) {
+	switch strings.TrimSpace(what) {
+	case "prompt":
+		_, line, ok := screen.LastPrompt(pattern)
+		if !ok {
+			return "", errors.New("no prompt line found")
+		}
+		return line, nil
+	case "command", "output":
+		block, ok := screen.LastCommand(pattern)
+		if !ok {
+			return "", errors.New("no completed or running command found")
+		}
+		if what == "command" {
+			return block.Command, nil
+		}
+		return strings.Join(block.Output, "\n"), nil
+	case "cursor":
+		return fmt.Sprintf("%d\t%d\t%s", screen.Cursor.Row, screen.Cursor.Col, screen.CursorLine()), nil
+	case "line":
+		visible := screen.Visible()
+		if row < 0 || row >= len(visible) {
+			return "", fmt.Errorf("--row %d outside the %d visible rows", row, len(visible))
+		}
+		return strings.TrimRight(visible[row].Text, " "), nil
+	case "cell":
+		raw, err := json.Marshal(screen.Cell(row, col))
+		return string(raw), err
+	case "text":
+		return screen.Text(), nil
+	default:
+		return "", fmt.Errorf("unsupported --what %q (use prompt, command, output, cursor, line, cell or text)", what)
+	}
+}
+
+func runDiff(argv []string) error {
+	opts := flag.NewFlagSet("tmux v1 diff", flag.ContinueOnError)
+	pane := opts.String("pane", "", "Only show diffs for this session:window:pane (default: all panes)")
+	limit := opts.Int("limit", 5, "Number of recorded diffs to show, newest first")
+	if err := opts.Parse(argv); err != nil {
+		return err
+	}
+	name := ""
+	if strings.TrimSpace(*pane) != "" {
+		target, err := parsePaneTarget(*pane)
+		if err != nil {
+			return err
+		}
+		name = paneName(target)
+	}
+	repoRoot, err := locateRepoRoot()
+	if err != nil {
+		return err
+	}
+	return withStateDB(repoRoot, func(db *sql.DB) error {
+		diffs, err := modstate.LoadPaneDiffs(db, name, *limit)
+		if err != nil {
+			return err
+		}
+		if len(diffs) == 0 {
+			fmt.Println("no recorded pane diffs")
+			return nil
+		}
+		for _, diff := range diffs {
+			fmt.Printf("[%d] %s snapshot %d -> %d changed_rows=%d scrolled=%d at %s\n",
+				diff.ID, diff.Pane, diff.FromID, diff.ToID, diff.ChangedRows, diff.Scrolled, diff.CreatedAt)
+			fmt.Println(diff.Text)
+		}
+		return nil
+	})
+}
+
+// paneName is the session:window:pane form pane snapshots are keyed by, the
+// same form shell v1 stores its prompt and command targets in.
+func paneName(t tmuxPaneTarget) string {
+	return fmt.Sprintf("%s:%s:%s", t.Session, t.Window, t.Pane)
+}
+
+func compilePromptPattern(raw string) (*regexp.Regexp, error) {
+	if strings.TrimSpace(raw) == "" {
+		return tmuxv1.DefaultPromptPattern, nil
+	}
+	pattern, err := regexp.Compile(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --prompt: %w", err)
+	}
+	return pattern, nil
+}
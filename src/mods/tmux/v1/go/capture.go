@@ -0,0 +1,152 @@
+package tmuxv1
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"dialtone/dev/internal/modstate"
+	"dialtone/dev/internal/tmuxcmd"
+)
+
+// Runner runs one tmux command and returns its stdout.
+type Runner func(args ...string) (string, error)
+
+func CommandRunner(repoRoot string) Runner {
+	return func(args ...string) (string, error) {
+		cmd := tmuxcmd.Command(repoRoot, args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("tmux %s failed: %s", args[0], strings.TrimSpace(stderr.String()))
+		}
+		return string(out), nil
+	}
+}
+
+// TmuxTarget turns the session:window:pane form used across dialtone state
+// into tmux's session:window.pane.
+func TmuxTarget(pane string) string {
+	parts := strings.Split(strings.TrimSpace(pane), ":")
+	if len(parts) == 3 {
+		return fmt.Sprintf("%s:%s.%s", parts[0], parts[1], parts[2])
+	}
+	return strings.TrimSpace(pane)
+}
+
+const paneInfoFormat = "#{pane_width}\t#{pane_height}\t#{history_size}\t#{cursor_y}\t#{cursor_x}\t#{alternate_on}"
+
+// Capture reads the pane geometry and the last `history` scrollback lines
+// plus the visible area, with escape sequences, and parses them.
+func Capture(run Runner, pane string, history int) (Screen, error) {
+	target := TmuxTarget(pane)
+	rawInfo, err := run("display-message", "-p", "-t", target, paneInfoFormat)
+	if err != nil {
+		return Screen{}, err
+	}
+	info, err := parsePaneInfo(rawInfo)
+	if err != nil {
+		return Screen{}, err
+	}
+	if history < 0 {
+		history = 0
+	}
+	raw, err := run("capture-pane", "-p", "-e", "-t", target, "-S", fmt.Sprintf("-%d", history))
+	if err != nil {
+		return Screen{}, err
+	}
+	return ParseCapture(raw, info), nil
+}
+
+func parsePaneInfo(raw string) (PaneInfo, error) {
+	fields := strings.Split(strings.TrimSpace(raw), "\t")
+	if len(fields) != 6 {
+		return PaneInfo{}, fmt.Errorf("unexpected tmux pane info %q", strings.TrimSpace(raw))
+	}
+	nums := make([]int, 6)
+	for i, field := range fields {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return PaneInfo{}, fmt.Errorf("unexpected tmux pane info %q", strings.TrimSpace(raw))
+		}
+		nums[i] = n
+	}
+	return PaneInfo{Width: nums[0], Height: nums[1], HistorySize: nums[2], CursorRow: nums[3], CursorCol: nums[4], Alternate: nums[5] == 1}, nil
+}
+
+// Recorded is what Record stored: the snapshot row and, when the pane had an
+// earlier snapshot that differs, the diff row.
+type Recorded struct {
+	SnapshotID int64
+	DiffID     int64
+	Diff       *Diff
+}
+
+// Record stores screen as the pane's newest snapshot in SQLite and records
+// the diff against the previous one.
+func Record(db *sql.DB, session, pane string, refID int64, screen Screen) (Recorded, error) {
+	pane = strings.TrimSpace(pane)
+	prev, hasPrev, err := modstate.LoadLatestPaneSnapshot(db, pane)
+	if err != nil {
+		return Recorded{}, err
+	}
+	raw, err := json.Marshal(screen)
+	if err != nil {
+		return Recorded{}, err
+	}
+	id, err := modstate.AppendPaneSnapshot(db, modstate.PaneSnapshotRecord{
+		Session:     session,
+		Pane:        pane,
+		RefID:       refID,
+		Width:       screen.Width,
+		Height:      screen.Height,
+		HistorySize: screen.HistorySize,
+		CursorRow:   screen.Cursor.Row,
+		CursorCol:   screen.Cursor.Col,
+		ScreenJSON:  string(raw),
+		Text:        screen.Text(),
+	})
+	if err != nil {
+		return Recorded{}, err
+	}
+	out := Recorded{SnapshotID: id}
+	if !hasPrev {
+		return out, nil
+	}
+	before, err := LoadSnapshot(prev)
+	if err != nil {
+		return out, err
+	}
+	diff := DiffScreens(before, screen)
+	if diff.Empty() {
+		return out, nil
+	}
+	rawDiff, err := json.Marshal(diff)
+	if err != nil {
+		return out, err
+	}
+	out.Diff = &diff
+	out.DiffID, err = modstate.AppendPaneDiff(db, modstate.PaneDiffRecord{
+		Pane:        pane,
+		FromID:      prev.ID,
+		ToID:        id,
+		Scrolled:    diff.Scrolled,
+		ChangedRows: len(diff.Changes),
+		DiffJSON:    string(rawDiff),
+		Text:        diff.String(),
+	})
+	return out, err
+}
+
+// LoadSnapshot decodes a stored snapshot row back into a Screen.
+func LoadSnapshot(record modstate.PaneSnapshotRecord) (Screen, error) {
+	var screen Screen
+	if err := json.Unmarshal([]byte(record.ScreenJSON), &screen); err != nil {
+		return Screen{}, fmt.Errorf("decode pane snapshot %d: %w", record.ID, err)
+	}
+	return screen, nil
+}
@@ -0,0 +1,120 @@
+package tmuxv1
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Diff describes how the visible area changed between two snapshots. Rows
+// are visible rows of the newer screen; Scrolled is how many lines moved
+// into scrollback in between (detected from the rows both screens share),
+// so row r of next is compared with row r+Scrolled of prev.
+type Diff struct {
+	Scrolled   int          `json:"scrolled"`
+	Resized    bool         `json:"resized,omitempty"`
+	Alternate  bool         `json:"alternate_changed,omitempty"`
+	CursorFrom Cursor       `json:"cursor_from"`
+	CursorTo   Cursor       `json:"cursor_to"`
+	Changes    []LineChange `json:"changes,omitempty"`
+}
+
+type LineChange struct {
+	Row       int    `json:"row"`
+	Before    string `json:"before"`
+	After     string `json:"after"`
+	StyleOnly bool   `json:"style_only,omitempty"`
+}
+
+func DiffScreens(prev, next Screen) Diff {
+	diff := Diff{
+		Resized:    prev.Width != next.Width || prev.Height != next.Height,
+		Alternate:  prev.Alternate != next.Alternate,
+		CursorFrom: prev.Cursor,
+		CursorTo:   next.Cursor,
+	}
+	before := prev.Visible()
+	after := next.Visible()
+	if !diff.Resized && !diff.Alternate && !next.Alternate {
+		diff.Scrolled = detectScroll(before, after, next.HistorySize-prev.HistorySize)
+	}
+	for row, line := range after {
+		var old Line
+		if idx := row + diff.Scrolled; idx < len(before) {
+			old = before[idx]
+		}
+		oldText := strings.TrimRight(old.Text, " ")
+		newText := strings.TrimRight(line.Text, " ")
+		if oldText == newText && reflect.DeepEqual(old.Spans, line.Spans) {
+			continue
+		}
+		diff.Changes = append(diff.Changes, LineChange{Row: row, Before: oldText, After: newText, StyleOnly: oldText == newText})
+	}
+	return diff
+}
+
+// detectScroll finds how far the visible rows moved up by matching the rows
+// the two screens share. history_size stops growing once tmux reaches
+// history-limit, so its delta is only a hint: it wins when it lines up at
+// least as many rows as no scroll, otherwise the best-matching shift does.
+func detectScroll(before, after []Line, hint int) int {
+	if len(before) != len(after) {
+		return 0
+	}
+	bestShift, bestScore := 0, overlapScore(before, after, 0)
+	if hint > 0 && hint < len(after) && overlapScore(before, after, hint) >= bestScore {
+		return hint
+	}
+	for shift := 1; shift < len(after); shift++ {
+		if score := overlapScore(before, after, shift); score > bestScore {
+			bestShift, bestScore = shift, score
+		}
+	}
+	return bestShift
+}
+
+// overlapScore counts non-blank rows of after that equal the row shift
+// lines further down in before. Blank rows match any shift, so they do not
+// count.
+func overlapScore(before, after []Line, shift int) int {
+	score := 0
+	for row := 0; row+shift < len(before) && row < len(after); row++ {
+		text := strings.TrimRight(after[row].Text, " ")
+		if text != "" && text == strings.TrimRight(before[row+shift].Text, " ") {
+			score++
+		}
+	}
+	return score
+}
+
+func (d Diff) Empty() bool {
+	return len(d.Changes) == 0 && d.Scrolled == 0 && !d.Resized && !d.Alternate && d.CursorFrom == d.CursorTo
+}
+
+func (d Diff) String() string {
+	if d.Empty() {
+		return "no change"
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "scrolled\t%d\n", d.Scrolled)
+	fmt.Fprintf(&out, "cursor\t%d,%d -> %d,%d\n", d.CursorFrom.Row, d.CursorFrom.Col, d.CursorTo.Row, d.CursorTo.Col)
+	if d.Resized {
+		out.WriteString("resized\ttrue\n")
+	}
+	if d.Alternate {
+		out.WriteString("alternate_screen\tchanged\n")
+	}
+	for _, change := range d.Changes {
+		if change.StyleOnly {
+			fmt.Fprintf(&out, "~%3d %s\n", change.Row, change.After)
+			continue
+		}
+		if change.Before != "" {
+			fmt.Fprintf(&out, "-%3d %s\n", change.Row, change.Before)
+		}
+		if change.After != "" {
+			fmt.Fprintf(&out, "+%3d %s\n", change.Row, change.After)
+		}
+	}
+	return strings.TrimRight(out.String(), "\n")
+}
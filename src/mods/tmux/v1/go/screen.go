@@ -0,0 +1,381 @@
+package tmuxv1
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Screen is a parsed `capture-pane -e` snapshot: the captured scrollback
+// followed by the visible rows, with SGR styling kept as per-line spans.
+// Columns count runes; wide characters are not expanded.
+type Screen struct {
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	HistorySize int    `json:"history_size"`
+	Alternate   bool   `json:"alternate,omitempty"`
+	Cursor      Cursor `json:"cursor"`
+	Lines       []Line `json:"lines"`
+}
+
+// Cursor is relative to the visible area, as tmux reports it.
+type Cursor struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+type Line struct {
+	Text  string `json:"text"`
+	Spans []Span `json:"spans,omitempty"`
+}
+
+// Span styles the runes [Start, End) of a line. Unstyled runs have no span.
+type Span struct {
+	Start int   `json:"start"`
+	End   int   `json:"end"`
+	Style Style `json:"style"`
+}
+
+// Colors are "" (terminal default), a palette index ("1", "208") or "#rrggbb".
+type Style struct {
+	FG        string `json:"fg,omitempty"`
+	BG        string `json:"bg,omitempty"`
+	Bold      bool   `json:"bold,omitempty"`
+	Dim       bool   `json:"dim,omitempty"`
+	Italic    bool   `json:"italic,omitempty"`
+	Underline bool   `json:"underline,omitempty"`
+	Blink     bool   `json:"blink,omitempty"`
+	Reverse   bool   `json:"reverse,omitempty"`
+	Strike    bool   `json:"strike,omitempty"`
+}
+
+type Cell struct {
+	Ch    string `json:"ch"`
+	Style Style  `json:"style"`
+}
+
+// PaneInfo is the pane geometry read alongside the capture.
+type PaneInfo struct {
+	Width       int
+	Height      int
+	HistorySize int
+	CursorRow   int
+	CursorCol   int
+	Alternate   bool
+}
+
+// DefaultPromptPattern matches prompts that start with user@host
+// ("user@host:~/x$ ", "[pi@rover src]$ "), a cwd ("~/dialtone ❯ ",
+// "/srv/app (main) $ ") or a shell version ("bash-5.2# "), so output such as
+// "# comment" or "$ 5.00" is not taken for a prompt. Group 1 is the text
+// typed after the prompt. Bare "$ " or zsh "%" prompts need an explicit
+// pattern (snapshot/query --prompt).
+var DefaultPromptPattern = regexp.MustCompile(`^(?:\[[\w.-]+@[\w.-]+[^\]]*\]|[\w.-]+@[\w.-]+(?::\S*)?|[~/]\S*(?: \S+){0,2}|(?:ba|z|k)?sh-\d[\d.]*) ?[$#❯](?: (.*))?$`)
+
+// ParseCapture builds a Screen from `capture-pane -p -e` output. The last
+// info.Height lines are the visible area; anything above is scrollback.
+func ParseCapture(raw string, info PaneInfo) Screen {
+	raw = strings.TrimSuffix(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	screen := Screen{
+		Width:       info.Width,
+		Height:      info.Height,
+		HistorySize: info.HistorySize,
+		Alternate:   info.Alternate,
+		Cursor:      Cursor{Row: info.CursorRow, Col: info.CursorCol},
+	}
+	if raw != "" {
+		// tmux only emits SGR when the style changes, so a style set on one
+		// line stays in effect on the following lines until it is reset.
+		var style Style
+		for _, text := range strings.Split(raw, "\n") {
+			var line Line
+			line, style = parseStyledLine(text, style)
+			screen.Lines = append(screen.Lines, line)
+		}
+	}
+	if screen.Height <= 0 {
+		screen.Height = len(screen.Lines)
+	}
+	for len(screen.Lines) < screen.Height {
+		screen.Lines = append(screen.Lines, Line{})
+	}
+	return screen
+}
+
+// parseStyledLine strips escape sequences from one captured line, applying
+// SGR (ESC [ ... m) to the following runes and dropping everything else.
+// style is the style in effect at the start of the line; the style in effect
+// at its end is returned for the next line.
+func parseStyledLine(raw string, style Style) (Line, Style) {
+	var (
+		text  []rune
+		spans []Span
+	)
+	mark := func() {
+		if n := len(spans); n > 0 && spans[n-1].End == -1 {
+			spans[n-1].End = len(text)
+			if spans[n-1].Start == spans[n-1].End {
+				spans = spans[:n-1]
+			}
+		}
+		if style != (Style{}) {
+			spans = append(spans, Span{Start: len(text), End: -1, Style: style})
+		}
+	}
+	mark()
+	runes := []rune(raw)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r != 0x1b {
+			text = append(text, r)
+			continue
+		}
+		if i+1 >= len(runes) {
+			break
+		}
+		switch runes[i+1] {
+		case '[':
+			j := i + 2
+			for j < len(runes) && (runes[j] < 0x40 || runes[j] > 0x7e) {
+				j++
+			}
+			if j < len(runes) && runes[j] == 'm' {
+				next := applySGR(style, string(runes[i+2:j]))
+				if next != style {
+					style = next
+					mark()
+				}
+			}
+			i = j
+		case ']':
+			// OSC (hyperlinks, titles): skip to BEL or ST.
+			j := i + 2
+			for j < len(runes) && runes[j] != 0x07 && !(runes[j] == 0x1b && j+1 < len(runes) && runes[j+1] == '\\') {
+				j++
+			}
+			if j < len(runes) && runes[j] == 0x1b {
+				j++
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	carry := style
+	style = Style{}
+	mark()
+	return Line{Text: string(text), Spans: spans}, carry
+}
+
+func applySGR(style Style, params string) Style {
+	if params == "" {
+		return Style{}
+	}
+	fields := strings.FieldsFunc(params, func(r rune) bool { return r == ';' || r == ':' })
+	for i := 0; i < len(fields); i++ {
+		code, err := strconv.Atoi(fields[i])
+		if err != nil {
+			continue
+		}
+		switch {
+		case code == 0:
+			style = Style{}
+		case code == 1:
+			style.Bold = true
+		case code == 2:
+			style.Dim = true
+		case code == 3:
+			style.Italic = true
+		case code == 4:
+			style.Underline = true
+		case code == 5:
+			style.Blink = true
+		case code == 7:
+			style.Reverse = true
+		case code == 9:
+			style.Strike = true
+		case code == 22:
+			style.Bold, style.Dim = false, false
+		case code == 23:
+			style.Italic = false
+		case code == 24:
+			style.Underline = false
+		case code == 25:
+			style.Blink = false
+		case code == 27:
+			style.Reverse = false
+		case code == 29:
+			style.Strike = false
+		case code >= 30 && code <= 37:
+			style.FG = strconv.Itoa(code - 30)
+		case code >= 90 && code <= 97:
+			style.FG = strconv.Itoa(code - 90 + 8)
+		case code == 39:
+			style.FG = ""
+		case code >= 40 && code <= 47:
+			style.BG = strconv.Itoa(code - 40)
+		case code >= 100 && code <= 107:
+			style.BG = strconv.Itoa(code - 100 + 8)
+		case code == 49:
+			style.BG = ""
+		case code == 38 || code == 48:
+			color, used := extendedColor(fields[i+1:])
+			i += used
+			if code == 38 {
+				style.FG = color
+			} else {
+				style.BG = color
+			}
+		}
+	}
+	return style
+}
+
+// extendedColor decodes the arguments after 38/48: "5;n" or "2;r;g;b".
+func extendedColor(args []string) (string, int) {
+	if len(args) >= 2 && args[0] == "5" {
+		return args[1], 2
+	}
+	if len(args) >= 4 && args[0] == "2" {
+		var rgb [3]int
+		for k := range rgb {
+			rgb[k], _ = strconv.Atoi(args[k+1])
+		}
+		return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2]), 4
+	}
+	return "", len(args)
+}
+
+// Visible returns the rows currently on screen.
+func (s Screen) Visible() []Line {
+	if len(s.Lines) <= s.Height {
+		return s.Lines
+	}
+	return s.Lines[len(s.Lines)-s.Height:]
+}
+
+// Scrollback returns the captured lines above the visible area.
+func (s Screen) Scrollback() []Line {
+	if len(s.Lines) <= s.Height {
+		return nil
+	}
+	return s.Lines[:len(s.Lines)-s.Height]
+}
+
+// Text renders every captured line without styling, trailing blanks trimmed.
+func (s Screen) Text() string {
+	lines := make([]string, 0, len(s.Lines))
+	for _, line := range s.Lines {
+		lines = append(lines, strings.TrimRight(line.Text, " "))
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// CursorIndex is the cursor row as an index into Lines.
+func (s Screen) CursorIndex() int {
+	return len(s.Lines) - len(s.Visible()) + s.Cursor.Row
+}
+
+func (s Screen) CursorLine() string {
+	idx := s.CursorIndex()
+	if idx < 0 || idx >= len(s.Lines) {
+		return ""
+	}
+	return strings.TrimRight(s.Lines[idx].Text, " ")
+}
+
+// Cell returns the rune and style at a visible row and column.
+func (s Screen) Cell(row, col int) Cell {
+	visible := s.Visible()
+	if row < 0 || row >= len(visible) || col < 0 {
+		return Cell{Ch: " "}
+	}
+	line := visible[row]
+	runes := []rune(line.Text)
+	cell := Cell{Ch: " "}
+	if col < len(runes) {
+		cell.Ch = string(runes[col])
+	}
+	for _, span := range line.Spans {
+		if col >= span.Start && col < span.End {
+			cell.Style = span.Style
+			break
+		}
+	}
+	return cell
+}
+
+// LastPrompt finds the last line at or above the cursor that looks like a
+// shell prompt. pattern defaults to DefaultPromptPattern.
+func (s Screen) LastPrompt(pattern *regexp.Regexp) (int, string, bool) {
+	rows := s.promptRows(pattern)
+	if len(rows) == 0 {
+		return -1, "", false
+	}
+	row := rows[len(rows)-1]
+	return row, strings.TrimRight(s.Lines[row].Text, " "), true
+}
+
+// CommandBlock is one prompt line plus the output printed after it.
+type CommandBlock struct {
+	PromptRow int      `json:"prompt_row"`
+	Prompt    string   `json:"prompt"`
+	Command   string   `json:"command"`
+	Output    []string `json:"output"`
+	Running   bool     `json:"running"`
+}
+
+// LastCommand returns the most recent command and its output. When the
+// cursor sits on a fresh prompt the command before it finished; otherwise
+// the latest prompt's command is still running and its output so far is
+// returned.
+func (s Screen) LastCommand(pattern *regexp.Regexp) (CommandBlock, bool) {
+	if pattern == nil {
+		pattern = DefaultPromptPattern
+	}
+	rows := s.promptRows(pattern)
+	if len(rows) == 0 {
+		return CommandBlock{}, false
+	}
+	cursor := s.CursorIndex()
+	start, end, running := rows[len(rows)-1], cursor+1, true
+	if start == cursor {
+		if len(rows) < 2 {
+			return CommandBlock{}, false
+		}
+		start, end, running = rows[len(rows)-2], cursor, false
+	}
+	prompt := strings.TrimRight(s.Lines[start].Text, " ")
+	block := CommandBlock{PromptRow: start, Prompt: prompt, Running: running}
+	if m := pattern.FindStringSubmatch(prompt); len(m) > 1 {
+		block.Command = strings.TrimSpace(m[1])
+	}
+	if end > len(s.Lines) {
+		end = len(s.Lines)
+	}
+	for _, line := range s.Lines[start+1 : end] {
+		block.Output = append(block.Output, strings.TrimRight(line.Text, " "))
+	}
+	for len(block.Output) > 0 && block.Output[len(block.Output)-1] == "" {
+		block.Output = block.Output[:len(block.Output)-1]
+	}
+	return block, true
+}
+
+func (s Screen) promptRows(pattern *regexp.Regexp) []int {
+	if pattern == nil {
+		pattern = DefaultPromptPattern
+	}
+	limit := s.CursorIndex()
+	if limit >= len(s.Lines) {
+		limit = len(s.Lines) - 1
+	}
+	var rows []int
+	for i := 0; i <= limit; i++ {
+		if pattern.MatchString(strings.TrimRight(s.Lines[i].Text, " ")) {
+			rows = append(rows, i)
+		}
+	}
+	return rows
+}
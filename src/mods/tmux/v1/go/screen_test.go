@@ -0,0 +1,187 @@
+package tmuxv1
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dialtone/dev/internal/modstate"
+)
+
+const esc = "\x1b"
+
+func TestParseCaptureKeepsStylesCursorAndScrollback(t *testing.T) {
+	raw := strings.Join([]string{
+		"old history line",
+		"user@host:~/dialtone$ ls",
+		esc + "[1;34mdocs" + esc + "[0m  " + esc + "[38;5;208msrc" + esc + "[39m " + esc + "]8;;file:///x" + esc + "\\link" + esc + "]8;;" + esc + "\\",
+		esc + "[38;2;255;0;10;48;5;4mred" + esc + "[m plain",
+		"user@host:~/dialtone$ ",
+	}, "\n") + "\n"
+	screen := ParseCapture(raw, PaneInfo{Width: 80, Height: 4, HistorySize: 1, CursorRow: 3, CursorCol: 22})
+	if len(screen.Scrollback()) != 1 || len(screen.Visible()) != 4 {
+		t.Fatalf("unexpected split: %d scrollback, %d visible", len(screen.Scrollback()), len(screen.Visible()))
+	}
+	if got := screen.Lines[2].Text; got != "docs  src link" {
+		t.Fatalf("escape sequences not stripped: %q", got)
+	}
+	if cell := screen.Cell(1, 0); cell.Ch != "d" || !cell.Style.Bold || cell.Style.FG != "4" {
+		t.Fatalf("unexpected styled cell: %+v", cell)
+	}
+	if cell := screen.Cell(1, 6); cell.Ch != "s" || cell.Style.FG != "208" || cell.Style.Bold {
+		t.Fatalf("unexpected 256-color cell: %+v", cell)
+	}
+	if cell := screen.Cell(1, 4); cell.Style != (Style{}) {
+		t.Fatalf("reset should clear style: %+v", cell)
+	}
+	if cell := screen.Cell(2, 1); cell.Style.FG != "#ff000a" || cell.Style.BG != "4" {
+		t.Fatalf("unexpected truecolor cell: %+v", cell)
+	}
+	if cell := screen.Cell(2, 4); cell.Ch != "p" || cell.Style != (Style{}) {
+		t.Fatalf("unexpected plain cell: %+v", cell)
+	}
+	if got := screen.CursorLine(); got != "user@host:~/dialtone$" {
+		t.Fatalf("unexpected cursor line: %q", got)
+	}
+	if row, line, ok := screen.LastPrompt(nil); !ok || row != 4 || line != "user@host:~/dialtone$" {
+		t.Fatalf("unexpected last prompt: %d %q %t", row, line, ok)
+	}
+	block, ok := screen.LastCommand(nil)
+	if !ok || block.Running || block.Command != "ls" || strings.Join(block.Output, "|") != "docs  src link|red plain" {
+		t.Fatalf("unexpected last command: %+v", block)
+	}
+}
+
+func TestParseCaptureCarriesStyleAcrossLines(t *testing.T) {
+	screen := ParseCapture(esc+"[31mred one\nred two\n"+esc+"[0mplain", PaneInfo{Width: 20, Height: 3})
+	if cell := screen.Cell(1, 0); cell.Ch != "r" || cell.Style.FG != "1" {
+		t.Fatalf("expected style to carry onto the next line: %+v", cell)
+	}
+	if spans := screen.Lines[1].Spans; len(spans) != 1 || spans[0].Start != 0 || spans[0].End != 7 {
+		t.Fatalf("expected one span over the carried line: %+v", spans)
+	}
+	if cell := screen.Cell(2, 0); cell.Style != (Style{}) {
+		t.Fatalf("reset on the last line should clear style: %+v", cell)
+	}
+}
+
+func TestLastCommandReportsRunningCommand(t *testing.T) {
+	raw := "$ echo one\none\n~/dialtone ❯ ./dialtone_mod mods v1 probe --mode sleep\nprobe_mode\tsleep\n\n\n"
+	screen := ParseCapture(raw, PaneInfo{Width: 80, Height: 6, CursorRow: 4})
+	block, ok := screen.LastCommand(nil)
+	if !ok || !block.Running || block.Command != "./dialtone_mod mods v1 probe --mode sleep" || strings.Join(block.Output, "|") != "probe_mode\tsleep" {
+		t.Fatalf("unexpected running command: %+v", block)
+	}
+	if _, ok := ParseCapture("no prompt here\n", PaneInfo{Height: 1}).LastCommand(nil); ok {
+		t.Fatalf("expected no command without a prompt")
+	}
+}
+
+func TestDefaultPromptPatternNeedsPromptShape(t *testing.T) {
+	for line, want := range map[string]string{
+		"[pi@rover src]$ make":            "make",
+		"bash-5.2# ":                      "",
+		"root@box:/# ":                    "",
+		"user@host:~/dialtone$ ls -la":    "ls -la",
+		"~/dialtone ❯ git status":         "git status",
+		"/srv/app (main) $ go test ./...": "go test ./...",
+	} {
+		m := DefaultPromptPattern.FindStringSubmatch(line)
+		if m == nil || m[1] != want {
+			t.Fatalf("%q: expected prompt with command %q, got %q", line, want, m)
+		}
+	}
+	for _, line := range []string{"# comment", "$ 5.00", "total: $", "## Heading"} {
+		if DefaultPromptPattern.MatchString(line) {
+			t.Fatalf("%q should not read as a prompt", line)
+		}
+	}
+}
+
+func TestDiffScreensAccountsForScroll(t *testing.T) {
+	prev := ParseCapture("$ make\nbuilding\n$ \n", PaneInfo{Width: 20, Height: 3, HistorySize: 10, CursorRow: 2, CursorCol: 2})
+	next := ParseCapture("$ \n$ ls\n"+esc+"[31mREADME"+esc+"[0m\n", PaneInfo{Width: 20, Height: 3, HistorySize: 12, CursorRow: 2, CursorCol: 6})
+	diff := DiffScreens(prev, next)
+	if diff.Scrolled != 2 || diff.Resized || diff.CursorTo.Col != 6 {
+		t.Fatalf("unexpected diff header: %+v", diff)
+	}
+	if len(diff.Changes) != 2 || diff.Changes[0].Row != 1 || diff.Changes[0].After != "$ ls" || diff.Changes[1].After != "README" {
+		t.Fatalf("unexpected changes: %+v", diff.Changes)
+	}
+	if text := diff.String(); !strings.Contains(text, "scrolled\t2") || !strings.Contains(text, "+  2 README") {
+		t.Fatalf("unexpected diff text:\n%s", text)
+	}
+	restyled := ParseCapture("$ \n$ ls\n"+esc+"[32mREADME"+esc+"[0m\n", PaneInfo{Width: 20, Height: 3, HistorySize: 12, CursorRow: 2, CursorCol: 6})
+	if d := DiffScreens(next, restyled); len(d.Changes) != 1 || !d.Changes[0].StyleOnly {
+		t.Fatalf("expected style-only change: %+v", d)
+	}
+	if !DiffScreens(next, next).Empty() {
+		t.Fatalf("identical screens should not differ")
+	}
+}
+
+func TestDiffScreensDetectsScrollAtHistoryLimit(t *testing.T) {
+	// Once history-limit is reached history_size stays put while lines keep
+	// scrolling, so the shift has to come from the rows the screens share.
+	prev := ParseCapture("one\ntwo\nthree\nfour\n", PaneInfo{Width: 20, Height: 4, HistorySize: 2000, CursorRow: 3})
+	next := ParseCapture("three\nfour\nfive\nsix\n", PaneInfo{Width: 20, Height: 4, HistorySize: 2000, CursorRow: 3})
+	diff := DiffScreens(prev, next)
+	if diff.Scrolled != 2 {
+		t.Fatalf("expected scroll of 2 at the history limit, got %+v", diff)
+	}
+	if len(diff.Changes) != 2 || diff.Changes[0].Row != 2 || diff.Changes[0].After != "five" || diff.Changes[1].After != "six" {
+		t.Fatalf("expected only the new rows to change: %+v", diff.Changes)
+	}
+}
+
+func TestCaptureAndRecordStoreSnapshotsWithDiffs(t *testing.T) {
+	frames := []string{"pi@rover:~$ \n\n", "pi@rover:~$ ls\nREADME\npi@rover:~$ \n"}
+	infos := []string{"40\t3\t0\t0\t2\t0\n", "40\t3\t0\t2\t2\t0\n"}
+	frame := -1
+	var calls [][]string
+	run := func(args ...string) (string, error) {
+		calls = append(calls, args)
+		if args[0] == "display-message" {
+			frame++
+			return infos[frame], nil
+		}
+		return frames[frame], nil
+	}
+	db, err := modstate.Open(filepath.Join(t.TempDir(), "state.sqlite"))
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer db.Close()
+
+	var last Recorded
+	for range frames {
+		screen, err := Capture(run, "codex-view:0:1", 50)
+		if err != nil {
+			t.Fatalf("Capture returned error: %v", err)
+		}
+		if last, err = Record(db, "codex-view", "codex-view:0:1", 9, screen); err != nil {
+			t.Fatalf("Record returned error: %v", err)
+		}
+	}
+	if strings.Join(calls[1], " ") != "capture-pane -p -e -t codex-view:0.1 -S -50" {
+		t.Fatalf("unexpected capture args: %v", calls[1])
+	}
+	if last.SnapshotID == 0 || last.DiffID == 0 || last.Diff == nil || len(last.Diff.Changes) != 3 {
+		t.Fatalf("unexpected record result: %+v", last)
+	}
+	stored, ok, err := modstate.LoadLatestPaneSnapshot(db, "codex-view:0:1")
+	if err != nil || !ok || stored.CursorRow != 2 || stored.Text != "pi@rover:~$ ls\nREADME\npi@rover:~$" {
+		t.Fatalf("unexpected stored snapshot: %+v ok=%t err=%v", stored, ok, err)
+	}
+	screen, err := LoadSnapshot(stored)
+	if err != nil {
+		t.Fatalf("LoadSnapshot returned error: %v", err)
+	}
+	if block, ok := screen.LastCommand(nil); !ok || block.Command != "ls" || strings.Join(block.Output, "|") != "README" {
+		t.Fatalf("unexpected command from stored snapshot: %+v", block)
+	}
+	diffs, err := modstate.LoadPaneDiffs(db, "codex-view:0:1", 5)
+	if err != nil || len(diffs) != 1 || diffs[0].ToID != last.SnapshotID || diffs[0].ChangedRows != 3 {
+		t.Fatalf("unexpected stored diffs: %+v err=%v", diffs, err)
+	}
+}
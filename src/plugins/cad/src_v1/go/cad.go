@@ -1,6 +1,10 @@
 package cad
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,6 +12,9 @@ import (
 	"os/exec"
 	"sort"
 	"strconv"
+	"strings"
+
+	"dialtone/dev/plugins/cad/src_v1/go/mesh"
 )
 
 // CADObject represents a parametric 3D object.
@@ -41,6 +48,12 @@ func (o CADObject) ToJSON() (string, error) {
 }
 
 func GenerateSTL(paths Paths, params map[string]interface{}) ([]byte, error) {
+	return GenerateSTLContext(context.Background(), paths, params, nil)
+}
+
+// GenerateSTLContext runs the backend until ctx is done, passing each stderr
+// line to progress.
+func GenerateSTLContext(ctx context.Context, paths Paths, params map[string]interface{}, progress func(string)) ([]byte, error) {
 	pixiBin, err := ResolvePixiBinary(paths)
 	if err != nil {
 		return nil, err
@@ -56,19 +69,39 @@ func GenerateSTL(paths Paths, params map[string]interface{}) ([]byte, error) {
 		args = append(args, "--"+k, fmt.Sprintf("%v", params[k]))
 	}
 
-	cmd := exec.Command(pixiBin, args...)
+	cmd := exec.CommandContext(ctx, pixiBin, args...)
 	cmd.Dir = paths.BackendDir
-	output, err := cmd.Output()
+	stderrPipe, err := cmd.StderrPipe()
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return nil, fmt.Errorf("python cli failed (pixi=%s): %s", pixiBin, string(exitErr.Stderr))
+		return nil, err
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("pixi command failed (pixi=%s): %w", pixiBin, err)
+	}
+	var stderr strings.Builder
+	scanner := bufio.NewScanner(stderrPipe)
+	for scanner.Scan() {
+		line := scanner.Text()
+		stderr.WriteString(line + "\n")
+		if progress != nil && strings.TrimSpace(line) != "" {
+			progress(strings.TrimSpace(line))
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if _, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("python cli failed (pixi=%s): %s", pixiBin, stderr.String())
 		}
 		return nil, fmt.Errorf("pixi command failed (pixi=%s): %w", pixiBin, err)
 	}
-	return output, nil
+	return stdout.Bytes(), nil
 }
 
-func HandleGenerate(paths Paths) http.HandlerFunc {
+func HandleGenerate(queue *JobQueue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -79,9 +112,8 @@ func HandleGenerate(paths Paths) http.HandlerFunc {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
-		stl, err := GenerateSTL(paths, params)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Generation failed: %v", err), http.StatusInternalServerError)
+		stl, ok := queue.fetch(w, r, params)
+		if !ok {
 			return
 		}
 		w.Header().Set("Content-Type", "application/sla")
@@ -120,33 +152,105 @@ func HandleMetadata(paths Paths) http.HandlerFunc {
 	}
 }
 
-func HandleDownload(paths Paths) http.HandlerFunc {
+// HandleDownload serves the generated mesh as an attachment; the format
+// query parameter picks stl (default), stl-ascii, 3mf or obj.
+func HandleDownload(queue *JobQueue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := make(map[string]interface{})
 		query := r.URL.Query()
 		for k := range query {
+			if k == "format" {
+				continue
+			}
 			params[k] = query.Get(k)
 		}
-
-		stl, err := GenerateSTL(paths, params)
+		format, err := mesh.ParseFormat(query.Get("format"))
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Generation failed: %v", err), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
+		stl, ok := queue.fetch(w, r, params)
+		if !ok {
+			return
+		}
+		out := stl
+		if format != mesh.FormatSTL || !isBinarySTL(stl) {
+			m, err := mesh.Parse(stl)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Mesh parse failed: %v", err), http.StatusInternalServerError)
+				return
+			}
+			m.Name = "gear"
+			var buf bytes.Buffer
+			if err := mesh.Encode(&buf, m, format); err != nil {
+				http.Error(w, fmt.Sprintf("Mesh export failed: %v", err), http.StatusInternalServerError)
+				return
+			}
+			out = buf.Bytes()
+		}
+
 		numTeeth := query.Get("num_teeth")
 		if numTeeth == "" {
 			numTeeth = "unknown"
 		}
 
-		w.Header().Set("Content-Type", "application/sla")
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=gear_%st.stl", numTeeth))
-		_, _ = w.Write(stl)
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=gear_%st.%s", numTeeth, format.Extension()))
+		_, _ = w.Write(out)
+	}
+}
+
+func isBinarySTL(data []byte) bool {
+	return len(data) >= 84 && uint64(len(data)) == 84+50*uint64(binary.LittleEndian.Uint32(data[80:84]))
+}
+
+// HandleMeshMetadata generates (or loads from cache) the mesh for the query
+// parameters, or a POSTed JSON body, and reports its printability.
+func HandleMeshMetadata(queue *JobQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := make(map[string]interface{})
+		switch r.Method {
+		case http.MethodGet:
+			query := r.URL.Query()
+			for k := range query {
+				params[k] = query.Get(k)
+			}
+		case http.MethodPost:
+			if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		stl, ok := queue.fetch(w, r, params)
+		if !ok {
+			return
+		}
+		m, err := mesh.Parse(stl)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Mesh parse failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"type":       "gear",
+			"parameters": params,
+			"job":        w.Header().Get("X-CAD-Job"),
+			"mesh":       mesh.Analyze(m),
+			"formats":    mesh.Formats,
+		})
 	}
 }
 
-func RegisterHandlers(mux *http.ServeMux, paths Paths) {
-	mux.HandleFunc("/api/cad/generate", HandleGenerate(paths))
+func RegisterHandlers(mux *http.ServeMux, paths Paths) *JobQueue {
+	queue := NewPathsJobQueue(paths)
+	mux.HandleFunc("/api/cad/generate", HandleGenerate(queue))
 	mux.HandleFunc("/api/cad", HandleMetadata(paths))
-	mux.HandleFunc("/api/cad/download", HandleDownload(paths))
+	mux.HandleFunc("/api/cad/download", HandleDownload(queue))
+	mux.HandleFunc("/api/metadata", HandleMeshMetadata(queue))
+	mux.HandleFunc("/api/cad/jobs", queue.HandleJobs())
+	mux.HandleFunc("/api/cad/jobs/", queue.HandleJobs())
+	return queue
 }
@@ -0,0 +1,561 @@
+package cad
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	JobQueued   = "queued"
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+var ErrQueueFull = errors.New("cad generation queue is full")
+
+// GenerateFunc produces STL bytes for params; progress receives backend log lines.
+type GenerateFunc func(ctx context.Context, params map[string]interface{}, progress func(string)) ([]byte, error)
+
+// DefaultPartKind is the part the pixi backend generates.
+const DefaultPartKind = "gear"
+
+// DefaultMaxCacheBytes caps the on-disk STL cache; least recently used
+// files are evicted past it.
+const DefaultMaxCacheBytes = 512 << 20
+
+type JobQueueOptions struct {
+	Workers    int
+	MaxPending int
+	KeepJobs   int
+	CacheDir   string
+	// Kind is the part Generate builds and is part of every key, so queues
+	// for different generators can share CacheDir. It defaults to
+	// DefaultPartKind.
+	Kind string
+	// MaxCacheBytes bounds CacheDir; it defaults to DefaultMaxCacheBytes.
+	MaxCacheBytes int64
+	// Salt is mixed into every key so cached STLs are dropped when the
+	// generator changes; it defaults to the backend main.py contents.
+	Salt     string
+	Generate GenerateFunc
+}
+
+// Job is one generation keyed by the canonical parameter hash. Requests for
+// the same key while it is queued or running share the job.
+type Job struct {
+	ID         string                 `json:"id"`
+	Key        string                 `json:"key"`
+	Kind       string                 `json:"kind"`
+	Parameters map[string]interface{} `json:"parameters"`
+	State      string                 `json:"state"`
+	Cached     bool                   `json:"cached,omitempty"`
+	Position   int                    `json:"queue_position,omitempty"`
+	Message    string                 `json:"message,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Bytes      int                    `json:"bytes,omitempty"`
+	Waiters    int                    `json:"waiters"`
+	CreatedAt  time.Time              `json:"created_at"`
+	StartedAt  time.Time              `json:"started_at,omitempty"`
+	FinishedAt time.Time              `json:"finished_at,omitempty"`
+
+	// detached jobs were submitted asynchronously and only end on Cancel.
+	detached bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func (j *Job) finished() bool {
+	return j.State == JobDone || j.State == JobFailed || j.State == JobCanceled
+}
+
+type JobQueue struct {
+	opts JobQueueOptions
+
+	mu       sync.Mutex
+	jobs     map[string]*Job
+	pending  []*Job
+	history  []*Job
+	running  int
+	runs     int
+	hits     int
+	shared   int
+	canceled int
+	evicted  int
+
+	// cacheMu serializes evictions so workers don't walk CacheDir at once.
+	cacheMu sync.Mutex
+}
+
+func NewJobQueue(opts JobQueueOptions) *JobQueue {
+	if opts.Workers <= 0 {
+		opts.Workers = 2
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = 16
+	}
+	if opts.KeepJobs <= 0 {
+		opts.KeepJobs = 64
+	}
+	if strings.TrimSpace(opts.Kind) == "" {
+		opts.Kind = DefaultPartKind
+	}
+	if opts.MaxCacheBytes <= 0 {
+		opts.MaxCacheBytes = DefaultMaxCacheBytes
+	}
+	return &JobQueue{opts: opts, jobs: map[string]*Job{}}
+}
+
+// NewPathsJobQueue generates through pixi and caches under paths.STLCacheDir.
+func NewPathsJobQueue(paths Paths) *JobQueue {
+	salt := ""
+	if source, err := os.ReadFile(paths.BackendMain); err == nil {
+		sum := sha256.Sum256(source)
+		salt = hex.EncodeToString(sum[:])
+	}
+	return NewJobQueue(JobQueueOptions{
+		CacheDir: paths.STLCacheDir,
+		Salt:     salt,
+		Generate: func(ctx context.Context, params map[string]interface{}, progress func(string)) ([]byte, error) {
+			return GenerateSTLContext(ctx, paths, params, progress)
+		},
+	})
+}
+
+// CanonicalKey hashes an object's type and parameters independent of key
+// order and of whether numbers arrived as JSON numbers or query strings.
+func CanonicalKey(obj CADObject, salt string) string {
+	keys := make([]string, 0, len(obj.Parameters))
+	for k := range obj.Parameters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n%s\n", strings.ToLower(strings.TrimSpace(obj.Type)), salt)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", k, canonicalValue(obj.Parameters[k]))
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func canonicalValue(v interface{}) string {
+	switch t := v.(type) {
+	case float64:
+		return strconv.FormatFloat(t, 'g', -1, 64)
+	case int:
+		return strconv.Itoa(t)
+	case json.Number:
+		return canonicalValue(string(t))
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(t), 64); err == nil {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return strconv.Quote(t)
+	default:
+		return fmt.Sprintf("%v", t)
+	}
+}
+
+func (q *JobQueue) cachePath(key string) string {
+	if q.opts.CacheDir == "" {
+		return ""
+	}
+	return filepath.Join(q.opts.CacheDir, key[:2], key+".stl")
+}
+
+// Submit returns the job for params: a finished job on a cache hit, the
+// in-flight job when one exists for the same key, or a newly queued one.
+// Each call adds a waiter that must be dropped with Release.
+func (q *JobQueue) Submit(params map[string]interface{}) (*Job, error) {
+	key := CanonicalKey(CADObject{Type: q.opts.Kind, Parameters: params}, q.opts.Salt)
+	now := time.Now().UTC()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job, ok := q.jobs[key]; ok && !job.finished() {
+		job.Waiters++
+		q.shared++
+		return job, nil
+	}
+	job := &Job{ID: key[:16], Key: key, Kind: q.opts.Kind, Parameters: params, CreatedAt: now, Waiters: 1, done: make(chan struct{})}
+	if path := q.cachePath(key); path != "" {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			// The mtime doubles as last use for eviction.
+			_ = os.Chtimes(path, now, now)
+			job.State = JobDone
+			job.Cached = true
+			job.Bytes = int(info.Size())
+			job.FinishedAt = now
+			close(job.done)
+			q.hits++
+			q.remember(job)
+			return job, nil
+		}
+	}
+	if len(q.pending) >= q.opts.MaxPending {
+		return nil, ErrQueueFull
+	}
+	job.State = JobQueued
+	job.ctx, job.cancel = context.WithCancel(context.Background())
+	q.pending = append(q.pending, job)
+	q.remember(job)
+	q.startLocked()
+	return job, nil
+}
+
+func (q *JobQueue) remember(job *Job) {
+	q.jobs[job.Key] = job
+	q.history = append(q.history, job)
+	for len(q.history) > q.opts.KeepJobs {
+		old := q.history[0]
+		q.history = q.history[1:]
+		if q.jobs[old.Key] == old && old.finished() {
+			delete(q.jobs, old.Key)
+		}
+	}
+}
+
+// startLocked hands pending jobs to free workers in FIFO order.
+func (q *JobQueue) startLocked() {
+	for q.running < q.opts.Workers && len(q.pending) > 0 {
+		job := q.pending[0]
+		q.pending = q.pending[1:]
+		q.running++
+		q.runs++
+		job.State = JobRunning
+		job.StartedAt = time.Now().UTC()
+		go q.run(job)
+	}
+}
+
+func (q *JobQueue) run(job *Job) {
+	stl, err := q.opts.Generate(job.ctx, job.Parameters, func(line string) {
+		q.mu.Lock()
+		job.Message = line
+		q.mu.Unlock()
+	})
+	if err == nil && job.ctx.Err() == nil {
+		if err = q.store(job.Key, stl); err == nil {
+			q.evict(job.Key)
+		}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running--
+	switch {
+	case job.State == JobCanceled:
+	case err != nil:
+		job.State = JobFailed
+		job.Error = err.Error()
+	default:
+		job.State = JobDone
+		job.Bytes = len(stl)
+	}
+	job.FinishedAt = time.Now().UTC()
+	job.cancel()
+	close(job.done)
+	q.startLocked()
+}
+
+func (q *JobQueue) store(key string, stl []byte) error {
+	path := q.cachePath(key)
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.tmp-%d", path, time.Now().UnixNano())
+	if err := os.WriteFile(tmp, stl, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// evict removes the least recently used STLs until CacheDir fits in
+// MaxCacheBytes, never touching keep. Jobs whose file is evicted regenerate
+// on their next Submit.
+func (q *JobQueue) evict(keep string) {
+	if q.opts.CacheDir == "" {
+		return
+	}
+	q.cacheMu.Lock()
+	defer q.cacheMu.Unlock()
+	type cached struct {
+		path string
+		size int64
+		used time.Time
+	}
+	var files []cached
+	var total int64
+	_ = filepath.WalkDir(q.opts.CacheDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".stl" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		total += info.Size()
+		if path != q.cachePath(keep) {
+			files = append(files, cached{path: path, size: info.Size(), used: info.ModTime()})
+		}
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].used.Before(files[j].used) })
+	removed := 0
+	for _, f := range files {
+		if total <= q.opts.MaxCacheBytes {
+			break
+		}
+		if os.Remove(f.path) == nil {
+			total -= f.size
+			removed++
+		}
+	}
+	if removed > 0 {
+		q.mu.Lock()
+		q.evicted += removed
+		q.mu.Unlock()
+	}
+}
+
+// Release drops a waiter; the last waiter leaving an unfinished job cancels it.
+func (q *JobQueue) Release(job *Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job.Waiters > 0 {
+		job.Waiters--
+	}
+	if job.Waiters == 0 && !job.detached && !job.finished() {
+		q.cancelLocked(job)
+	}
+}
+
+// Detach releases the caller's waiter but keeps the job running until it
+// finishes or is cancelled explicitly.
+func (q *JobQueue) Detach(job *Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job.detached = true
+	if job.Waiters > 0 {
+		job.Waiters--
+	}
+}
+
+// Cancel stops a queued or running job regardless of its waiters.
+func (q *JobQueue) Cancel(id string) (*Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := q.lookupLocked(id)
+	if job == nil {
+		return nil, false
+	}
+	if !job.finished() {
+		q.cancelLocked(job)
+	}
+	return job, true
+}
+
+func (q *JobQueue) cancelLocked(job *Job) {
+	wasQueued := job.State == JobQueued
+	job.State = JobCanceled
+	job.FinishedAt = time.Now().UTC()
+	q.canceled++
+	if job.cancel != nil {
+		job.cancel()
+	}
+	if wasQueued {
+		for i, pending := range q.pending {
+			if pending == job {
+				q.pending = append(q.pending[:i], q.pending[i+1:]...)
+				break
+			}
+		}
+		close(job.done)
+	}
+}
+
+func (q *JobQueue) lookupLocked(id string) *Job {
+	for i := len(q.history) - 1; i >= 0; i-- {
+		if job := q.history[i]; job.ID == id || job.Key == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// Wait blocks until job finishes or ctx ends, then returns the STL bytes.
+func (q *JobQueue) Wait(ctx context.Context, job *Job) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-job.done:
+	}
+	snap := q.snapshot(job)
+	switch snap.State {
+	case JobDone:
+		return q.Result(job)
+	case JobCanceled:
+		return nil, context.Canceled
+	default:
+		return nil, errors.New(snap.Error)
+	}
+}
+
+func (q *JobQueue) Result(job *Job) ([]byte, error) {
+	path := q.cachePath(job.Key)
+	if path == "" {
+		return nil, fmt.Errorf("cad job %s has no cache dir", job.ID)
+	}
+	return os.ReadFile(path)
+}
+
+func (q *JobQueue) snapshot(job *Job) Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	snap := *job
+	snap.Position = 0
+	for i, pending := range q.pending {
+		if pending == job {
+			snap.Position = i + 1
+		}
+	}
+	return snap
+}
+
+type QueueStatus struct {
+	Workers  int   `json:"workers"`
+	Running  int   `json:"running"`
+	Pending  int   `json:"pending"`
+	Runs     int   `json:"runs"`
+	Hits     int   `json:"cache_hits"`
+	Shared   int   `json:"shared"`
+	Canceled int   `json:"canceled"`
+	Evicted  int   `json:"cache_evicted"`
+	Jobs     []Job `json:"jobs"`
+}
+
+func (q *JobQueue) Status() QueueStatus {
+	q.mu.Lock()
+	history := append([]*Job(nil), q.history...)
+	st := QueueStatus{Workers: q.opts.Workers, Running: q.running, Pending: len(q.pending), Runs: q.runs, Hits: q.hits, Shared: q.shared, Canceled: q.canceled, Evicted: q.evicted}
+	q.mu.Unlock()
+	for i := len(history) - 1; i >= 0; i-- {
+		st.Jobs = append(st.Jobs, q.snapshot(history[i]))
+	}
+	return st
+}
+
+// fetch runs params through the queue for an HTTP caller, setting the job
+// headers on success and writing the error response otherwise.
+func (q *JobQueue) fetch(w http.ResponseWriter, r *http.Request, params map[string]interface{}) ([]byte, bool) {
+	job, err := q.Submit(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return nil, false
+	}
+	snap := q.snapshot(job)
+	defer q.Release(job)
+	stl, err := q.Wait(r.Context(), job)
+	if err != nil {
+		if r.Context().Err() == nil {
+			http.Error(w, fmt.Sprintf("Generation failed: %v", err), http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	cache := "miss"
+	switch {
+	case snap.Cached:
+		cache = "hit"
+	case snap.Waiters > 1:
+		cache = "shared"
+	}
+	w.Header().Set("X-CAD-Job", job.ID)
+	w.Header().Set("X-CAD-Cache", cache)
+	return stl, true
+}
+
+// HandleJobs serves /api/cad/jobs (GET list, POST submit) and
+// /api/cad/jobs/{id}[/stl] (GET status or result, DELETE cancel).
+func (q *JobQueue) HandleJobs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/cad/jobs"), "/")
+		if rest == "" {
+			switch r.Method {
+			case http.MethodGet:
+				writeJSON(w, http.StatusOK, q.Status())
+			case http.MethodPost:
+				var params map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+					http.Error(w, "Invalid request body", http.StatusBadRequest)
+					return
+				}
+				job, err := q.Submit(params)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusServiceUnavailable)
+					return
+				}
+				q.Detach(job)
+				snap := q.snapshot(job)
+				status := http.StatusAccepted
+				if snap.finished() {
+					status = http.StatusOK
+				}
+				writeJSON(w, status, snap)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+		id, sub, _ := strings.Cut(rest, "/")
+		q.mu.Lock()
+		job := q.lookupLocked(id)
+		q.mu.Unlock()
+		if job == nil {
+			http.Error(w, "unknown job", http.StatusNotFound)
+			return
+		}
+		switch {
+		case r.Method == http.MethodDelete && sub == "", r.Method == http.MethodPost && sub == "cancel":
+			q.Cancel(id)
+			writeJSON(w, http.StatusOK, q.snapshot(job))
+		case r.Method == http.MethodGet && sub == "":
+			writeJSON(w, http.StatusOK, q.snapshot(job))
+		case r.Method == http.MethodGet && sub == "stl":
+			if snap := q.snapshot(job); snap.State != JobDone {
+				http.Error(w, "job is "+snap.State, http.StatusConflict)
+				return
+			}
+			stl, err := q.Result(job)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusGone)
+				return
+			}
+			w.Header().Set("Content-Type", "application/sla")
+			_, _ = w.Write(stl)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
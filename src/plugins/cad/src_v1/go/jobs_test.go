@@ -0,0 +1,282 @@
+package cad
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dialtone/dev/plugins/cad/src_v1/go/mesh"
+)
+
+type fakeGenerator struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (g *fakeGenerator) generate(ctx context.Context, params map[string]interface{}, progress func(string)) ([]byte, error) {
+	g.calls.Add(1)
+	progress("[INFO] building gear")
+	if g.release != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-g.release:
+		}
+	}
+	return []byte("solid gear\nendsolid gear\n"), nil
+}
+
+func TestCanonicalKeyNormalizesParameters(t *testing.T) {
+	a := CanonicalKey(CADObject{Type: "gear", Parameters: map[string]interface{}{"num_teeth": 20.0, "thickness": 8.0}}, "")
+	b := CanonicalKey(CADObject{Type: "Gear", Parameters: map[string]interface{}{"thickness": "8", "num_teeth": 20}}, "")
+	if a != b {
+		t.Fatalf("equivalent parameters produced different keys: %s %s", a, b)
+	}
+	if c := CanonicalKey(CADObject{Type: "gear", Parameters: map[string]interface{}{"num_teeth": 21.0, "thickness": 8.0}}, ""); c == a {
+		t.Fatalf("different parameters produced the same key")
+	}
+	if d := CanonicalKey(CADObject{Type: "gear", Parameters: map[string]interface{}{"num_teeth": 20.0, "thickness": 8.0}}, "v2"); d == a {
+		t.Fatalf("salt did not change the key")
+	}
+}
+
+func TestJobQueueSharesInFlightJobsAndCachesResults(t *testing.T) {
+	gen := &fakeGenerator{release: make(chan struct{})}
+	dir := t.TempDir()
+	queue := NewJobQueue(JobQueueOptions{CacheDir: dir, Generate: gen.generate})
+	params := map[string]interface{}{"num_teeth": 20.0}
+
+	var wg sync.WaitGroup
+	results := make([][]byte, 4)
+	for i := range results {
+		job, err := queue.Submit(params)
+		if err != nil {
+			t.Fatalf("Submit returned error: %v", err)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer queue.Release(job)
+			results[i], _ = queue.Wait(context.Background(), job)
+		}(i)
+	}
+	close(gen.release)
+	wg.Wait()
+	if n := gen.calls.Load(); n != 1 {
+		t.Fatalf("generator ran %d times, want 1", n)
+	}
+	for i, stl := range results {
+		if !bytes.HasPrefix(stl, []byte("solid gear")) {
+			t.Fatalf("waiter %d got %q", i, stl)
+		}
+	}
+
+	// A fresh queue over the same directory serves the result from disk.
+	again := NewJobQueue(JobQueueOptions{CacheDir: dir, Generate: gen.generate})
+	job, err := again.Submit(map[string]interface{}{"num_teeth": "20"})
+	if err != nil {
+		t.Fatalf("Submit returned error: %v", err)
+	}
+	if snap := again.snapshot(job); !snap.Cached || snap.State != JobDone {
+		t.Fatalf("expected cache hit, got %+v", snap)
+	}
+	if n := gen.calls.Load(); n != 1 {
+		t.Fatalf("cache hit ran the generator again (%d calls)", n)
+	}
+}
+
+func TestJobQueueKeysByPartKind(t *testing.T) {
+	gen := &fakeGenerator{}
+	dir := t.TempDir()
+	params := map[string]interface{}{"num_teeth": 20.0}
+	gears := NewJobQueue(JobQueueOptions{CacheDir: dir, Generate: gen.generate})
+	job, _ := gears.Submit(params)
+	if _, err := gears.Wait(context.Background(), job); err != nil {
+		t.Fatalf("Wait returned error: %v", err)
+	}
+	gears.Release(job)
+	if job.Kind != DefaultPartKind {
+		t.Fatalf("expected default kind %q, got %q", DefaultPartKind, job.Kind)
+	}
+
+	pulleys := NewJobQueue(JobQueueOptions{CacheDir: dir, Kind: "pulley", Generate: gen.generate})
+	other, _ := pulleys.Submit(params)
+	defer pulleys.Release(other)
+	if other.Key == job.Key || pulleys.snapshot(other).Cached {
+		t.Fatalf("a different part kind reused the gear STL: %+v", pulleys.snapshot(other))
+	}
+}
+
+func TestJobQueueEvictsLeastRecentlyUsedSTLs(t *testing.T) {
+	gen := &fakeGenerator{}
+	dir := t.TempDir()
+	// Each fake STL is 25 bytes, so the cap holds two of them.
+	queue := NewJobQueue(JobQueueOptions{CacheDir: dir, MaxCacheBytes: 60, Generate: gen.generate})
+	generate := func(teeth float64) *Job {
+		t.Helper()
+		job, err := queue.Submit(map[string]interface{}{"num_teeth": teeth})
+		if err != nil {
+			t.Fatalf("Submit returned error: %v", err)
+		}
+		defer queue.Release(job)
+		if _, err := queue.Wait(context.Background(), job); err != nil {
+			t.Fatalf("Wait returned error: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		return job
+	}
+	first := generate(10)
+	second := generate(12)
+	generate(10) // a cache hit marks the first STL as recently used
+	third := generate(14)
+
+	for job, want := range map[*Job]bool{first: true, second: false, third: true} {
+		if _, err := os.Stat(queue.cachePath(job.Key)); (err == nil) != want {
+			t.Fatalf("job %s cached=%v, want %v", job.ID, err == nil, want)
+		}
+	}
+	if st := queue.Status(); st.Evicted != 1 || st.Hits != 1 {
+		t.Fatalf("unexpected status: evicted=%d hits=%d", st.Evicted, st.Hits)
+	}
+}
+
+func TestJobQueueCancelsWhenLastWaiterLeaves(t *testing.T) {
+	gen := &fakeGenerator{release: make(chan struct{})}
+	queue := NewJobQueue(JobQueueOptions{Workers: 1, CacheDir: t.TempDir(), Generate: gen.generate})
+
+	running, _ := queue.Submit(map[string]interface{}{"num_teeth": 10.0})
+	queued, _ := queue.Submit(map[string]interface{}{"num_teeth": 12.0})
+	if snap := queue.snapshot(queued); snap.State != JobQueued || snap.Position != 1 {
+		t.Fatalf("expected queued at position 1, got %+v", snap)
+	}
+	queue.Release(queued)
+	if snap := queue.snapshot(queued); snap.State != JobCanceled {
+		t.Fatalf("queued job not canceled: %+v", snap)
+	}
+
+	shared, _ := queue.Submit(map[string]interface{}{"num_teeth": 10.0})
+	queue.Release(running)
+	if snap := queue.snapshot(running); snap.State != JobRunning {
+		t.Fatalf("job canceled while a waiter remained: %+v", snap)
+	}
+	queue.Release(shared)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := queue.Wait(ctx, running); err != context.Canceled {
+		t.Fatalf("expected canceled running job, got %v", err)
+	}
+	if n := gen.calls.Load(); n != 1 {
+		t.Fatalf("canceled queued job still ran (%d calls)", n)
+	}
+}
+
+func TestJobHandlersSubmitPollAndFetch(t *testing.T) {
+	gen := &fakeGenerator{}
+	queue := NewJobQueue(JobQueueOptions{CacheDir: t.TempDir(), Generate: gen.generate})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/cad/generate", HandleGenerate(queue))
+	mux.HandleFunc("/api/cad/jobs", queue.HandleJobs())
+	mux.HandleFunc("/api/cad/jobs/", queue.HandleJobs())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	body := []byte(`{"num_teeth":20,"thickness":8}`)
+	resp, err := http.Post(srv.URL+"/api/cad/jobs", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("submit failed: %v", err)
+	}
+	var job Job
+	_ = json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if job.ID == "" {
+		t.Fatalf("submit returned no job id (status %d)", resp.StatusCode)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.State != JobDone && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		resp, err := http.Get(srv.URL + "/api/cad/jobs/" + job.ID)
+		if err != nil {
+			t.Fatalf("status failed: %v", err)
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&job)
+		resp.Body.Close()
+	}
+	if job.State != JobDone || job.Message != "[INFO] building gear" {
+		t.Fatalf("unexpected job status: %+v", job)
+	}
+
+	resp, err = http.Get(srv.URL + "/api/cad/jobs/" + job.ID + "/stl")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("fetch stl failed: %v %v", err, resp)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Post(srv.URL+"/api/cad/generate", "application/json", bytes.NewReader([]byte(`{"thickness":"8","num_teeth":"20"}`)))
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-CAD-Cache") != "hit" || resp.Header.Get("Content-Type") != "application/sla" {
+		t.Fatalf("unexpected generate response: %d %v", resp.StatusCode, resp.Header)
+	}
+	if n := gen.calls.Load(); n != 1 {
+		t.Fatalf("generator ran %d times, want 1", n)
+	}
+}
+
+func TestMeshMetadataAndExportHandlers(t *testing.T) {
+	a, b, c, d := mesh.Vec3{}, mesh.Vec3{X: 1}, mesh.Vec3{Y: 1}, mesh.Vec3{Z: 1}
+	tetra := &mesh.Mesh{Triangles: []mesh.Triangle{
+		{Vertices: [3]mesh.Vec3{a, c, b}},
+		{Vertices: [3]mesh.Vec3{a, b, d}},
+		{Vertices: [3]mesh.Vec3{a, d, c}},
+		{Vertices: [3]mesh.Vec3{b, c, d}},
+	}}
+	var stl bytes.Buffer
+	if err := mesh.WriteBinarySTL(&stl, tetra); err != nil {
+		t.Fatal(err)
+	}
+	queue := NewJobQueue(JobQueueOptions{CacheDir: t.TempDir(), Generate: func(context.Context, map[string]interface{}, func(string)) ([]byte, error) {
+		return stl.Bytes(), nil
+	}})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/metadata", HandleMeshMetadata(queue))
+	mux.HandleFunc("/api/cad/download", HandleDownload(queue))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/metadata?num_teeth=20")
+	if err != nil {
+		t.Fatalf("metadata failed: %v", err)
+	}
+	var meta struct {
+		Mesh mesh.Report `json:"mesh"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&meta)
+	resp.Body.Close()
+	if meta.Mesh.Triangles != 4 || !meta.Mesh.Printable {
+		t.Fatalf("unexpected mesh report: %+v", meta.Mesh)
+	}
+
+	for format, contentType := range map[string]string{"3mf": "model/3mf", "obj": "model/obj", "stl-ascii": "application/sla"} {
+		resp, err := http.Get(srv.URL + "/api/cad/download?num_teeth=20&format=" + format)
+		if err != nil {
+			t.Fatalf("download %s failed: %v", format, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != contentType {
+			t.Fatalf("download %s: %d %v", format, resp.StatusCode, resp.Header)
+		}
+	}
+	if resp, err := http.Get(srv.URL + "/api/cad/download?format=step"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown format, got %v %v", resp, err)
+	}
+}
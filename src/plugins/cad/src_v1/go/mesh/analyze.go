@@ -0,0 +1,110 @@
+package mesh
+
+import (
+	"fmt"
+	"math"
+)
+
+type Bounds struct {
+	Min  Vec3 `json:"min"`
+	Max  Vec3 `json:"max"`
+	Size Vec3 `json:"size"`
+}
+
+type Report struct {
+	Triangles           int      `json:"triangles"`
+	Vertices            int      `json:"vertices"`
+	Bounds              Bounds   `json:"bounds"`
+	Volume              float64  `json:"volume"`
+	SurfaceArea         float64  `json:"surface_area"`
+	Watertight          bool     `json:"watertight"`
+	Manifold            bool     `json:"manifold"`
+	BoundaryEdges       int      `json:"boundary_edges"`
+	NonManifoldEdges    int      `json:"non_manifold_edges"`
+	FlippedEdges        int      `json:"flipped_edges"`
+	DegenerateTriangles int      `json:"degenerate_triangles"`
+	InvertedNormals     bool     `json:"inverted_normals"`
+	Printable           bool     `json:"printable"`
+	Warnings            []string `json:"warnings,omitempty"`
+}
+
+// Analyze measures the mesh and checks it for the defects slicers reject.
+// An edge shared by exactly two faces with opposite winding is closed and
+// consistently oriented; one face is a hole, more than two is non-manifold.
+func Analyze(m *Mesh) Report {
+	r := Report{Triangles: len(m.Triangles)}
+	if len(m.Triangles) == 0 {
+		r.Warnings = []string{"mesh has no triangles"}
+		return r
+	}
+	idx := m.Index()
+	r.Vertices = len(idx.Vertices)
+
+	inf := math.Inf(1)
+	r.Bounds.Min = Vec3{inf, inf, inf}
+	r.Bounds.Max = Vec3{-inf, -inf, -inf}
+	for _, v := range idx.Vertices {
+		r.Bounds.Min = Vec3{math.Min(r.Bounds.Min.X, v.X), math.Min(r.Bounds.Min.Y, v.Y), math.Min(r.Bounds.Min.Z, v.Z)}
+		r.Bounds.Max = Vec3{math.Max(r.Bounds.Max.X, v.X), math.Max(r.Bounds.Max.Y, v.Y), math.Max(r.Bounds.Max.Z, v.Z)}
+	}
+	r.Bounds.Size = r.Bounds.Max.Sub(r.Bounds.Min)
+
+	type edge [2]int
+	undirected := map[edge]int{}
+	directed := map[edge]int{}
+	signedVolume := 0.0
+	for _, f := range idx.Faces {
+		a, b, c := idx.Vertices[f[0]], idx.Vertices[f[1]], idx.Vertices[f[2]]
+		area := b.Sub(a).Cross(c.Sub(a)).Len() / 2
+		if area == 0 || f[0] == f[1] || f[1] == f[2] || f[0] == f[2] {
+			r.DegenerateTriangles++
+			continue
+		}
+		r.SurfaceArea += area
+		signedVolume += a.Dot(b.Cross(c)) / 6
+		for i := 0; i < 3; i++ {
+			from, to := f[i], f[(i+1)%3]
+			directed[edge{from, to}]++
+			if from > to {
+				from, to = to, from
+			}
+			undirected[edge{from, to}]++
+		}
+	}
+	for e, n := range undirected {
+		switch {
+		case n == 1:
+			r.BoundaryEdges++
+		case n > 2:
+			r.NonManifoldEdges++
+		case directed[e] != 1:
+			// Both faces walk the edge the same way, so one is flipped.
+			r.FlippedEdges++
+		}
+	}
+	r.Volume = math.Abs(signedVolume)
+	r.Watertight = r.BoundaryEdges == 0 && r.NonManifoldEdges == 0
+	r.Manifold = r.NonManifoldEdges == 0 && r.FlippedEdges == 0
+	r.InvertedNormals = r.Watertight && r.FlippedEdges == 0 && signedVolume < 0
+
+	if r.BoundaryEdges > 0 {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("mesh is not watertight: %d open edges", r.BoundaryEdges))
+	}
+	if r.NonManifoldEdges > 0 {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("%d edges are shared by more than two faces", r.NonManifoldEdges))
+	}
+	if r.FlippedEdges > 0 {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("%d edges join faces with inconsistent winding", r.FlippedEdges))
+	}
+	if r.InvertedNormals {
+		r.Warnings = append(r.Warnings, "faces are wound inside-out")
+	}
+	if r.DegenerateTriangles > 0 {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("%d degenerate triangles", r.DegenerateTriangles))
+	}
+	if r.Watertight && r.Volume == 0 {
+		r.Warnings = append(r.Warnings, "mesh encloses no volume")
+	}
+	r.Printable = r.Watertight && r.Manifold && !r.InvertedNormals && r.Volume > 0
+	return r
+}
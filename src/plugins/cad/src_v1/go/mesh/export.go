@@ -0,0 +1,207 @@
+package mesh
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatSTL      Format = "stl"
+	FormatSTLASCII Format = "stl-ascii"
+	Format3MF      Format = "3mf"
+	FormatOBJ      Format = "obj"
+)
+
+var Formats = []Format{FormatSTL, FormatSTLASCII, Format3MF, FormatOBJ}
+
+// ParseFormat accepts the names above plus "stl-binary" and "ascii".
+func ParseFormat(raw string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "", "stl", "stl-binary", "binary":
+		return FormatSTL, nil
+	case "stl-ascii", "ascii":
+		return FormatSTLASCII, nil
+	case "3mf":
+		return Format3MF, nil
+	case "obj":
+		return FormatOBJ, nil
+	}
+	return "", fmt.Errorf("unsupported mesh format %q (want stl, stl-ascii, 3mf or obj)", raw)
+}
+
+func (f Format) Extension() string {
+	if f == FormatSTLASCII {
+		return "stl"
+	}
+	return string(f)
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case Format3MF:
+		return "model/3mf"
+	case FormatOBJ:
+		return "model/obj"
+	default:
+		return "application/sla"
+	}
+}
+
+func Encode(w io.Writer, m *Mesh, f Format) error {
+	switch f {
+	case FormatSTL:
+		return WriteBinarySTL(w, m)
+	case FormatSTLASCII:
+		return WriteASCIISTL(w, m)
+	case Format3MF:
+		return Write3MF(w, m)
+	case FormatOBJ:
+		return WriteOBJ(w, m)
+	}
+	return fmt.Errorf("unsupported mesh format %q", f)
+}
+
+func (m *Mesh) name() string {
+	if strings.TrimSpace(m.Name) == "" {
+		return "dialtone"
+	}
+	return strings.TrimSpace(m.Name)
+}
+
+func WriteBinarySTL(w io.Writer, m *Mesh) error {
+	header := make([]byte, 84)
+	copy(header, "binary STL "+m.name())
+	binary.LittleEndian.PutUint32(header[80:], uint32(len(m.Triangles)))
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+	rec := make([]byte, 50)
+	put := func(off int, v Vec3) {
+		binary.LittleEndian.PutUint32(rec[off:], math.Float32bits(float32(v.X)))
+		binary.LittleEndian.PutUint32(rec[off+4:], math.Float32bits(float32(v.Y)))
+		binary.LittleEndian.PutUint32(rec[off+8:], math.Float32bits(float32(v.Z)))
+	}
+	for _, t := range m.Triangles {
+		put(0, faceNormal(t))
+		for i, v := range t.Vertices {
+			put(12+12*i, v)
+		}
+		if _, err := bw.Write(rec); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func WriteASCIISTL(w io.Writer, m *Mesh) error {
+	bw := bufio.NewWriter(w)
+	name := m.name()
+	fmt.Fprintf(bw, "solid %s\n", name)
+	for _, t := range m.Triangles {
+		n := faceNormal(t)
+		fmt.Fprintf(bw, "  facet normal %s %s %s\n    outer loop\n", num(n.X), num(n.Y), num(n.Z))
+		for _, v := range t.Vertices {
+			fmt.Fprintf(bw, "      vertex %s %s %s\n", num(v.X), num(v.Y), num(v.Z))
+		}
+		bw.WriteString("    endloop\n  endfacet\n")
+	}
+	fmt.Fprintf(bw, "endsolid %s\n", name)
+	return bw.Flush()
+}
+
+func WriteOBJ(w io.Writer, m *Mesh) error {
+	idx := m.Index()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "o %s\n", m.name())
+	for _, v := range idx.Vertices {
+		fmt.Fprintf(bw, "v %s %s %s\n", num(v.X), num(v.Y), num(v.Z))
+	}
+	for _, f := range idx.Faces {
+		fmt.Fprintf(bw, "f %d %d %d\n", f[0]+1, f[1]+1, f[2]+1)
+	}
+	return bw.Flush()
+}
+
+const threeMFContentTypes = `<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+  <Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+  <Default Extension="model" ContentType="application/vnd.ms-package.3dmanufacturing-3dmodel+xml"/>
+</Types>
+`
+
+const threeMFRels = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Target="/3D/3dmodel.model" Id="rel0" Type="http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"/>
+</Relationships>
+`
+
+// Write3MF writes a single-object 3MF package in millimetres.
+func Write3MF(w io.Writer, m *Mesh) error {
+	zw := zip.NewWriter(w)
+	for _, part := range []struct{ name, body string }{
+		{"[Content_Types].xml", threeMFContentTypes},
+		{"_rels/.rels", threeMFRels},
+	} {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return err
+		}
+	}
+	f, err := zw.Create("3D/3dmodel.model")
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	idx := m.Index()
+	bw.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	bw.WriteString(`<model unit="millimeter" xml:lang="en-US" xmlns="http://schemas.microsoft.com/3dmanufacturing/core/2015/02">` + "\n")
+	fmt.Fprintf(bw, "  <resources>\n    <object id=\"1\" name=\"%s\" type=\"model\">\n      <mesh>\n        <vertices>\n", xmlEscape(m.name()))
+	for _, v := range idx.Vertices {
+		fmt.Fprintf(bw, "          <vertex x=\"%s\" y=\"%s\" z=\"%s\"/>\n", num(v.X), num(v.Y), num(v.Z))
+	}
+	bw.WriteString("        </vertices>\n        <triangles>\n")
+	for _, t := range idx.Faces {
+		fmt.Fprintf(bw, "          <triangle v1=\"%d\" v2=\"%d\" v3=\"%d\"/>\n", t[0], t[1], t[2])
+	}
+	bw.WriteString("        </triangles>\n      </mesh>\n    </object>\n  </resources>\n")
+	bw.WriteString("  <build>\n    <item objectid=\"1\"/>\n  </build>\n</model>\n")
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func num(f float64) string {
+	return strconv.FormatFloat(f, 'g', 9, 64)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '"':
+			b.WriteString("&quot;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,189 @@
+package mesh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type Vec3 struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+func (a Vec3) Sub(b Vec3) Vec3 { return Vec3{a.X - b.X, a.Y - b.Y, a.Z - b.Z} }
+
+func (a Vec3) Cross(b Vec3) Vec3 {
+	return Vec3{a.Y*b.Z - a.Z*b.Y, a.Z*b.X - a.X*b.Z, a.X*b.Y - a.Y*b.X}
+}
+
+func (a Vec3) Dot(b Vec3) float64 { return a.X*b.X + a.Y*b.Y + a.Z*b.Z }
+
+func (a Vec3) Len() float64 { return math.Sqrt(a.Dot(a)) }
+
+type Triangle struct {
+	Normal   Vec3
+	Vertices [3]Vec3
+}
+
+// Mesh is a triangle soup as read from STL; Index welds shared vertices.
+type Mesh struct {
+	Name      string
+	Triangles []Triangle
+}
+
+// Parse reads binary or ASCII STL. Binary files may also begin with
+// "solid", so the size implied by the triangle count decides first.
+func Parse(data []byte) (*Mesh, error) {
+	if len(data) >= 84 {
+		count := binary.LittleEndian.Uint32(data[80:84])
+		if uint64(len(data)) == 84+50*uint64(count) {
+			return parseBinary(data)
+		}
+	}
+	if bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("solid")) {
+		return parseASCII(data)
+	}
+	if len(data) >= 84 {
+		return parseBinary(data)
+	}
+	return nil, fmt.Errorf("stl: %d bytes is too short", len(data))
+}
+
+func parseBinary(data []byte) (*Mesh, error) {
+	count := binary.LittleEndian.Uint32(data[80:84])
+	if uint64(len(data)) < 84+50*uint64(count) {
+		return nil, fmt.Errorf("stl: header declares %d triangles but only %d bytes follow", count, len(data)-84)
+	}
+	m := &Mesh{Name: strings.TrimRight(string(bytes.TrimPrefix(data[:80], []byte("solid "))), "\x00 "), Triangles: make([]Triangle, count)}
+	readVec := func(off int) Vec3 {
+		f := func(i int) float64 {
+			return float64(math.Float32frombits(binary.LittleEndian.Uint32(data[off+4*i:])))
+		}
+		return Vec3{f(0), f(1), f(2)}
+	}
+	for i := range m.Triangles {
+		off := 84 + 50*i
+		m.Triangles[i] = Triangle{
+			Normal:   readVec(off),
+			Vertices: [3]Vec3{readVec(off + 12), readVec(off + 24), readVec(off + 36)},
+		}
+	}
+	return m, nil
+}
+
+func parseASCII(data []byte) (*Mesh, error) {
+	m := &Mesh{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var tri Triangle
+	verts := 0
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "solid":
+			if line == 1 || m.Name == "" {
+				m.Name = strings.TrimSpace(strings.Join(fields[1:], " "))
+			}
+		case "facet":
+			if len(fields) != 5 || fields[1] != "normal" {
+				return nil, fmt.Errorf("stl line %d: malformed facet", line)
+			}
+			n, err := parseVec(fields[2:])
+			if err != nil {
+				return nil, fmt.Errorf("stl line %d: %w", line, err)
+			}
+			tri = Triangle{Normal: n}
+			verts = 0
+		case "vertex":
+			if len(fields) != 4 || verts >= 3 {
+				return nil, fmt.Errorf("stl line %d: malformed vertex", line)
+			}
+			v, err := parseVec(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("stl line %d: %w", line, err)
+			}
+			tri.Vertices[verts] = v
+			verts++
+		case "endfacet":
+			if verts != 3 {
+				return nil, fmt.Errorf("stl line %d: facet has %d vertices", line, verts)
+			}
+			m.Triangles = append(m.Triangles, tri)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func parseVec(fields []string) (Vec3, error) {
+	var out [3]float64
+	for i := range out {
+		f, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return Vec3{}, fmt.Errorf("bad coordinate %q", fields[i])
+		}
+		out[i] = f
+	}
+	return Vec3{out[0], out[1], out[2]}, nil
+}
+
+// Indexed is a welded mesh: Faces index into Vertices.
+type Indexed struct {
+	Vertices []Vec3
+	Faces    [][3]int
+}
+
+// weldTolerance merges STL vertices that differ only by float32 rounding.
+const weldTolerance = 1e-5
+
+// Index welds vertices that fall within weldTolerance of each other.
+func (m *Mesh) Index() Indexed {
+	out := Indexed{Faces: make([][3]int, 0, len(m.Triangles))}
+	seen := map[[3]int64]int{}
+	key := func(v Vec3) [3]int64 {
+		return [3]int64{
+			int64(math.Round(v.X / weldTolerance)),
+			int64(math.Round(v.Y / weldTolerance)),
+			int64(math.Round(v.Z / weldTolerance)),
+		}
+	}
+	for _, tri := range m.Triangles {
+		var face [3]int
+		for i, v := range tri.Vertices {
+			k := key(v)
+			idx, ok := seen[k]
+			if !ok {
+				idx = len(out.Vertices)
+				seen[k] = idx
+				out.Vertices = append(out.Vertices, v)
+			}
+			face[i] = idx
+		}
+		out.Faces = append(out.Faces, face)
+	}
+	return out
+}
+
+// faceNormal returns the unit normal from the winding, or zero for a
+// degenerate triangle.
+func faceNormal(t Triangle) Vec3 {
+	n := t.Vertices[1].Sub(t.Vertices[0]).Cross(t.Vertices[2].Sub(t.Vertices[0]))
+	l := n.Len()
+	if l == 0 {
+		return Vec3{}
+	}
+	return Vec3{n.X / l, n.Y / l, n.Z / l}
+}
@@ -0,0 +1,126 @@
+package mesh
+
+import (
+	"archive/zip"
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+// unitCube returns a closed, outward-wound cube with side s.
+func unitCube(s float64) *Mesh {
+	v := func(x, y, z float64) Vec3 { return Vec3{x * s, y * s, z * s} }
+	quads := [][4]Vec3{
+		{v(0, 0, 0), v(0, 1, 0), v(1, 1, 0), v(1, 0, 0)}, // bottom
+		{v(0, 0, 1), v(1, 0, 1), v(1, 1, 1), v(0, 1, 1)}, // top
+		{v(0, 0, 0), v(1, 0, 0), v(1, 0, 1), v(0, 0, 1)}, // front
+		{v(0, 1, 0), v(0, 1, 1), v(1, 1, 1), v(1, 1, 0)}, // back
+		{v(0, 0, 0), v(0, 0, 1), v(0, 1, 1), v(0, 1, 0)}, // left
+		{v(1, 0, 0), v(1, 1, 0), v(1, 1, 1), v(1, 0, 1)}, // right
+	}
+	m := &Mesh{Name: "cube"}
+	for _, q := range quads {
+		m.Triangles = append(m.Triangles,
+			Triangle{Vertices: [3]Vec3{q[0], q[1], q[2]}},
+			Triangle{Vertices: [3]Vec3{q[0], q[2], q[3]}},
+		)
+	}
+	return m
+}
+
+func TestAnalyzeClosedCube(t *testing.T) {
+	r := Analyze(unitCube(10))
+	if r.Triangles != 12 || r.Vertices != 8 {
+		t.Fatalf("unexpected counts: %+v", r)
+	}
+	if math.Abs(r.Volume-1000) > 1e-6 || math.Abs(r.SurfaceArea-600) > 1e-6 {
+		t.Fatalf("volume=%v area=%v", r.Volume, r.SurfaceArea)
+	}
+	if r.Bounds.Size != (Vec3{10, 10, 10}) {
+		t.Fatalf("unexpected bounds: %+v", r.Bounds)
+	}
+	if !r.Watertight || !r.Manifold || !r.Printable || len(r.Warnings) != 0 {
+		t.Fatalf("closed cube should be printable: %+v", r)
+	}
+}
+
+func TestAnalyzeReportsDefects(t *testing.T) {
+	open := unitCube(1)
+	open.Triangles = open.Triangles[1:]
+	if r := Analyze(open); r.Watertight || r.Printable || r.BoundaryEdges != 3 {
+		t.Fatalf("open cube: %+v", r)
+	}
+
+	flipped := unitCube(1)
+	tri := flipped.Triangles[0].Vertices
+	flipped.Triangles[0].Vertices = [3]Vec3{tri[0], tri[2], tri[1]}
+	if r := Analyze(flipped); r.Manifold || r.Printable || r.FlippedEdges == 0 {
+		t.Fatalf("flipped face: %+v", r)
+	}
+
+	inverted := unitCube(1)
+	for i, tri := range inverted.Triangles {
+		inverted.Triangles[i].Vertices = [3]Vec3{tri.Vertices[0], tri.Vertices[2], tri.Vertices[1]}
+	}
+	if r := Analyze(inverted); !r.InvertedNormals || r.Printable {
+		t.Fatalf("inside-out cube: %+v", r)
+	}
+}
+
+func TestExportRoundTrips(t *testing.T) {
+	cube := unitCube(2)
+	for _, f := range []Format{FormatSTL, FormatSTLASCII} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, cube, f); err != nil {
+			t.Fatalf("%s encode: %v", f, err)
+		}
+		parsed, err := Parse(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%s parse: %v", f, err)
+		}
+		if r := Analyze(parsed); r.Triangles != 12 || math.Abs(r.Volume-8) > 1e-6 || !r.Printable {
+			t.Fatalf("%s round trip: %+v", f, r)
+		}
+	}
+
+	var obj bytes.Buffer
+	if err := WriteOBJ(&obj, cube); err != nil {
+		t.Fatal(err)
+	}
+	if v, f := strings.Count(obj.String(), "\nv "), strings.Count(obj.String(), "\nf "); v != 8 || f != 12 {
+		t.Fatalf("obj has %d vertices and %d faces", v, f)
+	}
+
+	var pkg bytes.Buffer
+	if err := Write3MF(&pkg, cube); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(pkg.Bytes()), int64(pkg.Len()))
+	if err != nil {
+		t.Fatalf("3mf is not a zip: %v", err)
+	}
+	names := map[string]bool{}
+	for _, f := range zr.File {
+		names[f.Name] = true
+	}
+	if !names["[Content_Types].xml"] || !names["_rels/.rels"] || !names["3D/3dmodel.model"] {
+		t.Fatalf("3mf parts: %v", names)
+	}
+}
+
+func TestParseBinaryWithSolidHeader(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteBinarySTL(&buf, unitCube(1)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	copy(data, "solid cube exported by a tool that lies")
+	m, err := Parse(data)
+	if err != nil || len(m.Triangles) != 12 {
+		t.Fatalf("binary stl with solid header: %v %v", m, err)
+	}
+	if _, err := ParseFormat("step"); err == nil {
+		t.Fatalf("expected unsupported format error")
+	}
+}
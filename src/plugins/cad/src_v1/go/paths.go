@@ -14,6 +14,7 @@ type Paths struct {
 	StateDir    string
 	ServerPID   string
 	ServerMeta  string
+	STLCacheDir string
 }
 
 func ResolvePaths(start, version string) (Paths, error) {
@@ -35,5 +36,6 @@ func ResolvePaths(start, version string) (Paths, error) {
 		StateDir:    configv1.RepoPath(rt, ".dialtone", "cad", version),
 		ServerPID:   configv1.RepoPath(rt, ".dialtone", "cad", version, "server.pid"),
 		ServerMeta:  configv1.RepoPath(rt, ".dialtone", "cad", version, "server.json"),
+		STLCacheDir: configv1.RepoPath(rt, ".dialtone", "cad", version, "stl-cache"),
 	}, nil
 }
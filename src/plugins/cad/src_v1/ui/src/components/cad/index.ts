@@ -347,6 +347,7 @@ class CadStage implements VisualizationControl {
       this.setStatus('Gear regenerated');
       this.lastGeneratedKey = requestKey;
       console.info(`cad-model-ready:${this.generationSeq}`);
+      void this.checkPrintable(requestKey);
     } catch (error) {
       if ((error as Error).name === 'AbortError') return;
       console.error('[cad/ui] regenerate failed', error);
@@ -367,6 +368,26 @@ class CadStage implements VisualizationControl {
     }
   }
 
+  private async checkPrintable(requestKey: string): Promise<void> {
+    try {
+      const response = await fetch(cadAPIURL('/api/metadata'), {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: requestKey,
+      });
+      if (!response.ok || requestKey !== this.lastGeneratedKey) return;
+      const meta = (await response.json()) as { mesh?: { printable?: boolean; warnings?: string[] } };
+      this.stageStatus.setAttribute('data-printable', String(meta.mesh?.printable ?? false));
+      if (meta.mesh && !meta.mesh.printable) {
+        const warning = meta.mesh.warnings?.[0] ?? 'mesh is not printable';
+        console.warn(`[cad/ui] ${warning}`);
+        this.setStatus(`Not printable: ${warning}`);
+      }
+    } catch (error) {
+      console.warn('[cad/ui] mesh check failed', error);
+    }
+  }
+
   private applyGeometry(geometry: THREE.BufferGeometry): void {
     geometry.center();
     geometry.computeVertexNormals();
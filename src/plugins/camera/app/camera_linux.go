@@ -5,14 +5,11 @@ package camera
 import (
 	"context"
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
 
 	"dialtone/dev/plugins/logs/src_v1/go"
 	"github.com/vladimirvivien/go4vl/device"
@@ -68,29 +65,38 @@ func ListCameras() ([]Camera, error) {
 	return cameras, nil
 }
 
-var (
-	camDev               *device.Device
-	camFrames            <-chan *device.Frame
-	camMu                sync.Mutex
-	lastAutoStartAttempt time.Time
-	lastAutoStartLogAt   time.Time
-	autoStartBackoff     = 2 * time.Second
-	autoStartLogThrottle = 10 * time.Second
-)
-
-// StartCamera initializes the camera if not already started.
-func StartCamera(ctx context.Context, devName string) error {
-	camMu.Lock()
-	defer camMu.Unlock()
+type v4l2Source struct {
+	devName string
+	dev     *device.Device
+	frames  <-chan *device.Frame
+}
 
-	if camDev != nil {
-		return nil
+// openV4L2Source opens devName, or the first usable capture device when empty.
+func openV4L2Source(ctx context.Context, devName string) (FrameSource, error) {
+	candidates := []string{devName}
+	if strings.TrimSpace(devName) == "" {
+		candidates = candidateDevices()
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("no usable camera capture devices found")
+		}
 	}
+	var lastErr error
+	for _, candidate := range candidates {
+		src, err := startV4L2Device(ctx, candidate)
+		if err == nil {
+			return src, nil
+		}
+		LogInfo("Camera start failed for %s: %v", candidate, err)
+		lastErr = err
+	}
+	return nil, fmt.Errorf("failed to start camera from candidates %v: %w", candidates, lastErr)
+}
 
+func startV4L2Device(ctx context.Context, devName string) (*v4l2Source, error) {
 	LogInfo("Opening camera device %s...", devName)
 	cam, err := openCameraDevice(devName)
 	if err != nil {
-		return fmt.Errorf("failed to open device: %w", err)
+		return nil, fmt.Errorf("failed to open device: %w", err)
 	}
 
 	// Select frame-stream mode before Start(). go4vl creates channels at Start().
@@ -98,23 +104,42 @@ func StartCamera(ctx context.Context, devName string) error {
 
 	if err := cam.Start(ctx); err != nil {
 		cam.Close()
-		return fmt.Errorf("failed to start stream: %w", err)
+		return nil, fmt.Errorf("failed to start stream: %w", err)
 	}
 	frames := cam.GetFrames()
 	if frames == nil {
 		cam.Close()
-		return fmt.Errorf("camera frame channel unavailable after start")
+		return nil, fmt.Errorf("camera frame channel unavailable after start")
 	}
-
-	camDev = cam
-	camFrames = frames
 	LogInfo("Camera stream mode: frames")
 	go func(devName string, errs <-chan error) {
 		for err := range errs {
 			LogInfo("Camera stream error on %s: %v", devName, err)
 		}
 	}(devName, cam.GetError())
-	return nil
+	return &v4l2Source{devName: devName, dev: cam, frames: frames}, nil
+}
+
+func (s *v4l2Source) Name() string {
+	return SourceV4L2 + ":" + s.devName
+}
+
+func (s *v4l2Source) NextFrame(ctx context.Context) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case frame, ok := <-s.frames:
+		if !ok {
+			return nil, fmt.Errorf("frames channel closed")
+		}
+		data := append([]byte(nil), frame.Data...)
+		frame.Release()
+		return data, nil
+	}
+}
+
+func (s *v4l2Source) Close() error {
+	return s.dev.Close()
 }
 
 func openCameraDevice(devName string) (*device.Device, error) {
@@ -171,142 +196,6 @@ func openCameraDevice(devName string) (*device.Device, error) {
 	return nil, lastErr
 }
 
-// StopCamera cleans up the camera device
-// Added for compatibility with other plugins that might expect this
-func StopCamera() {
-	camMu.Lock()
-	defer camMu.Unlock()
-	if camDev != nil {
-		camDev.Close()
-		camDev = nil
-		camFrames = nil
-	}
-}
-
-// GetLatestFrame returns a nil frame for now, as this method does not keep a buffer
-// Added for compatibility with diagnostic checks if they remain
-func GetLatestFrame() ([]byte, time.Time) {
-	return nil, time.Time{}
-}
-
-// StreamHandler handles MJPEG streaming requests.
-func StreamHandler(w http.ResponseWriter, r *http.Request) {
-	// Auto-start logic with backoff to avoid hot-loop retries when camera is unavailable.
-	camMu.Lock()
-	if camDev == nil {
-		now := time.Now()
-		if now.Sub(lastAutoStartAttempt) < autoStartBackoff {
-			camMu.Unlock()
-		} else {
-			lastAutoStartAttempt = now
-			camMu.Unlock()
-			candidates := candidateDevices()
-			var lastErr error
-			if len(candidates) == 0 && now.Sub(lastAutoStartLogAt) >= autoStartLogThrottle {
-				LogInfo("No usable camera capture devices found")
-				lastAutoStartLogAt = now
-			}
-			for _, devName := range candidates {
-				LogInfo("Auto-starting camera %s...", devName)
-				// Keep camera lifetime independent from individual HTTP request lifecycle.
-				if err := StartCamera(context.Background(), devName); err != nil {
-					LogInfo("Auto-start failed for %s: %v", devName, err)
-					lastErr = err
-					continue
-				}
-				lastErr = nil
-				break
-			}
-			if lastErr != nil && now.Sub(lastAutoStartLogAt) >= autoStartLogThrottle {
-				LogInfo("Failed to auto-start camera from candidates %v: %v", candidates, lastErr)
-				lastAutoStartLogAt = now
-			}
-		}
-	} else {
-		camMu.Unlock()
-	}
-
-	camMu.Lock()
-	cam := camDev
-	frames := camFrames
-	camMu.Unlock()
-
-	if cam == nil || frames == nil {
-		http.Error(w, "Camera not initialized", http.StatusServiceUnavailable)
-		return
-	}
-
-	// Set headers for MJPEG
-	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
-	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, pre-check=0, post-check=0, max-age=0")
-	w.Header().Set("Pragma", "no-cache")
-	w.Header().Set("X-Content-Type-Options", "nosniff")
-	w.Header().Set("Connection", "close")
-
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		LogInfo("ResponseWriter does not support flushing")
-		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
-		return
-	}
-
-	LogInfo("Starting stream for %s", r.RemoteAddr)
-	flusher.Flush()
-
-	tryRestart := func() bool {
-		StopCamera()
-		for _, devName := range candidateDevices() {
-			LogInfo("Attempting camera restart on %s...", devName)
-			if err := StartCamera(context.Background(), devName); err != nil {
-				LogInfo("Camera restart failed on %s: %v", devName, err)
-				continue
-			}
-			camMu.Lock()
-			cam = camDev
-			frames = camFrames
-			camMu.Unlock()
-			if cam != nil && frames != nil {
-				return true
-			}
-		}
-		return false
-	}
-
-	for {
-		select {
-		case <-r.Context().Done():
-			LogInfo("Stream closed by client %s", r.RemoteAddr)
-			return
-		case frame, ok := <-frames:
-			if !ok {
-				LogInfo("Frames channel closed")
-				if tryRestart() {
-					continue
-				}
-				return
-			}
-			// Write the MJPEG boundary and frame metadata
-			_, err := fmt.Fprintf(w, "--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(frame.Data))
-			if err != nil {
-				LogInfo("Stream write error (header) for %s: %v", r.RemoteAddr, err)
-				frame.Release()
-				return
-			}
-
-			// Write the actual JPEG data
-			if _, err := w.Write(frame.Data); err != nil {
-				LogInfo("Stream write error (body) for %s: %v", r.RemoteAddr, err)
-				frame.Release()
-				return
-			}
-
-			_, _ = w.Write([]byte("\r\n"))
-			flusher.Flush()
-			frame.Release()
-		}
-	}
-}
-
 func candidateDevices() []string {
 	seen := map[string]struct{}{}
 	var candidates []string
@@ -4,8 +4,7 @@ package camera
 
 import (
 	"context"
-	"net/http"
-	"time"
+	"fmt"
 )
 
 // Camera info structure
@@ -19,21 +18,7 @@ func ListCameras() ([]Camera, error) {
 	return []Camera{}, nil
 }
 
-// StartCamera is a no-op on non-linux platforms.
-func StartCamera(ctx context.Context, devName string) error {
-	return nil
-}
-
-// StopCamera is a no-op on non-linux platforms.
-func StopCamera() {
-}
-
-// StreamHandler returns a not implemented error on non-linux platforms.
-func StreamHandler(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "Camera streaming is only supported on Linux", http.StatusNotImplemented)
-}
-
-// GetLatestFrame returns nil on non-linux platforms.
-func GetLatestFrame() ([]byte, time.Time) {
-	return nil, time.Time{}
+// openV4L2Source is unavailable on non-linux platforms; use another source.
+func openV4L2Source(ctx context.Context, devName string) (FrameSource, error) {
+	return nil, fmt.Errorf("v4l2 camera source is only supported on Linux (try --source synthetic)")
 }
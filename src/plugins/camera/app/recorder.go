@@ -0,0 +1,545 @@
+package camera
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logs "dialtone/dev/plugins/logs/src_v1/go"
+)
+
+const (
+	segmentExt        = ".mjpeg"
+	segmentBoundary   = "frame"
+	segmentTimeLayout = "20060102T150405.000Z"
+	bookmarksFile     = "bookmarks.json"
+)
+
+// RecorderConfig controls segment rotation and retention. Zero MaxAge,
+// MaxBytes, BookmarkMaxAge or MaxBookmarks disables that limit.
+type RecorderConfig struct {
+	Dir             string
+	SegmentDuration time.Duration
+	MaxAge          time.Duration
+	MaxBytes        int64
+	FPS             int
+	// Bookmarks older than BookmarkMaxAge, and the oldest beyond
+	// MaxBookmarks, are dropped along with their snapshots so they stop
+	// protecting footage.
+	BookmarkMaxAge time.Duration
+	MaxBookmarks   int
+}
+
+func DefaultRecorderConfig(dir string) RecorderConfig {
+	return RecorderConfig{
+		Dir:             dir,
+		SegmentDuration: time.Minute,
+		MaxAge:          24 * time.Hour,
+		MaxBytes:        2 << 30,
+		FPS:             5,
+		BookmarkMaxAge:  30 * 24 * time.Hour,
+		MaxBookmarks:    200,
+	}
+}
+
+// Segment is one recorded file. Segments are multipart MJPEG (the format
+// served by /stream, readable by ffmpeg as mpjpeg) with an X-Timestamp header
+// per frame so playback keeps the original timing.
+type Segment struct {
+	Name      string    `json:"name"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Bytes     int64     `json:"bytes"`
+	Active    bool      `json:"active"`
+	Protected bool      `json:"protected"`
+}
+
+// Bookmark keeps the footage between KeepFrom and KeepUntil out of retention.
+type Bookmark struct {
+	ID        string    `json:"id"`
+	Label     string    `json:"label"`
+	At        time.Time `json:"at"`
+	KeepFrom  time.Time `json:"keep_from"`
+	KeepUntil time.Time `json:"keep_until"`
+	Snapshot  string    `json:"snapshot,omitempty"`
+}
+
+// BookmarkRequest is the JSON body accepted over NATS and HTTP. Zero values
+// fall back to one minute before and after the event.
+type BookmarkRequest struct {
+	Label     string  `json:"label"`
+	BeforeSec float64 `json:"before_sec"`
+	AfterSec  float64 `json:"after_sec"`
+}
+
+type Recorder struct {
+	cfg RecorderConfig
+
+	mu        sync.Mutex
+	file      *os.File
+	writer    *bufio.Writer
+	name      string
+	started   time.Time
+	lastFrame time.Time
+	bookmarks []Bookmark
+}
+
+func NewRecorder(cfg RecorderConfig) (*Recorder, error) {
+	cfg.Dir = strings.TrimSpace(cfg.Dir)
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("recorder requires a directory")
+	}
+	if cfg.SegmentDuration <= 0 {
+		return nil, fmt.Errorf("segment duration must be positive")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	r := &Recorder{cfg: cfg}
+	raw, err := os.ReadFile(filepath.Join(cfg.Dir, bookmarksFile))
+	if err == nil {
+		if err := json.Unmarshal(raw, &r.bookmarks); err != nil {
+			return nil, fmt.Errorf("read %s: %w", bookmarksFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Run records frames from the active source until ctx is done.
+func (r *Recorder) Run(ctx context.Context) error {
+	defer r.closeSegment()
+	var seq uint64
+	for {
+		frame, next, err := hub.next(ctx, seq)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		seq = next
+		if err := r.WriteFrame(frame, time.Now()); err != nil {
+			logs.Warn("Camera recorder write failed: %v", err)
+		}
+	}
+}
+
+// WriteFrame appends frame to the current segment, rotating and applying
+// retention when the segment is older than SegmentDuration.
+func (r *Recorder) WriteFrame(frame []byte, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cfg.FPS > 0 && !r.lastFrame.IsZero() && at.Sub(r.lastFrame) < time.Second/time.Duration(r.cfg.FPS) {
+		return nil
+	}
+	if r.file != nil && at.Sub(r.started) >= r.cfg.SegmentDuration {
+		if err := r.closeSegmentLocked(); err != nil {
+			return err
+		}
+		if err := r.applyRetentionLocked(at); err != nil {
+			logs.Warn("Camera recorder retention failed: %v", err)
+		}
+	}
+	if r.file == nil {
+		name := at.UTC().Format(segmentTimeLayout) + segmentExt
+		file, err := os.OpenFile(filepath.Join(r.cfg.Dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		r.file, r.writer, r.name, r.started = file, bufio.NewWriter(file), name, at
+	}
+	r.lastFrame = at
+	if _, err := fmt.Fprintf(r.writer, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\nX-Timestamp: %s\r\n\r\n", segmentBoundary, len(frame), at.UTC().Format(time.RFC3339Nano)); err != nil {
+		return err
+	}
+	if _, err := r.writer.Write(frame); err != nil {
+		return err
+	}
+	if _, err := r.writer.WriteString("\r\n"); err != nil {
+		return err
+	}
+	return r.writer.Flush()
+}
+
+func (r *Recorder) closeSegment() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.closeSegmentLocked(); err != nil {
+		logs.Warn("Camera recorder close failed: %v", err)
+	}
+}
+
+func (r *Recorder) closeSegmentLocked() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.writer.Flush()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	// The mtime marks the segment end for listings and retention.
+	if err == nil && !r.lastFrame.IsZero() {
+		err = os.Chtimes(filepath.Join(r.cfg.Dir, r.name), r.lastFrame, r.lastFrame)
+	}
+	r.file, r.writer, r.name = nil, nil, ""
+	return err
+}
+
+// Segments lists recordings oldest first.
+func (r *Recorder) Segments() ([]Segment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.segmentsLocked()
+}
+
+func (r *Recorder) segmentsLocked() ([]Segment, error) {
+	entries, err := os.ReadDir(r.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	out := []Segment{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		start, err := time.Parse(segmentTimeLayout, strings.TrimSuffix(name, segmentExt))
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		seg := Segment{Name: name, Start: start, End: info.ModTime().UTC(), Bytes: info.Size(), Active: name == r.name}
+		if seg.Active {
+			seg.End = r.lastFrame.UTC()
+		}
+		seg.Protected = r.protectedLocked(seg)
+		out = append(out, seg)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out, nil
+}
+
+func (r *Recorder) protectedLocked(seg Segment) bool {
+	for _, mark := range r.bookmarks {
+		if !seg.Start.After(mark.KeepUntil) && !seg.End.Before(mark.KeepFrom) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyRetention deletes the oldest unprotected segments until both the age
+// and size limits hold.
+func (r *Recorder) ApplyRetention(now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.applyRetentionLocked(now)
+}
+
+func (r *Recorder) applyRetentionLocked(now time.Time) error {
+	if r.pruneBookmarksLocked(now) {
+		if err := r.saveBookmarksLocked(); err != nil {
+			return err
+		}
+	}
+	segments, err := r.segmentsLocked()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, seg := range segments {
+		total += seg.Bytes
+	}
+	for _, seg := range segments {
+		tooOld := r.cfg.MaxAge > 0 && now.Sub(seg.End) > r.cfg.MaxAge
+		tooBig := r.cfg.MaxBytes > 0 && total > r.cfg.MaxBytes
+		if !tooOld && !tooBig {
+			continue
+		}
+		if seg.Active || seg.Protected {
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.cfg.Dir, seg.Name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= seg.Bytes
+		logs.Info("Camera recorder removed %s (%d bytes)", seg.Name, seg.Bytes)
+	}
+	return nil
+}
+
+// AddBookmark records an event, saves the latest frame next to it and keeps
+// the surrounding footage out of retention.
+func (r *Recorder) AddBookmark(req BookmarkRequest, at time.Time) (Bookmark, error) {
+	before := durationOrDefault(req.BeforeSec, time.Minute)
+	after := durationOrDefault(req.AfterSec, time.Minute)
+	mark := Bookmark{
+		ID:        at.UTC().Format(segmentTimeLayout),
+		Label:     strings.TrimSpace(req.Label),
+		At:        at.UTC(),
+		KeepFrom:  at.Add(-before).UTC(),
+		KeepUntil: at.Add(after).UTC(),
+	}
+	if frame, _ := GetLatestFrame(); len(frame) > 0 {
+		mark.Snapshot = "bookmark_" + mark.ID + ".jpg"
+		if err := os.WriteFile(filepath.Join(r.cfg.Dir, mark.Snapshot), frame, 0o644); err != nil {
+			return Bookmark{}, err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bookmarks = append(r.bookmarks, mark)
+	r.pruneBookmarksLocked(at)
+	if err := r.saveBookmarksLocked(); err != nil {
+		return Bookmark{}, err
+	}
+	logs.Info("Camera bookmark %s label=%q keep=%s..%s", mark.ID, mark.Label, mark.KeepFrom.Format(time.RFC3339), mark.KeepUntil.Format(time.RFC3339))
+	// Apply retention now rather than at the next segment rotation, so limits
+	// freed by expired bookmarks and the new protection both take effect.
+	if err := r.applyRetentionLocked(at); err != nil {
+		logs.Warn("Camera retention after bookmark %s failed: %v", mark.ID, err)
+	}
+	return mark, nil
+}
+
+// pruneBookmarksLocked drops bookmarks past BookmarkMaxAge and the oldest
+// beyond MaxBookmarks, deleting their snapshots. It reports whether any
+// bookmark was dropped.
+func (r *Recorder) pruneBookmarksLocked(now time.Time) bool {
+	kept := make([]Bookmark, 0, len(r.bookmarks))
+	var dropped []Bookmark
+	for _, mark := range r.bookmarks {
+		if r.cfg.BookmarkMaxAge > 0 && now.Sub(mark.At) > r.cfg.BookmarkMaxAge {
+			dropped = append(dropped, mark)
+			continue
+		}
+		kept = append(kept, mark)
+	}
+	if r.cfg.MaxBookmarks > 0 && len(kept) > r.cfg.MaxBookmarks {
+		sort.SliceStable(kept, func(i, j int) bool { return kept[i].At.Before(kept[j].At) })
+		over := len(kept) - r.cfg.MaxBookmarks
+		dropped = append(dropped, kept[:over]...)
+		kept = kept[over:]
+	}
+	for _, mark := range dropped {
+		if mark.Snapshot != "" {
+			if err := os.Remove(filepath.Join(r.cfg.Dir, mark.Snapshot)); err != nil && !os.IsNotExist(err) {
+				logs.Warn("Camera bookmark %s snapshot removal failed: %v", mark.ID, err)
+			}
+		}
+		logs.Info("Camera bookmark %s label=%q expired", mark.ID, mark.Label)
+	}
+	r.bookmarks = kept
+	return len(dropped) > 0
+}
+
+func (r *Recorder) saveBookmarksLocked() error {
+	raw, err := json.MarshalIndent(r.bookmarks, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(r.cfg.Dir, bookmarksFile+".tmp")
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(r.cfg.Dir, bookmarksFile))
+}
+
+// HandleBookmarkMessage parses a NATS bookmark payload (JSON or a plain label).
+func (r *Recorder) HandleBookmarkMessage(data []byte) (Bookmark, error) {
+	req := BookmarkRequest{}
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "{") {
+		if err := json.Unmarshal(data, &req); err != nil {
+			return Bookmark{}, fmt.Errorf("invalid bookmark payload: %w", err)
+		}
+	} else {
+		req.Label = trimmed
+	}
+	return r.AddBookmark(req, time.Now())
+}
+
+func (r *Recorder) Bookmarks() []Bookmark {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Bookmark(nil), r.bookmarks...)
+}
+
+func durationOrDefault(seconds float64, fallback time.Duration) time.Duration {
+	if seconds <= 0 {
+		return fallback
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// SnapshotHandler serves the latest frame as a JPEG, starting the source if needed.
+func SnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	frame, at := GetLatestFrame()
+	if len(frame) == 0 {
+		if err := hub.ensureStarted(); err != nil {
+			http.Error(w, "Camera not initialized", http.StatusServiceUnavailable)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+		if _, _, err := hub.next(ctx, 0); err != nil {
+			http.Error(w, "No camera frame available", http.StatusServiceUnavailable)
+			return
+		}
+		frame, at = GetLatestFrame()
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Timestamp", at.UTC().Format(time.RFC3339Nano))
+	_, _ = w.Write(frame)
+}
+
+// Handler serves GET /recordings (segment and bookmark listing),
+// GET /recordings/NAME (timed MJPEG playback, ?download=1 for the raw file)
+// and POST /recordings/bookmark.
+func (r *Recorder) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := strings.Trim(strings.TrimPrefix(req.URL.Path, "/recordings"), "/")
+		switch {
+		case name == "" && req.Method == http.MethodGet:
+			segments, err := r.Segments()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeRecorderJSON(w, map[string]any{"segments": segments, "bookmarks": r.Bookmarks()})
+		case name == "bookmark" && req.Method == http.MethodPost:
+			body := BookmarkRequest{}
+			if req.ContentLength != 0 {
+				if err := json.NewDecoder(io.LimitReader(req.Body, 64<<10)).Decode(&body); err != nil {
+					http.Error(w, "invalid bookmark body", http.StatusBadRequest)
+					return
+				}
+			}
+			mark, err := r.AddBookmark(body, time.Now())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeRecorderJSON(w, mark)
+		case req.Method == http.MethodGet && filepath.Base(name) == name && strings.HasSuffix(name, segmentExt):
+			path := filepath.Join(r.cfg.Dir, name)
+			if req.URL.Query().Get("download") == "1" {
+				w.Header().Set("Content-Type", "video/x-motion-jpeg")
+				http.ServeFile(w, req, path)
+				return
+			}
+			r.playSegment(w, req, path)
+		case name == "bookmark" || name == "":
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		default:
+			http.NotFound(w, req)
+		}
+	})
+}
+
+// playSegment replays a segment as a live MJPEG stream at recorded timing.
+func (r *Recorder) playSegment(w http.ResponseWriter, req *http.Request, path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+	defer file.Close()
+	speed := 1.0
+	if raw := req.URL.Query().Get("speed"); raw != "" {
+		if speed, err = strconv.ParseFloat(raw, 64); err != nil || speed <= 0 {
+			http.Error(w, "invalid speed", http.StatusBadRequest)
+			return
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+segmentBoundary)
+	w.Header().Set("Cache-Control", "no-store")
+	reader := bufio.NewReader(file)
+	var prev time.Time
+	for {
+		frame, at, err := readSegmentFrame(reader)
+		if err != nil {
+			return
+		}
+		if !prev.IsZero() && at.After(prev) {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-time.After(time.Duration(float64(at.Sub(prev)) / speed)):
+			}
+		}
+		prev = at
+		if _, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", segmentBoundary, len(frame)); err != nil {
+			return
+		}
+		if _, err := w.Write(frame); err != nil {
+			return
+		}
+		_, _ = w.Write([]byte("\r\n"))
+		flusher.Flush()
+	}
+}
+
+// readSegmentFrame reads one part using its Content-Length, so segments that
+// are still being written (no closing boundary) play back fully.
+func readSegmentFrame(reader *bufio.Reader) ([]byte, time.Time, error) {
+	tp := textproto.NewReader(reader)
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if line == "--"+segmentBoundary {
+			break
+		}
+		if line != "" {
+			return nil, time.Time{}, fmt.Errorf("unexpected segment line %q", line)
+		}
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	size, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || size < 0 || size > maxRemoteFrameBytes {
+		return nil, time.Time{}, fmt.Errorf("invalid segment frame length %q", header.Get("Content-Length"))
+	}
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(reader, frame); err != nil {
+		return nil, time.Time{}, err
+	}
+	at, _ := time.Parse(time.RFC3339Nano, header.Get("X-Timestamp"))
+	return frame, at, nil
+}
+
+func writeRecorderJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
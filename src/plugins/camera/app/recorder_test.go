@@ -0,0 +1,177 @@
+package camera
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorderRotatesAndKeepsBookmarkedSegments(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := NewRecorder(RecorderConfig{Dir: dir, SegmentDuration: time.Minute, MaxAge: 10 * time.Minute, FPS: 1})
+	if err != nil {
+		t.Fatalf("NewRecorder returned error: %v", err)
+	}
+	frame := []byte{0xFF, 0xD8, 0xFF, 0xE0, 1, 2, 3, 0xFF, 0xD9}
+	base := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	for i := 0; i < 5*60; i++ {
+		if err := rec.WriteFrame(frame, base.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("WriteFrame returned error: %v", err)
+		}
+	}
+	// Dropped by the 1 fps cap.
+	if err := rec.WriteFrame(frame, base.Add(299*time.Second+10*time.Millisecond)); err != nil {
+		t.Fatalf("WriteFrame returned error: %v", err)
+	}
+	segments, err := rec.Segments()
+	if err != nil {
+		t.Fatalf("Segments returned error: %v", err)
+	}
+	if len(segments) != 5 || !segments[4].Active || segments[0].Name != "20260102T030000.000Z.mjpeg" {
+		t.Fatalf("unexpected segments: %+v", segments)
+	}
+
+	mark, err := rec.AddBookmark(BookmarkRequest{Label: "bump", BeforeSec: 10, AfterSec: 10}, base.Add(90*time.Second))
+	if err != nil {
+		t.Fatalf("AddBookmark returned error: %v", err)
+	}
+	if err := rec.ApplyRetention(base.Add(30 * time.Minute)); err != nil {
+		t.Fatalf("ApplyRetention returned error: %v", err)
+	}
+	segments, err = rec.Segments()
+	if err != nil {
+		t.Fatalf("Segments returned error: %v", err)
+	}
+	if len(segments) != 2 || segments[0].Name != "20260102T030100.000Z.mjpeg" || !segments[0].Protected || !segments[1].Active {
+		t.Fatalf("expected bookmarked and active segments to survive retention, got %+v", segments)
+	}
+
+	reopened, err := NewRecorder(RecorderConfig{Dir: dir, SegmentDuration: time.Minute})
+	if err != nil {
+		t.Fatalf("NewRecorder reopen returned error: %v", err)
+	}
+	if marks := reopened.Bookmarks(); len(marks) != 1 || marks[0].ID != mark.ID || marks[0].Label != "bump" {
+		t.Fatalf("bookmarks were not persisted: %+v", marks)
+	}
+
+	server := httptest.NewServer(rec.Handler())
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL + "/recordings")
+	if err != nil {
+		t.Fatalf("GET /recordings returned error: %v", err)
+	}
+	listing := struct {
+		Segments  []Segment  `json:"segments"`
+		Bookmarks []Bookmark `json:"bookmarks"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		t.Fatalf("decode listing: %v", err)
+	}
+	resp.Body.Close()
+	if len(listing.Segments) != 2 || len(listing.Bookmarks) != 1 {
+		t.Fatalf("unexpected listing: %+v", listing)
+	}
+
+	resp, err = server.Client().Get(server.URL + "/recordings/" + segments[0].Name + "?speed=1000")
+	if err != nil {
+		t.Fatalf("GET segment returned error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if got := strings.Count(string(body), "--frame\r\n"); got != 60 {
+		t.Fatalf("playback frames = %d, want 60", got)
+	}
+	if strings.Contains(string(body), "X-Timestamp") {
+		t.Fatalf("playback should not leak recording headers")
+	}
+	if _, err := os.Stat(filepath.Join(dir, bookmarksFile)); err != nil {
+		t.Fatalf("bookmarks file missing: %v", err)
+	}
+}
+
+func TestRecorderExpiresBookmarksAndTheirSnapshots(t *testing.T) {
+	hub.mu.Lock()
+	previous := hub.latest
+	hub.latest = []byte{0xFF, 0xD8, 0xFF, 0xD9}
+	hub.mu.Unlock()
+	t.Cleanup(func() {
+		hub.mu.Lock()
+		hub.latest = previous
+		hub.mu.Unlock()
+	})
+
+	dir := t.TempDir()
+	rec, err := NewRecorder(RecorderConfig{Dir: dir, SegmentDuration: time.Minute, BookmarkMaxAge: time.Hour, MaxBookmarks: 2})
+	if err != nil {
+		t.Fatalf("NewRecorder returned error: %v", err)
+	}
+	base := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	var marks []Bookmark
+	for i, label := range []string{"first", "second", "third"} {
+		mark, err := rec.AddBookmark(BookmarkRequest{Label: label}, base.Add(time.Duration(i)*time.Minute))
+		if err != nil {
+			t.Fatalf("AddBookmark returned error: %v", err)
+		}
+		marks = append(marks, mark)
+	}
+	if got := rec.Bookmarks(); len(got) != 2 || got[0].Label != "second" || got[1].Label != "third" {
+		t.Fatalf("expected the oldest bookmark to be capped, got %+v", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, marks[0].Snapshot)); !os.IsNotExist(err) {
+		t.Fatalf("expected capped bookmark snapshot to be removed, stat err=%v", err)
+	}
+
+	if err := rec.ApplyRetention(base.Add(time.Hour + 90*time.Second)); err != nil {
+		t.Fatalf("ApplyRetention returned error: %v", err)
+	}
+	if got := rec.Bookmarks(); len(got) != 1 || got[0].Label != "third" {
+		t.Fatalf("expected the aged bookmark to expire, got %+v", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, marks[1].Snapshot)); !os.IsNotExist(err) {
+		t.Fatalf("expected expired bookmark snapshot to be removed, stat err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, marks[2].Snapshot)); err != nil {
+		t.Fatalf("expected kept bookmark snapshot to remain: %v", err)
+	}
+	reopened, err := NewRecorder(RecorderConfig{Dir: dir, SegmentDuration: time.Minute})
+	if err != nil {
+		t.Fatalf("NewRecorder reopen returned error: %v", err)
+	}
+	if got := reopened.Bookmarks(); len(got) != 1 || got[0].ID != marks[2].ID {
+		t.Fatalf("expected pruned bookmarks to be persisted, got %+v", got)
+	}
+}
+
+func TestRecorderAppliesRetentionWhenBookmarked(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := NewRecorder(RecorderConfig{Dir: dir, SegmentDuration: time.Minute, FPS: 1})
+	if err != nil {
+		t.Fatalf("NewRecorder returned error: %v", err)
+	}
+	frame := []byte{0xFF, 0xD8, 0xFF, 0xD9}
+	base := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	for i := 0; i < 3*60; i++ {
+		if err := rec.WriteFrame(frame, base.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("WriteFrame returned error: %v", err)
+		}
+	}
+	// Tighten the age limit without rotating another segment.
+	rec.mu.Lock()
+	rec.cfg.MaxAge = time.Minute
+	rec.mu.Unlock()
+	if _, err := rec.AddBookmark(BookmarkRequest{Label: "late", BeforeSec: 10, AfterSec: 10}, base.Add(170*time.Second)); err != nil {
+		t.Fatalf("AddBookmark returned error: %v", err)
+	}
+	segments, err := rec.Segments()
+	if err != nil {
+		t.Fatalf("Segments returned error: %v", err)
+	}
+	if len(segments) != 2 || segments[0].Name != "20260102T030100.000Z.mjpeg" || !segments[1].Active || !segments[1].Protected {
+		t.Fatalf("expected retention to run on bookmark, got %+v", segments)
+	}
+}
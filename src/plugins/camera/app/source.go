@@ -0,0 +1,407 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logs "dialtone/dev/plugins/logs/src_v1/go"
+)
+
+// FrameSource produces JPEG frames for /stream and GetLatestFrame.
+type FrameSource interface {
+	Name() string
+	// NextFrame blocks until the next JPEG frame is ready. The returned slice
+	// is owned by the caller.
+	NextFrame(ctx context.Context) ([]byte, error)
+	Close() error
+}
+
+const (
+	SourceV4L2      = "v4l2"
+	SourceSynthetic = "synthetic"
+	SourceFile      = "file"
+	SourceRemote    = "remote"
+)
+
+// SourceConfig selects and tunes a FrameSource.
+// Target is the device for v4l2, the path for file and the URL for remote.
+type SourceConfig struct {
+	Kind   string
+	Target string
+	Width  int
+	Height int
+	FPS    int
+}
+
+func DefaultSourceConfig() SourceConfig {
+	return SourceConfig{Kind: SourceV4L2, Width: 640, Height: 480, FPS: 15}
+}
+
+// ParseSourceSpec parses v4l2[:DEVICE], synthetic[:WxH], file:PATH or remote:URL.
+func ParseSourceSpec(spec string) (SourceConfig, error) {
+	cfg := DefaultSourceConfig()
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return cfg, nil
+	}
+	kind, target, _ := strings.Cut(spec, ":")
+	cfg.Kind = strings.ToLower(strings.TrimSpace(kind))
+	cfg.Target = strings.TrimSpace(target)
+	switch cfg.Kind {
+	case SourceV4L2:
+	case SourceSynthetic:
+		if cfg.Target != "" {
+			width, height, err := ParseFrameSize(cfg.Target)
+			if err != nil {
+				return cfg, err
+			}
+			cfg.Width, cfg.Height, cfg.Target = width, height, ""
+		}
+	case SourceFile:
+		if cfg.Target == "" {
+			return cfg, fmt.Errorf("file source requires a path (file:PATH)")
+		}
+	case SourceRemote:
+		if cfg.Target == "" {
+			return cfg, fmt.Errorf("remote source requires a URL (remote:URL)")
+		}
+	default:
+		return cfg, fmt.Errorf("unknown camera source %q (use v4l2, synthetic, file:PATH or remote:URL)", kind)
+	}
+	return cfg, nil
+}
+
+// ParseFrameSize parses WIDTHxHEIGHT.
+func ParseFrameSize(raw string) (int, int, error) {
+	w, h, ok := strings.Cut(strings.ToLower(strings.TrimSpace(raw)), "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid frame size %q (want WIDTHxHEIGHT)", raw)
+	}
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if errW != nil || errH != nil || width < 16 || height < 16 || width > 4096 || height > 4096 {
+		return 0, 0, fmt.Errorf("invalid frame size %q (want WIDTHxHEIGHT between 16 and 4096)", raw)
+	}
+	return width, height, nil
+}
+
+func (cfg SourceConfig) String() string {
+	switch cfg.Kind {
+	case SourceSynthetic:
+		return fmt.Sprintf("%s:%dx%d", cfg.Kind, cfg.Width, cfg.Height)
+	default:
+		if cfg.Target == "" {
+			return cfg.Kind
+		}
+		return cfg.Kind + ":" + cfg.Target
+	}
+}
+
+// OpenSource opens the FrameSource described by cfg.
+func OpenSource(ctx context.Context, cfg SourceConfig) (FrameSource, error) {
+	if cfg.FPS <= 0 {
+		cfg.FPS = DefaultSourceConfig().FPS
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		cfg.Width, cfg.Height = DefaultSourceConfig().Width, DefaultSourceConfig().Height
+	}
+	switch cfg.Kind {
+	case "", SourceV4L2:
+		return openV4L2Source(ctx, cfg.Target)
+	case SourceSynthetic:
+		return newSyntheticSource(cfg), nil
+	case SourceFile:
+		return openFileSource(cfg)
+	case SourceRemote:
+		return openRemoteSource(ctx, cfg.Target)
+	default:
+		return nil, fmt.Errorf("unknown camera source %q", cfg.Kind)
+	}
+}
+
+// framePacer spaces frames at a fixed rate, dropping frames rather than
+// bursting when a caller falls behind.
+type framePacer struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newFramePacer(fps int) framePacer {
+	return framePacer{interval: time.Second / time.Duration(max(1, fps))}
+}
+
+func (p *framePacer) wait(ctx context.Context) error {
+	if wait := time.Until(p.next); !p.next.IsZero() && wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	now := time.Now()
+	p.next = p.next.Add(p.interval)
+	if p.next.Before(now) {
+		p.next = now.Add(p.interval)
+	}
+	return nil
+}
+
+type frameHub struct {
+	mu               sync.Mutex
+	cfg              *SourceConfig
+	src              FrameSource
+	cancel           context.CancelFunc
+	latest           []byte
+	latestAt         time.Time
+	seq              uint64
+	updated          chan struct{}
+	lastStartAttempt time.Time
+	lastStartLogAt   time.Time
+}
+
+var (
+	hub                  = &frameHub{updated: make(chan struct{})}
+	autoStartBackoff     = 2 * time.Second
+	autoStartLogThrottle = 10 * time.Second
+	frameStallTimeout    = 5 * time.Second
+)
+
+// SetSource selects the source used by StreamHandler and restarts any
+// running source. Without it, CAMERA_SOURCE or V4L2 auto-detection is used.
+func SetSource(cfg SourceConfig) {
+	hub.mu.Lock()
+	hub.cfg = &cfg
+	hub.lastStartAttempt = time.Time{}
+	hub.mu.Unlock()
+	hub.stop()
+}
+
+// ActiveSource reports the running source name, or "" when stopped.
+func ActiveSource() string {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.src == nil {
+		return ""
+	}
+	return hub.src.Name()
+}
+
+// StartCamera opens the V4L2 device and starts buffering frames.
+func StartCamera(ctx context.Context, devName string) error {
+	hub.mu.Lock()
+	running := hub.src != nil
+	hub.mu.Unlock()
+	if running {
+		return nil
+	}
+	SetSource(SourceConfig{Kind: SourceV4L2, Target: strings.TrimSpace(devName)})
+	return hub.start(ctx)
+}
+
+// StopCamera stops the active source; the next stream request reopens it.
+func StopCamera() {
+	hub.stop()
+}
+
+// GetLatestFrame returns a copy of the most recent frame and its capture time.
+func GetLatestFrame() ([]byte, time.Time) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if len(hub.latest) == 0 {
+		return nil, time.Time{}
+	}
+	return append([]byte(nil), hub.latest...), hub.latestAt
+}
+
+func (h *frameHub) config() SourceConfig {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cfg != nil {
+		return *h.cfg
+	}
+	if spec := strings.TrimSpace(os.Getenv("CAMERA_SOURCE")); spec != "" {
+		cfg, err := ParseSourceSpec(spec)
+		if err == nil {
+			return cfg
+		}
+		logs.Warn("Ignoring CAMERA_SOURCE=%q: %v", spec, err)
+	}
+	return DefaultSourceConfig()
+}
+
+func (h *frameHub) start(ctx context.Context) error {
+	cfg := h.config()
+	src, err := OpenSource(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	if h.src != nil {
+		h.mu.Unlock()
+		_ = src.Close()
+		return nil
+	}
+	// Keep the source lifetime independent from the request that opened it.
+	pumpCtx, cancel := context.WithCancel(context.Background())
+	h.src = src
+	h.cancel = cancel
+	h.mu.Unlock()
+	logs.Info("Camera source started: %s", src.Name())
+	go h.pump(pumpCtx, src)
+	return nil
+}
+
+// ensureStarted starts the configured source, rate limited so an unavailable
+// camera does not hot-loop on every stream request.
+func (h *frameHub) ensureStarted() error {
+	h.mu.Lock()
+	if h.src != nil {
+		h.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	if now.Sub(h.lastStartAttempt) < autoStartBackoff {
+		h.mu.Unlock()
+		return errors.New("camera source unavailable")
+	}
+	h.lastStartAttempt = now
+	h.mu.Unlock()
+
+	err := h.start(context.Background())
+	if err != nil {
+		h.mu.Lock()
+		if now.Sub(h.lastStartLogAt) >= autoStartLogThrottle {
+			logs.Info("Failed to start camera source: %v", err)
+			h.lastStartLogAt = now
+		}
+		h.mu.Unlock()
+	}
+	return err
+}
+
+func (h *frameHub) pump(ctx context.Context, src FrameSource) {
+	for {
+		frame, err := src.NextFrame(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				logs.Info("Camera source %s stopped: %v", src.Name(), err)
+			}
+			h.release(src)
+			return
+		}
+		if len(frame) == 0 {
+			continue
+		}
+		h.mu.Lock()
+		h.latest = frame
+		h.latestAt = time.Now()
+		h.seq++
+		close(h.updated)
+		h.updated = make(chan struct{})
+		h.mu.Unlock()
+	}
+}
+
+func (h *frameHub) release(src FrameSource) {
+	h.mu.Lock()
+	if h.src == src {
+		h.src = nil
+		if h.cancel != nil {
+			h.cancel()
+			h.cancel = nil
+		}
+	}
+	h.mu.Unlock()
+	_ = src.Close()
+}
+
+func (h *frameHub) stop() {
+	h.mu.Lock()
+	src := h.src
+	h.mu.Unlock()
+	if src != nil {
+		h.release(src)
+	}
+}
+
+// next waits for a frame newer than seq.
+func (h *frameHub) next(ctx context.Context, seq uint64) ([]byte, uint64, error) {
+	for {
+		h.mu.Lock()
+		if h.seq > seq && len(h.latest) > 0 {
+			frame, current := h.latest, h.seq
+			h.mu.Unlock()
+			return frame, current, nil
+		}
+		updated := h.updated
+		h.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, seq, ctx.Err()
+		case <-updated:
+		case <-time.After(frameStallTimeout):
+			if err := h.ensureStarted(); err != nil {
+				return nil, seq, err
+			}
+		}
+	}
+}
+
+// StreamHandler handles MJPEG streaming requests.
+func StreamHandler(w http.ResponseWriter, r *http.Request) {
+	if err := hub.ensureStarted(); err != nil {
+		http.Error(w, "Camera not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Set headers for MJPEG
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, pre-check=0, post-check=0, max-age=0")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Connection", "close")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		logs.Info("ResponseWriter does not support flushing")
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	logs.Info("Starting stream for %s", r.RemoteAddr)
+	flusher.Flush()
+
+	var seq uint64
+	for {
+		frame, next, err := hub.next(r.Context(), seq)
+		if err != nil {
+			if r.Context().Err() != nil {
+				logs.Info("Stream closed by client %s", r.RemoteAddr)
+			} else {
+				logs.Info("Stream for %s ended: %v", r.RemoteAddr, err)
+			}
+			return
+		}
+		seq = next
+		// Write the MJPEG boundary and frame metadata
+		if _, err := fmt.Fprintf(w, "--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(frame)); err != nil {
+			logs.Info("Stream write error (header) for %s: %v", r.RemoteAddr, err)
+			return
+		}
+		if _, err := w.Write(frame); err != nil {
+			logs.Info("Stream write error (body) for %s: %v", r.RemoteAddr, err)
+			return
+		}
+		_, _ = w.Write([]byte("\r\n"))
+		flusher.Flush()
+	}
+}
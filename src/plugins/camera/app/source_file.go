@@ -0,0 +1,127 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileSource loops over recorded frames: either a concatenated MJPEG file or a
+// directory of .jpg/.jpeg/.png images played in name order.
+type fileSource struct {
+	path   string
+	frames [][]byte
+	pacer  framePacer
+	index  int
+}
+
+func openFileSource(cfg SourceConfig) (FrameSource, error) {
+	path := strings.TrimSpace(cfg.Target)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var frames [][]byte
+	if info.IsDir() {
+		frames, err = loadImageDir(path)
+	} else {
+		var raw []byte
+		raw, err = os.ReadFile(path)
+		if err == nil {
+			frames = splitMJPEG(raw)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no JPEG frames found in %s", path)
+	}
+	return &fileSource{path: path, frames: frames, pacer: newFramePacer(cfg.FPS)}, nil
+}
+
+func (s *fileSource) Name() string {
+	return SourceFile + ":" + s.path
+}
+
+func (s *fileSource) NextFrame(ctx context.Context) ([]byte, error) {
+	if err := s.pacer.wait(ctx); err != nil {
+		return nil, err
+	}
+	frame := s.frames[s.index]
+	s.index = (s.index + 1) % len(s.frames)
+	return append([]byte(nil), frame...), nil
+}
+
+func (s *fileSource) Close() error {
+	return nil
+}
+
+// splitMJPEG splits concatenated JPEG images on their SOI/EOI markers.
+func splitMJPEG(data []byte) [][]byte {
+	soi := []byte{0xFF, 0xD8, 0xFF}
+	eoi := []byte{0xFF, 0xD9}
+	var frames [][]byte
+	for {
+		start := bytes.Index(data, soi)
+		if start < 0 {
+			return frames
+		}
+		data = data[start:]
+		// The next SOI bounds this frame so embedded thumbnails are not split.
+		limit := len(data)
+		if next := bytes.Index(data[len(soi):], soi); next >= 0 {
+			limit = next + len(soi)
+		}
+		end := bytes.LastIndex(data[:limit], eoi)
+		if end < 0 {
+			return frames
+		}
+		frames = append(frames, data[:end+len(eoi)])
+		data = data[end+len(eoi):]
+	}
+}
+
+func loadImageDir(dir string) ([][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".jpg", ".jpeg", ".png":
+			if !entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+	frames := make([][]byte, 0, len(names))
+	for _, name := range names {
+		raw, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if ext := strings.ToLower(filepath.Ext(name)); ext == ".png" {
+			img, _, err := image.Decode(bytes.NewReader(raw))
+			if err != nil {
+				return nil, fmt.Errorf("decode %s: %w", name, err)
+			}
+			var buf bytes.Buffer
+			if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+				return nil, fmt.Errorf("encode %s: %w", name, err)
+			}
+			raw = buf.Bytes()
+		}
+		frames = append(frames, raw)
+	}
+	return frames, nil
+}
@@ -0,0 +1,105 @@
+package camera
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const maxRemoteFrameBytes = 16 << 20
+
+// remoteSource relays the MJPEG /stream of another dialtone camera.
+type remoteSource struct {
+	url    string
+	body   io.ReadCloser
+	parts  *multipart.Reader
+	cancel context.CancelFunc
+}
+
+func openRemoteSource(ctx context.Context, rawURL string) (FrameSource, error) {
+	target, err := remoteStreamURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	streamCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, target, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("remote camera request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("remote camera status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("remote camera %s did not return an MJPEG stream (content-type %q)", target, resp.Header.Get("Content-Type"))
+	}
+	return &remoteSource{
+		url:    target,
+		body:   resp.Body,
+		parts:  multipart.NewReader(resp.Body, params["boundary"]),
+		cancel: cancel,
+	}, nil
+}
+
+// remoteStreamURL accepts host:port, a base URL, or a full /stream URL.
+func remoteStreamURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid remote camera URL %q", raw)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/stream"
+	}
+	return u.String(), nil
+}
+
+func (s *remoteSource) Name() string {
+	return SourceRemote + ":" + s.url
+}
+
+func (s *remoteSource) NextFrame(ctx context.Context) ([]byte, error) {
+	stop := context.AfterFunc(ctx, s.cancel)
+	defer stop()
+	for {
+		part, err := s.parts.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		frame, err := io.ReadAll(io.LimitReader(part, maxRemoteFrameBytes+1))
+		_ = part.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(frame) > maxRemoteFrameBytes {
+			return nil, fmt.Errorf("remote camera frame exceeds %d bytes", maxRemoteFrameBytes)
+		}
+		if len(frame) > 0 {
+			return frame, nil
+		}
+	}
+}
+
+func (s *remoteSource) Close() error {
+	s.cancel()
+	return s.body.Close()
+}
@@ -0,0 +1,152 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"time"
+)
+
+// syntheticSource renders a moving test pattern with a timestamp overlay so
+// /stream and the robot UI can be exercised without a camera attached.
+type syntheticSource struct {
+	width   int
+	height  int
+	pacer   framePacer
+	started time.Time
+	frame   int
+}
+
+func newSyntheticSource(cfg SourceConfig) *syntheticSource {
+	return &syntheticSource{
+		width:  cfg.Width,
+		height: cfg.Height,
+		pacer:  newFramePacer(cfg.FPS),
+	}
+}
+
+func (s *syntheticSource) Name() string {
+	return fmt.Sprintf("%s:%dx%d", SourceSynthetic, s.width, s.height)
+}
+
+func (s *syntheticSource) NextFrame(ctx context.Context) ([]byte, error) {
+	if err := s.pacer.wait(ctx); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if s.started.IsZero() {
+		s.started = now
+	}
+	img := s.render(now.Sub(s.started), now)
+	s.frame++
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 75}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *syntheticSource) Close() error {
+	return nil
+}
+
+func (s *syntheticSource) render(elapsed time.Duration, now time.Time) *image.RGBA {
+	w, h := s.width, s.height
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: 96, A: 255})
+		}
+	}
+	t := elapsed.Seconds()
+
+	// Bouncing square and an orbiting circle make frozen frames obvious.
+	size := max(8, min(w, h)/6)
+	sx := bounce(t*float64(w)/4, w-size)
+	sy := bounce(t*float64(h)/3, h-size)
+	fillRect(img, sx, sy, size, size, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	radius := max(4, min(w, h)/10)
+	cx := w/2 + int(float64(w/3)*math.Cos(t))
+	cy := h/2 + int(float64(h/3)*math.Sin(t))
+	fillCircle(img, cx, cy, radius, color.RGBA{R: 220, G: 40, B: 40, A: 255})
+
+	scale := max(2, w/200)
+	lines := []string{
+		now.Format("2006-01-02 15:04:05.000"),
+		fmt.Sprintf("#%d", s.frame),
+	}
+	for i, line := range lines {
+		x, y := 4*scale, 4*scale+i*7*scale
+		fillRect(img, x-scale, y-scale, (len(line)*4+1)*scale, 7*scale, color.RGBA{A: 255})
+		drawText(img, x, y, scale, line, color.RGBA{R: 255, G: 255, B: 0, A: 255})
+	}
+	return img
+}
+
+func bounce(pos float64, span int) int {
+	if span <= 0 {
+		return 0
+	}
+	p := int(pos) % (2 * span)
+	if p > span {
+		return 2*span - p
+	}
+	return p
+}
+
+func fillRect(img *image.RGBA, x0, y0, w, h int, c color.RGBA) {
+	r := image.Rect(x0, y0, x0+w, y0+h).Intersect(img.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+func fillCircle(img *image.RGBA, cx, cy, radius int, c color.RGBA) {
+	for y := -radius; y <= radius; y++ {
+		for x := -radius; x <= radius; x++ {
+			if x*x+y*y <= radius*radius && image.Pt(cx+x, cy+y).In(img.Bounds()) {
+				img.SetRGBA(cx+x, cy+y, c)
+			}
+		}
+	}
+}
+
+// glyphs is a 3x5 bitmap font covering the overlay characters.
+var glyphs = map[rune][5]uint8{
+	'0': {7, 5, 5, 5, 7},
+	'1': {2, 6, 2, 2, 7},
+	'2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7},
+	'7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7},
+	':': {0, 2, 0, 2, 0},
+	'-': {0, 0, 7, 0, 0},
+	'.': {0, 0, 0, 0, 2},
+	'#': {5, 7, 5, 7, 5},
+}
+
+func drawText(img *image.RGBA, x, y, scale int, text string, c color.RGBA) {
+	for i, ch := range text {
+		rows, ok := glyphs[ch]
+		if !ok {
+			continue
+		}
+		for row, bits := range rows {
+			for col := 0; col < 3; col++ {
+				if bits&(4>>col) != 0 {
+					fillRect(img, x+(i*4+col)*scale, y+row*scale, scale, scale, c)
+				}
+			}
+		}
+	}
+}
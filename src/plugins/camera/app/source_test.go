@@ -0,0 +1,112 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseSourceSpec(t *testing.T) {
+	cfg, err := ParseSourceSpec("synthetic:320x240")
+	if err != nil || cfg.Kind != SourceSynthetic || cfg.Width != 320 || cfg.Height != 240 {
+		t.Fatalf("ParseSourceSpec(synthetic) = %+v, %v", cfg, err)
+	}
+	cfg, err = ParseSourceSpec("remote:http://rover:19090/stream")
+	if err != nil || cfg.Kind != SourceRemote || cfg.Target != "http://rover:19090/stream" {
+		t.Fatalf("ParseSourceSpec(remote) = %+v, %v", cfg, err)
+	}
+	for _, spec := range []string{"file", "remote:", "synthetic:10x10", "webcam"} {
+		if _, err := ParseSourceSpec(spec); err == nil {
+			t.Fatalf("ParseSourceSpec(%q) expected error", spec)
+		}
+	}
+}
+
+func TestFileSourceLoopsMJPEGAndImageDirectory(t *testing.T) {
+	ctx := context.Background()
+	synthetic := newSyntheticSource(SourceConfig{Width: 64, Height: 48, FPS: 1000})
+	var frames [][]byte
+	for range 3 {
+		frame, err := synthetic.NextFrame(ctx)
+		if err != nil {
+			t.Fatalf("synthetic NextFrame returned error: %v", err)
+		}
+		if _, err := jpeg.Decode(bytes.NewReader(frame)); err != nil {
+			t.Fatalf("synthetic frame is not a JPEG: %v", err)
+		}
+		frames = append(frames, frame)
+	}
+
+	dir := t.TempDir()
+	mjpeg := filepath.Join(dir, "clip.mjpeg")
+	if err := os.WriteFile(mjpeg, bytes.Join(frames, []byte("\r\n--frame\r\n")), 0o644); err != nil {
+		t.Fatalf("write clip: %v", err)
+	}
+	imageDir := filepath.Join(dir, "images")
+	for i, name := range []string{"b.jpg", "a.jpg", "notes.txt"} {
+		if err := os.MkdirAll(imageDir, 0o755); err != nil {
+			t.Fatalf("mkdir images: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(imageDir, name), frames[i], 0o644); err != nil {
+			t.Fatalf("write image: %v", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		path string
+		want [][]byte
+	}{
+		{path: mjpeg, want: [][]byte{frames[0], frames[1], frames[2], frames[0]}},
+		{path: imageDir, want: [][]byte{frames[1], frames[0], frames[1]}},
+	} {
+		src, err := OpenSource(ctx, SourceConfig{Kind: SourceFile, Target: tc.path, FPS: 1000})
+		if err != nil {
+			t.Fatalf("OpenSource(%s) returned error: %v", tc.path, err)
+		}
+		for i, want := range tc.want {
+			got, err := src.NextFrame(ctx)
+			if err != nil {
+				t.Fatalf("NextFrame returned error: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("%s frame %d: got %d bytes, want %d", tc.path, i, len(got), len(want))
+			}
+		}
+	}
+}
+
+func TestRemoteSourceRelaysStreamHandler(t *testing.T) {
+	SetSource(SourceConfig{Kind: SourceSynthetic, Width: 64, Height: 48, FPS: 50})
+	t.Cleanup(StopCamera)
+	server := httptest.NewServer(http.HandlerFunc(StreamHandler))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	src, err := OpenSource(ctx, SourceConfig{Kind: SourceRemote, Target: server.URL})
+	if err != nil {
+		t.Fatalf("OpenSource(remote) returned error: %v", err)
+	}
+	defer src.Close()
+	for range 2 {
+		frame, err := src.NextFrame(ctx)
+		if err != nil {
+			t.Fatalf("remote NextFrame returned error: %v", err)
+		}
+		if _, err := jpeg.Decode(bytes.NewReader(frame)); err != nil {
+			t.Fatalf("relayed frame is not a JPEG: %v", err)
+		}
+	}
+	if latest, at := GetLatestFrame(); len(latest) == 0 || at.IsZero() {
+		t.Fatalf("GetLatestFrame returned no frame after streaming")
+	}
+	if got := ActiveSource(); got != "synthetic:64x48" {
+		t.Fatalf("ActiveSource = %q", got)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	cameraapp "dialtone/dev/plugins/camera/app"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"net/http"
@@ -46,9 +47,51 @@ func run(args []string) error {
 	interval := fs.Duration("interval", time.Second, "Publish interval")
 	listen := fs.String("listen", ":19090", "HTTP listen address for stream service")
 	serveStream := fs.Bool("serve-stream", true, "Expose /stream endpoint")
+	source := fs.String("source", "v4l2", "Frame source: v4l2[:DEVICE], synthetic[:WxH], file:PATH or remote:URL")
+	fps := fs.Int("fps", 15, "Frame rate for synthetic and file sources")
+	size := fs.String("size", "640x480", "Frame size for the synthetic source")
+	recordDir := fs.String("record-dir", "", "Record rolling MJPEG segments into this directory (empty disables recording)")
+	segment := fs.Duration("segment", time.Minute, "Recording segment length")
+	retainAge := fs.Duration("retain-age", 24*time.Hour, "Delete recordings older than this (0 keeps all)")
+	retainMB := fs.Int64("retain-mb", 2048, "Delete oldest recordings above this total size in MB (0 disables)")
+	recordFPS := fs.Int("record-fps", 5, "Maximum recorded frames per second")
+	bookmarkAge := fs.Duration("bookmark-max-age", 30*24*time.Hour, "Drop bookmarks (and stop protecting their footage) after this long (0 keeps all)")
+	bookmarkMax := fs.Int("bookmark-max", 200, "Keep at most this many bookmarks, dropping the oldest (0 disables)")
+	bookmarkSubject := fs.String("bookmark-subject", "camera.bookmark", "NATS subject that bookmarks recorded footage")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("run does not accept positional arguments")
+	}
+	sourceCfg, err := cameraapp.ParseSourceSpec(*source)
+	if err != nil {
+		return err
+	}
+	if *fps <= 0 {
+		return fmt.Errorf("--fps must be positive")
+	}
+	sourceCfg.FPS = *fps
+	if sourceCfg.Kind == cameraapp.SourceSynthetic && !strings.Contains(*source, ":") {
+		if sourceCfg.Width, sourceCfg.Height, err = cameraapp.ParseFrameSize(*size); err != nil {
+			return err
+		}
+	}
+	cameraapp.SetSource(sourceCfg)
+
+	var recorder *cameraapp.Recorder
+	if dir := strings.TrimSpace(*recordDir); dir != "" {
+		recCfg := cameraapp.DefaultRecorderConfig(dir)
+		recCfg.SegmentDuration = *segment
+		recCfg.MaxAge = *retainAge
+		recCfg.MaxBytes = *retainMB << 20
+		recCfg.FPS = *recordFPS
+		recCfg.BookmarkMaxAge = *bookmarkAge
+		recCfg.MaxBookmarks = *bookmarkMax
+		if recorder, err = cameraapp.NewRecorder(recCfg); err != nil {
+			return err
+		}
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
@@ -56,6 +99,11 @@ func run(args []string) error {
 	})
 	if *serveStream {
 		mux.HandleFunc("/stream", cameraapp.StreamHandler)
+		mux.HandleFunc("/snapshot", cameraapp.SnapshotHandler)
+	}
+	if recorder != nil {
+		mux.Handle("/recordings", recorder.Handler())
+		mux.Handle("/recordings/", recorder.Handler())
 	}
 	httpSrv := &http.Server{
 		Addr:    strings.TrimSpace(*listen),
@@ -70,7 +118,6 @@ func run(args []string) error {
 
 	var nc *nats.Conn
 	if strings.TrimSpace(*natsURL) != "" {
-		var err error
 		nc, err = nats.Connect(strings.TrimSpace(*natsURL), nats.Timeout(2*time.Second))
 		if err != nil {
 			logs.Warn("camera_v1 nats connect failed; continuing http-only: %v", err)
@@ -82,10 +129,34 @@ func run(args []string) error {
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
+	if recorder != nil {
+		go func() {
+			if err := recorder.Run(ctx); err != nil {
+				logs.Error("camera_v1 recorder failed: %v", err)
+			}
+		}()
+		if nc != nil && strings.TrimSpace(*bookmarkSubject) != "" {
+			sub, err := nc.Subscribe(strings.TrimSpace(*bookmarkSubject), func(msg *nats.Msg) {
+				mark, err := recorder.HandleBookmarkMessage(msg.Data)
+				if err != nil {
+					logs.Warn("camera_v1 bookmark failed: %v", err)
+				}
+				if msg.Reply != "" {
+					reply, _ := json.Marshal(map[string]any{"ok": err == nil, "bookmark": mark})
+					_ = msg.Respond(reply)
+				}
+			})
+			if err != nil {
+				return err
+			}
+			defer sub.Unsubscribe()
+		}
+		logs.Info("camera_v1 recording to %s segment=%s retain_age=%s retain_mb=%d", *recordDir, *segment, *retainAge, *retainMB)
+	}
 	ticker := time.NewTicker(*interval)
 	defer ticker.Stop()
 
-	logs.Info("camera_v1 started subject=%s nats=%s listen=%s", *subject, *natsURL, *listen)
+	logs.Info("camera_v1 started subject=%s nats=%s listen=%s source=%s", *subject, *natsURL, *listen, sourceCfg)
 	for {
 		select {
 		case <-ctx.Done():
@@ -112,5 +183,7 @@ func usage() {
 	logs.Raw("Usage: dialtone_camera_v1 <command>")
 	logs.Raw("Commands:")
 	logs.Raw("  run [--nats-url URL] [--subject camera.heartbeat] [--interval 1s] [--listen :19090]")
+	logs.Raw("      [--source v4l2[:DEVICE]|synthetic[:WxH]|file:PATH|remote:URL] [--fps 15] [--size 640x480]")
+	logs.Raw("      [--record-dir DIR] [--segment 1m] [--retain-age 24h] [--retain-mb 2048] [--record-fps 5] [--bookmark-subject camera.bookmark]")
 	logs.Raw("  version")
 }
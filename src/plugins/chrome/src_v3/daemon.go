@@ -28,6 +28,8 @@ func runDaemon(args []string) error {
 	natsPort := fs.Int("nats-port", 0, "NATS port")
 	natsURL := fs.String("nats-url", "", "Manager NATS URL to connect to instead of starting embedded NATS")
 	hostID := fs.String("host-id", "", "Logical host id for manager subject routing")
+	leafHub := fs.String("nats-leaf-hub", strings.TrimSpace(os.Getenv("DIALTONE_NATS_LEAF_HUB")), "REPL leader mesh node or leafnode hosts/URLs to federate embedded NATS with")
+	leafPort := fs.Int("nats-leaf-port", logs.DefaultLeafPort, "Leafnode port on the REPL leader")
 	_ = fs.Parse(args)
 
 	managerURL := strings.TrimSpace(*natsURL)
@@ -80,6 +82,12 @@ func runDaemon(args []string) error {
 	var err error
 	if state.embeddedNATS {
 		opts := &natsserver.Options{Host: "0.0.0.0", Port: state.natsPort}
+		if hub := strings.TrimSpace(*leafHub); hub != "" {
+			if err := logs.ConfigureLeafRemote(opts, logs.LeafRoleChrome, logs.LeafToken(), logs.LeafURLs(sshv1.ResolveRouteHosts(hub), *leafPort)); err != nil {
+				return err
+			}
+			logs.Info("chrome src_v3 daemon federating nats as leaf of %s", hub)
+		}
 		ns, err = natsserver.NewServer(opts)
 		if err != nil {
 			return err
@@ -0,0 +1,64 @@
+package src_v3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	diagnosticv1 "dialtone/dev/plugins/diagnostic/src_v1/go"
+)
+
+// RegisterDiagnostics adds the chrome.* checks to r.
+func RegisterDiagnostics(r *diagnosticv1.Registry) error {
+	return r.Register(diagnosticv1.Check{
+		Name:        "chrome.service",
+		Description: "Managed chrome src_v3 daemon reports a healthy browser",
+		Severity:    diagnosticv1.SeverityInfo,
+		DependsOn:   []string{"ssh.reachable"},
+		Remediation: "start it with ./dialtone.sh chrome src_v3 service --mode start --host <node>",
+		Run: func(ctx context.Context, t diagnosticv1.Target) (string, error) {
+			host := t.Name()
+			if t.Local() {
+				host = "local"
+			}
+			type result struct {
+				resp *CommandResponse
+				err  error
+			}
+			done := make(chan result, 1)
+			go func() {
+				resp, err := ServiceStatusByTarget(host, defaultRole)
+				done <- result{resp: resp, err: err}
+			}()
+			select {
+			case r := <-done:
+				if r.err != nil {
+					return "", fmt.Errorf("chrome status for role %s: %v", defaultRole, r.err)
+				}
+				return evaluateServiceStatus(r.resp)
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		},
+	})
+}
+
+// evaluateServiceStatus summarizes the daemon's fillStatus response.
+func evaluateServiceStatus(resp *CommandResponse) (string, error) {
+	if resp == nil {
+		return "", fmt.Errorf("chrome daemon returned no status")
+	}
+	msg := fmt.Sprintf("role=%s pid=%d port=%d processes=%d url=%s",
+		normalizeRole(resp.Role), resp.BrowserPID, resp.ChromePort, resp.ProcessCount, strings.TrimSpace(resp.CurrentURL))
+	if resp.Unhealthy {
+		reason := strings.TrimSpace(resp.Error)
+		if reason == "" {
+			reason = strings.TrimSpace(resp.LastError)
+		}
+		return "", fmt.Errorf("unhealthy: %s (%s)", reason, msg)
+	}
+	if resp.ProcessCount > 1 {
+		return "", diagnosticv1.Warnf("%d managed browser processes for one role (%s)", resp.ProcessCount, msg)
+	}
+	return msg, nil
+}
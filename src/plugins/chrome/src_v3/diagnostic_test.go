@@ -0,0 +1,19 @@
+package src_v3
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvaluateServiceStatus(t *testing.T) {
+	msg, err := evaluateServiceStatus(&CommandResponse{Role: "dev", BrowserPID: 42, ChromePort: 9333, ProcessCount: 1, CurrentURL: "about:blank"})
+	if err != nil || msg != "role=dev pid=42 port=9333 processes=1 url=about:blank" {
+		t.Fatalf("healthy status = %q, %v", msg, err)
+	}
+	if _, err := evaluateServiceStatus(&CommandResponse{Role: "dev", Unhealthy: true, Error: "browser is not running"}); err == nil || !strings.Contains(err.Error(), "browser is not running") {
+		t.Fatalf("expected unhealthy status to fail, got %v", err)
+	}
+	if _, err := evaluateServiceStatus(&CommandResponse{Role: "dev", BrowserPID: 42, ProcessCount: 3}); err == nil || !strings.Contains(err.Error(), "3 managed browser processes") {
+		t.Fatalf("expected duplicate browsers to warn, got %v", err)
+	}
+}
@@ -96,7 +96,7 @@ func runSrcV1(command string, args []string) error {
 		}
 		// src_v1 serve with args delegates runtime tunnel serve behavior.
 		return cloudflare_ops.RunRuntime("serve", args)
-	case "login", "tunnel", "robot", "proxy", "provision", "setup-service", "shell":
+	case "login", "tunnel", "robot", "proxy", "provision", "plan", "apply", "setup-service", "shell":
 		return cloudflare_ops.RunRuntime(command, args)
 	default:
 		return fmt.Errorf("unknown cloudflare command: %s", command)
@@ -124,5 +124,7 @@ func printUsage() {
 	logs.Raw("  robot        Expose a remote robot via tunnel")
 	logs.Raw("  proxy        Start local TCP proxy")
 	logs.Raw("  provision    Create tunnel + DNS and store token in env/dialtone.json")
+	logs.Raw("  plan         Diff env/cloudflare-tunnels.json against Cloudflare (--exit-code for drift checks)")
+	logs.Raw("  apply        Apply the tunnel spec plan (--yes to make changes)")
 	logs.Raw("  setup-service Install cloudflare robot proxy as a service")
 }
@@ -0,0 +1,117 @@
+package ops
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	cloudflarev1 "dialtone/dev/plugins/cloudflare/src_v1/go"
+	logs "dialtone/dev/plugins/logs/src_v1/go"
+)
+
+type fleetFlags struct {
+	spec      *string
+	apiToken  *string
+	accountID *string
+	jsonOut   *bool
+}
+
+func bindFleetFlags(fs *flag.FlagSet) fleetFlags {
+	return fleetFlags{
+		spec:      fs.String("spec", filepath.Join(filepath.Dir(resolveRuntimeEnvPath()), "cloudflare-tunnels.json"), "tunnel fleet spec (JSON)"),
+		apiToken:  fs.String("api-token", lookupConfigString("CLOUDFLARE_API_TOKEN"), "cloudflare api token"),
+		accountID: fs.String("account-id", lookupConfigString("CLOUDFLARE_ACCOUNT_ID"), "cloudflare account id (overrides the spec)"),
+		jsonOut:   fs.Bool("json", false, "print the plan as JSON"),
+	}
+}
+
+func (f fleetFlags) plan(ctx context.Context) (cloudflarev1.API, cloudflarev1.TunnelPlan, error) {
+	spec, err := cloudflarev1.LoadTunnelFleetSpec(strings.TrimSpace(*f.spec))
+	if err != nil {
+		return nil, cloudflarev1.TunnelPlan{}, err
+	}
+	if v := strings.TrimSpace(*f.accountID); v != "" {
+		spec.AccountID = v
+	}
+	if strings.TrimSpace(*f.apiToken) == "" {
+		return nil, cloudflarev1.TunnelPlan{}, fmt.Errorf("api token is required (CLOUDFLARE_API_TOKEN or --api-token)")
+	}
+	api := cloudflarev1.NewHTTPAPI(*f.apiToken)
+	replIndexInfof("cloudflare plan: reading %d tunnel(s) in %s", len(spec.Tunnels), spec.Zone)
+	plan, err := cloudflarev1.PlanTunnels(ctx, api, spec)
+	return api, plan, err
+}
+
+func printTunnelPlan(plan cloudflarev1.TunnelPlan, asJSON bool) {
+	if asJSON {
+		b, _ := json.MarshalIndent(plan, "", "  ")
+		fmt.Println(string(b))
+		return
+	}
+	if plan.Empty() {
+		logs.Raw("No changes. Cloudflare matches the tunnel spec.")
+		return
+	}
+	for _, line := range plan.Lines() {
+		logs.Raw("%s", line)
+	}
+	logs.Raw("")
+	logs.Raw("Plan: %d change(s) in zone %s", len(plan.Changes), plan.Zone)
+}
+
+// runPlan diffs the tunnel spec against Cloudflare. --exit-code turns drift
+// into an error so CI can alert on it.
+func runPlan(args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	flags := bindFleetFlags(fs)
+	exitCode := fs.Bool("exit-code", false, "fail when the plan is not empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	_, plan, err := flags.plan(context.Background())
+	if err != nil {
+		return err
+	}
+	printTunnelPlan(plan, *flags.jsonOut)
+	if *exitCode && !plan.Empty() {
+		return fmt.Errorf("cloudflare drift detected: %d change(s)", len(plan.Changes))
+	}
+	return nil
+}
+
+func runApply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	flags := bindFleetFlags(fs)
+	yes := fs.Bool("yes", false, "apply without stopping after the plan")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	api, plan, err := flags.plan(context.Background())
+	if err != nil {
+		return err
+	}
+	printTunnelPlan(plan, *flags.jsonOut)
+	if plan.Empty() {
+		return nil
+	}
+	if !*yes {
+		return fmt.Errorf("re-run with --yes to apply %d change(s)", len(plan.Changes))
+	}
+	applied, err := cloudflarev1.ApplyTunnelPlan(context.Background(), api, plan, cloudflarev1.ApplyOptions{
+		EnvPath: resolveRuntimeEnvPath(),
+		OnChange: func(c cloudflarev1.TunnelChange) {
+			replIndexInfof("cloudflare apply: %s %s %s", c.Action, c.Kind, c.Name)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("applied %d of %d change(s): %w", len(applied), len(plan.Changes), err)
+	}
+	replIndexInfof("cloudflare apply: %d change(s) applied", len(applied))
+	return nil
+}
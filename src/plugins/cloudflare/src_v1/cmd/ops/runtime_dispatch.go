@@ -92,6 +92,10 @@ func RunRuntime(command string, args []string) error {
 		return runProxy(args)
 	case "provision":
 		return runProvision(args)
+	case "plan":
+		return runPlan(args)
+	case "apply":
+		return runApply(args)
 	case "setup-service":
 		return fmt.Errorf("setup-service is not yet migrated to src_v1 ops")
 	case "shell":
@@ -0,0 +1,284 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// API is the slice of the Cloudflare v4 API that plan and apply need.
+// HTTPAPI talks to Cloudflare; FakeAPI keeps state in memory for tests.
+type API interface {
+	ZoneID(ctx context.Context, zone string) (string, error)
+	ListTunnels(ctx context.Context, accountID string) ([]RemoteTunnel, error)
+	CreateTunnel(ctx context.Context, accountID, name string) (RemoteTunnel, error)
+	TunnelToken(ctx context.Context, accountID, tunnelID string) (string, error)
+	GetTunnelConfig(ctx context.Context, accountID, tunnelID string) (TunnelConfig, error)
+	PutTunnelConfig(ctx context.Context, accountID, tunnelID string, cfg TunnelConfig) error
+	ListDNSRecords(ctx context.Context, zoneID string) ([]DNSRecord, error)
+	CreateDNSRecord(ctx context.Context, zoneID string, rec DNSRecord) (DNSRecord, error)
+	UpdateDNSRecord(ctx context.Context, zoneID string, rec DNSRecord) error
+	DeleteDNSRecord(ctx context.Context, zoneID, recordID string) error
+	ListAccessApps(ctx context.Context, accountID string) ([]AccessApp, error)
+	CreateAccessApp(ctx context.Context, accountID string, app AccessApp) (AccessApp, error)
+	UpdateAccessApp(ctx context.Context, accountID string, app AccessApp) error
+	DeleteAccessApp(ctx context.Context, accountID, appID string) error
+}
+
+type RemoteTunnel struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type TunnelConfig struct {
+	Ingress       []IngressRule  `json:"ingress"`
+	OriginRequest *OriginRequest `json:"originRequest,omitempty"`
+}
+
+type DNSRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	Proxied bool   `json:"proxied"`
+}
+
+// AccessApp is a self-hosted Access application with one allow policy.
+type AccessApp struct {
+	ID              string   `json:"id,omitempty"`
+	Name            string   `json:"name"`
+	Domain          string   `json:"domain"`
+	SessionDuration string   `json:"session_duration"`
+	AllowEmails     []string `json:"allow_emails,omitempty"`
+	AllowDomains    []string `json:"allow_email_domains,omitempty"`
+}
+
+func tunnelCNAME(tunnelID string) string {
+	return tunnelID + ".cfargotunnel.com"
+}
+
+type HTTPAPI struct {
+	Token   string
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewHTTPAPI(token string) *HTTPAPI {
+	return &HTTPAPI{Token: strings.TrimSpace(token), BaseURL: "https://api.cloudflare.com/client/v4", Client: &http.Client{}}
+}
+
+type apiEnvelope struct {
+	Success bool            `json:"success"`
+	Result  json.RawMessage `json:"result"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (c *HTTPAPI) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.BaseURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	var env apiEnvelope
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err := json.Unmarshal(raw, &env); err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 || !env.Success {
+		msg := strings.TrimSpace(string(raw))
+		if len(env.Errors) > 0 {
+			msg = env.Errors[0].Message
+		}
+		return fmt.Errorf("%s %s failed: status=%d %s", method, path, resp.StatusCode, msg)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(env.Result, out); err != nil {
+		return fmt.Errorf("decode %s %s result: %w", method, path, err)
+	}
+	return nil
+}
+
+func (c *HTTPAPI) ZoneID(ctx context.Context, zone string) (string, error) {
+	var zones []struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(zone), nil, &zones); err != nil {
+		return "", err
+	}
+	if len(zones) == 0 {
+		return "", fmt.Errorf("zone %s not found", zone)
+	}
+	return zones[0].ID, nil
+}
+
+func (c *HTTPAPI) ListTunnels(ctx context.Context, accountID string) ([]RemoteTunnel, error) {
+	var out []RemoteTunnel
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/accounts/%s/cfd_tunnel?is_deleted=false&per_page=1000", accountID), nil, &out)
+	return out, err
+}
+
+func (c *HTTPAPI) CreateTunnel(ctx context.Context, accountID, name string) (RemoteTunnel, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return RemoteTunnel{}, fmt.Errorf("secret generation failed: %w", err)
+	}
+	payload := map[string]string{
+		"name":          name,
+		"config_src":    "cloudflare",
+		"tunnel_secret": base64.StdEncoding.EncodeToString(secret),
+	}
+	var out RemoteTunnel
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/accounts/%s/cfd_tunnel", accountID), payload, &out)
+	return out, err
+}
+
+func (c *HTTPAPI) TunnelToken(ctx context.Context, accountID, tunnelID string) (string, error) {
+	var token string
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/accounts/%s/cfd_tunnel/%s/token", accountID, tunnelID), nil, &token)
+	return strings.TrimSpace(token), err
+}
+
+func (c *HTTPAPI) GetTunnelConfig(ctx context.Context, accountID, tunnelID string) (TunnelConfig, error) {
+	var out struct {
+		Config *TunnelConfig `json:"config"`
+	}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/accounts/%s/cfd_tunnel/%s/configurations", accountID, tunnelID), nil, &out); err != nil {
+		return TunnelConfig{}, err
+	}
+	if out.Config == nil {
+		return TunnelConfig{}, nil
+	}
+	return *out.Config, nil
+}
+
+func (c *HTTPAPI) PutTunnelConfig(ctx context.Context, accountID, tunnelID string, cfg TunnelConfig) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/accounts/%s/cfd_tunnel/%s/configurations", accountID, tunnelID), map[string]any{"config": cfg}, nil)
+}
+
+func (c *HTTPAPI) ListDNSRecords(ctx context.Context, zoneID string) ([]DNSRecord, error) {
+	var out []DNSRecord
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/zones/%s/dns_records?per_page=5000", zoneID), nil, &out)
+	return out, err
+}
+
+func (c *HTTPAPI) CreateDNSRecord(ctx context.Context, zoneID string, rec DNSRecord) (DNSRecord, error) {
+	var out DNSRecord
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/zones/%s/dns_records", zoneID), dnsPayload(rec), &out)
+	return out, err
+}
+
+func (c *HTTPAPI) UpdateDNSRecord(ctx context.Context, zoneID string, rec DNSRecord) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, rec.ID), dnsPayload(rec), nil)
+}
+
+func dnsPayload(rec DNSRecord) map[string]any {
+	return map[string]any{"type": rec.Type, "name": rec.Name, "content": rec.Content, "proxied": rec.Proxied, "ttl": 1}
+}
+
+func (c *HTTPAPI) DeleteDNSRecord(ctx context.Context, zoneID, recordID string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, recordID), nil, nil)
+}
+
+// accessAppWire is the Access application shape on the wire, with the allow
+// policy inlined.
+type accessAppWire struct {
+	ID              string `json:"id,omitempty"`
+	Name            string `json:"name"`
+	Domain          string `json:"domain"`
+	Type            string `json:"type"`
+	SessionDuration string `json:"session_duration"`
+	Policies        []struct {
+		Name     string           `json:"name"`
+		Decision string           `json:"decision"`
+		Include  []map[string]any `json:"include"`
+	} `json:"policies"`
+}
+
+func (c *HTTPAPI) ListAccessApps(ctx context.Context, accountID string) ([]AccessApp, error) {
+	var wire []accessAppWire
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/accounts/%s/access/apps", accountID), nil, &wire); err != nil {
+		return nil, err
+	}
+	out := make([]AccessApp, 0, len(wire))
+	for _, w := range wire {
+		app := AccessApp{ID: w.ID, Name: w.Name, Domain: w.Domain, SessionDuration: w.SessionDuration}
+		for _, p := range w.Policies {
+			if p.Decision != "allow" {
+				continue
+			}
+			for _, inc := range p.Include {
+				if v, ok := inc["email"].(map[string]any); ok {
+					app.AllowEmails = append(app.AllowEmails, fmt.Sprint(v["email"]))
+				}
+				if v, ok := inc["email_domain"].(map[string]any); ok {
+					app.AllowDomains = append(app.AllowDomains, fmt.Sprint(v["domain"]))
+				}
+			}
+		}
+		out = append(out, app)
+	}
+	return out, nil
+}
+
+func accessAppPayload(app AccessApp) map[string]any {
+	include := []map[string]any{}
+	for _, email := range app.AllowEmails {
+		include = append(include, map[string]any{"email": map[string]string{"email": email}})
+	}
+	for _, domain := range app.AllowDomains {
+		include = append(include, map[string]any{"email_domain": map[string]string{"domain": domain}})
+	}
+	return map[string]any{
+		"name":             app.Name,
+		"domain":           app.Domain,
+		"type":             "self_hosted",
+		"session_duration": app.SessionDuration,
+		"policies": []map[string]any{{
+			"name":     app.Name + " allow",
+			"decision": "allow",
+			"include":  include,
+		}},
+	}
+}
+
+func (c *HTTPAPI) CreateAccessApp(ctx context.Context, accountID string, app AccessApp) (AccessApp, error) {
+	var wire accessAppWire
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/accounts/%s/access/apps", accountID), accessAppPayload(app), &wire); err != nil {
+		return AccessApp{}, err
+	}
+	app.ID = wire.ID
+	return app, nil
+}
+
+func (c *HTTPAPI) UpdateAccessApp(ctx context.Context, accountID string, app AccessApp) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/accounts/%s/access/apps/%s", accountID, app.ID), accessAppPayload(app), nil)
+}
+
+func (c *HTTPAPI) DeleteAccessApp(ctx context.Context, accountID, appID string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/accounts/%s/access/apps/%s", accountID, appID), nil, nil)
+}
@@ -0,0 +1,175 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// FakeAPI is an in-memory API for one account and its zones. Calls records
+// every mutating call as "<Method> <name>" so tests can assert apply order.
+type FakeAPI struct {
+	mu      sync.Mutex
+	nextID  int
+	Zones   map[string]string
+	Tunnels []RemoteTunnel
+	Configs map[string]TunnelConfig
+	Records map[string][]DNSRecord
+	Apps    []AccessApp
+	Calls   []string
+}
+
+func NewFakeAPI(zones ...string) *FakeAPI {
+	f := &FakeAPI{Zones: map[string]string{}, Configs: map[string]TunnelConfig{}, Records: map[string][]DNSRecord{}}
+	for _, zone := range zones {
+		f.Zones[zone] = f.id("zone")
+	}
+	return f
+}
+
+func (f *FakeAPI) id(prefix string) string {
+	f.nextID++
+	return fmt.Sprintf("%s-%d", prefix, f.nextID)
+}
+
+func (f *FakeAPI) record(call string) {
+	f.Calls = append(f.Calls, call)
+}
+
+func (f *FakeAPI) ZoneID(_ context.Context, zone string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if id, ok := f.Zones[zone]; ok {
+		return id, nil
+	}
+	return "", fmt.Errorf("zone %s not found", zone)
+}
+
+func (f *FakeAPI) ListTunnels(context.Context, string) ([]RemoteTunnel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]RemoteTunnel(nil), f.Tunnels...), nil
+}
+
+func (f *FakeAPI) CreateTunnel(_ context.Context, _ string, name string) (RemoteTunnel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range f.Tunnels {
+		if t.Name == name {
+			return RemoteTunnel{}, fmt.Errorf("tunnel %s already exists", name)
+		}
+	}
+	t := RemoteTunnel{ID: f.id("tunnel"), Name: name}
+	f.Tunnels = append(f.Tunnels, t)
+	f.record("CreateTunnel " + name)
+	return t, nil
+}
+
+func (f *FakeAPI) TunnelToken(_ context.Context, _ string, tunnelID string) (string, error) {
+	return "token-" + tunnelID, nil
+}
+
+func (f *FakeAPI) GetTunnelConfig(_ context.Context, _ string, tunnelID string) (TunnelConfig, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return cloneConfig(f.Configs[tunnelID]), nil
+}
+
+func (f *FakeAPI) PutTunnelConfig(_ context.Context, _ string, tunnelID string, cfg TunnelConfig) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Configs[tunnelID] = cloneConfig(cfg)
+	f.record("PutTunnelConfig " + tunnelID)
+	return nil
+}
+
+// cloneConfig deep-copies through JSON, the same way the real API would.
+func cloneConfig(cfg TunnelConfig) TunnelConfig {
+	raw, _ := json.Marshal(cfg)
+	var out TunnelConfig
+	_ = json.Unmarshal(raw, &out)
+	return out
+}
+
+func (f *FakeAPI) ListDNSRecords(_ context.Context, zoneID string) ([]DNSRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]DNSRecord(nil), f.Records[zoneID]...), nil
+}
+
+func (f *FakeAPI) CreateDNSRecord(_ context.Context, zoneID string, rec DNSRecord) (DNSRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rec.ID = f.id("dns")
+	f.Records[zoneID] = append(f.Records[zoneID], rec)
+	f.record("CreateDNSRecord " + rec.Name)
+	return rec, nil
+}
+
+func (f *FakeAPI) UpdateDNSRecord(_ context.Context, zoneID string, rec DNSRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, existing := range f.Records[zoneID] {
+		if existing.ID == rec.ID {
+			f.Records[zoneID][i] = rec
+			f.record("UpdateDNSRecord " + rec.Name)
+			return nil
+		}
+	}
+	return fmt.Errorf("dns record %s not found", rec.ID)
+}
+
+func (f *FakeAPI) DeleteDNSRecord(_ context.Context, zoneID, recordID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, existing := range f.Records[zoneID] {
+		if existing.ID == recordID {
+			f.Records[zoneID] = append(f.Records[zoneID][:i], f.Records[zoneID][i+1:]...)
+			f.record("DeleteDNSRecord " + existing.Name)
+			return nil
+		}
+	}
+	return fmt.Errorf("dns record %s not found", recordID)
+}
+
+func (f *FakeAPI) ListAccessApps(context.Context, string) ([]AccessApp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]AccessApp(nil), f.Apps...), nil
+}
+
+func (f *FakeAPI) CreateAccessApp(_ context.Context, _ string, app AccessApp) (AccessApp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	app.ID = f.id("app")
+	f.Apps = append(f.Apps, app)
+	f.record("CreateAccessApp " + app.Domain)
+	return app, nil
+}
+
+func (f *FakeAPI) UpdateAccessApp(_ context.Context, _ string, app AccessApp) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, existing := range f.Apps {
+		if existing.ID == app.ID {
+			f.Apps[i] = app
+			f.record("UpdateAccessApp " + app.Domain)
+			return nil
+		}
+	}
+	return fmt.Errorf("access app %s not found", app.ID)
+}
+
+func (f *FakeAPI) DeleteAccessApp(_ context.Context, _ string, appID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, existing := range f.Apps {
+		if existing.ID == appID {
+			f.Apps = append(f.Apps[:i], f.Apps[i+1:]...)
+			f.record("DeleteAccessApp " + existing.Domain)
+			return nil
+		}
+	}
+	return fmt.Errorf("access app %s not found", appID)
+}
@@ -0,0 +1,376 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+	// ChangeConflict marks a change apply cannot make, such as a CNAME for a
+	// hostname that already has A or AAAA records.
+	ChangeConflict = "conflict"
+)
+
+// TunnelChange is one API mutation needed to reach the spec.
+type TunnelChange struct {
+	Action string `json:"action"`
+	Kind   string `json:"kind"`
+	Tunnel string `json:"tunnel,omitempty"`
+	Name   string `json:"name"`
+	Detail string `json:"detail,omitempty"`
+
+	config *TunnelConfig
+	record DNSRecord
+	app    AccessApp
+}
+
+// TunnelPlan is the diff between a TunnelFleetSpec and the account. An
+// empty plan means no drift.
+type TunnelPlan struct {
+	AccountID string         `json:"account_id"`
+	Zone      string         `json:"zone"`
+	ZoneID    string         `json:"zone_id"`
+	Changes   []TunnelChange `json:"changes"`
+
+	tunnelIDs map[string]string
+}
+
+func (p TunnelPlan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// Conflicts returns the changes that need manual cleanup before apply.
+func (p TunnelPlan) Conflicts() []TunnelChange {
+	var out []TunnelChange
+	for _, c := range p.Changes {
+		if c.Action == ChangeConflict {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Lines renders the plan as "+ kind name: detail" lines; ~ marks updates
+// and ! conflicts.
+func (p TunnelPlan) Lines() []string {
+	out := make([]string, 0, len(p.Changes))
+	for _, c := range p.Changes {
+		mark := map[string]string{ChangeCreate: "+", ChangeUpdate: "~", ChangeDelete: "-", ChangeConflict: "!"}[c.Action]
+		line := fmt.Sprintf("%s %s %s", mark, c.Kind, c.Name)
+		if c.Detail != "" {
+			line += ": " + c.Detail
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// PlanTunnels reads the account and zone and lists the changes apply would
+// make. Tunnels not in the spec, DNS records not pointing at a spec tunnel
+// and Access apps without the dialtone: prefix are never touched. A spec
+// hostname that already has other record types (A, AAAA, ...) is reported
+// as a conflict instead of being overwritten.
+func PlanTunnels(ctx context.Context, api API, spec TunnelFleetSpec) (TunnelPlan, error) {
+	if strings.TrimSpace(spec.AccountID) == "" {
+		return TunnelPlan{}, fmt.Errorf("account id is required")
+	}
+	plan := TunnelPlan{AccountID: spec.AccountID, Zone: spec.Zone, tunnelIDs: map[string]string{}}
+	zoneID, err := api.ZoneID(ctx, spec.Zone)
+	if err != nil {
+		return TunnelPlan{}, err
+	}
+	plan.ZoneID = zoneID
+
+	remote, err := api.ListTunnels(ctx, spec.AccountID)
+	if err != nil {
+		return TunnelPlan{}, err
+	}
+	for _, t := range remote {
+		plan.tunnelIDs[t.Name] = t.ID
+	}
+	var dnsCreates, accessChanges, deletes []TunnelChange
+	wantDNS := map[string]bool{}
+	managedTargets := map[string]string{}
+	for _, t := range spec.Tunnels {
+		id := plan.tunnelIDs[t.Name]
+		desired := normalizeConfig(t.config())
+		if id == "" {
+			plan.Changes = append(plan.Changes, TunnelChange{Action: ChangeCreate, Kind: "tunnel", Tunnel: t.Name, Name: t.Name})
+			plan.Changes = append(plan.Changes, TunnelChange{Action: ChangeCreate, Kind: "ingress", Tunnel: t.Name, Name: t.Name, Detail: strings.Join(ingressDiff(TunnelConfig{}, desired), ", "), config: &desired})
+		} else {
+			managedTargets[tunnelCNAME(id)] = t.Name
+			current, err := api.GetTunnelConfig(ctx, spec.AccountID, id)
+			if err != nil {
+				return TunnelPlan{}, err
+			}
+			current = normalizeConfig(current)
+			if !sameJSON(current, desired) {
+				diff := ingressDiff(current, desired)
+				if len(diff) == 0 {
+					diff = []string{"origin settings changed"}
+				}
+				plan.Changes = append(plan.Changes, TunnelChange{Action: ChangeUpdate, Kind: "ingress", Tunnel: t.Name, Name: t.Name, Detail: strings.Join(diff, ", "), config: &desired})
+			}
+		}
+		for _, host := range t.Hostnames() {
+			wantDNS[host] = true
+			dnsCreates = append(dnsCreates, TunnelChange{Tunnel: t.Name, Name: host, record: DNSRecord{Type: "CNAME", Name: host, Proxied: true}})
+		}
+	}
+
+	records, err := api.ListDNSRecords(ctx, zoneID)
+	if err != nil {
+		return TunnelPlan{}, err
+	}
+	byName := map[string][]DNSRecord{}
+	for _, rec := range records {
+		byName[strings.ToLower(rec.Name)] = append(byName[strings.ToLower(rec.Name)], rec)
+		if owner, ok := managedTargets[rec.Content]; ok && rec.Type == "CNAME" && !wantDNS[strings.ToLower(rec.Name)] {
+			deletes = append(deletes, TunnelChange{Action: ChangeDelete, Kind: "dns", Tunnel: owner, Name: rec.Name, Detail: "was " + rec.Content, record: rec})
+		}
+	}
+	for _, c := range dnsCreates {
+		var existing *DNSRecord
+		var others []string
+		for _, rec := range byName[c.Name] {
+			if rec.Type == "CNAME" {
+				existing = &rec
+				continue
+			}
+			others = append(others, rec.Type+" "+rec.Content)
+		}
+		target := tunnelCNAME(plan.tunnelIDs[c.Tunnel])
+		if plan.tunnelIDs[c.Tunnel] == "" {
+			target = "<new " + c.Tunnel + ">.cfargotunnel.com"
+		}
+		switch {
+		case len(others) > 0:
+			// A CNAME cannot share its name with other records, and these
+			// are not ours to replace.
+			sort.Strings(others)
+			c.Action = ChangeConflict
+			c.Detail = fmt.Sprintf("%s already exist; remove them to route CNAME %s", strings.Join(others, ", "), target)
+		case existing == nil:
+			c.Action = ChangeCreate
+			c.Detail = "CNAME " + target
+		case existing.Content != target || !existing.Proxied:
+			c.Action = ChangeUpdate
+			c.Detail = fmt.Sprintf("%s %s -> CNAME %s", existing.Type, existing.Content, target)
+			c.record.ID = existing.ID
+		default:
+			continue
+		}
+		c.Kind = "dns"
+		plan.Changes = append(plan.Changes, c)
+	}
+
+	apps, err := api.ListAccessApps(ctx, spec.AccountID)
+	if err != nil {
+		return TunnelPlan{}, err
+	}
+	appsByDomain := map[string]AccessApp{}
+	for _, app := range apps {
+		appsByDomain[strings.ToLower(app.Domain)] = app
+	}
+	wantApps := map[string]bool{}
+	for _, t := range spec.Tunnels {
+		for _, policy := range t.Access {
+			desired := policy.app()
+			wantApps[desired.Domain] = true
+			existing, ok := appsByDomain[desired.Domain]
+			switch {
+			case !ok:
+				accessChanges = append(accessChanges, TunnelChange{Action: ChangeCreate, Kind: "access", Tunnel: t.Name, Name: desired.Domain, Detail: accessSummary(desired), app: desired})
+			case !strings.HasPrefix(existing.Name, accessAppPrefix):
+				return TunnelPlan{}, fmt.Errorf("access app %q already protects %s and is not managed by this spec", existing.Name, desired.Domain)
+			case !sameAccessApp(existing, desired):
+				desired.ID = existing.ID
+				accessChanges = append(accessChanges, TunnelChange{Action: ChangeUpdate, Kind: "access", Tunnel: t.Name, Name: desired.Domain, Detail: accessSummary(existing) + " -> " + accessSummary(desired), app: desired})
+			}
+		}
+	}
+	for _, app := range apps {
+		domain := strings.ToLower(app.Domain)
+		inZone := domain == spec.Zone || strings.HasSuffix(domain, "."+spec.Zone)
+		if strings.HasPrefix(app.Name, accessAppPrefix) && inZone && !wantApps[domain] {
+			deletes = append(deletes, TunnelChange{Action: ChangeDelete, Kind: "access", Name: app.Domain, Detail: accessSummary(app), app: app})
+		}
+	}
+	plan.Changes = append(plan.Changes, accessChanges...)
+	plan.Changes = append(plan.Changes, deletes...)
+	return plan, nil
+}
+
+type ApplyOptions struct {
+	// EnvPath receives CF_TUNNEL_TOKEN_<NAME> for each created tunnel.
+	EnvPath string
+	// OnChange is called after each change succeeds.
+	OnChange func(TunnelChange)
+}
+
+// ApplyTunnelPlan executes plan in order and stops at the first failure,
+// returning the changes that were applied. A plan with conflicts is refused
+// before any change is made.
+func ApplyTunnelPlan(ctx context.Context, api API, plan TunnelPlan, opts ApplyOptions) ([]TunnelChange, error) {
+	if conflicts := plan.Conflicts(); len(conflicts) > 0 {
+		names := make([]string, 0, len(conflicts))
+		for _, c := range conflicts {
+			names = append(names, c.Name)
+		}
+		return nil, fmt.Errorf("resolve %d DNS conflict(s) first: %s", len(conflicts), strings.Join(names, ", "))
+	}
+	var applied []TunnelChange
+	ids := map[string]string{}
+	for name, id := range plan.tunnelIDs {
+		ids[name] = id
+	}
+	for _, c := range plan.Changes {
+		if err := applyTunnelChange(ctx, api, plan, ids, c, opts); err != nil {
+			return applied, fmt.Errorf("%s %s %s: %w", c.Action, c.Kind, c.Name, err)
+		}
+		applied = append(applied, c)
+		if opts.OnChange != nil {
+			opts.OnChange(c)
+		}
+	}
+	return applied, nil
+}
+
+func applyTunnelChange(ctx context.Context, api API, plan TunnelPlan, ids map[string]string, c TunnelChange, opts ApplyOptions) error {
+	switch c.Kind {
+	case "tunnel":
+		t, err := api.CreateTunnel(ctx, plan.AccountID, c.Name)
+		if err != nil {
+			return err
+		}
+		ids[c.Name] = t.ID
+		if strings.TrimSpace(opts.EnvPath) == "" {
+			return nil
+		}
+		token, err := api.TunnelToken(ctx, plan.AccountID, t.ID)
+		if err != nil {
+			return err
+		}
+		return upsertConfigVar(opts.EnvPath, TokenEnvKey(c.Name), token)
+	case "ingress":
+		return api.PutTunnelConfig(ctx, plan.AccountID, ids[c.Tunnel], *c.config)
+	case "dns":
+		rec := c.record
+		switch c.Action {
+		case ChangeDelete:
+			return api.DeleteDNSRecord(ctx, plan.ZoneID, rec.ID)
+		case ChangeUpdate:
+			rec.Content = tunnelCNAME(ids[c.Tunnel])
+			return api.UpdateDNSRecord(ctx, plan.ZoneID, rec)
+		default:
+			rec.Content = tunnelCNAME(ids[c.Tunnel])
+			_, err := api.CreateDNSRecord(ctx, plan.ZoneID, rec)
+			return err
+		}
+	case "access":
+		switch c.Action {
+		case ChangeDelete:
+			return api.DeleteAccessApp(ctx, plan.AccountID, c.app.ID)
+		case ChangeUpdate:
+			return api.UpdateAccessApp(ctx, plan.AccountID, c.app)
+		default:
+			_, err := api.CreateAccessApp(ctx, plan.AccountID, c.app)
+			return err
+		}
+	}
+	return fmt.Errorf("unknown change kind %q", c.Kind)
+}
+
+// normalizeConfig drops empty origin settings, which the API returns as {}
+// and the spec leaves out.
+func normalizeConfig(cfg TunnelConfig) TunnelConfig {
+	out := TunnelConfig{OriginRequest: cfg.OriginRequest}
+	if out.OriginRequest != nil && *out.OriginRequest == (OriginRequest{}) {
+		out.OriginRequest = nil
+	}
+	for _, rule := range cfg.Ingress {
+		if rule.OriginRequest != nil && *rule.OriginRequest == (OriginRequest{}) {
+			rule.OriginRequest = nil
+		}
+		out.Ingress = append(out.Ingress, rule)
+	}
+	return out
+}
+
+func sameJSON(a, b any) bool {
+	ra, _ := json.Marshal(a)
+	rb, _ := json.Marshal(b)
+	return string(ra) == string(rb)
+}
+
+// ingressDiff summarises rule changes keyed by hostname and path.
+func ingressDiff(current, desired TunnelConfig) []string {
+	key := func(r IngressRule) string {
+		host := r.Hostname
+		if host == "" {
+			host = "*"
+		}
+		return host + r.Path
+	}
+	before := map[string]IngressRule{}
+	for _, r := range current.Ingress {
+		before[key(r)] = r
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, r := range desired.Ingress {
+		k := key(r)
+		seen[k] = true
+		old, ok := before[k]
+		switch {
+		case !ok:
+			out = append(out, fmt.Sprintf("+%s -> %s", k, r.Service))
+		case old.Service != r.Service:
+			out = append(out, fmt.Sprintf("~%s %s -> %s", k, old.Service, r.Service))
+		case !sameJSON(old.OriginRequest, r.OriginRequest):
+			out = append(out, fmt.Sprintf("~%s origin settings", k))
+		}
+	}
+	var removed []string
+	for k := range before {
+		if !seen[k] {
+			removed = append(removed, "-"+k)
+		}
+	}
+	sort.Strings(removed)
+	return append(out, removed...)
+}
+
+func sameAccessApp(a, b AccessApp) bool {
+	sortedA := AccessApp{Name: a.Name, Domain: strings.ToLower(a.Domain), SessionDuration: a.SessionDuration, AllowEmails: sortedCopy(a.AllowEmails), AllowDomains: sortedCopy(a.AllowDomains)}
+	sortedB := AccessApp{Name: b.Name, Domain: strings.ToLower(b.Domain), SessionDuration: b.SessionDuration, AllowEmails: sortedCopy(b.AllowEmails), AllowDomains: sortedCopy(b.AllowDomains)}
+	return sameJSON(sortedA, sortedB)
+}
+
+func sortedCopy(in []string) []string {
+	if len(in) == 0 {
+		return nil
+	}
+	out := append([]string(nil), in...)
+	sort.Strings(out)
+	return out
+}
+
+func accessSummary(app AccessApp) string {
+	allow := append(append([]string(nil), app.AllowEmails...), prefixAll("@", app.AllowDomains)...)
+	return fmt.Sprintf("allow %s for %s", strings.Join(allow, ","), app.SessionDuration)
+}
+
+func prefixAll(prefix string, in []string) []string {
+	out := make([]string, 0, len(in))
+	for _, s := range in {
+		out = append(out, prefix+s)
+	}
+	return out
+}
@@ -0,0 +1,163 @@
+package cloudflare
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testFleetSpec(t *testing.T) TunnelFleetSpec {
+	t.Helper()
+	spec := TunnelFleetSpec{
+		AccountID: "acct",
+		Zone:      "dialtone.earth",
+		Tunnels: []TunnelSpec{{
+			Name:          "rover-1",
+			OriginRequest: &OriginRequest{ConnectTimeout: 30},
+			Ingress: []IngressRule{
+				{Hostname: "rover-1", Service: "http://127.0.0.1:8080"},
+				{Hostname: "cad.rover-1", Service: "http://127.0.0.1:8081", OriginRequest: &OriginRequest{NoTLSVerify: true}},
+			},
+			Access: []AccessPolicy{{Hostname: "cad.rover-1", AllowDomains: []string{"dialtone.earth"}}},
+		}},
+	}
+	if err := spec.Normalize(); err != nil {
+		t.Fatalf("Normalize returned error: %v", err)
+	}
+	return spec
+}
+
+func TestNormalizeQualifiesHostnamesAndAddsCatchAll(t *testing.T) {
+	spec := testFleetSpec(t)
+	tun := spec.Tunnels[0]
+	if got := strings.Join(tun.Hostnames(), ","); got != "rover-1.dialtone.earth,cad.rover-1.dialtone.earth" {
+		t.Fatalf("unexpected hostnames: %s", got)
+	}
+	if last := tun.Ingress[len(tun.Ingress)-1]; last.Hostname != "" || last.Service != catchAllService {
+		t.Fatalf("missing catch-all rule: %+v", last)
+	}
+	if tun.Access[0].Name != "cad.rover-1.dialtone.earth" || tun.Access[0].SessionDuration != "24h" {
+		t.Fatalf("access defaults not applied: %+v", tun.Access[0])
+	}
+
+	bad := TunnelFleetSpec{Tunnels: []TunnelSpec{
+		{Name: "a", Ingress: []IngressRule{{Hostname: "x", Service: "http://a"}}},
+		{Name: "b", Ingress: []IngressRule{{Hostname: "x.dialtone.earth", Service: "http://b"}}},
+	}}
+	if err := bad.Normalize(); err == nil || !strings.Contains(err.Error(), "routed by tunnels a and b") {
+		t.Fatalf("expected duplicate hostname error, got %v", err)
+	}
+}
+
+func TestPlanApplyConvergesAndDetectsDrift(t *testing.T) {
+	ctx := context.Background()
+	api := NewFakeAPI("dialtone.earth")
+	zoneID := api.Zones["dialtone.earth"]
+	// Unrelated records and apps in the zone must survive apply.
+	api.Records[zoneID] = []DNSRecord{{ID: "keep", Type: "CNAME", Name: "www.dialtone.earth", Content: "pages.dev", Proxied: true}}
+	api.Apps = []AccessApp{{ID: "other", Name: "manual", Domain: "admin.dialtone.earth"}}
+	spec := testFleetSpec(t)
+	envPath := filepath.Join(t.TempDir(), "dialtone.json")
+	if err := os.WriteFile(envPath, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := PlanTunnels(ctx, api, spec)
+	if err != nil {
+		t.Fatalf("PlanTunnels returned error: %v", err)
+	}
+	want := []string{
+		"+ tunnel rover-1",
+		"+ ingress rover-1: +rover-1.dialtone.earth -> http://127.0.0.1:8080, +cad.rover-1.dialtone.earth -> http://127.0.0.1:8081, +* -> http_status:404",
+		"+ dns rover-1.dialtone.earth: CNAME <new rover-1>.cfargotunnel.com",
+		"+ dns cad.rover-1.dialtone.earth: CNAME <new rover-1>.cfargotunnel.com",
+		"+ access cad.rover-1.dialtone.earth: allow @dialtone.earth for 24h",
+	}
+	if got := strings.Join(plan.Lines(), "\n"); got != strings.Join(want, "\n") {
+		t.Fatalf("unexpected plan:\n%s", got)
+	}
+	if _, err := ApplyTunnelPlan(ctx, api, plan, ApplyOptions{EnvPath: envPath}); err != nil {
+		t.Fatalf("ApplyTunnelPlan returned error: %v", err)
+	}
+	tunnelID := api.Tunnels[0].ID
+	for _, rec := range api.Records[zoneID][1:] {
+		if rec.Content != tunnelID+".cfargotunnel.com" {
+			t.Fatalf("dns record not pointed at new tunnel: %+v", rec)
+		}
+	}
+	raw, _ := os.ReadFile(envPath)
+	if !strings.Contains(string(raw), "CF_TUNNEL_TOKEN_ROVER_1") {
+		t.Fatalf("run token not stored: %s", raw)
+	}
+
+	again, err := PlanTunnels(ctx, api, spec)
+	if err != nil || !again.Empty() {
+		t.Fatalf("second plan should be empty, got %v %v", again.Lines(), err)
+	}
+
+	// Drift: someone repoints the service and the spec drops the cad route.
+	cfg := api.Configs[tunnelID]
+	cfg.Ingress[0].Service = "http://127.0.0.1:9999"
+	api.Configs[tunnelID] = cfg
+	spec.Tunnels[0].Ingress = []IngressRule{{Hostname: "rover-1", Service: "http://127.0.0.1:8080"}}
+	spec.Tunnels[0].Access = nil
+	if err := spec.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	drift, err := PlanTunnels(ctx, api, spec)
+	if err != nil {
+		t.Fatalf("PlanTunnels returned error: %v", err)
+	}
+	want = []string{
+		"~ ingress rover-1: ~rover-1.dialtone.earth http://127.0.0.1:9999 -> http://127.0.0.1:8080, -cad.rover-1.dialtone.earth",
+		"- dns cad.rover-1.dialtone.earth: was " + tunnelID + ".cfargotunnel.com",
+		"- access cad.rover-1.dialtone.earth: allow @dialtone.earth for 24h",
+	}
+	if got := strings.Join(drift.Lines(), "\n"); got != strings.Join(want, "\n") {
+		t.Fatalf("unexpected drift plan:\n%s", got)
+	}
+	if _, err := ApplyTunnelPlan(ctx, api, drift, ApplyOptions{}); err != nil {
+		t.Fatalf("ApplyTunnelPlan returned error: %v", err)
+	}
+	if final, _ := PlanTunnels(ctx, api, spec); !final.Empty() {
+		t.Fatalf("plan after drift apply should be empty: %v", final.Lines())
+	}
+	if len(api.Records[zoneID]) != 2 || api.Records[zoneID][0].ID != "keep" || len(api.Apps) != 1 || api.Apps[0].ID != "other" {
+		t.Fatalf("unmanaged resources were modified: %+v %+v", api.Records[zoneID], api.Apps)
+	}
+}
+
+func TestPlanRefusesUnmanagedAccessApp(t *testing.T) {
+	api := NewFakeAPI("dialtone.earth")
+	api.Apps = []AccessApp{{ID: "manual", Name: "cad", Domain: "cad.rover-1.dialtone.earth"}}
+	if _, err := PlanTunnels(context.Background(), api, testFleetSpec(t)); err == nil || !strings.Contains(err.Error(), "not managed") {
+		t.Fatalf("expected unmanaged access app error, got %v", err)
+	}
+}
+
+func TestPlanReportsAddressRecordConflicts(t *testing.T) {
+	ctx := context.Background()
+	api := NewFakeAPI("dialtone.earth")
+	zoneID := api.Zones["dialtone.earth"]
+	api.Records[zoneID] = []DNSRecord{
+		{ID: "v6", Type: "AAAA", Name: "rover-1.dialtone.earth", Content: "2001:db8::1"},
+		{ID: "v4", Type: "A", Name: "rover-1.dialtone.earth", Content: "203.0.113.7"},
+	}
+	plan, err := PlanTunnels(ctx, api, testFleetSpec(t))
+	if err != nil {
+		t.Fatalf("PlanTunnels returned error: %v", err)
+	}
+	want := "! dns rover-1.dialtone.earth: A 203.0.113.7, AAAA 2001:db8::1 already exist; remove them to route CNAME <new rover-1>.cfargotunnel.com"
+	if !strings.Contains(strings.Join(plan.Lines(), "\n"), want) || len(plan.Conflicts()) != 1 {
+		t.Fatalf("expected address record conflict, got:\n%s", strings.Join(plan.Lines(), "\n"))
+	}
+	applied, err := ApplyTunnelPlan(ctx, api, plan, ApplyOptions{})
+	if err == nil || !strings.Contains(err.Error(), "rover-1.dialtone.earth") || len(applied) != 0 {
+		t.Fatalf("expected apply to refuse the conflict, got %v %v", applied, err)
+	}
+	if len(api.Tunnels) != 0 || len(api.Records[zoneID]) != 2 || api.Records[zoneID][0].Type != "AAAA" {
+		t.Fatalf("conflicting plan must not change the account: %+v %+v", api.Tunnels, api.Records[zoneID])
+	}
+}
@@ -0,0 +1,174 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// TunnelFleetSpec is the desired state for every tunnel dialtone manages in
+// one account and zone. Tunnels not listed are left alone.
+type TunnelFleetSpec struct {
+	AccountID string       `json:"account_id,omitempty"`
+	Zone      string       `json:"zone,omitempty"`
+	Tunnels   []TunnelSpec `json:"tunnels"`
+}
+
+type TunnelSpec struct {
+	Name string `json:"name"`
+	// OriginRequest applies to every ingress rule without its own settings.
+	OriginRequest *OriginRequest `json:"origin_request,omitempty"`
+	Ingress       []IngressRule  `json:"ingress"`
+	Access        []AccessPolicy `json:"access,omitempty"`
+}
+
+// IngressRule and OriginRequest use the field names of the cloudflared
+// config file so rules can be copied between the two.
+type IngressRule struct {
+	Hostname      string         `json:"hostname,omitempty"`
+	Path          string         `json:"path,omitempty"`
+	Service       string         `json:"service"`
+	OriginRequest *OriginRequest `json:"originRequest,omitempty"`
+}
+
+type OriginRequest struct {
+	ConnectTimeout         int    `json:"connectTimeout,omitempty"`
+	KeepAliveTimeout       int    `json:"keepAliveTimeout,omitempty"`
+	NoTLSVerify            bool   `json:"noTLSVerify,omitempty"`
+	HTTPHostHeader         string `json:"httpHostHeader,omitempty"`
+	OriginServerName       string `json:"originServerName,omitempty"`
+	DisableChunkedEncoding bool   `json:"disableChunkedEncoding,omitempty"`
+}
+
+// AccessPolicy puts a Cloudflare Access application in front of Hostname.
+type AccessPolicy struct {
+	Hostname        string   `json:"hostname"`
+	Name            string   `json:"name,omitempty"`
+	AllowEmails     []string `json:"allow_emails,omitempty"`
+	AllowDomains    []string `json:"allow_email_domains,omitempty"`
+	SessionDuration string   `json:"session_duration,omitempty"`
+}
+
+// catchAllService is appended as the final ingress rule when the spec does
+// not end with a hostname-less rule, as cloudflared requires.
+const catchAllService = "http_status:404"
+
+// accessAppPrefix marks Access applications owned by the spec; others in
+// the account are never updated or deleted.
+const accessAppPrefix = "dialtone:"
+
+func LoadTunnelFleetSpec(path string) (TunnelFleetSpec, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return TunnelFleetSpec{}, err
+	}
+	var spec TunnelFleetSpec
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return TunnelFleetSpec{}, fmt.Errorf("parse tunnel spec %s: %w", path, err)
+	}
+	return spec, spec.Normalize()
+}
+
+// Normalize expands short hostnames into the zone, fills defaults and
+// validates the spec in place.
+func (s *TunnelFleetSpec) Normalize() error {
+	s.Zone = strings.TrimSpace(s.Zone)
+	if s.Zone == "" {
+		s.Zone = defaultManagedZone
+	}
+	seenTunnels := map[string]bool{}
+	owner := map[string]string{}
+	for i := range s.Tunnels {
+		t := &s.Tunnels[i]
+		t.Name = strings.TrimSpace(t.Name)
+		if t.Name == "" {
+			return fmt.Errorf("tunnel %d: name is required", i)
+		}
+		if seenTunnels[t.Name] {
+			return fmt.Errorf("tunnel %s is listed twice", t.Name)
+		}
+		seenTunnels[t.Name] = true
+		if len(t.Ingress) == 0 {
+			return fmt.Errorf("tunnel %s: at least one ingress rule is required", t.Name)
+		}
+		for j := range t.Ingress {
+			rule := &t.Ingress[j]
+			rule.Service = strings.TrimSpace(rule.Service)
+			if rule.Service == "" {
+				return fmt.Errorf("tunnel %s ingress %d: service is required", t.Name, j)
+			}
+			if strings.TrimSpace(rule.Hostname) == "" {
+				if j != len(t.Ingress)-1 {
+					return fmt.Errorf("tunnel %s ingress %d: only the last rule may omit hostname", t.Name, j)
+				}
+				rule.Hostname = ""
+				continue
+			}
+			rule.Hostname = s.qualify(rule.Hostname)
+			if other, ok := owner[rule.Hostname]; ok && other != t.Name {
+				return fmt.Errorf("hostname %s is routed by tunnels %s and %s", rule.Hostname, other, t.Name)
+			}
+			owner[rule.Hostname] = t.Name
+		}
+		if t.Ingress[len(t.Ingress)-1].Hostname != "" {
+			t.Ingress = append(t.Ingress, IngressRule{Service: catchAllService})
+		}
+		for j := range t.Access {
+			p := &t.Access[j]
+			p.Hostname = s.qualify(p.Hostname)
+			if owner[p.Hostname] != t.Name {
+				return fmt.Errorf("tunnel %s access %d: %s is not one of its ingress hostnames", t.Name, j, p.Hostname)
+			}
+			if len(p.AllowEmails) == 0 && len(p.AllowDomains) == 0 {
+				return fmt.Errorf("tunnel %s access for %s: allow_emails or allow_email_domains is required", t.Name, p.Hostname)
+			}
+			if strings.TrimSpace(p.Name) == "" {
+				p.Name = p.Hostname
+			}
+			if strings.TrimSpace(p.SessionDuration) == "" {
+				p.SessionDuration = "24h"
+			}
+			sort.Strings(p.AllowEmails)
+			sort.Strings(p.AllowDomains)
+		}
+	}
+	return nil
+}
+
+// qualify turns a short label like "cad.rover-1" into "cad.rover-1.<zone>".
+func (s *TunnelFleetSpec) qualify(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+	if host == s.Zone || strings.HasSuffix(host, "."+s.Zone) {
+		return host
+	}
+	return host + "." + s.Zone
+}
+
+// Hostnames returns the tunnel's routed hostnames in ingress order.
+func (t TunnelSpec) Hostnames() []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, rule := range t.Ingress {
+		if rule.Hostname != "" && !seen[rule.Hostname] {
+			seen[rule.Hostname] = true
+			out = append(out, rule.Hostname)
+		}
+	}
+	return out
+}
+
+func (t TunnelSpec) config() TunnelConfig {
+	return TunnelConfig{Ingress: t.Ingress, OriginRequest: t.OriginRequest}
+}
+
+func (p AccessPolicy) app() AccessApp {
+	return AccessApp{
+		Name:            accessAppPrefix + p.Name,
+		Domain:          p.Hostname,
+		SessionDuration: p.SessionDuration,
+		AllowEmails:     p.AllowEmails,
+		AllowDomains:    p.AllowDomains,
+	}
+}
@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	chromev3 "dialtone/dev/plugins/chrome/src_v3"
+	diagnosticv1 "dialtone/dev/plugins/diagnostic/src_v1/go"
+	logs "dialtone/dev/plugins/logs/src_v1/go"
+	robotv2 "dialtone/dev/plugins/robot/src_v2"
+	sshv1 "dialtone/dev/plugins/ssh/src_v1/go"
+	tsnetv1 "dialtone/dev/plugins/tsnet/src_v1/go"
+	"github.com/nats-io/nats.go"
+)
+
+var registerOnce sync.Once
+var registerErr error
+
+// registerPluginChecks adds the core checks and every plugin's checks to the
+// default registry.
+func registerPluginChecks() error {
+	registerOnce.Do(func() {
+		for _, register := range []func(*diagnosticv1.Registry) error{
+			diagnosticv1.RegisterCoreChecks,
+			sshv1.RegisterDiagnostics,
+			tsnetv1.RegisterDiagnostics,
+			chromev3.RegisterDiagnostics,
+			robotv2.RegisterDiagnostics,
+		} {
+			if registerErr = register(diagnosticv1.Default); registerErr != nil {
+				return
+			}
+		}
+	})
+	return registerErr
+}
+
+func Run(args []string) error {
+	if len(args) == 0 || isHelpArg(args[0]) {
+		printUsage()
+		return nil
+	}
+	version := strings.TrimSpace(args[0])
+	if !strings.HasPrefix(version, "src_v") {
+		return fmt.Errorf("expected version as first diagnostic argument (for example: ./dialtone.sh diagnostic src_v1 run)")
+	}
+	if version != "src_v1" {
+		return fmt.Errorf("unsupported version %s", version)
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("missing command (usage: ./dialtone.sh diagnostic %s <command> [args])", version)
+	}
+
+	command := args[1]
+	rest := args[2:]
+	if err := registerPluginChecks(); err != nil {
+		return err
+	}
+	switch command {
+	case "help", "-h", "--help":
+		printUsage()
+		return nil
+	case "list":
+		return runList()
+	case "run":
+		return runChecks(rest)
+	default:
+		return fmt.Errorf("unknown diagnostic command: %s", command)
+	}
+}
+
+func printUsage() {
+	logs.Raw("Usage: ./dialtone.sh diagnostic src_v1 <command> [args]")
+	logs.Raw("")
+	logs.Raw("Commands:")
+	logs.Raw("  list                                 List registered checks")
+	logs.Raw("  run [--host local|all|n1,n2] [--check name|plugin,...] [--format markdown|json] [--out FILE]")
+	logs.Raw("      [--watch DUR] [--nats-url URL]   Run checks and print a combined health report")
+}
+
+func runList() error {
+	logs.Raw("%-24s %-9s %-20s %s", "CHECK", "SEVERITY", "DEPENDS_ON", "DESCRIPTION")
+	for _, c := range diagnosticv1.Default.Checks() {
+		deps := strings.Join(c.DependsOn, ",")
+		if deps == "" {
+			deps = "-"
+		}
+		scope := ""
+		if c.LocalOnly {
+			scope = " (local only)"
+		}
+		logs.Raw("%-24s %-9s %-20s %s%s", c.Name, c.Severity, deps, c.Description, scope)
+	}
+	return nil
+}
+
+func runChecks(args []string) error {
+	fs := flag.NewFlagSet("diagnostic run", flag.ContinueOnError)
+	host := fs.String("host", "local", "local, all (local + every mesh node), or a csv of mesh nodes")
+	checks := fs.String("check", "", "Comma-separated check or plugin names (dependencies are added)")
+	format := fs.String("format", "markdown", "Report format: markdown|json")
+	out := fs.String("out", "", "Write the report to FILE instead of stdout")
+	watch := fs.Duration("watch", 0, "Re-run every DUR and publish results to NATS")
+	natsURL := fs.String("nats-url", diagnosticv1.DefaultNATSURL(), "NATS URL for --watch")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "markdown" && *format != "json" {
+		return fmt.Errorf("unsupported --format %q (use markdown or json)", *format)
+	}
+	plan, err := diagnosticv1.Default.Plan(splitCSV(*checks))
+	if err != nil {
+		return err
+	}
+	targets, err := resolveTargets(*host)
+	if err != nil {
+		return err
+	}
+
+	if *watch <= 0 {
+		rep := diagnosticv1.Run(context.Background(), targets, plan)
+		if err := writeReport(rep, *format, *out); err != nil {
+			return err
+		}
+		if rep.Status == diagnosticv1.StatusFail {
+			return fmt.Errorf("diagnostics failed: %d failing checks", rep.Summary.Fail)
+		}
+		return nil
+	}
+
+	nc, err := nats.Connect(*natsURL, nats.Name("dialtone-diagnostic"), nats.MaxReconnects(-1))
+	if err != nil {
+		return fmt.Errorf("connect nats %s: %w", *natsURL, err)
+	}
+	defer nc.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	logs.Info("diagnostic watch: every %s on %d hosts, publishing to %s.<host>", *watch, len(targets), diagnosticv1.SubjectPrefix)
+	ticker := time.NewTicker(*watch)
+	defer ticker.Stop()
+	for {
+		rep := diagnosticv1.Run(ctx, targets, plan)
+		if err := diagnosticv1.PublishReport(nc, rep); err != nil {
+			logs.Warn("diagnostic watch: publish failed: %v", err)
+		}
+		if err := writeReport(rep, *format, *out); err != nil {
+			return err
+		}
+		logs.Info("diagnostic watch: %s (%d pass, %d warn, %d fail)", rep.Status, rep.Summary.Pass, rep.Summary.Warn, rep.Summary.Fail)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func writeReport(rep diagnosticv1.Report, format, out string) error {
+	var body string
+	if format == "json" {
+		raw, err := rep.JSON()
+		if err != nil {
+			return err
+		}
+		body = string(raw)
+	} else {
+		body = rep.Markdown()
+	}
+	if strings.TrimSpace(out) != "" {
+		return os.WriteFile(out, []byte(strings.TrimRight(body, "\n")+"\n"), 0o644)
+	}
+	logs.Raw("%s", strings.TrimRight(body, "\n"))
+	return nil
+}
+
+// resolveTargets maps --host to targets. Mesh nodes run their checks over
+// the ssh plugin; the local host runs them directly.
+func resolveTargets(host string) ([]diagnosticv1.Target, error) {
+	host = strings.TrimSpace(host)
+	if host == "" || host == "local" {
+		return []diagnosticv1.Target{diagnosticv1.LocalTarget()}, nil
+	}
+	var nodes []sshv1.MeshNode
+	targets := []diagnosticv1.Target{}
+	if strings.EqualFold(host, "all") {
+		targets = append(targets, diagnosticv1.LocalTarget())
+		nodes = sshv1.ListMeshNodes()
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	} else {
+		for _, name := range splitCSV(host) {
+			if name == "local" {
+				targets = append(targets, diagnosticv1.LocalTarget())
+				continue
+			}
+			node, err := sshv1.ResolveMeshNode(name)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	for _, node := range nodes {
+		name := node.Name
+		targets = append(targets, diagnosticv1.CommandTarget(name, node.OS, func(command string) (string, error) {
+			return sshv1.RunNodeCommand(name, command, sshv1.CommandOptions{ConnectTimeout: 5 * time.Second})
+		}))
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no diagnostic targets for --host %q", host)
+	}
+	return targets, nil
+}
+
+func splitCSV(raw string) []string {
+	var out []string
+	for _, p := range strings.Split(raw, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func isHelpArg(s string) bool {
+	switch strings.TrimSpace(s) {
+	case "help", "-h", "--help":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,559 @@
+package diagnostic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	cdplog "github.com/chromedp/cdproto/log"
+	cdpruntime "github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// Core checks cover the bootstrap state dev.go logs on startup and the
+// dependency, host and web UI checks of the legacy diagnostic plugin. Both
+// of those entry points run these checks instead of their own copies.
+
+// ExpectedUIVersion is the robot dashboard version core.web-ui requires.
+const ExpectedUIVersion = "v1.1.1"
+
+// RegisterCoreChecks adds the core.* checks to r.
+func RegisterCoreChecks(r *Registry) error {
+	return r.RegisterAll(
+		Check{
+			Name:        "core.go",
+			Description: "Go toolchain is installed",
+			Severity:    SeverityCritical,
+			Remediation: "run ./dialtone.sh install to fetch the managed Go toolchain",
+			Run: func(ctx context.Context, t Target) (string, error) {
+				goBin := "go"
+				if t.Local() {
+					if v := strings.TrimSpace(os.Getenv("DIALTONE_GO_BIN")); v != "" {
+						goBin = v
+					}
+				}
+				return toolVersion(ctx, t, goBin+" version")
+			},
+		},
+		Check{
+			Name:        "core.git",
+			Description: "git is installed",
+			Severity:    SeverityWarning,
+			Remediation: "install git; plugin tooling and branch commands need it",
+			Run: func(ctx context.Context, t Target) (string, error) {
+				return toolVersion(ctx, t, "git --version")
+			},
+		},
+		Check{
+			Name:        "core.node",
+			Description: "Node.js is installed",
+			Severity:    SeverityWarning,
+			Remediation: "install Node.js; UI builds need it",
+			Run: func(ctx context.Context, t Target) (string, error) {
+				return toolVersion(ctx, t, "node --version")
+			},
+		},
+		Check{
+			Name:        "core.zig",
+			Description: "Zig is installed",
+			Severity:    SeverityInfo,
+			Remediation: "install zig for cgo cross builds",
+			Run: func(ctx context.Context, t Target) (string, error) {
+				return toolVersion(ctx, t, "zig version")
+			},
+		},
+		Check{
+			Name:        "core.tailscale",
+			Description: "Tailscale is installed",
+			Severity:    SeverityCritical,
+			Remediation: "install tailscale (https://tailscale.com/download)",
+			Run: func(ctx context.Context, t Target) (string, error) {
+				return toolVersion(ctx, t, "tailscale version")
+			},
+		},
+		Check{
+			Name:        "core.env",
+			Description: "Bootstrap paths exist and env/dialtone.json is valid",
+			Severity:    SeverityCritical,
+			LocalOnly:   true,
+			Remediation: "run commands through ./dialtone.sh so DIALTONE_* paths are set, and fix env/dialtone.json",
+			Run:         checkEnv,
+		},
+		Check{
+			Name:        "core.env-keys",
+			Description: "env/dialtone.json has shared caches, tsnet and cloudflare keys and valid mesh_nodes",
+			Severity:    SeverityInfo,
+			LocalOnly:   true,
+			DependsOn:   []string{"core.env"},
+			Run: func(ctx context.Context, t Target) (string, error) {
+				var doc map[string]any
+				if err := readJSONFile(strings.TrimSpace(os.Getenv("DIALTONE_ENV_FILE")), &doc); err != nil {
+					return "", err
+				}
+				return evaluateEnvKeys(doc)
+			},
+		},
+		Check{
+			Name:        "core.mesh-config",
+			Description: "Mesh node config is readable",
+			Severity:    SeverityWarning,
+			LocalOnly:   true,
+			Remediation: "set DIALTONE_MESH_CONFIG to a readable mesh json (see the ssh plugin README)",
+			Run: func(ctx context.Context, t Target) (string, error) {
+				path := strings.TrimSpace(os.Getenv("DIALTONE_MESH_CONFIG"))
+				if path == "" {
+					return "", fmt.Errorf("DIALTONE_MESH_CONFIG is empty")
+				}
+				if err := readJSONFile(path, &json.RawMessage{}); err != nil {
+					return "", err
+				}
+				return path, nil
+			},
+		},
+		Check{
+			Name:        "core.nats",
+			Description: "REPL NATS endpoint is reachable",
+			Severity:    SeverityWarning,
+			LocalOnly:   true,
+			Remediation: "start the REPL leader with ./dialtone.sh repl src_v3 leader",
+			Run: func(ctx context.Context, t Target) (string, error) {
+				natsURL := DefaultNATSURL()
+				if err := dialURL(ctx, natsURL, "4222"); err != nil {
+					return "", fmt.Errorf("%s unreachable: %v", natsURL, err)
+				}
+				return natsURL + " reachable", nil
+			},
+		},
+		Check{
+			Name:        "core.repl-leader",
+			Description: "REPL leader process is running",
+			Severity:    SeverityInfo,
+			Remediation: "start the REPL leader with ./dialtone.sh repl src_v3 leader",
+			Run: func(ctx context.Context, t Target) (string, error) {
+				return processRunning(ctx, t, "plugins/repl/scaffold/main.go src_v3 leader", "src_v3 leader --embedded-nats")
+			},
+		},
+		Check{
+			Name:        "core.bootstrap-http",
+			Description: "REPL bootstrap HTTP server serves install.sh",
+			Severity:    SeverityInfo,
+			LocalOnly:   true,
+			Run: func(ctx context.Context, t Target) (string, error) {
+				raw := BootstrapInstallURL()
+				if err := httpGetOK(ctx, raw); err != nil {
+					return "", fmt.Errorf("%s: %v", raw, err)
+				}
+				return raw + " reachable", nil
+			},
+		},
+		Check{
+			Name:        "core.bootstrap-http-process",
+			Description: "REPL bootstrap HTTP process is running",
+			Severity:    SeverityInfo,
+			Run: func(ctx context.Context, t Target) (string, error) {
+				return processRunning(ctx, t, "bootstrap-http --host")
+			},
+		},
+		Check{
+			Name:        "core.cloudflared",
+			Description: "cloudflared is running",
+			Severity:    SeverityInfo,
+			Run: func(ctx context.Context, t Target) (string, error) {
+				return processRunning(ctx, t, "cloudflared")
+			},
+		},
+		Check{
+			Name:        "core.host",
+			Description: "Hostname, uptime and dialtone process state",
+			Severity:    SeverityInfo,
+			Run: func(ctx context.Context, t Target) (string, error) {
+				if t.OS() == "windows" {
+					return "", Skipf("host summary uses POSIX tools")
+				}
+				out, err := t.Exec(ctx, "echo \"hostname=$(hostname)\"; echo \"uptime=$(uptime -p 2>/dev/null || uptime)\"; pgrep -f 'dialtone start' >/dev/null && echo dialtone=running || echo dialtone=stopped")
+				if err != nil {
+					return "", fmt.Errorf("host summary failed: %v %s", err, out)
+				}
+				return strings.Join(strings.Fields(strings.ReplaceAll(out, "\n", "; ")), " "), nil
+			},
+		},
+		Check{
+			Name:        "core.app-status",
+			Description: "Dialtone app status API answers",
+			Severity:    SeverityWarning,
+			Remediation: "check the dialtone app service on the host and its tsnet hostname",
+			Timeout:     10 * time.Second,
+			Run: func(ctx context.Context, t Target) (string, error) {
+				base, ok := appURL(t)
+				if !ok {
+					return "", Skipf("set DIALTONE_HOSTNAME to check the local app")
+				}
+				return checkAppStatus(ctx, base)
+			},
+		},
+		Check{
+			Name:        "core.web-ui",
+			Description: "Dashboard loads with its panels, telemetry and no console errors",
+			Severity:    SeverityCritical,
+			DependsOn:   []string{"core.app-status"},
+			Remediation: "open the dashboard in a browser and check the console; redeploy the UI if the version is stale",
+			Timeout:     45 * time.Second,
+			Run: func(ctx context.Context, t Target) (string, error) {
+				base, _ := appURL(t)
+				return checkWebUI(ctx, base)
+			},
+		},
+	)
+}
+
+func DefaultNATSURL() string {
+	if v := strings.TrimSpace(os.Getenv("DIALTONE_REPL_NATS_URL")); v != "" {
+		return v
+	}
+	return "nats://127.0.0.1:4222"
+}
+
+// BootstrapInstallURL is the install.sh URL of the REPL bootstrap HTTP server.
+func BootstrapInstallURL() string {
+	host := strings.TrimSpace(os.Getenv("DIALTONE_REPL_BOOTSTRAP_HTTP_HOST"))
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	port := strings.TrimSpace(os.Getenv("DIALTONE_REPL_BOOTSTRAP_HTTP_PORT"))
+	if port == "" {
+		port = "8811"
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/install.sh"
+}
+
+func toolVersion(ctx context.Context, t Target, command string) (string, error) {
+	out, err := t.Exec(ctx, command)
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %v %s", command, err, out)
+	}
+	return out, nil
+}
+
+// processRunning passes when pgrep -f matches any pattern and reports info
+// otherwise, matching the running=true/false lines dev.go used to log.
+func processRunning(ctx context.Context, t Target, patterns ...string) (string, error) {
+	if t.OS() == "windows" {
+		return "", Skipf("process checks use pgrep")
+	}
+	for _, pattern := range patterns {
+		// "[p]attern" keeps pgrep from matching the sh -c running it.
+		if _, err := t.Exec(ctx, "pgrep -f '["+pattern[:1]+"]"+pattern[1:]+"'"); err == nil {
+			return "running", nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+	}
+	return "", fmt.Errorf("not running")
+}
+
+func checkEnv(ctx context.Context, t Target) (string, error) {
+	var problems []string
+	for _, key := range []string{"DIALTONE_REPO_ROOT", "DIALTONE_SRC_ROOT", "DIALTONE_ENV"} {
+		p := strings.TrimSpace(os.Getenv(key))
+		if p == "" {
+			problems = append(problems, key+" is empty")
+			continue
+		}
+		if info, err := os.Stat(p); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("%s=%s is not a directory", key, p))
+		}
+	}
+	envFile := strings.TrimSpace(os.Getenv("DIALTONE_ENV_FILE"))
+	if envFile == "" {
+		problems = append(problems, "DIALTONE_ENV_FILE is empty")
+	} else {
+		var doc map[string]any
+		if err := readJSONFile(envFile, &doc); err != nil {
+			problems = append(problems, err.Error())
+		} else {
+			for _, key := range []string{"DIALTONE_HOME", "DIALTONE_ENV", "DIALTONE_REPO_ROOT"} {
+				if !nonEmptyJSONValue(doc, key) {
+					problems = append(problems, fmt.Sprintf("%s missing from %s", key, envFile))
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return "", fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return envFile, nil
+}
+
+// evaluateEnvKeys reports the optional env/dialtone.json settings: shared
+// caches, tsnet and cloudflare bootstrap keys and the mesh_nodes list.
+func evaluateEnvKeys(doc map[string]any) (string, error) {
+	var missing []string
+	if !nonEmptyJSONValue(doc, "DIALTONE_GO_CACHE_DIR") {
+		missing = append(missing, "DIALTONE_GO_CACHE_DIR")
+	}
+	if !nonEmptyJSONValue(doc, "DIALTONE_BUN_CACHE_DIR") {
+		missing = append(missing, "DIALTONE_BUN_CACHE_DIR")
+	}
+	if !nonEmptyJSONValue(doc, "TS_AUTHKEY") && !(nonEmptyJSONValue(doc, "TS_API_KEY") && nonEmptyJSONValue(doc, "TS_TAILNET")) {
+		missing = append(missing, "TS_AUTHKEY or TS_API_KEY+TS_TAILNET")
+	}
+	if !nonEmptyJSONValue(doc, "CF_TUNNEL_TOKEN_SHELL") && !(nonEmptyJSONValue(doc, "CLOUDFLARE_API_TOKEN") && nonEmptyJSONValue(doc, "CLOUDFLARE_ACCOUNT_ID")) {
+		missing = append(missing, "CF_TUNNEL_TOKEN_SHELL or CLOUDFLARE_API_TOKEN+CLOUDFLARE_ACCOUNT_ID")
+	}
+	nodesOK, count := meshNodesReady(doc["mesh_nodes"])
+	if !nodesOK {
+		missing = append(missing, "valid mesh_nodes (each needs name+host+user)")
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing %s", strings.Join(missing, "; "))
+	}
+	return fmt.Sprintf("caches, tsnet and cloudflare keys set; mesh_nodes=%d", count), nil
+}
+
+func nonEmptyJSONValue(doc map[string]any, key string) bool {
+	v, ok := doc[key]
+	if !ok || v == nil {
+		return false
+	}
+	switch t := v.(type) {
+	case string:
+		return strings.TrimSpace(t) != ""
+	case float64, bool:
+		return true
+	default:
+		return fmt.Sprintf("%v", t) != ""
+	}
+}
+
+func meshNodesReady(raw any) (bool, int) {
+	nodes, ok := raw.([]any)
+	if !ok || len(nodes) == 0 {
+		return false, 0
+	}
+	count := 0
+	for _, n := range nodes {
+		m, ok := n.(map[string]any)
+		if !ok {
+			return false, count
+		}
+		for _, key := range []string{"name", "host", "user"} {
+			if v, _ := m[key].(string); strings.TrimSpace(v) == "" {
+				return false, count
+			}
+		}
+		count++
+	}
+	return true, count
+}
+
+func readJSONFile(path string, v any) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+func dialURL(ctx context.Context, raw, defaultPort string) error {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return err
+	}
+	host, port := u.Hostname(), u.Port()
+	if host == "" || host == "0.0.0.0" {
+		host = "127.0.0.1"
+	}
+	if port == "" {
+		port = defaultPort
+	}
+	d := net.Dialer{Timeout: 2 * time.Second}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func httpGetOK(ctx context.Context, raw string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, raw, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := (&http.Client{Timeout: 2 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// appURL is the dialtone app on a target: its tsnet hostname for mesh
+// nodes, or DIALTONE_HOSTNAME for the local host.
+func appURL(t Target) (string, bool) {
+	if !t.Local() {
+		return "http://" + t.Name(), true
+	}
+	if host := strings.TrimSpace(os.Getenv("DIALTONE_HOSTNAME")); host != "" {
+		return "http://" + host, true
+	}
+	return "", false
+}
+
+// checkAppStatus reads /api/status and /api/init. A host that does not
+// answer at all does not run the app, so the check (and core.web-ui) skip.
+func checkAppStatus(ctx context.Context, base string) (string, error) {
+	var status map[string]any
+	code, err := getJSON(ctx, base+"/api/status", &status)
+	if code == 0 && err != nil {
+		return "", Skipf("no app at %s: %v", base, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("status API: %v", err)
+	}
+	parts := []string{fmt.Sprintf("tailscale_ips=%v uptime=%v", status["tailscale_ips"], status["uptime"])}
+	if nats, ok := status["nats"].(map[string]any); ok {
+		parts = append(parts, fmt.Sprintf("nats=%v conns=%v", nats["url"], nats["connections"]))
+	}
+	var initData map[string]any
+	if _, err := getJSON(ctx, base+"/api/init", &initData); err == nil {
+		parts = append(parts, fmt.Sprintf("version=%v", initData["version"]))
+	}
+	return strings.Join(parts, " "), nil
+}
+
+func getJSON(ctx context.Context, raw string, v any) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, raw, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := (&http.Client{Timeout: 5 * time.Second}).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("non-200: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return resp.StatusCode, fmt.Errorf("decode: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+type webUIState struct {
+	Title         string
+	Terminal      bool
+	Three         bool
+	RightPanel    bool
+	UIVersion     string
+	NATS          string
+	Heartbeat     string
+	Lat, Lon, Yaw string
+	ConsoleErrors []string
+}
+
+// checkWebUI loads the dashboard in a headless browser and reads its panels
+// and telemetry fields.
+func checkWebUI(ctx context.Context, base string) (string, error) {
+	allocCtx, cancel := chromedp.NewExecAllocator(ctx, append(chromedp.DefaultExecAllocatorOptions[:], chromedp.Flag("headless", true))...)
+	defer cancel()
+	bctx, cancel := chromedp.NewContext(allocCtx)
+	defer cancel()
+
+	var st webUIState
+	var consoleErrors []string
+	chromedp.ListenTarget(bctx, func(ev interface{}) {
+		switch ev := ev.(type) {
+		case *cdplog.EventEntryAdded:
+			if ev.Entry.Level == "error" {
+				consoleErrors = append(consoleErrors, "[log] "+ev.Entry.Text)
+			}
+		case *cdpruntime.EventConsoleAPICalled:
+			if ev.Type != "error" {
+				return
+			}
+			for _, arg := range ev.Args {
+				consoleErrors = append(consoleErrors, fmt.Sprintf("[console] %s", arg.Value))
+			}
+		case *cdpruntime.EventExceptionThrown:
+			consoleErrors = append(consoleErrors, "[exception] "+ev.ExceptionDetails.Text)
+		}
+	})
+	err := chromedp.Run(bctx,
+		cdplog.Enable(),
+		chromedp.Navigate(base),
+		chromedp.Title(&st.Title),
+		chromedp.Sleep(3*time.Second), // JS initialization and websocket attempts
+		chromedp.Evaluate(`!!document.getElementById("terminal-container")`, &st.Terminal),
+		chromedp.Evaluate(`!!document.getElementById("three-container")`, &st.Three),
+		chromedp.Evaluate(`document.querySelectorAll(".panel-right").length > 0`, &st.RightPanel),
+	)
+	if err != nil {
+		return "", err
+	}
+	if st.Title != "" && st.Terminal && st.Three && st.RightPanel {
+		// Telemetry fields populate once NATS traffic arrives.
+		_ = chromedp.Run(bctx,
+			chromedp.Sleep(3*time.Second),
+			chromedp.Text("#val-nats", &st.NATS, chromedp.ByID),
+			chromedp.Text("#val-heartbeat", &st.Heartbeat, chromedp.ByID),
+			chromedp.Text("#val-lat", &st.Lat, chromedp.ByID),
+			chromedp.Text("#val-lon", &st.Lon, chromedp.ByID),
+			chromedp.Text("#val-yaw", &st.Yaw, chromedp.ByID),
+			chromedp.Text("#ui-version", &st.UIVersion, chromedp.ByID),
+			chromedp.Sleep(2*time.Second),
+		)
+	}
+	st.ConsoleErrors = consoleErrors
+	return evaluateWebUI(st)
+}
+
+func evaluateWebUI(st webUIState) (string, error) {
+	if st.Title == "" {
+		return "", fmt.Errorf("page loaded but title is empty")
+	}
+	if !st.Terminal || !st.Three || !st.RightPanel {
+		return "", fmt.Errorf("missing UI components: terminal=%t 3d=%t right-panel=%t", st.Terminal, st.Three, st.RightPanel)
+	}
+	if st.UIVersion != ExpectedUIVersion {
+		return "", fmt.Errorf("UI version %q, want %q", st.UIVersion, ExpectedUIVersion)
+	}
+	if n := len(st.ConsoleErrors); n > 0 {
+		shown := st.ConsoleErrors
+		if n > 5 {
+			shown = shown[:5]
+		}
+		return "", fmt.Errorf("%d browser console errors: %s", n, strings.Join(shown, "; "))
+	}
+	if hb := strings.TrimSpace(st.Heartbeat); hb == "" || hb == "--" {
+		return "", fmt.Errorf("mavlink heartbeat missing in UI")
+	}
+	msg := fmt.Sprintf("title=%q version=%s nats=%s heartbeat=%s", st.Title, st.UIVersion, st.NATS, st.Heartbeat)
+	var pending []string
+	if st.NATS == "0" || st.NATS == "--" {
+		pending = append(pending, "nats count")
+	}
+	if st.Lat == "--" || st.Lon == "--" {
+		pending = append(pending, "gps")
+	}
+	if st.Yaw == "--" {
+		pending = append(pending, "orientation")
+	}
+	if len(pending) > 0 {
+		msg += " (not received yet: " + strings.Join(pending, ", ") + ")"
+	}
+	return msg, nil
+}
@@ -0,0 +1,321 @@
+package diagnostic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checks are registered by plugins (each exports a RegisterDiagnostics func
+// that callers invoke explicitly) and run against a Target: the local host or
+// a mesh node reached through the ssh plugin.
+// A check may depend on other checks; when a dependency does not pass the
+// check is skipped instead of reporting a second, less useful failure.
+
+type Severity string
+
+const (
+	SeverityCritical Severity = "critical"
+	SeverityWarning  Severity = "warning"
+	SeverityInfo     Severity = "info"
+)
+
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusInfo Status = "info"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip"
+)
+
+const DefaultCheckTimeout = 15 * time.Second
+
+// Target is where a check runs.
+type Target interface {
+	Name() string
+	OS() string
+	Local() bool
+	Exec(ctx context.Context, command string) (string, error)
+}
+
+type Check struct {
+	Name        string
+	Plugin      string
+	Description string
+	Severity    Severity
+	DependsOn   []string
+	Remediation string
+	Timeout     time.Duration
+	// LocalOnly checks inspect this process (env, files) and are skipped
+	// on remote targets.
+	LocalOnly bool
+	Run       func(ctx context.Context, t Target) (string, error)
+}
+
+type Result struct {
+	Name        string   `json:"name"`
+	Plugin      string   `json:"plugin"`
+	Severity    Severity `json:"severity"`
+	Status      Status   `json:"status"`
+	Message     string   `json:"message,omitempty"`
+	Remediation string   `json:"remediation,omitempty"`
+	DurationMS  int64    `json:"duration_ms"`
+}
+
+type statusError struct {
+	status Status
+	msg    string
+}
+
+func (e *statusError) Error() string { return e.msg }
+
+// Warnf reports a check as warn regardless of its severity.
+func Warnf(format string, args ...any) error {
+	return &statusError{status: StatusWarn, msg: fmt.Sprintf(format, args...)}
+}
+
+// Skipf reports a check as not applicable to the target.
+func Skipf(format string, args ...any) error {
+	return &statusError{status: StatusSkip, msg: fmt.Sprintf(format, args...)}
+}
+
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+func NewRegistry() *Registry {
+	return &Registry{checks: map[string]Check{}}
+}
+
+// Default is the registry the diagnostic CLI fills with every plugin's
+// RegisterDiagnostics.
+var Default = NewRegistry()
+
+func (r *Registry) Register(c Check) error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return fmt.Errorf("diagnostic check without name")
+	}
+	if c.Run == nil {
+		return fmt.Errorf("diagnostic check %s has no Run func", c.Name)
+	}
+	switch c.Severity {
+	case "":
+		c.Severity = SeverityCritical
+	case SeverityCritical, SeverityWarning, SeverityInfo:
+	default:
+		return fmt.Errorf("diagnostic check %s has unknown severity %q", c.Name, c.Severity)
+	}
+	if c.Plugin == "" {
+		c.Plugin, _, _ = strings.Cut(c.Name, ".")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.checks[c.Name]; ok {
+		return fmt.Errorf("diagnostic check %s already registered", c.Name)
+	}
+	r.checks[c.Name] = c
+	return nil
+}
+
+// RegisterAll registers checks in order and stops at the first error.
+func (r *Registry) RegisterAll(checks ...Check) error {
+	for _, c := range checks {
+		if err := r.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Registry) Checks() []Check {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Check, 0, len(r.checks))
+	for _, c := range r.checks {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Plan returns the checks matching the selectors plus their dependencies,
+// ordered so every check comes after the checks it depends on. A selector
+// is a check name or a plugin name; no selectors selects everything.
+func (r *Registry) Plan(selectors []string) ([]Check, error) {
+	all := r.Checks()
+	byName := make(map[string]Check, len(all))
+	for _, c := range all {
+		byName[c.Name] = c
+	}
+	wanted := map[string]bool{}
+	for _, sel := range selectors {
+		sel = strings.TrimSpace(sel)
+		if sel == "" {
+			continue
+		}
+		matched := false
+		for _, c := range all {
+			if c.Name == sel || c.Plugin == sel {
+				wanted[c.Name] = true
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no diagnostic check or plugin named %q", sel)
+		}
+	}
+	if len(wanted) == 0 {
+		for _, c := range all {
+			wanted[c.Name] = true
+		}
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var order []Check
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		c, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("diagnostic check %s depends on unknown check %s", path[len(path)-1], name)
+		}
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("diagnostic dependency cycle: %s -> %s", strings.Join(path, " -> "), name)
+		}
+		state[name] = visiting
+		for _, dep := range c.DependsOn {
+			if err := visit(strings.TrimSpace(dep), append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		order = append(order, c)
+		return nil
+	}
+	for _, c := range all {
+		if wanted[c.Name] {
+			if err := visit(c.Name, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return order, nil
+}
+
+// RunHost runs the planned checks in order against one target.
+func RunHost(ctx context.Context, t Target, plan []Check) HostReport {
+	rep := HostReport{
+		Host:    t.Name(),
+		OS:      t.OS(),
+		Local:   t.Local(),
+		Started: time.Now().UTC(),
+	}
+	statuses := make(map[string]Status, len(plan))
+	for _, c := range plan {
+		res := runCheck(ctx, t, c, statuses)
+		statuses[c.Name] = res.Status
+		rep.Checks = append(rep.Checks, res)
+	}
+	rep.Status = worstStatus(rep.Checks)
+	return rep
+}
+
+func runCheck(ctx context.Context, t Target, c Check, statuses map[string]Status) Result {
+	res := Result{Name: c.Name, Plugin: c.Plugin, Severity: c.Severity}
+	for _, dep := range c.DependsOn {
+		if st := statuses[strings.TrimSpace(dep)]; st != StatusPass && st != StatusInfo {
+			res.Status = StatusSkip
+			res.Message = fmt.Sprintf("dependency %s did not pass (%s)", dep, st)
+			return res
+		}
+	}
+	if c.LocalOnly && !t.Local() {
+		res.Status = StatusSkip
+		res.Message = "local-only check"
+		return res
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	msg, err := safeRun(cctx, t, c)
+	res.DurationMS = time.Since(start).Milliseconds()
+	if err == nil && cctx.Err() != nil {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	if err == nil {
+		res.Status = StatusPass
+		res.Message = msg
+		return res
+	}
+
+	res.Message = err.Error()
+	var se *statusError
+	switch {
+	case errors.As(err, &se):
+		res.Status = se.status
+	case c.Severity == SeverityWarning:
+		res.Status = StatusWarn
+	case c.Severity == SeverityInfo:
+		res.Status = StatusInfo
+	default:
+		res.Status = StatusFail
+	}
+	if res.Status == StatusWarn || res.Status == StatusFail {
+		res.Remediation = c.Remediation
+	}
+	return res
+}
+
+func safeRun(ctx context.Context, t Target, c Check) (msg string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("check panicked: %v", r)
+		}
+	}()
+	return c.Run(ctx, t)
+}
+
+func worstStatus(results []Result) Status {
+	worst := StatusPass
+	rank := map[Status]int{StatusPass: 0, StatusInfo: 0, StatusSkip: 0, StatusWarn: 1, StatusFail: 2}
+	for _, r := range results {
+		if rank[r.Status] > rank[worst] {
+			worst = r.Status
+		}
+	}
+	return worst
+}
+
+// Run checks every target concurrently and combines the host reports.
+func Run(ctx context.Context, targets []Target, plan []Check) Report {
+	hosts := make([]HostReport, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			hosts[i] = RunHost(ctx, t, plan)
+		}(i, t)
+	}
+	wg.Wait()
+	return NewReport(hosts)
+}
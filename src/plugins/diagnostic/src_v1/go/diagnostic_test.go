@@ -0,0 +1,249 @@
+package diagnostic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeTarget struct {
+	name  string
+	local bool
+}
+
+func (t fakeTarget) Name() string { return t.name }
+func (t fakeTarget) OS() string   { return "linux" }
+func (t fakeTarget) Local() bool  { return t.local }
+func (t fakeTarget) Exec(ctx context.Context, command string) (string, error) {
+	return command, nil
+}
+
+func pass(ctx context.Context, t Target) (string, error) { return "ok", nil }
+
+func TestPlanOrdersDependenciesAndRejectsCycles(t *testing.T) {
+	reg := NewRegistry()
+	for _, c := range []Check{
+		{Name: "net.resources", DependsOn: []string{"net.reachable"}, Run: pass},
+		{Name: "net.reachable", Run: pass},
+		{Name: "other.check", Run: pass},
+	} {
+		if err := reg.Register(c); err != nil {
+			t.Fatalf("Register returned error: %v", err)
+		}
+	}
+	if err := reg.Register(Check{Name: "net.reachable", Run: pass}); err == nil {
+		t.Fatalf("expected duplicate registration error")
+	}
+
+	plan, err := reg.Plan([]string{"net.resources"})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if len(plan) != 2 || plan[0].Name != "net.reachable" || plan[1].Name != "net.resources" {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if plan[1].Plugin != "net" || plan[1].Severity != SeverityCritical {
+		t.Fatalf("defaults not applied: %+v", plan[1])
+	}
+	if plan, _ := reg.Plan([]string{"net"}); len(plan) != 2 {
+		t.Fatalf("plugin selector matched %d checks", len(plan))
+	}
+	if _, err := reg.Plan([]string{"missing"}); err == nil {
+		t.Fatalf("expected unknown selector error")
+	}
+
+	_ = reg.Register(Check{Name: "loop.a", DependsOn: []string{"loop.b"}, Run: pass})
+	_ = reg.Register(Check{Name: "loop.b", DependsOn: []string{"loop.a"}, Run: pass})
+	if _, err := reg.Plan([]string{"loop.a"}); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+}
+
+func TestRunHostStatuses(t *testing.T) {
+	reg := NewRegistry()
+	fail := func(ctx context.Context, t Target) (string, error) { return "", errors.New("broken") }
+	for _, c := range []Check{
+		{Name: "a.down", Remediation: "fix a", Run: fail},
+		{Name: "a.after", DependsOn: []string{"a.down"}, Run: pass},
+		{Name: "b.soft", Severity: SeverityWarning, Remediation: "fix b", Run: fail},
+		{Name: "b.note", Severity: SeverityInfo, Remediation: "ignored", Run: fail},
+		{Name: "c.local", LocalOnly: true, Run: pass},
+		{Name: "c.warn", Run: func(ctx context.Context, t Target) (string, error) { return "", Warnf("almost") }},
+		{Name: "c.slow", Timeout: 20 * time.Millisecond, Run: func(ctx context.Context, t Target) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}},
+		{Name: "c.panic", Severity: SeverityWarning, Run: func(ctx context.Context, t Target) (string, error) { panic("boom") }},
+		{Name: "c.exec", Run: func(ctx context.Context, t Target) (string, error) { return t.Exec(ctx, "echo hi") }},
+	} {
+		if err := reg.Register(c); err != nil {
+			t.Fatalf("Register returned error: %v", err)
+		}
+	}
+	plan, err := reg.Plan(nil)
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	rep := Run(context.Background(), []Target{fakeTarget{name: "robot"}}, plan)
+	got := map[string]Result{}
+	for _, r := range rep.Hosts[0].Checks {
+		got[r.Name] = r
+	}
+	want := map[string]Status{
+		"a.down":  StatusFail,
+		"a.after": StatusSkip,
+		"b.soft":  StatusWarn,
+		"b.note":  StatusInfo,
+		"c.local": StatusSkip,
+		"c.warn":  StatusWarn,
+		"c.slow":  StatusFail,
+		"c.panic": StatusWarn,
+		"c.exec":  StatusPass,
+	}
+	for name, status := range want {
+		if got[name].Status != status {
+			t.Errorf("%s: status %s, want %s (%s)", name, got[name].Status, status, got[name].Message)
+		}
+	}
+	if got["a.down"].Remediation != "fix a" || got["b.note"].Remediation != "" || got["c.exec"].Message != "echo hi" {
+		t.Fatalf("unexpected results: %+v", got)
+	}
+	if rep.Status != StatusFail || rep.Hosts[0].Status != StatusFail || rep.Summary.Fail != 2 || rep.Summary.Skip != 2 {
+		t.Fatalf("unexpected report: %+v", rep)
+	}
+
+	raw, err := rep.JSON()
+	if err != nil {
+		t.Fatalf("JSON returned error: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(raw, &decoded); err != nil || len(decoded.Hosts[0].Checks) != len(want) {
+		t.Fatalf("report did not round-trip: %v", err)
+	}
+	md := rep.Markdown()
+	for _, s := range []string{"# Diagnostics: fail", "## robot (mesh, linux): fail", "| a.down | critical | fail | broken |", "- `a.down`: fix a"} {
+		if !strings.Contains(md, s) {
+			t.Fatalf("markdown missing %q:\n%s", s, md)
+		}
+	}
+}
+
+func TestHostSubject(t *testing.T) {
+	if got := HostSubject("robot.local"); got != "diagnostic.report.robot_local" {
+		t.Fatalf("HostSubject = %q", got)
+	}
+}
+
+func TestCoreChecksRegisterExplicitly(t *testing.T) {
+	reg := NewRegistry()
+	if err := RegisterCoreChecks(reg); err != nil {
+		t.Fatalf("RegisterCoreChecks returned error: %v", err)
+	}
+	if err := RegisterCoreChecks(reg); err == nil {
+		t.Fatalf("expected duplicate registration error")
+	}
+	plan, err := reg.Plan([]string{"core.web-ui", "core.env-keys"})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	var names []string
+	for _, c := range plan {
+		names = append(names, c.Name)
+	}
+	if got := strings.Join(names, ","); got != "core.env,core.env-keys,core.app-status,core.web-ui" {
+		t.Fatalf("unexpected plan order: %s", got)
+	}
+	if len(Default.Checks()) != 0 {
+		t.Fatalf("core checks should not register into Default on import")
+	}
+}
+
+type scriptTarget struct {
+	fakeTarget
+	ok map[string]bool
+}
+
+func (t scriptTarget) Exec(ctx context.Context, command string) (string, error) {
+	if t.ok[command] {
+		return "", nil
+	}
+	return "", errors.New("exit status 1")
+}
+
+func TestProcessRunningDoesNotMatchItsOwnShell(t *testing.T) {
+	target := scriptTarget{ok: map[string]bool{"pgrep -f '[s]rc_v3 leader --embedded-nats'": true}}
+	if msg, err := processRunning(context.Background(), target, "plugins/repl/scaffold/main.go src_v3 leader", "src_v3 leader --embedded-nats"); err != nil || msg != "running" {
+		t.Fatalf("processRunning = %q, %v", msg, err)
+	}
+	if _, err := processRunning(context.Background(), target, "cloudflared"); err == nil {
+		t.Fatalf("expected not running")
+	}
+}
+
+func TestEvaluateEnvKeys(t *testing.T) {
+	doc := map[string]any{
+		"DIALTONE_GO_CACHE_DIR":  "/cache/go",
+		"DIALTONE_BUN_CACHE_DIR": "/cache/bun",
+		"TS_API_KEY":             "k",
+		"TS_TAILNET":             "t",
+		"CF_TUNNEL_TOKEN_SHELL":  "cf",
+		"mesh_nodes":             []any{map[string]any{"name": "rover", "host": "rover.local", "user": "pi"}},
+	}
+	if msg, err := evaluateEnvKeys(doc); err != nil || !strings.Contains(msg, "mesh_nodes=1") {
+		t.Fatalf("evaluateEnvKeys = %q, %v", msg, err)
+	}
+	delete(doc, "TS_TAILNET")
+	doc["mesh_nodes"] = []any{map[string]any{"name": "rover", "host": "rover.local", "user": 1.0}}
+	_, err := evaluateEnvKeys(doc)
+	if err == nil || !strings.Contains(err.Error(), "TS_AUTHKEY or TS_API_KEY+TS_TAILNET") || !strings.Contains(err.Error(), "valid mesh_nodes") {
+		t.Fatalf("expected missing tsnet keys and invalid mesh_nodes, got %v", err)
+	}
+}
+
+func TestCheckAppStatusSkipsHostsWithoutTheApp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/status":
+			_, _ = w.Write([]byte(`{"tailscale_ips":["100.64.0.1"],"uptime":"5m","nats":{"url":"nats://x","connections":2}}`))
+		case "/api/init":
+			_, _ = w.Write([]byte(`{"version":"v1.1.1"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	base := srv.URL
+	msg, err := checkAppStatus(context.Background(), base)
+	if err != nil || !strings.Contains(msg, "conns=2") || !strings.Contains(msg, "version=v1.1.1") {
+		t.Fatalf("checkAppStatus = %q, %v", msg, err)
+	}
+	srv.Close()
+	_, err = checkAppStatus(context.Background(), base)
+	var se *statusError
+	if !errors.As(err, &se) || se.status != StatusSkip {
+		t.Fatalf("expected skip for a host without the app, got %v", err)
+	}
+}
+
+func TestEvaluateWebUI(t *testing.T) {
+	st := webUIState{Title: "Dialtone", Terminal: true, Three: true, RightPanel: true, UIVersion: ExpectedUIVersion, NATS: "12", Heartbeat: "1s", Lat: "--", Lon: "--", Yaw: "10"}
+	if msg, err := evaluateWebUI(st); err != nil || !strings.Contains(msg, "not received yet: gps") {
+		t.Fatalf("evaluateWebUI = %q, %v", msg, err)
+	}
+	for name, mutate := range map[string]func(*webUIState){
+		"missing UI components": func(s *webUIState) { s.Three = false },
+		"UI version":            func(s *webUIState) { s.UIVersion = "v0.9" },
+		"console errors":        func(s *webUIState) { s.ConsoleErrors = []string{"[exception] boom"} },
+		"heartbeat missing":     func(s *webUIState) { s.Heartbeat = "--" },
+	} {
+		bad := st
+		mutate(&bad)
+		if _, err := evaluateWebUI(bad); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+}
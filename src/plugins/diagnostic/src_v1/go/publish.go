@@ -0,0 +1,44 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+const SubjectPrefix = "diagnostic.report"
+
+// HostSubject is where a host's report is published in --watch mode, for
+// example diagnostic.report.legion. Subject tokens cannot contain dots or
+// spaces, so those become underscores.
+func HostSubject(host string) string {
+	host = strings.TrimSpace(host)
+	if host == "" {
+		host = "unknown"
+	}
+	host = strings.NewReplacer(".", "_", " ", "_", "*", "_", ">", "_").Replace(host)
+	return SubjectPrefix + "." + host
+}
+
+// PublishReport sends each host report to its subject and the combined
+// report to diagnostic.report.
+func PublishReport(nc *nats.Conn, rep Report) error {
+	for _, h := range rep.Hosts {
+		raw, err := json.Marshal(h)
+		if err != nil {
+			return err
+		}
+		if err := nc.Publish(HostSubject(h.Host), raw); err != nil {
+			return err
+		}
+	}
+	raw, err := json.Marshal(rep)
+	if err != nil {
+		return err
+	}
+	if err := nc.Publish(SubjectPrefix, raw); err != nil {
+		return err
+	}
+	return nc.Flush()
+}
@@ -0,0 +1,107 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type HostReport struct {
+	Host    string    `json:"host"`
+	OS      string    `json:"os,omitempty"`
+	Local   bool      `json:"local"`
+	Status  Status    `json:"status"`
+	Started time.Time `json:"started"`
+	Checks  []Result  `json:"checks"`
+}
+
+type Summary struct {
+	Pass int `json:"pass"`
+	Info int `json:"info"`
+	Warn int `json:"warn"`
+	Fail int `json:"fail"`
+	Skip int `json:"skip"`
+}
+
+type Report struct {
+	GeneratedAt time.Time    `json:"generated_at"`
+	Status      Status       `json:"status"`
+	Summary     Summary      `json:"summary"`
+	Hosts       []HostReport `json:"hosts"`
+}
+
+func NewReport(hosts []HostReport) Report {
+	rep := Report{GeneratedAt: time.Now().UTC(), Status: StatusPass, Hosts: hosts}
+	var all []Result
+	for _, h := range hosts {
+		all = append(all, Result{Status: h.Status})
+		for _, r := range h.Checks {
+			switch r.Status {
+			case StatusPass:
+				rep.Summary.Pass++
+			case StatusInfo:
+				rep.Summary.Info++
+			case StatusWarn:
+				rep.Summary.Warn++
+			case StatusFail:
+				rep.Summary.Fail++
+			case StatusSkip:
+				rep.Summary.Skip++
+			}
+		}
+	}
+	rep.Status = worstStatus(all)
+	return rep
+}
+
+func (r Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+func (r Report) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Diagnostics: %s\n\n", r.Status)
+	fmt.Fprintf(&b, "Generated %s. %d pass, %d warn, %d fail, %d skip, %d info.\n",
+		r.GeneratedAt.Format(time.RFC3339), r.Summary.Pass, r.Summary.Warn, r.Summary.Fail, r.Summary.Skip, r.Summary.Info)
+	for _, h := range r.Hosts {
+		where := "mesh"
+		if h.Local {
+			where = "local"
+		}
+		fmt.Fprintf(&b, "\n## %s (%s, %s): %s\n\n", h.Host, where, defaultString(h.OS, "unknown os"), h.Status)
+		b.WriteString("| Check | Severity | Status | Message |\n")
+		b.WriteString("| --- | --- | --- | --- |\n")
+		var fixes []Result
+		for _, c := range h.Checks {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", c.Name, c.Severity, c.Status, markdownCell(c.Message))
+			if c.Remediation != "" {
+				fixes = append(fixes, c)
+			}
+		}
+		if len(fixes) > 0 {
+			b.WriteString("\nRemediation:\n\n")
+			for _, c := range fixes {
+				fmt.Fprintf(&b, "- `%s`: %s\n", c.Name, c.Remediation)
+			}
+		}
+	}
+	return b.String()
+}
+
+func markdownCell(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.ReplaceAll(s, "|", `\|`)
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > 160 {
+		s = s[:157] + "..."
+	}
+	return s
+}
+
+func defaultString(v, fallback string) string {
+	if strings.TrimSpace(v) == "" {
+		return fallback
+	}
+	return v
+}
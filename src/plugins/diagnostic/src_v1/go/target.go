@@ -0,0 +1,78 @@
+package diagnostic
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+type localTarget struct {
+	name string
+}
+
+// LocalTarget runs check commands on this host.
+func LocalTarget() Target {
+	name, _ := os.Hostname()
+	if name == "" {
+		name = "local"
+	}
+	return localTarget{name: name}
+}
+
+func (t localTarget) Name() string { return t.name }
+func (t localTarget) Local() bool  { return true }
+
+func (t localTarget) OS() string {
+	if runtime.GOOS == "darwin" {
+		return "macos"
+	}
+	return runtime.GOOS
+}
+
+func (t localTarget) Exec(ctx context.Context, command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-Command", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	out, err := cmd.CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
+
+// CommandTarget adapts a blocking command runner, such as the ssh plugin's
+// RunNodeCommand, to a Target. The runner keeps going after ctx expires but
+// the check returns right away.
+func CommandTarget(name, osName string, run func(command string) (string, error)) Target {
+	return commandTarget{name: name, os: osName, run: run}
+}
+
+type commandTarget struct {
+	name string
+	os   string
+	run  func(string) (string, error)
+}
+
+func (t commandTarget) Name() string { return t.name }
+func (t commandTarget) OS() string   { return t.os }
+func (t commandTarget) Local() bool  { return false }
+
+func (t commandTarget) Exec(ctx context.Context, command string) (string, error) {
+	type result struct {
+		out string
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := t.run(command)
+		done <- result{out: strings.TrimSpace(out), err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.out, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
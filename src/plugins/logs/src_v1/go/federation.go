@@ -0,0 +1,206 @@
+package logs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	nserver "github.com/nats-io/nats-server/v2/server"
+)
+
+// Leafnode federation joins the per-host embedded NATS servers (robot,
+// chrome daemon) to the REPL leader's bus. The leader is the hub and owns
+// the subject rules: each leaf role authenticates as its own leafnode user
+// whose permissions decide what flows upstream (leaf -> hub) and downstream
+// (hub -> leaf). Leaves only need the hub URLs and the shared token.
+
+const (
+	DefaultLeafPort        = 7422
+	LeafReconnectInterval  = 2 * time.Second
+	leafListenEnv          = "DIALTONE_NATS_LEAF_LISTEN"
+	leafTokenEnv           = "DIALTONE_NATS_LEAF_TOKEN"
+	LeafRoleRobot          = "robot"
+	LeafRoleChrome         = "chrome"
+	leafURLScheme          = "nats-leaf"
+	leafDefaultListenHost  = "0.0.0.0"
+	leafReplyInboxWildcard = "_INBOX.>"
+	leafLocalUser          = "local"
+)
+
+type LeafRule struct {
+	Role       string   `json:"role"`
+	Upstream   []string `json:"upstream"`
+	Downstream []string `json:"downstream"`
+}
+
+var DefaultLeafRules = []LeafRule{
+	{
+		Role:       LeafRoleRobot,
+		Upstream:   []string{"mavlink.>", "logs.robot.>", "robot.>", leafReplyInboxWildcard},
+		Downstream: []string{"rover.command", leafReplyInboxWildcard},
+	},
+	{
+		Role:       LeafRoleChrome,
+		Upstream:   []string{"repl.host.*.heartbeat.>", "logs.chrome.>", leafReplyInboxWildcard},
+		Downstream: []string{"chrome.src_v3.>", leafReplyInboxWildcard},
+	},
+}
+
+type EmbeddedNATSOption func(*nserver.Options) error
+
+// WithLeafHub accepts leafnode connections on listen for the given rules.
+func WithLeafHub(listen, token string, rules []LeafRule) EmbeddedNATSOption {
+	return func(opts *nserver.Options) error {
+		return ConfigureLeafHub(opts, listen, token, rules)
+	}
+}
+
+// LeafHubFromEnv returns the hub option configured by DIALTONE_NATS_LEAF_LISTEN
+// and DIALTONE_NATS_LEAF_TOKEN, or nil when federation is not enabled.
+func LeafHubFromEnv() EmbeddedNATSOption {
+	listen := strings.TrimSpace(os.Getenv(leafListenEnv))
+	if listen == "" {
+		return nil
+	}
+	return WithLeafHub(listen, LeafToken(), DefaultLeafRules)
+}
+
+func LeafToken() string {
+	return strings.TrimSpace(os.Getenv(leafTokenEnv))
+}
+
+func ConfigureLeafHub(opts *nserver.Options, listen, token string, rules []LeafRule) error {
+	if opts == nil {
+		return fmt.Errorf("nil nats options")
+	}
+	if strings.TrimSpace(token) == "" {
+		return fmt.Errorf("leafnode hub requires %s", leafTokenEnv)
+	}
+	host, port, err := parseLeafListen(listen)
+	if err != nil {
+		return err
+	}
+	// Leafnode-only users (opts.LeafNode.Users) carry no permissions, so each
+	// role is a regular user limited to LEAFNODE connections. Plain clients
+	// keep connecting without credentials through the no-auth local user.
+	if opts.NoAuthUser == "" {
+		opts.Users = append(opts.Users, &nserver.User{
+			Username:               leafLocalUser,
+			Password:               randomLeafSecret(),
+			AllowedConnectionTypes: map[string]struct{}{"STANDARD": {}, "WEBSOCKET": {}, "MQTT": {}},
+		})
+		opts.NoAuthUser = leafLocalUser
+	}
+	for _, rule := range rules {
+		role := strings.TrimSpace(rule.Role)
+		if role == "" {
+			return fmt.Errorf("leaf rule without role")
+		}
+		// Permissions read from the leaf's side, like any client: it may
+		// publish upstream subjects and subscribe to downstream ones. The
+		// hub sends them to the leaf, which enforces them as well.
+		opts.Users = append(opts.Users, &nserver.User{
+			Username:               role,
+			Password:               token,
+			AllowedConnectionTypes: map[string]struct{}{"LEAFNODE": {}},
+			Permissions: &nserver.Permissions{
+				Publish:   &nserver.SubjectPermission{Allow: append([]string(nil), rule.Upstream...)},
+				Subscribe: &nserver.SubjectPermission{Allow: append([]string(nil), rule.Downstream...)},
+			},
+		})
+	}
+	opts.LeafNode.Host = host
+	opts.LeafNode.Port = port
+	return nil
+}
+
+// ConfigureLeafRemote makes the server a leaf of the hub. URLs are tried in
+// the given order (callers pass them in mesh route preference order) and the
+// server keeps reconnecting on its own when the hub or route goes away.
+// denyDownstream drops hub subjects this leaf must never accept.
+func ConfigureLeafRemote(opts *nserver.Options, role, token string, urls []string, denyDownstream ...string) error {
+	if opts == nil {
+		return fmt.Errorf("nil nats options")
+	}
+	role = strings.TrimSpace(role)
+	if role == "" {
+		return fmt.Errorf("leaf role is required")
+	}
+	if len(urls) == 0 {
+		return fmt.Errorf("no leafnode hub urls for role %s", role)
+	}
+	remote := &nserver.RemoteLeafOpts{NoRandomize: true, DenyImports: denyDownstream}
+	for _, raw := range urls {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid leafnode url %q", raw)
+		}
+		u.User = url.UserPassword(role, token)
+		remote.URLs = append(remote.URLs, u)
+	}
+	opts.LeafNode.ReconnectInterval = LeafReconnectInterval
+	opts.LeafNode.Remotes = append(opts.LeafNode.Remotes, remote)
+	return nil
+}
+
+// LeafURLs turns hub hosts or explicit URLs into leafnode URLs.
+// Entries without a scheme get nats-leaf:// and the default leaf port.
+func LeafURLs(hosts []string, port int) []string {
+	if port <= 0 {
+		port = DefaultLeafPort
+	}
+	out := make([]string, 0, len(hosts))
+	seen := map[string]struct{}{}
+	for _, h := range hosts {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		if !strings.Contains(h, "://") {
+			if _, _, err := net.SplitHostPort(h); err != nil {
+				h = net.JoinHostPort(strings.Trim(h, "[]"), strconv.Itoa(port))
+			}
+			h = leafURLScheme + "://" + h
+		}
+		if _, ok := seen[h]; ok {
+			continue
+		}
+		seen[h] = struct{}{}
+		out = append(out, h)
+	}
+	return out
+}
+
+func randomLeafSecret() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func parseLeafListen(listen string) (string, int, error) {
+	listen = strings.TrimSpace(listen)
+	if listen == "" {
+		return "", 0, fmt.Errorf("leafnode listen address is required")
+	}
+	if !strings.Contains(listen, ":") {
+		listen = ":" + listen
+	}
+	host, rawPort, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid leafnode listen %q: %w", listen, err)
+	}
+	port, err := strconv.Atoi(rawPort)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid leafnode port %q: %w", rawPort, err)
+	}
+	if host == "" {
+		host = leafDefaultListenHost
+	}
+	return host, port, nil
+}
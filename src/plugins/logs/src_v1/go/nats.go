@@ -62,7 +62,7 @@ func StartEmbeddedNATS() (*EmbeddedNATS, error) {
 	return &EmbeddedNATS{server: srv, conn: nc}, nil
 }
 
-func StartEmbeddedNATSOnURL(natsURL string) (*EmbeddedNATS, error) {
+func StartEmbeddedNATSOnURL(natsURL string, options ...EmbeddedNATSOption) (*EmbeddedNATS, error) {
 	u, err := url.Parse(strings.TrimSpace(natsURL))
 	if err != nil {
 		return nil, fmt.Errorf("invalid nats url %q: %w", natsURL, err)
@@ -92,6 +92,14 @@ func StartEmbeddedNATSOnURL(natsURL string) (*EmbeddedNATS, error) {
 		JetStream: true,
 		StoreDir:  storeDir,
 	}
+	for _, apply := range options {
+		if apply == nil {
+			continue
+		}
+		if err := apply(opts); err != nil {
+			return nil, err
+		}
+	}
 	srv, err := nserver.NewServer(opts)
 	if err != nil {
 		return nil, err
@@ -83,11 +83,21 @@ func main() {
 				logs.Error("repl v3 bootstrap-http failed: %v", err)
 				os.Exit(1)
 			}
+		case "bootstrap-sync":
+			if err := replv3.RunBootstrapSync(rest); err != nil {
+				logs.Error("repl v3 bootstrap-sync failed: %v", err)
+				os.Exit(1)
+			}
 		case "add-host":
 			if err := replv3.AddHost(rest); err != nil {
 				logs.Error("repl v3 add-host failed: %v", err)
 				os.Exit(1)
 			}
+		case "cp":
+			if err := replv3.RunCopy(rest); err != nil {
+				logs.Error("repl v3 cp failed: %v", err)
+				os.Exit(1)
+			}
 		case "status":
 			if err := replv3.RunStatus(rest); err != nil {
 				logs.Error("repl v3 status failed: %v", err)
@@ -170,14 +180,16 @@ func printUsage() {
 	logs.Raw("  check                                                Compile-check REPL v3 and scaffold packages")
 	logs.Raw("  build                                                Build REPL scaffold/binaries/packages")
 	logs.Raw("  run [--nats-url URL] [--topic NAME] [--name USER]")
-	logs.Raw("  leader [--nats-url URL] [--topic NAME] [--embedded-nats] [--tsnet] [--tsnet-nats-port PORT] [--hostname HOST]")
-	logs.Raw("  join [topic-name] [--nats-url URL] [--name HOST] [--topic NAME]")
+	logs.Raw("  leader [--nats-url URL] [--topic NAME] [--embedded-nats] [--tsnet] [--tsnet-nats-port PORT] [--hostname HOST] [--file-allow DIRS]")
+	logs.Raw("  join [topic-name] [--nats-url URL] [--name HOST] [--topic NAME] [--history N|--since T]")
 	logs.Raw("  inject --user NAME [--host HOST] [--nats-url URL] [--topic NAME] <command>")
 	logs.Raw("  bootstrap [--apply] [--wsl-host HOST] [--wsl-user USER]  Show/apply first-host bootstrap guide")
-	logs.Raw("  bootstrap-http [--host 127.0.0.1] [--port 8811]         Serve /install.sh + /dialtone.sh + /dialtone-main.tar.gz")
+	logs.Raw("  bootstrap-http [--host 127.0.0.1] [--port 8811]         Serve /install.sh + /dialtone.sh + /dialtone-main.tar.gz + /bootstrap/manifest.json")
+	logs.Raw("  bootstrap-sync [--url URL] [--dir DIR] [--verify] [--prune]  Fetch only changed chunks from bootstrap-http, or --verify by hash")
 	logs.Raw("  add-host --name wsl --host HOST --user USER              Add/update mesh host in env/dialtone.json")
 	logs.Raw("  status [--nats-url URL] [--topic NAME]")
-	logs.Raw("  service [--mode install|run|status] [--repo owner/repo] [--nats-url URL] [--topic NAME] [--hostname HOST] [--check-interval 5m] [--embedded-nats] [--tsnet] [--tsnet-nats-port PORT]")
+	logs.Raw("  cp [host:]SRC [host:]DST [--nats-url URL] [--topic NAME] [--timeout 10m] [--quiet]  Copy a file between hosts over the REPL bus")
+	logs.Raw("  service [--mode install|run|status] [--repo owner/repo] [--nats-url URL] [--topic NAME] [--hostname HOST] [--check-interval 5m] [--embedded-nats] [--tsnet] [--tsnet-nats-port PORT] [--file-allow DIRS]")
 	logs.Raw("  task list [--count N] [--state all|running|done] [--nats-url URL]")
 	logs.Raw("  task show --task-id TASK_ID [--nats-url URL]")
 	logs.Raw("  task log --task-id TASK_ID [--lines N] [--nats-url URL]")
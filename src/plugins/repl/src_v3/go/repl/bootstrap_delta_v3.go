@@ -0,0 +1,704 @@
+package repl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logs "dialtone/dev/plugins/logs/src_v1/go"
+)
+
+// Delta bootstrap: the bootstrap HTTP server publishes a manifest of every
+// file it would put in the tarball, split into fixed-size chunks addressed by
+// sha256. Hosts that already have a tree fetch only the chunks they cannot
+// find locally and swap changed files into place one rename at a time.
+
+const (
+	bootstrapManifestVersion = 1
+	bootstrapChunkSize       = 1 << 20
+	bootstrapManifestRoute   = "/bootstrap/manifest.json"
+	bootstrapChunkRoute      = "/bootstrap/chunks/"
+	bootstrapStateDir        = ".dialtone/bootstrap"
+	bootstrapChunkWorkers    = 4
+)
+
+type repoManifest struct {
+	Version   int            `json:"version"`
+	ChunkSize int            `json:"chunk_size"`
+	TreeHash  string         `json:"tree_hash"`
+	CreatedAt string         `json:"created_at"`
+	Files     []manifestFile `json:"files"`
+}
+
+type manifestFile struct {
+	Path   string   `json:"path"`
+	Mode   uint32   `json:"mode,omitempty"`
+	Size   int64    `json:"size"`
+	Hash   string   `json:"hash"`
+	Link   string   `json:"link,omitempty"`
+	Chunks []string `json:"chunks,omitempty"`
+}
+
+type chunkLocation struct {
+	path   string
+	offset int64
+	size   int64
+}
+
+type syncStats struct {
+	Files         int
+	Updated       int
+	Removed       int
+	ChunksFetched int
+	ChunksReused  int
+	BytesFetched  int64
+}
+
+// repoChunkServer serves the manifest and chunks for repoRoot. Files are
+// rehashed only when their size or mtime changes between manifest requests.
+type repoChunkServer struct {
+	repoRoot string
+
+	mu     sync.Mutex
+	cache  map[string]cachedManifestFile
+	chunks map[string]chunkLocation
+}
+
+type cachedManifestFile struct {
+	size    int64
+	modTime time.Time
+	file    manifestFile
+}
+
+func newRepoChunkServer(repoRoot string) *repoChunkServer {
+	return &repoChunkServer{
+		repoRoot: repoRoot,
+		cache:    map[string]cachedManifestFile{},
+		chunks:   map[string]chunkLocation{},
+	}
+}
+
+func (s *repoChunkServer) Register(mux *http.ServeMux) {
+	mux.HandleFunc(bootstrapManifestRoute, s.handleManifest)
+	mux.HandleFunc(bootstrapChunkRoute, s.handleChunk)
+}
+
+func (s *repoChunkServer) Manifest() (repoManifest, error) {
+	paths, err := listRepoFiles(s.repoRoot)
+	if err != nil {
+		return repoManifest{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cache := make(map[string]cachedManifestFile, len(paths))
+	chunks := make(map[string]chunkLocation, len(s.chunks))
+	manifest := repoManifest{Version: bootstrapManifestVersion, ChunkSize: bootstrapChunkSize, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	for _, raw := range paths {
+		rel := cleanManifestPath(raw)
+		if rel == "" {
+			continue
+		}
+		abs := filepath.Join(s.repoRoot, filepath.FromSlash(rel))
+		info, err := os.Lstat(abs)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return repoManifest{}, err
+		}
+		if !info.Mode().IsRegular() && info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		entry, ok := s.cache[rel]
+		if !ok || info.Mode()&os.ModeSymlink != 0 || entry.size != info.Size() || !entry.modTime.Equal(info.ModTime()) || entry.file.Mode != manifestMode(info) {
+			file, err := hashManifestFile(abs, rel, info)
+			if err != nil {
+				return repoManifest{}, err
+			}
+			entry = cachedManifestFile{size: info.Size(), modTime: info.ModTime(), file: file}
+		}
+		if entry.file.Link != "" && !safeManifestLink(rel, entry.file.Link) {
+			// Clients refuse links that leave the tree; leave them out.
+			continue
+		}
+		cache[rel] = entry
+		for i, sum := range entry.file.Chunks {
+			offset := int64(i) * bootstrapChunkSize
+			chunks[sum] = chunkLocation{path: abs, offset: offset, size: min(bootstrapChunkSize, entry.file.Size-offset)}
+		}
+		manifest.Files = append(manifest.Files, entry.file)
+	}
+	s.cache, s.chunks = cache, chunks
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+	manifest.TreeHash = manifestTreeHash(manifest.Files)
+	return manifest, nil
+}
+
+func (s *repoChunkServer) handleManifest(w http.ResponseWriter, r *http.Request) {
+	manifest, err := s.Manifest()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(manifest)
+}
+
+func (s *repoChunkServer) handleChunk(w http.ResponseWriter, r *http.Request) {
+	sum := strings.TrimPrefix(r.URL.Path, bootstrapChunkRoute)
+	if !isChunkHash(sum) {
+		http.Error(w, "invalid chunk hash", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	loc, ok := s.chunks[sum]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown chunk; fetch the manifest again", http.StatusNotFound)
+		return
+	}
+	data, err := readChunk(loc)
+	if err != nil || hashBytes(data) != sum {
+		// The file changed after the manifest was built.
+		http.Error(w, "chunk changed on disk; fetch the manifest again", http.StatusGone)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	_, _ = w.Write(data)
+}
+
+func RunBootstrapSync(args []string) error {
+	fs := flag.NewFlagSet("repl-v3-bootstrap-sync", flag.ContinueOnError)
+	baseURL := fs.String("url", "", "Bootstrap HTTP server base URL (default DIALTONE_BOOTSTRAP_HTTP_URL or http://127.0.0.1:8811)")
+	dir := fs.String("dir", "", "Target repo directory (default: current repo root)")
+	verify := fs.Bool("verify", false, "Only compare the local tree with the manifest by hash")
+	prune := fs.Bool("prune", false, "Remove files placed by an earlier sync that are no longer in the manifest")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	url := strings.TrimRight(strings.TrimSpace(*baseURL), "/")
+	if url == "" {
+		url = strings.TrimRight(strings.TrimSpace(os.Getenv("DIALTONE_BOOTSTRAP_HTTP_URL")), "/")
+	}
+	if url == "" {
+		url = "http://127.0.0.1:8811"
+	}
+	target := strings.TrimSpace(*dir)
+	if target == "" {
+		repoRoot, _, err := resolveRoots()
+		if err != nil {
+			return fmt.Errorf("--dir is required outside a dialtone repo: %w", err)
+		}
+		target = repoRoot
+	}
+	client := &http.Client{Timeout: 2 * time.Minute}
+	manifest, err := fetchRepoManifest(client, url)
+	if err != nil {
+		return err
+	}
+	if *verify {
+		diffs, err := verifyRepoTree(target, manifest)
+		if err != nil {
+			return err
+		}
+		for _, d := range diffs {
+			logs.Raw("  %s", d)
+		}
+		if len(diffs) > 0 {
+			return fmt.Errorf("%s differs from %s in %d file(s) (remote tree %s)", target, url, len(diffs), shortHash(manifest.TreeHash))
+		}
+		logs.Info("repl v3 bootstrap verify ok: %d files match tree %s", len(manifest.Files), shortHash(manifest.TreeHash))
+		return nil
+	}
+	stats, err := syncRepoTree(client, url, target, manifest, *prune)
+	if err != nil {
+		return err
+	}
+	logs.Info("repl v3 bootstrap sync: tree %s files=%d updated=%d removed=%d chunks fetched=%d reused=%d bytes=%d",
+		shortHash(manifest.TreeHash), stats.Files, stats.Updated, stats.Removed, stats.ChunksFetched, stats.ChunksReused, stats.BytesFetched)
+	return nil
+}
+
+func fetchRepoManifest(client *http.Client, baseURL string) (repoManifest, error) {
+	resp, err := client.Get(baseURL + bootstrapManifestRoute)
+	if err != nil {
+		return repoManifest{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return repoManifest{}, fmt.Errorf("manifest %s: %s %s", baseURL, resp.Status, strings.TrimSpace(string(body)))
+	}
+	var manifest repoManifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return repoManifest{}, fmt.Errorf("decode manifest: %w", err)
+	}
+	if manifest.Version != bootstrapManifestVersion || manifest.ChunkSize != bootstrapChunkSize {
+		return repoManifest{}, fmt.Errorf("unsupported manifest version=%d chunk_size=%d", manifest.Version, manifest.ChunkSize)
+	}
+	for _, f := range manifest.Files {
+		if cleanManifestPath(f.Path) != f.Path {
+			return repoManifest{}, fmt.Errorf("manifest contains unsafe path %q", f.Path)
+		}
+		if f.Link != "" && !safeManifestLink(f.Path, f.Link) {
+			return repoManifest{}, fmt.Errorf("manifest link %s -> %q points outside the tree", f.Path, f.Link)
+		}
+		for _, sum := range f.Chunks {
+			if !isChunkHash(sum) {
+				return repoManifest{}, fmt.Errorf("manifest has invalid chunk %q for %s", sum, f.Path)
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// verifyRepoTree lists manifest files that are missing or differ locally.
+func verifyRepoTree(dir string, manifest repoManifest) ([]string, error) {
+	diffs := []string{}
+	for _, want := range manifest.Files {
+		abs := filepath.Join(dir, filepath.FromSlash(want.Path))
+		info, err := os.Lstat(abs)
+		if os.IsNotExist(err) {
+			diffs = append(diffs, "missing  "+want.Path)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		have, err := hashManifestFile(abs, want.Path, info)
+		if err != nil {
+			return nil, err
+		}
+		if have.Hash != want.Hash {
+			diffs = append(diffs, "changed  "+want.Path)
+		} else if have.Mode != want.Mode {
+			diffs = append(diffs, "mode     "+want.Path)
+		}
+	}
+	return diffs, nil
+}
+
+func syncRepoTree(client *http.Client, baseURL, dir string, manifest repoManifest, prune bool) (syncStats, error) {
+	stats := syncStats{Files: len(manifest.Files)}
+	stateDir := filepath.Join(dir, filepath.FromSlash(bootstrapStateDir))
+	chunkDir := filepath.Join(stateDir, "chunks")
+	if err := os.MkdirAll(chunkDir, 0o755); err != nil {
+		return stats, err
+	}
+
+	// Hash what is already on disk. Chunks of unchanged files can be read in
+	// place; chunks of files about to be replaced are copied to the chunk
+	// cache first so a rename cannot pull them out from under a later file.
+	local := map[string]chunkLocation{}
+	staged := map[string]chunkLocation{}
+	changed := make([]manifestFile, 0)
+	for _, want := range manifest.Files {
+		abs := filepath.Join(dir, filepath.FromSlash(want.Path))
+		info, err := os.Lstat(abs)
+		if err != nil && !os.IsNotExist(err) {
+			return stats, err
+		}
+		if err == nil && info.IsDir() {
+			return stats, fmt.Errorf("%s is a directory locally but a file in the manifest", want.Path)
+		}
+		if err != nil || (!info.Mode().IsRegular() && info.Mode()&os.ModeSymlink == 0) {
+			changed = append(changed, want)
+			continue
+		}
+		have, err := hashManifestFile(abs, want.Path, info)
+		if err != nil {
+			return stats, err
+		}
+		target := local
+		if have.Hash != want.Hash || have.Mode != want.Mode {
+			changed = append(changed, want)
+			target = staged
+		}
+		for i, sum := range have.Chunks {
+			offset := int64(i) * bootstrapChunkSize
+			target[sum] = chunkLocation{path: abs, offset: offset, size: min(bootstrapChunkSize, have.Size-offset)}
+		}
+	}
+
+	missing := []string{}
+	seen := map[string]bool{}
+	for _, f := range changed {
+		for _, sum := range f.Chunks {
+			if seen[sum] {
+				continue
+			}
+			seen[sum] = true
+			if _, ok := local[sum]; ok {
+				stats.ChunksReused++
+				continue
+			}
+			cached := filepath.Join(chunkDir, sum)
+			if _, err := os.Stat(cached); err == nil {
+				stats.ChunksReused++
+				continue
+			}
+			if loc, ok := staged[sum]; ok {
+				data, err := readChunk(loc)
+				if err == nil && hashBytes(data) == sum {
+					if err := writeFileAtomic(cached, data, 0o644); err != nil {
+						return stats, err
+					}
+					stats.ChunksReused++
+					continue
+				}
+			}
+			missing = append(missing, sum)
+		}
+	}
+	fetched, bytesFetched, err := fetchChunks(client, baseURL, chunkDir, missing)
+	stats.ChunksFetched, stats.BytesFetched = fetched, bytesFetched
+	if err != nil {
+		return stats, err
+	}
+
+	for _, f := range changed {
+		if err := applyManifestFile(dir, chunkDir, local, f); err != nil {
+			return stats, fmt.Errorf("apply %s: %w", f.Path, err)
+		}
+		stats.Updated++
+	}
+
+	statePath := filepath.Join(stateDir, "manifest.json")
+	if prune {
+		removed, err := pruneRepoTree(dir, statePath, manifest)
+		stats.Removed = removed
+		if err != nil {
+			return stats, err
+		}
+	}
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return stats, err
+	}
+	if err := writeFileAtomic(statePath, raw, 0o644); err != nil {
+		return stats, err
+	}
+	return stats, os.RemoveAll(chunkDir)
+}
+
+func fetchChunks(client *http.Client, baseURL, chunkDir string, sums []string) (int, int64, error) {
+	var (
+		mu      sync.Mutex
+		fetched int
+		total   int64
+		errs    []error
+		wg      sync.WaitGroup
+	)
+	queue := make(chan string)
+	for i := 0; i < bootstrapChunkWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sum := range queue {
+				n, err := fetchChunk(client, baseURL, chunkDir, sum)
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					fetched++
+					total += n
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, sum := range sums {
+		queue <- sum
+	}
+	close(queue)
+	wg.Wait()
+	return fetched, total, errors.Join(errs...)
+}
+
+func fetchChunk(client *http.Client, baseURL, chunkDir, sum string) (int64, error) {
+	resp, err := client.Get(baseURL + bootstrapChunkRoute + sum)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return 0, fmt.Errorf("chunk %s: %s %s", shortHash(sum), resp.Status, strings.TrimSpace(string(body)))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, bootstrapChunkSize+1))
+	if err != nil {
+		return 0, err
+	}
+	if hashBytes(data) != sum {
+		return 0, fmt.Errorf("chunk %s: hash mismatch", shortHash(sum))
+	}
+	return int64(len(data)), writeFileAtomic(filepath.Join(chunkDir, sum), data, 0o644)
+}
+
+// applyManifestFile assembles f next to its destination and renames it into
+// place, so readers see either the old or the new file.
+func applyManifestFile(dir, chunkDir string, local map[string]chunkLocation, f manifestFile) error {
+	abs := filepath.Join(dir, filepath.FromSlash(f.Path))
+	if err := checkNoSymlinkParents(dir, f.Path); err != nil {
+		return err
+	}
+	if f.Link != "" && !safeManifestLink(f.Path, f.Link) {
+		return fmt.Errorf("link target %q points outside the tree", f.Link)
+	}
+	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(abs), fmt.Sprintf(".%s.dialtone-sync-%d", filepath.Base(abs), os.Getpid()))
+	_ = os.Remove(tmp)
+	if f.Link != "" {
+		if err := os.Symlink(f.Link, tmp); err != nil {
+			return err
+		}
+		return os.Rename(tmp, abs)
+	}
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(f.Mode))
+	if err != nil {
+		return err
+	}
+	hasher := sha256.New()
+	w := io.MultiWriter(out, hasher)
+	for _, sum := range f.Chunks {
+		var data []byte
+		if loc, ok := local[sum]; ok {
+			data, err = readChunk(loc)
+		} else {
+			data, err = os.ReadFile(filepath.Join(chunkDir, sum))
+		}
+		if err == nil && hashBytes(data) != sum {
+			err = fmt.Errorf("chunk %s changed while syncing", shortHash(sum))
+		}
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		if err != nil {
+			_ = out.Close()
+			_ = os.Remove(tmp)
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if got := hex.EncodeToString(hasher.Sum(nil)); got != f.Hash {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("assembled hash %s, want %s", shortHash(got), shortHash(f.Hash))
+	}
+	if err := os.Chmod(tmp, os.FileMode(f.Mode)); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, abs)
+}
+
+// pruneRepoTree removes files listed in the previously applied manifest that
+// are gone from the new one. Files this sync never placed are left alone.
+func pruneRepoTree(dir, statePath string, manifest repoManifest) (int, error) {
+	raw, err := os.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var previous repoManifest
+	if err := json.Unmarshal(raw, &previous); err != nil {
+		return 0, fmt.Errorf("read previous bootstrap manifest: %w", err)
+	}
+	keep := make(map[string]bool, len(manifest.Files))
+	for _, f := range manifest.Files {
+		keep[f.Path] = true
+	}
+	removed := 0
+	for _, f := range previous.Files {
+		rel := cleanManifestPath(f.Path)
+		if rel == "" || keep[rel] {
+			continue
+		}
+		if err := checkNoSymlinkParents(dir, rel); err != nil {
+			return removed, err
+		}
+		if err := os.Remove(filepath.Join(dir, filepath.FromSlash(rel))); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func hashManifestFile(abs, rel string, info os.FileInfo) (manifestFile, error) {
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(abs)
+		if err != nil {
+			return manifestFile{}, err
+		}
+		return manifestFile{Path: rel, Link: target, Hash: hashBytes([]byte("link:" + target))}, nil
+	}
+	f, err := os.Open(abs)
+	if err != nil {
+		return manifestFile{}, err
+	}
+	defer f.Close()
+	out := manifestFile{Path: rel, Mode: manifestMode(info)}
+	whole := sha256.New()
+	buf := make([]byte, bootstrapChunkSize)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			whole.Write(buf[:n])
+			out.Chunks = append(out.Chunks, hashBytes(buf[:n]))
+			out.Size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return manifestFile{}, err
+		}
+	}
+	out.Hash = hex.EncodeToString(whole.Sum(nil))
+	return out, nil
+}
+
+// manifestMode keeps only the executable bit; umask decides the rest.
+func manifestMode(info os.FileInfo) uint32 {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return 0
+	}
+	if info.Mode().Perm()&0o111 != 0 {
+		return 0o755
+	}
+	return 0o644
+}
+
+func manifestTreeHash(files []manifestFile) string {
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00%o\x00%s\n", f.Path, f.Mode, f.Hash)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func cleanManifestPath(raw string) string {
+	rel := strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(raw)), "./")
+	if rel == "" || strings.HasPrefix(rel, "/") {
+		return ""
+	}
+	rel = path.Clean(rel)
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || shouldSkipTarPath(rel, false) {
+		return ""
+	}
+	return rel
+}
+
+// safeManifestLink reports whether a symlink at rel pointing to target stays
+// inside the tree: relative, and not climbing above the root.
+func safeManifestLink(rel, target string) bool {
+	target = filepath.ToSlash(target)
+	if target == "" || strings.HasPrefix(target, "/") || filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+		return false
+	}
+	resolved := path.Clean(path.Join(path.Dir(rel), target))
+	return resolved != ".." && !strings.HasPrefix(resolved, "../")
+}
+
+// checkNoSymlinkParents refuses rel when any directory between dir and rel
+// is a symlink, so a link placed by the server or already in the tree cannot
+// redirect a write outside dir.
+func checkNoSymlinkParents(dir, rel string) error {
+	parts := strings.Split(path.Dir(rel), "/")
+	cur := dir
+	for _, part := range parts {
+		if part == "." || part == "" {
+			continue
+		}
+		cur = filepath.Join(cur, part)
+		info, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s: parent %s is a symlink", rel, filepath.ToSlash(strings.TrimPrefix(cur, dir+string(filepath.Separator))))
+		}
+	}
+	return nil
+}
+
+func readChunk(loc chunkLocation) ([]byte, error) {
+	f, err := os.Open(loc.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data := make([]byte, loc.size)
+	if _, err := f.ReadAt(data, loc.offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func writeFileAtomic(dst string, data []byte, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func isChunkHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func shortHash(s string) string {
+	if len(s) > 12 {
+		return s[:12]
+	}
+	return s
+}
@@ -0,0 +1,229 @@
+package repl
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, root, rel string, data []byte, mode os.FileMode) {
+	t.Helper()
+	abs := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(abs, data, mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBootstrapSyncFetchesOnlyChangedChunks(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	big := bytes.Repeat([]byte("0123456789abcdef"), 3*bootstrapChunkSize/16) // three chunks
+	writeTestFile(t, src, "dialtone.sh", []byte("#!/bin/sh\necho hi\n"), 0o755)
+	writeTestFile(t, src, "src/big.bin", big, 0o644)
+	writeTestFile(t, src, "src/old.txt", []byte("old"), 0o644)
+	writeTestFile(t, src, "node_modules/skip.js", []byte("skip"), 0o644)
+
+	var chunkRequests atomic.Int64
+	mux := http.NewServeMux()
+	newRepoChunkServer(src).Register(mux)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, bootstrapChunkRoute) {
+			chunkRequests.Add(1)
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	sync := func(prune bool) syncStats {
+		t.Helper()
+		manifest, err := fetchRepoManifest(srv.Client(), srv.URL)
+		if err != nil {
+			t.Fatalf("fetchRepoManifest returned error: %v", err)
+		}
+		stats, err := syncRepoTree(srv.Client(), srv.URL, dst, manifest, prune)
+		if err != nil {
+			t.Fatalf("syncRepoTree returned error: %v", err)
+		}
+		if diffs, err := verifyRepoTree(dst, manifest); err != nil || len(diffs) != 0 {
+			t.Fatalf("verify after sync: %v %v", diffs, err)
+		}
+		return stats
+	}
+
+	// The big file's three chunks are identical, so one fetch covers them.
+	first := sync(true)
+	if first.Files != 3 || first.Updated != 3 || first.ChunksFetched != 3 || chunkRequests.Load() != 3 {
+		t.Fatalf("unexpected first sync: %+v (requests %d)", first, chunkRequests.Load())
+	}
+	if info, err := os.Stat(filepath.Join(dst, "dialtone.sh")); err != nil || info.Mode().Perm()&0o100 == 0 {
+		t.Fatalf("dialtone.sh not executable: %v %v", info, err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "node_modules")); !os.IsNotExist(err) {
+		t.Fatalf("skipped path was synced: %v", err)
+	}
+
+	// Change the tail of the big file, add and drop files. Only the changed
+	// chunk and the new file travel; a local-only file survives pruning.
+	copy(big[len(big)-4:], "tail")
+	writeTestFile(t, src, "src/big.bin", big, 0o644)
+	writeTestFile(t, src, "src/new.txt", []byte("new"), 0o644)
+	if err := os.Remove(filepath.Join(src, "src/old.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dst, "env/dialtone.json", []byte("{}"), 0o644)
+	chunkRequests.Store(0)
+	second := sync(true)
+	if second.Updated != 2 || second.ChunksFetched != 2 || second.Removed != 1 || chunkRequests.Load() != 2 {
+		t.Fatalf("unexpected second sync: %+v (requests %d)", second, chunkRequests.Load())
+	}
+	if _, err := os.Stat(filepath.Join(dst, "src/old.txt")); !os.IsNotExist(err) {
+		t.Fatalf("removed file was not pruned: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "env/dialtone.json")); err != nil {
+		t.Fatalf("local-only file was pruned: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, bootstrapStateDir, "chunks")); !os.IsNotExist(err) {
+		t.Fatalf("chunk cache left behind: %v", err)
+	}
+
+	// A second pass is a no-op, and --verify catches local edits.
+	chunkRequests.Store(0)
+	if third := sync(false); third.Updated != 0 || chunkRequests.Load() != 0 {
+		t.Fatalf("unexpected no-op sync: %+v", third)
+	}
+	writeTestFile(t, dst, "src/new.txt", []byte("edited"), 0o644)
+	manifest, _ := fetchRepoManifest(srv.Client(), srv.URL)
+	if diffs, _ := verifyRepoTree(dst, manifest); len(diffs) != 1 || diffs[0] != "changed  src/new.txt" {
+		t.Fatalf("unexpected verify diffs: %v", diffs)
+	}
+}
+
+func TestBootstrapChunkServerRejectsStaleChunks(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, src, "a.txt", []byte("first"), 0o644)
+	chunks := newRepoChunkServer(src)
+	manifest, err := chunks.Manifest()
+	if err != nil {
+		t.Fatalf("Manifest returned error: %v", err)
+	}
+	mux := http.NewServeMux()
+	chunks.Register(mux)
+	sum := manifest.Files[0].Chunks[0]
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+	if code := get(bootstrapChunkRoute + sum); code != http.StatusOK {
+		t.Fatalf("chunk: status %d", code)
+	}
+	writeTestFile(t, src, "a.txt", []byte("second"), 0o644)
+	if code := get(bootstrapChunkRoute + sum); code != http.StatusGone {
+		t.Fatalf("stale chunk: status %d", code)
+	}
+	if code := get(bootstrapChunkRoute + "not-a-sha256"); code != http.StatusBadRequest {
+		t.Fatalf("bad hash: status %d", code)
+	}
+}
+
+func TestBootstrapSyncRefusesWritesOutsideTree(t *testing.T) {
+	dst, outside := t.TempDir(), t.TempDir()
+	payload := []byte("pwned")
+	sum := hashBytes(payload)
+	manifest := repoManifest{Version: bootstrapManifestVersion, ChunkSize: bootstrapChunkSize, Files: []manifestFile{
+		{Path: "a", Link: outside, Hash: hashBytes([]byte("link:" + outside))},
+		{Path: "a/x", Mode: 0o644, Size: int64(len(payload)), Hash: sum, Chunks: []string{sum}},
+	}}
+	mux := http.NewServeMux()
+	mux.HandleFunc(bootstrapManifestRoute, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(manifest)
+	})
+	mux.HandleFunc(bootstrapChunkRoute, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(payload)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// An absolute or escaping link target is rejected with the manifest.
+	for _, link := range []string{outside, "../../etc", "b/../../x"} {
+		manifest.Files[0].Link = link
+		if _, err := fetchRepoManifest(srv.Client(), srv.URL); err == nil || !strings.Contains(err.Error(), "outside the tree") {
+			t.Fatalf("link %q: expected manifest to be rejected, got %v", link, err)
+		}
+	}
+
+	// A relative link inside the tree is fine, but nothing is written
+	// through it, and neither through a symlinked directory already present.
+	manifest.Files[0].Link = "b"
+	got, err := fetchRepoManifest(srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatalf("fetchRepoManifest returned error: %v", err)
+	}
+	if _, err := syncRepoTree(srv.Client(), srv.URL, dst, got, false); err == nil || !strings.Contains(err.Error(), "is a symlink") {
+		t.Fatalf("expected write through server link to fail, got %v", err)
+	}
+	if err := os.Remove(filepath.Join(dst, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dst, "a")); err != nil {
+		t.Fatal(err)
+	}
+	got.Files = got.Files[1:]
+	if _, err := syncRepoTree(srv.Client(), srv.URL, dst, got, false); err == nil || !strings.Contains(err.Error(), "is a symlink") {
+		t.Fatalf("expected write through local symlinked dir to fail, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "x")); !os.IsNotExist(err) {
+		t.Fatalf("file was written outside the tree: %v", err)
+	}
+}
+
+func TestBootstrapManifestListsModifiedTrackedFilesOnce(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	src := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", src, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+	writeTestFile(t, src, "a.txt", []byte("clean"), 0o644)
+	writeTestFile(t, src, "b.txt", []byte("before"), 0o644)
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "init")
+
+	writeTestFile(t, src, "b.txt", []byte("after!"), 0o644)
+	dirty, err := newRepoChunkServer(src).Manifest()
+	if err != nil {
+		t.Fatalf("Manifest returned error: %v", err)
+	}
+	if len(dirty.Files) != 2 || dirty.Files[0].Path != "a.txt" || dirty.Files[1].Path != "b.txt" {
+		t.Fatalf("expected each file once, got %+v", dirty.Files)
+	}
+
+	// The same content outside git must hash the same: the tree hash follows
+	// content, not whether git sees a file as modified.
+	plain := t.TempDir()
+	writeTestFile(t, plain, "a.txt", []byte("clean"), 0o644)
+	writeTestFile(t, plain, "b.txt", []byte("after!"), 0o644)
+	walked, err := newRepoChunkServer(plain).Manifest()
+	if err != nil {
+		t.Fatalf("Manifest returned error: %v", err)
+	}
+	if dirty.TreeHash != walked.TreeHash {
+		t.Fatalf("tree hash differs for identical content: %s != %s", dirty.TreeHash, walked.TreeHash)
+	}
+}
@@ -41,8 +41,13 @@ func RunBootstrapHTTP(args []string) error {
 	if _, err := os.Stat(srcDialtone); err != nil {
 		return fmt.Errorf("dialtone.sh not found at %s", srcDialtone)
 	}
+	chunks := newRepoChunkServer(repoRoot)
+	manifest, err := chunks.Manifest()
+	if err != nil {
+		return err
+	}
 	addr := fmt.Sprintf("%s:%d", strings.TrimSpace(*bindHost), *port)
-	srv, err := startBootstrapServerAtAddress(addr, repoTar, srcDialtone, "shell.dialtone.earth", false)
+	srv, err := startBootstrapServerAtAddress(addr, repoTar, srcDialtone, "shell.dialtone.earth", false, chunks)
 	if err != nil {
 		return err
 	}
@@ -53,10 +58,14 @@ func RunBootstrapHTTP(args []string) error {
 	logs.Info("  /install.sh")
 	logs.Info("  /dialtone.sh")
 	logs.Info("  /dialtone-main.tar.gz")
+	logs.Info("  %s (%d files, tree %s)", bootstrapManifestRoute, len(manifest.Files), shortHash(manifest.TreeHash))
+	logs.Info("  %s<sha256>", bootstrapChunkRoute)
 	logs.Info("Cloudflare example:")
 	logs.Info("  ./dialtone.sh cloudflare src_v1 tunnel start shell --url http://127.0.0.1:%d", *port)
 	logs.Info("Remote bootstrap example:")
 	logs.Info("  curl -fsSL https://shell.dialtone.earth/install.sh | bash -s -- repl src_v3 test")
+	logs.Info("Re-bootstrap an existing checkout with only the changed chunks:")
+	logs.Info("  ./dialtone.sh repl src_v3 bootstrap-sync --url http://%s", addr)
 	return srv.ListenAndServe()
 }
 
@@ -110,7 +119,7 @@ exec ./dialtone.sh "$@"
 	return baseURL, port, closeFn, nil
 }
 
-func startBootstrapServerAtAddress(addr, tarPath, dialtonePath, publicHost string, useResolve bool) (*http.Server, error) {
+func startBootstrapServerAtAddress(addr, tarPath, dialtonePath, publicHost string, useResolve bool, chunks *repoChunkServer) (*http.Server, error) {
 	addr = strings.TrimSpace(addr)
 	if addr == "" {
 		return nil, fmt.Errorf("bootstrap server address is required")
@@ -161,6 +170,9 @@ exec ./dialtone.sh "$@"
 `, curlLine, repoURLVersioned)
 		_, _ = io.WriteString(w, script)
 	})
+	if chunks != nil {
+		chunks.Register(mux)
+	}
 	srv := &http.Server{Addr: addr, Handler: mux}
 	return srv, nil
 }
@@ -90,28 +90,29 @@ func SetHooksForTest(h Hooks) func() {
 }
 
 type BusFrame struct {
-	Type      string   `json:"type"`
-	Scope     string   `json:"scope,omitempty"`
-	Kind      string   `json:"kind,omitempty"`
-	From      string   `json:"from,omitempty"`
-	Target    string   `json:"target,omitempty"`
-	Room      string   `json:"room,omitempty"`
-	Version   string   `json:"version,omitempty"`
-	OS        string   `json:"os,omitempty"`
-	Arch      string   `json:"arch,omitempty"`
-	ReplVer   string   `json:"repl_version,omitempty"`
-	DaemonVer string   `json:"daemon_version,omitempty"`
-	Command   string   `json:"command,omitempty"`
-	Args      []string `json:"args,omitempty"`
-	Prefix    string   `json:"prefix,omitempty"`
-	Message   string   `json:"message,omitempty"`
-	TaskID    string   `json:"task_id,omitempty"`
-	PID       int      `json:"pid,omitempty"`
-	LogPath   string   `json:"log_path,omitempty"`
-	ExitCode  int      `json:"exit_code,omitempty"`
-	Ready     bool     `json:"ready,omitempty"`
-	ServerID  string   `json:"server_id,omitempty"`
-	Timestamp string   `json:"timestamp"`
+	Type       string   `json:"type"`
+	Scope      string   `json:"scope,omitempty"`
+	Kind       string   `json:"kind,omitempty"`
+	From       string   `json:"from,omitempty"`
+	Target     string   `json:"target,omitempty"`
+	Room       string   `json:"room,omitempty"`
+	Version    string   `json:"version,omitempty"`
+	OS         string   `json:"os,omitempty"`
+	Arch       string   `json:"arch,omitempty"`
+	ReplVer    string   `json:"repl_version,omitempty"`
+	DaemonVer  string   `json:"daemon_version,omitempty"`
+	Command    string   `json:"command,omitempty"`
+	Args       []string `json:"args,omitempty"`
+	Prefix     string   `json:"prefix,omitempty"`
+	Message    string   `json:"message,omitempty"`
+	TaskID     string   `json:"task_id,omitempty"`
+	PID        int      `json:"pid,omitempty"`
+	LogPath    string   `json:"log_path,omitempty"`
+	ExitCode   int      `json:"exit_code,omitempty"`
+	Ready      bool     `json:"ready,omitempty"`
+	ServerID   string   `json:"server_id,omitempty"`
+	TransferID string   `json:"transfer_id,omitempty"`
+	Timestamp  string   `json:"timestamp"`
 }
 
 type HostStatus struct {
@@ -152,6 +153,9 @@ func RunLeader(args []string) error {
 	enableTSNet := fs.Bool("tsnet", true, "Start embedded tsnet identity on host when native tailscale is not already connected")
 	tsnetNATSPort := fs.Int("tsnet-nats-port", 0, "Expose NATS over tsnet on this port (default: port from --nats-url)")
 	hostname := fs.String("hostname", DefaultPromptName(), "Host name used in prompts")
+	roomHistory := fs.Int64("room-history", defaultRoomHistoryPerRoom, "Frames of history kept per room in JetStream (0 disables room history)")
+	roomHistoryAge := fs.Duration("room-history-age", defaultRoomHistoryMaxAge, "Maximum age of kept room history frames")
+	fileAllow := fs.String("file-allow", defaultFileAllow(), "Comma separated absolute directories this host serves for cp (ro: prefix = read-only, empty disables)")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
@@ -164,6 +168,15 @@ func RunLeader(args []string) error {
 	if broker != nil {
 		defer broker.Close()
 	}
+	if *roomHistory > 0 {
+		js, err := nc.JetStream()
+		if err == nil {
+			err = ensureRoomHistoryStream(js, *roomHistory, *roomHistoryAge)
+		}
+		if err != nil {
+			logs.Warn("REPL room history unavailable: %v", err)
+		}
+	}
 	clientNATSURL := leaderClientNATSURL(usedURL)
 	_ = os.Setenv("DIALTONE_REPL_NATS_URL", clientNATSURL)
 
@@ -389,6 +402,12 @@ func RunLeader(args []string) error {
 		return err
 	}
 	defer cmdSub.Unsubscribe()
+	stopFiles, err := startFileTransfers(nc, h, *fileAllow)
+	if err != nil {
+		logs.Warn("REPL file transfers unavailable: %v", err)
+	} else {
+		defer stopFiles()
+	}
 	healthSub, err := nc.Subscribe(leaderHealthSubject, func(msg *nats.Msg) {
 		st := buildLeaderState(clientNATSURL, tsnetPublicURL, roomName, h, serverID, *embedded, startedAt)
 		raw, _ := json.Marshal(st)
@@ -528,21 +547,44 @@ func RunJoin(args []string) error {
 	natsURL := fs.String("nats-url", resolveREPLNATSURL(), "NATS URL")
 	topic := topicFlag(fs, "Shared REPL topic")
 	name := fs.String("name", DefaultPromptName(), "Prompt name for this client")
+	historyLast := fs.Int("history", 0, "Replay the last N frames of the room from JetStream before live frames (heartbeat, daemon and probe frames do not count)")
+	historySince := fs.String("since", "", "Replay room frames since a duration ago (15m) or an RFC3339 time")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 	if fs.NArg() > 1 {
-		return fmt.Errorf("usage: join [topic-name] [--nats-url URL] [--name HOST]")
+		return fmt.Errorf("usage: join [topic-name] [--nats-url URL] [--name HOST] [--history N|--since T]")
 	}
 	if fs.NArg() == 1 {
 		*topic = fs.Arg(0)
 	}
+	if *historyLast < 0 {
+		return fmt.Errorf("--history must not be negative")
+	}
+	if *historyLast > 0 && strings.TrimSpace(*historySince) != "" {
+		return fmt.Errorf("use either --history or --since, not both")
+	}
+	since, err := parseRoomHistorySince(*historySince, time.Now())
+	if err != nil {
+		return err
+	}
+	historyStart := roomHistoryStart{Last: *historyLast, Since: since}
 
-	nc, err := nats.Connect(strings.TrimSpace(*natsURL), nats.Timeout(1500*time.Millisecond))
+	var resumeFeeds func()
+	nc, err := nats.Connect(strings.TrimSpace(*natsURL),
+		nats.Timeout(1500*time.Millisecond),
+		nats.MaxReconnects(-1),
+		nats.ReconnectHandler(func(*nats.Conn) {
+			if resumeFeeds != nil {
+				resumeFeeds()
+			}
+		}),
+	)
 	if err != nil {
 		return err
 	}
 	defer nc.Close()
+	js := roomHistoryJetStream(nc)
 
 	prompt := normalizePromptName(*name)
 	roomName := sanitizeRoom(*topic)
@@ -551,8 +593,8 @@ func RunJoin(args []string) error {
 	natsAddr := strings.TrimSpace(*natsURL)
 
 	var subMu sync.Mutex
-	var sub *nats.Subscription
-	var attachedSub *nats.Subscription
+	var sub *roomFeed
+	var attachedSub *roomFeed
 	attachedTaskID := ""
 	var hostRunMu sync.Mutex
 	var switchRoom func(string, bool) error
@@ -560,11 +602,18 @@ func RunJoin(args []string) error {
 	interactive := isInputTTY(os.Stdin)
 	console := newJoinConsole(os.Stdout, prompt, interactive)
 
-	onRoomFrame := func(msg *nats.Msg) {
+	onRoomFrame := func(msg *nats.Msg, replay bool) {
 		frame, ok := decodeFrame(msg.Data)
 		if !ok {
 			return
 		}
+		if replay {
+			// History is scrollback only: never re-run control frames.
+			if !ephemeralFrameType(frame.Type) {
+				console.PrintFrame(frame)
+			}
+			return
+		}
 		console.PrintFrame(frame)
 		if frame.Type == frameTypeControl && frame.Target == prompt && frame.Command == controlJoinRoom {
 			nextRoom := sanitizeRoom(frame.Room)
@@ -671,7 +720,7 @@ func RunJoin(args []string) error {
 		}
 	}
 
-	onAttachedFrame := func(msg *nats.Msg) {
+	onAttachedFrame := func(msg *nats.Msg, _ bool) {
 		frame, ok := decodeFrame(msg.Data)
 		if !ok {
 			return
@@ -698,7 +747,7 @@ func RunJoin(args []string) error {
 		if strings.TrimSpace(subj) == "" {
 			return fmt.Errorf("invalid task id %s", taskID)
 		}
-		nextSub, err := nc.Subscribe(subj, onAttachedFrame)
+		nextSub, err := subscribeRoomFeed(nc, js, subj, historyStart, onAttachedFrame)
 		if err != nil {
 			return err
 		}
@@ -718,7 +767,7 @@ func RunJoin(args []string) error {
 			return nil
 		}
 		targetSubj := replRoomSubject(targetRoom)
-		nextSub, err := nc.Subscribe(targetSubj, onRoomFrame)
+		nextSub, err := subscribeRoomFeed(nc, js, targetSubj, historyStart, onRoomFrame)
 		if err != nil {
 			subMu.Unlock()
 			return err
@@ -745,11 +794,30 @@ func RunJoin(args []string) error {
 		return nil
 	}
 
-	initialSub, err := nc.Subscribe(currentSubj, onRoomFrame)
+	resumeFeeds = func() {
+		subMu.Lock()
+		feeds := []*roomFeed{sub, attachedSub}
+		subMu.Unlock()
+		for _, feed := range feeds {
+			if err := feed.Resume(); err != nil {
+				console.PrintFrame(BusFrame{Type: frameTypeLine, Scope: "index", Kind: "error", Message: fmt.Sprintf("Room history resume failed: %v", err)})
+				continue
+			}
+			if feed != nil && js != nil {
+				console.PrintFrame(BusFrame{Type: frameTypeLine, Scope: "index", Kind: "status", Message: fmt.Sprintf("Reconnected; resuming after frame %d", feed.LastSeq())})
+			}
+		}
+	}
+	if historyStart.replays() && js == nil {
+		console.PrintFrame(BusFrame{Type: frameTypeLine, Scope: "index", Kind: "status", Message: "Room history is not available on this NATS server; showing live frames only"})
+	}
+	subMu.Lock()
+	initialSub, err := subscribeRoomFeed(nc, js, currentSubj, historyStart, onRoomFrame)
+	sub = initialSub
+	subMu.Unlock()
 	if err != nil {
 		return err
 	}
-	sub = initialSub
 	defer func() {
 		subMu.Lock()
 		defer subMu.Unlock()
@@ -2057,7 +2125,7 @@ func connectNATS(natsURL string, embedded bool) (*nats.Conn, *logs.EmbeddedNATS,
 		natsURL = resolveREPLNATSURL()
 	}
 	if embedded {
-		broker, err := logs.StartEmbeddedNATSOnURL(natsURL)
+		broker, err := logs.StartEmbeddedNATSOnURL(natsURL, logs.LeafHubFromEnv())
 		if err != nil {
 			return nil, nil, "", err
 		}
@@ -2084,7 +2152,12 @@ func publishFrame(nc *nats.Conn, subject string, frame BusFrame) error {
 	if err != nil {
 		return err
 	}
-	return nc.Publish(subject, payload)
+	msg := nats.NewMsg(subject)
+	msg.Data = payload
+	if ephemeralFrameType(frame.Type) {
+		msg.Header.Set(msgTTLHeader, ephemeralFrameTTL)
+	}
+	return nc.PublishMsg(msg)
 }
 
 func decodeFrame(data []byte) (BusFrame, bool) {
@@ -56,6 +56,8 @@ type serviceOptions struct {
 	TSNet          bool
 	TSNetNATSPort  int
 	AllowDowngrade bool
+	FileAllow      string
+	FileAllowSet   bool // --file-allow was given, even as "" to turn transfers off
 }
 
 func RunService(args []string) error {
@@ -72,6 +74,7 @@ func RunService(args []string) error {
 	enableTSNet := fs.Bool("tsnet", true, "Pass --tsnet to worker leader (auto-skips when native tailscale is already connected)")
 	tsnetNATSPort := fs.Int("tsnet-nats-port", 0, "Pass --tsnet-nats-port to worker leader")
 	allowDowngrade := fs.Bool("allow-downgrade", false, "Allow replacing worker with older version")
+	fileAllow := fs.String("file-allow", "", "Pass --file-allow to worker leader (directories this host serves for cp)")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
@@ -88,7 +91,13 @@ func RunService(args []string) error {
 		TSNet:          *enableTSNet,
 		TSNetNATSPort:  *tsnetNATSPort,
 		AllowDowngrade: *allowDowngrade,
+		FileAllow:      strings.TrimSpace(*fileAllow),
 	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "file-allow" {
+			opts.FileAllowSet = true
+		}
+	})
 	if opts.Mode == "" {
 		opts.Mode = "install"
 	}
@@ -280,6 +289,10 @@ func serviceRunArgs(opts serviceOptions) []string {
 	if opts.TSNetNATSPort > 0 {
 		args = append(args, "--tsnet-nats-port", strconv.Itoa(opts.TSNetNATSPort))
 	}
+	if opts.FileAllowSet {
+		// One --flag=value argument so an empty value survives the unit file.
+		args = append(args, "--file-allow="+opts.FileAllow)
+	}
 	return args
 }
 
@@ -425,6 +438,10 @@ func (m *serviceManager) startWorker(currentPath string, opts serviceOptions) er
 	if opts.TSNetNATSPort > 0 {
 		args = append(args, "--tsnet-nats-port", strconv.Itoa(opts.TSNetNATSPort))
 	}
+	if opts.FileAllowSet {
+		// One --flag=value argument so an empty value survives the unit file.
+		args = append(args, "--file-allow="+opts.FileAllow)
+	}
 	cmd := exec.Command(workerPath, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -0,0 +1,834 @@
+package repl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	configv1 "dialtone/dev/plugins/config/src_v1/go"
+	logs "dialtone/dev/plugins/logs/src_v1/go"
+	"github.com/nats-io/nats.go"
+)
+
+// File transfer over the REPL bus. The source host cuts the file into
+// bootstrapChunkSize chunks and stores each one in the repl_files_v3 object
+// store under its sha256, so a chunk that is already there is never sent
+// again. The destination host assembles the chunks into a partial file next
+// to the target, checking every chunk and the whole file against the
+// manifest before renaming it into place. A re-run after an interruption
+// resumes on both sides. The leader coordinates send then receive and every
+// step reports progress frames to the room.
+
+const (
+	fileTransferBucket   = "repl_files_v3"
+	fileTransferMaxAge   = 24 * time.Hour
+	fileCopySubject      = "repl.file.cp"
+	fileAllowEnv         = "DIALTONE_REPL_FILE_ALLOW"
+	fileProgressInterval = 500 * time.Millisecond
+	fileReadOnlyPrefix   = "ro:"
+	fileCopyReplyMargin  = 30 * time.Second
+)
+
+type fileEndpoint struct {
+	Host string `json:"host,omitempty"`
+	Path string `json:"path"`
+}
+
+func (e fileEndpoint) String() string {
+	if e.Host == "" {
+		return e.Path
+	}
+	return e.Host + ":" + e.Path
+}
+
+// parseFileEndpoint splits host:path. A single letter before the colon is a
+// Windows drive, and a path separator before it means a local path.
+func parseFileEndpoint(raw string) fileEndpoint {
+	raw = strings.TrimSpace(raw)
+	idx := strings.Index(raw, ":")
+	if idx <= 1 || strings.ContainsAny(raw[:idx], `/\`) {
+		return fileEndpoint{Path: raw}
+	}
+	return fileEndpoint{Host: normalizePromptName(raw[:idx]), Path: raw[idx+1:]}
+}
+
+type fileTransferManifest struct {
+	TransferID string       `json:"transfer_id"`
+	Source     fileEndpoint `json:"source"`
+	ChunkSize  int          `json:"chunk_size"`
+	File       manifestFile `json:"file"`
+	CreatedAt  string       `json:"created_at"`
+}
+
+// fileTransferStats counts chunks moved through the object store and
+// chunks that were already in place (in the store, or in the partial file).
+type fileTransferStats struct {
+	Chunks      int   `json:"chunks"`
+	Transferred int   `json:"transferred"`
+	Reused      int   `json:"reused"`
+	Bytes       int64 `json:"bytes"`
+}
+
+type fileCopyRequest struct {
+	TransferID string                `json:"transfer_id"`
+	From       string                `json:"from,omitempty"`
+	Room       string                `json:"room,omitempty"`
+	Source     fileEndpoint          `json:"source"`
+	Dest       fileEndpoint          `json:"dest"`
+	Manifest   *fileTransferManifest `json:"manifest,omitempty"`
+	TimeoutSec int                   `json:"timeout_sec,omitempty"`
+}
+
+type fileHostRequest struct {
+	TransferID string                `json:"transfer_id"`
+	Room       string                `json:"room,omitempty"`
+	Path       string                `json:"path"`
+	Manifest   *fileTransferManifest `json:"manifest,omitempty"`
+}
+
+type fileTransferReply struct {
+	TransferID string                `json:"transfer_id"`
+	Manifest   *fileTransferManifest `json:"manifest,omitempty"`
+	Path       string                `json:"path,omitempty"`
+	Sent       fileTransferStats     `json:"sent"`
+	Received   fileTransferStats     `json:"received"`
+	Error      string                `json:"error,omitempty"`
+}
+
+func fileHostSubject(host, op string) string {
+	host = subjectToken(host)
+	if host == "" {
+		host = "local"
+	}
+	return fmt.Sprintf("repl.host.%s.file.%s", host, op)
+}
+
+func nextTransferID(now time.Time) string {
+	return "cp-" + strings.TrimPrefix(nextTaskID(now), "task-")
+}
+
+func ensureFileTransferStore(js nats.JetStreamContext) (nats.ObjectStore, error) {
+	if js == nil {
+		return nil, fmt.Errorf("nil jetstream context")
+	}
+	obs, err := js.ObjectStore(fileTransferBucket)
+	if err == nil {
+		return obs, nil
+	}
+	if !errors.Is(err, nats.ErrStreamNotFound) && !errors.Is(err, nats.ErrBucketNotFound) {
+		return nil, err
+	}
+	return js.CreateObjectStore(&nats.ObjectStoreConfig{
+		Bucket:      fileTransferBucket,
+		Description: "REPL file transfer chunks",
+		TTL:         fileTransferMaxAge,
+		Storage:     nats.FileStorage,
+	})
+}
+
+func fileChunkObject(sum string) string { return "chunks/" + sum }
+
+func fileManifestObject(transferID string) string { return "manifests/" + transferID }
+
+// fileAllowRule lets a host read (and unless ReadOnly, write) under Dir.
+type fileAllowRule struct {
+	Dir      string
+	ReadOnly bool
+}
+
+// defaultFileAllow is DIALTONE_REPL_FILE_ALLOW, or the dialtone home
+// "files" directory when unset.
+func defaultFileAllow() string {
+	if raw := strings.TrimSpace(os.Getenv(fileAllowEnv)); raw != "" {
+		return raw
+	}
+	return filepath.Join(configv1.DefaultDialtoneHome(), "files")
+}
+
+// parseFileAllowRules reads a comma separated list of absolute directories;
+// a "ro:" prefix makes a directory read-only.
+func parseFileAllowRules(raw string) ([]fileAllowRule, error) {
+	var rules []fileAllowRule
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		rule := fileAllowRule{}
+		if strings.HasPrefix(entry, fileReadOnlyPrefix) {
+			rule.ReadOnly = true
+			entry = strings.TrimSpace(strings.TrimPrefix(entry, fileReadOnlyPrefix))
+		}
+		if !filepath.IsAbs(entry) {
+			return nil, fmt.Errorf("file allow rule %q must be an absolute path", entry)
+		}
+		rule.Dir = filepath.Clean(entry)
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// resolveAllowedPath turns a requested path into a checked absolute path.
+// Relative paths are taken from the first rule. Symlinks are resolved before
+// the check so a link inside an allowed directory cannot point outside it.
+func resolveAllowedPath(rules []fileAllowRule, raw string, write bool) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("empty path")
+	}
+	if len(rules) == 0 {
+		return "", fmt.Errorf("file transfers are disabled on this host (no allowed paths)")
+	}
+	abs := filepath.Clean(raw)
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(rules[0].Dir, abs)
+	}
+	real, err := resolveExistingPrefix(abs)
+	if err != nil {
+		return "", err
+	}
+	for _, rule := range rules {
+		dir, err := resolveExistingPrefix(rule.Dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(dir, real)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if write && rule.ReadOnly {
+			continue
+		}
+		return abs, nil
+	}
+	if write {
+		return "", fmt.Errorf("%s is not under a writable allowed path", abs)
+	}
+	return "", fmt.Errorf("%s is not under an allowed path", abs)
+}
+
+// resolveExistingPrefix resolves symlinks in the longest existing prefix of
+// p and appends the rest unchanged.
+func resolveExistingPrefix(p string) (string, error) {
+	rest := ""
+	for {
+		real, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return filepath.Join(p, rest), nil
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+		p = parent
+	}
+}
+
+// fileDestPath appends the source file name when dst is a directory or ends
+// with a separator.
+func fileDestPath(dst, sourcePath string) string {
+	name := filepath.Base(filepath.FromSlash(strings.ReplaceAll(sourcePath, `\`, "/")))
+	if strings.HasSuffix(dst, "/") || strings.HasSuffix(dst, `\`) {
+		return filepath.Join(dst, name)
+	}
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		return filepath.Join(dst, name)
+	}
+	return dst
+}
+
+type fileProgressFunc func(done, total int, bytes int64)
+
+// newFileProgress publishes at most one progress frame per interval, plus
+// the final one.
+func newFileProgress(nc *nats.Conn, room, transferID, host, verb string, size int64) fileProgressFunc {
+	var mu sync.Mutex
+	last := time.Time{}
+	return func(done, total int, bytes int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		if done < total && time.Since(last) < fileProgressInterval {
+			return
+		}
+		last = time.Now()
+		publishFileFrame(nc, room, transferID, "progress", fmt.Sprintf("%s %s %s %d/%d chunks (%s of %s)",
+			transferID, host, verb, done, total, formatFileBytes(bytes), formatFileBytes(size)))
+	}
+}
+
+func publishFileFrame(nc *nats.Conn, room, transferID, kind, message string) {
+	if nc == nil || strings.TrimSpace(room) == "" {
+		return
+	}
+	_ = publishFrame(nc, replRoomSubject(room), BusFrame{
+		Type:       frameTypeLine,
+		Scope:      "index",
+		Kind:       kind,
+		Room:       sanitizeRoom(room),
+		TransferID: transferID,
+		Message:    message,
+	})
+}
+
+func formatFileBytes(n int64) string {
+	if n <= 0 {
+		return "0 B"
+	}
+	return humanizeBytes(uint64(n))
+}
+
+// sendFileChunks stores path in the object store chunk by chunk, skipping
+// chunks already there, and then stores the manifest.
+func sendFileChunks(obs nats.ObjectStore, transferID string, source fileEndpoint, abs string, progress fileProgressFunc) (fileTransferManifest, fileTransferStats, error) {
+	stats := fileTransferStats{}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return fileTransferManifest{}, stats, err
+	}
+	if !info.Mode().IsRegular() {
+		return fileTransferManifest{}, stats, fmt.Errorf("%s is not a regular file", abs)
+	}
+	f, err := os.Open(abs)
+	if err != nil {
+		return fileTransferManifest{}, stats, err
+	}
+	defer f.Close()
+	total := int((info.Size() + bootstrapChunkSize - 1) / bootstrapChunkSize)
+	file := manifestFile{Path: filepath.Base(abs), Mode: manifestMode(info)}
+	whole := sha256.New()
+	buf := make([]byte, bootstrapChunkSize)
+	for {
+		n, readErr := io.ReadFull(f, buf)
+		if n > 0 {
+			chunk := buf[:n]
+			sum := hashBytes(chunk)
+			whole.Write(chunk)
+			if _, err := obs.GetInfo(fileChunkObject(sum)); err == nil {
+				stats.Reused++
+			} else if !errors.Is(err, nats.ErrObjectNotFound) {
+				return fileTransferManifest{}, stats, err
+			} else {
+				if _, err := obs.PutBytes(fileChunkObject(sum), chunk); err != nil {
+					return fileTransferManifest{}, stats, fmt.Errorf("store chunk %s: %w", shortHash(sum), err)
+				}
+				stats.Transferred++
+				stats.Bytes += int64(n)
+			}
+			file.Chunks = append(file.Chunks, sum)
+			file.Size += int64(n)
+			if progress != nil {
+				progress(len(file.Chunks), max(total, len(file.Chunks)), file.Size)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return fileTransferManifest{}, stats, readErr
+		}
+	}
+	if file.Size != info.Size() {
+		return fileTransferManifest{}, stats, fmt.Errorf("%s changed while it was being sent", abs)
+	}
+	file.Hash = hex.EncodeToString(whole.Sum(nil))
+	stats.Chunks = len(file.Chunks)
+	manifest := fileTransferManifest{
+		TransferID: transferID,
+		Source:     fileEndpoint{Host: source.Host, Path: abs},
+		ChunkSize:  bootstrapChunkSize,
+		File:       file,
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return fileTransferManifest{}, stats, err
+	}
+	if _, err := obs.PutBytes(fileManifestObject(transferID), raw); err != nil {
+		return fileTransferManifest{}, stats, err
+	}
+	return manifest, stats, nil
+}
+
+// receiveFileChunks assembles the manifest's file at dst. Chunks already
+// present in the partial file from an earlier attempt are kept.
+func receiveFileChunks(obs nats.ObjectStore, manifest fileTransferManifest, dst string, progress fileProgressFunc) (fileTransferStats, error) {
+	file := manifest.File
+	stats := fileTransferStats{Chunks: len(file.Chunks)}
+	if manifest.ChunkSize != bootstrapChunkSize || !isChunkHash(file.Hash) {
+		return stats, fmt.Errorf("unsupported transfer manifest chunk_size=%d", manifest.ChunkSize)
+	}
+	mode := os.FileMode(file.Mode)
+	if mode == 0 {
+		mode = 0o644
+	}
+	if info, err := os.Stat(dst); err == nil && info.Mode().IsRegular() && info.Size() == file.Size {
+		if have, err := hashManifestFile(dst, file.Path, info); err == nil && have.Hash == file.Hash {
+			stats.Reused = len(file.Chunks)
+			if progress != nil {
+				progress(len(file.Chunks), len(file.Chunks), file.Size)
+			}
+			return stats, os.Chmod(dst, mode)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return stats, err
+	}
+	partial := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".part-"+shortHash(file.Hash))
+	f, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+	partialSize := int64(0)
+	if info, err := f.Stat(); err == nil {
+		partialSize = info.Size()
+	}
+	written := int64(0)
+	for i, sum := range file.Chunks {
+		if !isChunkHash(sum) {
+			return stats, fmt.Errorf("manifest has invalid chunk %q", sum)
+		}
+		offset := int64(i) * bootstrapChunkSize
+		size := min(int64(bootstrapChunkSize), file.Size-offset)
+		if offset+size <= partialSize {
+			have := make([]byte, size)
+			if _, err := f.ReadAt(have, offset); err == nil && hashBytes(have) == sum {
+				stats.Reused++
+				written += size
+				if progress != nil {
+					progress(i+1, len(file.Chunks), written)
+				}
+				continue
+			}
+		}
+		data, err := obs.GetBytes(fileChunkObject(sum))
+		if err != nil {
+			return stats, fmt.Errorf("fetch chunk %s: %w", shortHash(sum), err)
+		}
+		if int64(len(data)) != size || hashBytes(data) != sum {
+			return stats, fmt.Errorf("chunk %s failed its checksum", shortHash(sum))
+		}
+		if _, err := f.WriteAt(data, offset); err != nil {
+			return stats, err
+		}
+		stats.Transferred++
+		stats.Bytes += size
+		written += size
+		if progress != nil {
+			progress(i+1, len(file.Chunks), written)
+		}
+	}
+	if err := f.Truncate(file.Size); err != nil {
+		return stats, err
+	}
+	if err := f.Sync(); err != nil {
+		return stats, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return stats, err
+	}
+	whole := sha256.New()
+	if _, err := io.Copy(whole, f); err != nil {
+		return stats, err
+	}
+	if got := hex.EncodeToString(whole.Sum(nil)); got != file.Hash {
+		_ = f.Close()
+		_ = os.Remove(partial)
+		return stats, fmt.Errorf("assembled file hash %s does not match %s", shortHash(got), shortHash(file.Hash))
+	}
+	if err := f.Close(); err != nil {
+		return stats, err
+	}
+	if err := os.Chmod(partial, mode); err != nil {
+		return stats, err
+	}
+	return stats, os.Rename(partial, dst)
+}
+
+// serveFileHost answers send and receive requests for host on behalf of the
+// leader, inside the allowed paths only.
+func serveFileHost(nc *nats.Conn, obs nats.ObjectStore, host string, rules []fileAllowRule) (func(), error) {
+	reply := func(msg *nats.Msg, out fileTransferReply) {
+		raw, _ := json.Marshal(out)
+		_ = msg.Respond(raw)
+	}
+	decode := func(msg *nats.Msg) (fileHostRequest, error) {
+		req := fileHostRequest{}
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return req, fmt.Errorf("invalid file transfer request: %w", err)
+		}
+		if strings.TrimSpace(req.TransferID) == "" {
+			return req, fmt.Errorf("missing transfer id")
+		}
+		return req, nil
+	}
+	sendSub, err := nc.Subscribe(fileHostSubject(host, "send"), func(msg *nats.Msg) {
+		go func() {
+			req, err := decode(msg)
+			if err != nil {
+				reply(msg, fileTransferReply{Error: err.Error()})
+				return
+			}
+			out := fileTransferReply{TransferID: req.TransferID}
+			abs, err := resolveAllowedPath(rules, req.Path, false)
+			if err != nil {
+				out.Error = err.Error()
+				reply(msg, out)
+				return
+			}
+			info, statErr := os.Stat(abs)
+			size := int64(0)
+			if statErr == nil {
+				size = info.Size()
+			}
+			manifest, stats, err := sendFileChunks(obs, req.TransferID, fileEndpoint{Host: host, Path: abs}, abs, newFileProgress(nc, req.Room, req.TransferID, host, "sent", size))
+			out.Sent = stats
+			if err != nil {
+				out.Error = err.Error()
+			} else {
+				out.Manifest = &manifest
+				out.Path = abs
+			}
+			reply(msg, out)
+		}()
+	})
+	if err != nil {
+		return nil, err
+	}
+	recvSub, err := nc.Subscribe(fileHostSubject(host, "recv"), func(msg *nats.Msg) {
+		go func() {
+			req, err := decode(msg)
+			if err == nil && req.Manifest == nil {
+				err = fmt.Errorf("missing transfer manifest")
+			}
+			if err != nil {
+				reply(msg, fileTransferReply{TransferID: req.TransferID, Error: err.Error()})
+				return
+			}
+			out := fileTransferReply{TransferID: req.TransferID, Manifest: req.Manifest}
+			abs, err := resolveAllowedPath(rules, req.Path, true)
+			if err == nil {
+				if strings.HasSuffix(req.Path, "/") || strings.HasSuffix(req.Path, `\`) {
+					abs += string(filepath.Separator)
+				}
+				abs, err = resolveAllowedPath(rules, fileDestPath(abs, req.Manifest.Source.Path), true)
+			}
+			if err != nil {
+				out.Error = err.Error()
+				reply(msg, out)
+				return
+			}
+			stats, err := receiveFileChunks(obs, *req.Manifest, abs, newFileProgress(nc, req.Room, req.TransferID, host, "received", req.Manifest.File.Size))
+			out.Received = stats
+			out.Path = abs
+			if err != nil {
+				out.Error = err.Error()
+			}
+			reply(msg, out)
+		}()
+	})
+	if err != nil {
+		_ = sendSub.Unsubscribe()
+		return nil, err
+	}
+	return func() {
+		_ = sendSub.Unsubscribe()
+		_ = recvSub.Unsubscribe()
+	}, nil
+}
+
+func requestFileHost(nc *nats.Conn, host, op string, req fileHostRequest, timeout time.Duration) (fileTransferReply, error) {
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return fileTransferReply{}, err
+	}
+	msg, err := nc.Request(fileHostSubject(host, op), raw, timeout)
+	if errors.Is(err, nats.ErrNoResponders) {
+		return fileTransferReply{}, fmt.Errorf("host %s is not serving file transfers", host)
+	}
+	if err != nil {
+		return fileTransferReply{}, fmt.Errorf("%s on %s: %w", op, host, err)
+	}
+	out := fileTransferReply{}
+	if err := json.Unmarshal(msg.Data, &out); err != nil {
+		return fileTransferReply{}, err
+	}
+	if out.Error != "" {
+		return out, fmt.Errorf("%s on %s: %s", op, host, out.Error)
+	}
+	return out, nil
+}
+
+// coordinateFileCopy is the leader side of cp: have the source host send
+// (unless the client already did), then the destination host receive
+// (unless the client will).
+func coordinateFileCopy(nc *nats.Conn, req fileCopyRequest) fileTransferReply {
+	out := fileTransferReply{TransferID: req.TransferID, Manifest: req.Manifest}
+	timeout := time.Duration(req.TimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+	fail := func(err error) fileTransferReply {
+		out.Error = err.Error()
+		publishFileFrame(nc, req.Room, req.TransferID, "error", fmt.Sprintf("Copy %s failed: %v", req.TransferID, err))
+		return out
+	}
+	publishFileFrame(nc, req.Room, req.TransferID, "status", fmt.Sprintf("Copy %s: %s -> %s", req.TransferID, req.Source, req.Dest))
+	if req.Source.Host != "" {
+		sent, err := requestFileHost(nc, req.Source.Host, "send", fileHostRequest{TransferID: req.TransferID, Room: req.Room, Path: req.Source.Path}, timeout)
+		out.Sent = sent.Sent
+		if err != nil {
+			return fail(err)
+		}
+		out.Manifest = sent.Manifest
+	}
+	if out.Manifest == nil {
+		return fail(fmt.Errorf("no manifest for %s", req.Source))
+	}
+	if req.Dest.Host != "" {
+		received, err := requestFileHost(nc, req.Dest.Host, "recv", fileHostRequest{TransferID: req.TransferID, Room: req.Room, Path: req.Dest.Path, Manifest: out.Manifest}, timeout)
+		out.Received = received.Received
+		if err != nil {
+			return fail(err)
+		}
+		out.Path = received.Path
+		publishFileFrame(nc, req.Room, req.TransferID, "status", fmt.Sprintf("Copy %s done: %s to %s:%s (sha256 %s)",
+			req.TransferID, formatFileBytes(out.Manifest.File.Size), req.Dest.Host, out.Path, shortHash(out.Manifest.File.Hash)))
+	}
+	return out
+}
+
+func serveFileCopy(nc *nats.Conn) (*nats.Subscription, error) {
+	return nc.QueueSubscribe(fileCopySubject, commandQueue, func(msg *nats.Msg) {
+		go func() {
+			req := fileCopyRequest{}
+			out := fileTransferReply{}
+			if err := json.Unmarshal(msg.Data, &req); err != nil {
+				out.Error = fmt.Sprintf("invalid copy request: %v", err)
+			} else if strings.TrimSpace(req.TransferID) == "" {
+				out.Error = "missing transfer id"
+			} else {
+				out = coordinateFileCopy(nc, req)
+			}
+			raw, _ := json.Marshal(out)
+			_ = msg.Respond(raw)
+		}()
+	})
+}
+
+// startFileTransfers serves this host's file operations and, for the
+// leader, cp coordination.
+func startFileTransfers(nc *nats.Conn, host, allow string) (func(), error) {
+	rules, err := parseFileAllowRules(allow)
+	if err != nil {
+		return nil, err
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	obs, err := ensureFileTransferStore(js)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if !rule.ReadOnly {
+			_ = os.MkdirAll(rule.Dir, 0o755)
+		}
+	}
+	stopHost, err := serveFileHost(nc, obs, host, rules)
+	if err != nil {
+		return nil, err
+	}
+	copySub, err := serveFileCopy(nc)
+	if err != nil {
+		stopHost()
+		return nil, err
+	}
+	return func() {
+		stopHost()
+		_ = copySub.Unsubscribe()
+	}, nil
+}
+
+// copyFileOverBus runs one cp from the client side. Local endpoints are
+// handled here; remote ones by the leader and the host agents.
+func copyFileOverBus(nc *nats.Conn, req fileCopyRequest, timeout time.Duration) (fileTransferReply, error) {
+	if req.Source.Host == "" && req.Dest.Host == "" {
+		return fileTransferReply{}, fmt.Errorf("at least one side must be host:path")
+	}
+	if strings.TrimSpace(req.Source.Path) == "" || strings.TrimSpace(req.Dest.Path) == "" {
+		return fileTransferReply{}, fmt.Errorf("source and destination paths are required")
+	}
+	req.TimeoutSec = int(timeout / time.Second)
+	var obs nats.ObjectStore
+	if req.Source.Host == "" || req.Dest.Host == "" {
+		js, err := nc.JetStream()
+		if err != nil {
+			return fileTransferReply{}, err
+		}
+		if obs, err = ensureFileTransferStore(js); err != nil {
+			return fileTransferReply{}, err
+		}
+	}
+	local := normalizePromptName(req.From)
+	out := fileTransferReply{TransferID: req.TransferID}
+	if req.Source.Host == "" {
+		abs, err := filepath.Abs(req.Source.Path)
+		if err != nil {
+			return out, err
+		}
+		size := int64(0)
+		if info, err := os.Stat(abs); err == nil {
+			size = info.Size()
+		}
+		manifest, stats, err := sendFileChunks(obs, req.TransferID, fileEndpoint{Host: local, Path: abs}, abs, newFileProgress(nc, req.Room, req.TransferID, local, "sent", size))
+		if err != nil {
+			return out, err
+		}
+		req.Manifest = &manifest
+		out.Sent = stats
+	}
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return out, err
+	}
+	msg, err := nc.Request(fileCopySubject, raw, fileCopyLeaderWait(req, timeout))
+	if errors.Is(err, nats.ErrNoResponders) {
+		return out, fmt.Errorf("no REPL leader is coordinating file transfers on this NATS")
+	}
+	if err != nil {
+		return out, err
+	}
+	leaderOut := fileTransferReply{}
+	if err := json.Unmarshal(msg.Data, &leaderOut); err != nil {
+		return out, err
+	}
+	if leaderOut.Error != "" {
+		return leaderOut, errors.New(leaderOut.Error)
+	}
+	if req.Source.Host != "" {
+		out.Sent = leaderOut.Sent
+	}
+	out.Manifest = leaderOut.Manifest
+	out.Received = leaderOut.Received
+	out.Path = leaderOut.Path
+	if req.Dest.Host == "" {
+		if out.Manifest == nil {
+			return out, fmt.Errorf("leader returned no manifest")
+		}
+		abs, err := filepath.Abs(req.Dest.Path)
+		if err != nil {
+			return out, err
+		}
+		if strings.HasSuffix(req.Dest.Path, "/") || strings.HasSuffix(req.Dest.Path, `\`) {
+			abs += string(filepath.Separator)
+		}
+		abs = fileDestPath(abs, out.Manifest.Source.Path)
+		stats, err := receiveFileChunks(obs, *out.Manifest, abs, newFileProgress(nc, req.Room, req.TransferID, local, "received", out.Manifest.File.Size))
+		out.Received = stats
+		out.Path = abs
+		if err != nil {
+			publishFileFrame(nc, req.Room, req.TransferID, "error", fmt.Sprintf("Copy %s failed: %v", req.TransferID, err))
+			return out, err
+		}
+		publishFileFrame(nc, req.Room, req.TransferID, "status", fmt.Sprintf("Copy %s done: %s to %s:%s (sha256 %s)",
+			req.TransferID, formatFileBytes(out.Manifest.File.Size), local, abs, shortHash(out.Manifest.File.Hash)))
+	}
+	return out, nil
+}
+
+// fileCopyLeaderWait is how long the client waits for the leader, which
+// spends up to timeout on each remote side in turn.
+func fileCopyLeaderWait(req fileCopyRequest, timeout time.Duration) time.Duration {
+	sides := 0
+	if req.Source.Host != "" {
+		sides++
+	}
+	if req.Dest.Host != "" {
+		sides++
+	}
+	return time.Duration(sides)*timeout + fileCopyReplyMargin
+}
+
+// parseCopyArgs parses flags placed before, between or after the paths,
+// since the usage puts them after SRC and DST.
+func parseCopyArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var paths []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return paths, nil
+		}
+		paths = append(paths, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func RunCopy(args []string) error {
+	fs := flag.NewFlagSet("repl-v3-cp", flag.ContinueOnError)
+	natsURL := fs.String("nats-url", resolveREPLNATSURL(), "NATS URL of the REPL leader")
+	topic := topicFlag(fs, "REPL topic that receives progress frames")
+	name := fs.String("name", DefaultPromptName(), "Host name for local paths in progress frames")
+	timeout := fs.Duration("timeout", 10*time.Minute, "Maximum time for each side of the transfer; a host-to-host copy can take up to twice this")
+	quiet := fs.Bool("quiet", false, "Do not print progress frames")
+	paths, err := parseCopyArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) != 2 {
+		return fmt.Errorf("usage: ./dialtone.sh repl src_v3 cp [host:]SRC [host:]DST [--nats-url URL] [--topic NAME] [--timeout 10m] [--quiet]")
+	}
+	url := strings.TrimSpace(*natsURL)
+	if err := EnsureLeaderRunning(url, defaultRoom); err != nil {
+		return err
+	}
+	nc, err := nats.Connect(url, nats.Timeout(1500*time.Millisecond))
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	req := fileCopyRequest{
+		TransferID: nextTransferID(time.Now()),
+		From:       normalizePromptName(*name),
+		Room:       sanitizeRoom(*topic),
+		Source:     parseFileEndpoint(paths[0]),
+		Dest:       parseFileEndpoint(paths[1]),
+	}
+	if !*quiet {
+		sub, err := nc.Subscribe(replRoomSubject(req.Room), func(msg *nats.Msg) {
+			if frame, ok := decodeFrame(msg.Data); ok && frame.TransferID == req.TransferID {
+				printFrame(os.Stdout, frame)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		defer sub.Unsubscribe()
+	}
+	out, err := copyFileOverBus(nc, req, *timeout)
+	_ = nc.Flush()
+	if err != nil {
+		return err
+	}
+	logs.Info("repl v3 cp %s: %s -> %s size=%d sha256=%s chunks=%d uploaded=%d reused=%d downloaded=%d kept=%d",
+		out.TransferID, req.Source, req.Dest, out.Manifest.File.Size, shortHash(out.Manifest.File.Hash),
+		len(out.Manifest.File.Chunks), out.Sent.Transferred, out.Sent.Reused, out.Received.Transferred, out.Received.Reused)
+	return nil
+}
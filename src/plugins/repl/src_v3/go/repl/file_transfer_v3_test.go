@@ -0,0 +1,318 @@
+package repl
+
+import (
+	"bytes"
+	"flag"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+type fileTransferFixture struct {
+	nc    *nats.Conn
+	obs   nats.ObjectStore
+	alpha string
+	beta  string
+}
+
+// startFileTransferFixture runs host agents for alpha (read-only) and beta
+// plus the cp coordinator on one JetStream server.
+func startFileTransferFixture(t *testing.T) fileTransferFixture {
+	t.Helper()
+	nc, _ := startRoomHistoryServer(t)
+	fx := fileTransferFixture{nc: nc, alpha: t.TempDir(), beta: t.TempDir()}
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("jetstream: %v", err)
+	}
+	if fx.obs, err = ensureFileTransferStore(js); err != nil {
+		t.Fatalf("object store: %v", err)
+	}
+	alphaRules, _ := parseFileAllowRules("ro:" + fx.alpha)
+	betaRules, _ := parseFileAllowRules(fx.beta)
+	for host, rules := range map[string][]fileAllowRule{"alpha": alphaRules, "beta": betaRules} {
+		stop, err := serveFileHost(nc, fx.obs, host, rules)
+		if err != nil {
+			t.Fatalf("serve %s: %v", host, err)
+		}
+		t.Cleanup(stop)
+	}
+	sub, err := serveFileCopy(nc)
+	if err != nil {
+		t.Fatalf("serve cp: %v", err)
+	}
+	t.Cleanup(func() { _ = sub.Unsubscribe() })
+	return fx
+}
+
+func randomFileData(t *testing.T, size int) []byte {
+	t.Helper()
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	return data
+}
+
+func (fx fileTransferFixture) copy(t *testing.T, src, dst string) (fileTransferReply, error) {
+	t.Helper()
+	return copyFileOverBus(fx.nc, fileCopyRequest{
+		TransferID: nextTransferID(time.Now()),
+		From:       "gamma",
+		Room:       "index",
+		Source:     parseFileEndpoint(src),
+		Dest:       parseFileEndpoint(dst),
+	}, 30*time.Second)
+}
+
+func TestCopyFileBetweenHostsReportsProgress(t *testing.T) {
+	fx := startFileTransferFixture(t)
+	data := randomFileData(t, 2*bootstrapChunkSize+12345)
+	if err := os.WriteFile(filepath.Join(fx.alpha, "build.bin"), data, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var frames []BusFrame
+	sub, err := fx.nc.Subscribe(replRoomSubject("index"), func(msg *nats.Msg) {
+		if frame, ok := decodeFrame(msg.Data); ok && frame.TransferID != "" {
+			mu.Lock()
+			frames = append(frames, frame)
+			mu.Unlock()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	out, err := fx.copy(t, "alpha:build.bin", "beta:incoming/")
+	if err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(fx.beta, "incoming", "build.bin"))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("expected copied file to match source (err=%v)", err)
+	}
+	if info, _ := os.Stat(filepath.Join(fx.beta, "incoming", "build.bin")); info.Mode().Perm()&0o111 == 0 {
+		t.Fatalf("expected executable bit to be kept, got %v", info.Mode())
+	}
+	if out.Sent.Chunks != 3 || out.Sent.Transferred != 3 || out.Received.Transferred != 3 {
+		t.Fatalf("expected 3 chunks sent and received, got %+v %+v", out.Sent, out.Received)
+	}
+	fx.nc.Flush()
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	var progress, done bool
+	for _, frame := range frames {
+		if frame.TransferID != out.TransferID {
+			t.Fatalf("unexpected transfer id on frame %+v", frame)
+		}
+		if frame.Kind == "progress" && strings.Contains(frame.Message, "beta received 3/3 chunks") {
+			progress = true
+		}
+		if frame.Kind == "status" && strings.Contains(frame.Message, "done") {
+			done = true
+		}
+	}
+	if !progress || !done {
+		t.Fatalf("expected progress and done frames, got %+v", frames)
+	}
+}
+
+func TestCopyFileResumesFromStoredChunksAndPartialFile(t *testing.T) {
+	fx := startFileTransferFixture(t)
+	data := randomFileData(t, 3*bootstrapChunkSize)
+	if err := os.WriteFile(filepath.Join(fx.alpha, "disk.img"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// An earlier attempt stored the first chunk and wrote it, plus a torn
+	// second chunk, into the destination's partial file.
+	if _, err := fx.obs.PutBytes(fileChunkObject(hashBytes(data[:bootstrapChunkSize])), data[:bootstrapChunkSize]); err != nil {
+		t.Fatal(err)
+	}
+	partial := filepath.Join(fx.beta, ".disk.img.part-"+shortHash(hashBytes(data)))
+	torn := append(append([]byte{}, data[:bootstrapChunkSize]...), bytes.Repeat([]byte{0xff}, bootstrapChunkSize)...)
+	if err := os.WriteFile(partial, torn, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := fx.copy(t, "alpha:"+filepath.Join(fx.alpha, "disk.img"), "beta:disk.img")
+	if err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if out.Sent.Reused != 1 || out.Sent.Transferred != 2 {
+		t.Fatalf("expected one stored chunk to be reused, got %+v", out.Sent)
+	}
+	if out.Received.Reused != 1 || out.Received.Transferred != 2 {
+		t.Fatalf("expected the good partial chunk to be kept and the torn one refetched, got %+v", out.Received)
+	}
+	got, _ := os.ReadFile(filepath.Join(fx.beta, "disk.img"))
+	if !bytes.Equal(got, data) {
+		t.Fatalf("expected resumed file to match source")
+	}
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Fatalf("expected partial file to be renamed into place, stat err=%v", err)
+	}
+
+	// Copying again finds the finished file and moves nothing.
+	again, err := fx.copy(t, "alpha:disk.img", "beta:disk.img")
+	if err != nil {
+		t.Fatalf("copy again: %v", err)
+	}
+	if again.Sent.Transferred != 0 || again.Received.Transferred != 0 || again.Received.Reused != 3 {
+		t.Fatalf("expected nothing to move on a repeat copy, got %+v %+v", again.Sent, again.Received)
+	}
+}
+
+func TestCopyFileRejectsCorruptChunk(t *testing.T) {
+	fx := startFileTransferFixture(t)
+	data := randomFileData(t, 1000)
+	sum := hashBytes(data)
+	if _, err := fx.obs.PutBytes(fileChunkObject(sum), bytes.Repeat([]byte{'x'}, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	manifest := fileTransferManifest{
+		TransferID: "cp-test",
+		Source:     fileEndpoint{Host: "alpha", Path: "/x/data.bin"},
+		ChunkSize:  bootstrapChunkSize,
+		File:       manifestFile{Path: "data.bin", Size: 1000, Hash: sum, Chunks: []string{sum}, Mode: 0o644},
+	}
+	_, err := receiveFileChunks(fx.obs, manifest, filepath.Join(fx.beta, "data.bin"), nil)
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("expected checksum failure, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(fx.beta, "data.bin")); !os.IsNotExist(err) {
+		t.Fatalf("expected no destination file after a bad chunk")
+	}
+}
+
+func TestCopyFileEnforcesAllowedPaths(t *testing.T) {
+	fx := startFileTransferFixture(t)
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("no"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret"), filepath.Join(fx.alpha, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(fx.beta, "ok.txt"), []byte("ok"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		src, dst, want string
+	}{
+		{"alpha:" + filepath.Join(outside, "secret"), "beta:x", "not under an allowed path"},
+		{"alpha:link", "beta:x", "not under an allowed path"},
+		{"alpha:../" + filepath.Base(outside) + "/secret", "beta:x", "not under an allowed path"},
+		{"beta:ok.txt", "alpha:copy.txt", "not under a writable allowed path"},
+		{"beta:ok.txt", "beta:" + filepath.Join(outside, "copy.txt"), "not under a writable allowed path"},
+		{"beta:ok.txt", "delta:x", "delta is not serving file transfers"},
+	}
+	for _, tc := range cases {
+		if _, err := fx.copy(t, tc.src, tc.dst); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("copy %s %s: expected %q, got %v", tc.src, tc.dst, tc.want, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "copy.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing written outside the allowed paths")
+	}
+}
+
+func TestCopyFileBetweenLocalAndRemote(t *testing.T) {
+	fx := startFileTransferFixture(t)
+	local := t.TempDir()
+	data := randomFileData(t, 4096)
+	if err := os.WriteFile(filepath.Join(local, "notes.txt"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fx.copy(t, filepath.Join(local, "notes.txt"), "beta:notes.txt"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(fx.beta, "notes.txt")); !bytes.Equal(got, data) {
+		t.Fatalf("expected uploaded file on beta")
+	}
+	out, err := fx.copy(t, "beta:notes.txt", local+string(filepath.Separator)+"back"+string(filepath.Separator))
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if out.Path != filepath.Join(local, "back", "notes.txt") {
+		t.Fatalf("expected download into directory, got %s", out.Path)
+	}
+	if got, _ := os.ReadFile(out.Path); !bytes.Equal(got, data) {
+		t.Fatalf("expected downloaded file to match")
+	}
+	if _, err := fx.copy(t, filepath.Join(local, "notes.txt"), filepath.Join(local, "again.txt")); err == nil {
+		t.Fatalf("expected local to local copy to be rejected")
+	}
+}
+
+func TestParseFileEndpointAndAllowRules(t *testing.T) {
+	cases := map[string]fileEndpoint{
+		"legion:/tmp/a":   {Host: "legion", Path: "/tmp/a"},
+		"wsl:notes.txt":   {Host: "wsl", Path: "notes.txt"},
+		"/tmp/a:b":        {Path: "/tmp/a:b"},
+		"./x:y":           {Path: "./x:y"},
+		`C:\Users\me\a`:   {Path: `C:\Users\me\a`},
+		"plain-file.txt":  {Path: "plain-file.txt"},
+		"gpu box:/data/x": {Host: "gpu-box", Path: "/data/x"},
+	}
+	for raw, want := range cases {
+		if got := parseFileEndpoint(raw); got != want {
+			t.Fatalf("parseFileEndpoint(%q) = %+v, want %+v", raw, got, want)
+		}
+	}
+	rules, err := parseFileAllowRules(" /srv/share , ro:/var/log ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0] != (fileAllowRule{Dir: "/srv/share"}) || rules[1] != (fileAllowRule{Dir: "/var/log", ReadOnly: true}) {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+	if _, err := parseFileAllowRules("relative/dir"); err == nil {
+		t.Fatalf("expected relative rule to be rejected")
+	}
+	if _, err := resolveAllowedPath(nil, "/tmp/x", false); err == nil {
+		t.Fatalf("expected no rules to disable transfers")
+	}
+}
+
+func TestFileCopyLeaderWaitCoversEachRemoteSide(t *testing.T) {
+	remote := fileCopyRequest{Source: fileEndpoint{Host: "legion", Path: "a"}, Dest: fileEndpoint{Host: "wsl", Path: "b"}}
+	if got := fileCopyLeaderWait(remote, time.Minute); got != 2*time.Minute+fileCopyReplyMargin {
+		t.Fatalf("host-to-host wait = %s", got)
+	}
+	upload := fileCopyRequest{Source: fileEndpoint{Path: "a"}, Dest: fileEndpoint{Host: "wsl", Path: "b"}}
+	if got := fileCopyLeaderWait(upload, time.Minute); got != time.Minute+fileCopyReplyMargin {
+		t.Fatalf("local-to-host wait = %s", got)
+	}
+}
+
+func TestServiceRunArgsPassEmptyFileAllow(t *testing.T) {
+	opts := serviceOptions{Repo: "timcash/dialtone", Room: "index", HostName: "legion", CheckInterval: time.Minute}
+	if args := strings.Join(serviceRunArgs(opts), " "); strings.Contains(args, "--file-allow") {
+		t.Fatalf("expected unset --file-allow to be omitted, got %s", args)
+	}
+	opts.FileAllowSet = true
+	args := serviceRunArgs(opts)
+	if args[len(args)-1] != "--file-allow=" {
+		t.Fatalf("expected explicit empty --file-allow to be passed, got %v", args)
+	}
+}
+
+func TestParseCopyArgsAcceptsFlagsAfterPaths(t *testing.T) {
+	fs := flag.NewFlagSet("cp", flag.ContinueOnError)
+	quiet := fs.Bool("quiet", false, "")
+	timeout := fs.Duration("timeout", time.Minute, "")
+	paths, err := parseCopyArgs(fs, []string{"legion:a.txt", "--timeout", "2m", "wsl:b/", "--quiet"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || paths[0] != "legion:a.txt" || paths[1] != "wsl:b/" || !*quiet || *timeout != 2*time.Minute {
+		t.Fatalf("unexpected parse: paths=%v quiet=%v timeout=%s", paths, *quiet, *timeout)
+	}
+}
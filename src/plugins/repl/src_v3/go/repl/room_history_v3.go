@@ -0,0 +1,297 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Room frames are kept in one JetStream stream over every room subject.
+// Retention is per room (per subject) so a chatty task room cannot push the
+// index room's scrollback out. Presence chatter (heartbeat, daemon, probe)
+// carries a short per-message TTL so it never crowds out real history.
+const (
+	roomHistoryStreamName     = "REPL_ROOMS"
+	roomHistorySubjects       = "repl.topic.>"
+	defaultRoomHistoryPerRoom = 1000
+	defaultRoomHistoryMaxAge  = 7 * 24 * time.Hour
+	ephemeralFrameTTL         = "30s"
+	msgTTLHeader              = "Nats-TTL"
+)
+
+func ephemeralFrameType(frameType string) bool {
+	switch strings.TrimSpace(frameType) {
+	case frameTypeHeartbeat, frameTypeDaemon, frameTypeProbe:
+		return true
+	default:
+		return false
+	}
+}
+
+func roomHistoryStreamConfig(perRoom int64, maxAge time.Duration) *nats.StreamConfig {
+	return &nats.StreamConfig{
+		Name:              roomHistoryStreamName,
+		Description:       "REPL room frame history",
+		Subjects:          []string{roomHistorySubjects},
+		Storage:           nats.FileStorage,
+		Retention:         nats.LimitsPolicy,
+		Discard:           nats.DiscardOld,
+		MaxMsgsPerSubject: perRoom,
+		MaxAge:            maxAge,
+		AllowMsgTTL:       true,
+	}
+}
+
+// ensureRoomHistoryStream creates the room history stream or brings an
+// existing one in line with the requested retention.
+func ensureRoomHistoryStream(js nats.JetStreamContext, perRoom int64, maxAge time.Duration) error {
+	if js == nil {
+		return fmt.Errorf("nil jetstream context")
+	}
+	cfg := roomHistoryStreamConfig(perRoom, maxAge)
+	info, err := js.StreamInfo(roomHistoryStreamName)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(cfg)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if info.Config.MaxMsgsPerSubject == cfg.MaxMsgsPerSubject && info.Config.MaxAge == cfg.MaxAge && info.Config.AllowMsgTTL {
+		return nil
+	}
+	_, err = js.UpdateStream(cfg)
+	return err
+}
+
+// roomHistoryStart says where a newly joined room feed begins: the last N
+// frames, frames since a time, or (zero value) only new frames.
+type roomHistoryStart struct {
+	Last  int
+	Since time.Time
+}
+
+func (s roomHistoryStart) replays() bool {
+	return s.Last > 0 || !s.Since.IsZero()
+}
+
+// parseRoomHistorySince accepts a duration back from now ("15m", "2h") or
+// an RFC3339 timestamp.
+func parseRoomHistorySince(raw string, now time.Time) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(raw); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("--since duration must be positive")
+		}
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q (use a duration like 15m or an RFC3339 time)", raw)
+}
+
+// roomFeed delivers one room subject to handle. With JetStream history it
+// replays per start, remembers the last stream sequence it handed to handle,
+// and Resume continues from the next one after a NATS reconnect. The
+// sequence lives in memory only, so a new join process starts from its own
+// --history/--since instead. replay is true for frames published before the
+// (re)subscribe; those are shown but must not trigger control actions again.
+// Without history it is a plain subscription and Resume is a no-op.
+type roomFeed struct {
+	js      nats.JetStreamContext
+	subject string
+	handle  func(msg *nats.Msg, replay bool)
+
+	mu       sync.Mutex
+	sub      *nats.Subscription
+	lastSeq  uint64
+	replayTo uint64
+	// With --history N, replayed frames are held until the feed catches up
+	// so only the last N non-ephemeral frames (and the presence frames
+	// between them) are handed on.
+	historyLast int
+	held        []*nats.Msg
+}
+
+func subscribeRoomFeed(nc *nats.Conn, js nats.JetStreamContext, subject string, start roomHistoryStart, handle func(msg *nats.Msg, replay bool)) (*roomFeed, error) {
+	f := &roomFeed{js: js, subject: subject, handle: handle}
+	if js == nil {
+		sub, err := nc.Subscribe(subject, func(msg *nats.Msg) { handle(msg, false) })
+		if err != nil {
+			return nil, err
+		}
+		f.sub = sub
+		return f, nil
+	}
+	info, err := js.StreamInfo(roomHistoryStreamName, &nats.StreamInfoRequest{SubjectsFilter: subject})
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replayTo = info.State.LastSeq
+	f.lastSeq = info.State.LastSeq
+	opts := []nats.SubOpt{nats.DeliverNew()}
+	switch {
+	case !start.Since.IsZero():
+		f.lastSeq = 0
+		opts = []nats.SubOpt{nats.StartTime(start.Since)}
+	case start.Last > 0:
+		f.lastSeq = 0
+		opts = []nats.SubOpt{nats.DeliverAll()}
+		if info.State.Subjects[subject] > 0 {
+			f.historyLast = start.Last
+		}
+	}
+	return f, f.subscribeLocked(opts...)
+}
+
+func (f *roomFeed) subscribeLocked(opts ...nats.SubOpt) error {
+	opts = append(opts, nats.AckNone(), nats.InactiveThreshold(time.Minute))
+	sub, err := f.js.Subscribe(f.subject, func(msg *nats.Msg) {
+		md, err := msg.Metadata()
+		if err != nil {
+			return
+		}
+		seq := md.Sequence.Stream
+		f.mu.Lock()
+		if msg.Sub != f.sub || seq <= f.lastSeq {
+			f.mu.Unlock()
+			return
+		}
+		f.lastSeq = seq
+		replay := seq <= f.replayTo
+		if f.historyLast == 0 {
+			f.mu.Unlock()
+			f.handle(msg, replay)
+			return
+		}
+		if replay {
+			f.holdLocked(msg)
+			// The room's newest retained frame may sit below replayTo, so
+			// NumPending is what says the backlog is done.
+			if seq < f.replayTo && md.NumPending > 0 {
+				f.mu.Unlock()
+				return
+			}
+		}
+		held := f.held
+		f.held = nil
+		f.historyLast = 0
+		f.mu.Unlock()
+		for _, m := range held {
+			f.handle(m, true)
+		}
+		if !replay {
+			f.handle(msg, false)
+		}
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	f.sub = sub
+	return nil
+}
+
+// holdLocked appends msg to the held backlog and drops frames from the
+// front until it spans exactly historyLast non-ephemeral frames.
+func (f *roomFeed) holdLocked(msg *nats.Msg) {
+	f.held = append(f.held, msg)
+	kept := 0
+	for _, m := range f.held {
+		if !ephemeralRoomMsg(m) {
+			kept++
+		}
+	}
+	for len(f.held) > 0 && (kept > f.historyLast || kept == f.historyLast && ephemeralRoomMsg(f.held[0])) {
+		if !ephemeralRoomMsg(f.held[0]) {
+			kept--
+		}
+		f.held = f.held[1:]
+	}
+}
+
+// ephemeralRoomMsg reports whether publishFrame gave msg a per-message TTL
+// (heartbeat, daemon and probe frames).
+func ephemeralRoomMsg(msg *nats.Msg) bool {
+	return msg.Header.Get(msgTTLHeader) != ""
+}
+
+// Resume replaces the subscription with one that starts right after the
+// last frame handled, so frames published while disconnected are replayed
+// once, in order.
+func (f *roomFeed) Resume() error {
+	if f == nil || f.js == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sub != nil {
+		_ = f.sub.Unsubscribe()
+	}
+	if info, err := f.js.StreamInfo(roomHistoryStreamName); err == nil {
+		f.replayTo = info.State.LastSeq
+	}
+	if f.historyLast > 0 {
+		// Dropped before the --history backlog was handed on: rebuild it.
+		f.held = nil
+		f.lastSeq = 0
+	}
+	return f.subscribeLocked(nats.StartSequence(f.lastSeq + 1))
+}
+
+func (f *roomFeed) LastSeq() uint64 {
+	if f == nil {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lastSeq
+}
+
+func (f *roomFeed) Unsubscribe() error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sub == nil {
+		return nil
+	}
+	err := f.sub.Unsubscribe()
+	f.sub = nil
+	return err
+}
+
+// roomHistoryJetStream returns a JetStream context when the room history
+// stream exists, or nil so callers fall back to live-only subscriptions.
+func roomHistoryJetStream(nc *nats.Conn) nats.JetStreamContext {
+	js, err := nc.JetStream(nats.MaxWait(1500 * time.Millisecond))
+	if err != nil {
+		return nil
+	}
+	if _, err := js.StreamInfo(roomHistoryStreamName); err != nil {
+		return nil
+	}
+	return js
+}
+
+func formatRoomHistoryStart(start roomHistoryStart) string {
+	switch {
+	case !start.Since.IsZero():
+		return "since " + start.Since.UTC().Format(time.RFC3339)
+	case start.Last > 0:
+		return "last " + strconv.Itoa(start.Last) + " frames"
+	default:
+		return "new frames"
+	}
+}
@@ -0,0 +1,271 @@
+package repl
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func startRoomHistoryServer(t *testing.T) (*nats.Conn, nats.JetStreamContext) {
+	t.Helper()
+	srv, err := natsserver.NewServer(&natsserver.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		NoLog:     true,
+		NoSigs:    true,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("start nats server: %v", err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatalf("nats server not ready")
+	}
+	t.Cleanup(srv.Shutdown)
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(nc.Close)
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("jetstream: %v", err)
+	}
+	if err := ensureRoomHistoryStream(js, 5, time.Hour); err != nil {
+		t.Fatalf("ensure stream: %v", err)
+	}
+	return nc, roomHistoryJetStream(nc)
+}
+
+type roomFeedRecorder struct {
+	mu     sync.Mutex
+	frames []string
+	replay []bool
+}
+
+func (r *roomFeedRecorder) handle(msg *nats.Msg, replay bool) {
+	frame, ok := decodeFrame(msg.Data)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.frames = append(r.frames, frame.Message)
+	r.replay = append(r.replay, replay)
+}
+
+func (r *roomFeedRecorder) waitFor(t *testing.T, n int) ([]string, []bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		if len(r.frames) >= n {
+			frames := append([]string(nil), r.frames...)
+			replay := append([]bool(nil), r.replay...)
+			r.mu.Unlock()
+			return frames, replay
+		}
+		r.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t.Fatalf("expected %d frames, got %v", n, r.frames)
+	return nil, nil
+}
+
+func publishRoomLines(t *testing.T, nc *nats.Conn, subject string, messages ...string) {
+	t.Helper()
+	for _, message := range messages {
+		if err := publishFrame(nc, subject, BusFrame{Type: frameTypeLine, Scope: "index", Message: message}); err != nil {
+			t.Fatalf("publish %q: %v", message, err)
+		}
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+}
+
+func TestEnsureRoomHistoryStreamKeepsHistoryPerRoom(t *testing.T) {
+	nc, js := startRoomHistoryServer(t)
+	if js == nil {
+		t.Fatalf("expected room history stream to be found")
+	}
+	publishRoomLines(t, nc, "repl.topic.index", "i1", "i2", "i3", "i4", "i5", "i6", "i7")
+	publishRoomLines(t, nc, "repl.topic.task-1", "t1")
+	if err := publishFrame(nc, "repl.topic.index", BusFrame{Type: frameTypeHeartbeat, Scope: "index"}); err != nil {
+		t.Fatalf("publish heartbeat: %v", err)
+	}
+	nc.Flush()
+
+	info, err := js.StreamInfo(roomHistoryStreamName, &nats.StreamInfoRequest{SubjectsFilter: roomHistorySubjects})
+	if err != nil {
+		t.Fatalf("stream info: %v", err)
+	}
+	if got := info.State.Subjects["repl.topic.index"]; got != 5 {
+		t.Fatalf("expected index room capped at 5 frames, got %d", got)
+	}
+	if got := info.State.Subjects["repl.topic.task-1"]; got != 1 {
+		t.Fatalf("expected task room to keep its frame, got %d", got)
+	}
+
+	// Re-running with new retention updates the existing stream.
+	if err := ensureRoomHistoryStream(js, 10, 2*time.Hour); err != nil {
+		t.Fatalf("update stream: %v", err)
+	}
+	info, err = js.StreamInfo(roomHistoryStreamName)
+	if err != nil {
+		t.Fatalf("stream info: %v", err)
+	}
+	if info.Config.MaxMsgsPerSubject != 10 || info.Config.MaxAge != 2*time.Hour {
+		t.Fatalf("expected updated retention, got %+v", info.Config)
+	}
+}
+
+func TestRoomFeedReplaysLastFramesThenLive(t *testing.T) {
+	nc, js := startRoomHistoryServer(t)
+	publishRoomLines(t, nc, "repl.topic.index", "a", "b", "c")
+	publishRoomLines(t, nc, "repl.topic.other", "x")
+
+	rec := &roomFeedRecorder{}
+	feed, err := subscribeRoomFeed(nc, js, "repl.topic.index", roomHistoryStart{Last: 2}, rec.handle)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer feed.Unsubscribe()
+	rec.waitFor(t, 2)
+	publishRoomLines(t, nc, "repl.topic.index", "d")
+
+	frames, replay := rec.waitFor(t, 3)
+	want := []string{"b", "c", "d"}
+	for i := range want {
+		if frames[i] != want[i] {
+			t.Fatalf("expected frames %v, got %v", want, frames)
+		}
+	}
+	if !replay[0] || !replay[1] || replay[2] {
+		t.Fatalf("expected only history frames marked replay, got %v", replay)
+	}
+}
+
+func TestRoomFeedHistoryCountsOnlyNonEphemeralFrames(t *testing.T) {
+	nc, js := startRoomHistoryServer(t)
+	publishRoomLines(t, nc, "repl.topic.index", "a", "b")
+	for i := 0; i < 2; i++ {
+		if err := publishFrame(nc, "repl.topic.index", BusFrame{Type: frameTypeHeartbeat, Scope: "index", Message: "hb"}); err != nil {
+			t.Fatalf("publish heartbeat: %v", err)
+		}
+	}
+	publishRoomLines(t, nc, "repl.topic.index", "c")
+
+	rec := &roomFeedRecorder{}
+	feed, err := subscribeRoomFeed(nc, js, "repl.topic.index", roomHistoryStart{Last: 2}, rec.handle)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer feed.Unsubscribe()
+	rec.waitFor(t, 4)
+	publishRoomLines(t, nc, "repl.topic.index", "d")
+
+	// The heartbeats between b and c must not push b out of the last two.
+	want := []string{"b", "hb", "hb", "c", "d"}
+	frames, replay := rec.waitFor(t, len(want))
+	for i := range want {
+		if frames[i] != want[i] {
+			t.Fatalf("expected frames %v, got %v", want, frames)
+		}
+	}
+	if !replay[3] || replay[4] {
+		t.Fatalf("expected only history frames marked replay, got %v", replay)
+	}
+}
+
+func TestRoomFeedSinceSkipsOlderFrames(t *testing.T) {
+	nc, js := startRoomHistoryServer(t)
+	publishRoomLines(t, nc, "repl.topic.index", "old")
+	time.Sleep(50 * time.Millisecond)
+	since := time.Now()
+	time.Sleep(50 * time.Millisecond)
+	publishRoomLines(t, nc, "repl.topic.index", "new")
+
+	rec := &roomFeedRecorder{}
+	feed, err := subscribeRoomFeed(nc, js, "repl.topic.index", roomHistoryStart{Since: since}, rec.handle)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer feed.Unsubscribe()
+	frames, replay := rec.waitFor(t, 1)
+	time.Sleep(100 * time.Millisecond)
+	if len(frames) != 1 || frames[0] != "new" || !replay[0] {
+		t.Fatalf("expected only the replayed new frame, got %v %v", frames, replay)
+	}
+}
+
+func TestRoomFeedResumeReplaysMissedFramesOnce(t *testing.T) {
+	nc, js := startRoomHistoryServer(t)
+	rec := &roomFeedRecorder{}
+	feed, err := subscribeRoomFeed(nc, js, "repl.topic.index", roomHistoryStart{}, rec.handle)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer feed.Unsubscribe()
+	publishRoomLines(t, nc, "repl.topic.index", "live-1")
+	rec.waitFor(t, 1)
+
+	// Simulate a dropped connection: frames published while away are missed.
+	feed.mu.Lock()
+	feed.sub.Unsubscribe()
+	feed.mu.Unlock()
+	publishRoomLines(t, nc, "repl.topic.index", "missed-1", "missed-2")
+
+	if err := feed.Resume(); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	publishRoomLines(t, nc, "repl.topic.index", "live-2")
+	frames, replay := rec.waitFor(t, 4)
+	time.Sleep(100 * time.Millisecond)
+	want := []string{"live-1", "missed-1", "missed-2", "live-2"}
+	rec.mu.Lock()
+	got := len(rec.frames)
+	rec.mu.Unlock()
+	if got != len(want) {
+		t.Fatalf("expected no duplicate frames, got %v", rec.frames)
+	}
+	for i := range want {
+		if frames[i] != want[i] {
+			t.Fatalf("expected frames %v, got %v", want, frames)
+		}
+	}
+	if replay[0] || !replay[1] || !replay[2] || replay[3] {
+		t.Fatalf("expected missed frames marked replay, got %v", replay)
+	}
+	if feed.LastSeq() == 0 {
+		t.Fatalf("expected last sequence to be tracked")
+	}
+}
+
+func TestParseRoomHistorySince(t *testing.T) {
+	now := time.Date(2026, time.April, 6, 22, 0, 0, 0, time.UTC)
+	got, err := parseRoomHistorySince("15m", now)
+	if err != nil || !got.Equal(now.Add(-15*time.Minute)) {
+		t.Fatalf("expected 15m ago, got %v %v", got, err)
+	}
+	got, err = parseRoomHistorySince("2026-04-06T21:00:00Z", now)
+	if err != nil || !got.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("expected RFC3339 time, got %v %v", got, err)
+	}
+	if got, err := parseRoomHistorySince("", now); err != nil || !got.IsZero() {
+		t.Fatalf("expected empty since to be zero, got %v %v", got, err)
+	}
+	if _, err := parseRoomHistorySince("yesterday", now); err == nil {
+		t.Fatalf("expected invalid since to fail")
+	}
+	if _, err := parseRoomHistorySince("-5m", now); err == nil {
+		t.Fatalf("expected negative duration to fail")
+	}
+}
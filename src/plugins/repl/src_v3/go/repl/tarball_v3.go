@@ -13,48 +13,9 @@ import (
 )
 
 func createRepoTarball(repoRoot, tarPath string) error {
-	lsCmd := exec.Command("git", "-C", repoRoot, "ls-files", "--cached", "--modified", "--others", "--exclude-standard", "-z")
-	files, err := lsCmd.Output()
-	paths := make([]string, 0, 2048)
-	if err == nil && len(files) > 0 {
-		entries := bytes.Split(files, []byte{0})
-		for _, e := range entries {
-			rel := strings.TrimSpace(string(e))
-			if rel == "" {
-				continue
-			}
-			paths = append(paths, rel)
-		}
-	} else {
-		walkErr := filepath.WalkDir(repoRoot, func(path string, d os.DirEntry, walkErr error) error {
-			if walkErr != nil {
-				return walkErr
-			}
-			rel, err := filepath.Rel(repoRoot, path)
-			if err != nil {
-				return err
-			}
-			if rel == "." {
-				return nil
-			}
-			rel = filepath.ToSlash(rel)
-			if shouldSkipTarPath(rel, d.IsDir()) {
-				if d.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			}
-			if d.Type().IsRegular() || d.Type()&os.ModeSymlink != 0 {
-				paths = append(paths, rel)
-			}
-			return nil
-		})
-		if walkErr != nil {
-			return fmt.Errorf("fallback file walk failed: %w", walkErr)
-		}
-	}
-	if len(paths) == 0 {
-		return fmt.Errorf("no files discovered for bootstrap tarball in %s", repoRoot)
+	paths, err := listRepoFiles(repoRoot)
+	if err != nil {
+		return err
 	}
 
 	out, err := os.Create(tarPath)
@@ -153,3 +114,58 @@ func shouldSkipTarPath(rel string, isDir bool) bool {
 	}
 	return false
 }
+
+// listRepoFiles returns the repo-relative paths shipped to new hosts: tracked
+// and untracked non-ignored files, or a filtered walk when git is unavailable.
+func listRepoFiles(repoRoot string) ([]string, error) {
+	lsCmd := exec.Command("git", "-C", repoRoot, "ls-files", "--cached", "--modified", "--others", "--exclude-standard", "-z")
+	files, err := lsCmd.Output()
+	paths := make([]string, 0, 2048)
+	if err == nil && len(files) > 0 {
+		// --cached and --modified both list a dirty tracked file.
+		seen := make(map[string]struct{}, 2048)
+		entries := bytes.Split(files, []byte{0})
+		for _, e := range entries {
+			rel := strings.TrimSpace(string(e))
+			if rel == "" {
+				continue
+			}
+			if _, dup := seen[rel]; dup {
+				continue
+			}
+			seen[rel] = struct{}{}
+			paths = append(paths, rel)
+		}
+	} else {
+		walkErr := filepath.WalkDir(repoRoot, func(path string, d os.DirEntry, walkErr error) error {
+			if walkErr != nil {
+				return walkErr
+			}
+			rel, err := filepath.Rel(repoRoot, path)
+			if err != nil {
+				return err
+			}
+			if rel == "." {
+				return nil
+			}
+			rel = filepath.ToSlash(rel)
+			if shouldSkipTarPath(rel, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() || d.Type()&os.ModeSymlink != 0 {
+				paths = append(paths, rel)
+			}
+			return nil
+		})
+		if walkErr != nil {
+			return nil, fmt.Errorf("fallback file walk failed: %w", walkErr)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files discovered for bootstrap in %s", repoRoot)
+	}
+	return paths, nil
+}
@@ -80,7 +80,7 @@ func main() {
 		startRoverCommandConsumer(nc, mavSvc)
 	}
 
-	mux := buildMux(cfg)
+	mux := buildMux(cfg, nc)
 
 	localSrv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.webPort),
@@ -174,7 +174,7 @@ func resolveAppVersion(uiPath string) string {
 	return v
 }
 
-func buildMux(cfg config) *http.ServeMux {
+func buildMux(cfg config, nc *nats.Conn) *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
 		_, _ = w.Write([]byte("ok"))
@@ -194,7 +194,9 @@ func buildMux(cfg config) *http.ServeMux {
 	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
 		cameraapp.StreamHandler(w, r)
 	})
-	mux.HandleFunc("/api/bookmark", bookmarkHandler)
+	mux.HandleFunc("/api/bookmark", func(w http.ResponseWriter, r *http.Request) {
+		bookmarkHandler(w, r, nc)
+	})
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		rel := strings.TrimPrefix(r.URL.Path, "/")
 		target := filepath.Join(cfg.uiPath, rel)
@@ -209,7 +211,7 @@ func buildMux(cfg config) *http.ServeMux {
 	return mux
 }
 
-func bookmarkHandler(w http.ResponseWriter, r *http.Request) {
+func bookmarkHandler(w http.ResponseWriter, r *http.Request, nc *nats.Conn) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -246,6 +248,14 @@ func bookmarkHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Ask the camera recorder to keep the footage around this moment.
+	if nc != nil {
+		payload, _ := json.Marshal(map[string]any{"label": name})
+		if err := nc.Publish("camera.bookmark", payload); err != nil {
+			logs.Warn("camera bookmark publish failed: %v", err)
+		}
+	}
+
 	writeJSON(w, map[string]any{
 		"ok":   true,
 		"path": dstPath,
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	logs "dialtone/dev/plugins/logs/src_v1/go"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	roleOperator = "operator"
+	roleViewer   = "viewer"
+
+	sessionCookieName = "robot_session"
+	// localNATSUser is the identity for plain TCP clients on the rover (the
+	// server itself, the mavlink bridge, the camera). It cannot be used over
+	// the websocket listener.
+	localNATSUser = "local"
+)
+
+var (
+	errBadCredentials = errors.New("invalid operator name or password")
+	errNotOperator    = errors.New("operator role required")
+)
+
+type operatorAccount struct {
+	Name           string `json:"name"`
+	Role           string `json:"role"`
+	PasswordBcrypt string `json:"password_bcrypt"`
+}
+
+type operatorsFile struct {
+	Operators []operatorAccount `json:"operators"`
+}
+
+type operatorSession struct {
+	Token     string
+	Name      string
+	Role      string
+	NATSUser  string
+	NATSPass  string
+	ExpiresAt time.Time
+}
+
+type sessionResponse struct {
+	AuthRequired  bool            `json:"auth_required"`
+	Authenticated bool            `json:"authenticated"`
+	Name          string          `json:"name,omitempty"`
+	Role          string          `json:"role,omitempty"`
+	NATSUser      string          `json:"nats_user,omitempty"`
+	NATSPass      string          `json:"nats_pass,omitempty"`
+	ExpiresAt     string          `json:"expires_at,omitempty"`
+	DriverLock    driverLockState `json:"driver_lock"`
+}
+
+// operatorAuth owns operator sessions, the driver lock and the embedded NATS
+// user list derived from both. A nil *operatorAuth means auth is disabled.
+type operatorAuth struct {
+	accounts  map[string]operatorAccount
+	ttl       time.Duration
+	lock      *driverLock
+	localPass string
+
+	mu       sync.Mutex
+	sessions map[string]*operatorSession
+
+	natsMu   sync.Mutex
+	ns       *natsserver.Server
+	natsOpts func() *natsserver.Options
+	onLock   func(driverLockState)
+}
+
+func resolveOperatorsFile() string {
+	if v := strings.TrimSpace(os.Getenv("ROBOT_V2_OPERATORS_FILE")); v != "" {
+		return v
+	}
+	home, err := os.UserHomeDir()
+	if err != nil || strings.TrimSpace(home) == "" {
+		return ""
+	}
+	return filepath.Join(home, ".dialtone", "robot", "operators.json")
+}
+
+// loadOperatorAuth returns nil when no operators file exists, which keeps the
+// server open as before for local dev and mock runs.
+func loadOperatorAuth(path string, sessionTTL, lockTimeout time.Duration) (*operatorAuth, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file operatorsFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return newOperatorAuth(file.Operators, sessionTTL, lockTimeout)
+}
+
+func newOperatorAuth(accounts []operatorAccount, sessionTTL, lockTimeout time.Duration) (*operatorAuth, error) {
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("operators file lists no operators")
+	}
+	if sessionTTL <= 0 {
+		sessionTTL = 12 * time.Hour
+	}
+	a := &operatorAuth{
+		accounts:  make(map[string]operatorAccount, len(accounts)),
+		ttl:       sessionTTL,
+		localPass: randomHex(24),
+		sessions:  map[string]*operatorSession{},
+	}
+	for _, acct := range accounts {
+		acct.Name = strings.TrimSpace(acct.Name)
+		acct.Role = strings.ToLower(strings.TrimSpace(acct.Role))
+		if acct.Role == "" {
+			acct.Role = roleViewer
+		}
+		if acct.Name == "" || acct.PasswordBcrypt == "" {
+			return nil, fmt.Errorf("operator entries need name and password_bcrypt")
+		}
+		if acct.Role != roleOperator && acct.Role != roleViewer {
+			return nil, fmt.Errorf("operator %s: unknown role %q", acct.Name, acct.Role)
+		}
+		if _, dup := a.accounts[acct.Name]; dup {
+			return nil, fmt.Errorf("operator %s listed twice", acct.Name)
+		}
+		a.accounts[acct.Name] = acct
+	}
+	a.lock = newDriverLock(lockTimeout, a.onLockChange)
+	return a, nil
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func (a *operatorAuth) Login(name, password string) (*operatorSession, error) {
+	acct, ok := a.accounts[strings.TrimSpace(name)]
+	if !ok {
+		return nil, errBadCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(acct.PasswordBcrypt), []byte(password)) != nil {
+		return nil, errBadCredentials
+	}
+	sess := &operatorSession{
+		Token:     randomHex(32),
+		Name:      acct.Name,
+		Role:      acct.Role,
+		NATSUser:  "session-" + randomHex(6),
+		NATSPass:  randomHex(24),
+		ExpiresAt: time.Now().Add(a.ttl),
+	}
+	a.mu.Lock()
+	a.pruneLocked(time.Now())
+	a.sessions[sess.Token] = sess
+	a.mu.Unlock()
+	a.syncNATSUsers()
+	logs.Info("robot src_v2 operator %s logged in as %s", sess.Name, sess.Role)
+	return sess, nil
+}
+
+func (a *operatorAuth) Logout(token string) {
+	a.mu.Lock()
+	sess := a.sessions[token]
+	delete(a.sessions, token)
+	a.mu.Unlock()
+	if sess == nil {
+		return
+	}
+	a.lock.Release(sess)
+	// Reloading without the session user closes its websocket.
+	a.syncNATSUsers()
+}
+
+func (a *operatorAuth) Session(token string) *operatorSession {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil
+	}
+	a.mu.Lock()
+	sess := a.sessions[token]
+	expired := sess != nil && time.Now().After(sess.ExpiresAt)
+	a.mu.Unlock()
+	if expired {
+		a.Logout(token)
+		return nil
+	}
+	return sess
+}
+
+func (a *operatorAuth) pruneLocked(now time.Time) {
+	for token, sess := range a.sessions {
+		if now.After(sess.ExpiresAt) {
+			delete(a.sessions, token)
+		}
+	}
+}
+
+func requestToken(r *http.Request) string {
+	if v := strings.TrimSpace(r.Header.Get("Authorization")); strings.HasPrefix(v, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(v, "Bearer "))
+	}
+	if c, err := r.Cookie(sessionCookieName); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+func (a *operatorAuth) requestSession(r *http.Request) *operatorSession {
+	return a.Session(requestToken(r))
+}
+
+// publicPath reports whether path is reachable without a session. The UI shell
+// and its assets stay public so the browser can render the login form.
+func publicPath(path string) bool {
+	switch path {
+	case "/health", "/api/init", "/api/login", "/api/session", "/api/logout":
+		return true
+	}
+	return !strings.HasPrefix(path, "/api/") && path != "/natsws" && path != "/stream"
+}
+
+// Middleware rejects requests without a session and mutating requests from
+// viewers. It is a passthrough when auth is disabled.
+func (a *operatorAuth) Middleware(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sess := a.requestSession(r)
+		if sess == nil {
+			http.Error(w, "login required", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && sess.Role != roleOperator {
+			http.Error(w, errNotOperator.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *operatorAuth) sessionPayload(sess *operatorSession) sessionResponse {
+	out := sessionResponse{AuthRequired: a != nil}
+	if a == nil {
+		return out
+	}
+	out.DriverLock = a.lock.State()
+	if sess == nil {
+		return out
+	}
+	out.Authenticated = true
+	out.Name = sess.Name
+	out.Role = sess.Role
+	out.NATSUser = sess.NATSUser
+	out.NATSPass = sess.NATSPass
+	out.ExpiresAt = sess.ExpiresAt.UTC().Format(time.RFC3339)
+	return out
+}
+
+func (a *operatorAuth) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/api/session", func(w http.ResponseWriter, r *http.Request) {
+		if a == nil {
+			writeJSON(w, a.sessionPayload(nil))
+			return
+		}
+		writeJSON(w, a.sessionPayload(a.requestSession(r)))
+	})
+	mux.HandleFunc("/api/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if a == nil {
+			http.Error(w, "operator auth not configured", http.StatusNotFound)
+			return
+		}
+		var req struct {
+			Name     string `json:"name"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid login body", http.StatusBadRequest)
+			return
+		}
+		sess, err := a.Login(req.Name, req.Password)
+		if err != nil {
+			logs.Warn("robot src_v2 login failed for %q from %s", req.Name, r.RemoteAddr)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookieName,
+			Value:    sess.Token,
+			Path:     "/",
+			Expires:  sess.ExpiresAt,
+			HttpOnly: true,
+			Secure:   r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https"),
+			SameSite: http.SameSiteStrictMode,
+		})
+		writeJSON(w, a.sessionPayload(sess))
+	})
+	mux.HandleFunc("/api/logout", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if a != nil {
+			a.Logout(requestToken(r))
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", MaxAge: -1})
+		writeJSON(w, map[string]any{"ok": true})
+	})
+	mux.HandleFunc("/api/driver-lock", func(w http.ResponseWriter, r *http.Request) {
+		if a == nil {
+			http.Error(w, "operator auth not configured", http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			writeJSON(w, a.lock.State())
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		sess := a.requestSession(r)
+		var req struct {
+			Action string `json:"action"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid driver-lock body", http.StatusBadRequest)
+			return
+		}
+		var err error
+		switch strings.ToLower(strings.TrimSpace(req.Action)) {
+		case "acquire", "renew":
+			err = a.lock.Acquire(sess)
+		case "release":
+			a.lock.Release(sess)
+		default:
+			http.Error(w, "action must be acquire, renew or release", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, errLockHeld) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(a.lock.State())
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		writeJSON(w, a.lock.State())
+	})
+}
+
+// ConfigureNATS adds the local and per-session users to opts. Plain TCP
+// clients without credentials map to the local user; websocket clients must
+// present session credentials from /api/session.
+func (a *operatorAuth) ConfigureNATS(opts *natsserver.Options) {
+	if a == nil {
+		return
+	}
+	users := []*natsserver.User{{
+		Username:               localNATSUser,
+		Password:               a.localPass,
+		AllowedConnectionTypes: map[string]struct{}{"STANDARD": {}},
+	}}
+	driver := a.lock.Holder()
+	a.mu.Lock()
+	now := time.Now()
+	a.pruneLocked(now)
+	for _, sess := range a.sessions {
+		users = append(users, &natsserver.User{
+			Username:               sess.NATSUser,
+			Password:               sess.NATSPass,
+			Permissions:            sessionPermissions(sess.Token == driver),
+			AllowedConnectionTypes: map[string]struct{}{"WEBSOCKET": {}},
+		})
+	}
+	a.mu.Unlock()
+	opts.Users = users
+	opts.NoAuthUser = localNATSUser
+}
+
+// sessionPermissions lets every session read telemetry; only the driver lock
+// holder may publish rover.command.
+func sessionPermissions(driving bool) *natsserver.Permissions {
+	publish := []string{"logs.ui.robot", "_INBOX.>"}
+	if driving {
+		publish = append(publish, "rover.command")
+	}
+	return &natsserver.Permissions{
+		Publish:   &natsserver.SubjectPermission{Allow: publish},
+		Subscribe: &natsserver.SubjectPermission{Allow: []string{">"}},
+	}
+}
+
+// AttachNATS records the running server and the options builder so session
+// and lock changes can reload user permissions in place.
+func (a *operatorAuth) AttachNATS(ns *natsserver.Server, build func() *natsserver.Options) {
+	if a == nil {
+		return
+	}
+	a.natsMu.Lock()
+	a.ns = ns
+	a.natsOpts = build
+	a.natsMu.Unlock()
+}
+
+// OnDriverLockChange registers fn to run after each lock hand-over, after the
+// NATS permissions have been updated.
+func (a *operatorAuth) OnDriverLockChange(fn func(driverLockState)) {
+	if a == nil {
+		return
+	}
+	a.natsMu.Lock()
+	a.onLock = fn
+	a.natsMu.Unlock()
+}
+
+func (a *operatorAuth) syncNATSUsers() {
+	a.natsMu.Lock()
+	defer a.natsMu.Unlock()
+	if a.ns == nil || a.natsOpts == nil {
+		return
+	}
+	if err := a.ns.ReloadOptions(a.natsOpts()); err != nil {
+		logs.Error("robot src_v2 nats user reload failed: %v", err)
+	}
+}
+
+func (a *operatorAuth) onLockChange(state driverLockState) {
+	a.syncNATSUsers()
+	if state.Held {
+		logs.Info("robot src_v2 driver lock held by %s until %s", state.Holder, state.ExpiresAt)
+	} else {
+		logs.Info("robot src_v2 driver lock released")
+	}
+	a.natsMu.Lock()
+	fn := a.onLock
+	a.natsMu.Unlock()
+	if fn != nil {
+		fn(state)
+	}
+}
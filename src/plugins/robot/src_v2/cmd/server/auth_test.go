@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testOperatorAuth(t *testing.T, lockTimeout time.Duration) *operatorAuth {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := newOperatorAuth([]operatorAccount{
+		{Name: "ada", Role: roleOperator, PasswordBcrypt: string(hash)},
+		{Name: "bo", Role: roleOperator, PasswordBcrypt: string(hash)},
+		{Name: "cy", Role: roleViewer, PasswordBcrypt: string(hash)},
+	}, time.Hour, lockTimeout)
+	if err != nil {
+		t.Fatalf("newOperatorAuth returned error: %v", err)
+	}
+	return auth
+}
+
+type authClient struct {
+	t    *testing.T
+	base string
+	http *http.Client
+}
+
+func newAuthClient(t *testing.T, base string) *authClient {
+	jar, _ := cookiejar.New(nil)
+	return &authClient{t: t, base: base, http: &http.Client{Jar: jar}}
+}
+
+func (c *authClient) do(method, path string, body any, out any) int {
+	c.t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		raw, _ := json.Marshal(body)
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, _ := http.NewRequest(method, c.base+path, reader)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if out != nil && strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		_ = json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func (c *authClient) login(name string) sessionResponse {
+	c.t.Helper()
+	var sess sessionResponse
+	if code := c.do(http.MethodPost, "/api/login", map[string]string{"name": name, "password": "pw"}, &sess); code != http.StatusOK {
+		c.t.Fatalf("login %s: status %d", name, code)
+	}
+	return sess
+}
+
+func TestOperatorAuthGatesHTTPAndDriverLock(t *testing.T) {
+	auth := testOperatorAuth(t, time.Minute)
+	mux := http.NewServeMux()
+	auth.RegisterHandlers(mux)
+	mux.HandleFunc("/api/bookmark", func(w http.ResponseWriter, _ *http.Request) { writeJSON(w, map[string]bool{"ok": true}) })
+	srv := httptest.NewServer(auth.Middleware(mux))
+	defer srv.Close()
+
+	anon := newAuthClient(t, srv.URL)
+	if code := anon.do(http.MethodGet, "/api/bookmark", nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("anonymous api request: status %d", code)
+	}
+	if code := anon.do(http.MethodPost, "/api/login", map[string]string{"name": "ada", "password": "nope"}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("bad password: status %d", code)
+	}
+
+	ada, bo, cy := newAuthClient(t, srv.URL), newAuthClient(t, srv.URL), newAuthClient(t, srv.URL)
+	if sess := ada.login("ada"); !sess.Authenticated || sess.NATSUser == "" || sess.Role != roleOperator {
+		t.Fatalf("unexpected session: %+v", sess)
+	}
+	bo.login("bo")
+	cy.login("cy")
+
+	if code := cy.do(http.MethodGet, "/api/bookmark", nil, nil); code != http.StatusOK {
+		t.Fatalf("viewer read: status %d", code)
+	}
+	if code := cy.do(http.MethodPost, "/api/bookmark", nil, nil); code != http.StatusForbidden {
+		t.Fatalf("viewer write: status %d", code)
+	}
+	if code := cy.do(http.MethodPost, "/api/driver-lock", map[string]string{"action": "acquire"}, nil); code != http.StatusForbidden {
+		t.Fatalf("viewer acquire: status %d", code)
+	}
+
+	var state driverLockState
+	if code := ada.do(http.MethodPost, "/api/driver-lock", map[string]string{"action": "acquire"}, &state); code != http.StatusOK || state.Holder != "ada" {
+		t.Fatalf("ada acquire: status %d state %+v", code, state)
+	}
+	if code := bo.do(http.MethodPost, "/api/driver-lock", map[string]string{"action": "acquire"}, &state); code != http.StatusConflict || state.Holder != "ada" {
+		t.Fatalf("bo acquire while held: status %d state %+v", code, state)
+	}
+	var sess sessionResponse
+	cy.do(http.MethodGet, "/api/session", nil, &sess)
+	if !sess.DriverLock.Held || sess.DriverLock.Holder != "ada" {
+		t.Fatalf("viewer cannot see lock holder: %+v", sess.DriverLock)
+	}
+
+	// Logging out hands the lock back.
+	ada.do(http.MethodPost, "/api/logout", nil, nil)
+	if code := ada.do(http.MethodGet, "/api/bookmark", nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("request after logout: status %d", code)
+	}
+	if code := bo.do(http.MethodPost, "/api/driver-lock", map[string]string{"action": "acquire"}, &state); code != http.StatusOK || state.Holder != "bo" {
+		t.Fatalf("bo acquire after logout: status %d state %+v", code, state)
+	}
+}
+
+func TestDriverLockControlsNATSPublishPermission(t *testing.T) {
+	auth := testOperatorAuth(t, 500*time.Millisecond)
+	natsPort, wsPort := freeTCPPort(t), freeTCPPort(t)
+	ns, err := startEmbeddedNATS(natsPort, wsPort, auth, nil)
+	if err != nil {
+		t.Fatalf("start embedded nats: %v", err)
+	}
+	defer ns.Shutdown()
+
+	// Local TCP clients keep working without credentials.
+	local, err := nats.Connect(fmt.Sprintf("nats://127.0.0.1:%d", natsPort))
+	if err != nil {
+		t.Fatalf("local connect: %v", err)
+	}
+	defer local.Close()
+	commands, _ := local.SubscribeSync("rover.command")
+	_ = local.Flush()
+
+	wsURL := fmt.Sprintf("ws://127.0.0.1:%d", wsPort)
+	if nc, err := nats.Connect(wsURL); err == nil {
+		nc.Close()
+		t.Fatalf("websocket connected without session credentials")
+	}
+
+	viewerSess, _ := auth.Login("cy", "pw")
+	driverSess, _ := auth.Login("ada", "pw")
+	connect := func(sess *operatorSession) *nats.Conn {
+		nc, err := nats.Connect(wsURL, nats.UserInfo(sess.NATSUser, sess.NATSPass), nats.ErrorHandler(func(*nats.Conn, *nats.Subscription, error) {}))
+		if err != nil {
+			t.Fatalf("websocket connect as %s: %v", sess.Name, err)
+		}
+		return nc
+	}
+	viewer, driver := connect(viewerSess), connect(driverSess)
+	defer viewer.Close()
+	defer driver.Close()
+
+	expectCommand := func(nc *nats.Conn, payload string, want bool) {
+		t.Helper()
+		_ = nc.Publish("rover.command", []byte(payload))
+		_ = nc.Flush()
+		msg, err := commands.NextMsg(200 * time.Millisecond)
+		if want && (err != nil || string(msg.Data) != payload) {
+			t.Fatalf("expected %s to reach rover.command, got %v", payload, err)
+		}
+		if !want && err == nil {
+			t.Fatalf("unexpected rover.command %s", msg.Data)
+		}
+	}
+
+	expectCommand(viewer, `{"cmd":"arm","from":"viewer"}`, false)
+	expectCommand(driver, `{"cmd":"arm","from":"unlocked"}`, false)
+
+	if err := auth.lock.Acquire(driverSess); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	expectCommand(driver, `{"cmd":"arm","from":"driver"}`, true)
+	expectCommand(viewer, `{"cmd":"disarm","from":"viewer"}`, false)
+
+	// Without renewal the lock times out and publish rights go with it.
+	deadline := time.Now().Add(2 * time.Second)
+	for auth.lock.State().Held && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if auth.lock.State().Held {
+		t.Fatalf("driver lock did not expire")
+	}
+	expectCommand(driver, `{"cmd":"stop","from":"expired"}`, false)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errLockHeld = errors.New("driver lock held by another operator")
+
+type driverLockState struct {
+	Held       bool   `json:"held"`
+	Holder     string `json:"holder,omitempty"`
+	AcquiredAt string `json:"acquired_at,omitempty"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
+	TimeoutMS  int64  `json:"timeout_ms"`
+}
+
+// driverLock is the exclusive right to publish rover.command. The holder must
+// renew it before timeout or it is released automatically.
+type driverLock struct {
+	timeout  time.Duration
+	onChange func(driverLockState)
+
+	mu         sync.Mutex
+	token      string
+	holder     string
+	acquiredAt time.Time
+	expiresAt  time.Time
+	timer      *time.Timer
+}
+
+func newDriverLock(timeout time.Duration, onChange func(driverLockState)) *driverLock {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &driverLock{timeout: timeout, onChange: onChange}
+}
+
+// Acquire takes or renews the lock for sess. Renewing only extends the
+// deadline, so it does not fire onChange.
+func (l *driverLock) Acquire(sess *operatorSession) error {
+	if sess == nil || sess.Role != roleOperator {
+		return errNotOperator
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.token != "" && l.token != sess.Token && now.Before(l.expiresAt) {
+		l.mu.Unlock()
+		return errLockHeld
+	}
+	changed := l.token != sess.Token
+	if changed {
+		l.token = sess.Token
+		l.holder = sess.Name
+		l.acquiredAt = now
+	}
+	l.expiresAt = now.Add(l.timeout)
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	token := l.token
+	l.timer = time.AfterFunc(l.timeout, func() { l.expire(token) })
+	state := l.stateLocked()
+	l.mu.Unlock()
+	if changed {
+		l.notify(state)
+	}
+	return nil
+}
+
+// Release drops the lock if sess holds it.
+func (l *driverLock) Release(sess *operatorSession) {
+	if sess == nil {
+		return
+	}
+	l.mu.Lock()
+	if l.token != sess.Token {
+		l.mu.Unlock()
+		return
+	}
+	l.clearLocked()
+	state := l.stateLocked()
+	l.mu.Unlock()
+	l.notify(state)
+}
+
+func (l *driverLock) expire(token string) {
+	l.mu.Lock()
+	if l.token != token || time.Now().Before(l.expiresAt) {
+		l.mu.Unlock()
+		return
+	}
+	l.clearLocked()
+	state := l.stateLocked()
+	l.mu.Unlock()
+	l.notify(state)
+}
+
+func (l *driverLock) clearLocked() {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.token = ""
+	l.holder = ""
+	l.acquiredAt = time.Time{}
+	l.expiresAt = time.Time{}
+}
+
+// Holder returns the session token holding the lock, or "".
+func (l *driverLock) Holder() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.token
+}
+
+func (l *driverLock) State() driverLockState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stateLocked()
+}
+
+func (l *driverLock) stateLocked() driverLockState {
+	state := driverLockState{TimeoutMS: l.timeout.Milliseconds()}
+	if l.token == "" {
+		return state
+	}
+	state.Held = true
+	state.Holder = l.holder
+	state.AcquiredAt = l.acquiredAt.UTC().Format(time.RFC3339)
+	state.ExpiresAt = l.expiresAt.UTC().Format(time.RFC3339)
+	return state
+}
+
+func (l *driverLock) notify(state driverLockState) {
+	if l.onChange != nil {
+		l.onChange(state)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	logs "dialtone/dev/plugins/logs/src_v1/go"
+	sshv1 "dialtone/dev/plugins/ssh/src_v1/go"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+)
+
+// resolveLeafHub builds the leafnode options that join the robot bus to the
+// REPL leader. hub is a mesh node name (URLs follow its route preference) or
+// a comma-separated list of hosts/URLs. It returns nil when hub is empty.
+func resolveLeafHub(hub string, port int, token string, auth *operatorAuth) (*natsserver.LeafNodeOpts, error) {
+	hub = strings.TrimSpace(hub)
+	if hub == "" {
+		return nil, nil
+	}
+	// With operator auth on, only the driver lock holder may command the
+	// rover, so hub-side rover.command is not imported.
+	var deny []string
+	if auth != nil {
+		deny = append(deny, "rover.command")
+	}
+	opts := &natsserver.Options{}
+	if err := logs.ConfigureLeafRemote(opts, logs.LeafRoleRobot, token, logs.LeafURLs(sshv1.ResolveRouteHosts(hub), port), deny...); err != nil {
+		return nil, fmt.Errorf("leafnode hub %q: %w", hub, err)
+	}
+	return &opts.LeafNode, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	logs "dialtone/dev/plugins/logs/src_v1/go"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestRobotLeafFederatesWithHub(t *testing.T) {
+	hubOpts := &natsserver.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true}
+	leafPort := freeTCPPort(t)
+	if err := logs.ConfigureLeafHub(hubOpts, fmt.Sprintf("127.0.0.1:%d", leafPort), "tok", logs.DefaultLeafRules); err != nil {
+		t.Fatalf("ConfigureLeafHub returned error: %v", err)
+	}
+	hub, err := natsserver.NewServer(hubOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go hub.Start()
+	defer hub.Shutdown()
+	if !hub.ReadyForConnections(5 * time.Second) {
+		t.Fatalf("hub not ready")
+	}
+
+	leaf, err := resolveLeafHub(fmt.Sprintf("127.0.0.1:%d", leafPort), 0, "tok", nil)
+	if err != nil {
+		t.Fatalf("resolveLeafHub returned error: %v", err)
+	}
+	natsPort, wsPort := freeTCPPort(t), freeTCPPort(t)
+	robot, err := startEmbeddedNATS(natsPort, wsPort, nil, leaf)
+	if err != nil {
+		t.Fatalf("start robot nats: %v", err)
+	}
+	defer robot.Shutdown()
+	deadline := time.Now().Add(5 * time.Second)
+	for robot.NumLeafNodes() == 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if robot.NumLeafNodes() == 0 {
+		t.Fatalf("robot did not connect to the hub")
+	}
+
+	hubConn, err := nats.Connect(hub.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hubConn.Close()
+	robotConn, err := nats.Connect(fmt.Sprintf("nats://127.0.0.1:%d", natsPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer robotConn.Close()
+
+	// expectFlow publishes until the subscriber sees it, which also waits
+	// out leafnode interest propagation.
+	expectFlow := func(pub *nats.Conn, sub *nats.Subscription, subject string) {
+		t.Helper()
+		until := time.Now().Add(3 * time.Second)
+		for time.Now().Before(until) {
+			_ = pub.Publish(subject, []byte(subject))
+			_ = pub.Flush()
+			if msg, err := sub.NextMsg(100 * time.Millisecond); err == nil && msg.Subject == subject {
+				for {
+					if _, err := sub.NextMsg(50 * time.Millisecond); err != nil {
+						return
+					}
+				}
+			}
+		}
+		t.Fatalf("%s did not cross the leafnode", subject)
+	}
+	expectBlocked := func(pub *nats.Conn, sub *nats.Subscription, subject string) {
+		t.Helper()
+		_ = pub.Publish(subject, []byte(subject))
+		_ = pub.Flush()
+		if msg, err := sub.NextMsg(300 * time.Millisecond); err == nil {
+			t.Fatalf("unexpected %s crossed the leafnode", msg.Subject)
+		}
+	}
+
+	upstream, _ := hubConn.SubscribeSync(">")
+	_ = hubConn.Flush()
+	expectFlow(robotConn, upstream, "mavlink.attitude")
+	expectFlow(robotConn, upstream, "logs.robot.server")
+	expectBlocked(robotConn, upstream, "camera.frame")
+
+	downstream, _ := robotConn.SubscribeSync(">")
+	_ = robotConn.Flush()
+	expectFlow(hubConn, downstream, "rover.command")
+	expectBlocked(hubConn, downstream, "mavlink.attitude")
+
+	// Operator auth keeps rover.command behind the driver lock.
+	locked, err := resolveLeafHub("127.0.0.1", leafPort, "tok", testOperatorAuth(t, time.Minute))
+	if err != nil {
+		t.Fatalf("resolveLeafHub returned error: %v", err)
+	}
+	if deny := locked.Remotes[0].DenyImports; len(deny) != 1 || deny[0] != "rover.command" {
+		t.Fatalf("unexpected deny imports with auth: %v", deny)
+	}
+	if got := locked.Remotes[0].URLs[0].Host; got != fmt.Sprintf("127.0.0.1:%d", leafPort) {
+		t.Fatalf("unexpected leaf url host %q", got)
+	}
+}
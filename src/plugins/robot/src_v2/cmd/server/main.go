@@ -31,10 +31,12 @@ type initResponse struct {
 	InternalWSPort int    `json:"internal_ws_port"`
 	WSPath         string `json:"ws_path"`
 	WSPathCompat   string `json:"wsPath"`
+	AuthRequired   bool   `json:"auth_required"`
 }
 
 type telemetryMonitor struct {
 	lastMavlinkTelemetryAt atomic.Int64
+	store                  *telemetryStore
 }
 
 type autoswapSupervisorSnapshot struct {
@@ -91,6 +93,10 @@ func main() {
 	uiDist := flag.String("ui-dist", envOrDefault("ROBOT_V2_UI_DIST", ""), "Path to robot src_v2 ui/dist")
 	natsPort := flag.Int("nats-port", envIntOrDefault("ROBOT_V2_NATS_PORT", 4222), "Embedded NATS TCP port")
 	natsWSPort := flag.Int("nats-ws-port", envIntOrDefault("ROBOT_V2_NATS_WS_PORT", 4223), "Embedded NATS websocket port")
+	operatorsFile := flag.String("operators", resolveOperatorsFile(), "Operators JSON file; auth is disabled when it does not exist")
+	lockTimeout := flag.Duration("driver-lock-timeout", envDurationOrDefault("ROBOT_V2_DRIVER_LOCK_TIMEOUT", 30*time.Second), "Driver lock timeout without renewal")
+	leafHub := flag.String("nats-leaf-hub", envOrDefault("ROBOT_V2_NATS_LEAF_HUB", ""), "REPL leader mesh node or leafnode hosts/URLs to federate with")
+	leafPort := flag.Int("nats-leaf-port", envIntOrDefault("ROBOT_V2_NATS_LEAF_PORT", logs.DefaultLeafPort), "Leafnode port on the REPL leader")
 	flag.Parse()
 	cameraStreamURL := strings.TrimSpace(envOrDefault("ROBOT_V2_CAMERA_STREAM_URL", ""))
 	mavlinkEnabled := strings.TrimSpace(envOrDefault("ROBOT_V2_MAVLINK_ENABLED", "0")) == "1"
@@ -103,15 +109,33 @@ func main() {
 		}
 	}
 	appVersion := resolveAppVersion(resolvedUIDist)
-	telemetry := &telemetryMonitor{}
+	telemetry := &telemetryMonitor{store: newTelemetryStore(resolveTelemetrySubjects(), telemetryTiers)}
 
-	ns, err := startEmbeddedNATS(*natsPort, *natsWSPort)
+	auth, err := loadOperatorAuth(*operatorsFile, envDurationOrDefault("ROBOT_V2_SESSION_TTL", 12*time.Hour), *lockTimeout)
+	if err != nil {
+		logs.Error("robot src_v2 operators load failed: %v", err)
+		os.Exit(1)
+	}
+	if auth == nil {
+		logs.Warn("robot src_v2 operator auth disabled (no operators file at %q); anyone who can reach the UI can drive", *operatorsFile)
+	}
+
+	leaf, err := resolveLeafHub(*leafHub, *leafPort, logs.LeafToken(), auth)
+	if err != nil {
+		logs.Error("robot src_v2 nats federation config failed: %v", err)
+		os.Exit(1)
+	}
+	if leaf != nil {
+		logs.Info("robot src_v2 nats federating as leaf of %s (%d urls)", *leafHub, len(leaf.Remotes[0].URLs))
+	}
+
+	ns, err := startEmbeddedNATS(*natsPort, *natsWSPort, auth, leaf)
 	if err != nil {
 		logs.Error("robot src_v2 nats startup failed: %v", err)
 		os.Exit(1)
 	}
 	defer ns.Shutdown()
-	startStatsPublisher(*natsPort, ns, mavlinkEnabled, telemetry)
+	nc := startStatsPublisher(*natsPort, ns, mavlinkEnabled, telemetry, auth)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
@@ -124,6 +148,7 @@ func main() {
 			InternalWSPort: *natsWSPort,
 			WSPath:         "/natsws",
 			WSPathCompat:   "/natsws",
+			AuthRequired:   auth != nil,
 		}
 		writeJSON(w, payload)
 	})
@@ -162,8 +187,10 @@ func main() {
 		}
 		writeJSON(w, payload)
 	})
+	auth.RegisterHandlers(mux)
+	telemetry.store.RegisterHandlers(mux)
 	mux.HandleFunc("/api/bookmark", func(w http.ResponseWriter, r *http.Request) {
-		bookmarkHandler(w, r)
+		bookmarkHandler(w, r, nc)
 	})
 	mux.HandleFunc("/api/key-params", func(w http.ResponseWriter, _ *http.Request) {
 		params, source, err := readRobotKeyParams()
@@ -198,13 +225,13 @@ func main() {
 	})
 
 	logs.Info("robot src_v2 server listening on %s (nats=%d ws=%d)", *listen, *natsPort, *natsWSPort)
-	if err := http.ListenAndServe(*listen, mux); err != nil {
+	if err := http.ListenAndServe(*listen, auth.Middleware(mux)); err != nil {
 		logs.Error("robot src_v2 server failed: %v", err)
 		os.Exit(1)
 	}
 }
 
-func startEmbeddedNATS(port, wsPort int) (*natsserver.Server, error) {
+func embeddedNATSOptions(port, wsPort int, auth *operatorAuth, leaf *natsserver.LeafNodeOpts) *natsserver.Options {
 	opts := &natsserver.Options{
 		Host: "127.0.0.1",
 		Port: port,
@@ -215,7 +242,15 @@ func startEmbeddedNATS(port, wsPort int) (*natsserver.Server, error) {
 			AllowedOrigins: []string{"*"},
 		},
 	}
-	ns, err := natsserver.NewServer(opts)
+	if leaf != nil {
+		opts.LeafNode = *leaf
+	}
+	auth.ConfigureNATS(opts)
+	return opts
+}
+
+func startEmbeddedNATS(port, wsPort int, auth *operatorAuth, leaf *natsserver.LeafNodeOpts) (*natsserver.Server, error) {
+	ns, err := natsserver.NewServer(embeddedNATSOptions(port, wsPort, auth, leaf))
 	if err != nil {
 		return nil, err
 	}
@@ -223,19 +258,28 @@ func startEmbeddedNATS(port, wsPort int) (*natsserver.Server, error) {
 	if !ns.ReadyForConnections(10 * time.Second) {
 		return nil, fmt.Errorf("nats server did not become ready on %d/%d", port, wsPort)
 	}
+	auth.AttachNATS(ns, func() *natsserver.Options { return embeddedNATSOptions(port, wsPort, auth, leaf) })
 	return ns, nil
 }
 
-func startStatsPublisher(natsPort int, ns *natsserver.Server, mavlinkEnabled bool, telemetry *telemetryMonitor) {
+func startStatsPublisher(natsPort int, ns *natsserver.Server, mavlinkEnabled bool, telemetry *telemetryMonitor, auth *operatorAuth) *nats.Conn {
 	natsURL := fmt.Sprintf("nats://127.0.0.1:%d", natsPort)
 	nc, err := nats.Connect(natsURL, nats.Timeout(2*time.Second))
 	if err != nil {
 		logs.Warn("robot src_v2 stats publisher disabled (nats connect failed): %v", err)
-		return
+		return nil
 	}
 	started := time.Now()
+	auth.OnDriverLockChange(func(state driverLockState) {
+		if b, err := json.Marshal(driverLockPayload(state)); err == nil {
+			_ = nc.Publish("robot.driver_lock", b)
+		}
+	})
 	_, _ = nc.Subscribe("mavlink.>", func(msg *nats.Msg) {
 		subj := strings.TrimSpace(msg.Subject)
+		if telemetry != nil {
+			telemetry.store.Record(subj, msg.Data, time.Now())
+		}
 		switch subj {
 		case "mavlink.heartbeat", "mavlink.attitude", "mavlink.global_position_int", "mavlink.statustext", "mavlink.command_ack":
 			if telemetry != nil {
@@ -287,6 +331,7 @@ func startStatsPublisher(natsPort int, ns *natsserver.Server, mavlinkEnabled boo
 			publishAutoswapState(nc, autoswapStateDir)
 		}
 	}()
+	return nc
 }
 
 func resolveAutoswapStateDir() string {
@@ -375,6 +420,19 @@ func readAutoswapRuntimePayload(path string) (map[string]any, bool) {
 	}, true
 }
 
+func driverLockPayload(state driverLockState) map[string]any {
+	return map[string]any{
+		"type":        "DRIVER_LOCK",
+		"source":      "robot_src_v2",
+		"held":        state.Held,
+		"holder":      state.Holder,
+		"acquired_at": state.AcquiredAt,
+		"expires_at":  state.ExpiresAt,
+		"timeout_ms":  state.TimeoutMS,
+		"timestamp":   time.Now().UnixMilli(),
+	}
+}
+
 func proxyNATSWS(w http.ResponseWriter, r *http.Request, upstreamURL string) {
 	ctx := r.Context()
 	downstream, err := websocket.Accept(w, r, nil)
@@ -430,6 +488,18 @@ func envIntOrDefault(key string, fallback int) int {
 	return out
 }
 
+func envDurationOrDefault(key string, fallback time.Duration) time.Duration {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	out, err := time.ParseDuration(raw)
+	if err != nil || out <= 0 {
+		return fallback
+	}
+	return out
+}
+
 func resolveDefaultUIDist() (string, bool) {
 	cwd, _ := os.Getwd()
 	exe, _ := os.Executable()
@@ -499,7 +569,7 @@ func serveUISPA(w http.ResponseWriter, r *http.Request, uiDist string) {
 	http.ServeFile(w, r, target)
 }
 
-func bookmarkHandler(w http.ResponseWriter, r *http.Request) {
+func bookmarkHandler(w http.ResponseWriter, r *http.Request, nc *nats.Conn) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -536,6 +606,14 @@ func bookmarkHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Ask the camera recorder to keep the footage around this moment.
+	if nc != nil {
+		payload, _ := json.Marshal(map[string]any{"label": name})
+		if err := nc.Publish("camera.bookmark", payload); err != nil {
+			logs.Warn("camera bookmark publish failed: %v", err)
+		}
+	}
+
 	writeJSON(w, map[string]any{
 		"ok":   true,
 		"path": dstPath,
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"mime/multipart"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -14,14 +18,14 @@ func TestStartStatsPublisherClearsErrorAfterHeartbeat(t *testing.T) {
 	natsPort := freeTCPPort(t)
 	wsPort := freeTCPPort(t)
 
-	ns, err := startEmbeddedNATS(natsPort, wsPort)
+	ns, err := startEmbeddedNATS(natsPort, wsPort, nil, nil)
 	if err != nil {
 		t.Fatalf("start embedded nats: %v", err)
 	}
 	defer ns.Shutdown()
 
 	telemetry := &telemetryMonitor{}
-	startStatsPublisher(natsPort, ns, true, telemetry)
+	startStatsPublisher(natsPort, ns, true, telemetry, nil)
 
 	nc, err := nats.Connect(fmt.Sprintf("nats://127.0.0.1:%d", natsPort), nats.Timeout(2*time.Second))
 	if err != nil {
@@ -97,3 +101,50 @@ func freeTCPPort(t *testing.T) int {
 	}
 	return addr.Port
 }
+
+func TestBookmarkHandlerPublishesCameraBookmark(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	natsPort := freeTCPPort(t)
+	ns, err := startEmbeddedNATS(natsPort, freeTCPPort(t), nil, nil)
+	if err != nil {
+		t.Fatalf("start embedded nats: %v", err)
+	}
+	defer ns.Shutdown()
+	nc, err := nats.Connect(fmt.Sprintf("nats://127.0.0.1:%d", natsPort), nats.Timeout(2*time.Second))
+	if err != nil {
+		t.Fatalf("connect nats: %v", err)
+	}
+	defer nc.Close()
+	sub, err := nc.SubscribeSync("camera.bookmark")
+	if err != nil {
+		t.Fatalf("subscribe camera.bookmark: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("image", "bump.jpg")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	_, _ = part.Write([]byte{0xFF, 0xD8, 0xFF, 0xD9})
+	_ = form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/bookmark", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	bookmarkHandler(rec, req, nc)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("bookmark status = %d body=%s", rec.Code, rec.Body.String())
+	}
+
+	msg, err := sub.NextMsg(2 * time.Second)
+	if err != nil {
+		t.Fatalf("expected camera.bookmark publish: %v", err)
+	}
+	var payload struct {
+		Label string `json:"label"`
+	}
+	if err := json.Unmarshal(msg.Data, &payload); err != nil || payload.Label != "bump.jpg" {
+		t.Fatalf("unexpected camera.bookmark payload %q: %v", msg.Data, err)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// writeTelemetryCSV writes one row per series point, oldest first per series.
+func writeTelemetryCSV(w io.Writer, res telemetryResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"time", "series", "avg", "min", "max", "last", "count"}); err != nil {
+		return err
+	}
+	f := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	for _, ser := range res.Series {
+		for _, p := range ser.Points {
+			row := []string{time.UnixMilli(p.T).UTC().Format(time.RFC3339Nano), ser.Name, f(p.Avg), f(p.Min), f(p.Max), f(p.Last), strconv.FormatInt(p.Count, 10)}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// The Parquet export is a single row group of required, PLAIN-encoded,
+// uncompressed columns. That subset needs no Thrift or compression library,
+// keeps the server CGO-free for the rover, and is readable by DuckDB,
+// pandas/pyarrow and Spark.
+
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMillis = 9
+)
+
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32 // -1 when unset
+	values    bytes.Buffer
+}
+
+func writeTelemetryParquet(w io.Writer, res telemetryResult) error {
+	cols := []*parquetColumn{
+		{name: "time", typ: parquetInt64, converted: parquetConvertedTimestampMillis},
+		{name: "series", typ: parquetByteArray, converted: parquetConvertedUTF8},
+		{name: "avg", typ: parquetDouble, converted: -1},
+		{name: "min", typ: parquetDouble, converted: -1},
+		{name: "max", typ: parquetDouble, converted: -1},
+		{name: "last", typ: parquetDouble, converted: -1},
+		{name: "count", typ: parquetInt64, converted: -1},
+	}
+	var rows int64
+	var u64 [8]byte
+	putInt := func(c *parquetColumn, v int64) {
+		binary.LittleEndian.PutUint64(u64[:], uint64(v))
+		c.values.Write(u64[:])
+	}
+	putFloat := func(c *parquetColumn, v float64) {
+		binary.LittleEndian.PutUint64(u64[:], math.Float64bits(v))
+		c.values.Write(u64[:])
+	}
+	for _, ser := range res.Series {
+		for _, p := range ser.Points {
+			putInt(cols[0], p.T)
+			binary.LittleEndian.PutUint32(u64[:4], uint32(len(ser.Name)))
+			cols[1].values.Write(u64[:4])
+			cols[1].values.WriteString(ser.Name)
+			putFloat(cols[2], p.Avg)
+			putFloat(cols[3], p.Min)
+			putFloat(cols[4], p.Max)
+			putFloat(cols[5], p.Last)
+			putInt(cols[6], p.Count)
+			rows++
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("PAR1")
+	type chunkMeta struct {
+		offset int64
+		size   int64
+	}
+	chunks := make([]chunkMeta, len(cols))
+	var total int64
+	for i, c := range cols {
+		var header thriftCompact
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(c.values.Len()))
+		header.i32(3, int32(c.values.Len()))
+		header.structBegin(5)
+		header.i32(1, int32(rows))
+		header.i32(2, 0) // PLAIN
+		header.i32(3, 3) // RLE definition levels (none: required)
+		header.i32(4, 3) // RLE repetition levels (none: flat)
+		header.structEnd()
+		header.stop()
+		chunks[i] = chunkMeta{offset: int64(out.Len()), size: int64(header.buf.Len() + c.values.Len())}
+		total += chunks[i].size
+		out.Write(header.buf.Bytes())
+		out.Write(c.values.Bytes())
+	}
+
+	var meta thriftCompact
+	meta.i32(1, 1)
+	meta.listBegin(2, thriftStruct, len(cols)+1)
+	meta.elemBegin()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(cols)))
+	meta.elemEnd()
+	for _, c := range cols {
+		meta.elemBegin()
+		meta.i32(1, c.typ)
+		meta.i32(3, 0) // REQUIRED
+		meta.binary(4, c.name)
+		if c.converted >= 0 {
+			meta.i32(6, c.converted)
+		}
+		meta.elemEnd()
+	}
+	meta.i64(3, rows)
+	meta.listBegin(4, thriftStruct, 1)
+	meta.elemBegin()
+	meta.listBegin(1, thriftStruct, len(cols))
+	for i, c := range cols {
+		meta.elemBegin()
+		meta.i64(2, chunks[i].offset)
+		meta.structBegin(3)
+		meta.i32(1, c.typ)
+		meta.listBegin(2, thriftI32, 1)
+		meta.varint(0) // PLAIN
+		meta.listBegin(3, thriftBinary, 1)
+		meta.str(c.name)
+		meta.i32(4, 0) // UNCOMPRESSED
+		meta.i64(5, rows)
+		meta.i64(6, chunks[i].size)
+		meta.i64(7, chunks[i].size)
+		meta.i64(9, chunks[i].offset)
+		meta.structEnd()
+		meta.elemEnd()
+	}
+	meta.i64(2, total)
+	meta.i64(3, rows)
+	meta.elemEnd()
+	meta.binary(6, "dialtone robot src_v2")
+	meta.stop()
+
+	out.Write(meta.buf.Bytes())
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(meta.buf.Len()))
+	out.Write(n[:])
+	out.WriteString("PAR1")
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// thriftCompact is just enough of the Thrift compact protocol to encode
+// Parquet page headers and file metadata.
+type thriftCompact struct {
+	buf  bytes.Buffer
+	last []int16 // last field id per open struct
+}
+
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+func (t *thriftCompact) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func zigzag(v int64) uint64 { return uint64((v << 1) ^ (v >> 63)) }
+
+func (t *thriftCompact) field(id int16, typ byte) {
+	var last int16
+	if n := len(t.last); n > 0 {
+		last = t.last[n-1]
+		t.last[n-1] = id
+	} else {
+		t.last = append(t.last, id)
+	}
+	if delta := id - last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+		return
+	}
+	t.buf.WriteByte(typ)
+	t.varint(zigzag(int64(id)))
+}
+
+func (t *thriftCompact) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftCompact) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thriftCompact) str(s string) {
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftCompact) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.str(s)
+}
+
+func (t *thriftCompact) listBegin(id int16, elem byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elem)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elem)
+	t.varint(uint64(size))
+}
+
+func (t *thriftCompact) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.elemBegin()
+}
+
+func (t *thriftCompact) structEnd() { t.elemEnd() }
+
+// elemBegin opens a struct that is a list element (no field header).
+func (t *thriftCompact) elemBegin() { t.last = append(t.last, 0) }
+
+func (t *thriftCompact) elemEnd() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftCompact) stop() { t.buf.WriteByte(0) }
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultTelemetrySubjects are recorded when ROBOT_V2_TELEMETRY_SUBJECTS is
+// unset. Every numeric top-level field becomes a series named
+// "<subject without mavlink.>.<field>", e.g. "sys_status.voltage_battery".
+var defaultTelemetrySubjects = []string{
+	"mavlink.global_position_int",
+	"mavlink.attitude",
+	"mavlink.sys_status",
+	"mavlink.battery_status",
+	"mavlink.rc_channels",
+	"mavlink.servo_output_raw",
+	"mavlink.control_feedback",
+	"mavlink.stats",
+}
+
+// telemetryTiers are the retention rings kept per series, finest first. A
+// sample lands in every tier, so coarse tiers keep history after the fine
+// ones wrap.
+var telemetryTiers = []telemetryTier{
+	{Step: time.Second, Buckets: 1800},      // 30m
+	{Step: 10 * time.Second, Buckets: 1080}, // 3h
+	{Step: time.Minute, Buckets: 1440},      // 24h
+}
+
+const (
+	maxTelemetrySeries = 128
+	maxTelemetryPoints = 5000
+)
+
+type telemetryTier struct {
+	Step    time.Duration
+	Buckets int
+}
+
+type telemetryBucket struct {
+	Start int64 // unix ms, aligned to the tier step
+	Count int64
+	Sum   float64
+	Min   float64
+	Max   float64
+	Last  float64
+}
+
+func (b *telemetryBucket) add(v float64) {
+	if b.Count == 0 || v < b.Min {
+		b.Min = v
+	}
+	if b.Count == 0 || v > b.Max {
+		b.Max = v
+	}
+	b.Count++
+	b.Sum += v
+	b.Last = v
+}
+
+func (b *telemetryBucket) merge(o telemetryBucket) {
+	if o.Count == 0 {
+		return
+	}
+	if b.Count == 0 || o.Min < b.Min {
+		b.Min = o.Min
+	}
+	if b.Count == 0 || o.Max > b.Max {
+		b.Max = o.Max
+	}
+	b.Count += o.Count
+	b.Sum += o.Sum
+	b.Last = o.Last
+}
+
+// bucketRing keeps the newest len(buf) buckets of one tier in time order.
+type bucketRing struct {
+	step int64
+	buf  []telemetryBucket
+	head int // index of the oldest bucket
+	size int
+}
+
+func newBucketRing(tier telemetryTier) *bucketRing {
+	return &bucketRing{step: tier.Step.Milliseconds(), buf: make([]telemetryBucket, tier.Buckets)}
+}
+
+func (r *bucketRing) at(i int) *telemetryBucket {
+	return &r.buf[(r.head+i)%len(r.buf)]
+}
+
+func (r *bucketRing) add(ts int64, v float64) {
+	start := ts - ts%r.step
+	if r.size > 0 {
+		newest := r.at(r.size - 1)
+		if start == newest.Start {
+			newest.add(v)
+			return
+		}
+		if start < newest.Start {
+			// Late samples merge into their bucket if it is still retained;
+			// ones that fall into a gap or an evicted bucket are dropped.
+			for i := r.size - 2; i >= 0; i-- {
+				b := r.at(i)
+				if b.Start == start {
+					b.add(v)
+					return
+				}
+				if b.Start < start {
+					break
+				}
+			}
+			return
+		}
+	}
+	var b *telemetryBucket
+	if r.size < len(r.buf) {
+		b = r.at(r.size)
+		r.size++
+	} else {
+		b = r.at(0)
+		r.head = (r.head + 1) % len(r.buf)
+	}
+	*b = telemetryBucket{Start: start}
+	b.add(v)
+}
+
+func (r *bucketRing) oldest() int64 {
+	if r.size == 0 {
+		return math.MaxInt64
+	}
+	return r.at(0).Start
+}
+
+func (r *bucketRing) each(from, to int64, fn func(telemetryBucket)) {
+	for i := 0; i < r.size; i++ {
+		b := r.at(i)
+		if b.Start+r.step <= from || b.Start >= to {
+			continue
+		}
+		fn(*b)
+	}
+}
+
+type telemetrySeries struct {
+	tiers []*bucketRing
+	first int64
+	last  int64
+}
+
+type telemetryStore struct {
+	subjects map[string]bool
+	tiers    []telemetryTier
+
+	mu      sync.RWMutex
+	series  map[string]*telemetrySeries
+	dropped int64
+}
+
+func newTelemetryStore(subjects []string, tiers []telemetryTier) *telemetryStore {
+	s := &telemetryStore{subjects: map[string]bool{}, tiers: tiers, series: map[string]*telemetrySeries{}}
+	for _, subj := range subjects {
+		if subj = strings.TrimSpace(subj); subj != "" {
+			s.subjects[subj] = true
+		}
+	}
+	return s
+}
+
+func resolveTelemetrySubjects() []string {
+	raw := strings.TrimSpace(os.Getenv("ROBOT_V2_TELEMETRY_SUBJECTS"))
+	if raw == "" {
+		return defaultTelemetrySubjects
+	}
+	return strings.Split(raw, ",")
+}
+
+// Record stores the numeric fields of a JSON payload on a selected subject.
+func (s *telemetryStore) Record(subject string, data []byte, at time.Time) {
+	if s == nil || !s.subjects[subject] {
+		return
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return
+	}
+	prefix := strings.TrimPrefix(subject, "mavlink.")
+	ts := at.UnixMilli()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for field, raw := range payload {
+		if field == "timestamp" || field == "t_raw" {
+			continue
+		}
+		v, ok := raw.(float64)
+		if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		name := prefix + "." + field
+		ser := s.series[name]
+		if ser == nil {
+			if len(s.series) >= maxTelemetrySeries {
+				s.dropped++
+				continue
+			}
+			ser = &telemetrySeries{first: ts}
+			for _, tier := range s.tiers {
+				ser.tiers = append(ser.tiers, newBucketRing(tier))
+			}
+			s.series[name] = ser
+		}
+		for _, ring := range ser.tiers {
+			ring.add(ts, v)
+		}
+		if ts > ser.last {
+			ser.last = ts
+		}
+	}
+}
+
+type telemetrySeriesInfo struct {
+	Name  string `json:"name"`
+	First int64  `json:"first_ms"`
+	Last  int64  `json:"last_ms"`
+}
+
+func (s *telemetryStore) Series() []telemetrySeriesInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]telemetrySeriesInfo, 0, len(s.series))
+	for name, ser := range s.series {
+		out = append(out, telemetrySeriesInfo{Name: name, First: ser.first, Last: ser.last})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// matchSeries expands names and path.Match globs ("rc_channels.*").
+func (s *telemetryStore) matchSeries(patterns []string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seen := map[string]bool{}
+	var out []string
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		for name := range s.series {
+			if ok, _ := path.Match(p, name); (ok || name == p) && !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+type telemetryPoint struct {
+	T     int64   `json:"t"`
+	Avg   float64 `json:"avg"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Last  float64 `json:"last"`
+	Count int64   `json:"count"`
+}
+
+type telemetrySeriesResult struct {
+	Name   string           `json:"name"`
+	Points []telemetryPoint `json:"points"`
+}
+
+type telemetryQuery struct {
+	Series []string
+	From   time.Time
+	To     time.Time
+	Step   time.Duration
+}
+
+type telemetryResult struct {
+	From         int64                   `json:"from_ms"`
+	To           int64                   `json:"to_ms"`
+	StepMS       int64                   `json:"step_ms"`
+	ResolutionMS int64                   `json:"resolution_ms"`
+	Series       []telemetrySeriesResult `json:"series"`
+}
+
+// Query aggregates the selected series into buckets starting at multiples of
+// the step. It reads the finest tier that still covers q.From, raising the step
+// to that tier's resolution if needed; empty buckets are omitted.
+func (s *telemetryStore) Query(q telemetryQuery) (telemetryResult, error) {
+	from, to := q.From.UnixMilli(), q.To.UnixMilli()
+	if to <= from {
+		return telemetryResult{}, fmt.Errorf("to must be after from")
+	}
+	step := q.Step.Milliseconds()
+	if step <= 0 {
+		step = (to - from) / 300
+	}
+	if floor := (to - from) / maxTelemetryPoints; step < floor {
+		step = floor
+	}
+	if step < 1 {
+		step = 1
+	}
+	names := s.matchSeries(q.Series)
+	if len(names) == 0 {
+		return telemetryResult{}, fmt.Errorf("no series match %q", strings.Join(q.Series, ","))
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tierIdx := len(s.tiers) - 1
+	for i := range s.tiers {
+		if s.tierCovers(i, names, from) {
+			tierIdx = i
+			break
+		}
+	}
+	resolution := s.tiers[tierIdx].Step.Milliseconds()
+	if step < resolution {
+		step = resolution
+	}
+	res := telemetryResult{From: from, To: to, StepMS: step, ResolutionMS: resolution}
+	origin := from - from%step
+	for _, name := range names {
+		agg := map[int64]*telemetryBucket{}
+		var keys []int64
+		s.series[name].tiers[tierIdx].each(from, to, func(b telemetryBucket) {
+			key := b.Start - b.Start%step
+			if key < origin {
+				key = origin
+			}
+			cur := agg[key]
+			if cur == nil {
+				cur = &telemetryBucket{Start: key}
+				agg[key] = cur
+				keys = append(keys, key)
+			}
+			cur.merge(b)
+		})
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		out := telemetrySeriesResult{Name: name, Points: make([]telemetryPoint, 0, len(keys))}
+		for _, k := range keys {
+			b := agg[k]
+			out.Points = append(out.Points, telemetryPoint{T: k, Avg: b.Sum / float64(b.Count), Min: b.Min, Max: b.Max, Last: b.Last, Count: b.Count})
+		}
+		res.Series = append(res.Series, out)
+	}
+	return res, nil
+}
+
+// tierCovers reports whether tier i still holds everything after from for all
+// names. A ring that has not wrapped yet holds the whole series.
+func (s *telemetryStore) tierCovers(i int, names []string, from int64) bool {
+	for _, name := range names {
+		ring := s.series[name].tiers[i]
+		if ring.size == len(ring.buf) && ring.oldest() > from {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTelemetryTime accepts RFC3339, unix milliseconds, or a duration
+// relative to now ("15m" and "-15m" both mean 15 minutes ago).
+func parseTelemetryTime(raw string, now time.Time, fallback time.Time) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	switch {
+	case raw == "":
+		return fallback, nil
+	case raw == "now":
+		return now, nil
+	}
+	if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	if d, err := time.ParseDuration(strings.TrimPrefix(raw, "-")); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use RFC3339, unix ms or a duration like 15m)", raw)
+}
+
+func parseTelemetryQuery(r *http.Request, now time.Time) (telemetryQuery, error) {
+	v := r.URL.Query()
+	q := telemetryQuery{Series: strings.Split(v.Get("series"), ",")}
+	if strings.TrimSpace(v.Get("series")) == "" {
+		return q, fmt.Errorf("series is required")
+	}
+	var err error
+	if q.To, err = parseTelemetryTime(v.Get("to"), now, now); err != nil {
+		return q, err
+	}
+	if q.From, err = parseTelemetryTime(v.Get("from"), now, q.To.Add(-15*time.Minute)); err != nil {
+		return q, err
+	}
+	if raw := strings.TrimSpace(v.Get("step")); raw != "" {
+		if q.Step, err = time.ParseDuration(raw); err != nil || q.Step <= 0 {
+			return q, fmt.Errorf("invalid step %q", raw)
+		}
+	}
+	return q, nil
+}
+
+func (s *telemetryStore) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/api/telemetry/series", func(w http.ResponseWriter, _ *http.Request) {
+		s.mu.RLock()
+		dropped := s.dropped
+		s.mu.RUnlock()
+		writeJSON(w, map[string]any{"series": s.Series(), "dropped_samples": dropped})
+	})
+	mux.HandleFunc("/api/telemetry/query", func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseTelemetryQuery(r, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		res, err := s.Query(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, res)
+	})
+	mux.HandleFunc("/api/telemetry/export", func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseTelemetryQuery(r, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		res, err := s.Query(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+		if format == "" {
+			format = "csv"
+		}
+		name := fmt.Sprintf("telemetry-%s-%s", q.From.UTC().Format("20060102T150405Z"), q.To.UTC().Format("20060102T150405Z"))
+		switch format {
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+			err = writeTelemetryCSV(w, res)
+		case "parquet":
+			w.Header().Set("Content-Type", "application/vnd.apache.parquet")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".parquet"))
+			err = writeTelemetryParquet(w, res)
+		default:
+			http.Error(w, "format must be csv or parquet", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
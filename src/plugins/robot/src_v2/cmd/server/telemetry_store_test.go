@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTelemetryStoreDownsamplesAndQueries(t *testing.T) {
+	store := newTelemetryStore([]string{"mavlink.sys_status"}, []telemetryTier{
+		{Step: time.Second, Buckets: 10},
+		{Step: 10 * time.Second, Buckets: 100},
+	})
+	base := time.UnixMilli(1_699_999_980_000)
+	for i := 0; i < 60; i++ {
+		payload := fmt.Sprintf(`{"type":"SYS_STATUS","voltage_battery":%d,"battery_remaining":%d,"timestamp":1}`, 12000-i, 100-i)
+		store.Record("mavlink.sys_status", []byte(payload), base.Add(time.Duration(i)*time.Second))
+	}
+	store.Record("mavlink.heartbeat", []byte(`{"custom_mode":4}`), base)
+
+	names := []string{}
+	for _, s := range store.Series() {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != "sys_status.battery_remaining,sys_status.voltage_battery" {
+		t.Fatalf("unexpected series: %v", names)
+	}
+
+	// The 1s ring only holds the last 10s, so a recent window reads it.
+	recent, err := store.Query(telemetryQuery{Series: []string{"sys_status.voltage_battery"}, From: base.Add(50 * time.Second), To: base.Add(60 * time.Second), Step: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("Query returned error: %v", err)
+	}
+	pts := recent.Series[0].Points
+	if recent.ResolutionMS != 1000 || len(pts) != 2 || pts[0].Count != 5 || pts[0].Max != 11950 || pts[0].Min != 11946 || pts[1].Last != 11941 {
+		t.Fatalf("unexpected recent query: %+v", recent)
+	}
+
+	// The full minute has wrapped out of the 1s ring and comes from 10s buckets.
+	all, err := store.Query(telemetryQuery{Series: []string{"sys_status.*"}, From: base, To: base.Add(time.Minute), Step: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("Query returned error: %v", err)
+	}
+	if all.ResolutionMS != 10000 || len(all.Series) != 2 {
+		t.Fatalf("unexpected tier or series: %+v", all)
+	}
+	volts := all.Series[1].Points
+	if len(volts) != 2 || volts[0].Count != 30 || volts[0].Avg != 11985.5 || volts[1].Min != 11941 {
+		t.Fatalf("unexpected downsampled points: %+v", volts)
+	}
+
+	if _, err := store.Query(telemetryQuery{Series: []string{"gps.*"}, From: base, To: base.Add(time.Minute)}); err == nil {
+		t.Fatalf("expected error for unknown series")
+	}
+}
+
+func TestTelemetryExportCSVAndParquet(t *testing.T) {
+	store := newTelemetryStore([]string{"mavlink.global_position_int"}, telemetryTiers)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		store.Record("mavlink.global_position_int", []byte(fmt.Sprintf(`{"lat":37.%d,"lon":-122.4}`, i)), now.Add(time.Duration(i-3)*time.Second))
+	}
+	mux := http.NewServeMux()
+	store.RegisterHandlers(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	get := func(query string) []byte {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/api/telemetry/export?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("export %s: %d %s", query, resp.StatusCode, buf.String())
+		}
+		return buf.Bytes()
+	}
+
+	rows, err := csv.NewReader(bytes.NewReader(get("series=global_position_int.lat&from=1m&step=1s"))).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(rows) != 4 || strings.Join(rows[0], ",") != "time,series,avg,min,max,last,count" || rows[3][2] != "37.2" {
+		t.Fatalf("unexpected csv: %v", rows)
+	}
+
+	wantRows, err := csv.NewReader(bytes.NewReader(get("series=global_position_int.*&from=1m&step=1s"))).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	wantRows = wantRows[1:]
+	pq := get("series=global_position_int.*&from=1m&step=1s&format=parquet")
+	if !bytes.HasPrefix(pq, []byte("PAR1")) || !bytes.HasSuffix(pq, []byte("PAR1")) {
+		t.Fatalf("missing parquet magic")
+	}
+	footer := int(binary.LittleEndian.Uint32(pq[len(pq)-8:]))
+	if footer <= 0 || footer > len(pq)-12 {
+		t.Fatalf("bad footer length %d for %d bytes", footer, len(pq))
+	}
+	meta := (&thriftTestReader{t: t, b: pq[len(pq)-8-footer : len(pq)-8]}).readStruct()
+	if rows := meta[3].(int64); rows != int64(len(wantRows)) || rows == 0 {
+		t.Fatalf("footer num_rows=%d, want %d", rows, len(wantRows))
+	}
+	if meta[6] != "dialtone robot src_v2" {
+		t.Fatalf("unexpected created_by %v", meta[6])
+	}
+	schema := meta[2].([]any)
+	wantSchema := []struct {
+		name      string
+		typ       int64
+		converted int64
+	}{
+		{"time", parquetInt64, parquetConvertedTimestampMillis},
+		{"series", parquetByteArray, parquetConvertedUTF8},
+		{"avg", parquetDouble, -1},
+		{"min", parquetDouble, -1},
+		{"max", parquetDouble, -1},
+		{"last", parquetDouble, -1},
+		{"count", parquetInt64, -1},
+	}
+	if len(schema) != len(wantSchema)+1 || schema[0].(map[int16]any)[5].(int64) != int64(len(wantSchema)) {
+		t.Fatalf("unexpected schema root %v", schema)
+	}
+	for i, want := range wantSchema {
+		el := schema[i+1].(map[int16]any)
+		converted, ok := el[6].(int64)
+		if !ok {
+			converted = -1
+		}
+		if el[4] != want.name || el[1].(int64) != want.typ || converted != want.converted {
+			t.Fatalf("schema column %d = %v, want %+v", i, el, want)
+		}
+	}
+
+	// Read the first value of each column back through its column chunk
+	// offset and page header.
+	columns := meta[4].([]any)[0].(map[int16]any)[1].([]any)
+	first := func(col int) []byte {
+		t.Helper()
+		offset := columns[col].(map[int16]any)[3].(map[int16]any)[9].(int64)
+		page := &thriftTestReader{t: t, b: pq[offset:]}
+		header := page.readStruct()
+		if n := header[5].(map[int16]any)[1].(int64); n != int64(len(wantRows)) {
+			t.Fatalf("column %d page has %d values, want %d", col, n, len(wantRows))
+		}
+		return pq[int(offset)+page.pos:]
+	}
+	wantTime, _ := time.Parse(time.RFC3339Nano, wantRows[0][0])
+	if got := int64(binary.LittleEndian.Uint64(first(0))); got != wantTime.UnixMilli() {
+		t.Fatalf("first time = %d, want %d", got, wantTime.UnixMilli())
+	}
+	series := first(1)
+	if n := binary.LittleEndian.Uint32(series); string(series[4:4+n]) != wantRows[0][1] {
+		t.Fatalf("first series = %q, want %q", series[4:4+n], wantRows[0][1])
+	}
+	wantAvg, _ := strconv.ParseFloat(wantRows[0][2], 64)
+	if got := math.Float64frombits(binary.LittleEndian.Uint64(first(2))); got != wantAvg {
+		t.Fatalf("first avg = %v, want %v", got, wantAvg)
+	}
+	if got := int64(binary.LittleEndian.Uint64(first(6))); strconv.FormatInt(got, 10) != wantRows[0][6] {
+		t.Fatalf("first count = %d, want %s", got, wantRows[0][6])
+	}
+
+	resp, _ := http.Get(srv.URL + "/api/telemetry/query?series=global_position_int.lat&from=bogus")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad from, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+}
+
+// thriftTestReader decodes Thrift compact structs into field id -> value
+// maps so tests can check the Parquet footer independently of the writer.
+type thriftTestReader struct {
+	t   *testing.T
+	b   []byte
+	pos int
+}
+
+func (r *thriftTestReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	if n <= 0 {
+		r.t.Fatalf("bad varint at %d", r.pos)
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftTestReader) int() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftTestReader) readStruct() map[int16]any {
+	out := map[int16]any{}
+	var last int16
+	for {
+		h := r.b[r.pos]
+		r.pos++
+		if h == 0 {
+			return out
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			id = int16(r.int())
+		}
+		last = id
+		out[id] = r.readValue(h & 0x0f)
+	}
+}
+
+func (r *thriftTestReader) readValue(typ byte) any {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case 3:
+		r.pos++
+		return int64(int8(r.b[r.pos-1]))
+	case 4, thriftI32, thriftI64:
+		return r.int()
+	case 7:
+		r.pos += 8
+		return math.Float64frombits(binary.LittleEndian.Uint64(r.b[r.pos-8:]))
+	case thriftBinary:
+		n := int(r.uvarint())
+		r.pos += n
+		return string(r.b[r.pos-n : r.pos])
+	case thriftList:
+		h := r.b[r.pos]
+		r.pos++
+		size := int(h >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		items := make([]any, size)
+		for i := range items {
+			items[i] = r.readValue(h & 0x0f)
+		}
+		return items
+	case thriftStruct:
+		return r.readStruct()
+	}
+	r.t.Fatalf("unsupported thrift type %d at %d", typ, r.pos)
+	return nil
+}
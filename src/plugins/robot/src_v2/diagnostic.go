@@ -0,0 +1,108 @@
+package robotv2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	diagnosticv1 "dialtone/dev/plugins/diagnostic/src_v1/go"
+)
+
+const (
+	autoswapUnit        = "dialtone_autoswap.service"
+	autoswapRuntimeFile = "$HOME/.dialtone/autoswap/state/runtime.json"
+)
+
+// RegisterDiagnostics adds the robot.* checks to r. They cover the service
+// and process parts of `robot src_v2 diagnostic`; artifact digests, the
+// manifest-url release comparison and the UI browser checks stay in that
+// command.
+func RegisterDiagnostics(r *diagnosticv1.Registry) error {
+	return r.RegisterAll(diagnosticv1.Check{
+		Name:        "robot.autoswap",
+		Description: "Autoswap user service is active and runs dialtone_autoswap_v1",
+		Severity:    diagnosticv1.SeverityWarning,
+		DependsOn:   []string{"ssh.reachable"},
+		Remediation: "redeploy with ./dialtone.sh robot src_v2 rollout --host <node>, then check journalctl --user -u " + autoswapUnit,
+		Run: func(ctx context.Context, t diagnosticv1.Target) (string, error) {
+			if t.OS() != "linux" {
+				return "", diagnosticv1.Skipf("autoswap runs as a systemd user service on linux only")
+			}
+			out, err := t.Exec(ctx, "systemctl --user show "+autoswapUnit+" --property=LoadState,ActiveState,ExecStart --no-pager")
+			if err != nil {
+				return "", fmt.Errorf("systemctl --user show failed: %v %s", err, out)
+			}
+			return evaluateAutoswapUnit(out)
+		},
+	}, diagnosticv1.Check{
+		Name:        "robot.runtime",
+		Description: "Autoswap runtime state reports every managed process running",
+		Severity:    diagnosticv1.SeverityWarning,
+		DependsOn:   []string{"robot.autoswap"},
+		Remediation: "run ./dialtone.sh robot src_v2 diagnostic --host <node> for the full artifact and manifest check",
+		Run: func(ctx context.Context, t diagnosticv1.Target) (string, error) {
+			out, err := t.Exec(ctx, "cat "+autoswapRuntimeFile)
+			if err != nil {
+				return "", fmt.Errorf("read %s: %v %s", autoswapRuntimeFile, err, out)
+			}
+			return evaluateAutoswapRuntime(out)
+		},
+	})
+}
+
+// evaluateAutoswapUnit reads `systemctl show` key=value output. A unit that
+// is not installed means the host is not a robot, so the check is skipped.
+func evaluateAutoswapUnit(out string) (string, error) {
+	props := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			props[key] = value
+		}
+	}
+	if props["LoadState"] == "" || props["LoadState"] == "not-found" {
+		return "", diagnosticv1.Skipf("%s is not installed", autoswapUnit)
+	}
+	if state := props["ActiveState"]; state != "active" {
+		return "", fmt.Errorf("%s is %s", autoswapUnit, chooseNonEmpty(state, "unknown"))
+	}
+	if !strings.Contains(props["ExecStart"], "dialtone_autoswap_v1") {
+		return "", fmt.Errorf("%s ExecStart does not run dialtone_autoswap_v1", autoswapUnit)
+	}
+	if manifestURL := strings.TrimSpace(extractFlagValue(props["ExecStart"], "--manifest-url")); manifestURL != "" {
+		return "active manifest-url=" + manifestURL, nil
+	}
+	return "active", nil
+}
+
+func evaluateAutoswapRuntime(raw string) (string, error) {
+	var state struct {
+		Processes []struct {
+			Name   string `json:"name"`
+			PID    int    `json:"pid"`
+			Status string `json:"status"`
+		} `json:"processes"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &state); err != nil {
+		return "", fmt.Errorf("parse autoswap runtime state: %w", err)
+	}
+	if len(state.Processes) == 0 {
+		return "", fmt.Errorf("autoswap runtime state lists no processes")
+	}
+	var running, down []string
+	for _, p := range state.Processes {
+		name := chooseNonEmpty(strings.TrimSpace(p.Name), "?")
+		if strings.EqualFold(strings.TrimSpace(p.Status), "running") && p.PID > 0 {
+			running = append(running, name)
+			continue
+		}
+		down = append(down, fmt.Sprintf("%s=%s", name, chooseNonEmpty(strings.TrimSpace(p.Status), "unknown")))
+	}
+	sort.Strings(running)
+	sort.Strings(down)
+	if len(down) > 0 {
+		return "", fmt.Errorf("not running: %s", strings.Join(down, ", "))
+	}
+	return "running: " + strings.Join(running, ", "), nil
+}
@@ -0,0 +1,53 @@
+package robotv2
+
+import (
+	"strings"
+	"testing"
+
+	diagnosticv1 "dialtone/dev/plugins/diagnostic/src_v1/go"
+	sshv1 "dialtone/dev/plugins/ssh/src_v1/go"
+)
+
+func TestRegisterDiagnosticsPlansAfterSSH(t *testing.T) {
+	reg := diagnosticv1.NewRegistry()
+	if err := sshv1.RegisterDiagnostics(reg); err != nil {
+		t.Fatalf("ssh RegisterDiagnostics returned error: %v", err)
+	}
+	if err := RegisterDiagnostics(reg); err != nil {
+		t.Fatalf("RegisterDiagnostics returned error: %v", err)
+	}
+	plan, err := reg.Plan([]string{"robot"})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if len(plan) != 3 || plan[0].Name != "ssh.reachable" || plan[1].Name != "robot.autoswap" || plan[2].Name != "robot.runtime" {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+}
+
+func TestEvaluateAutoswapUnit(t *testing.T) {
+	active := "LoadState=loaded\nActiveState=active\nExecStart={ path=/home/pi/.dialtone/autoswap/bin/dialtone_autoswap_v1 ; argv[]=dialtone_autoswap_v1 service --mode run --manifest-url https://example.test/m.json ; }"
+	if msg, err := evaluateAutoswapUnit(active); err != nil || msg != "active manifest-url=https://example.test/m.json" {
+		t.Fatalf("active unit = %q, %v", msg, err)
+	}
+	if _, err := evaluateAutoswapUnit("LoadState=not-found\nActiveState=inactive\nExecStart="); err == nil || !strings.Contains(err.Error(), "not installed") {
+		t.Fatalf("expected missing unit to be skipped, got %v", err)
+	}
+	if _, err := evaluateAutoswapUnit("LoadState=loaded\nActiveState=failed\nExecStart=x"); err == nil || !strings.Contains(err.Error(), "is failed") {
+		t.Fatalf("expected failed unit to fail, got %v", err)
+	}
+}
+
+func TestEvaluateAutoswapRuntime(t *testing.T) {
+	msg, err := evaluateAutoswapRuntime(`{"processes":[{"name":"robot","pid":10,"status":"running"},{"name":"camera","pid":11,"status":"running"}]}`)
+	if err != nil || msg != "running: camera, robot" {
+		t.Fatalf("healthy runtime = %q, %v", msg, err)
+	}
+	_, err = evaluateAutoswapRuntime(`{"processes":[{"name":"robot","pid":10,"status":"running"},{"name":"mavlink","pid":0,"status":"exited"}]}`)
+	if err == nil || !strings.Contains(err.Error(), "mavlink=exited") {
+		t.Fatalf("expected stopped process to fail, got %v", err)
+	}
+	if _, err := evaluateAutoswapRuntime("{"); err == nil {
+		t.Fatalf("expected invalid runtime state to fail")
+	}
+}
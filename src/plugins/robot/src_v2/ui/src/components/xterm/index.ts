@@ -2,6 +2,7 @@ import { Terminal } from '@xterm/xterm';
 import { FitAddon } from '@xterm/addon-fit';
 import '@xterm/xterm/css/xterm.css';
 import { VisualizationControl } from '@ui/types';
+import { acquireDriverLock, logout, releaseDriverLock } from '../../data/auth';
 import { addRobotEventListener, getRobotEventHistory, sendCommand, type RobotEvent } from '../../data/connection';
 import { logInfo } from '../../data/logging';
 import { registerButtons, renderButtons, setMode } from '../../buttons';
@@ -244,7 +245,13 @@ export function mountXterm(container: HTMLElement): VisualizationControl {
     const inputAria = inputEl.getAttribute('aria-label') || 'Log Command Input';
     logInfo('ui/xterm', `[TEST_ACTION] input aria=${inputAria} value=${value}`);
     terminalEl.setAttribute('data-last-command', value);
-    if (value.startsWith('mode ')) {
+    if (value === 'drive') {
+      void acquireDriverLock();
+    } else if (value === 'release') {
+      void releaseDriverLock();
+    } else if (value === 'logout') {
+      void logout();
+    } else if (value.startsWith('mode ')) {
       const parts = value.split(' ');
       if (parts.length > 1) sendCommand('mode', parts[1]);
     } else if (value === 'arm') {
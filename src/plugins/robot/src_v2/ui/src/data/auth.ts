@@ -0,0 +1,151 @@
+import { logInfo, logWarn } from './logging';
+
+export type DriverLockState = {
+  held: boolean;
+  holder?: string;
+  acquired_at?: string;
+  expires_at?: string;
+  timeout_ms: number;
+};
+
+type SessionInfo = {
+  auth_required: boolean;
+  authenticated: boolean;
+  name?: string;
+  role?: string;
+  nats_user?: string;
+  nats_pass?: string;
+  driver_lock?: DriverLockState;
+};
+
+let session: SessionInfo = { auth_required: false, authenticated: false };
+let lockState: DriverLockState = { held: false, timeout_ms: 0 };
+let renewTimer: number | null = null;
+
+function setHeaderAttr(name: string, value: string) {
+  const header = document.querySelector("[aria-label='App Header']") as HTMLElement | null;
+  if (header) header.setAttribute(name, value);
+}
+
+export function authRequired() {
+  return session.auth_required;
+}
+
+export function holdsDriverLock() {
+  return lockState.held && !!session.name && lockState.holder === session.name;
+}
+
+// canDrive is true when auth is off or this operator holds the driver lock.
+export function canDrive() {
+  return !session.auth_required || holdsDriverLock();
+}
+
+export function updateDriverLock(next: DriverLockState) {
+  lockState = {
+    held: !!next.held,
+    holder: next.holder || '',
+    acquired_at: next.acquired_at,
+    expires_at: next.expires_at,
+    timeout_ms: Number(next.timeout_ms) || lockState.timeout_ms,
+  };
+  const mine = holdsDriverLock();
+  setHeaderAttr('data-driver-lock-holder', lockState.held ? lockState.holder || '' : '');
+  setHeaderAttr('data-driver-lock-mine', mine ? 'true' : 'false');
+  const badge = document.getElementById('driver-lock');
+  if (badge) {
+    badge.hidden = !session.auth_required;
+    badge.setAttribute('data-held', lockState.held ? 'true' : 'false');
+    badge.setAttribute('data-mine', mine ? 'true' : 'false');
+    badge.textContent = lockState.held ? `driver: ${lockState.holder}${mine ? ' (you)' : ''}` : 'driver: none';
+  }
+  if (mine && renewTimer === null) {
+    const every = Math.max(1000, Math.floor((lockState.timeout_ms || 30000) / 3));
+    renewTimer = window.setInterval(() => void postDriverLock('renew'), every);
+  } else if (!mine && renewTimer !== null) {
+    window.clearInterval(renewTimer);
+    renewTimer = null;
+  }
+}
+
+async function fetchSession(): Promise<SessionInfo> {
+  const res = await fetch('/api/session', { cache: 'no-store', credentials: 'same-origin' });
+  return (await res.json()) as SessionInfo;
+}
+
+function promptLogin(message = ''): Promise<SessionInfo> {
+  return new Promise((resolve) => {
+    const form = document.createElement('form');
+    form.className = 'login-form';
+    form.setAttribute('aria-label', 'Operator Login');
+    form.innerHTML = `
+      <h2>Operator login</h2>
+      <input name="name" aria-label="Operator Name" autocomplete="username" placeholder="name" required />
+      <input name="password" aria-label="Operator Password" type="password" autocomplete="current-password" placeholder="password" required />
+      <button type="submit" aria-label="Operator Login Submit">Log in</button>
+      <p aria-label="Operator Login Error"></p>`;
+    const errorEl = form.querySelector('p') as HTMLElement;
+    errorEl.textContent = message;
+    form.addEventListener('submit', async (ev) => {
+      ev.preventDefault();
+      const data = new FormData(form);
+      const res = await fetch('/api/login', {
+        method: 'POST',
+        credentials: 'same-origin',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ name: data.get('name'), password: data.get('password') }),
+      });
+      if (!res.ok) {
+        errorEl.textContent = (await res.text()).trim() || 'login failed';
+        return;
+      }
+      form.remove();
+      resolve((await res.json()) as SessionInfo);
+    });
+    document.body.appendChild(form);
+  });
+}
+
+// ensureSession resolves with the NATS credentials for this browser, showing
+// the login form first when the server requires auth and no session exists.
+export async function ensureSession(): Promise<{ user?: string; pass?: string }> {
+  session = await fetchSession();
+  if (session.auth_required && !session.authenticated) {
+    session = await promptLogin();
+    logInfo('ui/auth', `[AUTH] Logged in as ${session.name} (${session.role})`);
+  }
+  setHeaderAttr('data-operator', session.name || '');
+  setHeaderAttr('data-operator-role', session.role || '');
+  if (session.driver_lock) updateDriverLock(session.driver_lock);
+  if (!session.auth_required) return {};
+  return { user: session.nats_user, pass: session.nats_pass };
+}
+
+async function postDriverLock(action: 'acquire' | 'renew' | 'release') {
+  const res = await fetch('/api/driver-lock', {
+    method: 'POST',
+    credentials: 'same-origin',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ action }),
+  });
+  if (res.ok || res.status === 409) {
+    updateDriverLock((await res.json()) as DriverLockState);
+  }
+  if (res.status === 409) {
+    logWarn('ui/auth', `[AUTH] Driver lock held by ${lockState.holder}`);
+  } else if (!res.ok) {
+    logWarn('ui/auth', `[AUTH] Driver lock ${action} failed: ${(await res.text()).trim()}`);
+  }
+}
+
+export function acquireDriverLock() {
+  return postDriverLock('acquire');
+}
+
+export function releaseDriverLock() {
+  return postDriverLock('release');
+}
+
+export async function logout() {
+  await fetch('/api/logout', { method: 'POST', credentials: 'same-origin' });
+  window.location.reload();
+}
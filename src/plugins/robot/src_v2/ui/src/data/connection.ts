@@ -1,4 +1,5 @@
 import { JSONCodec, connect, type NatsConnection } from 'nats.ws';
+import { canDrive, ensureSession, updateDriverLock } from './auth';
 import { logError, logInfo, logWarn, setNATSPublisher } from './logging';
 
 let nc: NatsConnection | null = null;
@@ -106,6 +107,8 @@ function summarizePayload(payload: any): string {
         return `roll=${stringifyValue(payload.roll)} pitch=${stringifyValue(payload.pitch)} yaw=${stringifyValue(payload.yaw)}`;
       case 'AUTOSWAP_SUPERVISOR':
         return `status=${stringifyValue(payload.status)} worker=${stringifyValue(payload.worker_version)} pid=${stringifyValue(payload.worker_pid)} release=${stringifyValue(payload.last_release_tag)}`;
+      case 'DRIVER_LOCK':
+        return payload.held ? `held by ${stringifyValue(payload.holder)} until ${stringifyValue(payload.expires_at)}` : 'released';
       case 'AUTOSWAP_RUNTIME':
         return `listen=${stringifyValue(payload.listen)} running=${stringifyValue(payload.running_count)}/${stringifyValue(payload.process_count)} procs=${stringifyValue(payload.process_names)}`;
       default:
@@ -161,6 +164,8 @@ function normalizeRobotEvent(subject: string, payload: any): RobotEvent {
     prefix = '[ROBOT]';
     if (Array.isArray(payload?.errors) && payload.errors.length > 0) {
       level = 'ERROR';
+    } else if (subject === 'robot.driver_lock') {
+      prefix = '[ROBOT][DRIVER_LOCK]';
     } else if (['robot.service', 'robot.autoswap.supervisor', 'robot.autoswap.runtime'].includes(subject)) {
       noisy = true;
     }
@@ -186,6 +191,7 @@ async function bindSubscriptions(next: NatsConnection) {
       for await (const msg of sub) {
         try {
           const payload = jc.decode(msg.data);
+          if (msg.subject === 'robot.driver_lock') updateDriverLock(payload as any);
           pushRobotEvent(normalizeRobotEvent(msg.subject, payload));
         } catch (err) {
           logError('ui/connection', `[NATS] Decode error subject=${msg.subject}`, err);
@@ -207,9 +213,10 @@ export async function initConnection() {
     const server = wsPath
       ? `${protocol}//${window.location.host}${wsPath}`
       : `${protocol}//${hostname}:${wsPort}`;
+    const creds = await ensureSession();
     logInfo('ui/connection', `[NATS] Connecting to ${server}...`);
     setConnectionState(false);
-    nc = await connect({ servers: [server] });
+    nc = await connect({ servers: [server], ...creds });
     setNATSPublisher((subject, payload) => {
       if (nc) nc.publish(subject, payload);
     });
@@ -236,6 +243,10 @@ export function sendCommand(cmd: string, mode?: string, extra?: Record<string, u
     logWarn('ui/connection', `[NATS] Not connected, cannot send command: ${cmd}`);
     return;
   }
+  if (!canDrive()) {
+    logWarn('ui/connection', `[AUTH] Take the driver lock before sending: ${cmd}`);
+    return;
+  }
   const payload: any = { cmd };
   if (mode) payload.mode = mode;
   if (extra && typeof extra === 'object') Object.assign(payload, extra);
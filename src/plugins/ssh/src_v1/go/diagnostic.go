@@ -0,0 +1,95 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	diagnosticv1 "dialtone/dev/plugins/diagnostic/src_v1/go"
+)
+
+const (
+	diagnosticMinMemFreeMB  = 256
+	diagnosticMinDiskFreeMB = 2 * 1024
+)
+
+// RegisterDiagnostics adds the ssh.* checks to r.
+func RegisterDiagnostics(r *diagnosticv1.Registry) error {
+	return r.RegisterAll(diagnosticv1.Check{
+		Name:        "ssh.reachable",
+		Description: "Target answers a shell command",
+		Severity:    diagnosticv1.SeverityCritical,
+		Remediation: "check ./dialtone.sh ssh src_v1 resolve --host <node> and the node's route_preference in the mesh config",
+		Run: func(ctx context.Context, t diagnosticv1.Target) (string, error) {
+			out, err := t.Exec(ctx, "echo ok")
+			if err != nil {
+				return "", err
+			}
+			if !strings.Contains(out, "ok") {
+				return "", fmt.Errorf("unexpected probe output %q", out)
+			}
+			return "ok", nil
+		},
+	}, diagnosticv1.Check{
+		Name:        "ssh.host-resources",
+		Description: "CPU, memory, disk and battery from the ssh status probe",
+		Severity:    diagnosticv1.SeverityWarning,
+		DependsOn:   []string{"ssh.reachable"},
+		Remediation: "free memory or disk space on the host (ssh src_v1 status --host <node> shows the same probe)",
+		Run: func(ctx context.Context, t diagnosticv1.Target) (string, error) {
+			out, err := t.Exec(ctx, buildStatusProbeCommand(MeshNode{OS: t.OS()}))
+			if err != nil {
+				return "", err
+			}
+			return evaluateStatusProbe(parseStatusOutput(out))
+		},
+	})
+}
+
+func evaluateStatusProbe(st map[string]string) (string, error) {
+	if len(st) == 0 {
+		return "", fmt.Errorf("status probe returned no data")
+	}
+	msg := fmt.Sprintf("cpu=%s mem_free=%s disk_free=%s battery=%s",
+		defaultDash(st["cpu"]), defaultDash(st["mem_free"]), defaultDash(st["disk_free"]), defaultDash(st["battery"]))
+	var low []string
+	if mb, ok := parseSizeMB(st["mem_free"]); ok && mb < diagnosticMinMemFreeMB {
+		low = append(low, "memory")
+	}
+	if mb, ok := parseSizeMB(st["disk_free"]); ok && mb < diagnosticMinDiskFreeMB {
+		low = append(low, "disk")
+	}
+	if len(low) > 0 {
+		return "", fmt.Errorf("low %s: %s", strings.Join(low, " and "), msg)
+	}
+	return msg, nil
+}
+
+// parseSizeMB reads the probe's human sizes (512MB, 12G, 1.5Ti) as MiB.
+func parseSizeMB(raw string) (float64, bool) {
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	if s == "" || s == "-" {
+		return 0, false
+	}
+	mult := 1.0 / 1024 / 1024
+	switch s[len(s)-1] {
+	case 'K':
+		mult = 1.0 / 1024
+	case 'M':
+		mult = 1
+	case 'G':
+		mult = 1024
+	case 'T':
+		mult = 1024 * 1024
+	}
+	if s[len(s)-1] < '0' || s[len(s)-1] > '9' {
+		s = s[:len(s)-1]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v * mult, true
+}
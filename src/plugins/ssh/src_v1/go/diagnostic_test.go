@@ -0,0 +1,22 @@
+package ssh
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvaluateStatusProbe(t *testing.T) {
+	if _, err := evaluateStatusProbe(parseStatusOutput("cpu=3.1%|mem_free=2048MB|network=eth0:10.0.0.2/24|disk_free=40G|battery=-")); err != nil {
+		t.Fatalf("healthy probe failed: %v", err)
+	}
+	_, err := evaluateStatusProbe(parseStatusOutput("cpu=90%|mem_free=100MB|network=-|disk_free=1.5G|battery=-"))
+	if err == nil || !strings.Contains(err.Error(), "low memory and disk") {
+		t.Fatalf("expected low memory and disk, got %v", err)
+	}
+	if mb, ok := parseSizeMB("1.5Ti"); !ok || mb != 1.5*1024*1024 {
+		t.Fatalf("parseSizeMB(1.5Ti) = %v %v", mb, ok)
+	}
+	if _, ok := parseSizeMB("-"); ok {
+		t.Fatalf("parseSizeMB(-) should not parse")
+	}
+}
@@ -199,6 +199,30 @@ func CandidateHosts(node MeshNode) []string {
 	return prioritizedMeshHostsForNode(node, resolveMeshCandidates(node))
 }
 
+// ResolveRouteHosts returns a mesh node's hosts in route preference order.
+// Anything that is not a mesh node name is taken as a comma-separated list
+// of hosts or URLs and returned as given.
+func ResolveRouteHosts(target string) []string {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return nil
+	}
+	if !strings.ContainsAny(target, ",:/") {
+		if node, err := ResolveMeshNode(target); err == nil {
+			if hosts := CandidateHosts(node); len(hosts) > 0 {
+				return hosts
+			}
+		}
+	}
+	out := []string{}
+	for _, h := range strings.Split(target, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
 func CanReachHostPort(host, port string, timeout time.Duration) bool {
 	return canReachHostPort(host, port, timeout)
 }
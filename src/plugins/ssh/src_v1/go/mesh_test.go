@@ -192,3 +192,13 @@ func TestResolvePreferredHostFallsBackToPrimaryHost(t *testing.T) {
 		t.Fatalf("expected first remaining candidate host, got %s", got)
 	}
 }
+
+func TestResolveRouteHostsPassesThroughHostLists(t *testing.T) {
+	got := ResolveRouteHosts(" 10.0.0.5:7422, nats-leaf://hub.example:7422 ,")
+	if len(got) != 2 || got[0] != "10.0.0.5:7422" || got[1] != "nats-leaf://hub.example:7422" {
+		t.Fatalf("unexpected host list %v", got)
+	}
+	if got := ResolveRouteHosts("not-a-mesh-node"); len(got) != 1 || got[0] != "not-a-mesh-node" {
+		t.Fatalf("unknown node should be used as a host, got %v", got)
+	}
+}
@@ -25,6 +25,15 @@ func Run(args []string) error {
 		args = args[1:] // shift version
 	}
 
+	if len(args) > 0 {
+		switch args[0] {
+		case "record":
+			return runRecord(args[1:])
+		case "replay":
+			return runReplay(args[1:])
+		}
+	}
+
 	flags := flag.NewFlagSet("tap", flag.ExitOnError)
 	upstream := flags.String("upstream", "nats://127.0.0.1:4222", "Upstream NATS URL")
 	subjectsCSV := flags.String("subjects", "repl.>", "Comma-separated subject patterns")
@@ -40,3 +49,73 @@ func Run(args []string) error {
 
 	return tapv1.Run(*upstream, *subjectsCSV, *name, *reconnectWait, *raw, *showSubject, *showReconnects)
 }
+
+func runRecord(args []string) error {
+	flags := flag.NewFlagSet("tap record", flag.ExitOnError)
+	upstream := flags.String("upstream", "nats://127.0.0.1:4222", "Upstream NATS URL")
+	subjectsCSV := flags.String("subjects", "repl.>", "Comma-separated subject patterns")
+	name := flags.String("name", "dialtone-tap-record", "NATS client name")
+	output := flags.String("out", "", "Session file (default tap-<utc time>.jsonl.gz)")
+	duration := flags.Duration("duration", 0, "Stop after this long (0 records until interrupted)")
+	maxMessages := flags.Int("max-messages", 0, "Stop after this many messages (0 is unlimited)")
+	reconnectWait := flags.Duration("reconnect-wait", 1200*time.Millisecond, "Reconnect wait interval")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("record does not accept positional arguments")
+	}
+	return tapv1.Record(tapv1.RecordOptions{
+		Upstream:      *upstream,
+		Subjects:      *subjectsCSV,
+		Name:          *name,
+		Output:        *output,
+		Duration:      *duration,
+		MaxMessages:   *maxMessages,
+		ReconnectWait: *reconnectWait,
+	})
+}
+
+func runReplay(args []string) error {
+	flags := flag.NewFlagSet("tap replay", flag.ExitOnError)
+	target := flags.String("target", "", "Publish into this NATS URL instead of a fresh embedded NATS")
+	subjectsCSV := flags.String("subjects", "", "Only replay subjects matching these comma-separated patterns")
+	speed := flags.Float64("speed", 1, "Timing scale (2 is twice as fast, 0 is as fast as possible)")
+	wait := flags.Duration("wait", 0, "Wait before publishing so subscribers can attach")
+	loop := flags.Bool("loop", false, "Replay the session repeatedly")
+	hold := flags.Bool("hold", false, "Keep the embedded NATS running after replay until interrupted")
+	quiet := flags.Bool("quiet", false, "Do not print replayed messages")
+	files, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("replay requires exactly one session file, got %d", len(files))
+	}
+	return tapv1.Replay(tapv1.ReplayOptions{
+		Input:    files[0],
+		Target:   *target,
+		Subjects: *subjectsCSV,
+		Speed:    *speed,
+		Wait:     *wait,
+		Loop:     *loop,
+		Hold:     *hold,
+		Quiet:    *quiet,
+	})
+}
+
+// parseInterspersed parses flags placed before or after the positional
+// arguments, so `replay FILE --speed 4` honors --speed.
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
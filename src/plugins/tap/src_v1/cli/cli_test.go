@@ -0,0 +1,20 @@
+package cli
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestParseInterspersedReadsFlagsAfterFile(t *testing.T) {
+	flags := flag.NewFlagSet("tap replay", flag.ContinueOnError)
+	speed := flags.Float64("speed", 1, "")
+	quiet := flags.Bool("quiet", false, "")
+	files, err := parseInterspersed(flags, []string{"--quiet", "session.jsonl.gz", "--speed", "4"})
+	if err != nil {
+		t.Fatalf("parseInterspersed returned error: %v", err)
+	}
+	if !reflect.DeepEqual(files, []string{"session.jsonl.gz"}) || *speed != 4 || !*quiet {
+		t.Fatalf("files=%v speed=%v quiet=%v", files, *speed, *quiet)
+	}
+}
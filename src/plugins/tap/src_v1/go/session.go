@@ -0,0 +1,379 @@
+package tap
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	logs "dialtone/dev/plugins/logs/src_v1/go"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	sessionFormat  = "dialtone-tap-session"
+	sessionVersion = 2
+)
+
+// Session files are gzip-compressed JSON lines: one sessionHeader followed by
+// one sessionMessage per captured message, in arrival order. Version 2 keeps
+// UTF-8 payloads as verbatim strings; version 1 inlined JSON payloads, which
+// compacted them, and is still readable.
+type sessionHeader struct {
+	Format    string   `json:"format"`
+	Version   int      `json:"version"`
+	StartedAt string   `json:"started_at"`
+	Upstream  string   `json:"upstream,omitempty"`
+	Subjects  []string `json:"subjects"`
+}
+
+type sessionMessage struct {
+	OffsetNS int64               `json:"t"`
+	Subject  string              `json:"s"`
+	Reply    string              `json:"r,omitempty"`
+	Header   map[string][]string `json:"h,omitempty"`
+	Text     string              `json:"x,omitempty"`
+	JSON     json.RawMessage     `json:"j,omitempty"`
+	Data     []byte              `json:"d,omitempty"`
+}
+
+func (m sessionMessage) payload() []byte {
+	if m.Text != "" {
+		return []byte(m.Text)
+	}
+	if len(m.JSON) > 0 {
+		return m.JSON
+	}
+	return m.Data
+}
+
+type RecordOptions struct {
+	Upstream      string
+	Subjects      string
+	Name          string
+	Output        string
+	Duration      time.Duration
+	MaxMessages   int
+	ReconnectWait time.Duration
+}
+
+type ReplayOptions struct {
+	Input    string
+	Target   string
+	Subjects string
+	Speed    float64
+	Wait     time.Duration
+	Loop     bool
+	Hold     bool
+	Quiet    bool
+}
+
+type sessionWriter struct {
+	mu      sync.Mutex
+	file    *os.File
+	gz      *gzip.Writer
+	buf     *bufio.Writer
+	enc     *json.Encoder
+	started time.Time
+	count   int
+	err     error
+}
+
+func createSession(path string, header sessionHeader, started time.Time) (*sessionWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	buf := bufio.NewWriter(gz)
+	w := &sessionWriter{file: file, gz: gz, buf: buf, enc: json.NewEncoder(buf), started: started}
+	w.enc.SetEscapeHTML(false)
+	header.Format = sessionFormat
+	header.Version = sessionVersion
+	header.StartedAt = started.UTC().Format(time.RFC3339Nano)
+	if err := w.enc.Encode(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// write appends msg and returns how many messages the session now holds.
+func (w *sessionWriter) write(msg *nats.Msg, at time.Time) (int, error) {
+	rec := sessionMessage{Subject: msg.Subject, Reply: msg.Reply}
+	if len(msg.Header) > 0 {
+		rec.Header = msg.Header
+	}
+	if utf8.Valid(msg.Data) {
+		rec.Text = string(msg.Data)
+	} else {
+		rec.Data = msg.Data
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.count, w.err
+	}
+	// Offsets are taken under the lock so they stay monotonic in file order.
+	rec.OffsetNS = max(0, at.Sub(w.started).Nanoseconds())
+	if w.err = w.enc.Encode(rec); w.err != nil {
+		return w.count, w.err
+	}
+	w.count++
+	return w.count, nil
+}
+
+func (w *sessionWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.err
+	if flushErr := w.buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if gzErr := w.gz.Close(); err == nil {
+		err = gzErr
+	}
+	if fileErr := w.file.Close(); err == nil {
+		err = fileErr
+	}
+	return err
+}
+
+func readSession(path string) (sessionHeader, []sessionMessage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return sessionHeader{}, nil, err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return sessionHeader{}, nil, fmt.Errorf("%s is not a tap session: %w", path, err)
+	}
+	defer gz.Close()
+	dec := json.NewDecoder(gz)
+	var header sessionHeader
+	if err := dec.Decode(&header); err != nil || header.Format != sessionFormat {
+		return sessionHeader{}, nil, fmt.Errorf("%s is not a tap session", path)
+	}
+	if header.Version < 1 || header.Version > sessionVersion {
+		return sessionHeader{}, nil, fmt.Errorf("unsupported tap session version %d", header.Version)
+	}
+	messages := []sessionMessage{}
+	for {
+		var msg sessionMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				break
+			}
+			// A recording cut off mid-write still replays up to the last full line.
+			if err == io.ErrUnexpectedEOF || strings.Contains(err.Error(), "unexpected EOF") {
+				fmt.Fprintf(os.Stderr, "TAP> warning: %s is truncated after %d messages\n", path, len(messages))
+				break
+			}
+			return header, messages, err
+		}
+		messages = append(messages, msg)
+	}
+	return header, messages, nil
+}
+
+// Record captures the selected subjects into a session file until
+// interrupted, Duration elapses or MaxMessages are captured.
+func Record(opts RecordOptions) error {
+	subjects := parseSubjects(opts.Subjects)
+	if len(subjects) == 0 {
+		return fmt.Errorf("no subjects configured")
+	}
+	output := strings.TrimSpace(opts.Output)
+	if output == "" {
+		output = fmt.Sprintf("tap-%s.jsonl.gz", time.Now().UTC().Format("20060102T150405Z"))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+
+	nc, err := nats.Connect(strings.TrimSpace(opts.Upstream),
+		nats.Name(strings.TrimSpace(opts.Name)),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(opts.ReconnectWait),
+		nats.Timeout(1200*time.Millisecond),
+	)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	writer, err := createSession(output, sessionHeader{Upstream: strings.TrimSpace(opts.Upstream), Subjects: subjects}, time.Now())
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	var doneOnce sync.Once
+	for _, subject := range subjects {
+		_, err := nc.Subscribe(subject, func(msg *nats.Msg) {
+			count, err := writer.write(msg, time.Now())
+			if err != nil || (opts.MaxMessages > 0 && count >= opts.MaxMessages) {
+				doneOnce.Do(func() { close(done) })
+			}
+		})
+		if err != nil {
+			writer.Close()
+			return fmt.Errorf("subscribe failed for %q: %w", subject, err)
+		}
+	}
+	if err := nc.FlushTimeout(1200 * time.Millisecond); err != nil {
+		fmt.Fprintf(os.Stderr, "TAP> warning: initial nats flush pending (%v)\n", err)
+	}
+	fmt.Fprintf(os.Stderr, "TAP> recording %s to %s\n", strings.Join(subjects, ","), output)
+
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
+	// Drain delivers anything already buffered before the file is closed.
+	_ = nc.Drain()
+	for nc.IsDraining() {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "TAP> recorded %d messages in %s\n", writer.count, time.Since(writer.started).Truncate(time.Millisecond))
+	return nil
+}
+
+// Replay republishes a session into Target, or into a fresh embedded NATS
+// when Target is empty, keeping the recorded spacing divided by Speed.
+// Speed 0 replays as fast as possible.
+func Replay(opts ReplayOptions) error {
+	header, messages, err := readSession(strings.TrimSpace(opts.Input))
+	if err != nil {
+		return err
+	}
+	if filter := parseSubjects(opts.Subjects); len(filter) > 0 {
+		messages = filterSessionMessages(messages, filter)
+	}
+	if opts.Speed < 0 {
+		return fmt.Errorf("speed must be >= 0")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var nc *nats.Conn
+	if target := strings.TrimSpace(opts.Target); target != "" {
+		nc, err = nats.Connect(target, nats.Name("dialtone-tap-replay"), nats.Timeout(1200*time.Millisecond))
+		if err != nil {
+			return err
+		}
+		defer nc.Close()
+	} else {
+		embedded, err := logs.StartEmbeddedNATS()
+		if err != nil {
+			return err
+		}
+		defer embedded.Close()
+		nc = embedded.Conn()
+		fmt.Fprintf(os.Stderr, "TAP> embedded NATS listening on %s\n", embedded.URL())
+	}
+	fmt.Fprintf(os.Stderr, "TAP> replaying %d messages recorded %s from %s\n", len(messages), header.StartedAt, firstNonEmpty(header.Upstream, "unknown upstream"))
+
+	if opts.Wait > 0 {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.Wait):
+		}
+	}
+	for {
+		if err := replayMessages(ctx, nc, messages, opts.Speed, opts.Quiet); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if !opts.Loop {
+			break
+		}
+	}
+	if err := nc.FlushTimeout(2 * time.Second); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "TAP> replay complete")
+	if opts.Hold {
+		<-ctx.Done()
+	}
+	return nil
+}
+
+func replayMessages(ctx context.Context, nc *nats.Conn, messages []sessionMessage, speed float64, quiet bool) error {
+	start := time.Now()
+	for _, rec := range messages {
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(rec.OffsetNS) / speed))
+			if wait := time.Until(due); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		msg := &nats.Msg{Subject: rec.Subject, Reply: rec.Reply, Data: rec.payload()}
+		if len(rec.Header) > 0 {
+			msg.Header = nats.Header(rec.Header)
+		}
+		if err := nc.PublishMsg(msg); err != nil {
+			return fmt.Errorf("publish %s: %w", rec.Subject, err)
+		}
+		if !quiet {
+			printMessage(msg, false, true)
+		}
+	}
+	return nil
+}
+
+func filterSessionMessages(messages []sessionMessage, patterns []string) []sessionMessage {
+	out := make([]sessionMessage, 0, len(messages))
+	for _, msg := range messages {
+		for _, pattern := range patterns {
+			if subjectMatches(pattern, msg.Subject) {
+				out = append(out, msg)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// subjectMatches applies NATS wildcard rules: * matches one token, > the rest.
+func subjectMatches(pattern, subject string) bool {
+	pt := strings.Split(pattern, ".")
+	st := strings.Split(subject, ".")
+	for i, token := range pt {
+		if token == ">" {
+			return len(st) > i
+		}
+		if i >= len(st) || (token != "*" && token != st[i]) {
+			return false
+		}
+	}
+	return len(pt) == len(st)
+}
@@ -0,0 +1,131 @@
+package tap
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	logs "dialtone/dev/plugins/logs/src_v1/go"
+	"github.com/nats-io/nats.go"
+)
+
+func TestSessionRoundTripPreservesHeadersPayloadsAndTiming(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl.gz")
+	start := time.Now()
+	writer, err := createSession(path, sessionHeader{Upstream: "nats://rover:4222", Subjects: []string{"repl.>"}}, start)
+	if err != nil {
+		t.Fatalf("createSession returned error: %v", err)
+	}
+	frame := &nats.Msg{Subject: "repl.room.index", Data: []byte(`{"type":"chat","from":"robot","message":"hi","timestamp":"now"}`), Header: nats.Header{"Nats-Msg-Id": []string{"a1"}}}
+	binary := &nats.Msg{Subject: "robot.telemetry", Data: []byte{0x00, 0xFF, 0x10}}
+	if _, err := writer.write(frame, start.Add(10*time.Millisecond)); err != nil {
+		t.Fatalf("write returned error: %v", err)
+	}
+	if count, err := writer.write(binary, start.Add(60*time.Millisecond)); err != nil || count != 2 {
+		t.Fatalf("write = %d, %v", count, err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	header, messages, err := readSession(path)
+	if err != nil {
+		t.Fatalf("readSession returned error: %v", err)
+	}
+	if header.Upstream != "nats://rover:4222" || len(messages) != 2 {
+		t.Fatalf("unexpected session: %+v %+v", header, messages)
+	}
+	if messages[0].Text == "" || len(messages[1].Data) == 0 {
+		t.Fatalf("expected text and encoded binary payloads, got %+v", messages)
+	}
+
+	embedded, err := logs.StartEmbeddedNATS()
+	if err != nil {
+		t.Fatalf("StartEmbeddedNATS returned error: %v", err)
+	}
+	defer embedded.Close()
+	sub, err := embedded.Conn().SubscribeSync(">")
+	if err != nil {
+		t.Fatalf("SubscribeSync returned error: %v", err)
+	}
+	if err := embedded.Conn().Flush(); err != nil {
+		t.Fatalf("Flush returned error: %v", err)
+	}
+
+	replayStart := time.Now()
+	if err := replayMessages(context.Background(), embedded.Conn(), filterSessionMessages(messages, []string{"repl.*.*", "robot.>"}), 1, true); err != nil {
+		t.Fatalf("replayMessages returned error: %v", err)
+	}
+	first, err := sub.NextMsg(2 * time.Second)
+	if err != nil {
+		t.Fatalf("NextMsg returned error: %v", err)
+	}
+	second, err := sub.NextMsg(2 * time.Second)
+	if err != nil {
+		t.Fatalf("NextMsg returned error: %v", err)
+	}
+	if first.Subject != frame.Subject || !bytes.Equal(first.Data, frame.Data) || first.Header.Get("Nats-Msg-Id") != "a1" {
+		t.Fatalf("unexpected first replayed message: %s %q %v", first.Subject, first.Data, first.Header)
+	}
+	if second.Subject != binary.Subject || !bytes.Equal(second.Data, binary.Data) {
+		t.Fatalf("unexpected second replayed message: %s %v", second.Subject, second.Data)
+	}
+	if elapsed := time.Since(replayStart); elapsed < 50*time.Millisecond {
+		t.Fatalf("replay ignored recorded timing, finished in %s", elapsed)
+	}
+}
+
+func TestSessionKeepsPayloadBytesVerbatim(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl.gz")
+	start := time.Now()
+	writer, err := createSession(path, sessionHeader{Subjects: []string{">"}}, start)
+	if err != nil {
+		t.Fatalf("createSession returned error: %v", err)
+	}
+	payloads := [][]byte{
+		[]byte("{\n  \"message\": \"<b>&</b>\",\n  \"n\" : 1\n}\n"),
+		[]byte("plain <text> & more"),
+	}
+	for i, data := range payloads {
+		if _, err := writer.write(&nats.Msg{Subject: "repl.room.index", Data: data}, start.Add(time.Duration(i)*time.Millisecond)); err != nil {
+			t.Fatalf("write returned error: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	header, messages, err := readSession(path)
+	if err != nil {
+		t.Fatalf("readSession returned error: %v", err)
+	}
+	if header.Version != sessionVersion || len(messages) != len(payloads) {
+		t.Fatalf("unexpected session: %+v %+v", header, messages)
+	}
+	for i, data := range payloads {
+		if got := messages[i].payload(); !bytes.Equal(got, data) {
+			t.Fatalf("payload %d changed: got %q want %q", i, got, data)
+		}
+	}
+}
+
+func TestSubjectMatches(t *testing.T) {
+	cases := []struct {
+		pattern string
+		subject string
+		want    bool
+	}{
+		{"repl.>", "repl.room.index", true},
+		{"repl.>", "repl", false},
+		{"repl.*", "repl.room", true},
+		{"repl.*", "repl.room.index", false},
+		{"robot.telemetry", "robot.telemetry", true},
+		{"robot.telemetry", "robot.heartbeat", false},
+	}
+	for _, tc := range cases {
+		if got := subjectMatches(tc.pattern, tc.subject); got != tc.want {
+			t.Fatalf("subjectMatches(%q, %q) = %v, want %v", tc.pattern, tc.subject, got, tc.want)
+		}
+	}
+}
@@ -72,4 +72,5 @@ func printUsage() {
 	logs.Info("  hang")
 	logs.Info("  heartbeat --name demo [--mode show|stop|resume]")
 	logs.Info("  shutdown --name demo")
+	logs.Info("  scenario --file faults.scenario | --script 'at 0s flood; at 2s exit --code 3' [--name demo] [--dry-run]")
 }
@@ -54,6 +54,8 @@ func Run(args []string) error {
 		return RunShutdown(args[1:])
 	case "daemon":
 		return RunDaemon(args[1:])
+	case "scenario":
+		return RunScenario(args[1:])
 	case "help", "-h", "--help":
 		return nil
 	default:
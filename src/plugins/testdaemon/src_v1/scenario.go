@@ -0,0 +1,539 @@
+package testdaemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	configv1 "dialtone/dev/plugins/config/src_v1/go"
+	logs "dialtone/dev/plugins/logs/src_v1/go"
+	"github.com/nats-io/nats.go"
+)
+
+// A scenario is a list of timed fault steps, one per line (or separated by
+// ';' in --script):
+//
+//	at 0s ignore-sigterm
+//	at 500ms flood --lines 5000
+//	at 1s alloc --step 16MB --every 250ms --max 128MB
+//	at 2s heartbeat-stop
+//	at 3s nats-drop --for 2s
+//	at 6s exit --code 17
+//
+// Steps start at their offset from scenario start and run concurrently.
+type scenarioStep struct {
+	Line   int
+	At     time.Duration
+	Action string
+	Args   []string
+
+	Lines  int
+	Size   int
+	Text   string
+	Delay  time.Duration
+	Count  int
+	Detach bool
+	Step   int64
+	Every  time.Duration
+	Max    int64
+	For    time.Duration
+	Code   int
+}
+
+const scenarioActions = "log, flood, slow-write, ignore-sigterm, leak-children, alloc, free, heartbeat-stop, heartbeat-resume, nats-drop, hold, exit, panic, crash"
+
+func parseScenario(text string) ([]scenarioStep, error) {
+	steps := []scenarioStep{}
+	for i, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields, err := splitScenarioFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("scenario line %d: %w", i+1, err)
+		}
+		if len(fields) < 3 || fields[0] != "at" {
+			return nil, fmt.Errorf("scenario line %d: expected `at <offset> <action> [flags]`", i+1)
+		}
+		at, err := time.ParseDuration(fields[1])
+		if err != nil || at < 0 {
+			return nil, fmt.Errorf("scenario line %d: invalid offset %q", i+1, fields[1])
+		}
+		step := scenarioStep{Line: i + 1, At: at, Action: fields[2], Args: fields[3:]}
+		if err := step.parseFlags(); err != nil {
+			return nil, fmt.Errorf("scenario line %d: %w", i+1, err)
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("scenario has no steps")
+	}
+	return steps, nil
+}
+
+func (s *scenarioStep) parseFlags() error {
+	fs := flag.NewFlagSet(s.Action, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	switch s.Action {
+	case "log":
+		fs.StringVar(&s.Text, "text", "marker", "Text to log")
+	case "flood":
+		fs.IntVar(&s.Lines, "lines", 10000, "Lines to write")
+		fs.IntVar(&s.Size, "size", 120, "Bytes per line")
+	case "slow-write":
+		fs.StringVar(&s.Text, "text", "slow output", "Text written one byte at a time")
+		fs.DurationVar(&s.Delay, "delay", 100*time.Millisecond, "Delay between bytes")
+	case "leak-children":
+		fs.IntVar(&s.Count, "count", 1, "Children to spawn")
+		fs.BoolVar(&s.Detach, "detach", false, "Start children in their own session")
+	case "alloc":
+		stepRaw := fs.String("step", "16MB", "Bytes per allocation")
+		maxRaw := fs.String("max", "", "Stop after this many bytes (default: one step)")
+		fs.DurationVar(&s.Every, "every", time.Second, "Delay between allocations")
+		if err := fs.Parse(s.Args); err != nil {
+			return err
+		}
+		var err error
+		if s.Step, err = parseByteSize(*stepRaw); err != nil || s.Step <= 0 {
+			return fmt.Errorf("invalid --step %q", *stepRaw)
+		}
+		s.Max = s.Step
+		if strings.TrimSpace(*maxRaw) != "" {
+			if s.Max, err = parseByteSize(*maxRaw); err != nil || s.Max < s.Step {
+				return fmt.Errorf("invalid --max %q", *maxRaw)
+			}
+		}
+		return nil
+	case "nats-drop":
+		fs.DurationVar(&s.For, "for", 0, "Reconnect after this long (0 stays disconnected)")
+	case "exit":
+		fs.IntVar(&s.Code, "code", 0, "Exit code")
+	case "ignore-sigterm", "free", "heartbeat-stop", "heartbeat-resume", "hold", "panic", "crash":
+	default:
+		return fmt.Errorf("unknown action %q (want one of: %s)", s.Action, scenarioActions)
+	}
+	if err := fs.Parse(s.Args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%s does not accept positional arguments", s.Action)
+	}
+	return nil
+}
+
+func splitScenarioFields(line string) ([]string, error) {
+	fields := []string{}
+	var cur strings.Builder
+	quote := rune(0)
+	inField := false
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, cur.String())
+				cur.Reset()
+				inField = false
+			}
+		default:
+			cur.WriteRune(r)
+			inField = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inField {
+		fields = append(fields, cur.String())
+	}
+	return fields, nil
+}
+
+func parseByteSize(raw string) (int64, error) {
+	raw = strings.ToUpper(strings.TrimSpace(raw))
+	mult := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		mult   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(raw, unit.suffix) {
+			raw = strings.TrimSuffix(raw, unit.suffix)
+			mult = unit.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * mult, nil
+}
+
+type scenarioRunner struct {
+	name     string
+	paths    servicePaths
+	interval time.Duration
+	natsURL  string
+	done     chan error
+
+	mu         sync.Mutex
+	state      serviceState
+	beatsOff   bool
+	ignoreTerm bool
+	held       [][]byte
+	heldBytes  int64
+	nc         *nats.Conn
+}
+
+func RunScenario(args []string) error {
+	fs := flag.NewFlagSet("testdaemon-scenario", flag.ContinueOnError)
+	file := fs.String("file", "", "Scenario file")
+	script := fs.String("script", "", "Inline scenario, steps separated by ';'")
+	name := fs.String("name", "scenario", "Service name for state and heartbeats")
+	heartbeatInterval := fs.Duration("heartbeat-interval", defaultHeartbeatInterval, "Heartbeat interval")
+	natsURL := fs.String("nats-url", "", "NATS URL for heartbeats (default: REPL NATS when the scenario uses nats-drop)")
+	dryRun := fs.Bool("dry-run", false, "Print the parsed steps and exit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	steps, err := loadScenario(*file, *script)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		for _, step := range steps {
+			logs.Raw("testdaemon> step line=%d at=%s action=%s args=%s", step.Line, step.At, step.Action, strings.Join(step.Args, " "))
+		}
+		return nil
+	}
+	return withCommandSession("scenario", *name, func(session *commandSession) error {
+		return runScenarioSteps(*name, steps, *heartbeatInterval, *natsURL)
+	})
+}
+
+func loadScenario(file, script string) ([]scenarioStep, error) {
+	file = strings.TrimSpace(file)
+	script = strings.TrimSpace(script)
+	switch {
+	case file != "" && script != "":
+		return nil, fmt.Errorf("use either --file or --script, not both")
+	case file != "":
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return parseScenario(string(raw))
+	case script != "":
+		return parseScenario(strings.ReplaceAll(script, ";", "\n"))
+	default:
+		return nil, fmt.Errorf("scenario requires --file or --script")
+	}
+}
+
+func runScenarioSteps(name string, steps []scenarioStep, heartbeatInterval time.Duration, natsURL string) error {
+	paths, err := resolveServicePaths(name)
+	if err != nil {
+		return err
+	}
+	_ = os.Remove(paths.shutdownRequestPath)
+	now := time.Now().UTC()
+	r := &scenarioRunner{
+		name:     sanitizeName(name),
+		paths:    paths,
+		interval: heartbeatInterval,
+		natsURL:  strings.TrimSpace(natsURL),
+		done:     make(chan error, 1),
+		state: serviceState{
+			Name:              sanitizeName(name),
+			Host:              currentHostName(),
+			PID:               os.Getpid(),
+			StartedAt:         formatTimestamp(now),
+			UpdatedAt:         formatTimestamp(now),
+			LastHeartbeat:     formatTimestamp(now),
+			HeartbeatInterval: heartbeatInterval.String(),
+			Running:           true,
+			LogPath:           paths.logPath,
+		},
+	}
+	hold := false
+	for _, step := range steps {
+		if step.Action == "nats-drop" && r.natsURL == "" {
+			r.natsURL = configv1.ResolveREPLNATSURL()
+		}
+		hold = hold || step.Action == "hold"
+	}
+	if r.natsURL != "" {
+		if err := r.connectNATS(); err != nil {
+			return err
+		}
+	}
+	if err := r.writeState(); err != nil {
+		return err
+	}
+	logs.Raw("testdaemon> scenario started name=%s pid=%d steps=%d", r.name, r.state.PID, len(steps))
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, serviceSignals()...)
+	defer signal.Stop(sigCh)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for _, step := range steps {
+		wg.Add(1)
+		go func(step scenarioStep) {
+			defer wg.Done()
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Until(start.Add(step.At))):
+			}
+			r.apply(step, stop)
+		}(step)
+	}
+	allDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(allDone)
+	}()
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	poll := time.NewTicker(250 * time.Millisecond)
+	defer poll.Stop()
+
+	var result error
+	reason := ""
+	for reason == "" {
+		select {
+		case sig := <-sigCh:
+			r.mu.Lock()
+			ignore := r.ignoreTerm && sig == syscall.SIGTERM
+			r.mu.Unlock()
+			if ignore {
+				logs.Raw("testdaemon> ignoring signal=%s", sig.String())
+				continue
+			}
+			reason = "signal:" + sig.String()
+		case result = <-r.done:
+			reason = "scenario-exit"
+		case <-allDone:
+			allDone = nil
+			if !hold {
+				reason = "scenario-complete"
+			}
+		case <-poll.C:
+			if fileExists(paths.shutdownRequestPath) {
+				reason = "shutdown-requested"
+			}
+		case <-ticker.C:
+			r.heartbeat()
+		}
+	}
+	close(stop)
+
+	r.mu.Lock()
+	r.state.Running = false
+	r.state.ExitReason = reason
+	if exitErr, ok := result.(*ExitStatusError); ok {
+		r.state.ExitCode = exitErr.Code
+	}
+	if r.nc != nil {
+		r.nc.Close()
+	}
+	r.mu.Unlock()
+	if err := r.writeState(); err != nil {
+		return err
+	}
+	logs.Raw("testdaemon> scenario stopping name=%s reason=%s", r.name, reason)
+	return result
+}
+
+func (r *scenarioRunner) writeState() error {
+	r.mu.Lock()
+	state := r.state
+	r.mu.Unlock()
+	state.UpdatedAt = formatTimestamp(time.Now())
+	return writeServiceState(r.paths, state)
+}
+
+func (r *scenarioRunner) heartbeat() {
+	r.mu.Lock()
+	if r.beatsOff {
+		r.mu.Unlock()
+		return
+	}
+	at := formatTimestamp(time.Now())
+	r.state.LastHeartbeat = at
+	nc := r.nc
+	r.mu.Unlock()
+	if err := r.writeState(); err != nil {
+		logs.Raw("testdaemon> heartbeat state write failed: %v", err)
+	}
+	if nc != nil && nc.IsConnected() {
+		payload, _ := json.Marshal(map[string]any{"name": r.name, "pid": os.Getpid(), "at": at})
+		_ = nc.Publish("testdaemon."+r.name+".heartbeat", payload)
+	}
+}
+
+func (r *scenarioRunner) connectNATS() error {
+	nc, err := nats.Connect(r.natsURL, nats.Name("testdaemon-"+r.name), nats.Timeout(2*time.Second))
+	if err != nil {
+		return fmt.Errorf("scenario nats connect %s: %w", r.natsURL, err)
+	}
+	r.mu.Lock()
+	r.nc = nc
+	r.mu.Unlock()
+	logs.Raw("testdaemon> nats connected url=%s", r.natsURL)
+	return nil
+}
+
+func (r *scenarioRunner) apply(step scenarioStep, stop <-chan struct{}) {
+	logs.Raw("testdaemon> step line=%d at=%s action=%s", step.Line, step.At, step.Action)
+	switch step.Action {
+	case "log":
+		logs.Raw("testdaemon> %s", step.Text)
+	case "flood":
+		w := bufio.NewWriterSize(os.Stdout, 64*1024)
+		pad := strings.Repeat("x", max(0, step.Size-32))
+		for i := 1; i <= step.Lines; i++ {
+			fmt.Fprintf(w, "testdaemon> flood %d/%d %s\n", i, step.Lines, pad)
+		}
+		_ = w.Flush()
+	case "slow-write":
+		for _, b := range []byte(step.Text) {
+			select {
+			case <-stop:
+				return
+			case <-time.After(step.Delay):
+			}
+			_, _ = os.Stdout.Write([]byte{b})
+		}
+		_, _ = os.Stdout.Write([]byte("\n"))
+	case "ignore-sigterm":
+		r.mu.Lock()
+		r.ignoreTerm = true
+		r.mu.Unlock()
+	case "leak-children":
+		r.leakChildren(step)
+	case "alloc":
+		r.alloc(step, stop)
+	case "free":
+		r.mu.Lock()
+		r.held = nil
+		r.heldBytes = 0
+		r.mu.Unlock()
+		runtime.GC()
+		debug.FreeOSMemory()
+		logs.Raw("testdaemon> memory released")
+	case "heartbeat-stop", "heartbeat-resume":
+		r.mu.Lock()
+		r.beatsOff = step.Action == "heartbeat-stop"
+		r.mu.Unlock()
+	case "nats-drop":
+		r.mu.Lock()
+		nc := r.nc
+		r.nc = nil
+		r.mu.Unlock()
+		if nc == nil {
+			logs.Raw("testdaemon> nats already disconnected")
+			return
+		}
+		nc.Close()
+		logs.Raw("testdaemon> nats dropped for=%s", step.For)
+		if step.For <= 0 {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(step.For):
+		}
+		if err := r.connectNATS(); err != nil {
+			logs.Raw("testdaemon> nats reconnect failed: %v", err)
+		}
+	case "hold":
+	case "exit":
+		var err error
+		if step.Code != 0 {
+			err = &ExitStatusError{Code: step.Code, Message: fmt.Sprintf("testdaemon scenario exit code=%d", step.Code)}
+		}
+		select {
+		case r.done <- err:
+		default:
+		}
+	case "panic":
+		panic("testdaemon scenario panic requested")
+	case "crash":
+		_ = killProcess(os.Getpid())
+	}
+}
+
+func (r *scenarioRunner) leakChildren(step scenarioStep) {
+	exe, err := os.Executable()
+	if err != nil {
+		logs.Raw("testdaemon> leak-children failed: %v", err)
+		return
+	}
+	for i := 0; i < step.Count; i++ {
+		cmd := exec.Command(exe, "src_v1", "hang")
+		cmd.Env = append(os.Environ(), "DIALTONE_TESTDAEMON_CHILD=1")
+		if step.Detach {
+			configureDetachedCommand(cmd)
+		}
+		if err := cmd.Start(); err != nil {
+			logs.Raw("testdaemon> leak-children failed: %v", err)
+			return
+		}
+		go func() { _ = cmd.Wait() }()
+		r.mu.Lock()
+		r.state.Children = append(r.state.Children, cmd.Process.Pid)
+		r.mu.Unlock()
+		logs.Raw("testdaemon> leaked child pid=%d detached=%t", cmd.Process.Pid, step.Detach)
+	}
+	if err := r.writeState(); err != nil {
+		logs.Raw("testdaemon> state write failed: %v", err)
+	}
+}
+
+func (r *scenarioRunner) alloc(step scenarioStep, stop <-chan struct{}) {
+	for allocated := int64(0); allocated < step.Max; allocated += step.Step {
+		if allocated > 0 {
+			select {
+			case <-stop:
+				return
+			case <-time.After(step.Every):
+			}
+		}
+		block := make([]byte, step.Step)
+		// Touch every page so the allocation shows up in RSS.
+		for i := 0; i < len(block); i += 4096 {
+			block[i] = 1
+		}
+		r.mu.Lock()
+		r.held = append(r.held, block)
+		r.heldBytes += step.Step
+		total := r.heldBytes
+		r.mu.Unlock()
+		logs.Raw("testdaemon> allocated total_mb=%d", total>>20)
+	}
+}
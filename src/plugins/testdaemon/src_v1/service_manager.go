@@ -170,13 +170,14 @@ func RunService(args []string) error {
 	name := fs.String("name", "demo", "Service name")
 	heartbeatInterval := fs.Duration("heartbeat-interval", defaultHeartbeatInterval, "Heartbeat interval")
 	timeout := fs.Duration("timeout", 10*time.Second, "Wait timeout")
+	scenario := fs.String("scenario", "", "Run the service from a scenario file")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
 	switch strings.TrimSpace(*mode) {
 	case "start":
-		return runServiceStart(*name, *heartbeatInterval, *timeout)
+		return runServiceStart(*name, *heartbeatInterval, *timeout, *scenario)
 	case "status":
 		return runServiceStatus(*name)
 	case "stop":
@@ -186,7 +187,7 @@ func RunService(args []string) error {
 	}
 }
 
-func runServiceStart(name string, heartbeatInterval time.Duration, timeout time.Duration) error {
+func runServiceStart(name string, heartbeatInterval time.Duration, timeout time.Duration, scenario string) error {
 	paths, err := resolveServicePaths(name)
 	if err != nil {
 		return err
@@ -212,17 +213,27 @@ func runServiceStart(name string, heartbeatInterval time.Duration, timeout time.
 	}
 	defer logFile.Close()
 
-	exe, err := os.Executable()
-	if err != nil {
-		return err
-	}
-	cmd := exec.Command(
-		exe,
+	daemonArgs := []string{
 		"src_v1",
 		"daemon",
 		"--name", sanitizeName(name),
 		"--heartbeat-interval", heartbeatInterval.String(),
-	)
+	}
+	if scenario = strings.TrimSpace(scenario); scenario != "" {
+		if _, err := loadScenario(scenario, ""); err != nil {
+			return err
+		}
+		if scenario, err = filepath.Abs(scenario); err != nil {
+			return err
+		}
+		daemonArgs = append(daemonArgs, "--scenario", scenario)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, daemonArgs...)
 	cmd.Stdout = logFile
 	cmd.Stderr = logFile
 	cmd.Stdin = nil
@@ -389,9 +400,17 @@ func RunDaemon(args []string) error {
 	fs := flag.NewFlagSet("testdaemon-daemon", flag.ContinueOnError)
 	name := fs.String("name", "demo", "Service name")
 	heartbeatInterval := fs.Duration("heartbeat-interval", defaultHeartbeatInterval, "Heartbeat interval")
+	scenario := fs.String("scenario", "", "Scenario file to run instead of the plain heartbeat loop")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
+	if strings.TrimSpace(*scenario) != "" {
+		steps, err := loadScenario(*scenario, "")
+		if err != nil {
+			return err
+		}
+		return runScenarioSteps(*name, steps, *heartbeatInterval, "")
+	}
 	return runDaemonLoop(*name, *heartbeatInterval)
 }
 
@@ -36,6 +36,7 @@ type serviceState struct {
 	Health            string `json:"health,omitempty"`
 	ExitCode          int    `json:"exit_code,omitempty"`
 	ExitReason        string `json:"exit_reason,omitempty"`
+	Children          []int  `json:"children,omitempty"`
 	LogPath           string `json:"log_path,omitempty"`
 }
 
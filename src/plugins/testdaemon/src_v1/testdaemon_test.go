@@ -2,6 +2,7 @@ package testdaemon
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"os"
 	"os/exec"
@@ -9,10 +10,12 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	configv1 "dialtone/dev/plugins/config/src_v1/go"
+	logs "dialtone/dev/plugins/logs/src_v1/go"
 )
 
 var (
@@ -201,3 +204,156 @@ func parseOutputValue(output string, key string) string {
 	}
 	return ""
 }
+
+func TestParseScenarioValidatesSteps(t *testing.T) {
+	steps, err := parseScenario("# faults\nat 0s ignore-sigterm\nat 250ms alloc --step 1MB --max 4MB --every 10ms\nat 1s log --text \"hello world\"\nat 2s exit --code 3\n")
+	if err != nil {
+		t.Fatalf("parseScenario returned error: %v", err)
+	}
+	if len(steps) != 4 || steps[1].Max != 4<<20 || steps[2].Text != "hello world" || steps[3].Code != 3 || steps[3].Line != 5 {
+		t.Fatalf("unexpected steps: %+v", steps)
+	}
+	for _, bad := range []string{"at 1s teleport", "flood", "at soon exit", "at 1s exit extra", "at 1s alloc --step 4MB --max 1MB", "at 1s log --text \"open"} {
+		if _, err := parseScenario(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestScenarioCombinesFaultsAndExitsWithRequestedCode(t *testing.T) {
+	home := t.TempDir()
+	script := "at 0s flood --lines 2000 --size 64; at 0s leak-children --count 2; at 100ms heartbeat-stop; at 200ms alloc --step 1MB --max 3MB --every 20ms; at 1200ms exit --code 23"
+	out, err := runFixture(t, home, "src_v1", "scenario", "--name", "faulty", "--heartbeat-interval", "100ms", "--script", script)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 23 {
+		t.Fatalf("scenario exit = %v, want code 23\n%s", err, out)
+	}
+	if got := strings.Count(out, "testdaemon> flood "); got != 2000 {
+		t.Fatalf("flood wrote %d lines, want 2000", got)
+	}
+	if !strings.Contains(out, "allocated total_mb=3") {
+		t.Fatalf("scenario output missing allocation progress:\n%s", out)
+	}
+
+	statusOut, err := runFixture(t, home, "src_v1", "service", "--mode", "status", "--name", "faulty")
+	if err != nil {
+		t.Fatalf("service status failed: %v\n%s", err, statusOut)
+	}
+	if !strings.Contains(statusOut, "exit_reason=scenario-exit") {
+		t.Fatalf("status missing scenario exit reason:\n%s", statusOut)
+	}
+	paths := scenarioTestPaths(t, home, "faulty")
+	raw, err := os.ReadFile(paths)
+	if err != nil {
+		t.Fatalf("read state failed: %v", err)
+	}
+	var state serviceState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		t.Fatalf("decode state failed: %v", err)
+	}
+	if len(state.Children) != 2 || state.ExitCode != 23 {
+		t.Fatalf("unexpected scenario state: %+v", state)
+	}
+	// Heartbeats stopped at 100ms, so the last one is well before exit.
+	if gap := parseRFC3339(state.UpdatedAt).Sub(parseRFC3339(state.LastHeartbeat)); gap < 800*time.Millisecond {
+		t.Fatalf("heartbeats kept running after heartbeat-stop (gap %s)", gap)
+	}
+	for _, pid := range state.Children {
+		if !processAlive(pid) {
+			t.Fatalf("leaked child %d is not running", pid)
+		}
+		_ = killProcess(pid)
+	}
+}
+
+func TestScenarioIgnoresSIGTERMUntilShutdown(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGTERM is not deliverable on windows")
+	}
+	home := t.TempDir()
+	cmd := exec.Command(fixtureBinary(t), "src_v1", "scenario", "--name", "stubborn", "--script", "at 0s ignore-sigterm; at 0s hold")
+	cmd.Env = fixtureEnv(t, home)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("scenario start failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	time.Sleep(500 * time.Millisecond)
+	_ = cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case err := <-done:
+		t.Fatalf("scenario exited after SIGTERM: %v\n%s", err, out.String())
+	case <-time.After(700 * time.Millisecond):
+	}
+
+	shutdownOut, err := runFixture(t, home, "src_v1", "shutdown", "--name", "stubborn", "--timeout", "5s")
+	if err != nil {
+		t.Fatalf("shutdown failed: %v\n%s", err, shutdownOut)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("scenario exited with error after shutdown: %v\n%s", err, out.String())
+		}
+	case <-time.After(5 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Fatalf("scenario did not exit after shutdown request")
+	}
+	if !strings.Contains(out.String(), "ignoring signal=terminated") {
+		t.Fatalf("scenario output missing ignored signal:\n%s", out.String())
+	}
+}
+
+func scenarioTestPaths(t *testing.T, home, name string) string {
+	t.Helper()
+	return filepath.Join(home, ".dialtone", "testdaemon", "services", name, "state.json")
+}
+
+func TestScenarioNATSDropPausesHeartbeats(t *testing.T) {
+	embedded, err := logs.StartEmbeddedNATS()
+	if err != nil {
+		t.Fatalf("StartEmbeddedNATS returned error: %v", err)
+	}
+	defer embedded.Close()
+	sub, err := embedded.Conn().SubscribeSync("testdaemon.natsy.heartbeat")
+	if err != nil {
+		t.Fatalf("SubscribeSync returned error: %v", err)
+	}
+	if err := embedded.Conn().Flush(); err != nil {
+		t.Fatalf("Flush returned error: %v", err)
+	}
+
+	home := t.TempDir()
+	script := "at 400ms nats-drop --for 800ms; at 1800ms exit"
+	out, err := runFixture(t, home, "src_v1", "scenario", "--name", "natsy", "--heartbeat-interval", "100ms", "--nats-url", embedded.URL(), "--script", script)
+	if err != nil {
+		t.Fatalf("scenario failed: %v\n%s", err, out)
+	}
+	var last time.Time
+	maxGap := time.Duration(0)
+	count := 0
+	for {
+		msg, err := sub.NextMsg(200 * time.Millisecond)
+		if err != nil {
+			break
+		}
+		var beat struct {
+			At string `json:"at"`
+		}
+		if err := json.Unmarshal(msg.Data, &beat); err != nil {
+			t.Fatalf("decode heartbeat: %v", err)
+		}
+		at := parseRFC3339(beat.At)
+		if !last.IsZero() && at.Sub(last) > maxGap {
+			maxGap = at.Sub(last)
+		}
+		last = at
+		count++
+	}
+	if count < 6 || maxGap < 600*time.Millisecond {
+		t.Fatalf("expected heartbeats before and after a gap, got count=%d max gap=%s\n%s", count, maxGap, out)
+	}
+}
@@ -0,0 +1,249 @@
+package tsnet
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	logs "dialtone/dev/plugins/logs/src_v1/go"
+)
+
+// ACLPlan is the result of comparing the repo policy with the live one.
+type ACLPlan struct {
+	ETag     string          `json:"etag"`
+	Changes  []PolicyChange  `json:"changes"`
+	Problems []string        `json:"problems,omitempty"`
+	Tests    []ACLTestResult `json:"tests,omitempty"`
+}
+
+func (p ACLPlan) FailedTests() []ACLTestResult {
+	var out []ACLTestResult
+	for _, t := range p.Tests {
+		if !t.Passed {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// CheckACLPolicy validates desired and runs its tests without the API.
+func CheckACLPolicy(desired []byte) (ACLPlan, *ACLPolicy, error) {
+	policy, err := ParseACLPolicy(desired)
+	if err != nil {
+		return ACLPlan{}, nil, err
+	}
+	return ACLPlan{Problems: policy.Validate(), Tests: policy.RunTests()}, policy, nil
+}
+
+func PlanACL(client tailnetAPI, desired []byte) (ACLPlan, error) {
+	plan, policy, err := CheckACLPolicy(desired)
+	if err != nil {
+		return ACLPlan{}, err
+	}
+	live, err := client.GetPolicyFile()
+	if err != nil {
+		return ACLPlan{}, fmt.Errorf("fetch live policy failed: %w", err)
+	}
+	livePolicy, err := ParseACLPolicy(live.HuJSON)
+	if err != nil {
+		return ACLPlan{}, fmt.Errorf("live policy: %w", err)
+	}
+	plan.ETag = live.ETag
+	plan.Changes = DiffACLPolicy(livePolicy, policy)
+	return plan, nil
+}
+
+// ApplyACL pushes desired when it validates, its tests pass and it differs
+// from the live policy. The write is conditional on ifMatch, or on the ETag
+// read while planning when ifMatch is empty.
+func ApplyACL(client tailnetAPI, desired []byte, ifMatch string) (ACLPlan, error) {
+	plan, err := PlanACL(client, desired)
+	if err != nil {
+		return plan, err
+	}
+	if len(plan.Problems) > 0 {
+		return plan, fmt.Errorf("policy has %d validation problem(s)", len(plan.Problems))
+	}
+	if failed := plan.FailedTests(); len(failed) > 0 {
+		return plan, fmt.Errorf("policy has %d failing test(s)", len(failed))
+	}
+	etag := strings.TrimSpace(ifMatch)
+	if etag == "" {
+		etag = plan.ETag
+	} else if plan.ETag != "" && etag != plan.ETag {
+		return plan, ErrPolicyChanged
+	}
+	if len(plan.Changes) == 0 {
+		return plan, nil
+	}
+	written, err := client.SetPolicyFile(desired, etag)
+	if err != nil {
+		return plan, err
+	}
+	plan.ETag = written.ETag
+	return plan, nil
+}
+
+type aclFileOptions struct {
+	file     string
+	format   string
+	ifMatch  string
+	exitCode bool
+	yes      bool
+}
+
+func parseACLFileArgs(args []string) (aclFileOptions, error) {
+	opts := aclFileOptions{format: "text"}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--file":
+			if i+1 < len(args) {
+				opts.file = strings.TrimSpace(args[i+1])
+				i++
+			}
+		case "--format":
+			if i+1 < len(args) {
+				opts.format = strings.TrimSpace(args[i+1])
+				i++
+			}
+		case "--if-match":
+			if i+1 < len(args) {
+				opts.ifMatch = strings.TrimSpace(args[i+1])
+				i++
+			}
+		case "--exit-code":
+			opts.exitCode = true
+		case "--yes":
+			opts.yes = true
+		}
+	}
+	if opts.file == "" {
+		paths, err := ResolvePaths("")
+		if err != nil {
+			return opts, err
+		}
+		opts.file = paths.ACLPolicy
+	}
+	return opts, nil
+}
+
+func printACLPlan(plan ACLPlan, format string) error {
+	if format == "json" {
+		return printJSON(plan)
+	}
+	for _, problem := range plan.Problems {
+		logs.Raw("invalid: %s", problem)
+	}
+	for _, t := range plan.FailedTests() {
+		detail := t.Got
+		if t.Error != "" {
+			detail = t.Error
+		}
+		logs.Raw("test failed: %s -> %s want %s got %s", t.Src, t.Dst, t.Want, detail)
+	}
+	if len(plan.Tests) > 0 {
+		logs.Raw("tests: %d/%d passed", len(plan.Tests)-len(plan.FailedTests()), len(plan.Tests))
+	}
+	for _, change := range plan.Changes {
+		logs.Raw("%s", change.String())
+	}
+	if plan.ETag != "" {
+		if len(plan.Changes) == 0 {
+			logs.Raw("No changes. Live policy matches the repo (etag %s).", plan.ETag)
+		} else {
+			logs.Raw("Plan: %d change(s) against etag %s", len(plan.Changes), plan.ETag)
+		}
+	}
+	return nil
+}
+
+func runACLPlan(args []string) error {
+	opts, err := parseACLFileArgs(args)
+	if err != nil {
+		return err
+	}
+	desired, err := os.ReadFile(opts.file)
+	if err != nil {
+		return err
+	}
+	client, err := clientFromArgs(args)
+	if err != nil {
+		return err
+	}
+	plan, err := PlanACL(client, desired)
+	if err != nil {
+		return err
+	}
+	if err := printACLPlan(plan, opts.format); err != nil {
+		return err
+	}
+	if opts.exitCode && len(plan.Changes) > 0 {
+		return fmt.Errorf("tailnet policy drift: %d change(s)", len(plan.Changes))
+	}
+	return nil
+}
+
+func runACLTest(args []string) error {
+	opts, err := parseACLFileArgs(args)
+	if err != nil {
+		return err
+	}
+	desired, err := os.ReadFile(opts.file)
+	if err != nil {
+		return err
+	}
+	plan, _, err := CheckACLPolicy(desired)
+	if err != nil {
+		return err
+	}
+	if err := printACLPlan(plan, opts.format); err != nil {
+		return err
+	}
+	if len(plan.Problems) > 0 || len(plan.FailedTests()) > 0 {
+		return fmt.Errorf("%s: %d problem(s), %d failing test(s)", opts.file, len(plan.Problems), len(plan.FailedTests()))
+	}
+	return nil
+}
+
+func runACLApply(args []string) error {
+	opts, err := parseACLFileArgs(args)
+	if err != nil {
+		return err
+	}
+	desired, err := os.ReadFile(opts.file)
+	if err != nil {
+		return err
+	}
+	client, err := clientFromArgs(args)
+	if err != nil {
+		return err
+	}
+	if !opts.yes {
+		plan, err := PlanACL(client, desired)
+		if err != nil {
+			return err
+		}
+		if err := printACLPlan(plan, opts.format); err != nil {
+			return err
+		}
+		if len(plan.Changes) == 0 {
+			return nil
+		}
+		return fmt.Errorf("re-run with --yes --if-match %s to apply", plan.ETag)
+	}
+	plan, err := ApplyACL(client, desired, opts.ifMatch)
+	if printErr := printACLPlan(plan, opts.format); printErr != nil {
+		return printErr
+	}
+	if errors.Is(err, ErrPolicyChanged) {
+		return fmt.Errorf("%w; run acl plan again and review the new diff", err)
+	}
+	if err != nil {
+		return err
+	}
+	if len(plan.Changes) > 0 {
+		logs.Info("tsnet acl apply: pushed %d change(s) to tailnet %s", len(plan.Changes), client.Tailnet)
+	}
+	return nil
+}
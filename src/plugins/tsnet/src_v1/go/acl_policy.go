@@ -0,0 +1,446 @@
+package tsnet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tailscale/hujson"
+)
+
+// PolicyFile is tailnet policy source as HuJSON plus the ETag it was read at.
+type PolicyFile struct {
+	HuJSON []byte
+	ETag   string
+}
+
+var ErrPolicyChanged = errors.New("live tailnet policy changed since it was read")
+
+// ACLPolicy holds the parts of a tailnet policy file that acl test
+// evaluates. Doc keeps every section for diffs.
+type ACLPolicy struct {
+	Groups    map[string][]string `json:"groups"`
+	TagOwners map[string][]string `json:"tagOwners"`
+	Hosts     map[string]string   `json:"hosts"`
+	ACLs      []ACLRule           `json:"acls"`
+	Tests     []ACLTest           `json:"tests"`
+
+	Doc map[string]any `json:"-"`
+}
+
+type ACLRule struct {
+	Action string   `json:"action"`
+	Src    []string `json:"src"`
+	Dst    []string `json:"dst"`
+	Proto  string   `json:"proto,omitempty"`
+}
+
+// ACLTest is a policy-file test: Src must reach every Accept destination
+// and none of the Deny destinations, each written as "host:port".
+type ACLTest struct {
+	Src    string   `json:"src"`
+	Accept []string `json:"accept,omitempty"`
+	Deny   []string `json:"deny,omitempty"`
+}
+
+type ACLTestResult struct {
+	Src    string `json:"src"`
+	Dst    string `json:"dst"`
+	Want   string `json:"want"`
+	Got    string `json:"got"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+}
+
+func ParseACLPolicy(src []byte) (*ACLPolicy, error) {
+	std, err := hujson.Standardize(append([]byte(nil), src...))
+	if err != nil {
+		return nil, fmt.Errorf("parse policy hujson: %w", err)
+	}
+	var p ACLPolicy
+	if err := json.Unmarshal(std, &p); err != nil {
+		return nil, fmt.Errorf("decode policy: %w", err)
+	}
+	if err := json.Unmarshal(std, &p.Doc); err != nil {
+		return nil, fmt.Errorf("decode policy: %w", err)
+	}
+	if p.Doc == nil {
+		p.Doc = map[string]any{}
+	}
+	return &p, nil
+}
+
+var knownAutogroups = map[string]bool{
+	"autogroup:member":   true,
+	"autogroup:self":     true,
+	"autogroup:tagged":   true,
+	"autogroup:internet": true,
+	"autogroup:admin":    true,
+	"autogroup:owner":    true,
+	"autogroup:shared":   true,
+	"autogroup:nonroot":  true,
+}
+
+// Validate reports references to undefined groups, tags and hosts and
+// malformed destinations. An empty result means the policy is usable.
+func (p *ACLPolicy) Validate() []string {
+	var problems []string
+	checkRef := func(where, ref string) {
+		if msg := p.checkAlias(ref); msg != "" {
+			problems = append(problems, fmt.Sprintf("%s: %s", where, msg))
+		}
+	}
+	for tag, owners := range p.TagOwners {
+		if !strings.HasPrefix(tag, "tag:") {
+			problems = append(problems, fmt.Sprintf("tagOwners: %q must start with tag:", tag))
+		}
+		for _, owner := range owners {
+			checkRef("tagOwners["+tag+"]", owner)
+		}
+	}
+	for i, rule := range p.ACLs {
+		where := fmt.Sprintf("acls[%d]", i)
+		if rule.Action != "accept" {
+			problems = append(problems, fmt.Sprintf("%s: action %q is not accept", where, rule.Action))
+		}
+		if len(rule.Src) == 0 || len(rule.Dst) == 0 {
+			problems = append(problems, where+": src and dst are required")
+		}
+		for _, src := range rule.Src {
+			checkRef(where+" src", src)
+		}
+		for _, dst := range rule.Dst {
+			host, ports, err := splitACLDst(dst)
+			if err == nil {
+				_, err = parsePortRanges(ports)
+			}
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s dst %q: %v", where, dst, err))
+				continue
+			}
+			checkRef(where+" dst", host)
+		}
+	}
+	for i, test := range p.Tests {
+		where := fmt.Sprintf("tests[%d]", i)
+		checkRef(where+" src", test.Src)
+		for _, dst := range append(append([]string(nil), test.Accept...), test.Deny...) {
+			host, port, err := splitACLDst(dst)
+			if err == nil {
+				_, err = strconv.ParseUint(port, 10, 16)
+			}
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s dst %q: want host:port", where, dst))
+				continue
+			}
+			checkRef(where+" dst", host)
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+func (p *ACLPolicy) checkAlias(ref string) string {
+	switch {
+	case ref == "*" || strings.Contains(ref, "@"):
+		return ""
+	case strings.HasPrefix(ref, "group:"):
+		if _, ok := p.Groups[ref]; !ok {
+			return "undefined group " + ref
+		}
+	case strings.HasPrefix(ref, "tag:"):
+		if _, ok := p.TagOwners[ref]; !ok {
+			return "tag " + ref + " has no tagOwners entry"
+		}
+	case strings.HasPrefix(ref, "autogroup:"):
+		if !knownAutogroups[ref] {
+			return "unknown " + ref
+		}
+	default:
+		if _, err := netip.ParsePrefix(ref); err == nil {
+			return ""
+		}
+		if _, err := netip.ParseAddr(ref); err == nil {
+			return ""
+		}
+		if _, ok := p.Hosts[ref]; !ok {
+			return "undefined host " + ref
+		}
+	}
+	return ""
+}
+
+// Allows reports whether src may reach dst ("host:port") under the acls.
+func (p *ACLPolicy) Allows(src, dst string) (bool, error) {
+	host, portText, err := splitACLDst(dst)
+	if err != nil {
+		return false, err
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil {
+		return false, fmt.Errorf("destination %q needs a single port", dst)
+	}
+	for _, rule := range p.ACLs {
+		if rule.Action != "accept" || !p.anyMatch(rule.Src, src, "") {
+			continue
+		}
+		for _, ruleDst := range rule.Dst {
+			ruleHost, rulePorts, err := splitACLDst(ruleDst)
+			if err != nil {
+				continue
+			}
+			ranges, err := parsePortRanges(rulePorts)
+			if err != nil || !portInRanges(uint16(port), ranges) {
+				continue
+			}
+			if p.matches(ruleHost, host, src) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (p *ACLPolicy) anyMatch(patterns []string, principal, self string) bool {
+	for _, pattern := range patterns {
+		if p.matches(pattern, principal, self) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether an ACL alias covers principal, which is a user
+// email, a tag, a host alias or an IP. self is the source principal when
+// matching a destination, for autogroup:self.
+func (p *ACLPolicy) matches(pattern, principal, self string) bool {
+	isUser := strings.Contains(principal, "@") && !strings.HasPrefix(principal, "tag:")
+	switch {
+	case pattern == "*" || strings.EqualFold(pattern, principal):
+		return true
+	case strings.HasPrefix(pattern, "group:"):
+		for _, member := range p.Groups[pattern] {
+			if strings.EqualFold(member, principal) {
+				return true
+			}
+		}
+		return false
+	case pattern == "autogroup:member":
+		return isUser
+	case pattern == "autogroup:tagged":
+		return strings.HasPrefix(principal, "tag:")
+	case pattern == "autogroup:self":
+		return isUser && strings.EqualFold(principal, self)
+	case strings.HasPrefix(pattern, "autogroup:") || strings.HasPrefix(pattern, "tag:"):
+		return false
+	}
+	prefix, ok := p.resolvePrefix(pattern)
+	if !ok {
+		return false
+	}
+	target, ok := p.resolvePrefix(principal)
+	return ok && target.Bits() >= prefix.Bits() && prefix.Contains(target.Addr())
+}
+
+func (p *ACLPolicy) resolvePrefix(ref string) (netip.Prefix, bool) {
+	if alias, ok := p.Hosts[ref]; ok {
+		ref = alias
+	}
+	if prefix, err := netip.ParsePrefix(ref); err == nil {
+		return prefix.Masked(), true
+	}
+	if addr, err := netip.ParseAddr(ref); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), true
+	}
+	return netip.Prefix{}, false
+}
+
+// RunTests evaluates the policy's tests section locally.
+func (p *ACLPolicy) RunTests() []ACLTestResult {
+	var out []ACLTestResult
+	run := func(src, dst, want string) {
+		res := ACLTestResult{Src: src, Dst: dst, Want: want}
+		allowed, err := p.Allows(src, dst)
+		switch {
+		case err != nil:
+			res.Error = err.Error()
+		case allowed:
+			res.Got = "accept"
+		default:
+			res.Got = "deny"
+		}
+		res.Passed = err == nil && res.Got == want
+		out = append(out, res)
+	}
+	for _, test := range p.Tests {
+		for _, dst := range test.Accept {
+			run(test.Src, dst, "accept")
+		}
+		for _, dst := range test.Deny {
+			run(test.Src, dst, "deny")
+		}
+	}
+	return out
+}
+
+func splitACLDst(dst string) (string, string, error) {
+	i := strings.LastIndex(dst, ":")
+	if i <= 0 || i == len(dst)-1 {
+		return "", "", fmt.Errorf("want host:ports")
+	}
+	return dst[:i], dst[i+1:], nil
+}
+
+type portRange struct{ lo, hi uint16 }
+
+func parsePortRanges(spec string) ([]portRange, error) {
+	if spec == "*" {
+		return []portRange{{0, 65535}}, nil
+	}
+	var out []portRange
+	for _, part := range strings.Split(spec, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		a, err := strconv.ParseUint(lo, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("bad port %q", part)
+		}
+		b := a
+		if isRange {
+			if b, err = strconv.ParseUint(hi, 10, 16); err != nil || b < a {
+				return nil, fmt.Errorf("bad port range %q", part)
+			}
+		}
+		out = append(out, portRange{uint16(a), uint16(b)})
+	}
+	return out, nil
+}
+
+func portInRanges(port uint16, ranges []portRange) bool {
+	for _, r := range ranges {
+		if port >= r.lo && port <= r.hi {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyChange is one difference between the live and desired policy.
+// Path is "section" or "section[key]"; list sections report whole entries.
+type PolicyChange struct {
+	Op     string `json:"op"`
+	Path   string `json:"path"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+func (c PolicyChange) String() string {
+	switch c.Op {
+	case "+":
+		return fmt.Sprintf("+ %s %s", c.Path, c.After)
+	case "-":
+		return fmt.Sprintf("- %s %s", c.Path, c.Before)
+	default:
+		return fmt.Sprintf("~ %s %s -> %s", c.Path, c.Before, c.After)
+	}
+}
+
+// DiffACLPolicy compares two policies section by section, ignoring
+// comments, formatting, key order and the order of list entries.
+func DiffACLPolicy(live, desired *ACLPolicy) []PolicyChange {
+	keys := map[string]bool{}
+	for k := range live.Doc {
+		keys[k] = true
+	}
+	for k := range desired.Doc {
+		keys[k] = true
+	}
+	sections := make([]string, 0, len(keys))
+	for k := range keys {
+		sections = append(sections, k)
+	}
+	sort.Strings(sections)
+
+	var out []PolicyChange
+	for _, section := range sections {
+		before, hasBefore := live.Doc[section]
+		after, hasAfter := desired.Doc[section]
+		beforeMap, bIsMap := before.(map[string]any)
+		afterMap, aIsMap := after.(map[string]any)
+		beforeList, bIsList := before.([]any)
+		afterList, aIsList := after.([]any)
+		switch {
+		case (bIsMap || !hasBefore) && (aIsMap || !hasAfter):
+			out = append(out, diffPolicyMaps(section, beforeMap, afterMap)...)
+		case (bIsList || !hasBefore) && (aIsList || !hasAfter):
+			out = append(out, diffPolicyLists(section, beforeList, afterList)...)
+		case compactJSON(before) != compactJSON(after):
+			out = append(out, PolicyChange{Op: "~", Path: section, Before: compactJSON(before), After: compactJSON(after)})
+		}
+	}
+	return out
+}
+
+func diffPolicyMaps(section string, before, after map[string]any) []PolicyChange {
+	keys := map[string]bool{}
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	var out []PolicyChange
+	for _, k := range sorted {
+		path := section + "[" + k + "]"
+		b, hasB := before[k]
+		a, hasA := after[k]
+		switch {
+		case !hasB:
+			out = append(out, PolicyChange{Op: "+", Path: path, After: compactJSON(a)})
+		case !hasA:
+			out = append(out, PolicyChange{Op: "-", Path: path, Before: compactJSON(b)})
+		case compactJSON(b) != compactJSON(a):
+			out = append(out, PolicyChange{Op: "~", Path: path, Before: compactJSON(b), After: compactJSON(a)})
+		}
+	}
+	return out
+}
+
+func diffPolicyLists(section string, before, after []any) []PolicyChange {
+	remaining := map[string]int{}
+	for _, item := range before {
+		remaining[compactJSON(item)]++
+	}
+	var added []PolicyChange
+	for _, item := range after {
+		key := compactJSON(item)
+		if remaining[key] > 0 {
+			remaining[key]--
+			continue
+		}
+		added = append(added, PolicyChange{Op: "+", Path: section, After: key})
+	}
+	var removed []PolicyChange
+	for _, item := range before {
+		key := compactJSON(item)
+		if remaining[key] > 0 {
+			remaining[key]--
+			removed = append(removed, PolicyChange{Op: "-", Path: section, Before: key})
+		}
+	}
+	return append(removed, added...)
+}
+
+// compactJSON renders v with sorted keys, so equal values compare equal.
+func compactJSON(v any) string {
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
@@ -0,0 +1,182 @@
+package tsnet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeTailnet keeps one policy file and bumps its ETag on every write.
+type fakeTailnet struct {
+	policy []byte
+	etag   int
+	writes int
+	acl    map[string]any
+}
+
+func (f *fakeTailnet) ListKeys() ([]AuthKey, error)   { return nil, nil }
+func (f *fakeTailnet) RevokeKey(string) error         { return nil }
+func (f *fakeTailnet) ListDevices() ([]Device, error) { return nil, nil }
+func (f *fakeTailnet) DeleteDevice(string) error      { return nil }
+
+func (f *fakeTailnet) GetACL() (map[string]any, error) {
+	if f.acl != nil {
+		return f.acl, nil
+	}
+	p, err := ParseACLPolicy(f.policy)
+	if err != nil {
+		return nil, err
+	}
+	return p.Doc, nil
+}
+
+func (f *fakeTailnet) SetACL(policy any) error {
+	raw, _ := json.Marshal(policy)
+	_, err := f.SetPolicyFile(raw, "")
+	return err
+}
+
+func (f *fakeTailnet) GetPolicyFile() (PolicyFile, error) {
+	return PolicyFile{HuJSON: f.policy, ETag: f.currentETag()}, nil
+}
+
+func (f *fakeTailnet) SetPolicyFile(huJSON []byte, ifMatch string) (PolicyFile, error) {
+	if ifMatch != "" && ifMatch != f.currentETag() {
+		return PolicyFile{}, ErrPolicyChanged
+	}
+	f.policy = append([]byte(nil), huJSON...)
+	f.etag++
+	f.writes++
+	f.acl = nil
+	return f.GetPolicyFile()
+}
+
+func (f *fakeTailnet) currentETag() string {
+	return fmt.Sprintf("%q", fmt.Sprint("v", f.etag))
+}
+
+func TestRepoPolicyValidatesAndPassesTests(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("..", "acl", "policy.hujson"))
+	if err != nil {
+		t.Fatalf("read repo policy: %v", err)
+	}
+	plan, _, err := CheckACLPolicy(raw)
+	if err != nil {
+		t.Fatalf("CheckACLPolicy returned error: %v", err)
+	}
+	if len(plan.Problems) > 0 || len(plan.FailedTests()) > 0 || len(plan.Tests) == 0 {
+		t.Fatalf("repo policy: problems=%v failed=%+v", plan.Problems, plan.FailedTests())
+	}
+}
+
+func TestACLPolicyEvaluation(t *testing.T) {
+	policy, err := ParseACLPolicy([]byte(`{
+		// comments and trailing commas are HuJSON
+		"groups": {"group:ops": ["amy@example.com"]},
+		"tagOwners": {"tag:robot": ["group:ops"]},
+		"hosts": {"lab": "100.64.0.0/24", "cam": "100.64.0.7"},
+		"acls": [
+			{"action": "accept", "src": ["group:ops"], "dst": ["tag:robot:22,8000-8100"]},
+			{"action": "accept", "src": ["tag:robot"], "dst": ["lab:4222"]},
+			{"action": "accept", "src": ["autogroup:member"], "dst": ["autogroup:self:*"]},
+		],
+		"tests": [
+			{"src": "amy@example.com", "accept": ["tag:robot:8080"], "deny": ["tag:robot:9000"]},
+			{"src": "tag:robot", "accept": ["cam:4222"], "deny": ["cam:22"]},
+			{"src": "bob@example.com", "accept": ["bob@example.com:22"], "deny": ["amy@example.com:22", "tag:robot:22"]},
+		],
+	}`))
+	if err != nil {
+		t.Fatalf("ParseACLPolicy returned error: %v", err)
+	}
+	if problems := policy.Validate(); len(problems) != 0 {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+	for _, res := range policy.RunTests() {
+		if !res.Passed {
+			t.Fatalf("test failed: %+v", res)
+		}
+	}
+
+	bad, _ := ParseACLPolicy([]byte(`{"acls": [{"action": "drop", "src": ["group:nope"], "dst": ["tag:ghost:70000"]}]}`))
+	problems := strings.Join(bad.Validate(), "\n")
+	for _, want := range []string{`action "drop"`, "undefined group group:nope", `bad port "70000"`} {
+		if !strings.Contains(problems, want) {
+			t.Fatalf("missing %q in problems:\n%s", want, problems)
+		}
+	}
+}
+
+func TestPlanAndApplyACLWithETag(t *testing.T) {
+	live := &fakeTailnet{policy: []byte(`{
+		"groups": {"group:ops": ["amy@example.com"]},
+		"acls": [{"action": "accept", "src": ["*"], "dst": ["*:*"]}],
+	}`)}
+	desired := []byte(`{
+		// tightened
+		"groups": {"group:ops": ["amy@example.com", "bob@example.com"]},
+		"acls": [{"action": "accept", "src": ["group:ops"], "dst": ["*:22"]}],
+		"tests": [{"src": "amy@example.com", "accept": ["100.64.0.1:22"], "deny": ["100.64.0.1:80"]}],
+	}`)
+
+	plan, err := PlanACL(live, desired)
+	if err != nil {
+		t.Fatalf("PlanACL returned error: %v", err)
+	}
+	var lines []string
+	for _, c := range plan.Changes {
+		lines = append(lines, c.String())
+	}
+	want := []string{
+		`- acls {"action":"accept","dst":["*:*"],"src":["*"]}`,
+		`+ acls {"action":"accept","dst":["*:22"],"src":["group:ops"]}`,
+		`~ groups[group:ops] ["amy@example.com"] -> ["amy@example.com","bob@example.com"]`,
+		`+ tests {"accept":["100.64.0.1:22"],"deny":["100.64.0.1:80"],"src":"amy@example.com"}`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected plan:\n%s", strings.Join(lines, "\n"))
+	}
+
+	// Someone edits the policy in the admin console after the plan.
+	staleETag := plan.ETag
+	live.policy = append(live.policy, ' ')
+	live.etag++
+	if _, err := ApplyACL(live, desired, staleETag); !errors.Is(err, ErrPolicyChanged) {
+		t.Fatalf("expected ErrPolicyChanged, got %v", err)
+	}
+	if live.writes != 0 {
+		t.Fatalf("stale apply wrote the policy")
+	}
+
+	if _, err := ApplyACL(live, desired, ""); err != nil {
+		t.Fatalf("ApplyACL returned error: %v", err)
+	}
+	if string(live.policy) != string(desired) {
+		t.Fatalf("HuJSON was not pushed verbatim")
+	}
+	if again, err := PlanACL(live, desired); err != nil || len(again.Changes) != 0 {
+		t.Fatalf("expected no drift after apply, got %+v %v", again.Changes, err)
+	}
+
+	failing := []byte(`{"acls": [], "tests": [{"src": "amy@example.com", "accept": ["100.64.0.1:22"]}]}`)
+	if _, err := ApplyACL(live, failing, ""); err == nil || live.writes != 1 {
+		t.Fatalf("policy with failing tests was applied: %v", err)
+	}
+}
+
+func TestEnsureDialtoneACLUsesInterface(t *testing.T) {
+	live := &fakeTailnet{policy: []byte(`{"acls": []}`)}
+	if err := ensureDialtoneACL(live, "example.ts.net", []string{"rover-1"}); err != nil {
+		t.Fatalf("ensureDialtoneACL returned error: %v", err)
+	}
+	if live.writes != 1 || !strings.Contains(string(live.policy), "autogroup:member:60000-61000") {
+		t.Fatalf("mosh rule not written: %s", live.policy)
+	}
+	if err := ensureDialtoneACL(live, "example.ts.net", []string{"rover-1"}); err != nil || live.writes != 1 {
+		t.Fatalf("second ensure should be a no-op: writes=%d err=%v", live.writes, err)
+	}
+}
@@ -0,0 +1,40 @@
+package tsnet
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	diagnosticv1 "dialtone/dev/plugins/diagnostic/src_v1/go"
+)
+
+// RegisterDiagnostics adds the tsnet.* checks to r.
+func RegisterDiagnostics(r *diagnosticv1.Registry) error {
+	return r.Register(diagnosticv1.Check{
+		Name:        "tsnet.tailnet",
+		Description: "Host has an active native tailnet connection",
+		Severity:    diagnosticv1.SeverityInfo,
+		LocalOnly:   true,
+		Remediation: "run tailscale up, or let the REPL leader join with embedded tsnet",
+		Run: func(ctx context.Context, t diagnosticv1.Target) (string, error) {
+			type result struct {
+				active            bool
+				provider, tailnet string
+			}
+			done := make(chan result, 1)
+			go func() {
+				active, provider, tailnet := NativeTailnetConnected()
+				done <- result{active: active, provider: provider, tailnet: tailnet}
+			}()
+			select {
+			case r := <-done:
+				if !r.active {
+					return "", fmt.Errorf("no active tailnet")
+				}
+				return fmt.Sprintf("provider=%s tailnet=%s", r.provider, strings.TrimSpace(r.tailnet)), nil
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		},
+	})
+}
@@ -12,6 +12,7 @@ type Paths struct {
 	PluginVersionRoot string
 	TestCmdMain       string
 	TestTmpEnv        string
+	ACLPolicy         string
 }
 
 func ResolvePaths(start string) (Paths, error) {
@@ -26,5 +27,6 @@ func ResolvePaths(start string) (Paths, error) {
 		PluginVersionRoot: preset.PluginVersionRoot,
 		TestCmdMain:       filepath.Join(preset.TestCmd, "main.go"),
 		TestTmpEnv:        filepath.Join(preset.Test, "tmp.env"),
+		ACLPolicy:         filepath.Join(preset.PluginVersionRoot, "acl", "policy.hujson"),
 	}, nil
 }
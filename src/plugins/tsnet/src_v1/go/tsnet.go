@@ -102,6 +102,9 @@ func PrintUsage() {
 	logs.Raw("  keys usage [--tailnet N] [--api-key K]")
 	logs.Raw("  acl get [--tailnet N] [--api-key K]")
 	logs.Raw("  acl ensure [--tailnet N] [--api-key K] [--hostname H]")
+	logs.Raw("  acl plan [--file F] [--tailnet N] [--api-key K] [--format text|json] [--exit-code]")
+	logs.Raw("  acl test [--file F]                  Validate the repo policy and run its tests locally")
+	logs.Raw("  acl apply [--file F] [--if-match ETAG] [--yes] [--tailnet N] [--api-key K]")
 	logs.Raw("  test                                 Run tsnet plugin self-check")
 }
 
@@ -403,6 +406,19 @@ type KeyUsage struct {
 	Note        string   `json:"note"`
 }
 
+// tailnetAPI is the control-plane surface the commands use; tailscaleClient
+// implements it against api.tailscale.com.
+type tailnetAPI interface {
+	ListKeys() ([]AuthKey, error)
+	RevokeKey(keyID string) error
+	ListDevices() ([]Device, error)
+	DeleteDevice(deviceID string) error
+	GetACL() (map[string]any, error)
+	SetACL(policy any) error
+	GetPolicyFile() (PolicyFile, error)
+	SetPolicyFile(huJSON []byte, ifMatch string) (PolicyFile, error)
+}
+
 type tailscaleClient struct {
 	BaseURL string
 	APIKey  string
@@ -410,6 +426,8 @@ type tailscaleClient struct {
 	HTTP    *http.Client
 }
 
+var _ tailnetAPI = (*tailscaleClient)(nil)
+
 func runKeys(args []string) error {
 	args = stripAllVersionArgs(args)
 	if len(args) == 0 {
@@ -452,13 +470,19 @@ func runDevices(args []string) error {
 func runACL(args []string) error {
 	args = stripAllVersionArgs(args)
 	if len(args) == 0 {
-		return fmt.Errorf("usage: ./dialtone.sh tsnet acl <get|ensure> [--tailnet N] [--api-key K] [--hostname H]")
+		return fmt.Errorf("usage: ./dialtone.sh tsnet acl <get|ensure|plan|test|apply> [--tailnet N] [--api-key K] [--hostname H] [--file F]")
 	}
 	switch args[0] {
 	case "get":
 		return runACLGet(args[1:])
 	case "ensure":
 		return runACLEnsure(args[1:])
+	case "plan", "diff":
+		return runACLPlan(args[1:])
+	case "test":
+		return runACLTest(args[1:])
+	case "apply":
+		return runACLApply(args[1:])
 	default:
 		return fmt.Errorf("unknown acl subcommand: %s", args[0])
 	}
@@ -1364,6 +1388,63 @@ func (c *tailscaleClient) SetACL(policy any) error {
 	return fmt.Errorf("tailscale ACL update failed (POST, /policy PUT, wrapped POST variants): post=%v putPolicy=%v postUpper=%v postLower=%v", errPost, errPutPolicy, errPostUpper, errPostLower)
 }
 
+// GetPolicyFile reads the policy as HuJSON, comments included, with the
+// ETag to pass back to SetPolicyFile.
+func (c *tailscaleClient) GetPolicyFile() (PolicyFile, error) {
+	body, header, err := c.doHuJSON("GET", nil, "")
+	if err != nil {
+		return PolicyFile{}, err
+	}
+	return PolicyFile{HuJSON: body, ETag: header.Get("ETag")}, nil
+}
+
+// SetPolicyFile replaces the policy. A non-empty ifMatch makes the write
+// conditional and returns ErrPolicyChanged when the live ETag differs.
+func (c *tailscaleClient) SetPolicyFile(huJSON []byte, ifMatch string) (PolicyFile, error) {
+	body, header, err := c.doHuJSON("POST", huJSON, ifMatch)
+	if err != nil {
+		return PolicyFile{}, err
+	}
+	return PolicyFile{HuJSON: body, ETag: header.Get("ETag")}, nil
+}
+
+func (c *tailscaleClient) doHuJSON(method string, body []byte, ifMatch string) ([]byte, http.Header, error) {
+	endpoint := fmt.Sprintf("%s/api/v2/tailnet/%s/acl", strings.TrimSuffix(c.BaseURL, "/"), url.PathEscape(c.Tailnet))
+	var payload io.Reader
+	if body != nil {
+		payload = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, endpoint, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.SetBasicAuth(c.APIKey, "")
+	req.Header.Set("Accept", "application/hujson")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/hujson")
+	}
+	if strings.TrimSpace(ifMatch) != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBytes, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return nil, nil, ErrPolicyChanged
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(respBytes))
+		if msg == "" {
+			msg = resp.Status
+		}
+		return nil, nil, fmt.Errorf("tailscale api %s %s failed: %s", method, endpoint, msg)
+	}
+	return respBytes, resp.Header, nil
+}
+
 func (c *tailscaleClient) do(method, path string, body any, out any) error {
 	path = strings.TrimPrefix(path, "/")
 	endpoint := fmt.Sprintf("%s/api/v2/tailnet/%s/%s", strings.TrimSuffix(c.BaseURL, "/"), url.PathEscape(c.Tailnet), path)
@@ -1502,6 +1583,10 @@ func EnsureDialtoneACL(apiKey, tailnet string, hostnames ...string) error {
 	if err != nil {
 		return err
 	}
+	return ensureDialtoneACL(client, client.Tailnet, hostnames)
+}
+
+func ensureDialtoneACL(client tailnetAPI, tailnet string, hostnames []string) error {
 	acl, err := client.GetACL()
 	if err != nil {
 		return fmt.Errorf("fetch ACL failed: %w", err)
@@ -1512,7 +1597,7 @@ func EnsureDialtoneACL(apiKey, tailnet string, hostnames ...string) error {
 		return err
 	}
 	if !updated {
-		logs.Info("tsnet ACL already allows mosh for %s in tailnet %s", strings.Join(hostnames, ", "), client.Tailnet)
+		logs.Info("tsnet ACL already allows mosh for %s in tailnet %s", strings.Join(hostnames, ", "), tailnet)
 		return nil
 	}
 	var payload any = policy
@@ -1529,7 +1614,7 @@ func EnsureDialtoneACL(apiKey, tailnet string, hostnames ...string) error {
 	if err := client.SetACL(payload); err != nil {
 		return fmt.Errorf("set ACL failed: %w", err)
 	}
-	logs.Info("Updated tsnet ACL for mosh access: tailnet=%s hosts=%s", client.Tailnet, strings.Join(hostnames, ", "))
+	logs.Info("Updated tsnet ACL for mosh access: tailnet=%s hosts=%s", tailnet, strings.Join(hostnames, ", "))
 	return nil
 }
 